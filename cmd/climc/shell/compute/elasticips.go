@@ -34,5 +34,6 @@ func init() {
 	cmd.Perform("sync", &options.BaseIdOptions{})
 	cmd.Perform("syncstatus", &options.BaseIdOptions{})
 	cmd.Perform("change-bandwidth", &compute.EipChangeBandwidthOptions{})
+	cmd.Perform("set-qos-policy", &compute.EipSetQosPolicyOptions{})
 	cmd.Perform("change-owner", &compute.EipChangeOwnerOptions{})
 }
@@ -43,6 +43,7 @@ func init() {
 	cmd.Perform("syncstatus", &compute_options.NetworkIdOptions{})
 	cmd.Perform("sync", &compute_options.NetworkIdOptions{})
 	cmd.Perform("purge", &compute_options.NetworkIdOptions{})
+	cmd.Perform("set-qos-policy", &compute_options.NetworkSetQosPolicyOptions{})
 	cmd.Get("change-owner-candidate-domains", &compute_options.NetworkIdOptions{})
 	cmd.Perform("set-class-metadata", &options.ResourceMetadataOptions{})
 	cmd.Perform("switch-wire", &compute_options.NetworkSwitchWireOptions{})
@@ -30,5 +30,7 @@ func init() {
 	cmd.Perform("syncstatus", &options.RouteTableIdOptions{})
 	cmd.Perform("add-routes", &options.RouteTableAddRoutesOptions{})
 	cmd.Perform("del-routes", &options.RouteTableDelRoutesOptions{})
+	cmd.Perform("add-policies", &options.RouteTableAddPoliciesOptions{})
+	cmd.Perform("del-policies", &options.RouteTableDelPoliciesOptions{})
 	cmd.Perform("purge", &options.RouteTableIdOptions{})
 }
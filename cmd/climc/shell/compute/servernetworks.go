@@ -164,6 +164,35 @@ func init() {
 		return nil
 	})
 
+	type ServerNetworkQosPolicyOptions struct {
+		SERVER    string `help:"ID or Name of server"`
+		MACORIP   string `help:"IP, Mac, or Index of NIC"`
+		QosPolicy string `help:"ID or Name of qos policy, leave empty to use that of the network"`
+	}
+	R(&ServerNetworkQosPolicyOptions{}, "server-set-nic-qos-policy", "Set qos policy of server network", func(s *mcclient.ClientSession, args *ServerNetworkQosPolicyOptions) error {
+		params := jsonutils.NewDict()
+		if regutils.MatchMacAddr(args.MACORIP) {
+			params.Add(jsonutils.NewString(args.MACORIP), "mac")
+		} else if regutils.MatchIP4Addr(args.MACORIP) {
+			params.Add(jsonutils.NewString(args.MACORIP), "ip_addr")
+		} else if regutils.MatchInteger(args.MACORIP) {
+			index, err := strconv.ParseInt(args.MACORIP, 10, 64)
+			if err != nil {
+				return err
+			}
+			params.Add(jsonutils.NewInt(index), "index")
+		} else {
+			return fmt.Errorf("Please specify Ip or Mac")
+		}
+		params.Add(jsonutils.NewString(args.QosPolicy), "qos_policy_id")
+		server, err := modules.Servers.PerformAction(s, args.SERVER, "set-nic-qos-policy", params)
+		if err != nil {
+			return err
+		}
+		printObject(server)
+		return nil
+	})
+
 	type ServerAttachNetworkOptions struct {
 		SERVER            string   `help:"ID or Name of server"`
 		DisableSyncConfig bool     `help:"Disable sync config"`
@@ -70,6 +70,7 @@ func init() {
 	cmd.PrintObjectYAML().Perform("migrate-forecast", new(options.ServerMigrateForecastOptions))
 	cmd.Perform("migrate", new(options.ServerMigrateOptions))
 	cmd.Perform("live-migrate", new(options.ServerLiveMigrateOptions))
+	cmd.Perform("cross-region-migrate", new(options.ServerCrossRegionMigrateOptions))
 	cmd.BatchPerform("cancel-live-migrate", new(options.ServerIdsOptions))
 	cmd.Perform("set-live-migrate-params", new(options.ServerSetLiveMigrateParamsOptions))
 	cmd.Perform("modify-src-check", new(options.ServerModifySrcCheckOptions))
@@ -741,6 +742,7 @@ func init() {
 		ID         string `help:"ID or name of VM" json:"-"`
 		SNAPSHOT   string `help:"Instance snapshot name" json:"name"`
 		WithMemory bool   `help:"Save memory state" json:"with_memory"`
+		Consistent bool   `help:"Freeze guest filesystems by qemu-guest-agent during snapshot" json:"consistent"`
 	}
 	R(&ServerCreateSnapshot{}, "instance-snapshot-create", "create instance snapshot", func(s *mcclient.ClientSession, opts *ServerCreateSnapshot) error {
 		params := jsonutils.Marshal(opts)
@@ -755,6 +757,7 @@ func init() {
 		ID              string `help:"ID or name of VM" json:"-"`
 		BACKUP          string `help:"Instance backup name" json:"name"`
 		BACKUPSTORAGEID string `help:"backup storage id" json:"backup_storage_id"`
+		Consistent      bool   `help:"Freeze guest filesystems by qemu-guest-agent during backup" json:"consistent"`
 	}
 	R(&ServerCreateBackup{}, "server-create-instance-backup", "create instance backup", func(s *mcclient.ClientSession, opts *ServerCreateBackup) error {
 		params := jsonutils.Marshal(opts)
@@ -66,6 +66,51 @@ func RegisterTaskCmds(service string, manager modulebase.Manager, archivedManage
 		return nil
 	})
 
+	R(&TaskShowOptions{}, fmt.Sprintf("%s-task-tree", service), fmt.Sprintf("Show the subtask tree of a %s task with stage timings", service), func(s *mcclient.ClientSession, args *TaskShowOptions) error {
+		result, err := manager.GetSpecific(s, args.ID, "tree", nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	type TaskRetryOptions struct {
+		ID string `help:"ID of the task"`
+		apis.TaskRetryInput
+	}
+	R(&TaskRetryOptions{}, fmt.Sprintf("%s-task-retry", service), fmt.Sprintf("Retry a failed %s task from its failed stage", service), func(s *mcclient.ClientSession, args *TaskRetryOptions) error {
+		result, err := manager.PerformAction(s, args.ID, "retry", jsonutils.Marshal(args.TaskRetryInput))
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	type TaskQueuesOptions struct {
+	}
+	R(&TaskQueuesOptions{}, fmt.Sprintf("%s-task-queues", service), fmt.Sprintf("Show queued tasks of each project on %s server", service), func(s *mcclient.ClientSession, args *TaskQueuesOptions) error {
+		result, err := manager.Get(s, "queues", nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	type TaskReprioritizeOptions struct {
+		apis.TaskReprioritizeInput
+	}
+	R(&TaskReprioritizeOptions{}, fmt.Sprintf("%s-task-reprioritize", service), fmt.Sprintf("Reprioritize queued tasks or set the weight of a project on %s server", service), func(s *mcclient.ClientSession, args *TaskReprioritizeOptions) error {
+		result, err := manager.PerformClassAction(s, "reprioritize", jsonutils.Marshal(args.TaskReprioritizeInput))
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
 	R(&TaskListOptions{}, fmt.Sprintf("%s-archived-task-list", service), fmt.Sprintf("List archived tasks on %s server", service), func(s *mcclient.ClientSession, args *TaskListOptions) error {
 		params := jsonutils.Marshal(args)
 		result, err := archivedManager.List(s, params)
@@ -93,6 +138,47 @@ func RegisterTaskCmds(service string, manager modulebase.Manager, archivedManage
 			return errors.Wrapf(errors.ErrDuplicateId, "found %d record for %s", result.Total, args.ID)
 		}
 	})
+
+	// fetch the id of the latest archived record of a task
+	archivedTaskId := func(s *mcclient.ClientSession, taskId string) (string, error) {
+		params := jsonutils.NewDict()
+		params.Set("task_id", jsonutils.NewString(taskId))
+		params.Set("limit", jsonutils.NewInt(1))
+		result, err := archivedManager.List(s, params)
+		if err != nil {
+			return "", err
+		}
+		if len(result.Data) == 0 {
+			return "", errors.Wrapf(errors.ErrNotFound, "not found %s", taskId)
+		}
+		return result.Data[0].GetString("id")
+	}
+
+	R(&TaskShowOptions{}, fmt.Sprintf("%s-archived-task-tree", service), fmt.Sprintf("Show the subtask tree of an archived %s task with stage timings", service), func(s *mcclient.ClientSession, args *TaskShowOptions) error {
+		id, err := archivedTaskId(s, args.ID)
+		if err != nil {
+			return err
+		}
+		result, err := archivedManager.GetSpecific(s, id, "tree", nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	R(&TaskRetryOptions{}, fmt.Sprintf("%s-archived-task-retry", service), fmt.Sprintf("Restore an archived failed %s task and retry it from its failed stage", service), func(s *mcclient.ClientSession, args *TaskRetryOptions) error {
+		id, err := archivedTaskId(s, args.ID)
+		if err != nil {
+			return err
+		}
+		result, err := archivedManager.PerformAction(s, id, "retry", jsonutils.Marshal(args.TaskRetryInput))
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
 }
 
 func init() {
@@ -24,4 +24,5 @@ func init() {
 	cmd.List(new(options.AlertRecordListOptions))
 	cmd.Show(new(options.AlertRecordShowOptions))
 	cmd.Get("", new(options.AlertRecordTotalOptions))
+	cmd.Perform("ack", new(options.AlertRecordAckOptions))
 }
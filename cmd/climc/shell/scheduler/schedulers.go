@@ -58,6 +58,20 @@ func init() {
 			return nil
 		})
 
+	R(&options.SchedulerExplainOptions{}, "scheduler-explain", "Explain why each candidate is accepted or rejected by scheduler",
+		func(s *mcclient.ClientSession, args *options.SchedulerExplainOptions) error {
+			params, err := args.Params(s)
+			if err != nil {
+				return err
+			}
+			result, err := modules.SchedManager.DoExplain(s, params.JSON(params))
+			if err != nil {
+				return err
+			}
+			fmt.Println(result.YAMLString())
+			return nil
+		})
+
 	type SchedulerCandidateListOptions struct {
 		Type   string `help:"Sched type filter" choices:"baremetal|host"`
 		Region string `help:"Cloud region ID"`
@@ -182,6 +196,87 @@ func init() {
 			return nil
 		})
 
+	R(&options.SchedulerRebalanceOptions{}, "scheduler-rebalance-plan", "Compute a dry-run migration plan to rebalance hosts",
+		func(s *mcclient.ClientSession, args *options.SchedulerRebalanceOptions) error {
+			params, err := args.Params()
+			if err != nil {
+				return err
+			}
+			result, err := modules.SchedManager.RebalancePlan(s, params)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result.YAMLString())
+			return nil
+		})
+
+	R(&options.SchedulerRebalanceExecuteOptions{}, "scheduler-rebalance-execute", "Execute a computed rebalance plan by live migration",
+		func(s *mcclient.ClientSession, args *options.SchedulerRebalanceExecuteOptions) error {
+			params, err := args.Params()
+			if err != nil {
+				return err
+			}
+			result, err := modules.SchedManager.RebalanceExecute(s, params)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result.YAMLString())
+			return nil
+		})
+
+	type SchedulerRebalanceShowOptions struct {
+		ID string `help:"Rebalance plan ID"`
+	}
+	R(&SchedulerRebalanceShowOptions{}, "scheduler-rebalance-show", "Show rebalance plan and its executing progress",
+		func(s *mcclient.ClientSession, args *SchedulerRebalanceShowOptions) error {
+			result, err := modules.SchedManager.RebalanceShow(s, args.ID)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result.YAMLString())
+			return nil
+		})
+
+	type SchedulerReservedResourcesOptions struct {
+		Release string `help:"Release the all-or-nothing reservation of the session" json:"remove"`
+	}
+	R(&SchedulerReservedResourcesOptions{}, "scheduler-reserved-resources", "List all-or-nothing reservations of scheduler",
+		func(s *mcclient.ClientSession, args *SchedulerReservedResourcesOptions) error {
+			params := jsonutils.NewDict()
+			if len(args.Release) > 0 {
+				params.Add(jsonutils.NewString(args.Release), "Remove")
+			}
+			result, err := modules.SchedManager.ReservedResources(s, params)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result.YAMLString())
+			return nil
+		})
+
+	type SchedulerReservationOptions struct {
+		SESSION string `help:"Schedule session id"`
+	}
+	R(&SchedulerReservationOptions{}, "scheduler-reservation-commit", "Commit all-or-nothing reservation of the session",
+		func(s *mcclient.ClientSession, args *SchedulerReservationOptions) error {
+			result, err := modules.SchedManager.CommitReservation(s, args.SESSION)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result.YAMLString())
+			return nil
+		})
+
+	R(&SchedulerReservationOptions{}, "scheduler-reservation-release", "Release all-or-nothing reservation of the session",
+		func(s *mcclient.ClientSession, args *SchedulerReservationOptions) error {
+			result, err := modules.SchedManager.ReleaseReservation(s, args.SESSION)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result.YAMLString())
+			return nil
+		})
+
 	type SyncOpt struct {
 		Wait bool `help:"wait sync finish"`
 	}
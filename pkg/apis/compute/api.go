@@ -409,6 +409,16 @@ type ServerConfigs struct {
 	// default: 1
 	Count int `json:"count"`
 
+	// 批量创建时要求全部调度成功, 任意一台调度失败则全部失败并释放调度器中的资源预留
+	// default: false
+	// required: false
+	AllOrNothing bool `json:"all_or_nothing"`
+
+	// all_or_nothing 模式下调度器资源预留的超时时间(秒), 超时未提交则释放全部预留
+	// 为0时使用调度器默认值
+	// required: false
+	ReservationTimeout int `json:"reservation_timeout"`
+
 	// 磁盘列表,第一块磁盘为系统盘,需要指定image_id
 	// 若指定主机快照，此参数可以为空
 	// required: true
@@ -531,6 +541,16 @@ type ServerCreateInput struct {
 	// emulate: pc, q35
 	Machine string `json:"machine"`
 
+	// 启用基于swtpm的TPM 2.0虚拟设备, 仅KVM平台支持
+	// TPM状态保存在系统盘所在目录, 随迁移、快照及备份一同保存
+	// default: false
+	EnableVtpm bool `json:"enable_vtpm"`
+
+	// 启用UEFI安全启动, 仅KVM x86_64平台支持
+	// 若未指定bios会自动设置为UEFI, 若未指定machine会自动设置为q35
+	// default: false
+	EnableSecureBoot bool `json:"enable_secure_boot"`
+
 	// 启动顺序
 	// c: cdrome
 	// d: disk
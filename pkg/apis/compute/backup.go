@@ -43,6 +43,7 @@ const (
 	BACKUP_STATUS_RECOVERY                = "recovery"
 	BACKUP_STATUS_RECOVERY_FAILED         = "recovery_failed"
 	BACKUP_STATUS_UNKNOWN                 = "unknown"
+	BACKUP_STATUS_MERGING                 = "merging"
 
 	BACKUP_EXIST     = "exist"
 	BACKUP_NOT_EXIST = "not_exist"
@@ -117,6 +118,8 @@ type DiskBackupDetails struct {
 	BackupStorageName string `json:"backup_storage_name"`
 	// description: 是否是子备份
 	IsSubBackup bool `json:"is_sub_backup"`
+	// description: 备份链, 从全量备份到当前备份
+	ChainBackupIds []string `json:"chain_backup_ids"`
 
 	SDiskBackup
 }
@@ -143,6 +146,14 @@ type DiskBackupCreateInput struct {
 	// swagger:ignore
 	ManagerId   string                `json:"manager_id"`
 	BackupAsTar *DiskBackupAsTarInput `json:"backup_as_tar"`
+
+	// description: 是否增量备份, 基于该硬盘在同一备份存储上最近的增量备份链, 没有则创建全量备份作为新备份链的起点
+	Incremental bool `json:"incremental"`
+	// description: 备份链保留的最大增量备份数量, 超出后最早的增量备份合并到全量备份, 0为不限制, 默认沿用父备份的设置
+	MaxIncrements *int `json:"max_increments"`
+
+	// description: 是否通过guest agent冻结文件系统创建一致性备份, 冻结失败时仍创建崩溃一致性备份
+	Consistent bool `json:"consistent"`
 }
 
 type DiskBackupRecoveryInput struct {
@@ -218,4 +229,6 @@ type ServerCreateInstanceBackupInput struct {
 	GenerateName string `json:"generate_name"`
 	// 备份存储ID
 	BackupStorageId string `json:"backup_storage_id"`
+	// 是否通过guest agent冻结文件系统创建一致性备份
+	Consistent bool `json:"consistent"`
 }
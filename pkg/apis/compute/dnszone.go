@@ -97,3 +97,73 @@ type DnsZoneRemoveVpcsInput struct {
 
 type DnsZonePurgeInput struct {
 }
+
+const (
+	DNSSEC_ALGORITHM_ECDSAP256SHA256 = "ECDSAP256SHA256"
+	DNSSEC_ALGORITHM_ECDSAP384SHA384 = "ECDSAP384SHA384"
+	DNSSEC_ALGORITHM_ED25519         = "ED25519"
+
+	TSIG_ALGORITHM_HMAC_SHA1   = "hmac-sha1"
+	TSIG_ALGORITHM_HMAC_SHA256 = "hmac-sha256"
+	TSIG_ALGORITHM_HMAC_SHA512 = "hmac-sha512"
+)
+
+var (
+	DNSSEC_ALGORITHMS = []string{
+		DNSSEC_ALGORITHM_ECDSAP256SHA256,
+		DNSSEC_ALGORITHM_ECDSAP384SHA384,
+		DNSSEC_ALGORITHM_ED25519,
+	}
+	TSIG_ALGORITHMS = []string{
+		TSIG_ALGORITHM_HMAC_SHA1,
+		TSIG_ALGORITHM_HMAC_SHA256,
+		TSIG_ALGORITHM_HMAC_SHA512,
+	}
+)
+
+type DnsZoneEnableDnssecInput struct {
+	// 签名算法, 默认ECDSAP256SHA256
+	//
+	// | 算法            |
+	// |-----------------|
+	// | ECDSAP256SHA256 |
+	// | ECDSAP384SHA384 |
+	// | ED25519         |
+	Algorithm string `json:"algorithm"`
+
+	// 重新生成密钥, 已启用时轮换KSK及ZSK
+	Rekey bool `json:"rekey"`
+}
+
+type DnsZoneDisableDnssecInput struct {
+}
+
+type DnsZoneDnssecDetails struct {
+	// 签名算法
+	Algorithm string `json:"algorithm"`
+	// DNSKEY记录, 含KSK及ZSK
+	Dnskeys []string `json:"dnskeys"`
+	// DS记录, 需添加到上级域
+	Ds []string `json:"ds"`
+}
+
+type DnsZoneSetDynamicUpdateInput struct {
+	// 是否允许RFC 2136动态更新
+	Enabled bool `json:"enabled"`
+
+	// TSIG密钥名称, 默认与域名相同
+	TsigKeyName string `json:"tsig_key_name"`
+	// TSIG算法, 默认hmac-sha256
+	TsigAlgorithm string `json:"tsig_algorithm"`
+	// 重新生成TSIG密钥
+	ResetSecret bool `json:"reset_secret"`
+}
+
+type DnsZoneTsigKeyDetails struct {
+	// TSIG密钥名称
+	TsigKeyName string `json:"tsig_key_name"`
+	// TSIG算法
+	TsigAlgorithm string `json:"tsig_algorithm"`
+	// base64编码的密钥
+	TsigSecret string `json:"tsig_secret"`
+}
@@ -332,6 +332,10 @@ const (
 	VM_METADATA_HOT_REMOVE_NIC      = "hot_remove_nic"
 	VM_METADATA_START_VMEM_MB       = "start_vmem_mb"
 	VM_METADATA_START_VCPU_COUNT    = "start_vcpu_count"
+	VM_METADATA_ENABLE_VTPM         = "enable_vtpm"
+	VM_METADATA_ENABLE_SECURE_BOOT  = "enable_secure_boot"
+	VM_METADATA_HOT_UNPLUG_CPU      = "hot_unplug_cpu"
+	VM_METADATA_VIRTIO_MEM          = "virtio_mem"
 
 	VM_METADATA_RELEASED_DEVICES = "released_devices"
 
@@ -341,3 +345,13 @@ const (
 // windows allow a maximal length of 15
 // http://support.microsoft.com/kb/909264
 const MAX_WINDOWS_COMPUTER_NAME_LENGTH = 15
+
+// max seconds of scheduler reservation for all_or_nothing batch create
+const SCHED_RESERVATION_MAX_TIMEOUT = 3600
+
+const (
+	// source region of a guest moved by cross-region migrate
+	SERVER_META_CROSS_REGION_MIGRATE_FROM = "__cross_region_migrate_from"
+	// reserved ip notes of cross-region migrate, followed by guest id
+	CROSS_REGION_MIGRATE_RESERVE_NOTES = "cross-region-migrate:"
+)
@@ -154,6 +154,9 @@ type GuestnetworkJsonDesc struct {
 	BaremetalId string `json:"baremetal_id"`
 
 	LinkUp bool `json:"link_up"`
+
+	// 生效的QoS策略, 网卡未指定时使用所在IP子网的策略
+	QosPolicy *QosPolicyDesc `json:"qos_policy,omitempty"`
 }
 
 type SNicTrafficRecord struct {
@@ -540,6 +540,51 @@ type GuestLiveMigrateInput struct {
 	KeepDestGuestOnFailed *bool `json:"keep_dest_guest_on_failed"`
 }
 
+type GuestNetworkRemap struct {
+	// 源虚拟机网卡序号
+	Index int `json:"index"`
+	// 目标区域的网络Id或名称
+	Network string `json:"network"`
+	// 保留原IP地址, 目标网络必须包含该地址
+	ReuseIp bool `json:"reuse_ip"`
+	// 指定目标网络中的IP地址, 未指定且不保留原IP时自动分配
+	Address string `json:"address"`
+
+	// swagger:ignore
+	NetworkId string `json:"network_id"`
+	// swagger:ignore
+	MacAddr string `json:"mac_addr"`
+	// swagger:ignore
+	SourceNetworkId string `json:"source_network_id"`
+	// swagger:ignore
+	SourceIpAddr string `json:"source_ip_addr"`
+}
+
+type GuestCrossRegionMigrateInput struct {
+	// 目标区域, 必须是本部署管理的私有云区域
+	// 跨部署迁移不在本接口范围内, 其他部署的区域会被拒绝
+	PreferRegionId string `json:"prefer_region_id"`
+	// 目标可用区
+	PreferZoneId string `json:"prefer_zone_id"`
+	// 目标宿主机
+	PreferHostId string `json:"prefer_host_id"`
+
+	// 网卡重映射规则, 每块网卡都必须指定目标网络
+	Networks []GuestNetworkRemap `json:"networks"`
+
+	// 通过热迁移完成最终切换, 要求虚拟机处于运行状态且所有网卡保留原IP地址
+	// 否则虚拟机需关机, 以冷迁移方式切换
+	LiveSwitchover bool `json:"live_switchover"`
+	// 冷切换完成后自动启动
+	AutoStart bool `json:"auto_start"`
+	// 是否跳过CPU检查
+	SkipCpuCheck bool `json:"skip_cpu_check"`
+	// 是否启用 tls
+	EnableTLS bool `json:"enable_tls"`
+	// 迁移带宽限制
+	MaxBandwidthMb *int64 `json:"max_bandwidth_mb"`
+}
+
 type GuestSetSecgroupInput struct {
 	// 安全组Id列表
 	// 实例必须处于运行,休眠或者关机状态
@@ -1075,6 +1120,8 @@ type ServerSnapshotAndCloneInput struct {
 type ServerInstanceSnapshot struct {
 	ServerCreateSnapshotParams
 	WithMemory bool `json:"with_memory"`
+	// 是否通过guest agent冻结文件系统创建一致性快照
+	Consistent bool `json:"consistent"`
 }
 
 type ServerCreateSnapshotParams struct {
@@ -16,6 +16,28 @@ package compute
 
 import "yunion.io/x/onecloud/pkg/apis"
 
+const (
+	// 反亲和，组内主机尽量分散到不同的拓扑域
+	INSTANCE_GROUP_ANTI_AFFINITY = "anti-affinity"
+	// 亲和，组内主机尽量集中到同一个拓扑域
+	INSTANCE_GROUP_AFFINITY = "affinity"
+
+	// 以宿主机为拓扑域
+	INSTANCE_GROUP_TOPOLOGY_HOST = "host"
+	// 以可用区为拓扑域
+	INSTANCE_GROUP_TOPOLOGY_ZONE = "zone"
+	// 以二层网络为拓扑域
+	INSTANCE_GROUP_TOPOLOGY_WIRE = "wire"
+
+	INSTANCE_GROUP_WEIGHT_DEFAULT = 10
+	INSTANCE_GROUP_WEIGHT_MAX     = 100
+)
+
+var INSTANCE_GROUP_AFFINITIES = []string{
+	INSTANCE_GROUP_ANTI_AFFINITY,
+	INSTANCE_GROUP_AFFINITY,
+}
+
 type InstanceGroupListInput struct {
 	apis.VirtualResourceListInput
 
@@ -82,3 +104,40 @@ type GroupResourceInfo struct {
 	// 实例组名称
 	Group string `json:"group"`
 }
+
+type InstanceGroupCreateInput struct {
+	apis.VirtualResourceCreateInput
+
+	// 亲和策略
+	// enum: anti-affinity, affinity
+	// default: anti-affinity
+	Affinity string `json:"affinity"`
+
+	// 拓扑域，host、zone、wire 或者宿主机的 metadata key(例如 rack)
+	// default: host
+	TopologyKey string `json:"topology_key"`
+
+	// 软性规则(force_dispersion=false)及拓扑分散的权重，取值 1-100
+	// default: 10
+	Weight int `json:"weight"`
+
+	// 拓扑分散允许的最大偏差，0 表示不启用拓扑分散
+	MaxSkew int `json:"max_skew"`
+}
+
+type InstanceGroupUpdateInput struct {
+	apis.VirtualResourceBaseUpdateInput
+
+	// 亲和策略
+	// enum: anti-affinity, affinity
+	Affinity *string `json:"affinity"`
+
+	// 拓扑域，host、zone、wire 或者宿主机的 metadata key(例如 rack)
+	TopologyKey *string `json:"topology_key"`
+
+	// 软性规则及拓扑分散的权重，取值 1-100
+	Weight *int `json:"weight"`
+
+	// 拓扑分散允许的最大偏差，0 表示不启用拓扑分散
+	MaxSkew *int `json:"max_skew"`
+}
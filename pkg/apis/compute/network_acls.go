@@ -0,0 +1,193 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/gotypes"
+	"yunion.io/x/pkg/util/regutils"
+	"yunion.io/x/pkg/util/secrules"
+	"yunion.io/x/pkg/utils"
+
+	"yunion.io/x/onecloud/pkg/apis"
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+const (
+	NETWORK_ACL_STATUS_AVAILABLE = "available"
+
+	NetworkAclRuleMinPriority = 1
+	NetworkAclRuleMaxPriority = 1000
+
+	// 单个网络ACL最多包含的规则数
+	NetworkAclMaxRules = 200
+)
+
+// 网络ACL规则, 按优先级从小到大依次匹配, 命中即生效, 未命中任何规则的流量将被拒绝
+// 注意: 与公有云无状态的网络ACL不同, 这里的规则是有状态的(基于连接跟踪),
+// 被允许的连接, 其回包无需另一方向的规则放行, 也无法被另一方向的deny规则拒绝
+type SNetworkAclRule struct {
+	// 优先级, 取值1-1000, 数值越小越先匹配
+	Priority int `json:"priority"`
+
+	// 方向, in: 进入子网, out: 离开子网
+	// enum: ["in", "out"]
+	Direction string `json:"direction"`
+
+	// 行为
+	// enum: ["allow", "deny"]
+	Action string `json:"action"`
+
+	// 协议
+	// enum: ["any", "tcp", "udp", "icmp"]
+	Protocol string `json:"protocol"`
+
+	// 对端地址段, 为空表示任意地址
+	// example: 10.0.0.0/8
+	Cidr string `json:"cidr"`
+
+	// 端口, 仅tcp, udp有效, 为空表示任意端口
+	// example: 22,80,1000-2000
+	Ports string `json:"ports"`
+
+	// 规则描述信息
+	Description string `json:"description"`
+}
+
+func (rule *SNetworkAclRule) Validate() error {
+	if rule.Priority < NetworkAclRuleMinPriority || rule.Priority > NetworkAclRuleMaxPriority {
+		return errors.Wrapf(httperrors.ErrOutOfRange, "priority should be within [%d, %d]", NetworkAclRuleMinPriority, NetworkAclRuleMaxPriority)
+	}
+	switch secrules.TSecurityRuleDirection(rule.Direction) {
+	case secrules.SecurityRuleIngress, secrules.SecurityRuleEgress:
+	default:
+		return errors.Wrapf(httperrors.ErrInputParameter, "invalid direction %q", rule.Direction)
+	}
+	switch secrules.TSecurityRuleAction(rule.Action) {
+	case secrules.SecurityRuleAllow, secrules.SecurityRuleDeny:
+	default:
+		return errors.Wrapf(httperrors.ErrInputParameter, "invalid action %q", rule.Action)
+	}
+	if len(rule.Protocol) == 0 {
+		rule.Protocol = secrules.PROTO_ANY
+	}
+	if !utils.IsInStringArray(rule.Protocol, []string{secrules.PROTO_ANY, secrules.PROTO_TCP, secrules.PROTO_UDP, secrules.PROTO_ICMP}) {
+		return errors.Wrapf(httperrors.ErrInputParameter, "invalid protocol %q", rule.Protocol)
+	}
+	rule.Cidr = strings.TrimSpace(rule.Cidr)
+	if len(rule.Cidr) > 0 {
+		if !regutils.MatchCIDR(rule.Cidr) && !regutils.MatchIP4Addr(rule.Cidr) && !regutils.MatchCIDR6(rule.Cidr) && !regutils.MatchIP6Addr(rule.Cidr) {
+			return errors.Wrapf(httperrors.ErrInputParameter, "invalid cidr %q", rule.Cidr)
+		}
+	}
+	rule.Ports = strings.TrimSpace(rule.Ports)
+	if len(rule.Ports) > 0 {
+		if rule.Protocol != secrules.PROTO_TCP && rule.Protocol != secrules.PROTO_UDP {
+			return errors.Wrapf(httperrors.ErrInputParameter, "ports is only valid for tcp and udp")
+		}
+		sr := secrules.SecurityRule{}
+		if err := sr.ParsePorts(rule.Ports); err != nil {
+			return errors.Wrapf(httperrors.ErrInputParameter, "invalid ports %q: %v", rule.Ports, err)
+		}
+	}
+	return nil
+}
+
+type SNetworkAclRules []SNetworkAclRule
+
+func (rules SNetworkAclRules) String() string {
+	return jsonutils.Marshal(rules).String()
+}
+
+func (rules SNetworkAclRules) IsZero() bool {
+	return len(rules) == 0
+}
+
+func (rules SNetworkAclRules) Validate() error {
+	if len(rules) > NetworkAclMaxRules {
+		return errors.Wrapf(httperrors.ErrOutOfRange, "too many rules (%d>%d)", len(rules), NetworkAclMaxRules)
+	}
+	// 同方向优先级不可重复, 否则匹配顺序不确定
+	found := map[string]bool{}
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return errors.Wrapf(err, "rule %d", i)
+		}
+		key := fmt.Sprintf("%s/%d", rules[i].Direction, rules[i].Priority)
+		if found[key] {
+			return errors.Wrapf(httperrors.ErrDuplicateId, "duplicate priority %d for direction %s", rules[i].Priority, rules[i].Direction)
+		}
+		found[key] = true
+	}
+	return nil
+}
+
+type NetworkAclListInput struct {
+	apis.EnabledStatusInfrasResourceBaseListInput
+
+	// 按VPC过滤
+	VpcId string `json:"vpc_id"`
+}
+
+type NetworkAclDetails struct {
+	apis.EnabledStatusInfrasResourceBaseDetails
+
+	// VPC名称
+	Vpc string `json:"vpc"`
+
+	// 关联的IP子网数量
+	NetworkCount int `json:"network_count"`
+}
+
+// 创建子网级别的网络ACL
+// 网络ACL是有状态的, 而不是无状态的: 放行规则会放行对应连接的回包
+type NetworkAclCreateInput struct {
+	apis.EnabledStatusInfrasResourceBaseCreateInput
+
+	// VPC ID或名称
+	// required: true
+	VpcId string `json:"vpc_id" required:"true" help:"id or name of vpc"`
+
+	// 规则列表
+	Rules SNetworkAclRules `json:"rules"`
+}
+
+type NetworkAclUpdateInput struct {
+	apis.EnabledStatusInfrasResourceBaseUpdateInput
+
+	// 规则列表, 整体替换
+	Rules SNetworkAclRules `json:"rules"`
+}
+
+type NetworkAclAssociateInput struct {
+	// IP子网ID或名称列表
+	NetworkIds []string `json:"network_ids"`
+}
+
+type NetworkAclDisassociateInput struct {
+	// IP子网ID或名称列表
+	NetworkIds []string `json:"network_ids"`
+}
+
+func init() {
+	gotypes.RegisterSerializable(reflect.TypeOf(&SNetworkAclRules{}), func() gotypes.ISerializable {
+		return &SNetworkAclRules{}
+	})
+}
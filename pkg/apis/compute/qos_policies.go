@@ -0,0 +1,154 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/apis"
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+const (
+	QOS_POLICY_STATUS_AVAILABLE = "available"
+
+	// 不修改DSCP标记
+	QosPolicyDscpNone = -1
+	QosPolicyDscpMax  = 63
+)
+
+// 网卡QoS参数, 随虚拟机描述信息下发到宿主机
+// ingress为进入虚拟机方向, egress为虚拟机发出方向
+type QosPolicyDesc struct {
+	Id string `json:"id"`
+
+	// 带宽, 单位Mbps, 0表示不限制
+	IngressBandwidth int `json:"ingress_bandwidth"`
+	// 突发, 单位Mb
+	IngressBurst int `json:"ingress_burst"`
+	// 包速率, 单位pps, 0表示不限制
+	IngressPps int `json:"ingress_pps"`
+
+	EgressBandwidth int `json:"egress_bandwidth"`
+	EgressBurst     int `json:"egress_burst"`
+	EgressPps       int `json:"egress_pps"`
+
+	// 虚拟机发出的IP报文的DSCP标记, -1表示不修改
+	Dscp int `json:"dscp"`
+}
+
+// GetIngressBurst returns burst in Mb, defaults to twice of the bandwidth
+func (desc *QosPolicyDesc) GetIngressBurst() int {
+	if desc.IngressBurst > 0 {
+		return desc.IngressBurst
+	}
+	return desc.IngressBandwidth * 2
+}
+
+func (desc *QosPolicyDesc) GetEgressBurst() int {
+	if desc.EgressBurst > 0 {
+		return desc.EgressBurst
+	}
+	return desc.EgressBandwidth * 2
+}
+
+func (desc *QosPolicyDesc) HasDscp() bool {
+	return desc.Dscp >= 0 && desc.Dscp <= QosPolicyDscpMax
+}
+
+type QosPolicyListInput struct {
+	apis.EnabledStatusInfrasResourceBaseListInput
+}
+
+type QosPolicyDetails struct {
+	apis.EnabledStatusInfrasResourceBaseDetails
+
+	// 直接关联的虚拟机网卡数量
+	GuestnetworkCount int `json:"guestnetwork_count"`
+
+	// 关联的IP子网数量
+	NetworkCount int `json:"network_count"`
+
+	// 关联的弹性公网IP数量
+	ElasticipCount int `json:"elasticip_count"`
+}
+
+type QosPolicyCreateInput struct {
+	apis.EnabledStatusInfrasResourceBaseCreateInput
+
+	// 进入虚拟机方向带宽, 单位Mbps, 0表示不限制
+	IngressBandwidth int `json:"ingress_bandwidth"`
+	// 进入虚拟机方向突发, 单位Mb, 0表示带宽的2倍
+	IngressBurst int `json:"ingress_burst"`
+	// 进入虚拟机方向包速率, 单位pps, 0表示不限制
+	IngressPps int `json:"ingress_pps"`
+
+	// 虚拟机发出方向带宽, 单位Mbps, 0表示不限制
+	EgressBandwidth int `json:"egress_bandwidth"`
+	// 虚拟机发出方向突发, 单位Mb, 0表示带宽的2倍
+	EgressBurst int `json:"egress_burst"`
+	// 虚拟机发出方向包速率, 单位pps, 0表示不限制
+	EgressPps int `json:"egress_pps"`
+
+	// 虚拟机发出的IP报文的DSCP标记, 取值0-63, 不指定表示不修改
+	Dscp *int `json:"dscp"`
+}
+
+type QosPolicyUpdateInput struct {
+	apis.EnabledStatusInfrasResourceBaseUpdateInput
+
+	IngressBandwidth *int `json:"ingress_bandwidth"`
+	IngressBurst     *int `json:"ingress_burst"`
+	IngressPps       *int `json:"ingress_pps"`
+
+	EgressBandwidth *int `json:"egress_bandwidth"`
+	EgressBurst     *int `json:"egress_burst"`
+	EgressPps       *int `json:"egress_pps"`
+
+	// 取值0-63, -1表示不修改DSCP标记
+	Dscp *int `json:"dscp"`
+}
+
+func ValidateQosPolicyParams(bandwidths []*int, dscp *int) error {
+	for _, bw := range bandwidths {
+		if bw != nil && *bw < 0 {
+			return errors.Wrap(httperrors.ErrInputParameter, "bandwidth, burst and pps should not be negative")
+		}
+		if bw != nil && *bw > MAX_BANDWIDTH {
+			return errors.Wrapf(httperrors.ErrOutOfRange, "value %d too large", *bw)
+		}
+	}
+	if dscp != nil && (*dscp < QosPolicyDscpNone || *dscp > QosPolicyDscpMax) {
+		return errors.Wrapf(httperrors.ErrOutOfRange, "dscp should be within [0, %d] or %d", QosPolicyDscpMax, QosPolicyDscpNone)
+	}
+	return nil
+}
+
+type ServerSetNicQosPolicyInput struct {
+	ServerNetworkInfo
+
+	// QoS策略ID或名称, 为空表示解除关联, 解除后网卡使用所在IP子网的QoS策略
+	QosPolicyId string `json:"qos_policy_id"`
+}
+
+type NetworkSetQosPolicyInput struct {
+	// QoS策略ID或名称, 为空表示解除关联
+	QosPolicyId string `json:"qos_policy_id"`
+}
+
+type ElasticipSetQosPolicyInput struct {
+	// QoS策略ID或名称, 为空表示解除关联, 弹性公网IP不支持包速率限制, 不能关联设置了pps的策略
+	QosPolicyId string `json:"qos_policy_id"`
+}
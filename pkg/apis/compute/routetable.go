@@ -110,12 +110,18 @@ type RouteTableCreateInput struct {
 
 	Type   string   `json:"type"`
 	Routes *SRoutes `json:"routes"`
+
+	// 策略路由, 仅适用于vpcagent管理的VPC
+	Policies *SRoutePolicies `json:"policies"`
 }
 
 type RouteTableUpdateInput struct {
 	apis.StatusInfrasResourceBaseUpdateInput
 
 	Routes *SRoutes `json:"routes"`
+
+	// 策略路由, 整体替换
+	Policies *SRoutePolicies `json:"policies"`
 }
 
 type RouteTableFilterListBase struct {
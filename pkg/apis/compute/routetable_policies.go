@@ -0,0 +1,191 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"net"
+	"reflect"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/gotypes"
+	"yunion.io/x/pkg/util/secrules"
+	"yunion.io/x/pkg/utils"
+
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+const (
+	ROUTE_POLICY_ACTION_REROUTE = "reroute"
+	ROUTE_POLICY_ACTION_DROP    = "drop"
+	ROUTE_POLICY_ACTION_ALLOW   = "allow"
+
+	RoutePolicyMinPriority = 1
+	RoutePolicyMaxPriority = 1000
+)
+
+// 策略路由, 按源地址, 目的地址, 协议和端口匹配流量, 优先于目的地址路由生效
+// 多条策略同时命中时, priority数值小的生效
+type SRoutePolicy struct {
+	// 优先级, 取值1-1000, 数值越小越优先
+	Priority int `json:"priority"`
+
+	// 源地址段, 为空表示任意地址
+	// example: 10.0.1.0/24
+	SrcCidr string `json:"src_cidr"`
+
+	// 目的地址段, 为空表示任意地址
+	DstCidr string `json:"dst_cidr"`
+
+	// 协议
+	// enum: ["any", "tcp", "udp", "icmp"]
+	Protocol string `json:"protocol"`
+
+	// 目的端口, 仅tcp, udp有效
+	// example: 80,443,8000-9000
+	Ports string `json:"ports"`
+
+	// 行为, reroute: 转发至下一跳, drop: 丢弃, allow: 按路由表正常转发
+	// enum: ["reroute", "drop", "allow"]
+	Action string `json:"action"`
+
+	// 下一跳类型, action为reroute时必填
+	// NatGateway: 经VPC外网网关SNAT出网, 要求VPC开启外网访问
+	// enum: ["Instance", "IP", "NatGateway"]
+	NextHopType string `json:"next_hop_type"`
+
+	// 下一跳, 虚拟机ID或IP地址, 下一跳类型为NatGateway时为空
+	NextHopId string `json:"next_hop_id"`
+
+	// 描述信息
+	Description string `json:"description"`
+}
+
+func normalizeRoutePolicyCidr(cidr string) (string, error) {
+	cidr = strings.TrimSpace(cidr)
+	if len(cidr) == 0 {
+		return "", nil
+	}
+	if strings.Contains(cidr, ":") {
+		return "", errors.Wrapf(httperrors.ErrNotSupported, "ipv6 cidr %s is not supported", cidr)
+	}
+	if strings.Index(cidr, "/") > 0 {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil || ipNet.IP.To4() == nil {
+			return "", errors.Wrapf(httperrors.ErrInputParameter, "invalid cidr %s", cidr)
+		}
+		return ipNet.String(), nil
+	}
+	if ip := net.ParseIP(cidr).To4(); ip == nil {
+		return "", errors.Wrapf(httperrors.ErrInputParameter, "invalid addr %s", cidr)
+	}
+	return cidr, nil
+}
+
+func (policy *SRoutePolicy) Validate() error {
+	var err error
+	if policy.Priority < RoutePolicyMinPriority || policy.Priority > RoutePolicyMaxPriority {
+		return errors.Wrapf(httperrors.ErrOutOfRange, "priority should be within [%d, %d]", RoutePolicyMinPriority, RoutePolicyMaxPriority)
+	}
+	if policy.SrcCidr, err = normalizeRoutePolicyCidr(policy.SrcCidr); err != nil {
+		return errors.Wrap(err, "src_cidr")
+	}
+	if policy.DstCidr, err = normalizeRoutePolicyCidr(policy.DstCidr); err != nil {
+		return errors.Wrap(err, "dst_cidr")
+	}
+	if len(policy.Protocol) == 0 {
+		policy.Protocol = secrules.PROTO_ANY
+	}
+	if !utils.IsInStringArray(policy.Protocol, []string{secrules.PROTO_ANY, secrules.PROTO_TCP, secrules.PROTO_UDP, secrules.PROTO_ICMP}) {
+		return errors.Wrapf(httperrors.ErrInputParameter, "invalid protocol %q", policy.Protocol)
+	}
+	policy.Ports = strings.TrimSpace(policy.Ports)
+	if len(policy.Ports) > 0 {
+		if policy.Protocol != secrules.PROTO_TCP && policy.Protocol != secrules.PROTO_UDP {
+			return errors.Wrapf(httperrors.ErrInputParameter, "ports is only valid for tcp and udp")
+		}
+		sr := secrules.SecurityRule{}
+		if err := sr.ParsePorts(policy.Ports); err != nil {
+			return errors.Wrapf(httperrors.ErrInputParameter, "invalid ports %q: %v", policy.Ports, err)
+		}
+	}
+	switch policy.Action {
+	case ROUTE_POLICY_ACTION_REROUTE:
+		switch policy.NextHopType {
+		case NEXT_HOP_TYPE_IP:
+			if strings.Contains(policy.NextHopId, ":") {
+				return errors.Wrapf(httperrors.ErrNotSupported, "ipv6 next hop %s is not supported", policy.NextHopId)
+			}
+			if ip := net.ParseIP(policy.NextHopId).To4(); ip == nil {
+				return errors.Wrapf(httperrors.ErrInputParameter, "invalid next hop ip %q", policy.NextHopId)
+			}
+		case NEXT_HOP_TYPE_INSTANCE:
+			if len(policy.NextHopId) == 0 {
+				return httperrors.NewMissingParameterError("next_hop_id")
+			}
+		case NEXT_HOP_TYPE_NAT:
+			policy.NextHopId = ""
+		default:
+			return errors.Wrapf(httperrors.ErrInputParameter, "invalid next hop type %q", policy.NextHopType)
+		}
+	case ROUTE_POLICY_ACTION_DROP, ROUTE_POLICY_ACTION_ALLOW:
+		policy.NextHopType = ""
+		policy.NextHopId = ""
+	default:
+		return errors.Wrapf(httperrors.ErrInputParameter, "invalid action %q", policy.Action)
+	}
+	return nil
+}
+
+type SRoutePolicies []*SRoutePolicy
+
+func (policies SRoutePolicies) String() string {
+	return jsonutils.Marshal(policies).String()
+}
+
+func (policies SRoutePolicies) IsZero() bool {
+	return len(policies) == 0
+}
+
+func (policies SRoutePolicies) Validate() error {
+	found := map[int]struct{}{}
+	for _, policy := range policies {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+		if _, ok := found[policy.Priority]; ok {
+			return httperrors.NewInputParameterError("duplicate route policy priority %d", policy.Priority)
+		}
+		found[policy.Priority] = struct{}{}
+	}
+	return nil
+}
+
+type RouteTableAddPoliciesInput struct {
+	// 新增的策略路由, 与已有策略优先级相同时替换已有策略
+	Policies SRoutePolicies `json:"policies"`
+}
+
+type RouteTableDelPoliciesInput struct {
+	// 待删除策略路由的优先级
+	Priorities []int `json:"priorities"`
+}
+
+func init() {
+	gotypes.RegisterSerializable(reflect.TypeOf(&SRoutePolicies{}), func() gotypes.ISerializable {
+		return &SRoutePolicies{}
+	})
+}
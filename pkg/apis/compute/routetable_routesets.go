@@ -23,6 +23,7 @@ import (
 const (
 	NEXT_HOP_TYPE_INSTANCE   = compute.NEXT_HOP_TYPE_INSTANCE   // ECS实例。
 	NEXT_HOP_TYPE_VPCPEERING = compute.NEXT_HOP_TYPE_VPCPEERING // vpc对等连接
+	NEXT_HOP_TYPE_NAT        = compute.NEXT_HOP_TYPE_NAT        // NAT网关
 
 	NEXT_HOP_TYPE_IP = compute.NEXT_HOP_TYPE_IP
 )
@@ -46,6 +46,9 @@ type SnapshotCreateInput struct {
 	ManagerId string `json:"manager_id"`
 	// swagger:ignore
 	OsArch string `json:"os_arch"`
+
+	// 是否通过guest agent冻结文件系统创建一致性快照, 冻结失败时仍创建崩溃一致性快照
+	Consistent bool `json:"consistent"`
 }
 
 type SnapshotListInput struct {
@@ -193,6 +193,8 @@ var (
 
 	SHARED_FILE_STORAGE = []string{STORAGE_NFS, STORAGE_GPFS}
 	FIEL_STORAGE        = []string{STORAGE_LOCAL, STORAGE_NFS, STORAGE_GPFS, STORAGE_LVM, STORAGE_CLVM, STORAGE_SLVM}
+	// storages of system disk able to keep the vTPM state in a file beside the disk
+	VTPM_STATE_STORAGE = []string{STORAGE_LOCAL, STORAGE_NFS, STORAGE_GPFS}
 
 	// supported shared storage types
 	SHARED_STORAGE = []string{STORAGE_NFS, STORAGE_GPFS, STORAGE_RBD, STORAGE_CLVM, STORAGE_SLVM}
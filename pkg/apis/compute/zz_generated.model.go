@@ -595,6 +595,16 @@ type SDiskBackup struct {
 	// 操作系统类型
 	OsType     string             `json:"os_type"`
 	DiskConfig *SBackupDiskConfig `json:"disk_config"`
+	// 增量备份链ID, 同一备份链的备份共享按内容寻址的数据块
+	ChainId string `json:"chain_id"`
+	// 增量备份的父备份ID, 为空表示全量备份
+	ParentBackupId string `json:"parent_backup_id"`
+	// 备份链保留的最大增量备份数量, 0为不限制
+	MaxIncrements int `json:"max_increments"`
+	// 是否冻结文件系统创建一致性备份
+	Consistent bool `json:"consistent"`
+	// 备份所用快照创建时文件系统是否已成功冻结
+	Quiesced bool `json:"quiesced"`
 }
 
 // SDiskResourceBase is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SDiskResourceBase.
@@ -629,6 +639,25 @@ type SDnsZone struct {
 	SManagedResourceBase
 	ZoneType    string `json:"zone_type"`
 	ProductType string `json:"product_type"`
+	// 是否启用DNSSEC签名, 仅本地域名
+	DnssecEnabled *bool `json:"dnssec_enabled,omitempty"`
+	// DNSSEC签名算法
+	DnssecAlgorithm string `json:"dnssec_algorithm"`
+	// KSK及ZSK公钥, DNSKEY记录格式
+	DnssecKsk string `json:"dnssec_ksk"`
+	DnssecZsk string `json:"dnssec_zsk"`
+	// KSK及ZSK私钥, 加密存储
+	DnssecKskPrivate string `json:"dnssec_ksk_private"`
+	DnssecZskPrivate string `json:"dnssec_zsk_private"`
+	// 是否允许RFC 2136动态更新, 仅本地域名
+	DynamicUpdate *bool `json:"dynamic_update,omitempty"`
+	// TSIG密钥名称及算法
+	TsigKeyName   string `json:"tsig_key_name"`
+	TsigAlgorithm string `json:"tsig_algorithm"`
+	// TSIG密钥, 加密存储
+	TsigSecret string `json:"tsig_secret"`
+	// 动态更新写入的SOA序列号, 序列号随时间递增, 同一秒内的多次更新可超前于当前时间
+	SoaSerial int64 `json:"soa_serial"`
 }
 
 // SDnsZoneResourceBase is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SDnsZoneResourceBase.
@@ -899,6 +928,8 @@ type SElasticip struct {
 	BgpType string `json:"bgp_type"`
 	// 是否跟随主机删除而自动释放
 	AutoDellocate *bool `json:"auto_dellocate,omitempty"`
+	// 关联的QoS策略
+	QosPolicyId string `json:"qos_policy_id"`
 }
 
 // SExternalProject is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SExternalProject.
@@ -940,6 +971,31 @@ type SFileSystem struct {
 	MountTargetCountLimit int `json:"mount_target_count_limit"`
 }
 
+// SFlowLog is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SFlowLog.
+type SFlowLog struct {
+	apis.SEnabledStatusInfrasResourceBase
+	// 作用范围, vpc, network或vnic
+	ResourceType string `json:"resource_type"`
+	// 所属VPC
+	VpcId string `json:"vpc_id"`
+	// 作用的IP子网, resource_type为network或vnic时有效
+	NetworkId string `json:"network_id"`
+	// 作用的虚拟机, resource_type为vnic时有效
+	GuestId string `json:"guest_id"`
+	// 作用的虚拟机网卡MAC地址
+	MacAddr string `json:"mac_addr"`
+	// 记录的流量类型, all, accept或reject
+	TrafficType string `json:"traffic_type"`
+	// 每秒最多记录的报文数
+	RateLimit int `json:"rate_limit"`
+	// 日志投递目标, logger或bucket
+	Destination string `json:"destination"`
+	// 投递的存储桶
+	BucketId string `json:"bucket_id"`
+	// 存储桶对象前缀
+	BucketPrefix string `json:"bucket_prefix"`
+}
+
 // SGlobalVpc is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SGlobalVpc.
 type SGlobalVpc struct {
 	apis.SEnabledStatusInfrasResourceBase
@@ -965,6 +1021,14 @@ type SGroup struct {
 	// the upper limit number of guests with this group in a host
 	Granularity     int   `json:"granularity"`
 	ForceDispersion *bool `json:"force_dispersion,omitempty"`
+	// 亲和策略, anti-affinity 或 affinity
+	Affinity string `json:"affinity"`
+	// 拓扑域, host、zone、wire 或者宿主机的 metadata key
+	TopologyKey string `json:"topology_key"`
+	// 软性规则及拓扑分散的权重
+	Weight int `json:"weight"`
+	// 拓扑分散允许的最大偏差, 0 表示不启用
+	MaxSkew int `json:"max_skew"`
 }
 
 // SGroupJointsBase is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SGroupJointsBase.
@@ -1162,6 +1226,8 @@ type SGuestnetwork struct {
 	IsDefault bool `json:"is_default"`
 	// 端口映射
 	PortMappings []*GuestPortMapping `json:"port_mappings"`
+	// 关联的QoS策略, 为空时使用所在IP子网的QoS策略
+	QosPolicyId string `json:"qos_policy_id"`
 }
 
 // SGuestsecgroup is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SGuestsecgroup.
@@ -1392,6 +1458,10 @@ type SInstanceBackup struct {
 	InstanceType string `json:"instance_type"`
 	// 主机备份容量和
 	SizeMb int `json:"size_mb"`
+	// 是否冻结文件系统创建一致性备份
+	Consistent bool `json:"consistent"`
+	// 所有磁盘快照是否均在文件系统冻结期间完成
+	Quiesced bool `json:"quiesced"`
 }
 
 // SInstanceSnapshot is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SInstanceSnapshot.
@@ -1434,6 +1504,10 @@ type SInstanceSnapshot struct {
 	MemoryFilePath string `json:"memory_file_path"`
 	// 内存文件校验和
 	MemoryFileChecksum string `json:"memory_file_checksum"`
+	// 是否冻结文件系统创建一致性快照
+	Consistent bool `json:"consistent"`
+	// 所有磁盘快照是否均在文件系统冻结期间完成
+	Quiesced bool `json:"quiesced"`
 }
 
 // SInterVpcNetwork is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SInterVpcNetwork.
@@ -2232,6 +2306,19 @@ type SNetwork struct {
 	IsAutoAlloc *bool `json:"is_auto_alloc,omitempty"`
 	// 线路类型
 	BgpType string `json:"bgp_type"`
+	// 关联的网络ACL
+	NetworkAclId string `json:"network_acl_id"`
+	// 关联的QoS策略
+	QosPolicyId string `json:"qos_policy_id"`
+}
+
+// SNetworkAcl is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SNetworkAcl.
+type SNetworkAcl struct {
+	apis.SEnabledStatusInfrasResourceBase
+	// 所属VPC
+	VpcId string `json:"vpc_id"`
+	// 规则列表
+	Rules *SNetworkAclRules `json:"rules"`
 }
 
 // SNetworkAdditionalWire is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SNetworkAdditionalWire.
@@ -2335,6 +2422,25 @@ type SProjectMappingResourceBase struct {
 	EnableResourceSync *bool  `json:"enable_resource_sync,omitempty"`
 }
 
+// SQosPolicy is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SQosPolicy.
+type SQosPolicy struct {
+	apis.SEnabledStatusInfrasResourceBase
+	// 进入虚拟机方向带宽, 单位Mbps
+	IngressBandwidth int `json:"ingress_bandwidth"`
+	// 进入虚拟机方向突发, 单位Mb
+	IngressBurst int `json:"ingress_burst"`
+	// 进入虚拟机方向包速率, 单位pps
+	IngressPps int `json:"ingress_pps"`
+	// 虚拟机发出方向带宽, 单位Mbps
+	EgressBandwidth int `json:"egress_bandwidth"`
+	// 虚拟机发出方向突发, 单位Mb
+	EgressBurst int `json:"egress_burst"`
+	// 虚拟机发出方向包速率, 单位pps
+	EgressPps int `json:"egress_pps"`
+	// 虚拟机发出的IP报文的DSCP标记, -1表示不修改
+	Dscp int `json:"dscp"`
+}
+
 // SReservedip is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SReservedip.
 type SReservedip struct {
 	apis.SResourceBase
@@ -2360,6 +2466,8 @@ type SRouteTable struct {
 	SVpcResourceBase
 	Type   string   `json:"type"`
 	Routes *SRoutes `json:"routes"`
+	// 策略路由
+	Policies *SRoutePolicies `json:"policies"`
 }
 
 // SRouteTableAssociation is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SRouteTableAssociation.
@@ -2658,6 +2766,10 @@ type SSnapshot struct {
 	BackingDiskId string    `json:"backing_disk_id"`
 	DiskBackupId  string    `json:"disk_backup_id"`
 	ExpiredAt     time.Time `json:"expired_at"`
+	// 是否通过guest agent冻结文件系统创建一致性快照
+	Consistent bool `json:"consistent"`
+	// 创建快照时文件系统是否已成功冻结
+	Quiesced bool `json:"quiesced"`
 }
 
 // SSnapshotPolicy is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SSnapshotPolicy.
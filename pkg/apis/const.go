@@ -40,6 +40,7 @@ const (
 	SERVICE_TYPE_INFLUXDB         = "influxdb"
 	SERVICE_TYPE_NTP              = "ntp"
 	SERVICE_TYPE_VICTORIA_METRICS = "victoria-metrics"
+	SERVICE_TYPE_PROMETHEUS       = "prometheus"
 
 	SERVICE_TYPE_SCHEDULEDTASK = "scheduledtask"
 
@@ -40,6 +40,11 @@ type AlertRecordListInput struct {
 	Alerting bool   `json:"alerting"`
 	ResName  string `json:"res_name"`
 	ResId    string `json:"res_id"`
+	// 是否已确认
+	Acked *bool `json:"acked"`
+}
+
+type AlertRecordAckInput struct {
 }
 
 type AlertRecordDetails struct {
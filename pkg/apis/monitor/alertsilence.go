@@ -0,0 +1,124 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"time"
+
+	"yunion.io/x/onecloud/pkg/apis"
+)
+
+const (
+	// send state of a record whose matches are all suppressed by alert
+	// silences, unlike SEND_STATE_SILENT which is set by the alert itself
+	SEND_STATE_MUTED = "muted"
+
+	// tag of an eval match suppressed by a silence
+	ALERT_SILENCE_ID_KEY = "silence_id"
+
+	ALERT_SILENCE_MATCH_EQUAL     = "="
+	ALERT_SILENCE_MATCH_NOT_EQUAL = "!="
+	ALERT_SILENCE_MATCH_REGEX     = "=~"
+	ALERT_SILENCE_MATCH_NOT_REGEX = "!~"
+
+	// labels of an eval match besides its metric tags
+	ALERT_SILENCE_LABEL_ALERT_ID   = "alert_id"
+	ALERT_SILENCE_LABEL_ALERT_NAME = "alert_name"
+	ALERT_SILENCE_LABEL_METRIC     = "metric"
+	ALERT_SILENCE_LABEL_RES_TYPE   = "res_type"
+	ALERT_SILENCE_LABEL_LEVEL      = "level"
+	ALERT_SILENCE_LABEL_PROJECT    = "project"
+	ALERT_SILENCE_LABEL_PROJECT_ID = "project_id"
+
+	// a recurring window lasts at most one week
+	ALERT_SILENCE_MAX_DURATION = 7 * 24 * 3600
+)
+
+var (
+	ALERT_SILENCE_MATCH_OPERATORS = []string{
+		ALERT_SILENCE_MATCH_EQUAL,
+		ALERT_SILENCE_MATCH_NOT_EQUAL,
+		ALERT_SILENCE_MATCH_REGEX,
+		ALERT_SILENCE_MATCH_NOT_REGEX,
+	}
+)
+
+// AlertSilenceMatcher matches a label of the eval matches, which are the
+// metric tags like host, vm_name, tenant plus alert_id, alert_name,
+// metric, res_type, level, project and project_id
+type AlertSilenceMatcher struct {
+	Label    string `json:"label"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+type AlertSilenceCreateInput struct {
+	apis.ScopedResourceCreateInput
+	apis.StatusStandaloneResourceCreateInput
+	apis.EnabledBaseResourceCreateInput
+
+	// only silence this alert, empty for every alert
+	AlertId string `json:"alert_id"`
+	// all the matchers should match
+	Matchers []AlertSilenceMatcher `json:"matchers"`
+
+	// the silence takes effect from start_time, default now
+	StartTime time.Time `json:"start_time"`
+	// the silence takes no effect after end_time, empty for never
+	EndTime time.Time `json:"end_time"`
+
+	// cron expression of the beginning of each maintenance window, e.g.
+	// "0 2 * * 0" for every Sunday at 02:00
+	Recurrence string `json:"recurrence"`
+	// length of each maintenance window in seconds, required by recurrence
+	Duration int `json:"duration"`
+	// timezone of the recurrence, e.g. Asia/Shanghai, default the server's
+	Timezone string `json:"timezone"`
+}
+
+type AlertSilenceUpdateInput struct {
+	apis.StatusStandaloneResourceBaseUpdateInput
+
+	AlertId    *string               `json:"alert_id"`
+	Matchers   []AlertSilenceMatcher `json:"matchers"`
+	StartTime  *time.Time            `json:"start_time"`
+	EndTime    *time.Time            `json:"end_time"`
+	Recurrence *string               `json:"recurrence"`
+	Duration   *int                  `json:"duration"`
+	Timezone   *string               `json:"timezone"`
+}
+
+type AlertSilenceListInput struct {
+	apis.Meta
+
+	apis.ScopedResourceBaseListInput
+	apis.EnabledResourceBaseListInput
+	apis.StatusStandaloneResourceListInput
+
+	AlertId string `json:"alert_id"`
+	// only list silences in effect now
+	Active *bool `json:"active"`
+}
+
+type AlertSilenceDetails struct {
+	apis.StatusStandaloneResourceDetails
+	apis.ScopedResourceBaseInfo
+
+	AlertName string `json:"alert_name"`
+	// whether the silence is in effect now
+	Active bool `json:"active"`
+	// whether end_time has passed
+	Expired bool `json:"expired"`
+}
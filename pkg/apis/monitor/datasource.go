@@ -19,4 +19,5 @@ import "yunion.io/x/onecloud/pkg/apis"
 const (
 	DataSourceTypeInfluxdb        = apis.SERVICE_TYPE_INFLUXDB
 	DataSourceTypeVictoriaMetrics = apis.SERVICE_TYPE_VICTORIA_METRICS
+	DataSourceTypePrometheus      = apis.SERVICE_TYPE_PROMETHEUS
 )
@@ -30,6 +30,16 @@ var (
 	AlertNotificationStateUnknown   = AlertNotificationStateType("unknown")
 )
 
+const (
+	// defaults of grouped notifications, same as alertmanager
+	NOTIFICATION_GROUP_WAIT       = 30
+	NOTIFICATION_GROUP_INTERVAL   = 5 * 60
+	NOTIFICATION_REPEAT_INTERVAL  = 4 * 3600
+	NOTIFICATION_ESCALATION_AFTER = 15 * 60
+	// longest escalation chain followed from a notification
+	NOTIFICATION_ESCALATION_MAX_STEPS = 8
+)
+
 const (
 	AlertNotificationTypeOneCloud      = "onecloud"
 	AlertNotificationTypeDingding      = "dingding"
@@ -55,6 +65,29 @@ type NotificationCreateInput struct {
 	Frequency time.Duration `json:"frequency"`
 	// 通知配置
 	Settings jsonutils.JSONObject `json:"settings"`
+
+	NotificationGroupInput
+	NotificationEscalationInput
+}
+
+// NotificationGroupInput 按标签将多个报警聚合为一条通知
+type NotificationGroupInput struct {
+	// 聚合通知的标签，如 host、alert_name、project，为空则不聚合
+	GroupBy []string `json:"group_by"`
+	// 分组首次通知前的等待时间 单位：s
+	GroupWait int64 `json:"group_wait"`
+	// 分组已通知后，新增报警再次通知的间隔 单位：s
+	GroupInterval int64 `json:"group_interval"`
+	// 同一报警重复通知的间隔 单位：s
+	RepeatInterval int64 `json:"repeat_interval"`
+}
+
+// NotificationEscalationInput 报警未被确认时升级到另一个通知
+type NotificationEscalationInput struct {
+	// 升级通知的 Id 或名称
+	EscalationNotificationId string `json:"escalation_notification_id"`
+	// 报警未确认多久后升级 单位：s
+	EscalationAfter int64 `json:"escalation_after"`
 }
 
 type NotificationUpdateInput struct {
@@ -70,6 +103,19 @@ type NotificationUpdateInput struct {
 	DisableResolveMessage *bool `json:"disable_resolve_message"`
 	// 发送频率
 	Frequency *time.Duration `json:"frequency"`
+
+	// 聚合通知的标签
+	GroupBy []string `json:"group_by"`
+	// 分组首次通知前的等待时间 单位：s
+	GroupWait *int64 `json:"group_wait"`
+	// 分组已通知后，新增报警再次通知的间隔 单位：s
+	GroupInterval *int64 `json:"group_interval"`
+	// 同一报警重复通知的间隔 单位：s
+	RepeatInterval *int64 `json:"repeat_interval"`
+	// 升级通知的 Id 或名称
+	EscalationNotificationId *string `json:"escalation_notification_id"`
+	// 报警未确认多久后升级 单位：s
+	EscalationAfter *int64 `json:"escalation_after"`
 }
 
 type NotificationListInput struct {
@@ -30,6 +30,13 @@ const (
 	REDUCER_PERCENT_DIFF   ReducerType = "percent_diff"
 	REDUCER_COUNT_NON_NULL ReducerType = "count_non_null"
 	REDUCER_PERCENTILE     ReducerType = "percentile"
+	REDUCER_P50            ReducerType = "p50"
+	REDUCER_P95            ReducerType = "p95"
+	REDUCER_P99            ReducerType = "p99"
+	// REDUCER_RATE is the per-second increase of a counter, tolerating counter resets
+	REDUCER_RATE ReducerType = "rate"
+	// REDUCER_DERIVATIVE is the per-second change between the first and the last point
+	REDUCER_DERIVATIVE ReducerType = "derivative"
 )
 
 var ValidateReducerTypes = sets.NewString()
@@ -37,7 +44,8 @@ var ValidateReducerTypes = sets.NewString()
 func init() {
 	for _, rt := range []ReducerType{REDUCER_AVG, REDUCER_SUM, REDUCER_MIN,
 		REDUCER_MAX, REDUCER_COUNT, REDUCER_LAST, REDUCER_MEDIAN, REDUCER_DIFF,
-		REDUCER_PERCENT_DIFF, REDUCER_COUNT_NON_NULL, REDUCER_PERCENTILE} {
+		REDUCER_PERCENT_DIFF, REDUCER_COUNT_NON_NULL, REDUCER_PERCENTILE,
+		REDUCER_P50, REDUCER_P95, REDUCER_P99, REDUCER_RATE, REDUCER_DERIVATIVE} {
 		ValidateReducerTypes.Insert(string(rt))
 	}
 }
@@ -63,6 +63,11 @@ var (
 		"median":       "median",
 		"diff":         "The difference between the latest value and the oldest value. The judgment basis value must be legal",
 		"percent_diff": "The difference between the new value and the old value,based on the percentage of the old value",
+		"p50":          "50th percentile",
+		"p95":          "95th percentile",
+		"p99":          "99th percentile",
+		"rate":         "Per-second increase of a counter, counter resets are tolerated",
+		"derivative":   "Per-second change between the oldest value and the latest value",
 	}
 )
 
@@ -90,6 +90,9 @@ type SAlertRecord struct {
 	AlertRule jsonutils.JSONObject `json:"alert_rule"`
 	ResType   string               `json:"res_type"`
 	ResIds    string               `json:"res_ids"`
+	// who acknowledged the alert, escalation stops once acknowledged
+	AckedBy string    `json:"acked_by"`
+	AckedAt time.Time `json:"acked_at"`
 }
 
 // SAlertRecordShield is an autogenerated struct via yunion.io/x/onecloud/pkg/monitor/models.SAlertRecordShield.
@@ -111,6 +114,23 @@ type SAlertResource struct {
 	Type string `json:"type"`
 }
 
+// SAlertSilence is an autogenerated struct via yunion.io/x/onecloud/pkg/monitor/models.SAlertSilence.
+type SAlertSilence struct {
+	apis.SEnabledResourceBase
+	apis.SStatusStandaloneResourceBase
+	SMonitorScopedResource
+	AlertId    string               `json:"alert_id"`
+	Matchers   jsonutils.JSONObject `json:"matchers"`
+	StartTime  time.Time            `json:"start_time"`
+	EndTime    time.Time            `json:"end_time"`
+	Recurrence string               `json:"recurrence"`
+	// seconds
+	Duration         int       `json:"duration"`
+	Timezone         string    `json:"timezone"`
+	SuppressedCount  int       `json:"suppressed_count"`
+	LastSuppressedAt time.Time `json:"last_suppressed_at"`
+}
+
 // SCommonAlert is an autogenerated struct via yunion.io/x/onecloud/pkg/monitor/models.SCommonAlert.
 type SCommonAlert struct {
 	SAlert
@@ -214,6 +234,15 @@ type SNotification struct {
 	Frequency            int64                `json:"frequency"`
 	Settings             jsonutils.JSONObject `json:"settings"`
 	LastSendNotification time.Time            `json:"last_send_notification"`
+	// labels to group the eval matches of alerts into one notification
+	GroupBy []string `json:"group_by"`
+	// unit is second
+	GroupWait      int64 `json:"group_wait"`
+	GroupInterval  int64 `json:"group_interval"`
+	RepeatInterval int64 `json:"repeat_interval"`
+	// notification sent when the alert is not acknowledged after escalation_after seconds
+	EscalationNotificationId string `json:"escalation_notification_id"`
+	EscalationAfter          int64  `json:"escalation_after"`
 }
 
 // SV1Alert is an autogenerated struct via yunion.io/x/onecloud/pkg/monitor/models.SV1Alert.
@@ -108,6 +108,9 @@ type ScheduleInput struct {
 	HasIsolatedDevice bool
 
 	PendingUsages []jsonutils.JSONObject
+
+	// used by explain api only, schedule, test and forecast reject it
+	WhatIf *SchedWhatIf `json:"what_if"`
 }
 
 func (input ScheduleInput) ToConditionInput() *jsonutils.JSONDict {
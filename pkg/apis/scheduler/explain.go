@@ -0,0 +1,108 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+// SchedWhatIf 调度解释时假设的资源变化，仅作用于本次 explain 请求，不会修改任何数据
+type SchedWhatIf struct {
+	// 假设宿主机资源变化
+	Hosts []SchedWhatIfHost `json:"hosts"`
+	// 假设被移除的调度标签，可以是 id 或 name
+	RemoveSchedtags []string `json:"remove_schedtags"`
+}
+
+type SchedWhatIfHost struct {
+	// 宿主机 id 或 name
+	Id string `json:"id"`
+	// 额外增加的内存大小(MB)，可以为负数
+	ExtraMemoryMb int64 `json:"extra_memory_mb"`
+	// 额外增加的 CPU 数量，可以为负数
+	ExtraCpuCount int64 `json:"extra_cpu_count"`
+}
+
+func (w *SchedWhatIf) GetHost(id, name string) *SchedWhatIfHost {
+	if w == nil {
+		return nil
+	}
+	for i := range w.Hosts {
+		if w.Hosts[i].Id == id || w.Hosts[i].Id == name {
+			return &w.Hosts[i]
+		}
+	}
+	return nil
+}
+
+func (w *SchedWhatIf) IsSchedtagRemoved(id, name string) bool {
+	if w == nil {
+		return false
+	}
+	for _, tag := range w.RemoveSchedtags {
+		if tag == id || tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SchedExplainPredicate 单个过滤器对候选者的检查结果
+type SchedExplainPredicate struct {
+	Name string `json:"name"`
+	Fit  bool   `json:"fit"`
+	// 过滤器内部错误
+	Error   string   `json:"error"`
+	Reasons []string `json:"reasons"`
+}
+
+// SchedExplainScore 单项打分结果
+type SchedExplainScore struct {
+	// 打分项名称，优先级插件名称或调度标签
+	Name string `json:"name"`
+	// prefer, avoid 或 normal
+	Kind  string `json:"kind"`
+	Score int    `json:"score"`
+}
+
+type SchedExplainCandidate struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// 是否通过所有过滤器
+	Fit bool `json:"fit"`
+	// 通过过滤器的候选者的排名，从 1 开始
+	Rank int `json:"rank"`
+	// 可容纳的实例数量
+	Capacity int64 `json:"capacity"`
+	// 本次调度会分配到该候选者的实例数量
+	Selected int64 `json:"selected"`
+	// 应用了 what-if 假设
+	WhatIf bool `json:"what_if"`
+
+	Predicates []SchedExplainPredicate `json:"predicates"`
+	// 被拒绝的过滤器名称
+	RejectedBy []string `json:"rejected_by"`
+
+	PreferScore int                 `json:"prefer_score"`
+	AvoidScore  int                 `json:"avoid_score"`
+	NormalScore int                 `json:"normal_score"`
+	Scores      []SchedExplainScore `json:"scores"`
+}
+
+// SchedExplainOutput 调度解释结果
+type SchedExplainOutput struct {
+	SessionId string `json:"session_id"`
+	ReqCount  int64  `json:"req_count"`
+	// 可分配的实例数量
+	AllowCount int64 `json:"allow_count"`
+	// 通过过滤器的候选者按排名在前，其余按名称排序
+	Candidates []SchedExplainCandidate `json:"candidates"`
+}
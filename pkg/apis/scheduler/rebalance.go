@@ -0,0 +1,106 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import "time"
+
+const (
+	// 均衡各宿主机的 CPU/内存负载
+	RebalanceStrategyBalance = "balance"
+	// 将虚拟机集中到少量宿主机，腾空整台宿主机用于维护
+	RebalanceStrategyPack = "pack"
+
+	RebalancePlanStatusPlanned  = "planned"
+	RebalancePlanStatusRunning  = "running"
+	RebalancePlanStatusFinished = "finished"
+
+	RebalanceMigrationStatusPending = "pending"
+	RebalanceMigrationStatusRunning = "running"
+	RebalanceMigrationStatusSuccess = "success"
+	RebalanceMigrationStatusFailed  = "failed"
+	// 依赖的迁移失败，未执行
+	RebalanceMigrationStatusSkipped = "skipped"
+)
+
+type RebalancePlanInput struct {
+	// 重平衡策略
+	// enum: ["balance", "pack"]
+	// default: balance
+	Strategy string `json:"strategy"`
+	// 限定可用区
+	Zone string `json:"zone"`
+	// 限定参与重平衡的宿主机，id 或 name，为空表示可用区内所有 kvm 宿主机
+	Hosts []string `json:"hosts"`
+	// pack 策略下需要腾空的宿主机，id 或 name，为空表示自动选择负载最低的宿主机
+	DrainHosts []string `json:"drain_hosts"`
+	// 最多迁移的虚拟机数量
+	// default: 20
+	MaxMigrations int `json:"max_migrations"`
+	// balance 策略下，宿主机最高与最低利用率之差小于该值即认为已均衡
+	// default: 0.1
+	Tolerance float64 `json:"tolerance"`
+	// pack 策略下，迁移目标宿主机的利用率上限
+	// default: 0.8
+	MaxUtilization float64 `json:"max_utilization"`
+}
+
+type RebalanceExecuteInput struct {
+	// 要执行的计划 id，由 rebalance-plan 生成
+	PlanId string `json:"plan_id"`
+	// 同时进行的热迁移数量
+	// default: 2
+	Concurrency int `json:"concurrency"`
+}
+
+type RebalanceMigration struct {
+	GuestId        string `json:"guest_id"`
+	GuestName      string `json:"guest_name"`
+	VcpuCount      int64  `json:"vcpu_count"`
+	VmemSizeMb     int64  `json:"vmem_size_mb"`
+	SourceHostId   string `json:"source_host_id"`
+	SourceHostName string `json:"source_host_name"`
+	TargetHostId   string `json:"target_host_id"`
+	TargetHostName string `json:"target_host_name"`
+	// 需要先完成的迁移在计划中的序号，这些迁移腾出了目标宿主机的资源
+	DependsOn []int `json:"depends_on"`
+
+	// 执行状态
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+type RebalanceHostUsage struct {
+	HostId     string `json:"host_id"`
+	HostName   string `json:"host_name"`
+	GuestCount int    `json:"guest_count"`
+	// CPU 利用率(分配)
+	CpuRatio float64 `json:"cpu_ratio"`
+	// 内存利用率(分配)
+	MemRatio float64 `json:"mem_ratio"`
+}
+
+type RebalancePlan struct {
+	Id        string    `json:"id"`
+	Strategy  string    `json:"strategy"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Migrations []RebalanceMigration `json:"migrations"`
+	// pack 策略腾空的宿主机
+	FreedHosts []string `json:"freed_hosts"`
+
+	Before []RebalanceHostUsage `json:"before"`
+	After  []RebalanceHostUsage `json:"after"`
+}
@@ -86,4 +86,58 @@ type TaskDetails struct {
 }
 
 type TaskCancelInput struct {
+	// 取消原因
+	Reason string `json:"reason" help:"reason of the cancellation"`
+}
+
+type TaskRetryInput struct {
+	// 重新进入的阶段，默认为最后失败的阶段
+	Stage string `json:"stage" help:"stage to re-enter, default is the last failed stage"`
+}
+
+type TaskStageInfo struct {
+	// 阶段名称
+	Name string `json:"name"`
+	// 阶段开始时间
+	StartAt time.Time `json:"start_at"`
+	// 阶段结束时间，进行中的阶段为空
+	EndAt time.Time `json:"end_at"`
+	// 阶段耗时(秒)
+	Duration float64 `json:"duration"`
+	// 是否在该阶段失败
+	Failed bool `json:"failed"`
+}
+
+type TaskTreeNode struct {
+	Id           string `json:"id"`
+	TaskName     string `json:"task_name"`
+	ObjType      string `json:"obj_type"`
+	ObjId        string `json:"obj_id"`
+	Object       string `json:"object"`
+	Stage        string `json:"stage"`
+	Status       string `json:"status"`
+	ParentTaskId string `json:"parent_task_id"`
+	// 创建该任务时父任务所处的阶段
+	ParentStage string `json:"parent_stage"`
+	// 任务是否已归档
+	Archived bool `json:"archived"`
+
+	StartAt  time.Time `json:"start_at"`
+	EndAt    time.Time `json:"end_at"`
+	Duration float64   `json:"duration"`
+
+	Stages   []TaskStageInfo `json:"stages"`
+	SubTasks []TaskTreeNode  `json:"sub_tasks"`
+}
+
+type TaskReprioritizeInput struct {
+	// 调整优先级的排队任务Id
+	TaskIds []string `json:"task_ids" help:"ids of the queued tasks to reprioritize"`
+	// 排队任务的优先级，优先级高的任务先执行，默认为0
+	Priority *int `json:"priority" help:"priority of the queued tasks, higher runs first, default 0"`
+
+	// 项目或域Id
+	OwnerId string `json:"owner_id" help:"project or domain id to set the weight"`
+	// 项目或域的调度权重，默认为1，小于等于0恢复默认值
+	Weight *int `json:"weight" help:"share of the project or domain in the task queues, default 1"`
 }
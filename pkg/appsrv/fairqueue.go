@@ -0,0 +1,334 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appsrv
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// IFairWorkerTask is implemented by the worker tasks that are dispatched
+// fairly among their owners when fair queuing is enabled on the worker manager
+type IFairWorkerTask interface {
+	IWorkerTask
+
+	// GetFairQueueOwner returns the project and domain the task is queued for
+	GetFairQueueOwner() (projectId string, domainId string)
+}
+
+type iWorkerQueue interface {
+	Push(val interface{}) bool
+	Pop() interface{}
+	Size() int
+	Capacity() int
+	Range(proc func(obj interface{}) bool)
+}
+
+const DEFAULT_FAIR_QUEUE_WEIGHT = 1
+
+type sFairQueueItem struct {
+	value    interface{}
+	priority int
+	enqueue  time.Time
+}
+
+type sFairQueueOwner struct {
+	projectId string
+	domainId  string
+	items     *list.List
+	// virtual time of the owner, advanced by 1/weight for each dispatched task
+	pass float64
+
+	dispatched int64
+	totalWait  time.Duration
+	maxWait    time.Duration
+}
+
+// FairQueue is a weighted fair queue of the worker tasks, each owner (project)
+// has its own FIFO queue and the owners are served by stride scheduling, so
+// that a project flooding the queue does not starve the others. Tasks with a
+// higher priority are always dispatched first.
+type FairQueue struct {
+	owners map[string]*sFairQueueOwner
+	// project or domain id => weight
+	weights map[string]int
+
+	size     int
+	capacity int
+	pass     float64
+
+	lock *sync.Mutex
+}
+
+func NewFairQueue(capacity int) *FairQueue {
+	return &FairQueue{
+		owners:   make(map[string]*sFairQueueOwner),
+		weights:  make(map[string]int),
+		capacity: capacity,
+		lock:     &sync.Mutex{},
+	}
+}
+
+func workerTaskOf(val interface{}) IWorkerTask {
+	switch v := val.(type) {
+	case *sWorkerTask:
+		return v.task
+	case IWorkerTask:
+		return v
+	}
+	return nil
+}
+
+func fairQueueOwnerOf(val interface{}) (string, string) {
+	if task, ok := workerTaskOf(val).(IFairWorkerTask); ok {
+		return task.GetFairQueueOwner()
+	}
+	return "", ""
+}
+
+func (q *FairQueue) weightWithLock(owner *sFairQueueOwner) int {
+	if weight, ok := q.weights[owner.projectId]; ok {
+		return weight
+	}
+	if weight, ok := q.weights[owner.domainId]; ok {
+		return weight
+	}
+	return DEFAULT_FAIR_QUEUE_WEIGHT
+}
+
+func (q *FairQueue) Push(val interface{}) bool {
+	return q.pushAt(val, time.Now())
+}
+
+func (q *FairQueue) pushAt(val interface{}, now time.Time) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.size >= q.capacity {
+		return false
+	}
+	projectId, domainId := fairQueueOwnerOf(val)
+	owner, ok := q.owners[projectId]
+	if !ok {
+		owner = &sFairQueueOwner{
+			projectId: projectId,
+			domainId:  domainId,
+			items:     list.New(),
+		}
+		q.owners[projectId] = owner
+	}
+	if owner.items.Len() == 0 && owner.pass < q.pass {
+		// an idle owner does not accumulate credits
+		owner.pass = q.pass
+	}
+	item := &sFairQueueItem{value: val, enqueue: now}
+	e := owner.items.Back()
+	for e != nil && e.Value.(*sFairQueueItem).priority < item.priority {
+		e = e.Prev()
+	}
+	if e == nil {
+		owner.items.PushFront(item)
+	} else {
+		owner.items.InsertAfter(item, e)
+	}
+	q.size += 1
+	return true
+}
+
+func (q *FairQueue) Pop() interface{} {
+	return q.popAt(time.Now())
+}
+
+func (q *FairQueue) popAt(now time.Time) interface{} {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var best *sFairQueueOwner
+	var bestItem *sFairQueueItem
+	for _, owner := range q.owners {
+		if owner.items.Len() == 0 {
+			continue
+		}
+		head := owner.items.Front().Value.(*sFairQueueItem)
+		if best == nil || head.priority > bestItem.priority ||
+			(head.priority == bestItem.priority && (owner.pass < best.pass ||
+				(owner.pass == best.pass && head.enqueue.Before(bestItem.enqueue)))) {
+			best = owner
+			bestItem = head
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	best.items.Remove(best.items.Front())
+	q.size -= 1
+	q.pass = best.pass
+	best.pass += 1.0 / float64(q.weightWithLock(best))
+
+	wait := now.Sub(bestItem.enqueue)
+	best.dispatched += 1
+	best.totalWait += wait
+	if wait > best.maxWait {
+		best.maxWait = wait
+	}
+	if best.items.Len() == 0 {
+		// drop drained owners so that the map does not grow with every
+		// project ever seen, pushAt recreates the owner at the current pass
+		delete(q.owners, best.projectId)
+	}
+	return bestItem.value
+}
+
+func (q *FairQueue) Size() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.size
+}
+
+func (q *FairQueue) Capacity() int {
+	return q.capacity
+}
+
+func (q *FairQueue) Range(proc func(obj interface{}) bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for _, owner := range q.owners {
+		for e := owner.items.Front(); e != nil; e = e.Next() {
+			if !proc(e.Value.(*sFairQueueItem).value) {
+				return
+			}
+		}
+	}
+}
+
+// SetWeight sets the weight of a project or a domain, the weight of a project
+// takes precedence over the weight of its domain. A weight no more than zero
+// resets it to the default.
+func (q *FairQueue) SetWeight(ownerId string, weight int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if weight <= 0 {
+		delete(q.weights, ownerId)
+	} else {
+		q.weights[ownerId] = weight
+	}
+}
+
+// Reprioritize sets the priority of the queued tasks matched, and returns the
+// number of tasks updated. Tasks of the same owner are kept in the order of
+// priority, then in FIFO order.
+func (q *FairQueue) Reprioritize(match func(task IWorkerTask) bool, priority int) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	cnt := 0
+	for _, owner := range q.owners {
+		items := make([]*sFairQueueItem, 0, owner.items.Len())
+		for e := owner.items.Front(); e != nil; e = e.Next() {
+			item := e.Value.(*sFairQueueItem)
+			if match(workerTaskOf(item.value)) {
+				item.priority = priority
+				cnt += 1
+			}
+			items = append(items, item)
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].priority > items[j].priority
+		})
+		owner.items.Init()
+		for i := range items {
+			owner.items.PushBack(items[i])
+		}
+	}
+	return cnt
+}
+
+type SFairQueueOwnerStats struct {
+	ProjectId string `json:"project_id"`
+	DomainId  string `json:"domain_id"`
+	Weight    int    `json:"weight"`
+
+	QueueCnt      int   `json:"queue_cnt"`
+	DispatchedCnt int64 `json:"dispatched_cnt"`
+
+	AvgWaitSeconds    float64 `json:"avg_wait_seconds"`
+	MaxWaitSeconds    float64 `json:"max_wait_seconds"`
+	OldestWaitSeconds float64 `json:"oldest_wait_seconds"`
+}
+
+// Stats returns the queue depth and wait time of each owner
+func (q *FairQueue) Stats() []SFairQueueOwnerStats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	now := time.Now()
+	ret := make([]SFairQueueOwnerStats, 0, len(q.owners))
+	for _, owner := range q.owners {
+		stats := SFairQueueOwnerStats{
+			ProjectId:      owner.projectId,
+			DomainId:       owner.domainId,
+			Weight:         q.weightWithLock(owner),
+			QueueCnt:       owner.items.Len(),
+			DispatchedCnt:  owner.dispatched,
+			MaxWaitSeconds: owner.maxWait.Seconds(),
+		}
+		if owner.dispatched > 0 {
+			stats.AvgWaitSeconds = owner.totalWait.Seconds() / float64(owner.dispatched)
+		}
+		if front := owner.items.Front(); front != nil {
+			stats.OldestWaitSeconds = now.Sub(front.Value.(*sFairQueueItem).enqueue).Seconds()
+		}
+		ret = append(ret, stats)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].QueueCnt > ret[j].QueueCnt
+	})
+	return ret
+}
+
+type SQueuedWorkerTask struct {
+	Task IWorkerTask `json:"-"`
+
+	ProjectId   string  `json:"project_id"`
+	DomainId    string  `json:"domain_id"`
+	Priority    int     `json:"priority"`
+	WaitSeconds float64 `json:"wait_seconds"`
+}
+
+// QueuedTasks returns the tasks waiting in the queue
+func (q *FairQueue) QueuedTasks() []SQueuedWorkerTask {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	now := time.Now()
+	ret := make([]SQueuedWorkerTask, 0, q.size)
+	for _, owner := range q.owners {
+		for e := owner.items.Front(); e != nil; e = e.Next() {
+			item := e.Value.(*sFairQueueItem)
+			ret = append(ret, SQueuedWorkerTask{
+				Task:        workerTaskOf(item.value),
+				ProjectId:   owner.projectId,
+				DomainId:    owner.domainId,
+				Priority:    item.priority,
+				WaitSeconds: now.Sub(item.enqueue).Seconds(),
+			})
+		}
+	}
+	return ret
+}
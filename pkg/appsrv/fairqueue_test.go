@@ -0,0 +1,132 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appsrv
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type fairTestTask struct {
+	id        int
+	projectId string
+	domainId  string
+}
+
+func (t *fairTestTask) Run() {}
+
+func (t *fairTestTask) Dump() string {
+	return fmt.Sprintf("%s-%d", t.projectId, t.id)
+}
+
+func (t *fairTestTask) GetFairQueueOwner() (string, string) {
+	return t.projectId, t.domainId
+}
+
+func popN(q *FairQueue, n int) []string {
+	ret := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		val := q.Pop()
+		if val == nil {
+			break
+		}
+		ret = append(ret, val.(IWorkerTask).Dump())
+	}
+	return ret
+}
+
+func TestFairQueue(t *testing.T) {
+	t.Run("no starvation", func(t *testing.T) {
+		q := NewFairQueue(100)
+		now := time.Now()
+		for i := 0; i < 50; i++ {
+			q.pushAt(&fairTestTask{id: i, projectId: "flood"}, now)
+		}
+		q.pushAt(&fairTestTask{id: 0, projectId: "other"}, now.Add(time.Second))
+		got := popN(q, 3)
+		want := []string{"flood-0", "other-0", "flood-1"}
+		if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", want) {
+			t.Errorf("got %v want %v", got, want)
+		}
+		if q.Size() != 48 {
+			t.Errorf("size got %d", q.Size())
+		}
+	})
+	t.Run("weight", func(t *testing.T) {
+		q := NewFairQueue(100)
+		q.SetWeight("dom-a", 2)
+		now := time.Now()
+		for i := 0; i < 6; i++ {
+			q.pushAt(&fairTestTask{id: i, projectId: "a", domainId: "dom-a"}, now)
+			q.pushAt(&fairTestTask{id: i, projectId: "b", domainId: "dom-b"}, now.Add(time.Millisecond))
+		}
+		cnt := map[byte]int{}
+		for _, d := range popN(q, 6) {
+			cnt[d[0]] += 1
+		}
+		if cnt['a'] != 4 || cnt['b'] != 2 {
+			t.Errorf("weighted share got %v", cnt)
+		}
+	})
+	t.Run("reprioritize", func(t *testing.T) {
+		q := NewFairQueue(100)
+		now := time.Now()
+		for i := 0; i < 3; i++ {
+			q.pushAt(&fairTestTask{id: i, projectId: "a"}, now)
+		}
+		q.pushAt(&fairTestTask{id: 0, projectId: "b"}, now.Add(time.Second))
+		n := q.Reprioritize(func(task IWorkerTask) bool {
+			return task.Dump() == "a-2" || task.Dump() == "b-0"
+		}, 10)
+		if n != 2 {
+			t.Errorf("reprioritize got %d", n)
+		}
+		got := popN(q, 4)
+		want := []string{"a-2", "b-0", "a-0", "a-1"}
+		if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", want) {
+			t.Errorf("got %v want %v", got, want)
+		}
+	})
+	t.Run("capacity and stats", func(t *testing.T) {
+		q := NewFairQueue(2)
+		now := time.Now().Add(-time.Minute)
+		q.pushAt(&fairTestTask{id: 0, projectId: "a"}, now)
+		q.pushAt(&fairTestTask{id: 1, projectId: "a"}, now)
+		if q.Push(&fairTestTask{id: 2, projectId: "a"}) {
+			t.Errorf("push to a full queue should fail")
+		}
+		q.Pop()
+		stats := q.Stats()
+		if len(stats) != 1 || stats[0].QueueCnt != 1 || stats[0].DispatchedCnt != 1 || stats[0].AvgWaitSeconds < 59 || stats[0].OldestWaitSeconds < 59 {
+			t.Errorf("stats got %#v", stats)
+		}
+	})
+	t.Run("prune drained owners", func(t *testing.T) {
+		q := NewFairQueue(100)
+		now := time.Now()
+		for i := 0; i < 10; i++ {
+			q.pushAt(&fairTestTask{id: 0, projectId: fmt.Sprintf("p%d", i)}, now)
+		}
+		popN(q, 10)
+		if len(q.owners) != 0 {
+			t.Errorf("owners not pruned: %d", len(q.owners))
+		}
+		q.pushAt(&fairTestTask{id: 1, projectId: "p0"}, now)
+		if got := popN(q, 2); len(got) != 1 || got[0] != "p0-1" {
+			t.Errorf("got %v after re-push", got)
+		}
+	})
+}
@@ -54,3 +54,7 @@ func (man *SHashedWorkerManager) GetWorkerManager(key string) *SWorkerManager {
 	nodeIdxStr, _ := man.workerRing.GetNode(key)
 	return man.workers[man.indexMap[nodeIdxStr]]
 }
+
+func (man *SHashedWorkerManager) GetWorkerManagers() []*SWorkerManager {
+	return man.workers
+}
@@ -169,7 +169,8 @@ func (wl *SWorkerList) size() int {
 
 type SWorkerManager struct {
 	name           string
-	queue          *Ring
+	queue          iWorkerQueue
+	fairQueue      *FairQueue
 	workerCount    int
 	backlog        int
 	activeWorker   *SWorkerList
@@ -237,17 +238,78 @@ func (wm *SWorkerManager) EnableCancelPreviousIdenticalTask() {
 	wm.cancelPrevIdent = true
 }
 
+// EnableFairQueue dispatches the queued tasks fairly among their owners, see
+// IFairWorkerTask, instead of in FIFO order
+func (wm *SWorkerManager) EnableFairQueue() error {
+	wm.workerLock.Lock()
+	defer wm.workerLock.Unlock()
+	if wm.fairQueue != nil {
+		return nil
+	}
+	if wm.queue.Size() > 0 {
+		return errors.Errorf("worker queue is not empty")
+	}
+	wm.fairQueue = NewFairQueue(wm.queue.Capacity())
+	wm.queue = wm.fairQueue
+	return nil
+}
+
+func (wm *SWorkerManager) IsFairQueue() bool {
+	return wm.fairQueue != nil
+}
+
 func (wm *SWorkerManager) UpdateWorkerCount(workerCount int) error {
 	wm.workerLock.Lock()
 	defer wm.workerLock.Unlock()
 	if wm.queue.Size() > 0 {
 		return errors.Errorf("worker queue is not empty")
 	}
-	wm.queue = NewRing(workerCount * wm.backlog)
+	if wm.fairQueue != nil {
+		fairQueue := NewFairQueue(workerCount * wm.backlog)
+		fairQueue.weights = wm.fairQueue.weights
+		wm.fairQueue = fairQueue
+		wm.queue = fairQueue
+	} else {
+		wm.queue = NewRing(workerCount * wm.backlog)
+	}
 	wm.workerCount = workerCount
 	return nil
 }
 
+// SetFairQueueWeight sets the share of a project or domain in the fair queue
+func (wm *SWorkerManager) SetFairQueueWeight(ownerId string, weight int) error {
+	if wm.fairQueue == nil {
+		return errors.Errorf("worker manager %s is not fair queued", wm.name)
+	}
+	wm.fairQueue.SetWeight(ownerId, weight)
+	return nil
+}
+
+// ReprioritizeQueuedTasks sets the priority of the queued tasks matched and
+// returns the number of tasks updated
+func (wm *SWorkerManager) ReprioritizeQueuedTasks(match func(task IWorkerTask) bool, priority int) (int, error) {
+	if wm.fairQueue == nil {
+		return 0, errors.Errorf("worker manager %s is not fair queued", wm.name)
+	}
+	return wm.fairQueue.Reprioritize(match, priority), nil
+}
+
+// GetQueuedTasks returns the tasks waiting in a fair queue
+func (wm *SWorkerManager) GetQueuedTasks() []SQueuedWorkerTask {
+	if wm.fairQueue == nil {
+		return nil
+	}
+	return wm.fairQueue.QueuedTasks()
+}
+
+// GetFairQueueStats returns the queue depth and wait time of each owner
+func (wm *SWorkerManager) GetFairQueueStats() []SFairQueueOwnerStats {
+	if wm.fairQueue == nil {
+		return nil
+	}
+	return wm.fairQueue.Stats()
+}
+
 func (wm *SWorkerManager) String() string {
 	return wm.name
 }
@@ -344,6 +406,8 @@ type SWorkerManagerStates struct {
 	DetachWorkerCnt int
 	DbWorker        bool
 	AllowOverflow   bool
+
+	FairQueue []SFairQueueOwnerStats
 }
 
 func (s SWorkerManagerStates) IsBusy() bool {
@@ -364,6 +428,7 @@ func (wm *SWorkerManager) getState() SWorkerManagerStates {
 	state.DetachWorkerCnt = wm.detachedWorker.size()
 	state.DbWorker = wm.dbWorker
 	state.AllowOverflow = wm.ignoreOverflow
+	state.FairQueue = wm.GetFairQueueStats()
 
 	return state
 }
@@ -18,6 +18,7 @@ import (
 	"context"
 	"reflect"
 	"sync"
+	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
@@ -49,6 +50,19 @@ type ISingleTask interface {
 	ScheduleRun(data jsonutils.JSONObject) error
 }
 
+// ICancelableTask is optionally implemented by a task to release resources or
+// restore the status of its object when it is cancelled, either by the cancel
+// action or on stage timeout. OnCancel is called before the failed handler of
+// the current stage.
+type ICancelableTask interface {
+	OnCancel(ctx context.Context, obj db.IStandaloneModel, body jsonutils.JSONObject)
+}
+
+// ICancelableBatchTask is the ICancelableTask of a batch task
+type ICancelableBatchTask interface {
+	OnCancel(ctx context.Context, objs []db.IStandaloneModel, body jsonutils.JSONObject)
+}
+
 var ITaskType reflect.Type
 var IBatchTaskType reflect.Type
 
@@ -61,15 +75,42 @@ func init() {
 	taskTable = make(map[string]reflect.Type)
 }
 
-func RegisterTaskAndWorker(task interface{}, workerMan *appsrv.SWorkerManager) {
-	registerTaskAndWorkerMan(task, workerMan)
+type sTaskOptions struct {
+	// stage name => timeout, empty stage name for all stages
+	stageTimeouts map[string]time.Duration
+}
+
+type TaskOption func(opts *sTaskOptions)
+
+// WithStageTimeout bounds how long the task may stay in a stage, e.g. waiting
+// for the callback of a host. The timeout applies to the given stages, or to
+// every stage if none given. A task exceeding the timeout is cancelled.
+func WithStageTimeout(timeout time.Duration, stages ...string) TaskOption {
+	return func(opts *sTaskOptions) {
+		if len(stages) == 0 {
+			stages = []string{""}
+		}
+		for _, stage := range stages {
+			opts.stageTimeouts[stage] = timeout
+		}
+	}
+}
+
+var taskOptionsTable map[string]*sTaskOptions
+
+func init() {
+	taskOptionsTable = make(map[string]*sTaskOptions)
+}
+
+func RegisterTaskAndWorker(task interface{}, workerMan *appsrv.SWorkerManager, opts ...TaskOption) {
+	registerTaskAndWorkerMan(task, workerMan, opts...)
 }
 
-func RegisterTaskAndHashedWorkerManager(task interface{}, workerMan *appsrv.SHashedWorkerManager) {
-	registerTaskAndWorkerMan(task, workerMan)
+func RegisterTaskAndHashedWorkerManager(task interface{}, workerMan *appsrv.SHashedWorkerManager, opts ...TaskOption) {
+	registerTaskAndWorkerMan(task, workerMan, opts...)
 }
 
-func registerTaskAndWorkerMan(task interface{}, workerMan interface{}) {
+func registerTaskAndWorkerMan(task interface{}, workerMan interface{}, opts ...TaskOption) {
 	taskName := gotypes.GetInstanceTypeName(task)
 	if _, ok := taskTable[taskName]; ok {
 		log.Fatalf("Task %s already registered!", taskName)
@@ -79,14 +120,61 @@ func registerTaskAndWorkerMan(task interface{}, workerMan interface{}) {
 	// log.Infof("Task %s registerd", taskName)
 	if workerMan != nil && !gotypes.IsNil(workerMan) {
 		taskWorkerMap[taskName] = workerMan
+		enableFairQueue(workerMan)
 	}
+	if len(opts) > 0 {
+		taskOpts := &sTaskOptions{stageTimeouts: make(map[string]time.Duration)}
+		for _, opt := range opts {
+			opt(taskOpts)
+		}
+		taskOptionsTable[taskName] = taskOpts
+	}
+}
+
+func RegisterTask(task interface{}, opts ...TaskOption) {
+	registerTaskAndWorkerMan(task, nil, opts...)
+}
+
+func getStageTimeout(taskName string, stage string) time.Duration {
+	opts, ok := taskOptionsTable[taskName]
+	if !ok {
+		return 0
+	}
+	if timeout, ok := opts.stageTimeouts[stage]; ok {
+		return timeout
+	}
+	return opts.stageTimeouts[""]
 }
 
-func RegisterTask(task interface{}) {
-	registerTaskAndWorkerMan(task, nil)
+func getStageTimeoutTaskNames() []string {
+	ret := make([]string, 0)
+	for taskName, opts := range taskOptionsTable {
+		if len(opts.stageTimeouts) > 0 {
+			ret = append(ret, taskName)
+		}
+	}
+	return ret
 }
 
 func isTaskExist(taskName string) bool {
 	_, ok := taskTable[taskName]
 	return ok
 }
+
+// enableFairQueue keeps the tasks of a project from starving the others in
+// the worker managers tasks are dispatched to
+func enableFairQueue(workerMan interface{}) {
+	workerMans := make([]*appsrv.SWorkerManager, 0)
+	switch man := workerMan.(type) {
+	case *appsrv.SWorkerManager:
+		workerMans = append(workerMans, man)
+	case *appsrv.SHashedWorkerManager:
+		workerMans = append(workerMans, man.GetWorkerManagers()...)
+	}
+	for _, man := range workerMans {
+		err := man.EnableFairQueue()
+		if err != nil {
+			log.Errorf("enable fair queue of worker manager %s: %v", man, err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskman
+
+import (
+	"testing"
+	"time"
+)
+
+type sTimeoutTestTask struct {
+	STask
+}
+
+func TestStageTimeout(t *testing.T) {
+	RegisterTask(sTimeoutTestTask{}, WithStageTimeout(10*time.Minute), WithStageTimeout(time.Hour, "OnMigrateComplete"))
+	defer func() {
+		delete(taskTable, "sTimeoutTestTask")
+		delete(taskOptionsTable, "sTimeoutTestTask")
+	}()
+
+	for _, c := range []struct {
+		taskName string
+		stage    string
+		want     time.Duration
+	}{
+		{"sTimeoutTestTask", "on_init", 10 * time.Minute},
+		{"sTimeoutTestTask", "OnMigrateComplete", time.Hour},
+		{"UnknownTask", "on_init", 0},
+	} {
+		if got := getStageTimeout(c.taskName, c.stage); got != c.want {
+			t.Errorf("%s %s: got %s want %s", c.taskName, c.stage, got, c.want)
+		}
+	}
+	names := getStageTimeoutTaskNames()
+	if len(names) != 1 || names[0] != "sTimeoutTestTask" {
+		t.Errorf("getStageTimeoutTaskNames got %v", names)
+	}
+}
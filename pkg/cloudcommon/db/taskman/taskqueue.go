@@ -0,0 +1,167 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskman
+
+import (
+	"context"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+
+	"yunion.io/x/onecloud/pkg/apis"
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+type sQueuedTask struct {
+	TaskId      string  `json:"task_id"`
+	TaskName    string  `json:"task_name"`
+	ObjType     string  `json:"obj_type"`
+	ObjId       string  `json:"obj_id"`
+	Object      string  `json:"object"`
+	ProjectId   string  `json:"tenant_id"`
+	DomainId    string  `json:"domain_id"`
+	Priority    int     `json:"priority"`
+	WaitSeconds float64 `json:"wait_seconds"`
+}
+
+type sTaskWorkerQueue struct {
+	Name            string                        `json:"name"`
+	QueueCnt        int                           `json:"queue_cnt"`
+	ActiveWorkerCnt int                           `json:"active_worker_cnt"`
+	Owners          []appsrv.SFairQueueOwnerStats `json:"owners"`
+	Tasks           []sQueuedTask                 `json:"tasks"`
+}
+
+// 查看任务队列中各项目的排队情况
+func (manager *STaskManager) GetPropertyQueues(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if db.IsAdminAllowList(userCred, manager).Result.IsDeny() {
+		return nil, httperrors.NewForbiddenError("not allow to list task queues")
+	}
+	workerMans := getTaskWorkManagers()
+	queues := make([]sTaskWorkerQueue, 0, len(workerMans))
+	taskIds := make([]string, 0)
+	for _, workerMan := range workerMans {
+		if !workerMan.IsFairQueue() {
+			continue
+		}
+		queue := sTaskWorkerQueue{
+			Name:            workerMan.String(),
+			ActiveWorkerCnt: workerMan.ActiveWorkerCount(),
+			Owners:          workerMan.GetFairQueueStats(),
+		}
+		for _, queued := range workerMan.GetQueuedTasks() {
+			t, ok := queued.Task.(*taskTask)
+			if !ok {
+				continue
+			}
+			queue.Tasks = append(queue.Tasks, sQueuedTask{
+				TaskId:      t.taskId,
+				ProjectId:   queued.ProjectId,
+				DomainId:    queued.DomainId,
+				Priority:    queued.Priority,
+				WaitSeconds: queued.WaitSeconds,
+			})
+			taskIds = append(taskIds, t.taskId)
+		}
+		queue.QueueCnt = len(queue.Tasks)
+		queues = append(queues, queue)
+	}
+	if len(taskIds) > 0 {
+		tasks := make([]STask, 0, len(taskIds))
+		err := db.FetchModelObjects(manager, manager.Query().In("id", taskIds), &tasks)
+		if err != nil {
+			return nil, errors.Wrap(err, "FetchModelObjects")
+		}
+		taskMap := make(map[string]*STask)
+		for i := range tasks {
+			taskMap[tasks[i].Id] = &tasks[i]
+		}
+		for i := range queues {
+			for j := range queues[i].Tasks {
+				queued := &queues[i].Tasks[j]
+				if task, ok := taskMap[queued.TaskId]; ok {
+					queued.TaskName = task.TaskName
+					queued.ObjType = task.ObjType
+					queued.ObjId = task.ObjId
+					queued.Object = task.Object
+				}
+			}
+		}
+	}
+	ret := jsonutils.NewDict()
+	ret.Add(jsonutils.Marshal(queues), "queues")
+	return ret, nil
+}
+
+// 调整排队任务的优先级或项目的调度权重
+func (manager *STaskManager) PerformReprioritize(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input apis.TaskReprioritizeInput,
+) (jsonutils.JSONObject, error) {
+	if db.IsAdminAllowClassPerform(userCred, manager, "reprioritize").Result.IsDeny() {
+		return nil, httperrors.NewForbiddenError("not allow to reprioritize tasks")
+	}
+	if len(input.TaskIds) == 0 && input.Weight == nil {
+		return nil, httperrors.NewMissingParameterError("task_ids")
+	}
+	if input.Weight != nil && len(input.OwnerId) == 0 {
+		return nil, httperrors.NewMissingParameterError("owner_id")
+	}
+	workerMans := getTaskWorkManagers()
+	ret := jsonutils.NewDict()
+	if len(input.TaskIds) > 0 {
+		priority := 0
+		if input.Priority != nil {
+			priority = *input.Priority
+		}
+		match := func(task appsrv.IWorkerTask) bool {
+			t, ok := task.(*taskTask)
+			return ok && utils.IsInStringArray(t.taskId, input.TaskIds)
+		}
+		cnt := 0
+		for _, workerMan := range workerMans {
+			if !workerMan.IsFairQueue() {
+				continue
+			}
+			n, err := workerMan.ReprioritizeQueuedTasks(match, priority)
+			if err != nil {
+				return nil, errors.Wrapf(err, "ReprioritizeQueuedTasks %s", workerMan)
+			}
+			cnt += n
+		}
+		if cnt == 0 {
+			return nil, httperrors.NewNotFoundError("no queued task of %v", input.TaskIds)
+		}
+		ret.Add(jsonutils.NewInt(int64(cnt)), "reprioritized")
+	}
+	if input.Weight != nil {
+		for _, workerMan := range workerMans {
+			if !workerMan.IsFairQueue() {
+				continue
+			}
+			err := workerMan.SetFairQueueWeight(input.OwnerId, *input.Weight)
+			if err != nil {
+				return nil, errors.Wrapf(err, "SetFairQueueWeight %s", workerMan)
+			}
+		}
+	}
+	return ret, nil
+}
@@ -59,6 +59,10 @@ const (
 	PENDING_USAGE_KEY      = "__pending_usage__"
 	PARENT_TASK_NOTIFY_KEY = "__parent_task_notifyurl"
 	REQUEST_CONTEXT_KEY    = "__request_context"
+	TASK_STAGES_KEY        = "__stages"
+	TASK_FAILED_REASON_KEY = "__failed_reason"
+	TASK_RETRIES_KEY       = "__retries"
+	TASK_CANCEL_KEY        = "__cancel__"
 
 	TASK_STAGE_FAILED   = "failed"
 	TASK_STAGE_COMPLETE = "complete"
@@ -506,6 +510,8 @@ func execITask(taskValue reflect.Value, task *STask, odata jsonutils.JSONObject,
 		data = jsonutils.NewDict()
 	}
 
+	isCancel := taskFailed && jsonutils.QueryBoolean(data, TASK_CANCEL_KEY, false)
+
 	stageName := task.Stage
 	if taskFailed {
 		stageName = fmt.Sprintf("%sFailed", task.Stage)
@@ -520,7 +526,7 @@ func execITask(taskValue reflect.Value, task *STask, odata jsonutils.JSONObject,
 
 	funcValue := taskValue.MethodByName(stageName)
 
-	if !funcValue.IsValid() || funcValue.IsNil() {
+	if (!funcValue.IsValid() || funcValue.IsNil()) && !isCancel {
 		msg := fmt.Sprintf("Stage %s not found", stageName)
 		if taskFailed {
 			// failed handler is optional, ignore the error
@@ -637,14 +643,66 @@ func execITask(taskValue reflect.Value, task *STask, odata jsonutils.JSONObject,
 		}
 	}()
 
-	log.Debugf("Call %s(%s) %s %#v", task.TaskName, task.Id, stageName, params)
-	funcValue.Call(params)
+	if isCancel {
+		cancelITask(ctx, taskValue, task, funcValue, params, data, isMulti)
+	} else {
+		log.Debugf("Call %s(%s) %s %#v", task.TaskName, task.Id, stageName, params)
+		funcValue.Call(params)
+	}
 
 	// call save request context
 	saveRequestContextFuncValue := taskValue.MethodByName("SaveRequestContext")
 	saveRequestContextFuncValue.Call([]reflect.Value{reflect.ValueOf(&ctxData)})
 }
 
+// cancelITask calls the OnCancel hook and the failed handler of the current
+// stage, if any. A task without either handler is marked failed and its
+// objects are left in unknown status, as nobody knows the state they are in.
+func cancelITask(ctx context.Context, taskValue reflect.Value, task *STask, failedFuncValue reflect.Value, params []reflect.Value, data jsonutils.JSONObject, isMulti bool) {
+	handled := false
+	if isMulti {
+		if cancelable, ok := taskValue.Interface().(ICancelableBatchTask); ok {
+			log.Debugf("Call %s(%s) OnCancel", task.TaskName, task.Id)
+			cancelable.OnCancel(ctx, task.taskObjects, data)
+			handled = true
+		}
+	} else {
+		if cancelable, ok := taskValue.Interface().(ICancelableTask); ok {
+			log.Debugf("Call %s(%s) OnCancel", task.TaskName, task.Id)
+			cancelable.OnCancel(ctx, task.taskObject, data)
+			handled = true
+		}
+	}
+	if failedFuncValue.IsValid() && !failedFuncValue.IsNil() {
+		log.Debugf("Call %s(%s) %s_failed on cancel", task.TaskName, task.Id, task.Stage)
+		failedFuncValue.Call(params)
+		handled = true
+	}
+	reason, _ := data.GetString("__reason__")
+	if latest := TaskManager.fetchTask(task.Id); latest != nil && latest.Stage != TASK_STAGE_FAILED {
+		// call set stage failed, should not call task.SetStageFailed
+		// func SetStageFailed may be overloading
+		taskValue.MethodByName("SetStageFailed").Call(
+			[]reflect.Value{
+				reflect.ValueOf(ctx),
+				reflect.ValueOf(jsonutils.NewString(reason)),
+			},
+		)
+	}
+	if handled {
+		return
+	}
+	objs := task.taskObjects
+	if task.taskObject != nil {
+		objs = []db.IStandaloneModel{task.taskObject}
+	}
+	for i := range objs {
+		if statusObj, ok := objs[i].(db.IStatusStandaloneModel); ok {
+			db.StatusBaseSetStatus(ctx, statusObj, task.GetUserCred(), apis.STATUS_UNKNOWN, reason)
+		}
+	}
+}
+
 func (task *STask) ScheduleRun(data jsonutils.JSONObject) error {
 	return runTask(task.Id, data)
 }
@@ -719,10 +777,10 @@ func (task *STask) SetStage(stageName string, data *jsonutils.JSONDict) error {
 			params.Update(data)
 		}
 		if len(stageName) > 0 {
-			stages, _ := params.Get("__stages")
+			stages, _ := params.Get(TASK_STAGES_KEY)
 			if stages == nil {
 				stages = jsonutils.NewArray()
-				params.Add(stages, "__stages")
+				params.Add(stages, TASK_STAGES_KEY)
 			}
 			stageList := stages.(*jsonutils.JSONArray)
 			stageData := jsonutils.NewDict()
@@ -783,7 +841,7 @@ func (task *STask) SetStageFailed(ctx context.Context, reason jsonutils.JSONObje
 		reasonDict.Add(reason, "reason")
 	}
 	reason = reasonDict
-	prevFailed, _ := task.Params.Get("__failed_reason")
+	prevFailed, _ := task.Params.Get(TASK_FAILED_REASON_KEY)
 	if prevFailed != nil {
 		switch prevFailed.(type) {
 		case *jsonutils.JSONArray:
@@ -794,7 +852,7 @@ func (task *STask) SetStageFailed(ctx context.Context, reason jsonutils.JSONObje
 		}
 	}
 	data := jsonutils.NewDict()
-	data.Add(reason, "__failed_reason")
+	data.Add(reason, TASK_FAILED_REASON_KEY)
 	task.SetStage(TASK_STAGE_FAILED, data)
 	task.SetProgressAndStatus(100, taskStatusDone)
 	task.NotifyParentTaskFailure(ctx, reason)
@@ -1528,7 +1586,11 @@ func (task *STask) PerformCancel(
 	if utils.IsInArray(task.Stage, []string{TASK_STAGE_FAILED, TASK_STAGE_COMPLETE}) {
 		return nil, errors.Wrapf(errors.ErrInvalidStatus, "cannot cancel stage in %s", task.Stage)
 	}
-	err := task.cancel(ctx, nil)
+	reason := input.Reason
+	if len(reason) == 0 {
+		reason = fmt.Sprintf("cancelled by %s", userCred.GetUserName())
+	}
+	err := task.cancel(ctx, userCred, reason)
 	if err != nil {
 		return nil, errors.Wrap(err, "cancel")
 	}
@@ -1546,28 +1608,102 @@ func (task *STask) fetchSubTasks() ([]STask, error) {
 	return tasks, nil
 }
 
-func (task *STask) cancel(ctx context.Context, reason *jsonutils.JSONDict) error {
+func (task *STask) cancel(ctx context.Context, userCred mcclient.TokenCredential, reason string) error {
 	if utils.IsInArray(task.Stage, []string{TASK_STAGE_FAILED, TASK_STAGE_COMPLETE}) {
 		return nil
 	}
-	if reason == nil {
-		reason = jsonutils.NewDict()
-		reason.Add(jsonutils.NewString("cancel"), "__reason__")
-		reason.Add(jsonutils.NewString("error"), "__status__")
-	}
 
 	subtasks, err := task.fetchSubTasks()
 	if err != nil {
 		return errors.Wrap(err, "fetchSubTasks")
 	}
 	for i := range subtasks {
-		err := subtasks[i].cancel(ctx, reason)
+		err := subtasks[i].cancel(ctx, userCred, reason)
 		if err != nil {
 			return errors.Wrap(err, "cancelTask")
 		}
 	}
 
 	task.fixParams()
-	TaskManager.execTask(task.GetTaskId(), reason)
+	task.logCancel(ctx, userCred, reason)
+
+	data := jsonutils.NewDict()
+	data.Add(jsonutils.NewString(reason), "__reason__")
+	data.Add(jsonutils.NewString("error"), "__status__")
+	data.Add(jsonutils.JSONTrue, TASK_CANCEL_KEY)
+	TaskManager.execTask(task.GetTaskId(), data)
 	return nil
 }
+
+// logCancel records the cancellation in the opslog of the task objects
+func (task *STask) logCancel(ctx context.Context, userCred mcclient.TokenCredential, reason string) {
+	manager, ok := db.GetModelManager(task.ObjType).(db.IStandaloneModelManager)
+	if !ok {
+		return
+	}
+	objIds := []string{task.ObjId}
+	if task.ObjId == MULTI_OBJECTS_ID {
+		objIds = TaskObjectManager.GetObjectIds(task)
+	}
+	notes := jsonutils.NewDict()
+	notes.Add(jsonutils.NewString(task.TaskName), "task")
+	notes.Add(jsonutils.NewString(task.Id), "task_id")
+	notes.Add(jsonutils.NewString(task.Stage), "stage")
+	notes.Add(jsonutils.NewString(reason), "reason")
+	for _, objId := range objIds {
+		obj, err := manager.FetchById(objId)
+		if err != nil {
+			log.Errorf("fetch %s %s of cancelled task %s: %v", task.ObjType, objId, task.Id, err)
+			continue
+		}
+		db.OpsLog.LogEvent(obj, db.ACT_CANCEL, notes, userCred)
+	}
+}
+
+// stageStartAt returns the time the task entered its current stage
+func (task *STask) stageStartAt() time.Time {
+	if task.Params != nil {
+		stages, _ := task.Params.GetArray(TASK_STAGES_KEY)
+		if len(stages) > 0 {
+			completeAt, _ := stages[len(stages)-1].GetTime("complete_at")
+			if !completeAt.IsZero() {
+				return completeAt
+			}
+		}
+	}
+	if !task.StartAt.IsZero() {
+		return task.StartAt
+	}
+	return task.CreatedAt
+}
+
+// TaskTimeoutJob cancels the tasks staying in a stage longer than the stage
+// timeout declared when registering the task
+func (manager *STaskManager) TaskTimeoutJob(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	taskNames := getStageTimeoutTaskNames()
+	if len(taskNames) == 0 {
+		return
+	}
+	q := manager.Query().In("task_name", taskNames).NotIn("stage", []string{TASK_STAGE_FAILED, TASK_STAGE_COMPLETE})
+	tasks := make([]STask, 0)
+	err := db.FetchModelObjects(manager, q, &tasks)
+	if err != nil {
+		log.Errorf("TaskTimeoutJob FetchModelObjects fail %s", err)
+		return
+	}
+	now := time.Now()
+	for i := range tasks {
+		task := &tasks[i]
+		task.fixParams()
+		timeout := getStageTimeout(task.TaskName, task.Stage)
+		if timeout <= 0 || now.Sub(task.stageStartAt()) < timeout {
+			continue
+		}
+		reason := fmt.Sprintf("stage %s timeout after %s", task.Stage, timeout)
+		log.Warningf("Task %s(%s) %s, cancel it", task.TaskName, task.Id, reason)
+		err := task.cancel(ctx, userCred, reason)
+		if err != nil {
+			log.Errorf("cancel timeout task %s(%s) fail %s", task.TaskName, task.Id, err)
+		}
+	}
+}
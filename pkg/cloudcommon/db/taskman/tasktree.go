@@ -0,0 +1,420 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskman
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+
+	"yunion.io/x/onecloud/pkg/apis"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+const maxTaskTreeDepth = 16
+
+// sTaskTreeItem is a task of a tree, either still in tasks_tbl or already
+// moved to archived_tasks_tbl
+type sTaskTreeItem struct {
+	id        string
+	createdAt time.Time
+	archived  bool
+
+	STaskBase
+}
+
+func (item *sTaskTreeItem) startTime() time.Time {
+	if !item.StartAt.IsZero() {
+		return item.StartAt
+	}
+	return item.createdAt
+}
+
+func fetchTaskTreeItem(taskId string) (*sTaskTreeItem, error) {
+	tasks := make([]STask, 0)
+	q := TaskManager.Query().Equals("id", taskId)
+	err := db.FetchModelObjects(TaskManager, q, &tasks)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	if len(tasks) > 0 {
+		return &sTaskTreeItem{id: tasks[0].Id, createdAt: tasks[0].CreatedAt, STaskBase: tasks[0].STaskBase}, nil
+	}
+	if ArchivedTaskManager != nil {
+		archived := make([]SArchivedTask, 0)
+		q := ArchivedTaskManager.Query().Equals("task_id", taskId).Desc("id").Limit(1)
+		err := db.FetchModelObjects(ArchivedTaskManager, q, &archived)
+		if err != nil {
+			return nil, errors.Wrap(err, "FetchModelObjects archived")
+		}
+		if len(archived) > 0 {
+			return &sTaskTreeItem{id: archived[0].TaskId, archived: true, STaskBase: archived[0].STaskBase}, nil
+		}
+	}
+	return nil, errors.Wrapf(errors.ErrNotFound, "task %s", taskId)
+}
+
+func fetchChildTaskTreeItems(parentTaskId string) ([]sTaskTreeItem, error) {
+	ret := make([]sTaskTreeItem, 0)
+	tasks := make([]STask, 0)
+	q := TaskManager.Query().Equals("parent_task_id", parentTaskId)
+	err := db.FetchModelObjects(TaskManager, q, &tasks)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	taskIds := make(map[string]bool)
+	for i := range tasks {
+		taskIds[tasks[i].Id] = true
+		ret = append(ret, sTaskTreeItem{id: tasks[i].Id, createdAt: tasks[i].CreatedAt, STaskBase: tasks[i].STaskBase})
+	}
+	if ArchivedTaskManager != nil {
+		archived := make([]SArchivedTask, 0)
+		q := ArchivedTaskManager.Query().Equals("parent_task_id", parentTaskId).Desc("id")
+		err := db.FetchModelObjects(ArchivedTaskManager, q, &archived)
+		if err != nil {
+			return nil, errors.Wrap(err, "FetchModelObjects archived")
+		}
+		for i := range archived {
+			// a retried task may be archived more than once, keep the latest one
+			if taskIds[archived[i].TaskId] {
+				continue
+			}
+			taskIds[archived[i].TaskId] = true
+			ret = append(ret, sTaskTreeItem{id: archived[i].TaskId, archived: true, STaskBase: archived[i].STaskBase})
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].startTime().Before(ret[j].startTime())
+	})
+	return ret, nil
+}
+
+func isTaskStageFinished(stage string) bool {
+	return stage == TASK_STAGE_COMPLETE || stage == TASK_STAGE_FAILED
+}
+
+// taskStageTimings computes the time spent in each stage from the stage
+// transitions recorded by SetStage. A stage is failed when the task switched
+// to the failed stage right after it.
+func taskStageTimings(params *jsonutils.JSONDict, startAt time.Time, stage string, now time.Time) []apis.TaskStageInfo {
+	ret := make([]apis.TaskStageInfo, 0)
+	prev := startAt
+	if params != nil {
+		stages, _ := params.GetArray(TASK_STAGES_KEY)
+		for i := range stages {
+			name, _ := stages[i].GetString("name")
+			completeAt, _ := stages[i].GetTime("complete_at")
+			next := stage
+			if i+1 < len(stages) {
+				next, _ = stages[i+1].GetString("name")
+			}
+			ret = append(ret, apis.TaskStageInfo{
+				Name:     name,
+				StartAt:  prev,
+				EndAt:    completeAt,
+				Duration: completeAt.Sub(prev).Seconds(),
+				Failed:   name != TASK_STAGE_FAILED && next == TASK_STAGE_FAILED,
+			})
+			prev = completeAt
+		}
+	}
+	if !isTaskStageFinished(stage) {
+		ret = append(ret, apis.TaskStageInfo{
+			Name:     stage,
+			StartAt:  prev,
+			Duration: now.Sub(prev).Seconds(),
+		})
+	}
+	return ret
+}
+
+// stageAtTime returns the stage the task was in at the given time
+func stageAtTime(stages []apis.TaskStageInfo, tm time.Time) string {
+	for i := range stages {
+		if tm.Before(stages[i].StartAt) {
+			continue
+		}
+		if stages[i].EndAt.IsZero() || tm.Before(stages[i].EndAt) {
+			return stages[i].Name
+		}
+	}
+	return ""
+}
+
+func buildTaskTree(item *sTaskTreeItem, depth int, visited map[string]bool, now time.Time) apis.TaskTreeNode {
+	visited[item.id] = true
+	node := apis.TaskTreeNode{
+		Id:           item.id,
+		TaskName:     item.TaskName,
+		ObjType:      item.ObjType,
+		ObjId:        item.ObjId,
+		Object:       item.Object,
+		Stage:        item.Stage,
+		Status:       item.Status,
+		ParentTaskId: item.ParentTaskId,
+		Archived:     item.archived,
+		StartAt:      item.startTime(),
+		EndAt:        item.EndAt,
+	}
+	if isTaskStageFinished(item.Stage) && !item.EndAt.IsZero() {
+		node.Duration = item.EndAt.Sub(node.StartAt).Seconds()
+	} else {
+		node.Duration = now.Sub(node.StartAt).Seconds()
+	}
+	node.Stages = taskStageTimings(item.Params, node.StartAt, item.Stage, now)
+	if depth >= maxTaskTreeDepth {
+		return node
+	}
+	children, err := fetchChildTaskTreeItems(item.id)
+	if err != nil {
+		log.Errorf("fetch sub tasks of %s: %v", item.id, err)
+		return node
+	}
+	for i := range children {
+		if visited[children[i].id] {
+			continue
+		}
+		child := buildTaskTree(&children[i], depth+1, visited, now)
+		if subtask := SubTaskManager.GetSubTask(item.id, children[i].id); subtask != nil {
+			child.ParentStage = subtask.Stage
+		} else {
+			// the subtask records are purged once the parent task is archived
+			child.ParentStage = stageAtTime(node.Stages, child.StartAt)
+		}
+		node.SubTasks = append(node.SubTasks, child)
+	}
+	return node
+}
+
+func getTaskTree(taskId string) (*apis.TaskTreeNode, error) {
+	item, err := fetchTaskTreeItem(taskId)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetchTaskTreeItem")
+	}
+	node := buildTaskTree(item, 0, make(map[string]bool), time.Now())
+	return &node, nil
+}
+
+// 获取任务及其全部子任务的执行树
+func (task *STask) GetDetailsTree(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (*apis.TaskTreeNode, error) {
+	return getTaskTree(task.Id)
+}
+
+// 获取已归档任务及其全部子任务的执行树
+func (task *SArchivedTask) GetDetailsTree(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (*apis.TaskTreeNode, error) {
+	return getTaskTree(task.TaskId)
+}
+
+// lastFailedStage returns the stage the task was in when it failed for the last time
+func lastFailedStage(params *jsonutils.JSONDict) string {
+	if params == nil {
+		return ""
+	}
+	reason, _ := params.Get(TASK_FAILED_REASON_KEY)
+	var reasons []jsonutils.JSONObject
+	switch r := reason.(type) {
+	case *jsonutils.JSONArray:
+		reasons, _ = r.GetArray()
+	case *jsonutils.JSONDict:
+		reasons = []jsonutils.JSONObject{r}
+	}
+	for i := len(reasons) - 1; i >= 0; i-- {
+		stage, _ := reasons[i].GetString("stage")
+		if len(stage) > 0 && !isTaskStageFinished(stage) {
+			return stage
+		}
+	}
+	return ""
+}
+
+// enteredStages returns the stages the task has ever been in
+func enteredStages(params *jsonutils.JSONDict) []string {
+	ret := make([]string, 0)
+	if params == nil {
+		return ret
+	}
+	stages, _ := params.GetArray(TASK_STAGES_KEY)
+	for i := range stages {
+		name, _ := stages[i].GetString("name")
+		if len(name) > 0 && !isTaskStageFinished(name) && !utils.IsInArray(name, ret) {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// 从失败的阶段重新执行任务
+func (task *STask) PerformRetry(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input apis.TaskRetryInput,
+) (jsonutils.JSONObject, error) {
+	if !db.IsAdminAllowPerform(ctx, userCred, task, "retry") {
+		return nil, httperrors.NewForbiddenError("not allow to retry task")
+	}
+	lockman.LockRawObject(ctx, "tasks", task.Id)
+	defer lockman.ReleaseRawObject(ctx, "tasks", task.Id)
+
+	err := task.retry(ctx, userCred, input)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (task *STask) retry(ctx context.Context, userCred mcclient.TokenCredential, input apis.TaskRetryInput) error {
+	if task.Stage != TASK_STAGE_FAILED {
+		return httperrors.NewInvalidStatusError("cannot retry task in stage %s", task.Stage)
+	}
+	if !isTaskExist(task.TaskName) {
+		return httperrors.NewNotSupportedError("task %s is not supported by this service", task.TaskName)
+	}
+	if parentTaskId := task.GetParentTaskId(); len(parentTaskId) > 0 {
+		// the parent task would never be notified once it is finished
+		parentTask := TaskManager.fetchTask(parentTaskId)
+		if parentTask == nil || isTaskStageFinished(parentTask.Stage) {
+			return httperrors.NewInvalidStatusError("parent task %s has finished, retry the parent task instead", parentTaskId)
+		}
+	}
+	task.fixParams()
+	stage := input.Stage
+	if len(stage) == 0 {
+		stage = lastFailedStage(task.Params)
+		if len(stage) == 0 {
+			return httperrors.NewInvalidStatusError("no failed stage recorded for task %s", task.Id)
+		}
+	} else if !utils.IsInArray(stage, enteredStages(task.Params)) {
+		return httperrors.NewInputParameterError("task %s has never entered stage %s", task.Id, stage)
+	}
+
+	retry := jsonutils.NewDict()
+	retry.Add(jsonutils.NewString(stage), "stage")
+	retry.Add(jsonutils.NewString(userCred.GetUserName()), "user")
+	retry.Add(jsonutils.NewTimeString(time.Now()), "retry_at")
+	retries, _ := task.Params.GetArray(TASK_RETRIES_KEY)
+	data := jsonutils.NewDict()
+	data.Add(jsonutils.NewArray(append(retries, retry)...), TASK_RETRIES_KEY)
+	// leaving the failed stage records the time the task stayed failed
+	err := task.SetStage(stage, data)
+	if err != nil {
+		return errors.Wrap(err, "SetStage")
+	}
+	err = task.SetProgressAndStatus(0, TASK_STATUS_QUEUE)
+	if err != nil {
+		return errors.Wrap(err, "SetProgressAndStatus")
+	}
+	log.Infof("Task %s(%s) retry from stage %s by %s", task.TaskName, task.Id, stage, userCred.GetUserName())
+	return task.ScheduleRun(nil)
+}
+
+// 恢复已归档的失败任务并从失败的阶段重新执行
+func (task *SArchivedTask) PerformRetry(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input apis.TaskRetryInput,
+) (jsonutils.JSONObject, error) {
+	if !db.IsAdminAllowPerform(ctx, userCred, task, "retry") {
+		return nil, httperrors.NewForbiddenError("not allow to retry task")
+	}
+	if task.Stage != TASK_STAGE_FAILED {
+		return nil, httperrors.NewInvalidStatusError("cannot retry task in stage %s", task.Stage)
+	}
+	lockman.LockRawObject(ctx, "tasks", task.TaskId)
+	defer lockman.ReleaseRawObject(ctx, "tasks", task.TaskId)
+
+	restored, err := task.restore(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "restore")
+	}
+	err = restored.retry(ctx, userCred, input)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// restore moves an archived task back to tasks_tbl, the archived record is
+// kept and the task will be archived again once it finishes
+func (task *SArchivedTask) restore(ctx context.Context) (*STask, error) {
+	cnt, err := TaskManager.Query().Equals("id", task.TaskId).CountWithError()
+	if err != nil {
+		return nil, errors.Wrap(err, "CountWithError")
+	}
+	if cnt > 0 {
+		restored := TaskManager.fetchTask(task.TaskId)
+		if restored == nil {
+			return nil, errors.Wrapf(errors.ErrNotFound, "task %s", task.TaskId)
+		}
+		return restored, nil
+	}
+
+	manager, ok := db.GetModelManager(task.ObjType).(db.IStandaloneModelManager)
+	if !ok {
+		return nil, httperrors.NewNotSupportedError("task object type %s is not supported by this service", task.ObjType)
+	}
+	objIds := []string{task.ObjId}
+	if task.ObjId == MULTI_OBJECTS_ID {
+		objIds = task.ObjIds
+	}
+	objs := make([]db.IStandaloneModel, 0, len(objIds))
+	for _, objId := range objIds {
+		obj, err := manager.FetchById(objId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetch %s %s", task.ObjType, objId)
+		}
+		objs = append(objs, obj.(db.IStandaloneModel))
+	}
+
+	restored := &STask{Id: task.TaskId, STaskBase: task.STaskBase}
+	restored.SetModelManager(TaskManager, restored)
+	err = TaskManager.TableSpec().Insert(ctx, restored)
+	if err != nil {
+		return nil, errors.Wrap(err, "Insert")
+	}
+	projectIds, domainIds := []string{}, []string{}
+	for i := range objs {
+		to, err := TaskObjectManager.insertObject(ctx, restored.Id, objs[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "insertObject")
+		}
+		if !utils.IsInArray(to.ProjectId, projectIds) {
+			projectIds = append(projectIds, to.ProjectId)
+		}
+		if !utils.IsInArray(to.DomainId, domainIds) {
+			domainIds = append(domainIds, to.DomainId)
+		}
+	}
+	_, err = db.Update(restored, func() error {
+		restored.ProjectId = strings.Join(projectIds, ",")
+		restored.DomainId = strings.Join(domainIds, ",")
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Update")
+	}
+	restored.fixParams()
+	return restored, nil
+}
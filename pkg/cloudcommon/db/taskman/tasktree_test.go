@@ -0,0 +1,95 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskman
+
+import (
+	"testing"
+	"time"
+
+	"yunion.io/x/jsonutils"
+)
+
+func stageEntry(name string, completeAt time.Time) *jsonutils.JSONDict {
+	entry := jsonutils.NewDict()
+	entry.Add(jsonutils.NewString(name), "name")
+	entry.Add(jsonutils.NewTimeString(completeAt), "complete_at")
+	return entry
+}
+
+func TestTaskStageTimings(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.NewArray(
+		stageEntry("on_init", start.Add(10*time.Second)),
+		stageEntry("OnDeployComplete", start.Add(70*time.Second)),
+		stageEntry("failed", start.Add(100*time.Second)),
+	), TASK_STAGES_KEY)
+
+	stages := taskStageTimings(params, start, "OnDeployComplete", start.Add(130*time.Second))
+	if len(stages) != 4 {
+		t.Fatalf("expect 4 stages, got %d", len(stages))
+	}
+	for i, want := range []struct {
+		name     string
+		duration float64
+		failed   bool
+	}{
+		{"on_init", 10, false},
+		{"OnDeployComplete", 60, true},
+		{"failed", 30, false},
+		{"OnDeployComplete", 30, false},
+	} {
+		if stages[i].Name != want.name || stages[i].Duration != want.duration || stages[i].Failed != want.failed {
+			t.Errorf("stage %d: got %s %v failed=%v, want %s %v failed=%v", i, stages[i].Name, stages[i].Duration, stages[i].Failed, want.name, want.duration, want.failed)
+		}
+	}
+	if !stages[3].EndAt.IsZero() {
+		t.Errorf("running stage should not have end time")
+	}
+	if stage := stageAtTime(stages, start.Add(20*time.Second)); stage != "OnDeployComplete" {
+		t.Errorf("stageAtTime got %s", stage)
+	}
+	if stage := stageAtTime(stages, start.Add(200*time.Second)); stage != "OnDeployComplete" {
+		t.Errorf("stageAtTime of running stage got %s", stage)
+	}
+}
+
+func TestLastFailedStage(t *testing.T) {
+	reason := func(stage string) *jsonutils.JSONDict {
+		r := jsonutils.NewDict()
+		r.Add(jsonutils.NewString(stage), "stage")
+		r.Add(jsonutils.NewString("error"), "reason")
+		return r
+	}
+	cases := []struct {
+		name   string
+		reason jsonutils.JSONObject
+		want   string
+	}{
+		{"none", nil, ""},
+		{"single", reason("OnDeployComplete"), "OnDeployComplete"},
+		{"multiple", jsonutils.NewArray(reason("on_init"), reason("OnStartComplete")), "OnStartComplete"},
+		{"finished", jsonutils.NewArray(reason("on_init"), reason("failed")), "on_init"},
+	}
+	for _, c := range cases {
+		params := jsonutils.NewDict()
+		if c.reason != nil {
+			params.Add(c.reason, TASK_FAILED_REASON_KEY)
+		}
+		if got := lastFailedStage(params); got != c.want {
+			t.Errorf("%s: got %q want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -52,9 +52,40 @@ func getTaskWorkMan(task *STask) *appsrv.SWorkerManager {
 	}
 	log.Infof("TaskWorkerManager %d", consts.TaskWorkerCount())
 	_taskWorkMan = appsrv.NewWorkerManager("TaskWorkerManager", consts.TaskWorkerCount(), 1024, true)
+	_taskWorkMan.EnableFairQueue()
 	return _taskWorkMan
 }
 
+// getTaskWorkManagers returns all the worker managers tasks are dispatched to
+func getTaskWorkManagers() []*appsrv.SWorkerManager {
+	taskWorkManLock.Lock()
+	defer taskWorkManLock.Unlock()
+
+	ret := make([]*appsrv.SWorkerManager, 0)
+	if _taskWorkMan != nil {
+		ret = append(ret, _taskWorkMan)
+	}
+	appendWorkMan := func(workerMan *appsrv.SWorkerManager) {
+		for i := range ret {
+			if ret[i] == workerMan {
+				return
+			}
+		}
+		ret = append(ret, workerMan)
+	}
+	for _, worker := range taskWorkerMap {
+		switch workerMan := worker.(type) {
+		case *appsrv.SWorkerManager:
+			appendWorkMan(workerMan)
+		case *appsrv.SHashedWorkerManager:
+			for _, man := range workerMan.GetWorkerManagers() {
+				appendWorkMan(man)
+			}
+		}
+	}
+	return ret
+}
+
 /*func UpdateWorkerCount(workerCount int) error {
 	if workerCount != DEFAULT_WORKER_COUNT {
 		log.Infof("update task work count: %d", workerCount)
@@ -64,8 +95,14 @@ func getTaskWorkMan(task *STask) *appsrv.SWorkerManager {
 }*/
 
 type taskTask struct {
-	taskId string
-	data   jsonutils.JSONObject
+	taskId    string
+	data      jsonutils.JSONObject
+	projectId string
+	domainId  string
+}
+
+func (t *taskTask) GetFairQueueOwner() (string, string) {
+	return t.projectId, t.domainId
 }
 
 func (t *taskTask) Run() {
@@ -84,8 +121,10 @@ func runTask(taskId string, data jsonutils.JSONObject) error {
 	worker := getTaskWorkMan(baseTask)
 
 	task := &taskTask{
-		taskId: taskId,
-		data:   data,
+		taskId:    taskId,
+		data:      data,
+		projectId: baseTask.ProjectId,
+		domainId:  baseTask.DomainId,
 	}
 
 	isOk := worker.Run(task, nil, func(err error) {
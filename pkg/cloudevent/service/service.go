@@ -68,6 +68,7 @@ func StartService() {
 		cron.AddJobEveryFewHour("AutoPurgeSplitable", 4, 30, 0, db.AutoPurgeSplitable, false)
 
 		cron.AddJobAtIntervalsWithStartRun("TaskCleanupJob", time.Duration(options.Options.TaskArchiveIntervalMinutes)*time.Minute, taskman.TaskManager.TaskCleanupJob, true)
+		cron.AddJobAtIntervals("TaskTimeoutJob", time.Minute, taskman.TaskManager.TaskTimeoutJob)
 
 		cron.Start()
 		defer cron.Stop()
@@ -523,6 +523,14 @@ func (drv *SBaseGuestDriver) QgaRequestGetOsInfo(ctx context.Context, userCred m
 	return nil, httperrors.ErrNotImplemented
 }
 
+func (drv *SBaseGuestDriver) QgaRequestFsFreeze(ctx context.Context, header http.Header, host *models.SHost, guest *models.SGuest) (bool, error) {
+	return false, httperrors.ErrNotImplemented
+}
+
+func (drv *SBaseGuestDriver) QgaRequestFsThaw(ctx context.Context, header http.Header, host *models.SHost, guest *models.SGuest) (bool, error) {
+	return false, httperrors.ErrNotImplemented
+}
+
 func (drv *SBaseGuestDriver) RequestQgaCommand(ctx context.Context, userCred mcclient.TokenCredential, body jsonutils.JSONObject, host *models.SHost, guest *models.SGuest) (jsonutils.JSONObject, error) {
 	return nil, httperrors.ErrNotImplemented
 }
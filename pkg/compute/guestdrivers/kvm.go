@@ -144,6 +144,9 @@ func (self *SKVMGuestDriver) RequestDiskSnapshot(ctx context.Context, guest *mod
 	body := jsonutils.NewDict()
 	body.Set("disk_id", jsonutils.NewString(diskId))
 	body.Set("snapshot_id", jsonutils.NewString(snapshotId))
+	if snapshot.Consistent {
+		body.Set("consistent", jsonutils.JSONTrue)
+	}
 
 	if snapshot.DiskBackupId != "" {
 		backupObj, err := models.DiskBackupManager.FetchById(snapshot.DiskBackupId)
@@ -456,18 +459,27 @@ func (self *SKVMGuestDriver) RequestChangeVmConfig(ctx context.Context, guest *m
 	if jsonutils.QueryBoolean(taskParams, "guest_online", false) {
 		addCpu := vcpuCount - int64(guest.VcpuCount)
 		addMem := vmemSize - int64(guest.VmemSize)
-		if addCpu < 0 || addMem < 0 {
-			return fmt.Errorf("KVM guest doesn't support online reduce cpu or mem")
+		if addCpu < 0 && !isGuestSupportHotUnplugCpu(ctx, guest) {
+			return fmt.Errorf("KVM guest doesn't support online reduce cpu")
+		}
+		if addMem < 0 && !isGuestSupportVirtioMem(ctx, guest) {
+			return fmt.Errorf("KVM guest doesn't support online reduce mem")
 		}
 		header := task.GetTaskRequestHeader()
 		body := jsonutils.NewDict()
 		if vcpuCount > int64(guest.VcpuCount) {
 			body.Set("add_cpu", jsonutils.NewInt(addCpu))
 			body.Set("total_cpu", jsonutils.NewInt(int64(guest.VcpuCount)))
+		} else if vcpuCount < int64(guest.VcpuCount) {
+			body.Set("del_cpu", jsonutils.NewInt(-addCpu))
+			body.Set("total_cpu", jsonutils.NewInt(int64(guest.VcpuCount)))
 		}
 		if vmemSize > int64(guest.VmemSize) {
 			body.Set("add_mem", jsonutils.NewInt(addMem))
 			body.Set("total_mem", jsonutils.NewInt(int64(guest.VmemSize)))
+		} else if vmemSize < int64(guest.VmemSize) {
+			body.Set("del_mem", jsonutils.NewInt(-addMem))
+			body.Set("total_mem", jsonutils.NewInt(int64(guest.VmemSize)))
 		}
 		if taskParams.Contains("cpu_numa_pin") {
 			cpuNumaPin, _ := taskParams.Get("cpu_numa_pin")
@@ -772,24 +784,37 @@ func (self *SKVMGuestDriver) OnGuestChangeCpuMemFailed(ctx context.Context, gues
 	var cpuAdded int64
 	if jsonutils.QueryBoolean(data, "add_cpu_failed", false) {
 		cpuAdded, _ = data.Int("added_cpu")
+	} else if jsonutils.QueryBoolean(data, "del_cpu_failed", false) {
+		cpuDeleted, _ := data.Int("deleted_cpu")
+		cpuAdded = -cpuDeleted
 	} else if jsonutils.QueryBoolean(data, "add_mem_failed", false) {
 		vcpuCount, _ := task.GetParams().Int("vcpu_count")
-		if vcpuCount-int64(guest.VcpuCount) > 0 {
+		if vcpuCount > 0 {
 			cpuAdded = vcpuCount - int64(guest.VcpuCount)
 		}
 	}
-	if cpuAdded > 0 {
+	// memory partially resized by virtio-mem
+	vmemSize, _ := data.Int("vmem_size")
+	if vmemSize == int64(guest.VmemSize) {
+		vmemSize = 0
+	}
+	if cpuAdded != 0 || vmemSize > 0 {
 		_, err := db.Update(guest, func() error {
 			guest.VcpuCount = guest.VcpuCount + int(cpuAdded)
+			if vmemSize > 0 {
+				guest.VmemSize = int(vmemSize)
+			}
 			return nil
 		})
 		if err != nil {
 			return err
 		}
-		db.OpsLog.LogEvent(guest, db.ACT_CHANGE_FLAVOR,
-			fmt.Sprintf("Change config task failed but added cpu count %d", cpuAdded), task.GetUserCred())
-		logclient.AddActionLogWithContext(ctx, guest, logclient.ACT_VM_CHANGE_FLAVOR,
-			fmt.Sprintf("Change config task failed but added cpu count %d", cpuAdded), task.GetUserCred(), false)
+		notes := fmt.Sprintf("Change config task failed but added cpu count %d", cpuAdded)
+		if vmemSize > 0 {
+			notes += fmt.Sprintf(", memory resized to %dM", vmemSize)
+		}
+		db.OpsLog.LogEvent(guest, db.ACT_CHANGE_FLAVOR, notes, task.GetUserCred())
+		logclient.AddActionLogWithContext(ctx, guest, logclient.ACT_VM_CHANGE_FLAVOR, notes, task.GetUserCred(), false)
 
 		models.HostManager.ClearSchedDescCache(guest.HostId)
 	}
@@ -1032,6 +1057,30 @@ func (self *SKVMGuestDriver) ValidateCreateData(ctx context.Context, userCred mc
 		input.Vdi, input.Vga = self.validateVGA("", "", &input.Vdi, &input.Vga)
 	}
 
+	if input.EnableSecureBoot {
+		if apis.IsARM(input.OsArch) {
+			return nil, httperrors.NewInputParameterError("secure boot is not supported for arch %q", input.OsArch)
+		}
+		// secure boot relies on OVMF variables protected by SMM which is only available on q35
+		if len(input.Bios) == 0 {
+			input.Bios = "UEFI"
+		} else if input.Bios != "UEFI" {
+			return nil, httperrors.NewInputParameterError("secure boot requires UEFI boot mode")
+		}
+		if len(input.Machine) == 0 {
+			input.Machine = api.VM_MACHINE_TYPE_Q35
+		} else if input.Machine != api.VM_MACHINE_TYPE_Q35 {
+			return nil, httperrors.NewInputParameterError("secure boot requires machine type %s", api.VM_MACHINE_TYPE_Q35)
+		}
+	}
+
+	// the vTPM state is kept beside the system disk file so that it follows
+	// the disk in snapshot, backup and migration
+	if input.EnableVtpm && len(input.Disks) > 0 && !utils.IsInStringArray(input.Disks[0].Backend, api.VTPM_STATE_STORAGE) {
+		return nil, httperrors.NewNotSupportedError("vtpm requires system disk on storage %s, not %s",
+			strings.Join(api.VTPM_STATE_STORAGE, ","), input.Disks[0].Backend)
+	}
+
 	if input.Machine != "" {
 		if err := self.validateMachineType(input.Machine, input.OsArch); err != nil {
 			return nil, errors.Wrap(err, "validateMachineType")
@@ -1178,6 +1227,24 @@ func (self *SKVMGuestDriver) QgaRequestGetOsInfo(ctx context.Context, userCred m
 	return res, nil
 }
 
+func (self *SKVMGuestDriver) QgaRequestFsFreeze(ctx context.Context, header http.Header, host *models.SHost, guest *models.SGuest) (bool, error) {
+	url := fmt.Sprintf("%s/servers/%s/qga-fs-freeze", host.ManagerUri, guest.Id)
+	_, res, err := httputils.JSONRequest(httputils.GetDefaultClient(), ctx, "POST", url, header, nil, false)
+	if err != nil {
+		return false, errors.Wrap(err, "host request")
+	}
+	return jsonutils.QueryBoolean(res, "frozen", false), nil
+}
+
+func (self *SKVMGuestDriver) QgaRequestFsThaw(ctx context.Context, header http.Header, host *models.SHost, guest *models.SGuest) (bool, error) {
+	url := fmt.Sprintf("%s/servers/%s/qga-fs-thaw", host.ManagerUri, guest.Id)
+	_, res, err := httputils.JSONRequest(httputils.GetDefaultClient(), ctx, "POST", url, header, nil, false)
+	if err != nil {
+		return false, errors.Wrap(err, "host request")
+	}
+	return jsonutils.QueryBoolean(res, "quiesced", false), nil
+}
+
 func (self *SKVMGuestDriver) QgaRequestSetUserPassword(ctx context.Context, task taskman.ITask, host *models.SHost, guest *models.SGuest, input *api.ServerQgaSetPasswordInput) error {
 	url := fmt.Sprintf("%s/servers/%s/qga-set-password", host.ManagerUri, guest.Id)
 	httpClient := httputils.GetDefaultClient()
@@ -1293,9 +1360,27 @@ func (kvm *SKVMGuestDriver) ValidateGuestHotChangeConfigInput(ctx context.Contex
 	if apis.IsARM(guest.OsArch) {
 		return confs, errors.Wrap(errors.ErrInvalidStatus, "cpu architecture is arm")
 	}
+	if confs.VcpuCount < confs.Old.VcpuCount && !isGuestSupportHotUnplugCpu(ctx, guest) {
+		return confs, errors.Wrap(errors.ErrInvalidStatus, "guest doesn't support cpu hot unplug, stop it to reduce cpu")
+	}
+	if confs.VmemSize < confs.Old.VmemSize && !isGuestSupportVirtioMem(ctx, guest) {
+		return confs, errors.Wrap(errors.ErrInvalidStatus, "guest has no virtio-mem device, stop it to reduce memory")
+	}
 	return confs, nil
 }
 
+// cpu hot unplug requires guest os handle acpi eject, windows doesn't support it
+func isGuestSupportHotUnplugCpu(ctx context.Context, guest *models.SGuest) bool {
+	if guest.IsWindows() {
+		return false
+	}
+	return guest.GetMetadata(ctx, api.VM_METADATA_HOT_UNPLUG_CPU, nil) == "enable"
+}
+
+func isGuestSupportVirtioMem(ctx context.Context, guest *models.SGuest) bool {
+	return guest.GetMetadata(ctx, api.VM_METADATA_VIRTIO_MEM, nil) == "enable"
+}
+
 func (kvm *SKVMGuestDriver) GetRandomNetworkTypes() []api.TNetworkType {
 	return []api.TNetworkType{api.NETWORK_TYPE_GUEST, api.NETWORK_TYPE_HOSTLOCAL}
 }
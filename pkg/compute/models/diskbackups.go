@@ -25,6 +25,8 @@ import (
 	"yunion.io/x/log"
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/gotypes"
+	"yunion.io/x/pkg/util/stringutils"
+	"yunion.io/x/pkg/utils"
 	"yunion.io/x/sqlchemy"
 
 	api "yunion.io/x/onecloud/pkg/apis/compute"
@@ -67,6 +69,18 @@ type SDiskBackup struct {
 	// 操作系统类型
 	OsType     string `width:"32" charset:"ascii" nullable:"true" list:"user" create:"optional"`
 	DiskConfig *SBackupDiskConfig
+
+	// 增量备份链ID, 同一备份链的备份共享按内容寻址的数据块
+	ChainId string `width:"36" charset:"ascii" nullable:"true" list:"user" index:"true"`
+	// 增量备份的父备份ID, 为空表示全量备份
+	ParentBackupId string `width:"36" charset:"ascii" nullable:"true" list:"user"`
+	// 备份链保留的最大增量备份数量, 0为不限制
+	MaxIncrements int `nullable:"false" default:"0" list:"user"`
+
+	// 是否冻结文件系统创建一致性备份
+	Consistent bool `nullable:"false" default:"false" list:"user" create:"optional"`
+	// 备份所用快照创建时文件系统是否已成功冻结
+	Quiesced bool `nullable:"false" default:"false" list:"user"`
 }
 
 var DiskBackupManager *SDiskBackupManager
@@ -147,6 +161,24 @@ func (self *SDiskBackup) ValidateDeleteCondition(ctx context.Context, info jsonu
 	if is {
 		return httperrors.NewBadRequestError("disk backup referenced by instance backup")
 	}
+	if len(self.ChainId) > 0 {
+		children, err := self.getChainChildren()
+		if err != nil {
+			return errors.Wrap(err, "getChainChildren")
+		}
+		if len(children) > 0 {
+			return httperrors.NewBadRequestError("disk backup is the base of %d incremental backups", len(children))
+		}
+		backups, err := self.GetChainBackups()
+		if err != nil {
+			return errors.Wrap(err, "GetChainBackups")
+		}
+		for i := range backups {
+			if backups[i].Id != self.Id && utils.IsInStringArray(backups[i].Status, []string{api.BACKUP_STATUS_CREATING, api.BACKUP_STATUS_SNAPSHOT, api.BACKUP_STATUS_SAVING, api.BACKUP_STATUS_MERGING}) {
+				return httperrors.NewBadRequestError("backup %s of the same chain is %s", backups[i].Name, backups[i].Status)
+			}
+		}
+	}
 	return nil
 }
 
@@ -186,9 +218,98 @@ func (db *SDiskBackup) getMoreDetails(out api.DiskBackupDetails) api.DiskBackupD
 	if t, _ := InstanceBackupJointManager.IsSubBackup(db.Id); t {
 		out.IsSubBackup = true
 	}
+	if len(db.ChainId) > 0 {
+		chain, err := db.GetBackupChain()
+		if err != nil {
+			log.Errorf("GetBackupChain of %s: %s", db.Id, err)
+		}
+		for i := range chain {
+			out.ChainBackupIds = append(out.ChainBackupIds, chain[i].Id)
+		}
+	}
 	return out
 }
 
+func (self *SDiskBackup) GetChainBackups() ([]SDiskBackup, error) {
+	backups := make([]SDiskBackup, 0)
+	if len(self.ChainId) == 0 {
+		return backups, nil
+	}
+	q := DiskBackupManager.Query().Equals("chain_id", self.ChainId).Asc("created_at")
+	err := db.FetchModelObjects(DiskBackupManager, q, &backups)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	return backups, nil
+}
+
+// GetBackupChain returns the backups from the full backup of the chain to self
+func (self *SDiskBackup) GetBackupChain() ([]SDiskBackup, error) {
+	if len(self.ChainId) == 0 {
+		return []SDiskBackup{*self}, nil
+	}
+	backups, err := self.GetChainBackups()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetChainBackups")
+	}
+	backupMap := make(map[string]SDiskBackup, len(backups))
+	for i := range backups {
+		backupMap[backups[i].Id] = backups[i]
+	}
+	chain := []SDiskBackup{*self}
+	parentId := self.ParentBackupId
+	for len(parentId) > 0 && len(chain) <= len(backups) {
+		parent, ok := backupMap[parentId]
+		if !ok {
+			return nil, errors.Wrapf(errors.ErrNotFound, "parent backup %s of chain %s", parentId, self.ChainId)
+		}
+		chain = append([]SDiskBackup{parent}, chain...)
+		parentId = parent.ParentBackupId
+	}
+	return chain, nil
+}
+
+func (self *SDiskBackup) getChainChildren() ([]SDiskBackup, error) {
+	backups := make([]SDiskBackup, 0)
+	q := DiskBackupManager.Query().Equals("parent_backup_id", self.Id)
+	err := db.FetchModelObjects(DiskBackupManager, q, &backups)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	return backups, nil
+}
+
+// GetOtherChainBackupIds returns the ids of the chain backups except the excluded ones
+func (self *SDiskBackup) GetOtherChainBackupIds(excludes ...string) ([]string, error) {
+	backups, err := self.GetChainBackups()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]string, 0, len(backups))
+	for i := range backups {
+		if backups[i].Id == self.Id || utils.IsInStringArray(backups[i].Id, excludes) {
+			continue
+		}
+		ret = append(ret, backups[i].Id)
+	}
+	return ret, nil
+}
+
+func (manager *SDiskBackupManager) getIncrementalParent(diskId, backupStorageId string) (*SDiskBackup, error) {
+	q := manager.Query().Equals("disk_id", diskId).Equals("backup_storage_id", backupStorageId).
+		Equals("status", api.BACKUP_STATUS_READY).IsNotEmpty("chain_id").Desc("created_at")
+	parent := &SDiskBackup{}
+	parent.SetModelManager(manager, parent)
+	err := q.First(parent)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "First")
+	}
+	return parent, nil
+}
+
 func (db *SDiskBackup) GetDisk() (*SDisk, error) {
 	iDisk, err := DiskManager.FetchById(db.DiskId)
 	if err != nil {
@@ -238,6 +359,9 @@ func (dm *SDiskBackupManager) ValidateCreateData(
 	if len(input.BackupStorageId) == 0 {
 		return input, httperrors.NewMissingParameterError("backup_storage_id")
 	}
+	if input.MaxIncrements != nil && *input.MaxIncrements < 0 {
+		return input, httperrors.NewInputParameterError("max_increments should not be negative")
+	}
 	// check disk
 	_disk, err := validators.ValidateModel(ctx, userCred, DiskManager, &input.DiskId)
 	if err != nil {
@@ -247,6 +371,14 @@ func (dm *SDiskBackupManager) ValidateCreateData(
 	if disk.Status != api.DISK_READY {
 		return input, httperrors.NewInvalidStatusError("disk %s status is not %s", disk.Name, api.DISK_READY)
 	}
+	if input.Incremental {
+		if len(disk.EncryptKeyId) > 0 {
+			return input, httperrors.NewNotSupportedError("incremental backup of encrypted disk is not supported")
+		}
+		if input.BackupAsTar != nil {
+			return input, httperrors.NewNotSupportedError("incremental backup is not supported with backup_as_tar")
+		}
+	}
 	if len(disk.EncryptKeyId) > 0 {
 		input.EncryptKeyId = &disk.EncryptKeyId
 		input.EncryptedResourceCreateInput, err = dm.SEncryptedResourceManager.ValidateCreateData(ctx, userCred, ownerId, query, input.EncryptedResourceCreateInput)
@@ -338,6 +470,22 @@ func (db *SDiskBackup) CustomizeCreate(ctx context.Context, userCred mcclient.To
 	db.StorageId = disk.StorageId
 	db.DomainId = disk.DomainId
 	db.ProjectId = disk.ProjectId
+	if input.Incremental {
+		parent, err := DiskBackupManager.getIncrementalParent(db.DiskId, db.BackupStorageId)
+		if err != nil {
+			return errors.Wrap(err, "getIncrementalParent")
+		}
+		if parent != nil {
+			db.ChainId = parent.ChainId
+			db.ParentBackupId = parent.Id
+			db.MaxIncrements = parent.MaxIncrements
+		} else {
+			db.ChainId = stringutils.UUID4()
+		}
+		if input.MaxIncrements != nil {
+			db.MaxIncrements = *input.MaxIncrements
+		}
+	}
 	return nil
 }
 
@@ -437,6 +585,47 @@ func (manager *SDiskBackupManager) OrderByExtraFields(ctx context.Context, q *sq
 	return q, nil
 }
 
+// StartChainRetentionTask merges the full backup of the chain into its only
+// child when the chain of self holds more increments than MaxIncrements
+func (self *SDiskBackup) StartChainRetentionTask(ctx context.Context, userCred mcclient.TokenCredential, parentTaskId string) (bool, error) {
+	if len(self.ChainId) == 0 || self.MaxIncrements <= 0 {
+		return false, nil
+	}
+	chain, err := self.GetBackupChain()
+	if err != nil {
+		return false, errors.Wrap(err, "GetBackupChain")
+	}
+	if len(chain)-1 <= self.MaxIncrements {
+		return false, nil
+	}
+	base, into := &chain[0], &chain[1]
+	if base.Status != api.BACKUP_STATUS_READY || into.Status != api.BACKUP_STATUS_READY {
+		log.Infof("skip merging backup %s into %s in status %s/%s", base.Id, into.Id, base.Status, into.Status)
+		return false, nil
+	}
+	if is, _ := InstanceBackupJointManager.IsSubBackup(base.Id); is {
+		return false, nil
+	}
+	children, err := base.getChainChildren()
+	if err != nil {
+		return false, errors.Wrap(err, "getChainChildren")
+	}
+	if len(children) != 1 {
+		log.Infof("skip merging backup %s with %d incremental backups", base.Id, len(children))
+		return false, nil
+	}
+	base.SetStatus(ctx, userCred, api.BACKUP_STATUS_MERGING, "")
+	params := jsonutils.NewDict()
+	params.Set("into_backup_id", jsonutils.NewString(into.Id))
+	params.Set("leaf_backup_id", jsonutils.NewString(self.Id))
+	task, err := taskman.TaskManager.NewTask(ctx, "DiskBackupMergeTask", base, userCred, params, parentTaskId, "", nil)
+	if err != nil {
+		return false, err
+	}
+	task.ScheduleRun(nil)
+	return true, nil
+}
+
 func (self *SDiskBackup) Delete(ctx context.Context, userCred mcclient.TokenCredential) error {
 	return nil
 }
@@ -489,7 +678,7 @@ func (self *SDiskBackup) StartRecoveryTask(ctx context.Context, userCred mcclien
 	return nil
 }
 
-func (manager *SDiskBackupManager) CreateBackup(ctx context.Context, owner mcclient.IIdentityProvider, diskId, backupStorageId, name string) (*SDiskBackup, error) {
+func (manager *SDiskBackupManager) CreateBackup(ctx context.Context, owner mcclient.IIdentityProvider, diskId, backupStorageId, name string, consistent bool) (*SDiskBackup, error) {
 	iDisk, err := DiskManager.FetchById(diskId)
 	if err != nil {
 		return nil, err
@@ -519,6 +708,7 @@ func (manager *SDiskBackupManager) CreateBackup(ctx context.Context, owner mccli
 	}
 	backup.BackupStorageId = backupStorageId
 	backup.Name = name
+	backup.Consistent = consistent
 	backup.Status = api.BACKUP_STATUS_CREATING
 	err = DiskBackupManager.TableSpec().Insert(ctx, backup)
 	if err != nil {
@@ -17,6 +17,7 @@ package models
 import (
 	"sort"
 	"testing"
+	"time"
 
 	"yunion.io/x/jsonutils"
 
@@ -41,3 +42,22 @@ func TestSortDnsResults(t *testing.T) {
 	sort.Sort(sDnsResolveResults(results))
 	t.Logf("results: %s", jsonutils.Marshal(results))
 }
+
+func TestSoaSerial(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	zone := &SDnsZone{}
+	if serial := zone.GetSoaSerial(now); serial != 1700000000 {
+		t.Errorf("serial of unchanged zone %d should follow the clock", serial)
+	}
+	// two updates within the same second
+	zone.SoaSerial = nextSoaSerial(zone.SoaSerial, now)
+	first := zone.GetSoaSerial(now)
+	zone.SoaSerial = nextSoaSerial(zone.SoaSerial, now)
+	second := zone.GetSoaSerial(now)
+	if first <= 1700000000 || second <= first {
+		t.Errorf("serials of updates should increase: %d %d", first, second)
+	}
+	if serial := zone.GetSoaSerial(now.Add(time.Hour)); serial != 1700003600 {
+		t.Errorf("serial %d should follow the clock again", serial)
+	}
+}
@@ -0,0 +1,392 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/tristate"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+const (
+	dnssecKeyTTL = 3600
+
+	dnssecFlagsKsk = 257
+	dnssecFlagsZsk = 256
+
+	tsigSecretLength = 32
+)
+
+func dnssecAlgorithm(name string) (uint8, int, error) {
+	switch name {
+	case api.DNSSEC_ALGORITHM_ECDSAP256SHA256:
+		return dns.ECDSAP256SHA256, 256, nil
+	case api.DNSSEC_ALGORITHM_ECDSAP384SHA384:
+		return dns.ECDSAP384SHA384, 384, nil
+	case api.DNSSEC_ALGORITHM_ED25519:
+		return dns.ED25519, 256, nil
+	}
+	return 0, 0, httperrors.NewInputParameterError("unsupported dnssec algorithm %q, want one of %s", name, api.DNSSEC_ALGORITHMS)
+}
+
+// local zones are served by region-dns, only they can be signed or updated
+func (self *SDnsZone) IsLocal() bool {
+	return len(self.ManagerId) == 0
+}
+
+func (self *SDnsZone) Fqdn() string {
+	return dns.Fqdn(strings.ToLower(self.Name))
+}
+
+func (self *SDnsZone) generateDnssecKey(flags uint16, algorithm string) (string, string, error) {
+	alg, bits, err := dnssecAlgorithm(algorithm)
+	if err != nil {
+		return "", "", err
+	}
+	key := &dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name:   self.Fqdn(),
+			Rrtype: dns.TypeDNSKEY,
+			Class:  dns.ClassINET,
+			Ttl:    dnssecKeyTTL,
+		},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: alg,
+	}
+	priv, err := key.Generate(bits)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Generate")
+	}
+	sec, err := utils.EncryptAESBase64(self.Id, key.PrivateKeyString(priv))
+	if err != nil {
+		return "", "", errors.Wrap(err, "EncryptAESBase64")
+	}
+	return key.String(), sec, nil
+}
+
+func parseDnssecKey(pub, sec, id string) (*dns.DNSKEY, crypto.Signer, error) {
+	rr, err := dns.NewRR(pub)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "NewRR")
+	}
+	key, ok := rr.(*dns.DNSKEY)
+	if !ok {
+		return nil, nil, errors.Wrapf(errors.ErrInvalidFormat, "not a DNSKEY: %s", pub)
+	}
+	privStr, err := utils.DescryptAESBase64(id, sec)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "DescryptAESBase64")
+	}
+	priv, err := key.NewPrivateKey(privStr)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "NewPrivateKey")
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.Wrapf(errors.ErrNotSupported, "private key of algorithm %d", key.Algorithm)
+	}
+	return key, signer, nil
+}
+
+// GetDnssecKeys returns the key signing key and zone signing key
+func (self *SDnsZone) GetDnssecKeys() (*dns.DNSKEY, crypto.Signer, *dns.DNSKEY, crypto.Signer, error) {
+	ksk, kskPriv, err := parseDnssecKey(self.DnssecKsk, self.DnssecKskPrivate, self.Id)
+	if err != nil {
+		return nil, nil, nil, nil, errors.Wrap(err, "ksk")
+	}
+	zsk, zskPriv, err := parseDnssecKey(self.DnssecZsk, self.DnssecZskPrivate, self.Id)
+	if err != nil {
+		return nil, nil, nil, nil, errors.Wrap(err, "zsk")
+	}
+	return ksk, kskPriv, zsk, zskPriv, nil
+}
+
+// 启用DNSSEC签名
+func (self *SDnsZone) PerformEnableDnssec(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.DnsZoneEnableDnssecInput) (jsonutils.JSONObject, error) {
+	if !self.IsLocal() {
+		return nil, httperrors.NewUnsupportOperationError("dnssec is only supported by local dns zone")
+	}
+	if len(input.Algorithm) == 0 {
+		input.Algorithm = self.DnssecAlgorithm
+	}
+	if len(input.Algorithm) == 0 {
+		input.Algorithm = api.DNSSEC_ALGORITHM_ECDSAP256SHA256
+	}
+	if _, _, err := dnssecAlgorithm(input.Algorithm); err != nil {
+		return nil, err
+	}
+	if self.DnssecEnabled.IsTrue() && !input.Rekey && input.Algorithm == self.DnssecAlgorithm {
+		return nil, nil
+	}
+	ksk, kskPriv, err := self.generateDnssecKey(dnssecFlagsKsk, input.Algorithm)
+	if err != nil {
+		return nil, httperrors.NewGeneralError(errors.Wrap(err, "generate ksk"))
+	}
+	zsk, zskPriv, err := self.generateDnssecKey(dnssecFlagsZsk, input.Algorithm)
+	if err != nil {
+		return nil, httperrors.NewGeneralError(errors.Wrap(err, "generate zsk"))
+	}
+	_, err = db.Update(self, func() error {
+		self.DnssecEnabled = tristate.True
+		self.DnssecAlgorithm = input.Algorithm
+		self.DnssecKsk = ksk
+		self.DnssecKskPrivate = kskPriv
+		self.DnssecZsk = zsk
+		self.DnssecZskPrivate = zskPriv
+		return nil
+	})
+	if err != nil {
+		return nil, httperrors.NewGeneralError(errors.Wrap(err, "db.Update"))
+	}
+	notes := map[string]interface{}{"dnssec": "enable", "algorithm": input.Algorithm, "rekey": input.Rekey}
+	db.OpsLog.LogEvent(self, db.ACT_UPDATE, notes, userCred)
+	logclient.AddActionLogWithContext(ctx, self, logclient.ACT_UPDATE, notes, userCred, true)
+	return nil, nil
+}
+
+// 禁用DNSSEC签名
+func (self *SDnsZone) PerformDisableDnssec(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.DnsZoneDisableDnssecInput) (jsonutils.JSONObject, error) {
+	if self.DnssecEnabled.IsFalse() {
+		return nil, nil
+	}
+	_, err := db.Update(self, func() error {
+		self.DnssecEnabled = tristate.False
+		return nil
+	})
+	if err != nil {
+		return nil, httperrors.NewGeneralError(errors.Wrap(err, "db.Update"))
+	}
+	notes := map[string]interface{}{"dnssec": "disable"}
+	db.OpsLog.LogEvent(self, db.ACT_UPDATE, notes, userCred)
+	logclient.AddActionLogWithContext(ctx, self, logclient.ACT_UPDATE, notes, userCred, true)
+	return nil, nil
+}
+
+// 获取DNSSEC公钥及DS记录
+func (self *SDnsZone) GetDetailsDnssec(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (*api.DnsZoneDnssecDetails, error) {
+	if self.DnssecEnabled.IsFalse() || len(self.DnssecKsk) == 0 {
+		return nil, httperrors.NewInvalidStatusError("dnssec of dns zone %s is not enabled", self.Name)
+	}
+	ret := &api.DnsZoneDnssecDetails{
+		Algorithm: self.DnssecAlgorithm,
+	}
+	for _, pub := range []string{self.DnssecKsk, self.DnssecZsk} {
+		rr, err := dns.NewRR(pub)
+		if err != nil {
+			return nil, httperrors.NewGeneralError(errors.Wrapf(err, "NewRR %s", pub))
+		}
+		key, ok := rr.(*dns.DNSKEY)
+		if !ok {
+			return nil, httperrors.NewGeneralError(errors.Wrapf(errors.ErrInvalidFormat, "not a DNSKEY: %s", pub))
+		}
+		ret.Dnskeys = append(ret.Dnskeys, key.String())
+		if key.Flags == dnssecFlagsKsk {
+			ret.Ds = append(ret.Ds, key.ToDS(dns.SHA256).String())
+		}
+	}
+	return ret, nil
+}
+
+func tsigAlgorithm(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, alg := range api.TSIG_ALGORITHMS {
+		if alg == name {
+			return name, nil
+		}
+	}
+	return "", httperrors.NewInputParameterError("unsupported tsig algorithm %q, want one of %s", name, api.TSIG_ALGORITHMS)
+}
+
+func (self *SDnsZone) GetTsigSecret() (string, error) {
+	if len(self.TsigSecret) == 0 {
+		return "", errors.Wrap(errors.ErrEmpty, "tsig secret")
+	}
+	return utils.DescryptAESBase64(self.Id, self.TsigSecret)
+}
+
+func (self *SDnsZone) getTsigKeyDetails() (*api.DnsZoneTsigKeyDetails, error) {
+	secret, err := self.GetTsigSecret()
+	if err != nil {
+		return nil, err
+	}
+	return &api.DnsZoneTsigKeyDetails{
+		TsigKeyName:   self.TsigKeyName,
+		TsigAlgorithm: self.TsigAlgorithm,
+		TsigSecret:    secret,
+	}, nil
+}
+
+// 设置RFC 2136动态更新
+func (self *SDnsZone) PerformSetDynamicUpdate(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.DnsZoneSetDynamicUpdateInput) (*api.DnsZoneTsigKeyDetails, error) {
+	if !self.IsLocal() {
+		return nil, httperrors.NewUnsupportOperationError("dynamic update is only supported by local dns zone")
+	}
+	if !input.Enabled {
+		_, err := db.Update(self, func() error {
+			self.DynamicUpdate = tristate.False
+			return nil
+		})
+		if err != nil {
+			return nil, httperrors.NewGeneralError(errors.Wrap(err, "db.Update"))
+		}
+		notes := map[string]interface{}{"dynamic_update": false}
+		db.OpsLog.LogEvent(self, db.ACT_UPDATE, notes, userCred)
+		logclient.AddActionLogWithContext(ctx, self, logclient.ACT_UPDATE, notes, userCred, true)
+		return nil, nil
+	}
+
+	keyName := input.TsigKeyName
+	if len(keyName) == 0 {
+		keyName = self.TsigKeyName
+	}
+	if len(keyName) == 0 {
+		keyName = self.Fqdn()
+	}
+	keyName = dns.Fqdn(strings.ToLower(keyName))
+	if _, ok := dns.IsDomainName(keyName); !ok {
+		return nil, httperrors.NewInputParameterError("invalid tsig key name %q", input.TsigKeyName)
+	}
+	algorithm := input.TsigAlgorithm
+	if len(algorithm) == 0 {
+		algorithm = self.TsigAlgorithm
+	}
+	if len(algorithm) == 0 {
+		algorithm = api.TSIG_ALGORITHM_HMAC_SHA256
+	}
+	algorithm, err := tsigAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	secret := self.TsigSecret
+	if len(secret) == 0 || input.ResetSecret {
+		raw := make([]byte, tsigSecretLength)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, httperrors.NewGeneralError(errors.Wrap(err, "rand.Read"))
+		}
+		secret, err = utils.EncryptAESBase64(self.Id, base64.StdEncoding.EncodeToString(raw))
+		if err != nil {
+			return nil, httperrors.NewGeneralError(errors.Wrap(err, "EncryptAESBase64"))
+		}
+	}
+	_, err = db.Update(self, func() error {
+		self.DynamicUpdate = tristate.True
+		self.TsigKeyName = keyName
+		self.TsigAlgorithm = algorithm
+		self.TsigSecret = secret
+		return nil
+	})
+	if err != nil {
+		return nil, httperrors.NewGeneralError(errors.Wrap(err, "db.Update"))
+	}
+	notes := map[string]interface{}{
+		"dynamic_update": true,
+		"tsig_key_name":  keyName,
+		"tsig_algorithm": algorithm,
+		"reset_secret":   input.ResetSecret,
+	}
+	db.OpsLog.LogEvent(self, db.ACT_UPDATE, notes, userCred)
+	logclient.AddActionLogWithContext(ctx, self, logclient.ACT_UPDATE, notes, userCred, true)
+	return self.getTsigKeyDetails()
+}
+
+// 获取TSIG密钥
+func (self *SDnsZone) GetDetailsTsigKey(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (*api.DnsZoneTsigKeyDetails, error) {
+	if self.DynamicUpdate.IsFalse() {
+		return nil, httperrors.NewInvalidStatusError("dynamic update of dns zone %s is not enabled", self.Name)
+	}
+	ret, err := self.getTsigKeyDetails()
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	return ret, nil
+}
+
+// FetchLocalZoneOfName returns the closest local zone enclosing name
+func (manager *SDnsZoneManager) FetchLocalZoneOfName(name string) (*SDnsZone, error) {
+	labels := dns.SplitDomainName(strings.ToLower(name))
+	names := make([]string, 0, len(labels))
+	for i := range labels {
+		names = append(names, strings.Join(labels[i:], "."))
+	}
+	q := manager.queryLocalZones().In("name", names)
+	zones := []SDnsZone{}
+	err := db.FetchModelObjects(manager, q, &zones)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	var zone *SDnsZone
+	for i := range zones {
+		if zone == nil || len(zones[i].Name) > len(zone.Name) {
+			zone = &zones[i]
+		}
+	}
+	if zone == nil {
+		return nil, errors.Wrapf(errors.ErrNotFound, "local dns zone of %s", name)
+	}
+	zone.SetModelManager(manager, zone)
+	return zone, nil
+}
+
+func (manager *SDnsZoneManager) queryLocalZones() *sqlchemy.SQuery {
+	return manager.Query().IsNullOrEmpty("manager_id").IsTrue("enabled")
+}
+
+// FetchDnssecZones returns local zones with dnssec signing enabled
+func (manager *SDnsZoneManager) FetchDnssecZones() ([]SDnsZone, error) {
+	q := manager.queryLocalZones().IsTrue("dnssec_enabled")
+	ret := []SDnsZone{}
+	err := db.FetchModelObjects(manager, q, &ret)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	return ret, nil
+}
+
+// FetchLocalZoneByName returns the local zone named exactly as name
+func (manager *SDnsZoneManager) FetchLocalZoneByName(name string) (*SDnsZone, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	q := manager.queryLocalZones().Equals("name", name)
+	zones := []SDnsZone{}
+	err := db.FetchModelObjects(manager, q, &zones)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	if len(zones) == 0 {
+		return nil, errors.Wrapf(errors.ErrNotFound, "local dns zone %s", name)
+	}
+	if len(zones) > 1 {
+		return nil, errors.Wrapf(errors.ErrDuplicateId, "local dns zone %s", name)
+	}
+	zone := &zones[0]
+	zone.SetModelManager(manager, zone)
+	return zone, nil
+}
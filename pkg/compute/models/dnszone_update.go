@@ -0,0 +1,288 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"yunion.io/x/cloudmux/pkg/cloudprovider"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/tristate"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+// SDnsZoneUpdate is a dynamic update of a local zone done in one database
+// transaction.  The row of the zone is locked as the transaction begins, so
+// that updates are serialized across all the processes serving the zone.
+// Records are read and written in the transaction, the update takes effect
+// as a whole on commit or not at all.  Records are logged after commit
+type SDnsZoneUpdate struct {
+	zone     *SDnsZone
+	ctx      context.Context
+	userCred mcclient.TokenCredential
+	tx       *sql.Tx
+
+	// soa serial of the zone when the update begins
+	serial int64
+
+	created []*SDnsRecord
+	updated []*SDnsRecord
+	deleted []*SDnsRecord
+}
+
+// BeginUpdate starts a dynamic update of the zone, the caller must either
+// Commit or Rollback it
+func (self *SDnsZone) BeginUpdate(ctx context.Context, userCred mcclient.TokenCredential) (*SDnsZoneUpdate, error) {
+	if !self.IsLocal() {
+		return nil, httperrors.NewUnsupportOperationError("dns zone %s is not local", self.Name)
+	}
+	tx, err := sqlchemy.GetDB().BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "BeginTx")
+	}
+	u := &SDnsZoneUpdate{
+		zone:     self,
+		ctx:      ctx,
+		userCred: userCred,
+		tx:       tx,
+	}
+	sqlStr := fmt.Sprintf("select soa_serial from %s where id = ? for update", DnsZoneManager.TableSpec().Name())
+	if err := tx.QueryRowContext(ctx, sqlStr, self.Id).Scan(&u.serial); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrapf(err, "lock dns zone %s", self.Name)
+	}
+	return u, nil
+}
+
+// GetDnsRecordsByName returns records of a name relative to the zone, @
+// stands for the apex.  Records written earlier in the update are seen
+func (u *SDnsZoneUpdate) GetDnsRecordsByName(name string) ([]SDnsRecord, error) {
+	q := DnsRecordManager.Query().Equals("dns_zone_id", u.zone.Id).Equals("name", strings.ToLower(name))
+	rows, err := u.tx.QueryContext(u.ctx, q.String(), q.Variables()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "QueryContext")
+	}
+	defer rows.Close()
+	ret := []SDnsRecord{}
+	for rows.Next() {
+		rec := SDnsRecord{}
+		if err := q.Row2Struct(rows, &rec); err != nil {
+			return nil, errors.Wrap(err, "Row2Struct")
+		}
+		ret = append(ret, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows")
+	}
+	for i := range ret {
+		ret[i].SetModelManager(DnsRecordManager, &ret[i])
+	}
+	return ret, nil
+}
+
+func (u *SDnsZoneUpdate) updateRecord(rec *SDnsRecord, doUpdate func()) error {
+	session, err := DnsRecordManager.TableSpec().GetTableSpec().PrepareUpdate(rec)
+	if err != nil {
+		return errors.Wrap(err, "PrepareUpdate")
+	}
+	doUpdate()
+	result, err := session.SaveUpdateSql(rec)
+	if err != nil {
+		return errors.Wrap(err, "SaveUpdateSql")
+	}
+	if _, err := u.tx.ExecContext(u.ctx, result.Sql, result.Vars...); err != nil {
+		return errors.Wrapf(err, "update record %s", rec.Id)
+	}
+	return nil
+}
+
+func (u *SDnsZoneUpdate) insertRecord(rec *SDnsRecord) error {
+	result, err := DnsRecordManager.TableSpec().GetTableSpec().InsertSqlPrep(rec, false)
+	if err != nil {
+		return errors.Wrap(err, "InsertSqlPrep")
+	}
+	if _, err := u.tx.ExecContext(u.ctx, result.Sql, result.Values...); err != nil {
+		return errors.Wrapf(err, "insert record %s %s", rec.Name, rec.DnsType)
+	}
+	u.created = append(u.created, rec)
+	return nil
+}
+
+func (u *SDnsZoneUpdate) deleteRecord(rec *SDnsRecord) error {
+	err := u.updateRecord(rec, func() {
+		rec.MarkDelete()
+	})
+	if err != nil {
+		return err
+	}
+	u.deleted = append(u.deleted, rec)
+	return nil
+}
+
+// AddDnsRecord adds a record as RFC 2136 section 3.4.2.2 says: a record of
+// the same type and value replaces the existing one, a CNAME is ignored if
+// the name has records of other types and replaces the CNAME of the name
+// otherwise, records of other types are ignored if the name has a CNAME.
+// Whether the zone is changed is returned
+func (u *SDnsZoneUpdate) AddDnsRecord(input api.DnsRecordCreateInput) (bool, error) {
+	input.Name = strings.ToLower(input.Name)
+	record := api.SDnsRecord{}
+	record.DnsZoneId = u.zone.Id
+	record.DnsType = input.DnsType
+	record.DnsValue = input.DnsValue
+	record.TTL = input.TTL
+	record.MxPriority = input.MxPriority
+	err := record.ValidateDnsrecordValue()
+	if err != nil {
+		return false, err
+	}
+
+	records, err := u.GetDnsRecordsByName(input.Name)
+	if err != nil {
+		return false, errors.Wrap(err, "GetDnsRecordsByName")
+	}
+	isCname := input.DnsType == string(cloudprovider.DnsTypeCNAME)
+	for i := range records {
+		if records[i].IsCNAME() != isCname {
+			log.Infof("dns zone %s: ignore %s %s %s conflicting with %s record", u.zone.Name, input.Name, input.DnsType, input.DnsValue, records[i].DnsType)
+			return false, nil
+		}
+	}
+	for i := range records {
+		rec := &records[i]
+		if rec.DnsType == input.DnsType && rec.DnsValue == input.DnsValue {
+			if rec.TTL == input.TTL && rec.MxPriority == input.MxPriority {
+				return false, nil
+			}
+			err := u.updateRecord(rec, func() {
+				rec.TTL = input.TTL
+				rec.MxPriority = input.MxPriority
+			})
+			if err != nil {
+				return false, err
+			}
+			u.updated = append(u.updated, rec)
+			return true, nil
+		}
+		if isCname {
+			// the only record of the name is a CNAME of another target
+			if err := u.deleteRecord(rec); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	rec := &SDnsRecord{}
+	rec.SetModelManager(DnsRecordManager, rec)
+	rec.DnsZoneId = u.zone.Id
+	rec.Name = input.Name
+	rec.DnsType = input.DnsType
+	rec.DnsValue = input.DnsValue
+	rec.TTL = input.TTL
+	rec.MxPriority = input.MxPriority
+	rec.Enabled = tristate.True
+	rec.Status = api.DNS_RECORDSET_STATUS_AVAILABLE
+	if err := u.insertRecord(rec); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveDnsRecords deletes records of name, empty dnsType or dnsValue
+// matches all
+func (u *SDnsZoneUpdate) RemoveDnsRecords(name, dnsType, dnsValue string) (int, error) {
+	records, err := u.GetDnsRecordsByName(name)
+	if err != nil {
+		return 0, errors.Wrap(err, "GetDnsRecordsByName")
+	}
+	cnt := 0
+	for i := range records {
+		rec := &records[i]
+		if len(dnsType) > 0 && rec.DnsType != dnsType {
+			continue
+		}
+		if len(dnsValue) > 0 && rec.DnsValue != dnsValue {
+			continue
+		}
+		if err := u.deleteRecord(rec); err != nil {
+			return cnt, err
+		}
+		cnt++
+	}
+	return cnt, nil
+}
+
+// nextSoaSerial returns the serial of a zone just changed.  It's ahead of
+// both the stored serial and the clock, so it's never served before
+func nextSoaSerial(serial int64, now time.Time) int64 {
+	if ts := now.Unix(); ts > serial {
+		serial = ts
+	}
+	return serial + 1
+}
+
+// GetSoaSerial returns the soa serial of the zone.  It follows the clock
+// unless the zone has been changed by dynamic updates more than once a
+// second
+func (self *SDnsZone) GetSoaSerial(now time.Time) uint32 {
+	if ts := now.Unix(); ts > self.SoaSerial {
+		return uint32(ts)
+	}
+	return uint32(self.SoaSerial)
+}
+
+// Commit bumps the soa serial of the zone if any record is changed, and
+// commits the update
+func (u *SDnsZoneUpdate) Commit() error {
+	if len(u.created)+len(u.updated)+len(u.deleted) > 0 {
+		sqlStr := fmt.Sprintf("update %s set soa_serial = ? where id = ?", DnsZoneManager.TableSpec().Name())
+		if _, err := u.tx.ExecContext(u.ctx, sqlStr, nextSoaSerial(u.serial, time.Now()), u.zone.Id); err != nil {
+			return errors.Wrap(err, "update soa serial")
+		}
+	}
+	if err := u.tx.Commit(); err != nil {
+		return errors.Wrap(err, "Commit")
+	}
+	for _, rec := range u.created {
+		db.OpsLog.LogEvent(rec, db.ACT_CREATE, rec.GetShortDesc(u.ctx), u.userCred)
+	}
+	for _, rec := range u.updated {
+		db.OpsLog.LogEvent(rec, db.ACT_UPDATE, rec.GetShortDesc(u.ctx), u.userCred)
+	}
+	for _, rec := range u.deleted {
+		db.OpsLog.LogEvent(rec, db.ACT_DELETE, rec.GetShortDesc(u.ctx), u.userCred)
+		if err := db.Metadata.RemoveAll(u.ctx, rec, u.userCred); err != nil {
+			log.Errorf("remove metadata of dns record %s: %v", rec.Id, err)
+		}
+	}
+	return nil
+}
+
+// Rollback discards the update, it's a no-op after Commit
+func (u *SDnsZoneUpdate) Rollback() {
+	if err := u.tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		log.Errorf("rollback update of dns zone %s: %v", u.zone.Name, err)
+	}
+}
@@ -72,6 +72,27 @@ type SDnsZone struct {
 
 	ZoneType    string `width:"32" charset:"ascii" nullable:"false" list:"domain" create:"domain_required"`
 	ProductType string `width:"32" charset:"ascii" nullable:"false" list:"domain" create:"domain_optional"`
+
+	// 是否启用DNSSEC签名, 仅本地域名
+	DnssecEnabled tristate.TriState `default:"false" list:"user"`
+	// DNSSEC签名算法
+	DnssecAlgorithm string `width:"32" charset:"ascii" nullable:"true" list:"user"`
+	// KSK及ZSK公钥, DNSKEY记录格式
+	DnssecKsk string `width:"512" charset:"ascii" nullable:"true" list:"domain"`
+	DnssecZsk string `width:"512" charset:"ascii" nullable:"true" list:"domain"`
+	// KSK及ZSK私钥, 加密存储
+	DnssecKskPrivate string `width:"512" charset:"ascii" nullable:"true"`
+	DnssecZskPrivate string `width:"512" charset:"ascii" nullable:"true"`
+
+	// 是否允许RFC 2136动态更新, 仅本地域名
+	DynamicUpdate tristate.TriState `default:"false" list:"user"`
+	// TSIG密钥名称及算法
+	TsigKeyName   string `width:"128" charset:"ascii" nullable:"true" list:"domain"`
+	TsigAlgorithm string `width:"32" charset:"ascii" nullable:"true" list:"domain"`
+	// TSIG密钥, 加密存储
+	TsigSecret string `width:"256" charset:"ascii" nullable:"true"`
+	// 动态更新写入的SOA序列号, 序列号随时间递增, 同一秒内的多次更新可超前于当前时间
+	SoaSerial int64 `nullable:"false" default:"0" list:"user"`
 }
 
 func (self *SDnsZone) GetUniqValues() jsonutils.JSONObject {
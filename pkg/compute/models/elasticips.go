@@ -113,6 +113,9 @@ type SElasticip struct {
 	// 是否跟随主机删除而自动释放
 	AutoDellocate tristate.TriState `default:"false" get:"user" create:"optional" update:"user"`
 
+	// 关联的QoS策略
+	QosPolicyId string `width:"36" charset:"ascii" nullable:"true" index:"true" list:"user"`
+
 	// 区域Id
 	// CloudregionId string `width:"36" charset:"ascii" nullable:"false" list:"user" create:"required"`
 }
@@ -1838,6 +1841,38 @@ func (self *SElasticip) PerformChangeBandwidth(ctx context.Context, userCred mcc
 	return nil, nil
 }
 
+// 设置弹性公网IP的QoS策略, 仅适用于vpcagent管理的VPC
+func (self *SElasticip) PerformSetQosPolicy(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.ElasticipSetQosPolicyInput) (jsonutils.JSONObject, error) {
+	if self.IsManaged() {
+		return nil, errors.Wrap(httperrors.ErrNotSupported, "qos policy of managed eip")
+	}
+	policyId, err := QosPolicyManager.fetchQosPolicyId(ctx, userCred, input.QosPolicyId)
+	if err != nil {
+		return nil, err
+	}
+	if len(policyId) > 0 {
+		obj, err := QosPolicyManager.FetchById(policyId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetch qos policy %s", policyId)
+		}
+		if obj.(*SQosPolicy).hasPps() {
+			return nil, httperrors.NewNotSupportedError("pps of qos policy %s is not enforced on elasticip", obj.GetName())
+		}
+	}
+	if self.QosPolicyId == policyId {
+		return nil, nil
+	}
+	diff, err := db.Update(self, func() error {
+		self.QosPolicyId = policyId
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.OpsLog.LogEvent(self, db.ACT_UPDATE, diff, userCred)
+	return nil, nil
+}
+
 func (self *SElasticip) StartEipChangeBandwidthTask(ctx context.Context, userCred mcclient.TokenCredential, bandwidth int64) error {
 
 	self.SetStatus(ctx, userCred, api.EIP_STATUS_CHANGE_BANDWIDTH, "change bandwidth")
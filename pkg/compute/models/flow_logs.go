@@ -0,0 +1,393 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/stringutils2"
+)
+
+// +onecloud:swagger-gen-model-singular=flow_log
+// +onecloud:swagger-gen-model-plural=flow_logs
+type SFlowLogManager struct {
+	db.SEnabledStatusInfrasResourceBaseManager
+}
+
+var FlowLogManager *SFlowLogManager
+
+func init() {
+	FlowLogManager = &SFlowLogManager{
+		SEnabledStatusInfrasResourceBaseManager: db.NewEnabledStatusInfrasResourceBaseManager(
+			SFlowLog{},
+			"flow_logs_tbl",
+			"flow_log",
+			"flow_logs",
+		),
+	}
+	FlowLogManager.SetVirtualObject(FlowLogManager)
+}
+
+// +onecloud:model-api-gen
+type SFlowLog struct {
+	db.SEnabledStatusInfrasResourceBase
+
+	// 作用范围, vpc, network或vnic
+	ResourceType string `width:"16" charset:"ascii" nullable:"false" list:"domain" create:"domain_required"`
+
+	// 所属VPC
+	VpcId string `width:"36" charset:"ascii" nullable:"false" index:"true" list:"domain" create:"domain_optional"`
+	// 作用的IP子网, resource_type为network或vnic时有效
+	NetworkId string `width:"36" charset:"ascii" nullable:"true" list:"domain" create:"domain_optional"`
+	// 作用的虚拟机, resource_type为vnic时有效
+	GuestId string `width:"36" charset:"ascii" nullable:"true" list:"domain" create:"domain_optional"`
+	// 作用的虚拟机网卡MAC地址
+	MacAddr string `width:"32" charset:"ascii" nullable:"true" list:"domain" create:"domain_optional"`
+
+	// 记录的流量类型, all, accept或reject
+	TrafficType string `width:"16" charset:"ascii" nullable:"false" default:"all" list:"domain" update:"domain" create:"domain_optional"`
+	// 每秒最多记录的报文数
+	RateLimit int `nullable:"false" default:"100" list:"domain" update:"domain" create:"domain_optional"`
+
+	// 日志投递目标, logger或bucket
+	Destination string `width:"16" charset:"ascii" nullable:"false" default:"logger" list:"domain" update:"domain" create:"domain_optional"`
+	// 投递的存储桶
+	BucketId string `width:"36" charset:"ascii" nullable:"true" list:"domain" update:"domain" create:"domain_optional"`
+	// 存储桶对象前缀
+	BucketPrefix string `width:"128" charset:"utf8" nullable:"true" list:"domain" update:"domain" create:"domain_optional"`
+}
+
+func (manager *SFlowLogManager) ListItemFilter(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.FlowLogListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusInfrasResourceBaseManager.ListItemFilter(ctx, q, userCred, query.EnabledStatusInfrasResourceBaseListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SEnabledStatusInfrasResourceBaseManager.ListItemFilter")
+	}
+	if len(query.ResourceType) > 0 {
+		q = q.In("resource_type", query.ResourceType)
+	}
+	if len(query.Destination) > 0 {
+		q = q.In("destination", query.Destination)
+	}
+	if len(query.VpcId) > 0 {
+		vpcObj, err := VpcManager.FetchByIdOrName(ctx, userCred, query.VpcId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return nil, httperrors.NewResourceNotFoundError2(VpcManager.Keyword(), query.VpcId)
+			}
+			return nil, errors.Wrap(err, "VpcManager.FetchByIdOrName")
+		}
+		q = q.Equals("vpc_id", vpcObj.GetId())
+	}
+	if len(query.NetworkId) > 0 {
+		netObj, err := NetworkManager.FetchByIdOrName(ctx, userCred, query.NetworkId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return nil, httperrors.NewResourceNotFoundError2(NetworkManager.Keyword(), query.NetworkId)
+			}
+			return nil, errors.Wrap(err, "NetworkManager.FetchByIdOrName")
+		}
+		q = q.Equals("network_id", netObj.GetId())
+	}
+	if len(query.GuestId) > 0 {
+		guestObj, err := GuestManager.FetchByIdOrName(ctx, userCred, query.GuestId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return nil, httperrors.NewResourceNotFoundError2(GuestManager.Keyword(), query.GuestId)
+			}
+			return nil, errors.Wrap(err, "GuestManager.FetchByIdOrName")
+		}
+		q = q.Equals("guest_id", guestObj.GetId())
+	}
+	return q, nil
+}
+
+func (manager *SFlowLogManager) OrderByExtraFields(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.FlowLogListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusInfrasResourceBaseManager.OrderByExtraFields(ctx, q, userCred, query.EnabledStatusInfrasResourceBaseListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SEnabledStatusInfrasResourceBaseManager.OrderByExtraFields")
+	}
+	return q, nil
+}
+
+func (manager *SFlowLogManager) QueryDistinctExtraField(q *sqlchemy.SQuery, field string) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusInfrasResourceBaseManager.QueryDistinctExtraField(q, field)
+	if err == nil {
+		return q, nil
+	}
+	return q, httperrors.ErrNotFound
+}
+
+func (manager *SFlowLogManager) FetchCustomizeColumns(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	objs []interface{},
+	fields stringutils2.SSortedStrings,
+	isList bool,
+) []api.FlowLogDetails {
+	rows := make([]api.FlowLogDetails, len(objs))
+	stdRows := manager.SEnabledStatusInfrasResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+	vpcIds := make([]string, len(objs))
+	netIds := make([]string, len(objs))
+	guestIds := make([]string, len(objs))
+	bucketIds := make([]string, len(objs))
+	for i := range rows {
+		rows[i] = api.FlowLogDetails{
+			EnabledStatusInfrasResourceBaseDetails: stdRows[i],
+		}
+		fl := objs[i].(*SFlowLog)
+		vpcIds[i] = fl.VpcId
+		netIds[i] = fl.NetworkId
+		guestIds[i] = fl.GuestId
+		bucketIds[i] = fl.BucketId
+	}
+	for _, m := range []struct {
+		manager db.IStandaloneModelManager
+		ids     []string
+		set     func(row *api.FlowLogDetails, name string)
+	}{
+		{VpcManager, vpcIds, func(row *api.FlowLogDetails, name string) { row.Vpc = name }},
+		{NetworkManager, netIds, func(row *api.FlowLogDetails, name string) { row.Network = name }},
+		{GuestManager, guestIds, func(row *api.FlowLogDetails, name string) { row.Guest = name }},
+		{BucketManager, bucketIds, func(row *api.FlowLogDetails, name string) { row.Bucket = name }},
+	} {
+		idMap, err := db.FetchIdNameMap2(m.manager, m.ids)
+		if err != nil {
+			log.Errorf("FetchIdNameMap2 %s fail: %s", m.manager.Keyword(), err)
+			continue
+		}
+		for i := range rows {
+			if name, ok := idMap[m.ids[i]]; ok {
+				m.set(&rows[i], name)
+			}
+		}
+	}
+	return rows
+}
+
+// ovn based flow logging is only available to vpcs managed by vpcagent
+func (manager *SFlowLogManager) validateVpc(vpc *SVpc) error {
+	if !vpc.isOvnBacked() {
+		return errors.Wrapf(httperrors.ErrNotSupported, "vpc %s is not ovn backed", vpc.Name)
+	}
+	return nil
+}
+
+func (manager *SFlowLogManager) ValidateCreateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	ownerId mcclient.IIdentityProvider,
+	query jsonutils.JSONObject,
+	input api.FlowLogCreateInput,
+) (api.FlowLogCreateInput, error) {
+	var err error
+	input.EnabledStatusInfrasResourceBaseCreateInput, err = manager.SEnabledStatusInfrasResourceBaseManager.ValidateCreateData(ctx, userCred, ownerId, query, input.EnabledStatusInfrasResourceBaseCreateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SEnabledStatusInfrasResourceBaseManager.ValidateCreateData")
+	}
+	var vpc *SVpc
+	switch input.ResourceType {
+	case api.FlowLogResourceVpc:
+		vpcObj, err := VpcManager.FetchByIdOrName(ctx, userCred, input.VpcId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return input, httperrors.NewResourceNotFoundError2(VpcManager.Keyword(), input.VpcId)
+			}
+			return input, errors.Wrap(err, "VpcManager.FetchByIdOrName")
+		}
+		vpc = vpcObj.(*SVpc)
+		input.NetworkId = ""
+		input.GuestId = ""
+		input.MacAddr = ""
+	case api.FlowLogResourceNetwork:
+		netObj, err := NetworkManager.FetchByIdOrName(ctx, userCred, input.NetworkId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return input, httperrors.NewResourceNotFoundError2(NetworkManager.Keyword(), input.NetworkId)
+			}
+			return input, errors.Wrap(err, "NetworkManager.FetchByIdOrName")
+		}
+		network := netObj.(*SNetwork)
+		vpc, err = network.GetVpc()
+		if err != nil {
+			return input, errors.Wrapf(err, "GetVpc of network %s", network.Name)
+		}
+		input.NetworkId = network.Id
+		input.GuestId = ""
+		input.MacAddr = ""
+	case api.FlowLogResourceGuestNic:
+		guestObj, err := GuestManager.FetchByIdOrName(ctx, userCred, input.GuestId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return input, httperrors.NewResourceNotFoundError2(GuestManager.Keyword(), input.GuestId)
+			}
+			return input, errors.Wrap(err, "GuestManager.FetchByIdOrName")
+		}
+		guest := guestObj.(*SGuest)
+		if guest.Hypervisor != api.HYPERVISOR_KVM {
+			return input, errors.Wrapf(httperrors.ErrNotSupported, "hypervisor %s not supported", guest.Hypervisor)
+		}
+		gns, err := GuestnetworkManager.FetchByGuestId(guest.Id)
+		if err != nil {
+			return input, errors.Wrap(err, "GuestnetworkManager.FetchByGuestId")
+		}
+		var gn *SGuestnetwork
+		if len(input.IpAddr) == 0 && len(input.MacAddr) == 0 {
+			if len(gns) != 1 {
+				return input, errors.Wrap(httperrors.ErrInputParameter, "either ip_addr or mac_addr should be specified")
+			}
+			gn = &gns[0]
+		} else {
+			for i := range gns {
+				if (len(input.IpAddr) > 0 && input.IpAddr == gns[i].IpAddr) || (len(input.MacAddr) > 0 && input.MacAddr == gns[i].MacAddr) {
+					gn = &gns[i]
+					break
+				}
+			}
+			if gn == nil {
+				return input, errors.Wrap(httperrors.ErrNotFound, "guest network not found")
+			}
+		}
+		network, err := gn.GetNetwork()
+		if err != nil {
+			return input, errors.Wrapf(err, "GetNetwork of guest nic %s", gn.MacAddr)
+		}
+		vpc, err = network.GetVpc()
+		if err != nil {
+			return input, errors.Wrapf(err, "GetVpc of network %s", network.Name)
+		}
+		input.GuestId = guest.Id
+		input.NetworkId = gn.NetworkId
+		input.MacAddr = gn.MacAddr
+	default:
+		return input, errors.Wrapf(httperrors.ErrInputParameter, "invalid resource type %s", input.ResourceType)
+	}
+	if err := manager.validateVpc(vpc); err != nil {
+		return input, err
+	}
+	input.VpcId = vpc.Id
+
+	if len(input.TrafficType) == 0 {
+		input.TrafficType = api.FlowLogTrafficAll
+	}
+	if input.RateLimit == 0 {
+		input.RateLimit = api.FlowLogDefaultRateLimit
+	}
+	if len(input.Destination) == 0 {
+		input.Destination = api.FlowLogDestinationLogger
+	}
+	input.BucketId, err = manager.validateSettings(ctx, userCred, input.TrafficType, input.RateLimit, input.Destination, input.BucketId)
+	if err != nil {
+		return input, err
+	}
+	input.Status = api.FLOW_LOG_STATUS_AVAILABLE
+	if input.Enabled == nil {
+		trueVal := true
+		input.Enabled = &trueVal
+	}
+	return input, nil
+}
+
+func (manager *SFlowLogManager) validateSettings(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	trafficType string,
+	rateLimit int,
+	destination string,
+	bucketId string,
+) (string, error) {
+	if !utils.IsInStringArray(trafficType, api.FlowLogTrafficTypes) {
+		return "", errors.Wrapf(httperrors.ErrInputParameter, "invalid traffic type %s", trafficType)
+	}
+	if rateLimit <= 0 || rateLimit > api.FlowLogMaxRateLimit {
+		return "", errors.Wrapf(httperrors.ErrOutOfRange, "rate limit should be within [1, %d]", api.FlowLogMaxRateLimit)
+	}
+	switch destination {
+	case api.FlowLogDestinationLogger:
+		return "", nil
+	case api.FlowLogDestinationBucket:
+		if len(bucketId) == 0 {
+			return "", httperrors.NewMissingParameterError("bucket_id")
+		}
+		bucketObj, err := BucketManager.FetchByIdOrName(ctx, userCred, bucketId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return "", httperrors.NewResourceNotFoundError2(BucketManager.Keyword(), bucketId)
+			}
+			return "", errors.Wrap(err, "BucketManager.FetchByIdOrName")
+		}
+		return bucketObj.GetId(), nil
+	default:
+		return "", errors.Wrapf(httperrors.ErrInputParameter, "invalid destination %s", destination)
+	}
+}
+
+func (fl *SFlowLog) ValidateUpdateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.FlowLogUpdateInput,
+) (api.FlowLogUpdateInput, error) {
+	var err error
+	input.EnabledStatusInfrasResourceBaseUpdateInput, err = fl.SEnabledStatusInfrasResourceBase.ValidateUpdateData(ctx, userCred, query, input.EnabledStatusInfrasResourceBaseUpdateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SEnabledStatusInfrasResourceBase.ValidateUpdateData")
+	}
+	trafficType := fl.TrafficType
+	if len(input.TrafficType) > 0 {
+		trafficType = input.TrafficType
+	}
+	rateLimit := fl.RateLimit
+	if input.RateLimit != nil {
+		rateLimit = *input.RateLimit
+	}
+	destination := fl.Destination
+	if len(input.Destination) > 0 {
+		destination = input.Destination
+	}
+	bucketId := fl.BucketId
+	if len(input.BucketId) > 0 {
+		bucketId = input.BucketId
+	}
+	bucketId, err = FlowLogManager.validateSettings(ctx, userCred, trafficType, rateLimit, destination, bucketId)
+	if err != nil {
+		return input, err
+	}
+	if bucketId != fl.BucketId {
+		input.BucketId = bucketId
+	}
+	return input, nil
+}
@@ -27,6 +27,7 @@ import (
 	"yunion.io/x/pkg/util/netutils"
 	"yunion.io/x/pkg/util/rbacscope"
 	"yunion.io/x/pkg/util/sets"
+	"yunion.io/x/pkg/utils"
 	"yunion.io/x/sqlchemy"
 
 	"yunion.io/x/onecloud/pkg/apis"
@@ -91,10 +92,93 @@ type SGroup struct {
 	// the upper limit number of guests with this group in a host
 	Granularity     int               `nullable:"false" list:"user" get:"user" create:"optional" update:"user" default:"1"`
 	ForceDispersion tristate.TriState `list:"user" get:"user" create:"optional" update:"user" default:"true"`
+
+	// 亲和策略, anti-affinity 或 affinity
+	// force_dispersion 为 true 时为硬性规则, 否则为软性规则
+	Affinity string `width:"16" charset:"ascii" nullable:"false" default:"anti-affinity" list:"user" get:"user" create:"optional" update:"user"`
+	// 拓扑域, host、zone、wire 或者宿主机的 metadata key(例如 rack)
+	TopologyKey string `width:"64" charset:"utf8" nullable:"false" default:"host" list:"user" get:"user" create:"optional" update:"user"`
+	// 软性规则及拓扑分散的权重
+	Weight int `nullable:"false" default:"10" list:"user" get:"user" create:"optional" update:"user"`
+	// 拓扑分散允许的最大偏差, 0 表示不启用
+	MaxSkew int `nullable:"false" default:"0" list:"user" get:"user" create:"optional" update:"user"`
 	// 是否启用
 	// Enabled tristate.TriState `default:"true" create:"optional" list:"user" update:"user"`
 }
 
+func validateGroupTopology(affinity, topologyKey string, weight, maxSkew int) error {
+	if !utils.IsInStringArray(affinity, api.INSTANCE_GROUP_AFFINITIES) {
+		return httperrors.NewInputParameterError("invalid affinity %q, must be one of %s", affinity, api.INSTANCE_GROUP_AFFINITIES)
+	}
+	if len(topologyKey) == 0 {
+		return httperrors.NewMissingParameterError("topology_key")
+	}
+	if weight < 1 || weight > api.INSTANCE_GROUP_WEIGHT_MAX {
+		return httperrors.NewOutOfRangeError("weight must in 1~%d", api.INSTANCE_GROUP_WEIGHT_MAX)
+	}
+	if maxSkew < 0 {
+		return httperrors.NewOutOfRangeError("max_skew must not be negative")
+	}
+	return nil
+}
+
+func (sm *SGroupManager) ValidateCreateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	ownerId mcclient.IIdentityProvider,
+	query jsonutils.JSONObject,
+	input api.InstanceGroupCreateInput,
+) (api.InstanceGroupCreateInput, error) {
+	if len(input.Affinity) == 0 {
+		input.Affinity = api.INSTANCE_GROUP_ANTI_AFFINITY
+	}
+	if len(input.TopologyKey) == 0 {
+		input.TopologyKey = api.INSTANCE_GROUP_TOPOLOGY_HOST
+	}
+	if input.Weight == 0 {
+		input.Weight = api.INSTANCE_GROUP_WEIGHT_DEFAULT
+	}
+	if err := validateGroupTopology(input.Affinity, input.TopologyKey, input.Weight, input.MaxSkew); err != nil {
+		return input, err
+	}
+	var err error
+	input.VirtualResourceCreateInput, err = sm.SVirtualResourceBaseManager.ValidateCreateData(ctx, userCred, ownerId, query, input.VirtualResourceCreateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SVirtualResourceBaseManager.ValidateCreateData")
+	}
+	return input, nil
+}
+
+func (group *SGroup) ValidateUpdateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.InstanceGroupUpdateInput,
+) (api.InstanceGroupUpdateInput, error) {
+	affinity, topologyKey, weight, maxSkew := group.Affinity, group.TopologyKey, group.Weight, group.MaxSkew
+	if input.Affinity != nil {
+		affinity = *input.Affinity
+	}
+	if input.TopologyKey != nil {
+		topologyKey = *input.TopologyKey
+	}
+	if input.Weight != nil {
+		weight = *input.Weight
+	}
+	if input.MaxSkew != nil {
+		maxSkew = *input.MaxSkew
+	}
+	if err := validateGroupTopology(affinity, topologyKey, weight, maxSkew); err != nil {
+		return input, err
+	}
+	var err error
+	input.VirtualResourceBaseUpdateInput, err = group.SVirtualResourceBase.ValidateUpdateData(ctx, userCred, query, input.VirtualResourceBaseUpdateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SVirtualResourceBase.ValidateUpdateData")
+	}
+	return input, nil
+}
+
 // 主机组列表
 func (sm *SGroupManager) ListItemFilter(
 	ctx context.Context,
@@ -228,6 +312,13 @@ func (sm *SGroupManager) FetchCustomizeColumns(
 	return rows
 }
 
+// IsHostAntiAffinity return true if the group is the traditional anti-affinity
+// group on host dimension, which is limited by Granularity
+func (group *SGroup) IsHostAntiAffinity() bool {
+	return (len(group.Affinity) == 0 || group.Affinity == api.INSTANCE_GROUP_ANTI_AFFINITY) &&
+		(len(group.TopologyKey) == 0 || group.TopologyKey == api.INSTANCE_GROUP_TOPOLOGY_HOST)
+}
+
 func (group *SGroup) GetGuestCount() int {
 	q := GroupguestManager.Query().Equals("group_id", group.Id)
 	count, _ := q.CountWithError()
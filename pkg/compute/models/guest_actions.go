@@ -3137,6 +3137,42 @@ func (guest *SGuest) PerformChangeBandwidth(
 	return nil, nil
 }
 
+// 设置网卡QoS策略
+func (guest *SGuest) PerformSetNicQosPolicy(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.ServerSetNicQosPolicyInput,
+) (jsonutils.JSONObject, error) {
+	if !utils.IsInStringArray(guest.Status, []string{api.VM_READY, api.VM_RUNNING}) {
+		return nil, httperrors.NewBadRequestError("Cannot set nic qos policy in status %s", guest.Status)
+	}
+	guestnic, err := guest.findGuestnetworkByInfo(input.ServerNetworkInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "findGuestnetworkByInfo")
+	}
+	policyId, err := QosPolicyManager.fetchQosPolicyId(ctx, userCred, input.QosPolicyId)
+	if err != nil {
+		return nil, err
+	}
+	if guestnic.QosPolicyId == policyId {
+		return nil, nil
+	}
+	diff, err := db.Update(guestnic, func() error {
+		guestnic.QosPolicyId = policyId
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.OpsLog.LogEvent(guest, db.ACT_UPDATE, diff, userCred)
+	logclient.AddActionLogWithContext(ctx, guest, logclient.ACT_UPDATE, diff, userCred, true)
+	if guest.Status == api.VM_READY {
+		return nil, nil
+	}
+	return nil, guest.StartSyncTask(ctx, userCred, false, "")
+}
+
 // 修改源地址检查
 func (self *SGuest) PerformModifySrcCheck(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
 	if !utils.IsInStringArray(self.Status, []string{api.VM_READY, api.VM_RUNNING}) {
@@ -5470,7 +5506,7 @@ func (self *SGuest) PerformInstanceSnapshot(
 			return nil, httperrors.NewUnsupportOperationError("Can't save memory state when guest status is %q", self.Status)
 		}
 	}
-	instanceSnapshot, err := InstanceSnapshotManager.CreateInstanceSnapshot(ctx, userCred, self, input.Name, false, input.WithMemory)
+	instanceSnapshot, err := InstanceSnapshotManager.CreateInstanceSnapshot(ctx, userCred, self, input.Name, false, input.WithMemory, input.Consistent)
 	if err != nil {
 		quotas.CancelPendingUsage(
 			ctx, userCred, pendingUsage, pendingUsage, false)
@@ -5524,7 +5560,7 @@ func (self *SGuest) PerformInstanceBackup(
 	if bs.Status != api.BACKUPSTORAGE_STATUS_ONLINE {
 		return nil, httperrors.NewForbiddenError("can't backup guest to backup storage with status %s", bs.Status)
 	}
-	instanceBackup, err := InstanceBackupManager.CreateInstanceBackup(ctx, userCred, self, name, backupStorageId)
+	instanceBackup, err := InstanceBackupManager.CreateInstanceBackup(ctx, userCred, self, name, backupStorageId, input.Consistent)
 	if err != nil {
 		return nil, httperrors.NewInternalServerError("create instance backup failed: %s", err)
 	}
@@ -5688,7 +5724,7 @@ func (self *SGuest) PerformSnapshotAndClone(
 	}
 	instanceSnapshot, err := InstanceSnapshotManager.CreateInstanceSnapshot(
 		ctx, userCred, self, instanceSnapshotName,
-		input.AutoDeleteInstanceSnapshot != nil && *input.AutoDeleteInstanceSnapshot, false)
+		input.AutoDeleteInstanceSnapshot != nil && *input.AutoDeleteInstanceSnapshot, false, false)
 	if err != nil {
 		quotas.CancelPendingUsage(ctx, userCred, &pendingUsage, &pendingUsage, false)
 		quotas.CancelPendingUsage(ctx, userCred, &pendingRegionUsage, &pendingRegionUsage, false)
@@ -0,0 +1,515 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/netutils"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+// 跨区域迁移虚拟机
+// 磁盘以流式拷贝方式迁移到目标区域的宿主机, 网卡按照重映射规则切换到目标区域的网络
+// 在最终切换之前源虚拟机的记录保持不变, 失败时释放目标区域预留的IP地址即可回滚
+// 仅支持同一部署(同一数据库)内的区域之间迁移
+// 跨部署迁移需要在两个部署之间导出导入并切换记录, 不在本功能范围内, 已拆分为单独的需求, 目前会被明确拒绝
+func (self *SGuest) PerformCrossRegionMigrate(
+	ctx context.Context, userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject, input *api.GuestCrossRegionMigrateInput,
+) (jsonutils.JSONObject, error) {
+	if err := self.validateCrossRegionMigrate(ctx, userCred, input); err != nil {
+		return nil, err
+	}
+	if err := self.reserveRemapAddresses(ctx, userCred, input.Networks); err != nil {
+		return nil, err
+	}
+	if err := self.StartCrossRegionMigrateTask(ctx, userCred, input, ""); err != nil {
+		self.ReleaseRemapAddresses(ctx, userCred, input.Networks)
+		return nil, errors.Wrap(err, "StartCrossRegionMigrateTask")
+	}
+	return nil, nil
+}
+
+func (self *SGuest) validateCrossRegionMigrate(ctx context.Context, userCred mcclient.TokenCredential, input *api.GuestCrossRegionMigrateInput) error {
+	if self.GetHypervisor() != api.HYPERVISOR_KVM {
+		return httperrors.NewNotAcceptableError("Not allow for hypervisor %s", self.GetHypervisor())
+	}
+	if len(self.BackupHostId) > 0 {
+		return httperrors.NewBadRequestError("Cannot cross-region migrate guest with backup host")
+	}
+	if input.LiveSwitchover {
+		if self.Status != api.VM_RUNNING {
+			return httperrors.NewServerStatusError("Cannot live switchover guest in status %s", self.Status)
+		}
+	} else if self.Status != api.VM_READY {
+		return httperrors.NewServerStatusError("Cannot cold switchover guest in status %s, stop it first or use live_switchover", self.Status)
+	}
+
+	srcRegion, err := self.GetRegion()
+	if err != nil {
+		return errors.Wrap(err, "GetRegion")
+	}
+	if err := self.validateCrossRegionTarget(ctx, userCred, input); err != nil {
+		return err
+	}
+	if input.PreferRegionId == srcRegion.Id {
+		return httperrors.NewBadRequestError("target region is the same as source region %s, use migrate or live-migrate instead", srcRegion.Name)
+	}
+
+	if eip, _ := self.GetElasticIp(); eip != nil {
+		return httperrors.NewBadRequestError("eip %s is bound to guest, dissociate it first", eip.IpAddr)
+	}
+	if devs, _ := self.GetIsolatedDevices(); len(devs) > 0 {
+		return httperrors.NewBadRequestError("Cannot cross-region migrate guest with isolated devices")
+	}
+	disks, err := self.GetDisks()
+	if err != nil {
+		return errors.Wrap(err, "GetDisks")
+	}
+	for i := range disks {
+		storage, err := disks[i].GetStorage()
+		if err != nil {
+			return errors.Wrapf(err, "disk %s GetStorage", disks[i].Name)
+		}
+		if !utils.IsInStringArray(storage.StorageType, api.STORAGE_LOCAL_TYPES) {
+			return httperrors.NewBadRequestError("disk %s on %s storage %s can not be streamed across region", disks[i].Name, storage.StorageType, storage.Name)
+		}
+	}
+
+	gns, err := self.GetNetworks("")
+	if err != nil {
+		return errors.Wrap(err, "GetNetworks")
+	}
+	remaps, err := checkNetworkRemaps(gns, input.Networks, input.LiveSwitchover)
+	if err != nil {
+		return err
+	}
+	for i := range remaps {
+		netObj, err := NetworkManager.FetchByIdOrName(ctx, userCred, remaps[i].Network)
+		if err != nil {
+			if errors.Cause(err) == errors.ErrNotFound {
+				return httperrors.NewResourceNotFoundError2(NetworkManager.Keyword(), remaps[i].Network)
+			}
+			return errors.Wrapf(err, "fetch network %s", remaps[i].Network)
+		}
+		network := netObj.(*SNetwork)
+		region, err := network.GetRegion()
+		if err != nil {
+			return errors.Wrapf(err, "network %s GetRegion", network.Name)
+		}
+		if region.Id != input.PreferRegionId {
+			return httperrors.NewInputParameterError("network %s of nic %d is not in target region", network.Name, remaps[i].Index)
+		}
+		if len(remaps[i].Address) > 0 {
+			addr, err := netutils.NewIPV4Addr(remaps[i].Address)
+			if err != nil {
+				return httperrors.NewInputParameterError("invalid address %s of nic %d", remaps[i].Address, remaps[i].Index)
+			}
+			if !network.IsAddressInRange(addr) {
+				return httperrors.NewInputParameterError("address %s of nic %d not in range of network %s", remaps[i].Address, remaps[i].Index, network.Name)
+			}
+		}
+		remaps[i].NetworkId = network.Id
+	}
+	input.Networks = remaps
+	return nil
+}
+
+// validateCrossRegionTarget resolves prefer host/zone/region into ids and
+// makes sure they point to the same region
+func (self *SGuest) validateCrossRegionTarget(ctx context.Context, userCred mcclient.TokenCredential, input *api.GuestCrossRegionMigrateInput) error {
+	if len(input.PreferHostId) > 0 {
+		hostObj, err := HostManager.FetchByIdOrName(ctx, userCred, input.PreferHostId)
+		if err != nil {
+			return httperrors.NewResourceNotFoundError2(HostManager.Keyword(), input.PreferHostId)
+		}
+		host := hostObj.(*SHost)
+		if host.HostType != api.HOST_TYPE_HYPERVISOR {
+			return httperrors.NewBadRequestError("host %s is not kvm host", host.Name)
+		}
+		if len(input.PreferZoneId) > 0 && input.PreferZoneId != host.ZoneId {
+			return httperrors.NewInputParameterError("host %s not in zone %s", host.Name, input.PreferZoneId)
+		}
+		input.PreferHostId = host.Id
+		input.PreferZoneId = host.ZoneId
+	}
+	if len(input.PreferZoneId) > 0 {
+		zoneObj, err := ZoneManager.FetchByIdOrName(ctx, userCred, input.PreferZoneId)
+		if err != nil {
+			return httperrors.NewResourceNotFoundError2(ZoneManager.Keyword(), input.PreferZoneId)
+		}
+		zone := zoneObj.(*SZone)
+		if len(input.PreferRegionId) > 0 && input.PreferRegionId != zone.CloudregionId {
+			regionObj, err := CloudregionManager.FetchByIdOrName(ctx, userCred, input.PreferRegionId)
+			if err != nil || regionObj.GetId() != zone.CloudregionId {
+				return httperrors.NewInputParameterError("zone %s not in region %s", zone.Name, input.PreferRegionId)
+			}
+		}
+		input.PreferZoneId = zone.Id
+		input.PreferRegionId = zone.CloudregionId
+	}
+	if len(input.PreferRegionId) == 0 {
+		return httperrors.NewMissingParameterError("prefer_region_id")
+	}
+	regionObj, err := CloudregionManager.FetchByIdOrName(ctx, userCred, input.PreferRegionId)
+	if err != nil {
+		if errors.Cause(err) == errors.ErrNotFound {
+			// regions of other deployments live in other databases, the
+			// export/import handover between deployments is not implemented
+			return httperrors.NewNotSupportedError("region %s is not managed by this deployment, cross-region migration only moves guests within one deployment", input.PreferRegionId)
+		}
+		return errors.Wrapf(err, "fetch region %s", input.PreferRegionId)
+	}
+	region := regionObj.(*SCloudregion)
+	if region.Provider != api.CLOUD_PROVIDER_ONECLOUD {
+		return httperrors.NewNotSupportedError("region %s of %s is not an on-premise region of this deployment", region.Name, region.Provider)
+	}
+	input.PreferRegionId = region.Id
+	return nil
+}
+
+// checkNetworkRemaps matches remap rules with guest nics by index, every nic
+// must have exactly one rule, the result is ordered the same as nics
+func checkNetworkRemaps(gns []SGuestnetwork, rules []api.GuestNetworkRemap, live bool) ([]api.GuestNetworkRemap, error) {
+	ruleMap := make(map[int]api.GuestNetworkRemap, len(rules))
+	for i := range rules {
+		if _, ok := ruleMap[rules[i].Index]; ok {
+			return nil, httperrors.NewDuplicateIdError("networks.index", fmt.Sprintf("%d", rules[i].Index))
+		}
+		if len(rules[i].Network) == 0 {
+			return nil, httperrors.NewMissingParameterError(fmt.Sprintf("networks.%d.network", i))
+		}
+		ruleMap[rules[i].Index] = rules[i]
+	}
+	remaps := make([]api.GuestNetworkRemap, 0, len(gns))
+	for i := range gns {
+		rule, ok := ruleMap[int(gns[i].Index)]
+		if !ok {
+			return nil, httperrors.NewMissingParameterError(fmt.Sprintf("network remap of nic %d", gns[i].Index))
+		}
+		delete(ruleMap, int(gns[i].Index))
+		if rule.ReuseIp {
+			if len(rule.Address) > 0 && rule.Address != gns[i].IpAddr {
+				return nil, httperrors.NewConflictError("nic %d reuse_ip conflicts with address %s", rule.Index, rule.Address)
+			}
+			rule.Address = gns[i].IpAddr
+		}
+		if live && rule.Address != gns[i].IpAddr {
+			return nil, httperrors.NewInputParameterError("live switchover requires nic %d to reuse ip %s", rule.Index, gns[i].IpAddr)
+		}
+		rule.MacAddr = gns[i].MacAddr
+		rule.SourceNetworkId = gns[i].NetworkId
+		rule.SourceIpAddr = gns[i].IpAddr
+		remaps = append(remaps, rule)
+	}
+	for i := range rules {
+		if _, ok := ruleMap[rules[i].Index]; ok {
+			return nil, httperrors.NewInputParameterError("nic %d not found", rules[i].Index)
+		}
+	}
+	return remaps, nil
+}
+
+func (self *SGuest) getRemapReserveNotes() string {
+	return api.CROSS_REGION_MIGRATE_RESERVE_NOTES + self.Id
+}
+
+// reserveRemapAddresses holds target addresses as reserved ips until
+// handover, so that nothing in the target region can take them
+func (self *SGuest) reserveRemapAddresses(ctx context.Context, userCred mcclient.TokenCredential, remaps []api.GuestNetworkRemap) error {
+	for i := range remaps {
+		err := func() error {
+			netObj, err := NetworkManager.FetchById(remaps[i].NetworkId)
+			if err != nil {
+				return errors.Wrapf(err, "FetchById %s", remaps[i].NetworkId)
+			}
+			network := netObj.(*SNetwork)
+			lockman.LockObject(ctx, network)
+			defer lockman.ReleaseObject(ctx, network)
+
+			candidate := remaps[i].Address
+			addr, err := network.GetFreeIP(ctx, userCred, nil, nil, candidate, "", false, api.AddressTypeIPv4)
+			if err != nil {
+				return errors.Wrapf(err, "GetFreeIP of network %s", network.Name)
+			}
+			if len(candidate) > 0 && addr != candidate {
+				return httperrors.NewConflictError("address %s of network %s has been used", candidate, network.Name)
+			}
+			err = ReservedipManager.ReserveIP(ctx, userCred, network, addr, self.getRemapReserveNotes(), api.AddressTypeIPv4)
+			if err != nil {
+				return errors.Wrapf(err, "reserve %s of network %s", addr, network.Name)
+			}
+			remaps[i].Address = addr
+			return nil
+		}()
+		if err != nil {
+			self.ReleaseRemapAddresses(ctx, userCred, remaps[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseRemapAddresses gives back target addresses reserved by cross-region migrate,
+// it is the rollback of reserveRemapAddresses and safe to call more than once
+func (self *SGuest) ReleaseRemapAddresses(ctx context.Context, userCred mcclient.TokenCredential, remaps []api.GuestNetworkRemap) {
+	for i := range remaps {
+		netObj, err := NetworkManager.FetchById(remaps[i].NetworkId)
+		if err != nil {
+			continue
+		}
+		network := netObj.(*SNetwork)
+		rip := ReservedipManager.GetReservedIP(network, remaps[i].Address, api.AddressTypeIPv4)
+		if rip == nil || rip.Notes != self.getRemapReserveNotes() {
+			continue
+		}
+		if err := rip.Release(ctx, userCred, network); err != nil {
+			log.Errorf("release reserved ip %s of network %s: %s", remaps[i].Address, network.Name, err)
+		}
+	}
+}
+
+// RemapNicsJsonDesc replaces nic descs of target host with remapped networks and addresses
+func (self *SGuest) RemapNicsJsonDesc(ctx context.Context, host *SHost, desc *api.GuestJsonDesc, remaps []api.GuestNetworkRemap) error {
+	gns, err := self.GetNetworks("")
+	if err != nil {
+		return errors.Wrap(err, "GetNetworks")
+	}
+	for i := range remaps {
+		var ngn *SGuestnetwork
+		for j := range gns {
+			if gns[j].MacAddr == remaps[i].MacAddr {
+				gn := gns[j]
+				gn.NetworkId = remaps[i].NetworkId
+				gn.IpAddr = remaps[i].Address
+				gn.Ip6Addr = ""
+				ngn = &gn
+				break
+			}
+		}
+		if ngn == nil {
+			return errors.Wrapf(errors.ErrNotFound, "guestnetwork with mac %s", remaps[i].MacAddr)
+		}
+		for j := range desc.Nics {
+			if desc.Nics[j].Mac == remaps[i].MacAddr {
+				desc.Nics[j] = ngn.getJsonDescAtHost(ctx, host)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// txUpdate saves the change of model made by doUpdate in transaction tx.
+// model is changed in memory even if tx is rolled back later
+func txUpdate(ctx context.Context, tx *sql.Tx, model db.IModel, doUpdate func()) error {
+	session, err := model.GetModelManager().TableSpec().GetTableSpec().PrepareUpdate(model)
+	if err != nil {
+		return errors.Wrap(err, "PrepareUpdate")
+	}
+	doUpdate()
+	result, err := session.SaveUpdateSql(model)
+	if err != nil {
+		return errors.Wrap(err, "SaveUpdateSql")
+	}
+	if _, err := tx.ExecContext(ctx, result.Sql, result.Vars...); err != nil {
+		return errors.Wrapf(err, "update %s %s", model.Keyword(), model.GetId())
+	}
+	return nil
+}
+
+// HandoverCrossRegion is the point of no return of cross-region migrate.  In
+// one database transaction the guest is moved to the target host, its disks
+// and their snapshots to the target storages, its nics are switched to the
+// remapped networks and the reserved target addresses are consumed.  The
+// reservations keep holding the target addresses until the transaction
+// commits.  If anything fails the transaction is rolled back: the guest
+// stays on the source host with the source guestnetworks, and the target
+// addresses stay reserved until the task releases them
+func (self *SGuest) HandoverCrossRegion(ctx context.Context, userCred mcclient.TokenCredential, srcRegionId, targetHostId string, diskStorages map[string]string, remaps []api.GuestNetworkRemap) error {
+	lockman.LockObject(ctx, self)
+	defer lockman.ReleaseObject(ctx, self)
+
+	gns, err := self.GetNetworks("")
+	if err != nil {
+		return errors.Wrap(err, "GetNetworks")
+	}
+	nics := make([]*SGuestnetwork, len(remaps))
+	networks := make([]*SNetwork, len(remaps))
+	rips := make([]*SReservedip, len(remaps))
+	for i := range remaps {
+		for j := range gns {
+			if gns[j].MacAddr == remaps[i].MacAddr {
+				nics[i] = &gns[j]
+				break
+			}
+		}
+		if nics[i] == nil {
+			return errors.Wrapf(errors.ErrNotFound, "guestnetwork with mac %s", remaps[i].MacAddr)
+		}
+		if nics[i].NetworkId != remaps[i].SourceNetworkId {
+			return errors.Wrapf(httperrors.ErrInvalidStatus, "nic %d is no longer on source network %s", nics[i].Index, remaps[i].SourceNetworkId)
+		}
+		netObj, err := NetworkManager.FetchById(remaps[i].NetworkId)
+		if err != nil {
+			return errors.Wrapf(err, "FetchById %s", remaps[i].NetworkId)
+		}
+		networks[i] = netObj.(*SNetwork)
+		rips[i] = ReservedipManager.GetReservedIP(networks[i], remaps[i].Address, api.AddressTypeIPv4)
+		if rips[i] == nil || rips[i].Notes != self.getRemapReserveNotes() {
+			return errors.Wrapf(httperrors.ErrInvalidStatus, "address %s of network %s is no longer reserved", remaps[i].Address, networks[i].Name)
+		}
+	}
+	disks, err := self.GetDisks()
+	if err != nil {
+		return errors.Wrap(err, "GetDisks")
+	}
+
+	oldHostId := self.HostId
+	err = func() error {
+		tx, err := sqlchemy.GetDB().BeginTx(ctx, nil)
+		if err != nil {
+			return errors.Wrap(err, "BeginTx")
+		}
+		defer tx.Rollback()
+
+		err = txUpdate(ctx, tx, self, func() {
+			self.HostId = targetHostId
+		})
+		if err != nil {
+			return err
+		}
+		for i := range disks {
+			disk := &disks[i]
+			storageId, ok := diskStorages[disk.Id]
+			if !ok {
+				return errors.Wrapf(errors.ErrNotFound, "target storage of disk %s", disk.Name)
+			}
+			err := txUpdate(ctx, tx, disk, func() {
+				disk.Status = api.DISK_READY
+				disk.StorageId = storageId
+			})
+			if err != nil {
+				return err
+			}
+			snapshots := SnapshotManager.GetDiskSnapshots(disk.Id)
+			for j := range snapshots {
+				snapshot := &snapshots[j]
+				snapshot.SetModelManager(SnapshotManager, snapshot)
+				err := txUpdate(ctx, tx, snapshot, func() {
+					snapshot.StorageId = storageId
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for i := range remaps {
+			gn := nics[i]
+			err := txUpdate(ctx, tx, gn, func() {
+				gn.NetworkId = remaps[i].NetworkId
+				gn.IpAddr = remaps[i].Address
+				gn.Ip6Addr = ""
+				gn.MappedIpAddr = ""
+			})
+			if err != nil {
+				return err
+			}
+			rip := rips[i]
+			err = txUpdate(ctx, tx, rip, func() {
+				rip.MarkDelete()
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return errors.Wrap(err, "Commit")
+		}
+		return nil
+	}()
+	if err != nil {
+		self.HostId = oldHostId
+		return errors.Wrap(err, "handover")
+	}
+
+	notes := jsonutils.NewDict()
+	notes.Add(jsonutils.NewString(targetHostId), "host_id")
+	db.OpsLog.LogEvent(self, db.ACT_SCHEDULE, notes, userCred)
+	for i := range remaps {
+		db.OpsLog.LogEvent(networks[i], db.ACT_RELEASE_IP, rips[i].GetShortDesc(ctx), userCred)
+		logclient.AddActionLogWithContext(ctx, self, logclient.ACT_VM_CHANGE_NIC, jsonutils.Marshal(remaps[i]), userCred, true)
+	}
+	for _, hostId := range []string{oldHostId, targetHostId} {
+		if host := HostManager.FetchHostById(hostId); host != nil {
+			host.ClearSchedDescCache()
+		}
+	}
+	return self.SetMetadata(ctx, api.SERVER_META_CROSS_REGION_MIGRATE_FROM, srcRegionId, userCred)
+}
+
+func (self *SGuest) StartCrossRegionMigrateTask(ctx context.Context, userCred mcclient.TokenCredential, input *api.GuestCrossRegionMigrateInput, parentTaskId string) error {
+	srcRegion, err := self.GetRegion()
+	if err != nil {
+		return errors.Wrap(err, "GetRegion")
+	}
+	data := jsonutils.NewDict()
+	data.Set("cross_region", jsonutils.JSONTrue)
+	data.Set("source_region_id", jsonutils.NewString(srcRegion.Id))
+	data.Set("prefer_region_id", jsonutils.NewString(input.PreferRegionId))
+	if len(input.PreferZoneId) > 0 {
+		data.Set("prefer_zone_id", jsonutils.NewString(input.PreferZoneId))
+	}
+	if len(input.PreferHostId) > 0 {
+		data.Set("prefer_host_id", jsonutils.NewString(input.PreferHostId))
+	}
+	data.Set("network_remaps", jsonutils.Marshal(input.Networks))
+	data.Set("guest_status", jsonutils.NewString(self.Status))
+
+	taskName := "GuestMigrateTask"
+	if input.LiveSwitchover {
+		taskName = "GuestLiveMigrateTask"
+		data.Set("skip_cpu_check", jsonutils.NewBool(input.SkipCpuCheck))
+		data.Set("enable_tls", jsonutils.NewBool(input.EnableTLS))
+		if input.MaxBandwidthMb != nil {
+			data.Set("max_bandwidth_mb", jsonutils.NewInt(*input.MaxBandwidthMb))
+		}
+	} else if input.AutoStart {
+		data.Set("auto_start", jsonutils.JSONTrue)
+	}
+
+	task, err := taskman.TaskManager.NewTask(ctx, taskName, self, userCred, data, parentTaskId, "", nil)
+	if err != nil {
+		return errors.Wrapf(err, "NewTask %s", taskName)
+	}
+	self.SetStatus(ctx, userCred, api.VM_START_MIGRATE, "cross region migrate")
+	task.ScheduleRun(nil)
+	return nil
+}
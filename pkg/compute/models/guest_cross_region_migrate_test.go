@@ -0,0 +1,127 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+func TestCheckNetworkRemaps(t *testing.T) {
+	gns := []SGuestnetwork{
+		{Index: 0, NetworkId: "net-a", IpAddr: "10.0.0.2", MacAddr: "00:22:00:00:00:01"},
+		{Index: 1, NetworkId: "net-b", IpAddr: "10.1.0.2", MacAddr: "00:22:00:00:00:02"},
+	}
+	cases := []struct {
+		name    string
+		rules   []api.GuestNetworkRemap
+		live    bool
+		wantErr bool
+		want    []string
+	}{
+		{
+			name: "reuse and change",
+			rules: []api.GuestNetworkRemap{
+				{Index: 1, Network: "net-y", Address: "10.3.0.5"},
+				{Index: 0, Network: "net-x", ReuseIp: true},
+			},
+			want: []string{"10.0.0.2", "10.3.0.5"},
+		},
+		{
+			name: "auto allocate",
+			rules: []api.GuestNetworkRemap{
+				{Index: 0, Network: "net-x"},
+				{Index: 1, Network: "net-y"},
+			},
+			want: []string{"", ""},
+		},
+		{
+			name: "missing nic",
+			rules: []api.GuestNetworkRemap{
+				{Index: 0, Network: "net-x"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown nic",
+			rules: []api.GuestNetworkRemap{
+				{Index: 0, Network: "net-x"},
+				{Index: 1, Network: "net-y"},
+				{Index: 2, Network: "net-z"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate nic",
+			rules: []api.GuestNetworkRemap{
+				{Index: 0, Network: "net-x"},
+				{Index: 0, Network: "net-y"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "reuse conflicts address",
+			rules: []api.GuestNetworkRemap{
+				{Index: 0, Network: "net-x", ReuseIp: true, Address: "10.3.0.5"},
+				{Index: 1, Network: "net-y"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "live requires reuse",
+			rules: []api.GuestNetworkRemap{
+				{Index: 0, Network: "net-x", ReuseIp: true},
+				{Index: 1, Network: "net-y"},
+			},
+			live:    true,
+			wantErr: true,
+		},
+		{
+			name: "live reuse",
+			rules: []api.GuestNetworkRemap{
+				{Index: 0, Network: "net-x", ReuseIp: true},
+				{Index: 1, Network: "net-y", Address: "10.1.0.2"},
+			},
+			live: true,
+			want: []string{"10.0.0.2", "10.1.0.2"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			remaps, err := checkNetworkRemaps(gns, c.rules, c.live)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %#v", remaps)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if len(remaps) != len(gns) {
+				t.Fatalf("want %d remaps, got %d", len(gns), len(remaps))
+			}
+			for i := range remaps {
+				if remaps[i].Index != int(gns[i].Index) || remaps[i].MacAddr != gns[i].MacAddr || remaps[i].SourceIpAddr != gns[i].IpAddr {
+					t.Errorf("remap %d not matched with nic: %#v", i, remaps[i])
+				}
+				if remaps[i].Address != c.want[i] {
+					t.Errorf("remap %d address want %q got %q", i, c.want[i], remaps[i].Address)
+				}
+			}
+		})
+	}
+}
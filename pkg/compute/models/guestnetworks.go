@@ -121,6 +121,9 @@ type SGuestnetwork struct {
 
 	// 端口映射
 	PortMappings api.GuestPortMappings `length:"long" list:"user" update:"user"`
+
+	// 关联的QoS策略, 为空时使用所在IP子网的QoS策略
+	QosPolicyId string `width:"36" charset:"ascii" nullable:"true" index:"true" list:"user"`
 }
 
 func (gn SGuestnetwork) GetIP() string {
@@ -677,6 +680,7 @@ func (gn *SGuestnetwork) getJsonDesc() *api.GuestnetworkJsonDesc {
 	desc.VirtualIps = gn.GetVirtualIPs()
 	desc.ExternalId = net.ExternalId
 	desc.TeamWith = gn.TeamWith
+	desc.QosPolicy = gn.getQosPolicyDesc(net)
 
 	guest := gn.getGuest()
 	if ifname, ok := gn.OvsOffloadIfname(); ok {
@@ -710,6 +714,18 @@ func (gn *SGuestnetwork) getJsonDesc() *api.GuestnetworkJsonDesc {
 	return desc
 }
 
+// getQosPolicyDesc returns the effective qos policy of the nic, falls back
+// to that of the network if the nic has no enabled policy, the same order as
+// vpcagent applies to ovn nics
+func (gn *SGuestnetwork) getQosPolicyDesc(net *SNetwork) *api.QosPolicyDesc {
+	for _, policyId := range []string{gn.QosPolicyId, net.QosPolicyId} {
+		if policy := QosPolicyManager.fetchEnabledQosPolicy(policyId); policy != nil {
+			return policy.GetDesc()
+		}
+	}
+	return nil
+}
+
 func (gn *SGuestnetwork) IsSriovWithoutOffload() bool {
 	if gn.Driver != api.NETWORK_DRIVER_VFIO {
 		return false
@@ -1600,6 +1600,10 @@ func (manager *SGuestManager) validateCreateData(
 		return nil, httperrors.NewInputParameterError("metdata must less then 20")
 	}
 
+	if input.ReservationTimeout < 0 || input.ReservationTimeout > api.SCHED_RESERVATION_MAX_TIMEOUT {
+		return nil, httperrors.NewOutOfRangeError("reservation_timeout should be in range 0-%d", api.SCHED_RESERVATION_MAX_TIMEOUT)
+	}
+
 	if len(input.InstanceSnapshotId) > 0 {
 		inputMem := input.VmemSize
 		inputCpu := input.VcpuCount
@@ -1779,6 +1783,9 @@ func (manager *SGuestManager) validateCreateData(
 			if input.Bios == "UEFI" && len(imgProperties) != 0 {
 				return nil, httperrors.NewInputParameterError("UEFI boot mode requires UEFI image")
 			}
+			if input.EnableSecureBoot && len(imgProperties) != 0 {
+				return nil, httperrors.NewInputParameterError("secure boot requires UEFI image")
+			}
 		}
 
 		if len(imgProperties) == 0 {
@@ -2161,6 +2168,10 @@ func (manager *SGuestManager) validateCreateData(
 
 		}*/
 
+	if (input.EnableVtpm || input.EnableSecureBoot) && input.Hypervisor != api.HYPERVISOR_KVM {
+		return nil, httperrors.NewNotSupportedError("vtpm and secure boot are not supported by hypervisor %s", input.Hypervisor)
+	}
+
 	if input.ResourceType != api.HostResourceTypePrepaidRecycle {
 		input, err = driver.ValidateCreateData(ctx, userCred, input)
 		if err != nil {
@@ -2527,6 +2538,12 @@ func (guest *SGuest) PostCreate(ctx context.Context, userCred mcclient.TokenCred
 	if jsonutils.QueryBoolean(data, imageapi.IMAGE_DISABLE_USB_KBD, false) {
 		guest.SetMetadata(ctx, imageapi.IMAGE_DISABLE_USB_KBD, "true", userCred)
 	}
+	if jsonutils.QueryBoolean(data, api.VM_METADATA_ENABLE_VTPM, false) {
+		guest.SetMetadata(ctx, api.VM_METADATA_ENABLE_VTPM, "true", userCred)
+	}
+	if jsonutils.QueryBoolean(data, api.VM_METADATA_ENABLE_SECURE_BOOT, false) {
+		guest.SetMetadata(ctx, api.VM_METADATA_ENABLE_SECURE_BOOT, "true", userCred)
+	}
 	matcherJson, _ := data.Get(api.BAREMETAL_SERVER_METATA_ROOT_DISK_MATCHER)
 	if matcherJson != nil {
 		guest.SetMetadata(ctx, api.BAREMETAL_SERVER_METATA_ROOT_DISK_MATCHER, matcherJson, userCred)
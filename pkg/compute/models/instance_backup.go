@@ -75,6 +75,10 @@ type SInstanceBackup struct {
 	InstanceType string `width:"64" charset:"utf8" nullable:"true" list:"user" create:"optional"`
 	// 主机备份容量和
 	SizeMb int `nullable:"false" list:"user"`
+	// 是否冻结文件系统创建一致性备份
+	Consistent bool `nullable:"false" default:"false" list:"user"`
+	// 所有磁盘快照是否均在文件系统冻结期间完成
+	Quiesced bool `nullable:"false" default:"false" list:"user"`
 }
 
 // +onecloud:swagger-gen-model-singular=instancebackup
@@ -334,11 +338,12 @@ func (manager *SInstanceBackupManager) fillInstanceBackup(ctx context.Context, u
 	instanceBackup.InstanceType = guest.InstanceType
 }
 
-func (manager *SInstanceBackupManager) CreateInstanceBackup(ctx context.Context, userCred mcclient.TokenCredential, guest *SGuest, name, backupStorageId string) (*SInstanceBackup, error) {
+func (manager *SInstanceBackupManager) CreateInstanceBackup(ctx context.Context, userCred mcclient.TokenCredential, guest *SGuest, name, backupStorageId string, consistent bool) (*SInstanceBackup, error) {
 	instanceBackup := &SInstanceBackup{}
 	instanceBackup.SetModelManager(manager, instanceBackup)
 	instanceBackup.Name = name
 	instanceBackup.BackupStorageId = backupStorageId
+	instanceBackup.Consistent = consistent
 	manager.fillInstanceBackup(ctx, userCred, guest, instanceBackup)
 	// compute size of instanceBackup
 	//instanceBackup.SizeMb = guest.getDiskSize()
@@ -92,6 +92,10 @@ type SInstanceSnapshot struct {
 	MemoryFilePath string `width:"512" charset:"utf8" nullable:"true" get:"user" list:"user"`
 	// 内存文件校验和
 	MemoryFileChecksum string `width:"32" charset:"ascii" nullable:"true" get:"user" list:"user"`
+	// 是否冻结文件系统创建一致性快照
+	Consistent bool `nullable:"false" default:"false" get:"user" list:"user"`
+	// 所有磁盘快照是否均在文件系统冻结期间完成
+	Quiesced bool `nullable:"false" default:"false" get:"user" list:"user"`
 }
 
 type SInstanceSnapshotManager struct {
@@ -415,7 +419,7 @@ func (manager *SInstanceSnapshotManager) fillInstanceSnapshot(ctx context.Contex
 	instanceSnapshot.ServerMetadata = serverMetadata
 }
 
-func (manager *SInstanceSnapshotManager) CreateInstanceSnapshot(ctx context.Context, userCred mcclient.TokenCredential, guest *SGuest, name string, autoDelete bool, withMemory bool) (*SInstanceSnapshot, error) {
+func (manager *SInstanceSnapshotManager) CreateInstanceSnapshot(ctx context.Context, userCred mcclient.TokenCredential, guest *SGuest, name string, autoDelete bool, withMemory bool, consistent bool) (*SInstanceSnapshot, error) {
 	instanceSnapshot := &SInstanceSnapshot{}
 	instanceSnapshot.SetModelManager(manager, instanceSnapshot)
 	instanceSnapshot.Name = name
@@ -428,6 +432,7 @@ func (manager *SInstanceSnapshotManager) CreateInstanceSnapshot(ctx context.Cont
 	// compute size of instanceSnapshot
 	instanceSnapshot.SizeMb = guest.getDiskSize()
 	instanceSnapshot.WithMemory = withMemory
+	instanceSnapshot.Consistent = consistent
 	instanceSnapshot.MemoryFileHostId = guest.HostId
 	err := manager.TableSpec().Insert(ctx, instanceSnapshot)
 	if err != nil {
@@ -0,0 +1,327 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+	"yunion.io/x/onecloud/pkg/util/stringutils2"
+)
+
+// +onecloud:swagger-gen-model-singular=network_acl
+// +onecloud:swagger-gen-model-plural=network_acls
+type SNetworkAclManager struct {
+	db.SEnabledStatusInfrasResourceBaseManager
+}
+
+var NetworkAclManager *SNetworkAclManager
+
+func init() {
+	NetworkAclManager = &SNetworkAclManager{
+		SEnabledStatusInfrasResourceBaseManager: db.NewEnabledStatusInfrasResourceBaseManager(
+			SNetworkAcl{},
+			"network_acls_tbl",
+			"network_acl",
+			"network_acls",
+		),
+	}
+	NetworkAclManager.SetVirtualObject(NetworkAclManager)
+}
+
+// 子网级别的网络ACL, 仅适用于vpcagent管理的VPC
+// 规则是有状态的, 被放行连接的回包总是被放行, 这与公有云无状态的网络ACL不同
+// +onecloud:model-api-gen
+type SNetworkAcl struct {
+	db.SEnabledStatusInfrasResourceBase
+
+	// 所属VPC
+	VpcId string `width:"36" charset:"ascii" nullable:"false" index:"true" list:"domain" create:"domain_required"`
+
+	// 规则列表
+	Rules *api.SNetworkAclRules `length:"long" list:"domain" update:"domain" create:"domain_optional"`
+}
+
+func (manager *SNetworkAclManager) ListItemFilter(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.NetworkAclListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusInfrasResourceBaseManager.ListItemFilter(ctx, q, userCred, query.EnabledStatusInfrasResourceBaseListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SEnabledStatusInfrasResourceBaseManager.ListItemFilter")
+	}
+	if len(query.VpcId) > 0 {
+		vpcObj, err := VpcManager.FetchByIdOrName(ctx, userCred, query.VpcId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return nil, httperrors.NewResourceNotFoundError2(VpcManager.Keyword(), query.VpcId)
+			}
+			return nil, errors.Wrap(err, "VpcManager.FetchByIdOrName")
+		}
+		q = q.Equals("vpc_id", vpcObj.GetId())
+	}
+	return q, nil
+}
+
+func (manager *SNetworkAclManager) OrderByExtraFields(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.NetworkAclListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusInfrasResourceBaseManager.OrderByExtraFields(ctx, q, userCred, query.EnabledStatusInfrasResourceBaseListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SEnabledStatusInfrasResourceBaseManager.OrderByExtraFields")
+	}
+	return q, nil
+}
+
+func (manager *SNetworkAclManager) QueryDistinctExtraField(q *sqlchemy.SQuery, field string) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusInfrasResourceBaseManager.QueryDistinctExtraField(q, field)
+	if err == nil {
+		return q, nil
+	}
+	return q, httperrors.ErrNotFound
+}
+
+type sNetworkAclNetworkCount struct {
+	NetworkAclId string
+	NetworkCount int
+}
+
+func (manager *SNetworkAclManager) fetchNetworkCounts(aclIds []string) (map[string]int, error) {
+	q := NetworkManager.Query().In("network_acl_id", aclIds)
+	sq := q.SubQuery()
+	cq := sq.Query(
+		sq.Field("network_acl_id"),
+		sqlchemy.COUNT("network_count", sq.Field("id")),
+	)
+	cq = cq.GroupBy(cq.Field("network_acl_id"))
+	counts := []sNetworkAclNetworkCount{}
+	err := cq.All(&counts)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]int{}
+	for _, c := range counts {
+		ret[c.NetworkAclId] = c.NetworkCount
+	}
+	return ret, nil
+}
+
+func (manager *SNetworkAclManager) FetchCustomizeColumns(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	objs []interface{},
+	fields stringutils2.SSortedStrings,
+	isList bool,
+) []api.NetworkAclDetails {
+	rows := make([]api.NetworkAclDetails, len(objs))
+	stdRows := manager.SEnabledStatusInfrasResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+	aclIds := make([]string, len(objs))
+	vpcIds := make([]string, len(objs))
+	for i := range rows {
+		rows[i] = api.NetworkAclDetails{
+			EnabledStatusInfrasResourceBaseDetails: stdRows[i],
+		}
+		acl := objs[i].(*SNetworkAcl)
+		aclIds[i] = acl.Id
+		vpcIds[i] = acl.VpcId
+	}
+	vpcMap, err := db.FetchIdNameMap2(VpcManager, vpcIds)
+	if err != nil {
+		log.Errorf("FetchIdNameMap2 vpc fail: %s", err)
+	}
+	counts, err := manager.fetchNetworkCounts(aclIds)
+	if err != nil {
+		log.Errorf("fetchNetworkCounts fail: %s", err)
+	}
+	for i := range rows {
+		rows[i].Vpc = vpcMap[vpcIds[i]]
+		rows[i].NetworkCount = counts[aclIds[i]]
+	}
+	return rows
+}
+
+func (manager *SNetworkAclManager) ValidateCreateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	ownerId mcclient.IIdentityProvider,
+	query jsonutils.JSONObject,
+	input api.NetworkAclCreateInput,
+) (api.NetworkAclCreateInput, error) {
+	var err error
+	input.EnabledStatusInfrasResourceBaseCreateInput, err = manager.SEnabledStatusInfrasResourceBaseManager.ValidateCreateData(ctx, userCred, ownerId, query, input.EnabledStatusInfrasResourceBaseCreateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SEnabledStatusInfrasResourceBaseManager.ValidateCreateData")
+	}
+	if len(input.VpcId) == 0 {
+		return input, httperrors.NewMissingParameterError("vpc_id")
+	}
+	vpcObj, err := VpcManager.FetchByIdOrName(ctx, userCred, input.VpcId)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return input, httperrors.NewResourceNotFoundError2(VpcManager.Keyword(), input.VpcId)
+		}
+		return input, errors.Wrap(err, "VpcManager.FetchByIdOrName")
+	}
+	vpc := vpcObj.(*SVpc)
+	if !vpc.isOvnBacked() {
+		return input, errors.Wrapf(httperrors.ErrNotSupported, "vpc %s is not ovn backed", vpc.Name)
+	}
+	input.VpcId = vpc.Id
+	if err := input.Rules.Validate(); err != nil {
+		return input, err
+	}
+	input.Status = api.NETWORK_ACL_STATUS_AVAILABLE
+	if input.Enabled == nil {
+		trueVal := true
+		input.Enabled = &trueVal
+	}
+	return input, nil
+}
+
+func (acl *SNetworkAcl) ValidateUpdateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.NetworkAclUpdateInput,
+) (api.NetworkAclUpdateInput, error) {
+	var err error
+	input.EnabledStatusInfrasResourceBaseUpdateInput, err = acl.SEnabledStatusInfrasResourceBase.ValidateUpdateData(ctx, userCred, query, input.EnabledStatusInfrasResourceBaseUpdateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SEnabledStatusInfrasResourceBase.ValidateUpdateData")
+	}
+	if err := input.Rules.Validate(); err != nil {
+		return input, err
+	}
+	return input, nil
+}
+
+func (acl *SNetworkAcl) GetNetworks() ([]SNetwork, error) {
+	q := NetworkManager.Query().Equals("network_acl_id", acl.Id)
+	nets := []SNetwork{}
+	err := db.FetchModelObjects(NetworkManager, q, &nets)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	return nets, nil
+}
+
+func (acl *SNetworkAcl) ValidateDeleteCondition(ctx context.Context, info jsonutils.JSONObject) error {
+	cnt, err := NetworkManager.Query().Equals("network_acl_id", acl.Id).CountWithError()
+	if err != nil {
+		return errors.Wrap(err, "count associated networks")
+	}
+	if cnt > 0 {
+		return httperrors.NewNotEmptyError("network acl is associated with %d networks, please disassociate first", cnt)
+	}
+	return acl.SEnabledStatusInfrasResourceBase.ValidateDeleteCondition(ctx, nil)
+}
+
+func (acl *SNetworkAcl) fetchNetworks(ctx context.Context, userCred mcclient.TokenCredential, netIds []string) ([]*SNetwork, error) {
+	if len(netIds) == 0 {
+		return nil, httperrors.NewMissingParameterError("network_ids")
+	}
+	nets := make([]*SNetwork, 0, len(netIds))
+	for _, netId := range netIds {
+		netObj, err := NetworkManager.FetchByIdOrName(ctx, userCred, netId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return nil, httperrors.NewResourceNotFoundError2(NetworkManager.Keyword(), netId)
+			}
+			return nil, errors.Wrap(err, "NetworkManager.FetchByIdOrName")
+		}
+		network := netObj.(*SNetwork)
+		vpc, err := network.GetVpc()
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetVpc of network %s", network.Name)
+		}
+		if vpc.Id != acl.VpcId {
+			return nil, httperrors.NewInputParameterError("network %s is not in vpc of network acl", network.Name)
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+// 将网络ACL关联到IP子网, 子网原有的网络ACL将被替换
+func (acl *SNetworkAcl) PerformAssociate(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.NetworkAclAssociateInput,
+) (jsonutils.JSONObject, error) {
+	nets, err := acl.fetchNetworks(ctx, userCred, input.NetworkIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, network := range nets {
+		if network.NetworkAclId == acl.Id {
+			continue
+		}
+		_, err := db.Update(network, func() error {
+			network.NetworkAclId = acl.Id
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "associate network %s", network.Name)
+		}
+		db.OpsLog.LogEvent(network, db.ACT_ATTACH, acl.GetShortDesc(ctx), userCred)
+		logclient.AddActionLogWithContext(ctx, acl, logclient.ACT_ATTACH_NETWORK, network.GetShortDesc(ctx), userCred, true)
+	}
+	return nil, nil
+}
+
+// 解除网络ACL与IP子网的关联
+func (acl *SNetworkAcl) PerformDisassociate(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.NetworkAclDisassociateInput,
+) (jsonutils.JSONObject, error) {
+	nets, err := acl.fetchNetworks(ctx, userCred, input.NetworkIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, network := range nets {
+		if network.NetworkAclId != acl.Id {
+			continue
+		}
+		_, err := db.Update(network, func() error {
+			network.NetworkAclId = ""
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "disassociate network %s", network.Name)
+		}
+		db.OpsLog.LogEvent(network, db.ACT_DETACH, acl.GetShortDesc(ctx), userCred)
+		logclient.AddActionLogWithContext(ctx, acl, logclient.ACT_DETACH_NETWORK, network.GetShortDesc(ctx), userCred, true)
+	}
+	return nil, nil
+}
@@ -141,6 +141,12 @@ type SNetwork struct {
 
 	// 线路类型
 	BgpType string `width:"64" charset:"utf8" nullable:"false" list:"user" get:"user" update:"user" create:"optional"`
+
+	// 关联的网络ACL
+	NetworkAclId string `width:"36" charset:"ascii" nullable:"true" index:"true" list:"user"`
+
+	// 关联的QoS策略
+	QosPolicyId string `width:"36" charset:"ascii" nullable:"true" index:"true" list:"user"`
 }
 
 func (manager *SNetworkManager) GetContextManagers() [][]db.IModelManager {
@@ -3930,3 +3936,33 @@ func (net *SNetwork) StartRemoteUpdateTask(ctx context.Context, userCred mcclien
 	net.SetStatus(ctx, userCred, apis.STATUS_UPDATE_TAGS, "StartRemoteUpdateTask")
 	return task.ScheduleRun(nil)
 }
+
+// 设置IP子网的QoS策略, 对未单独设置QoS策略的网卡生效
+func (net *SNetwork) PerformSetQosPolicy(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.NetworkSetQosPolicyInput,
+) (jsonutils.JSONObject, error) {
+	policyId, err := QosPolicyManager.fetchQosPolicyId(ctx, userCred, input.QosPolicyId)
+	if err != nil {
+		return nil, err
+	}
+	if net.QosPolicyId == policyId {
+		return nil, nil
+	}
+	diff, err := db.Update(net, func() error {
+		net.QosPolicyId = policyId
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.OpsLog.LogEvent(net, db.ACT_UPDATE, diff, userCred)
+	logclient.AddActionLogWithContext(ctx, net, logclient.ACT_UPDATE, diff, userCred, true)
+
+	gnq := GuestnetworkManager.Query("guest_id").Equals("network_id", net.Id)
+	gnq = gnq.Filter(sqlchemy.IsNullOrEmpty(gnq.Field("qos_policy_id")))
+	syncQosPolicyGuests(ctx, userCred, gnq)
+	return nil, nil
+}
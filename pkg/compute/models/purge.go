@@ -208,10 +208,12 @@ func (self *SVpc) purge(ctx context.Context, userCred mcclient.TokenCredential)
 	ipv6 := IPv6GatewayManager.Query("id").Equals("vpc_id", self.Id)
 	secgroups := SecurityGroupManager.Query("id").Equals("vpc_id", self.Id)
 	rules := SecurityGroupRuleManager.Query("id").In("secgroup_id", secgroups.SubQuery())
+	nacls := NetworkAclManager.Query("id").Equals("vpc_id", self.Id)
 
 	pairs := []purgePair{
 		{manager: SecurityGroupRuleManager, key: "id", q: rules},
 		{manager: SecurityGroupManager, key: "id", q: secgroups},
+		{manager: NetworkAclManager, key: "id", q: nacls},
 		{manager: IPv6GatewayManager, key: "id", q: ipv6},
 		{manager: InterVpcNetworkRouteSetManager, key: "id", q: intervpcroutes},
 		{manager: DnsZoneVpcManager, key: "row_id", q: dnszones},
@@ -16,8 +16,10 @@ package models
 
 import (
 	"context"
+	"net/http"
 
 	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
 	"yunion.io/x/pkg/errors"
 
 	api "yunion.io/x/onecloud/pkg/apis/compute"
@@ -39,6 +41,52 @@ func (self *SGuest) UpdateQgaStatus(status string) error {
 	return nil
 }
 
+// RequestFsFreeze freezes the guest filesystems once for all the disk
+// snapshots of an instance snapshot or backup, returns false if the guest
+// can't be quiesced and the disks are snapshotted crash consistent
+func (self *SGuest) RequestFsFreeze(ctx context.Context, header http.Header) bool {
+	if self.PowerStates != api.VM_POWER_STATES_ON {
+		return false
+	}
+	host, err := self.GetHost()
+	if err != nil {
+		log.Errorf("guest %s GetHost: %s", self.Name, err)
+		return false
+	}
+	drv, err := self.GetDriver()
+	if err != nil {
+		log.Errorf("guest %s GetDriver: %s", self.Name, err)
+		return false
+	}
+	frozen, err := drv.QgaRequestFsFreeze(ctx, header, host, self)
+	if err != nil {
+		log.Warningf("guest %s freeze filesystems: %s", self.Name, err)
+		return false
+	}
+	return frozen
+}
+
+// RequestFsThaw thaws the filesystems frozen by RequestFsFreeze, returns
+// whether they stayed frozen until now
+func (self *SGuest) RequestFsThaw(ctx context.Context, header http.Header) bool {
+	host, err := self.GetHost()
+	if err != nil {
+		log.Errorf("guest %s GetHost: %s", self.Name, err)
+		return false
+	}
+	drv, err := self.GetDriver()
+	if err != nil {
+		log.Errorf("guest %s GetDriver: %s", self.Name, err)
+		return false
+	}
+	quiesced, err := drv.QgaRequestFsThaw(ctx, header, host, self)
+	if err != nil {
+		log.Errorf("guest %s thaw filesystems: %s", self.Name, err)
+		return false
+	}
+	return quiesced
+}
+
 func (self *SGuest) PerformQgaSetPassword(
 	ctx context.Context,
 	userCred mcclient.TokenCredential,
@@ -0,0 +1,335 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/stringutils2"
+)
+
+// +onecloud:swagger-gen-model-singular=qos_policy
+// +onecloud:swagger-gen-model-plural=qos_policies
+type SQosPolicyManager struct {
+	db.SEnabledStatusInfrasResourceBaseManager
+}
+
+var QosPolicyManager *SQosPolicyManager
+
+func init() {
+	QosPolicyManager = &SQosPolicyManager{
+		SEnabledStatusInfrasResourceBaseManager: db.NewEnabledStatusInfrasResourceBaseManager(
+			SQosPolicy{},
+			"qos_policies_tbl",
+			"qos_policy",
+			"qos_policies",
+		),
+	}
+	QosPolicyManager.SetVirtualObject(QosPolicyManager)
+}
+
+// 网卡QoS策略, 可关联到虚拟机网卡, IP子网和弹性公网IP
+// ingress为进入虚拟机方向, egress为虚拟机发出方向
+// +onecloud:model-api-gen
+type SQosPolicy struct {
+	db.SEnabledStatusInfrasResourceBase
+
+	// 进入虚拟机方向带宽, 单位Mbps
+	IngressBandwidth int `nullable:"false" default:"0" list:"user" update:"domain" create:"domain_optional"`
+	// 进入虚拟机方向突发, 单位Mb
+	IngressBurst int `nullable:"false" default:"0" list:"user" update:"domain" create:"domain_optional"`
+	// 进入虚拟机方向包速率, 单位pps
+	IngressPps int `nullable:"false" default:"0" list:"user" update:"domain" create:"domain_optional"`
+
+	// 虚拟机发出方向带宽, 单位Mbps
+	EgressBandwidth int `nullable:"false" default:"0" list:"user" update:"domain" create:"domain_optional"`
+	// 虚拟机发出方向突发, 单位Mb
+	EgressBurst int `nullable:"false" default:"0" list:"user" update:"domain" create:"domain_optional"`
+	// 虚拟机发出方向包速率, 单位pps
+	EgressPps int `nullable:"false" default:"0" list:"user" update:"domain" create:"domain_optional"`
+
+	// 虚拟机发出的IP报文的DSCP标记, -1表示不修改
+	Dscp int `nullable:"false" default:"-1" list:"user" update:"domain" create:"domain_optional"`
+}
+
+func (manager *SQosPolicyManager) ListItemFilter(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.QosPolicyListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusInfrasResourceBaseManager.ListItemFilter(ctx, q, userCred, query.EnabledStatusInfrasResourceBaseListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SEnabledStatusInfrasResourceBaseManager.ListItemFilter")
+	}
+	return q, nil
+}
+
+func (manager *SQosPolicyManager) OrderByExtraFields(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.QosPolicyListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusInfrasResourceBaseManager.OrderByExtraFields(ctx, q, userCred, query.EnabledStatusInfrasResourceBaseListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SEnabledStatusInfrasResourceBaseManager.OrderByExtraFields")
+	}
+	return q, nil
+}
+
+func (manager *SQosPolicyManager) QueryDistinctExtraField(q *sqlchemy.SQuery, field string) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusInfrasResourceBaseManager.QueryDistinctExtraField(q, field)
+	if err == nil {
+		return q, nil
+	}
+	return q, httperrors.ErrNotFound
+}
+
+type sQosPolicyRefCount struct {
+	QosPolicyId string
+	RefCount    int
+}
+
+func (manager *SQosPolicyManager) fetchRefCounts(refManager db.IModelManager, idField string, policyIds []string) (map[string]int, error) {
+	sq := refManager.Query().In("qos_policy_id", policyIds).SubQuery()
+	cq := sq.Query(
+		sq.Field("qos_policy_id"),
+		sqlchemy.COUNT("ref_count", sq.Field(idField)),
+	)
+	cq = cq.GroupBy(cq.Field("qos_policy_id"))
+	counts := []sQosPolicyRefCount{}
+	err := cq.All(&counts)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]int{}
+	for _, c := range counts {
+		ret[c.QosPolicyId] = c.RefCount
+	}
+	return ret, nil
+}
+
+func (manager *SQosPolicyManager) FetchCustomizeColumns(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	objs []interface{},
+	fields stringutils2.SSortedStrings,
+	isList bool,
+) []api.QosPolicyDetails {
+	rows := make([]api.QosPolicyDetails, len(objs))
+	stdRows := manager.SEnabledStatusInfrasResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+	policyIds := make([]string, len(objs))
+	for i := range rows {
+		rows[i] = api.QosPolicyDetails{
+			EnabledStatusInfrasResourceBaseDetails: stdRows[i],
+		}
+		policyIds[i] = objs[i].(*SQosPolicy).Id
+	}
+	gnCounts, err := manager.fetchRefCounts(GuestnetworkManager, "row_id", policyIds)
+	if err != nil {
+		log.Errorf("fetch guestnetwork counts fail: %s", err)
+	}
+	netCounts, err := manager.fetchRefCounts(NetworkManager, "id", policyIds)
+	if err != nil {
+		log.Errorf("fetch network counts fail: %s", err)
+	}
+	eipCounts, err := manager.fetchRefCounts(ElasticipManager, "id", policyIds)
+	if err != nil {
+		log.Errorf("fetch elasticip counts fail: %s", err)
+	}
+	for i := range rows {
+		rows[i].GuestnetworkCount = gnCounts[policyIds[i]]
+		rows[i].NetworkCount = netCounts[policyIds[i]]
+		rows[i].ElasticipCount = eipCounts[policyIds[i]]
+	}
+	return rows
+}
+
+func (manager *SQosPolicyManager) ValidateCreateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	ownerId mcclient.IIdentityProvider,
+	query jsonutils.JSONObject,
+	input api.QosPolicyCreateInput,
+) (api.QosPolicyCreateInput, error) {
+	var err error
+	input.EnabledStatusInfrasResourceBaseCreateInput, err = manager.SEnabledStatusInfrasResourceBaseManager.ValidateCreateData(ctx, userCred, ownerId, query, input.EnabledStatusInfrasResourceBaseCreateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SEnabledStatusInfrasResourceBaseManager.ValidateCreateData")
+	}
+	err = api.ValidateQosPolicyParams([]*int{
+		&input.IngressBandwidth, &input.IngressBurst, &input.IngressPps,
+		&input.EgressBandwidth, &input.EgressBurst, &input.EgressPps,
+	}, input.Dscp)
+	if err != nil {
+		return input, err
+	}
+	if input.Dscp == nil {
+		dscp := api.QosPolicyDscpNone
+		input.Dscp = &dscp
+	}
+	input.Status = api.QOS_POLICY_STATUS_AVAILABLE
+	if input.Enabled == nil {
+		trueVal := true
+		input.Enabled = &trueVal
+	}
+	return input, nil
+}
+
+func (policy *SQosPolicy) ValidateUpdateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.QosPolicyUpdateInput,
+) (api.QosPolicyUpdateInput, error) {
+	var err error
+	input.EnabledStatusInfrasResourceBaseUpdateInput, err = policy.SEnabledStatusInfrasResourceBase.ValidateUpdateData(ctx, userCred, query, input.EnabledStatusInfrasResourceBaseUpdateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SEnabledStatusInfrasResourceBase.ValidateUpdateData")
+	}
+	err = api.ValidateQosPolicyParams([]*int{
+		input.IngressBandwidth, input.IngressBurst, input.IngressPps,
+		input.EgressBandwidth, input.EgressBurst, input.EgressPps,
+	}, input.Dscp)
+	if err != nil {
+		return input, err
+	}
+	if (input.IngressPps != nil && *input.IngressPps > 0) || (input.EgressPps != nil && *input.EgressPps > 0) {
+		cnt, err := ElasticipManager.Query().Equals("qos_policy_id", policy.Id).CountWithError()
+		if err != nil {
+			return input, errors.Wrap(err, "count elasticips")
+		}
+		if cnt > 0 {
+			return input, httperrors.NewNotSupportedError("qos policy is used by %d elasticips which don't enforce pps", cnt)
+		}
+	}
+	return input, nil
+}
+
+// hasPps reports whether the policy limits packet rate, which is realised
+// by host side of the vif and not enforced for elastic ips
+func (policy *SQosPolicy) hasPps() bool {
+	return policy.IngressPps > 0 || policy.EgressPps > 0
+}
+
+func (policy *SQosPolicy) PostUpdate(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) {
+	policy.SEnabledStatusInfrasResourceBase.PostUpdate(ctx, userCred, query, data)
+
+	// nics on networks with this policy inherit it unless they have one of
+	// their own
+	netq := NetworkManager.Query("id").Equals("qos_policy_id", policy.Id)
+	gnq := GuestnetworkManager.Query("guest_id")
+	gnq = gnq.Filter(sqlchemy.OR(
+		sqlchemy.Equals(gnq.Field("qos_policy_id"), policy.Id),
+		sqlchemy.AND(
+			sqlchemy.IsNullOrEmpty(gnq.Field("qos_policy_id")),
+			sqlchemy.In(gnq.Field("network_id"), netq.SubQuery()),
+		),
+	))
+	syncQosPolicyGuests(ctx, userCred, gnq)
+}
+
+// syncQosPolicyGuests pushes nic qos changes to hosts of running kvm guests.
+// Ovn backed nics are taken care of by vpcagent, while limits realised on
+// the host side still need a sync
+func syncQosPolicyGuests(ctx context.Context, userCred mcclient.TokenCredential, gnq *sqlchemy.SQuery) {
+	q := GuestManager.Query().In("id", gnq.Distinct().SubQuery())
+	q = q.Equals("hypervisor", api.HYPERVISOR_KVM).Equals("status", api.VM_RUNNING)
+	guests := []SGuest{}
+	err := db.FetchModelObjects(GuestManager, q, &guests)
+	if err != nil {
+		log.Errorf("fetch guests to sync qos policy: %v", err)
+		return
+	}
+	for i := range guests {
+		err := guests[i].StartSyncTask(ctx, userCred, false, "")
+		if err != nil {
+			log.Errorf("StartSyncTask for guest %s: %v", guests[i].Name, err)
+		}
+	}
+}
+
+func (policy *SQosPolicy) ValidateDeleteCondition(ctx context.Context, info jsonutils.JSONObject) error {
+	for _, m := range []db.IModelManager{GuestnetworkManager, NetworkManager, ElasticipManager} {
+		cnt, err := m.Query().Equals("qos_policy_id", policy.Id).CountWithError()
+		if err != nil {
+			return errors.Wrapf(err, "count %s", m.KeywordPlural())
+		}
+		if cnt > 0 {
+			return httperrors.NewNotEmptyError("qos policy is used by %d %s", cnt, m.KeywordPlural())
+		}
+	}
+	return policy.SEnabledStatusInfrasResourceBase.ValidateDeleteCondition(ctx, nil)
+}
+
+func (policy *SQosPolicy) GetDesc() *api.QosPolicyDesc {
+	return &api.QosPolicyDesc{
+		Id:               policy.Id,
+		IngressBandwidth: policy.IngressBandwidth,
+		IngressBurst:     policy.IngressBurst,
+		IngressPps:       policy.IngressPps,
+		EgressBandwidth:  policy.EgressBandwidth,
+		EgressBurst:      policy.EgressBurst,
+		EgressPps:        policy.EgressPps,
+		Dscp:             policy.Dscp,
+	}
+}
+
+// fetchQosPolicyId resolves the policy to associate, empty id means
+// disassociation
+func (manager *SQosPolicyManager) fetchQosPolicyId(ctx context.Context, userCred mcclient.TokenCredential, policyId string) (string, error) {
+	if len(policyId) == 0 {
+		return "", nil
+	}
+	obj, err := manager.FetchByIdOrName(ctx, userCred, policyId)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return "", httperrors.NewResourceNotFoundError2(manager.Keyword(), policyId)
+		}
+		return "", errors.Wrap(err, "QosPolicyManager.FetchByIdOrName")
+	}
+	return obj.GetId(), nil
+}
+
+// fetchEnabledQosPolicy returns nil if policy is missing or disabled
+func (manager *SQosPolicyManager) fetchEnabledQosPolicy(policyId string) *SQosPolicy {
+	if len(policyId) == 0 {
+		return nil
+	}
+	obj, err := manager.FetchById(policyId)
+	if err != nil {
+		if errors.Cause(err) != sql.ErrNoRows {
+			log.Errorf("fetch qos policy %s: %v", policyId, err)
+		}
+		return nil
+	}
+	policy := obj.(*SQosPolicy)
+	if !policy.GetEnabled() {
+		return nil
+	}
+	return policy
+}
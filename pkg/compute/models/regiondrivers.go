@@ -55,6 +55,7 @@ type IRegionDriver interface {
 	RequestSyncDiskBackupStatus(ctx context.Context, userCred mcclient.TokenCredential, backup *SDiskBackup, task taskman.ITask) error
 	RequestCreateBackup(ctx context.Context, backup *SDiskBackup, snapshotId string, task taskman.ITask) error
 	RequestDeleteBackup(ctx context.Context, backup *SDiskBackup, task taskman.ITask) error
+	RequestMergeBackup(ctx context.Context, base *SDiskBackup, into *SDiskBackup, task taskman.ITask) error
 	RequestCreateInstanceBackup(ctx context.Context, guest *SGuest, ib *SInstanceBackup, task taskman.ITask, params *jsonutils.JSONDict) error
 	RequestDeleteInstanceBackup(ctx context.Context, ib *SInstanceBackup, task taskman.ITask) error
 	RequestSyncInstanceBackupStatus(ctx context.Context, userCred mcclient.TokenCredential, ib *SInstanceBackup, task taskman.ITask) error
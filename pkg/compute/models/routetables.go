@@ -16,6 +16,7 @@ package models
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 
 	"yunion.io/x/cloudmux/pkg/cloudprovider"
@@ -24,6 +25,7 @@ import (
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/gotypes"
 	"yunion.io/x/pkg/util/compare"
+	"yunion.io/x/pkg/utils"
 	"yunion.io/x/sqlchemy"
 
 	api "yunion.io/x/onecloud/pkg/apis/compute"
@@ -62,6 +64,9 @@ type SRouteTable struct {
 
 	Type   string       `width:"16" charset:"ascii" nullable:"false" list:"user"`
 	Routes *api.SRoutes `list:"user" update:"user" create:"required"`
+
+	// 策略路由
+	Policies *api.SRoutePolicies `list:"user" update:"user" create:"optional"`
 }
 
 // VPC虚拟路由表列表
@@ -144,6 +149,68 @@ func (man *SRouteTableManager) validateRoutes(ctx context.Context, data *jsonuti
 	return data, nil
 }
 
+// validatePolicies checks route policies and resolves instance next hops to
+// guest ids.  Policy routes are only realized for vpcs managed by vpcagent
+func (man *SRouteTableManager) validatePolicies(ctx context.Context, userCred mcclient.TokenCredential, vpcId string, policies *api.SRoutePolicies) error {
+	if policies == nil || len(*policies) == 0 {
+		return nil
+	}
+	vpcObj, err := VpcManager.FetchById(vpcId)
+	if err != nil {
+		return errors.Wrapf(err, "VpcManager.FetchById %s", vpcId)
+	}
+	vpc := vpcObj.(*SVpc)
+	if !vpc.isOvnBacked() {
+		return errors.Wrapf(httperrors.ErrNotSupported, "route policies are not supported by vpc %s", vpc.Name)
+	}
+	if err := policies.Validate(); err != nil {
+		return err
+	}
+	for _, policy := range *policies {
+		if policy.NextHopType == api.NEXT_HOP_TYPE_NAT {
+			if vpc.ExternalAccessMode == api.VPC_EXTERNAL_ACCESS_MODE_NONE || len(vpc.ExternalAccessMode) == 0 {
+				return httperrors.NewInputParameterError("vpc %s has no external access for nat gateway next hop", vpc.Name)
+			}
+			continue
+		}
+		if policy.NextHopType != api.NEXT_HOP_TYPE_INSTANCE {
+			continue
+		}
+		guestObj, err := GuestManager.FetchByIdOrName(ctx, userCred, policy.NextHopId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return httperrors.NewResourceNotFoundError2(GuestManager.Keyword(), policy.NextHopId)
+			}
+			return errors.Wrap(err, "GuestManager.FetchByIdOrName")
+		}
+		guest := guestObj.(*SGuest)
+		gns, err := GuestnetworkManager.FetchByGuestId(guest.Id)
+		if err != nil {
+			return errors.Wrap(err, "GuestnetworkManager.FetchByGuestId")
+		}
+		inVpc := false
+		for i := range gns {
+			network, err := gns[i].GetNetwork()
+			if err != nil {
+				return errors.Wrapf(err, "GetNetwork of guest nic %s", gns[i].MacAddr)
+			}
+			gnVpc, err := network.GetVpc()
+			if err != nil {
+				return errors.Wrapf(err, "GetVpc of network %s", network.Name)
+			}
+			if gnVpc.Id == vpc.Id {
+				inVpc = true
+				break
+			}
+		}
+		if !inVpc {
+			return httperrors.NewInputParameterError("guest %s has no nic in vpc %s", guest.Name, vpc.Name)
+		}
+		policy.NextHopId = guest.Id
+	}
+	return nil
+}
+
 func (man *SRouteTableManager) ValidateCreateData(
 	ctx context.Context,
 	userCred mcclient.TokenCredential,
@@ -159,6 +226,10 @@ func (man *SRouteTableManager) ValidateCreateData(
 	if err != nil {
 		return input, err
 	}
+	err = man.validatePolicies(ctx, userCred, input.VpcId, input.Policies)
+	if err != nil {
+		return input, errors.Wrap(err, "validatePolicies")
+	}
 	input.StatusInfrasResourceBaseCreateInput, err = man.SStatusInfrasResourceBaseManager.ValidateCreateData(ctx, userCred, ownerId, query, input.StatusInfrasResourceBaseCreateInput)
 	if err != nil {
 		return input, errors.Wrap(err, "SStatusInfrasResourceBaseManager.ValidateCreateData")
@@ -217,6 +288,10 @@ func (rt *SRouteTable) ValidateUpdateData(
 	if err != nil {
 		return input, errors.Wrap(err, "RouteTableManager.validateRoutes")
 	}
+	err = RouteTableManager.validatePolicies(ctx, userCred, rt.VpcId, input.Policies)
+	if err != nil {
+		return input, errors.Wrap(err, "RouteTableManager.validatePolicies")
+	}
 	input.StatusInfrasResourceBaseUpdateInput, err = rt.SStatusInfrasResourceBase.ValidateUpdateData(ctx, userCred, query, input.StatusInfrasResourceBaseUpdateInput)
 	if err != nil {
 		return input, errors.Wrap(err, "SStatusInfrasResourceBase.ValidateUpdateData")
@@ -298,6 +373,65 @@ func (rt *SRouteTable) PerformDelRoutes(ctx context.Context, userCred mcclient.T
 	return nil, nil
 }
 
+// PerformAddPolicies adds route policies, policies of the same priority are
+// replaced.  This is intended mainly for command line operations.
+func (rt *SRouteTable) PerformAddPolicies(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.RouteTableAddPoliciesInput) (jsonutils.JSONObject, error) {
+	if len(input.Policies) == 0 {
+		return nil, httperrors.NewMissingParameterError("policies")
+	}
+	err := RouteTableManager.validatePolicies(ctx, userCred, rt.VpcId, &input.Policies)
+	if err != nil {
+		return nil, err
+	}
+	var policies api.SRoutePolicies
+	if rt.Policies != nil {
+		policies = *gotypes.DeepCopy(rt.Policies).(*api.SRoutePolicies)
+	}
+	for _, add := range input.Policies {
+		found := false
+		for i, policy := range policies {
+			if policy.Priority == add.Priority {
+				policies[i] = add
+				found = true
+				break
+			}
+		}
+		if !found {
+			policies = append(policies, add)
+		}
+	}
+	_, err = db.Update(rt, func() error {
+		rt.Policies = &policies
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (rt *SRouteTable) PerformDelPolicies(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.RouteTableDelPoliciesInput) (jsonutils.JSONObject, error) {
+	if len(input.Priorities) == 0 {
+		return nil, httperrors.NewMissingParameterError("priorities")
+	}
+	var policies api.SRoutePolicies
+	if rt.Policies != nil {
+		for _, policy := range *rt.Policies {
+			if !utils.IsInArray(policy.Priority, input.Priorities) {
+				policies = append(policies, policy)
+			}
+		}
+	}
+	_, err := db.Update(rt, func() error {
+		rt.Policies = &policies
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
 func (manager *SRouteTableManager) FetchCustomizeColumns(
 	ctx context.Context,
 	userCred mcclient.TokenCredential,
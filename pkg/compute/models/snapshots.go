@@ -90,6 +90,11 @@ type SSnapshot struct {
 	BackingDiskId string    `width:"36" charset:"ascii" nullable:"true" default:""`
 	DiskBackupId  string    `width:"36" charset:"ascii" nullable:"true" default:""`
 	ExpiredAt     time.Time `nullable:"true" list:"user" create:"optional"`
+
+	// 是否通过guest agent冻结文件系统创建一致性快照
+	Consistent bool `nullable:"false" default:"false" list:"user" create:"optional"`
+	// 创建快照时文件系统是否已成功冻结
+	Quiesced bool `nullable:"false" default:"false" list:"user"`
 }
 
 var SnapshotManager *SSnapshotManager
@@ -670,7 +675,7 @@ func (self *SSnapshotManager) GetDiskSnapshotCount(diskId string) (int, error) {
 }
 
 func (self *SSnapshotManager) CreateSnapshot(ctx context.Context, owner mcclient.IIdentityProvider,
-	createdBy, diskId, guestId, location, name string, retentionDay int, isSystem bool, diskBackupId string) (*SSnapshot, error) {
+	createdBy, diskId, guestId, location, name string, retentionDay int, isSystem bool, diskBackupId string, consistent bool) (*SSnapshot, error) {
 	iDisk, err := DiskManager.FetchById(diskId)
 	if err != nil {
 		return nil, err
@@ -709,6 +714,7 @@ func (self *SSnapshotManager) CreateSnapshot(ctx context.Context, owner mcclient
 	}
 	snapshot.IsSystem = isSystem
 	snapshot.DiskBackupId = diskBackupId
+	snapshot.Consistent = consistent
 	err = SnapshotManager.TableSpec().Insert(ctx, snapshot)
 	if err != nil {
 		return nil, err
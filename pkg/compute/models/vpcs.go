@@ -262,6 +262,11 @@ func (svpc *SVpc) ValidateDeleteCondition(ctx context.Context, info *api.VpcDeta
 	return svpc.SEnabledStatusInfrasResourceBase.ValidateDeleteCondition(ctx, nil)
 }
 
+// vpc是否由vpcagent通过ovn实现
+func (svpc *SVpc) isOvnBacked() bool {
+	return svpc.Id != api.DEFAULT_VPC_ID && !svpc.IsManaged()
+}
+
 func (svpc *SVpc) getWireQuery() *sqlchemy.SQuery {
 	wires := WireManager.Query()
 	if svpc.Id == api.DEFAULT_VPC_ID {
@@ -805,7 +805,7 @@ func (self *SKVMRegionDriver) RequestCreateInstanceSnapshot(ctx context.Context,
 
 		return models.SnapshotManager.CreateSnapshot(
 			ctx, task.GetUserCred(), api.SNAPSHOT_MANUAL, disks[diskIndex].DiskId,
-			guest.Id, "", snapshotName, -1, false, "")
+			guest.Id, "", snapshotName, -1, false, "", isp.Consistent)
 	}()
 	if err != nil {
 		return err
@@ -916,7 +916,7 @@ func (self *SKVMRegionDriver) RequestCreateInstanceBackup(ctx context.Context, g
 				return nil, errors.Wrap(err, "Generate diskbackup name")
 			}
 
-			return models.DiskBackupManager.CreateBackup(ctx, task.GetUserCred(), disk.DiskId, ib.BackupStorageId, diskBackupName)
+			return models.DiskBackupManager.CreateBackup(ctx, task.GetUserCred(), disk.DiskId, ib.BackupStorageId, diskBackupName, ib.Consistent)
 		}()
 		if err != nil {
 			return err
@@ -1314,6 +1314,14 @@ func (self *SKVMRegionDriver) RequestDeleteBackup(ctx context.Context, backup *m
 	body := jsonutils.NewDict()
 	body.Set("backup_id", jsonutils.NewString(backup.GetId()))
 	body.Set("backup_storage_id", jsonutils.NewString(backupStorage.GetId()))
+	if len(backup.ChainId) > 0 {
+		chainBackupIds, err := backup.GetOtherChainBackupIds()
+		if err != nil {
+			return errors.Wrap(err, "GetOtherChainBackupIds")
+		}
+		body.Set("chain_id", jsonutils.NewString(backup.ChainId))
+		body.Set("chain_backup_ids", jsonutils.NewStringArray(chainBackupIds))
+	}
 	accessInfo, err := backupStorage.GetAccessInfo()
 	if err != nil {
 		return errors.Wrap(err, "GetAccessInfo")
@@ -1327,6 +1335,40 @@ func (self *SKVMRegionDriver) RequestDeleteBackup(ctx context.Context, backup *m
 	return nil
 }
 
+func (self *SKVMRegionDriver) RequestMergeBackup(ctx context.Context, base *models.SDiskBackup, into *models.SDiskBackup, task taskman.ITask) error {
+	backupStorage, err := base.GetBackupStorage()
+	if err != nil {
+		return errors.Wrap(err, "unable to get backupStorage")
+	}
+	host, err := models.HostManager.GetEnabledKvmHostForDiskBackup(base)
+	if err != nil {
+		return errors.Wrap(err, "GetEnabledKvmHostForDiskBackup")
+	}
+	chainBackupIds, err := base.GetOtherChainBackupIds(into.Id)
+	if err != nil {
+		return errors.Wrap(err, "GetOtherChainBackupIds")
+	}
+
+	url := fmt.Sprintf("%s/storages/merge-backup", host.ManagerUri)
+	body := jsonutils.NewDict()
+	body.Set("backup_id", jsonutils.NewString(base.GetId()))
+	body.Set("into_backup_id", jsonutils.NewString(into.GetId()))
+	body.Set("chain_id", jsonutils.NewString(base.ChainId))
+	body.Set("chain_backup_ids", jsonutils.NewStringArray(chainBackupIds))
+	body.Set("backup_storage_id", jsonutils.NewString(backupStorage.GetId()))
+	accessInfo, err := backupStorage.GetAccessInfo()
+	if err != nil {
+		return errors.Wrap(err, "GetAccessInfo")
+	}
+	body.Set("backup_storage_access_info", jsonutils.Marshal(accessInfo))
+	header := task.GetTaskRequestHeader()
+	_, _, err = httputils.JSONRequest(httputils.GetDefaultClient(), ctx, "POST", url, header, body, false)
+	if err != nil {
+		return errors.Wrap(err, "unable to merge backup")
+	}
+	return nil
+}
+
 func (self *SKVMRegionDriver) RequestCreateBackup(ctx context.Context, backup *models.SDiskBackup, snapshotId string, task taskman.ITask) error {
 	backupStorage, err := backup.GetBackupStorage()
 	if err != nil {
@@ -1358,6 +1400,12 @@ func (self *SKVMRegionDriver) RequestCreateBackup(ctx context.Context, backup *m
 	}
 	body.Set("backup_id", jsonutils.NewString(backup.GetId()))
 	body.Set("backup_storage_id", jsonutils.NewString(backupStorage.GetId()))
+	if len(backup.ChainId) > 0 {
+		body.Set("chain_id", jsonutils.NewString(backup.ChainId))
+		if len(backup.ParentBackupId) > 0 {
+			body.Set("parent_backup_id", jsonutils.NewString(backup.ParentBackupId))
+		}
+	}
 	accessInfo, err := backupStorage.GetAccessInfo()
 	if err != nil {
 		return errors.Wrap(err, "GetAccessInfo")
@@ -243,6 +243,10 @@ func InitHandlers(app *appsrv.Application) {
 		models.NetTapServiceManager,
 		models.NetTapFlowManager,
 
+		models.FlowLogManager,
+		models.NetworkAclManager,
+		models.QosPolicyManager,
+
 		models.ModelartsPoolManager,
 		models.ModelartsPoolSkuManager,
 
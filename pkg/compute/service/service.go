@@ -217,6 +217,7 @@ func StartServiceWithJobsAndApp(jobs func(cron *cronman.SCronJobManager), appCll
 			"CleanRecycleDiskFiles", 1, 3, 0, 0, models.StoragesCleanRecycleDiskfiles, false)
 
 		cron.AddJobAtIntervalsWithStartRun("TaskCleanupJob", time.Duration(options.Options.TaskArchiveIntervalMinutes)*time.Minute, taskman.TaskManager.TaskCleanupJob, true)
+		cron.AddJobAtIntervals("TaskTimeoutJob", time.Minute, taskman.TaskManager.TaskTimeoutJob)
 
 		if jobs != nil {
 			jobs(cron)
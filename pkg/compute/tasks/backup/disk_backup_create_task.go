@@ -17,6 +17,7 @@ package backup
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
@@ -37,7 +38,27 @@ type DiskBackupCreateTask struct {
 }
 
 func init() {
-	taskman.RegisterTask(DiskBackupCreateTask{})
+	taskman.RegisterTask(DiskBackupCreateTask{},
+		taskman.WithStageTimeout(time.Hour, "OnSnapshot", "OnCleanupSnapshot"),
+		taskman.WithStageTimeout(24*time.Hour, "OnSave"),
+	)
+}
+
+// OnCancel marks the backup failed at the step it was cancelled, the failed
+// handler of the stage then cleans up the snapshot
+func (self *DiskBackupCreateTask) OnCancel(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	backup := obj.(*models.SDiskBackup)
+	status := api.BACKUP_STATUS_CREATE_FAILED
+	switch backup.Status {
+	case api.BACKUP_STATUS_SNAPSHOT:
+		status = api.BACKUP_STATUS_SNAPSHOT_FAILED
+	case api.BACKUP_STATUS_SAVING:
+		status = api.BACKUP_STATUS_SAVE_FAILED
+	case api.BACKUP_STATUS_CLEANUP_SNAPSHOT:
+		status = api.BACKUP_STATUS_CLEANUP_SNAPSHOT_FAILED
+	}
+	reason, _ := data.GetString("__reason__")
+	backup.SetStatus(ctx, self.UserCred, status, fmt.Sprintf("cancelled: %s", reason))
 }
 
 func (self *DiskBackupCreateTask) taskFailed(ctx context.Context, backup *models.SDiskBackup, reason jsonutils.JSONObject, status string) {
@@ -67,6 +88,9 @@ func (self *DiskBackupCreateTask) taksSuccess(ctx context.Context, backup *model
 		Action: notifyclient.ActionCreate,
 	})
 	self.SetStageComplete(ctx, data)
+	if _, err := backup.StartChainRetentionTask(ctx, self.UserCred, ""); err != nil {
+		log.Errorf("unable to start retention of backup chain %s: %s", backup.ChainId, err)
+	}
 }
 
 func (self *DiskBackupCreateTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
@@ -93,6 +117,21 @@ func (self *DiskBackupCreateTask) OnInit(ctx context.Context, obj db.IStandalone
 
 func (self *DiskBackupCreateTask) OnSnapshot(ctx context.Context, backup *models.SDiskBackup, data jsonutils.JSONObject) {
 	snapshotId, _ := self.Params.GetString("snapshot_id")
+	if backup.Consistent {
+		snapshot, err := models.SnapshotManager.FetchById(snapshotId)
+		if err != nil {
+			self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()), api.BACKUP_STATUS_SNAPSHOT_FAILED)
+			return
+		}
+		_, err = db.Update(backup, func() error {
+			backup.Quiesced = snapshot.(*models.SSnapshot).Quiesced
+			return nil
+		})
+		if err != nil {
+			self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()), api.BACKUP_STATUS_SNAPSHOT_FAILED)
+			return
+		}
+	}
 	if self.Params.Contains("only_snapshot") {
 		p := jsonutils.NewDict()
 		p.Set("snapshot_id", jsonutils.NewString(snapshotId))
@@ -196,7 +235,7 @@ func (self *DiskBackupCreateTask) CreateSnapshot(ctx context.Context, diskBackup
 
 		return models.SnapshotManager.CreateSnapshot(
 			ctx, self.GetUserCred(), api.SNAPSHOT_MANUAL, disk.GetId(),
-			guest.Id, "", snapshotName, -1, true, diskBackup.GetId())
+			guest.Id, "", snapshotName, -1, true, diskBackup.GetId(), diskBackup.Consistent)
 	}()
 	if err != nil {
 		return nil, errors.Wrapf(err, "unable to create snapshot of disk %s", disk.GetId())
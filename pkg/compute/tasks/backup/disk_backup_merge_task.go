@@ -0,0 +1,105 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+// DiskBackupMergeTask folds the full backup of an incremental chain into its
+// only child, the child becomes the new full backup of the chain
+type DiskBackupMergeTask struct {
+	taskman.STask
+}
+
+func init() {
+	taskman.RegisterTask(DiskBackupMergeTask{})
+}
+
+func (self *DiskBackupMergeTask) taskFailed(ctx context.Context, backup *models.SDiskBackup, reason jsonutils.JSONObject) {
+	reasonStr, _ := reason.GetString()
+	backup.SetStatus(ctx, self.UserCred, api.BACKUP_STATUS_READY, reasonStr)
+	logclient.AddActionLogWithStartable(self, backup, logclient.ACT_MERGE, reason, self.UserCred, false)
+	self.SetStageFailed(ctx, reason)
+}
+
+func (self *DiskBackupMergeTask) getIntoBackup() (*models.SDiskBackup, error) {
+	intoId, _ := self.Params.GetString("into_backup_id")
+	obj, err := models.DiskBackupManager.FetchById(intoId)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*models.SDiskBackup), nil
+}
+
+func (self *DiskBackupMergeTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	backup := obj.(*models.SDiskBackup)
+	into, err := self.getIntoBackup()
+	if err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()))
+		return
+	}
+	self.SetStage("OnMerge", nil)
+	rd, err := backup.GetRegionDriver()
+	if err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()))
+		return
+	}
+	if err := rd.RequestMergeBackup(ctx, backup, into, self); err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()))
+	}
+}
+
+func (self *DiskBackupMergeTask) OnMerge(ctx context.Context, backup *models.SDiskBackup, data jsonutils.JSONObject) {
+	into, err := self.getIntoBackup()
+	if err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()))
+		return
+	}
+	_, err = db.Update(into, func() error {
+		into.ParentBackupId = backup.ParentBackupId
+		return nil
+	})
+	if err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()))
+		return
+	}
+	logclient.AddActionLogWithStartable(self, into, logclient.ACT_MERGE_FROM, backup.GetShortDesc(ctx), self.UserCred, true)
+	backup.RealDelete(ctx, self.UserCred)
+	self.SetStageComplete(ctx, nil)
+
+	leafId, _ := self.Params.GetString("leaf_backup_id")
+	leaf, err := models.DiskBackupManager.FetchById(leafId)
+	if err != nil {
+		log.Errorf("unable to fetch backup %s: %s", leafId, err)
+		return
+	}
+	if _, err := leaf.(*models.SDiskBackup).StartChainRetentionTask(ctx, self.UserCred, ""); err != nil {
+		log.Errorf("unable to start retention of backup chain %s: %s", backup.ChainId, err)
+	}
+}
+
+func (self *DiskBackupMergeTask) OnMergeFailed(ctx context.Context, backup *models.SDiskBackup, data jsonutils.JSONObject) {
+	self.taskFailed(ctx, backup, data)
+}
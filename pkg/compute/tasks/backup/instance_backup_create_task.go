@@ -37,7 +37,32 @@ func init() {
 	taskman.RegisterTask(InstanceBackupCreateTask{})
 }
 
+// thawFilesystems thaws the guest frozen for all the disk snapshots and
+// records whether the instance backup is quiesced
+func (self *InstanceBackupCreateTask) thawFilesystems(ctx context.Context, ib *models.SInstanceBackup, guest *models.SGuest) {
+	if !jsonutils.QueryBoolean(self.Params, "fs_frozen", false) {
+		return
+	}
+	params := jsonutils.NewDict()
+	params.Set("fs_frozen", jsonutils.JSONFalse)
+	self.SaveParams(params)
+	if guest == nil {
+		guest = models.GuestManager.FetchGuestById(ib.GuestId)
+	}
+	quiesced := guest.RequestFsThaw(ctx, self.GetTaskRequestHeader())
+	if !quiesced {
+		log.Warningf("instance backup %s is not quiesced, only crash consistent", ib.Name)
+	}
+	if _, err := db.Update(ib, func() error {
+		ib.Quiesced = quiesced
+		return nil
+	}); err != nil {
+		log.Errorf("update quiesced of instance backup %s: %s", ib.Name, err)
+	}
+}
+
 func (self *InstanceBackupCreateTask) taskFailed(ctx context.Context, ib *models.SInstanceBackup, guest *models.SGuest, reason jsonutils.JSONObject, status string) {
+	self.thawFilesystems(ctx, ib, guest)
 	if guest != nil {
 		guest.SetStatus(ctx, self.UserCred, compute.VM_INSTANCE_BACKUP_FAILED, reason.String())
 	}
@@ -61,6 +86,12 @@ func (self *InstanceBackupCreateTask) OnInit(ctx context.Context, obj db.IStanda
 	ib := obj.(*models.SInstanceBackup)
 	self.SetStage("OnInstanceBackup", nil)
 	guest := models.GuestManager.FetchGuestById(ib.GuestId)
+	if ib.Consistent {
+		// freeze once for all the disks, the snapshots of the disks are consistent with each other
+		params := jsonutils.NewDict()
+		params.Set("fs_frozen", jsonutils.NewBool(guest.RequestFsFreeze(ctx, self.GetTaskRequestHeader())))
+		self.SaveParams(params)
+	}
 	params := jsonutils.NewDict()
 	ib.SetStatus(ctx, self.GetUserCred(), compute.INSTANCE_BACKUP_STATUS_SNAPSHOT, "")
 	if err := ib.GetRegionDriver().RequestCreateInstanceBackup(ctx, guest, ib, self, params); err != nil {
@@ -71,6 +102,7 @@ func (self *InstanceBackupCreateTask) OnInit(ctx context.Context, obj db.IStanda
 func (self *InstanceBackupCreateTask) OnKvmDisksSnapshot(ctx context.Context, ib *models.SInstanceBackup, data jsonutils.JSONObject) {
 	subTasks := taskman.SubTaskManager.GetSubtasks(self.Id, "OnKvmDisksSnapshot", "")
 	guest := models.GuestManager.FetchGuestById(ib.GuestId)
+	self.thawFilesystems(ctx, ib, guest)
 	self.SetStage("OnInstanceBackup", nil)
 	for i := range subTasks {
 		log.Infof("subsTask %s result: %s", subTasks[i].SubtaskId, subTasks[i].Result)
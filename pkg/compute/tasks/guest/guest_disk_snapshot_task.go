@@ -83,10 +83,15 @@ func (self *GuestDiskSnapshotTask) OnDiskSnapshotComplete(ctx context.Context, g
 	if snapshot.DiskType == compute.DISK_TYPE_SYS {
 		osType = guest.GetOS()
 	}
+	quiesced := jsonutils.QueryBoolean(res, "quiesced", false)
+	if snapshot.Consistent && !quiesced {
+		log.Warningf("snapshot %s is not quiesced, only crash consistent", snapshot.Name)
+	}
 	_, err = db.Update(snapshot, func() error {
 		snapshot.Location = location
 		snapshot.Status = api.SNAPSHOT_READY
 		snapshot.OsType = osType
+		snapshot.Quiesced = quiesced
 		return nil
 	})
 	if err != nil {
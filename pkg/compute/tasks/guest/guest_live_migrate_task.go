@@ -90,6 +90,11 @@ func (task *GuestMigrateTask) GetSchedParams() (*schedapi.ScheduleInput, error)
 		input.SkipKernelCheck = skipKernelCheck
 	}
 	res := guest.GetSchedMigrateParams(task.GetUserCred(), input)
+	if task.isCrossRegion() {
+		if err := task.setCrossRegionSchedParams(res); err != nil {
+			return nil, errors.Wrap(err, "setCrossRegionSchedParams")
+		}
+	}
 
 	if devs, _ := guest.GetIsolatedDevices(); len(devs) > 0 {
 		preferNumaNodesSet := cpuset.NewBuilder()
@@ -103,6 +108,48 @@ func (task *GuestMigrateTask) GetSchedParams() (*schedapi.ScheduleInput, error)
 	return res, nil
 }
 
+func (task *GuestMigrateTask) isCrossRegion() bool {
+	return jsonutils.QueryBoolean(task.Params, "cross_region", false)
+}
+
+func (task *GuestMigrateTask) getNetworkRemaps() ([]api.GuestNetworkRemap, error) {
+	remaps := []api.GuestNetworkRemap{}
+	if err := task.Params.Unmarshal(&remaps, "network_remaps"); err != nil {
+		return nil, errors.Wrap(err, "unmarshal network_remaps")
+	}
+	return remaps, nil
+}
+
+func (task *GuestMigrateTask) isRemapAddressChanged() bool {
+	remaps, _ := task.getNetworkRemaps()
+	for i := range remaps {
+		if remaps[i].Address != remaps[i].SourceIpAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// setCrossRegionSchedParams schedules to target region with remapped networks,
+// target addresses have been reserved before the task started
+func (task *GuestMigrateTask) setCrossRegionSchedParams(input *schedapi.ScheduleInput) error {
+	remaps, err := task.getNetworkRemaps()
+	if err != nil {
+		return err
+	}
+	input.PreferRegion, _ = task.Params.GetString("prefer_region_id")
+	input.PreferZone, _ = task.Params.GetString("prefer_zone_id")
+	input.Networks = make([]*api.NetworkConfig, 0, len(remaps))
+	for i := range remaps {
+		input.Networks = append(input.Networks, &api.NetworkConfig{
+			Network: remaps[i].NetworkId,
+			Address: remaps[i].Address,
+			Mac:     remaps[i].MacAddr,
+		})
+	}
+	return nil
+}
+
 func (task *GuestMigrateTask) OnStartSchedule(obj taskutils.IScheduleModel) {
 	guest := obj.(*models.SGuest)
 	guestStatus, _ := task.Params.GetString("guest_status")
@@ -138,6 +185,14 @@ func (task *GuestMigrateTask) SaveScheduleResult(ctx context.Context, obj taskut
 		task.TaskFailed(ctx, guest, jsonutils.NewString("target host not found?"))
 		return
 	}
+	if task.isCrossRegion() {
+		regionId, _ := task.Params.GetString("prefer_region_id")
+		region, err := targetHost.GetRegion()
+		if err != nil || region.Id != regionId {
+			task.TaskFailed(ctx, guest, jsonutils.NewString(fmt.Sprintf("target host %s not in region %s", targetHost.Name, regionId)))
+			return
+		}
+	}
 
 	body := jsonutils.NewDict()
 	body.Set("target_host_id", jsonutils.NewString(targetHostId))
@@ -418,7 +473,11 @@ func (task *GuestMigrateTask) OnMigrateConfAndDiskComplete(ctx context.Context,
 
 func (task *GuestMigrateTask) OnNormalMigrateComplete(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
 	oldHostId := guest.HostId
-	task.setGuest(ctx, guest)
+	err := task.setGuest(ctx, guest)
+	if err != nil && task.isCrossRegion() {
+		task.TaskFailed(ctx, guest, jsonutils.NewString(err.Error()))
+		return
+	}
 	guestStatus, _ := task.Params.GetString("guest_status")
 	guest.SetStatus(ctx, task.UserCred, guestStatus, "")
 	if task.isRescueMode() {
@@ -432,6 +491,23 @@ func (task *GuestMigrateTask) OnNormalMigrateComplete(ctx context.Context, guest
 
 // Server migrate complete
 func (task *GuestMigrateTask) OnUndeployOldHostSucc(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	if task.isCrossRegion() && task.isRemapAddressChanged() {
+		// write new addresses into guest os before it boots in target region
+		task.SetStage("OnCrossRegionDeployComplete", nil)
+		err := guest.StartGuestDeployTask(ctx, task.UserCred, nil, "deploy", task.GetTaskId())
+		if err != nil {
+			task.TaskFailed(ctx, guest, jsonutils.NewString(err.Error()))
+		}
+		return
+	}
+	task.OnCrossRegionDeployComplete(ctx, guest, data)
+}
+
+func (task *GuestMigrateTask) OnCrossRegionDeployComplete(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	if guest.Status == api.VM_DEPLOYING {
+		guestStatus, _ := task.Params.GetString("guest_status")
+		guest.SetStatus(ctx, task.UserCred, guestStatus, "")
+	}
 	if jsonutils.QueryBoolean(task.Params, "auto_start", false) {
 		task.SetStage("OnGuestStartSucc", nil)
 		guest.StartGueststartTask(ctx, task.UserCred, nil, task.GetId())
@@ -440,6 +516,10 @@ func (task *GuestMigrateTask) OnUndeployOldHostSucc(ctx context.Context, guest *
 	}
 }
 
+func (task *GuestMigrateTask) OnCrossRegionDeployCompleteFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
+	task.TaskFailed(ctx, guest, data)
+}
+
 func (task *GuestMigrateTask) OnUndeployOldHostSuccFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
 	task.TaskFailed(ctx, guest, data)
 }
@@ -567,6 +647,15 @@ func (task *GuestMigrateTask) localStorageMigrateConf(ctx context.Context,
 	if len(targetDesc.Disks) == 0 {
 		return nil, errors.Errorf("Get disksDesc error")
 	}
+	if task.isCrossRegion() {
+		remaps, err := task.getNetworkRemaps()
+		if err != nil {
+			return nil, err
+		}
+		if err := guest.RemapNicsJsonDesc(ctx, targetHost, targetDesc, remaps); err != nil {
+			return nil, errors.Wrap(err, "RemapNicsJsonDesc")
+		}
+	}
 	if task.Params.Contains("target_cpu_numa_pin") {
 		if err := task.setCpuNumaPin(targetDesc); err != nil {
 			return nil, errors.Wrap(err, "setCpuNumaPin")
@@ -655,7 +744,7 @@ func (task *GuestLiveMigrateTask) OnStartDestCompleteFailed(ctx context.Context,
 
 func (task *GuestMigrateTask) setGuest(ctx context.Context, guest *models.SGuest) error {
 	targetHostId, _ := task.Params.GetString("target_host_id")
-	if jsonutils.QueryBoolean(task.Params, "is_local_storage", false) {
+	if jsonutils.QueryBoolean(task.Params, "is_local_storage", false) && !task.isCrossRegion() {
 		targetStorages, _ := task.Params.GetArray("target_storages")
 		disks, _ := guest.GetDisks()
 		for i := 0; i < len(disks); i++ {
@@ -697,6 +786,10 @@ func (task *GuestMigrateTask) setGuest(ctx context.Context, guest *models.SGuest
 		}
 	}
 
+	if task.isCrossRegion() {
+		return task.handoverCrossRegion(ctx, guest, targetHostId)
+	}
+
 	oldHost, _ := guest.GetHost()
 	oldHost.ClearSchedDescCache()
 	err := guest.OnScheduleToHost(ctx, task.UserCred, targetHostId)
@@ -706,6 +799,33 @@ func (task *GuestMigrateTask) setGuest(ctx context.Context, guest *models.SGuest
 	return nil
 }
 
+// handoverCrossRegion moves guest, its disks, nics and reserved addresses
+// to the target region at once, the source stays intact on failure
+func (task *GuestMigrateTask) handoverCrossRegion(ctx context.Context, guest *models.SGuest, targetHostId string) error {
+	remaps, err := task.getNetworkRemaps()
+	if err != nil {
+		return err
+	}
+	disks, err := guest.GetDisks()
+	if err != nil {
+		return errors.Wrap(err, "GetDisks")
+	}
+	diskStorages := map[string]string{}
+	targetStorages, _ := task.Params.GetArray("target_storages")
+	isLocalStorage := jsonutils.QueryBoolean(task.Params, "is_local_storage", false)
+	for i := range disks {
+		diskStorages[disks[i].Id] = disks[i].StorageId
+		if isLocalStorage && i < len(targetStorages) {
+			diskStorages[disks[i].Id], _ = targetStorages[i].GetString()
+		}
+	}
+	srcRegionId, _ := task.Params.GetString("source_region_id")
+	if err := guest.HandoverCrossRegion(ctx, task.UserCred, srcRegionId, targetHostId, diskStorages, remaps); err != nil {
+		return errors.Wrap(err, "HandoverCrossRegion")
+	}
+	return nil
+}
+
 func (task *GuestLiveMigrateTask) OnLiveMigrateCompleteFailed(ctx context.Context, guest *models.SGuest, data jsonutils.JSONObject) {
 	if reason, _ := data.GetString("__reason__"); reason == "cancelled" {
 		task.Params.Set("migrate_cancelled", jsonutils.JSONTrue)
@@ -791,6 +911,7 @@ func (task *GuestLiveMigrateTask) OnResumeDestGuestComplete(ctx context.Context,
 	err := task.setGuest(ctx, guest)
 	if err != nil {
 		task.TaskFailed(ctx, guest, jsonutils.NewString(err.Error()))
+		return
 	}
 	task.SetStage("OnUndeploySrcGuestComplete", nil)
 	err = guest.StartUndeployGuestTask(ctx, task.UserCred, task.GetTaskId(), oldHostId)
@@ -859,6 +980,12 @@ func (task *GuestMigrateTask) TaskFailed(ctx context.Context, guest *models.SGue
 }
 
 func (task *GuestMigrateTask) markFailed(ctx context.Context, guest *models.SGuest, reason jsonutils.JSONObject) {
+	if task.isCrossRegion() {
+		// the handover transaction consumes the reservations on commit and
+		// leaves them untouched on rollback, so only unused ones are left here
+		remaps, _ := task.getNetworkRemaps()
+		guest.ReleaseRemapAddresses(ctx, task.UserCred, remaps)
+	}
 	guest.SetStatus(ctx, task.UserCred, api.VM_MIGRATE_FAILED, reason.String())
 	db.OpsLog.LogEvent(guest, db.ACT_MIGRATE_FAIL, reason, task.UserCred)
 	logclient.AddActionLogWithContext(ctx, guest, logclient.ACT_MIGRATE, reason, task.UserCred, false)
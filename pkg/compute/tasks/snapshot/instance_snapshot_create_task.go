@@ -18,6 +18,7 @@ import (
 	"context"
 
 	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
 
 	"yunion.io/x/onecloud/pkg/apis/compute"
 	hostapi "yunion.io/x/onecloud/pkg/apis/host"
@@ -56,6 +57,7 @@ func (self *InstanceSnapshotCreateTask) taskFail(
 	if guest == nil {
 		guest = models.GuestManager.FetchGuestById(isp.GuestId)
 	}
+	self.thawFilesystems(ctx, isp, guest)
 	isp.SetStatus(ctx, self.UserCred, compute.INSTANCE_SNAPSHOT_FAILED, reason.String())
 	guest.SetStatus(ctx, self.UserCred, compute.VM_INSTANCE_SNAPSHOT_FAILED, reason.String())
 
@@ -84,11 +86,38 @@ func (self *InstanceSnapshotCreateTask) taskComplete(
 	self.SetStageComplete(ctx, nil)
 }
 
+// thawFilesystems thaws the guest frozen for all the disk snapshots and
+// records whether the instance snapshot is quiesced
+func (self *InstanceSnapshotCreateTask) thawFilesystems(ctx context.Context, isp *models.SInstanceSnapshot, guest *models.SGuest) {
+	if !jsonutils.QueryBoolean(self.Params, "fs_frozen", false) {
+		return
+	}
+	params := jsonutils.NewDict()
+	params.Set("fs_frozen", jsonutils.JSONFalse)
+	self.SaveParams(params)
+	quiesced := guest.RequestFsThaw(ctx, self.GetTaskRequestHeader())
+	if !quiesced {
+		log.Warningf("instance snapshot %s is not quiesced, only crash consistent", isp.Name)
+	}
+	if _, err := db.Update(isp, func() error {
+		isp.Quiesced = quiesced
+		return nil
+	}); err != nil {
+		log.Errorf("update quiesced of instance snapshot %s: %s", isp.Name, err)
+	}
+}
+
 func (self *InstanceSnapshotCreateTask) OnInit(
 	ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
 
 	isp := obj.(*models.SInstanceSnapshot)
 	guest := models.GuestManager.FetchGuestById(isp.GuestId)
+	if isp.Consistent {
+		// freeze once for all the disks, the snapshots of the disks are consistent with each other
+		params := jsonutils.NewDict()
+		params.Set("fs_frozen", jsonutils.NewBool(guest.RequestFsFreeze(ctx, self.GetTaskRequestHeader())))
+		self.SaveParams(params)
+	}
 	self.SetStage("OnInstanceSnapshot", nil)
 	params := jsonutils.NewDict()
 	params.Set("disk_index", jsonutils.NewInt(0))
@@ -109,6 +138,9 @@ func (self *InstanceSnapshotCreateTask) OnKvmDiskSnapshot(
 		return
 	}
 
+	if disks, _ := guest.GetGuestDisks(); int(diskIndex+1) >= len(disks) {
+		self.thawFilesystems(ctx, isp, guest)
+	}
 	params := jsonutils.NewDict()
 	params.Set("disk_index", jsonutils.NewInt(diskIndex+1))
 	if err := isp.GetRegionDriver().RequestCreateInstanceSnapshot(ctx, guest, isp, self, params); err != nil {
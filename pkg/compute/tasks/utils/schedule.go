@@ -20,6 +20,7 @@ import (
 	"sort"
 
 	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
 
 	api "yunion.io/x/onecloud/pkg/apis/compute"
 	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
@@ -152,6 +153,10 @@ func doScheduleObjects(
 		onSchedulerRequestFail(ctx, task, objs, jsonutils.NewString(err.Error()))
 		return
 	}
+	if schedInput.AllOrNothing && len(objs) > 0 {
+		onAllOrNothingSchedulerResults(ctx, task, objs, output.Candidates)
+		return
+	}
 	onSchedulerResults(ctx, task, objs, output.Candidates)
 }
 
@@ -233,6 +238,59 @@ func onSchedulerResults(
 	cancelPendingUsage(ctx, task)
 }
 
+// onAllOrNothingSchedulerResults saves every placement then commits the scheduler reservation,
+// if any object can't be scheduled all objects are failed.
+func onAllOrNothingSchedulerResults(
+	ctx context.Context,
+	task IScheduleTask,
+	objs []IScheduleModel,
+	results []*schedapi.CandidateResource,
+) {
+	var (
+		sessionId string
+		reason    jsonutils.JSONObject
+	)
+	if len(results) < len(objs) {
+		reason = jsonutils.NewString(fmt.Sprintf("all_or_nothing: only %d of %d guests scheduled", len(results), len(objs)))
+	}
+	for _, result := range results {
+		sessionId = result.SessionId
+		if len(result.Error) != 0 && reason == nil {
+			reason = jsonutils.NewString(result.Error)
+		}
+	}
+	s := auth.GetAdminSession(ctx, options.Options.Region)
+	if reason != nil {
+		for idx, obj := range objs {
+			onObjScheduleFail(ctx, task, obj, reason, idx)
+		}
+		task.OnScheduleFailed(ctx, reason)
+		cancelPendingUsage(ctx, task)
+		if len(sessionId) > 0 {
+			// scheduler reserves nothing for failed session, release in case of partial result
+			scheduler.SchedManager.ReleaseReservation(s, sessionId)
+		}
+		return
+	}
+	for idx, obj := range objs {
+		result := results[idx]
+		func() {
+			lockman.LockObject(ctx, obj)
+			defer lockman.ReleaseObject(ctx, obj)
+			if result.BackupCandidate == nil {
+				task.SaveScheduleResult(ctx, obj, result, idx)
+			} else {
+				task.SaveScheduleResultWithBackup(ctx, obj, result, result.BackupCandidate, idx)
+			}
+		}()
+	}
+	// the reservation is released by scheduler when timeout if commit failed
+	if _, err := scheduler.SchedManager.CommitReservation(s, sessionId); err != nil {
+		log.Errorf("commit scheduler reservation of session %s: %v", sessionId, err)
+	}
+	cancelPendingUsage(ctx, task)
+}
+
 func onMasterSlaveScheduleSucc(
 	ctx context.Context,
 	task IScheduleTask,
@@ -121,6 +121,7 @@ func InitializeCronjobs(ctx context.Context) error {
 	DevToolCronManager = cronman.InitCronJobManager(true, 8, options.Options.TimeZone)
 
 	DevToolCronManager.AddJobAtIntervalsWithStartRun("TaskCleanupJob", time.Duration(options.Options.TaskArchiveIntervalMinutes)*time.Minute, taskman.TaskManager.TaskCleanupJob, true)
+	DevToolCronManager.AddJobAtIntervals("TaskTimeoutJob", time.Minute, taskman.TaskManager.TaskTimeoutJob)
 
 	DevToolCronManager.Start()
 	Session := auth.GetAdminSession(ctx, "")
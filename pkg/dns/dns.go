@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/etcd/msg"
@@ -91,10 +92,17 @@ type SRegionDNS struct {
 	// K8sManager *k8s.SKubeClusterManager
 
 	primaryZoneLabelCount int
+
+	dnssecZones *dnssecZoneCache
+	// dynamic updates of this process are applied one by one, the row lock
+	// taken by the update transaction serializes them with other replicas
+	updateLock sync.Mutex
 }
 
 func New() *SRegionDNS {
-	r := &SRegionDNS{}
+	r := &SRegionDNS{
+		dnssecZones: newDnssecZoneCache(),
+	}
 	return r
 }
 
@@ -146,9 +154,19 @@ func (r *SRegionDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, rmsg *d
 		err     error
 	)
 
+	if rmsg.Opcode == dns.OpcodeUpdate {
+		return r.ServeUpdate(ctx, w, rmsg)
+	}
+	w = r.dnssecWriter(ctx, w, rmsg)
+
 	opt := plugin.Options{}
 	state := request.Request{W: w, Req: rmsg, Context: ctx}
 	zone := plugin.Zones(r.Zones).Matches(state.Name())
+	if state.QType() == dns.TypeDNSKEY {
+		if rcode, ok := r.serveDnskey(w, state); ok {
+			return rcode, nil
+		}
+	}
 	switch state.QType() {
 	case dns.TypeA:
 		records, err = plugin.A(r, zone, state, nil, opt)
@@ -0,0 +1,299 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"crypto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/compute/models"
+)
+
+// Zones with dnssec enabled are signed online, with NSEC "black lies" for
+// denial of existence: NXDOMAIN is turned into NODATA covered by a minimal
+// NSEC record of the query name, so that no zone walking is possible
+const (
+	dnssecZoneRefreshInterval = 30 * time.Second
+
+	// signatures are valid from an hour ago to a week later, tolerating
+	// clock skew of resolvers
+	dnssecSigInception  = -time.Hour
+	dnssecSigExpiration = 7 * 24 * time.Hour
+)
+
+type dnssecZone struct {
+	name string
+
+	// public keys as stored, to tell whether keys were rotated
+	kskStr string
+	zskStr string
+
+	ksk     *dns.DNSKEY
+	kskPriv crypto.Signer
+	zsk     *dns.DNSKEY
+	zskPriv crypto.Signer
+}
+
+func newDnssecZone(zone *models.SDnsZone) (*dnssecZone, error) {
+	ksk, kskPriv, zsk, zskPriv, err := zone.GetDnssecKeys()
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetDnssecKeys of zone %s", zone.Name)
+	}
+	return &dnssecZone{
+		name:    zone.Fqdn(),
+		kskStr:  zone.DnssecKsk,
+		zskStr:  zone.DnssecZsk,
+		ksk:     ksk,
+		kskPriv: kskPriv,
+		zsk:     zsk,
+		zskPriv: zskPriv,
+	}, nil
+}
+
+func (z *dnssecZone) dnskeys() []dns.RR {
+	return []dns.RR{dns.Copy(z.ksk), dns.Copy(z.zsk)}
+}
+
+// sign returns the signature of rrset, DNSKEY is signed by ksk and others
+// by zsk
+func (z *dnssecZone) sign(rrset []dns.RR, now time.Time) (*dns.RRSIG, error) {
+	key, priv := z.zsk, z.zskPriv
+	if rrset[0].Header().Rrtype == dns.TypeDNSKEY {
+		key, priv = z.ksk, z.kskPriv
+	}
+	sig := &dns.RRSIG{
+		Hdr: dns.RR_Header{
+			Ttl: rrset[0].Header().Ttl,
+		},
+		Algorithm:  key.Algorithm,
+		KeyTag:     key.KeyTag(),
+		SignerName: z.name,
+		Inception:  uint32(now.Add(dnssecSigInception).Unix()),
+		Expiration: uint32(now.Add(dnssecSigExpiration).Unix()),
+	}
+	if err := sig.Sign(priv, rrset); err != nil {
+		return nil, errors.Wrapf(err, "sign %s %s", rrset[0].Header().Name, dns.TypeToString[rrset[0].Header().Rrtype])
+	}
+	return sig, nil
+}
+
+// signSection appends signatures of rrsets owned by the zone
+func (z *dnssecZone) signSection(rrs []dns.RR, now time.Time) ([]dns.RR, error) {
+	type rrsetKey struct {
+		name  string
+		rtype uint16
+	}
+	keys := []rrsetKey{}
+	rrsets := map[rrsetKey][]dns.RR{}
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeRRSIG || hdr.Rrtype == dns.TypeOPT {
+			continue
+		}
+		if !dns.IsSubDomain(z.name, strings.ToLower(hdr.Name)) {
+			continue
+		}
+		key := rrsetKey{name: strings.ToLower(hdr.Name), rtype: hdr.Rrtype}
+		if _, ok := rrsets[key]; !ok {
+			keys = append(keys, key)
+		}
+		rrsets[key] = append(rrsets[key], rr)
+	}
+	for _, key := range keys {
+		sig, err := z.sign(rrsets[key], now)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, sig)
+	}
+	return rrs, nil
+}
+
+// nsec returns the minimal NSEC record asserting nothing but itself exists
+// at qname
+func (z *dnssecZone) nsec(qname string, ttl uint32) *dns.NSEC {
+	types := []uint16{dns.TypeRRSIG, dns.TypeNSEC}
+	if strings.ToLower(qname) == z.name {
+		types = []uint16{dns.TypeNS, dns.TypeSOA, dns.TypeRRSIG, dns.TypeNSEC, dns.TypeDNSKEY}
+	}
+	return &dns.NSEC{
+		Hdr: dns.RR_Header{
+			Name:   qname,
+			Rrtype: dns.TypeNSEC,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		NextDomain: "\\000." + qname,
+		TypeBitMap: types,
+	}
+}
+
+type dnssecZoneCache struct {
+	lock        sync.Mutex
+	zones       map[string]*dnssecZone
+	refreshedAt time.Time
+}
+
+func newDnssecZoneCache() *dnssecZoneCache {
+	return &dnssecZoneCache{
+		zones: map[string]*dnssecZone{},
+	}
+}
+
+func (c *dnssecZoneCache) refresh() {
+	zones, err := models.DnsZoneManager.FetchDnssecZones()
+	if err != nil {
+		log.Errorf("FetchDnssecZones: %v", err)
+		return
+	}
+	next := map[string]*dnssecZone{}
+	for i := range zones {
+		zone := &zones[i]
+		name := zone.Fqdn()
+		if old, ok := c.zones[name]; ok && old.kskStr == zone.DnssecKsk && old.zskStr == zone.DnssecZsk {
+			next[name] = old
+			continue
+		}
+		z, err := newDnssecZone(zone)
+		if err != nil {
+			log.Errorf("dnssec zone %s: %v", zone.Name, err)
+			continue
+		}
+		next[name] = z
+	}
+	c.zones = next
+}
+
+// get returns the signed zone qname belongs to
+func (c *dnssecZoneCache) get(qname string) *dnssecZone {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if now := time.Now(); now.Sub(c.refreshedAt) > dnssecZoneRefreshInterval {
+		c.refreshedAt = now
+		c.refresh()
+	}
+	if len(c.zones) == 0 {
+		return nil
+	}
+	name := dns.Fqdn(strings.ToLower(qname))
+	for {
+		if z, ok := c.zones[name]; ok {
+			return z
+		}
+		off, end := dns.NextLabel(name, 0)
+		if end {
+			return nil
+		}
+		name = name[off:]
+	}
+}
+
+// dnssecResponseWriter signs responses of the zone before writing them out
+type dnssecResponseWriter struct {
+	dns.ResponseWriter
+
+	r     *SRegionDNS
+	zone  *dnssecZone
+	state request.Request
+}
+
+func (w *dnssecResponseWriter) WriteMsg(res *dns.Msg) error {
+	if err := w.r.signMsg(w.zone, w.state, res); err != nil {
+		log.Errorf("dnssec sign response of %s: %v", w.state.Name(), err)
+		res = new(dns.Msg)
+		res.SetRcode(w.state.Req, dns.RcodeServerFailure)
+	}
+	// signatures make the response larger, truncate it again if needed
+	res = w.state.Scrub(res)
+	return w.ResponseWriter.WriteMsg(res)
+}
+
+// dnssecWriter wraps w if the request asks for dnssec records of a signed
+// zone
+func (r *SRegionDNS) dnssecWriter(ctx context.Context, w dns.ResponseWriter, rmsg *dns.Msg) dns.ResponseWriter {
+	state := request.Request{W: w, Req: rmsg, Context: ctx}
+	if !state.Do() {
+		return w
+	}
+	zone := r.dnssecZones.get(state.Name())
+	if zone == nil {
+		return w
+	}
+	return &dnssecResponseWriter{
+		ResponseWriter: w,
+		r:              r,
+		zone:           zone,
+		state:          state,
+	}
+}
+
+func (r *SRegionDNS) signMsg(zone *dnssecZone, state request.Request, res *dns.Msg) error {
+	if res.Rcode != dns.RcodeSuccess && res.Rcode != dns.RcodeNameError {
+		return nil
+	}
+	// soa of denials are generated for the server block zone, the one of the
+	// signed zone is wanted here
+	for i, rr := range res.Ns {
+		if rr.Header().Rrtype == dns.TypeSOA && strings.ToLower(rr.Header().Name) != zone.name {
+			soa, _ := plugin.SOA(r, zone.name, state, plugin.Options{})
+			res.Ns[i] = soa[0]
+		}
+	}
+	if res.Rcode == dns.RcodeNameError || len(res.Answer) == 0 {
+		res.Rcode = dns.RcodeSuccess
+		ttl := r.MinTTL(state)
+		res.Ns = append(res.Ns, zone.nsec(state.Name(), ttl))
+	}
+
+	var err error
+	now := time.Now()
+	res.Answer, err = zone.signSection(res.Answer, now)
+	if err != nil {
+		return errors.Wrap(err, "answer")
+	}
+	res.Ns, err = zone.signSection(res.Ns, now)
+	if err != nil {
+		return errors.Wrap(err, "authority")
+	}
+	res.Authoritative = true
+	state.SizeAndDo(res)
+	return nil
+}
+
+// serveDnskey answers DNSKEY query at the apex of a signed zone
+func (r *SRegionDNS) serveDnskey(w dns.ResponseWriter, state request.Request) (int, bool) {
+	zone := r.dnssecZones.get(state.Name())
+	if zone == nil || strings.ToLower(state.Name()) != zone.name {
+		return dns.RcodeSuccess, false
+	}
+	m := new(dns.Msg)
+	m.SetReply(state.Req)
+	m.Authoritative = true
+	m.Answer = zone.dnskeys()
+	state.SizeAndDo(m)
+	w.WriteMsg(m)
+	return dns.RcodeSuccess, true
+}
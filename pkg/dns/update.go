@@ -0,0 +1,406 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+)
+
+// Dynamic updates (RFC 2136) of local zones are authenticated with TSIG
+// (RFC 2845) and written through to dnsrecords.  The zone has no stored SOA,
+// updates of SOA are ignored as are deletions of apex NS records.
+//
+// TSIG is verified against the request packed again, as coredns does not
+// hand over the original wire data.  Both compressed and uncompressed
+// forms are tried
+//
+// The prerequisites are checked and the updates applied in one database
+// transaction with the row of the zone locked, as the zone may be served by
+// several replicas.  An update takes effect as a whole or not at all (RFC
+// 2136 section 3.4), and bumps the soa serial of the zone if anything is
+// changed.  As section 3.4.2.2 says, an add conflicting with the CNAME rule
+// is ignored silently and the update still succeeds
+var (
+	dnsUpdateTypes = map[uint16]bool{
+		dns.TypeA:     true,
+		dns.TypeAAAA:  true,
+		dns.TypeTXT:   true,
+		dns.TypeCNAME: true,
+		dns.TypePTR:   true,
+		dns.TypeMX:    true,
+		dns.TypeSRV:   true,
+		dns.TypeNS:    true,
+	}
+)
+
+const (
+	tsigFudge = 300
+)
+
+type dnsUpdateOp struct {
+	// delete if true, add otherwise
+	delete bool
+
+	name       string
+	dnsType    string
+	dnsValue   string
+	ttl        int64
+	mxPriority int64
+}
+
+// relativeName returns name relative to zone with @ for the apex, as stored
+// in dnsrecords
+func relativeName(zone, name string) string {
+	name = strings.ToLower(dns.Fqdn(name))
+	if name == zone {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+zone)
+}
+
+// rrToRecordValue converts rdata of rr to values stored in dnsrecords
+func rrToRecordValue(rr dns.RR) (string, int64, error) {
+	switch v := rr.(type) {
+	case *dns.A:
+		return v.A.String(), 0, nil
+	case *dns.AAAA:
+		return v.AAAA.String(), 0, nil
+	case *dns.CNAME:
+		return strings.TrimSuffix(v.Target, "."), 0, nil
+	case *dns.NS:
+		return strings.TrimSuffix(v.Ns, "."), 0, nil
+	case *dns.PTR:
+		return strings.TrimSuffix(v.Ptr, "."), 0, nil
+	case *dns.MX:
+		return strings.TrimSuffix(v.Mx, "."), int64(v.Preference), nil
+	case *dns.TXT:
+		return strings.Join(v.Txt, ""), 0, nil
+	case *dns.SRV:
+		return fmt.Sprintf("%d %d %d %s", v.Priority, v.Weight, v.Port, strings.TrimSuffix(v.Target, ".")), 0, nil
+	}
+	return "", 0, errors.Wrapf(errors.ErrNotSupported, "type %s", dns.TypeToString[rr.Header().Rrtype])
+}
+
+func tsigVerify(req *dns.Msg, secret string) error {
+	var err error
+	for _, compress := range []bool{true, false} {
+		m := req.Copy()
+		m.Compress = compress
+		buf, perr := m.Pack()
+		if perr != nil {
+			return errors.Wrap(perr, "Pack")
+		}
+		err = dns.TsigVerify(buf, secret, "", false)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// ServeUpdate handles dynamic updates
+func (r *SRegionDNS) ServeUpdate(ctx context.Context, w dns.ResponseWriter, req *dns.Msg) (int, error) {
+	state := request.Request{W: w, Req: req, Context: ctx}
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	rcode, secret, err := r.processUpdate(ctx, req)
+	if err != nil {
+		log.Errorf(`%s:%s update %s: %s %v`, state.RemoteAddr(), state.Port(), state.Name(), dns.RcodeToString[rcode], err)
+	} else {
+		log.Infof(`%s:%s update %s: %s`, state.RemoteAddr(), state.Port(), state.Name(), dns.RcodeToString[rcode])
+	}
+	m.Rcode = rcode
+
+	t := req.IsTsig()
+	if t == nil || len(secret) == 0 {
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	}
+	m.SetTsig(t.Hdr.Name, t.Algorithm, tsigFudge, time.Now().Unix())
+	buf, _, err := dns.TsigGenerate(m, secret, t.MAC, false)
+	if err != nil {
+		log.Errorf("TsigGenerate: %v", err)
+		m.Extra = nil
+		m.Rcode = dns.RcodeServerFailure
+		w.WriteMsg(m)
+		return dns.RcodeSuccess, nil
+	}
+	w.Write(buf)
+	return dns.RcodeSuccess, nil
+}
+
+// processUpdate returns the rcode, and the tsig secret if the request is
+// authenticated, with which the response should be signed
+func (r *SRegionDNS) processUpdate(ctx context.Context, req *dns.Msg) (int, string, error) {
+	if len(req.Question) != 1 || req.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError, "", errors.Wrap(errors.ErrInvalidFormat, "zone section")
+	}
+	zoneName := strings.ToLower(dns.Fqdn(req.Question[0].Name))
+	zone, err := models.DnsZoneManager.FetchLocalZoneByName(zoneName)
+	if err != nil {
+		return dns.RcodeNotAuth, "", errors.Wrap(err, "FetchLocalZoneByName")
+	}
+	if !zone.DynamicUpdate.IsTrue() {
+		return dns.RcodeRefused, "", errors.Wrapf(httperrors.ErrForbidden, "dynamic update of %s not enabled", zoneName)
+	}
+
+	t := req.IsTsig()
+	if t == nil {
+		return dns.RcodeRefused, "", errors.Wrap(httperrors.ErrForbidden, "tsig required")
+	}
+	if strings.ToLower(t.Hdr.Name) != zone.TsigKeyName || strings.ToLower(t.Algorithm) != dns.Fqdn(zone.TsigAlgorithm) {
+		return dns.RcodeNotAuth, "", errors.Wrapf(httperrors.ErrForbidden, "unknown tsig key %s %s", t.Hdr.Name, t.Algorithm)
+	}
+	secret, err := zone.GetTsigSecret()
+	if err != nil {
+		return dns.RcodeServerFailure, "", errors.Wrap(err, "GetTsigSecret")
+	}
+	if err := tsigVerify(req, secret); err != nil {
+		return dns.RcodeNotAuth, "", errors.Wrap(err, "TsigVerify")
+	}
+
+	r.updateLock.Lock()
+	defer r.updateLock.Unlock()
+	update, err := zone.BeginUpdate(ctx, auth.AdminCredential())
+	if err != nil {
+		return dns.RcodeServerFailure, secret, errors.Wrap(err, "BeginUpdate")
+	}
+	defer update.Rollback()
+
+	if rcode, err := checkUpdatePrereqs(update, zoneName, req.Answer); err != nil {
+		return rcode, secret, errors.Wrap(err, "prerequisite")
+	}
+	ops, rcode, err := prescanUpdates(zoneName, req.Ns)
+	if err != nil {
+		return rcode, secret, errors.Wrap(err, "prescan")
+	}
+	if err := applyUpdates(update, ops); err != nil {
+		return dns.RcodeServerFailure, secret, errors.Wrap(err, "apply")
+	}
+	if err := update.Commit(); err != nil {
+		return dns.RcodeServerFailure, secret, errors.Wrap(err, "commit")
+	}
+	return dns.RcodeSuccess, secret, nil
+}
+
+// checkUpdatePrereqs implements RFC 2136 section 3.2
+func checkUpdatePrereqs(zone *models.SDnsZoneUpdate, zoneName string, prereqs []dns.RR) (int, error) {
+	type rrsetKey struct {
+		name    string
+		dnsType string
+	}
+	// value dependent rrsets to compare as a whole
+	wanted := map[rrsetKey]map[string]bool{}
+	for _, rr := range prereqs {
+		hdr := rr.Header()
+		if hdr.Ttl != 0 {
+			return dns.RcodeFormatError, errors.Wrapf(errors.ErrInvalidFormat, "ttl of %s", hdr.Name)
+		}
+		if !dns.IsSubDomain(zoneName, strings.ToLower(hdr.Name)) {
+			return dns.RcodeNotZone, errors.Wrapf(errors.ErrInvalidFormat, "%s not in zone", hdr.Name)
+		}
+		name := relativeName(zoneName, hdr.Name)
+		dnsType := dns.TypeToString[hdr.Rrtype]
+		records, err := zone.GetDnsRecordsByName(name)
+		if err != nil {
+			return dns.RcodeServerFailure, errors.Wrap(err, "GetDnsRecordsByName")
+		}
+		rrsetExists := false
+		for i := range records {
+			if records[i].DnsType == dnsType {
+				rrsetExists = true
+				break
+			}
+		}
+		switch hdr.Class {
+		case dns.ClassANY:
+			if hdr.Rdlength != 0 {
+				return dns.RcodeFormatError, errors.Wrapf(errors.ErrInvalidFormat, "rdata of %s", hdr.Name)
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if len(records) == 0 {
+					return dns.RcodeNameError, errors.Wrapf(errors.ErrNotFound, "name %s", hdr.Name)
+				}
+			} else if !rrsetExists {
+				return dns.RcodeNXRrset, errors.Wrapf(errors.ErrNotFound, "rrset %s %s", hdr.Name, dnsType)
+			}
+		case dns.ClassNONE:
+			if hdr.Rdlength != 0 {
+				return dns.RcodeFormatError, errors.Wrapf(errors.ErrInvalidFormat, "rdata of %s", hdr.Name)
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if len(records) > 0 {
+					return dns.RcodeYXDomain, errors.Wrapf(errors.ErrDuplicateId, "name %s", hdr.Name)
+				}
+			} else if rrsetExists {
+				return dns.RcodeYXRrset, errors.Wrapf(errors.ErrDuplicateId, "rrset %s %s", hdr.Name, dnsType)
+			}
+		case dns.ClassINET:
+			value, _, err := rrToRecordValue(rr)
+			if err != nil {
+				return dns.RcodeNXRrset, err
+			}
+			key := rrsetKey{name: name, dnsType: dnsType}
+			if _, ok := wanted[key]; !ok {
+				wanted[key] = map[string]bool{}
+			}
+			wanted[key][value] = true
+		default:
+			return dns.RcodeFormatError, errors.Wrapf(errors.ErrInvalidFormat, "class %d of %s", hdr.Class, hdr.Name)
+		}
+	}
+	for key, values := range wanted {
+		records, err := zone.GetDnsRecordsByName(key.name)
+		if err != nil {
+			return dns.RcodeServerFailure, errors.Wrap(err, "GetDnsRecordsByName")
+		}
+		existing := map[string]bool{}
+		for i := range records {
+			if records[i].DnsType == key.dnsType {
+				existing[records[i].DnsValue] = true
+			}
+		}
+		if len(existing) != len(values) {
+			return dns.RcodeNXRrset, errors.Wrapf(errors.ErrNotFound, "rrset %s %s", key.name, key.dnsType)
+		}
+		for value := range values {
+			if !existing[value] {
+				return dns.RcodeNXRrset, errors.Wrapf(errors.ErrNotFound, "rrset %s %s", key.name, key.dnsType)
+			}
+		}
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// prescanUpdates implements RFC 2136 section 3.4.1, all updates are
+// validated before any is applied
+func prescanUpdates(zoneName string, updates []dns.RR) ([]dnsUpdateOp, int, error) {
+	ops := []dnsUpdateOp{}
+	for _, rr := range updates {
+		hdr := rr.Header()
+		if !dns.IsSubDomain(zoneName, strings.ToLower(hdr.Name)) {
+			return nil, dns.RcodeNotZone, errors.Wrapf(errors.ErrInvalidFormat, "%s not in zone", hdr.Name)
+		}
+		name := relativeName(zoneName, hdr.Name)
+		isApex := name == "@"
+		dnsType := dns.TypeToString[hdr.Rrtype]
+		if hdr.Rrtype == dns.TypeSOA {
+			// not stored, but allowed to appear
+			continue
+		}
+		switch hdr.Class {
+		case dns.ClassINET:
+			if !dnsUpdateTypes[hdr.Rrtype] {
+				return nil, dns.RcodeNotImplemented, errors.Wrapf(errors.ErrNotSupported, "type %s", dnsType)
+			}
+			value, mxPriority, err := rrToRecordValue(rr)
+			if err != nil {
+				return nil, dns.RcodeFormatError, err
+			}
+			record := api.SDnsRecord{}
+			record.DnsType = dnsType
+			record.DnsValue = value
+			record.MxPriority = mxPriority
+			if err := record.ValidateDnsrecordValue(); err != nil {
+				return nil, dns.RcodeRefused, err
+			}
+			ops = append(ops, dnsUpdateOp{
+				name:       name,
+				dnsType:    dnsType,
+				dnsValue:   value,
+				ttl:        int64(hdr.Ttl),
+				mxPriority: mxPriority,
+			})
+		case dns.ClassANY:
+			if hdr.Ttl != 0 || hdr.Rdlength != 0 {
+				return nil, dns.RcodeFormatError, errors.Wrapf(errors.ErrInvalidFormat, "ttl or rdata of %s", hdr.Name)
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if isApex {
+					// only records other than NS at the apex are deleted
+					for rtype := range dnsUpdateTypes {
+						if rtype != dns.TypeNS {
+							ops = append(ops, dnsUpdateOp{delete: true, name: name, dnsType: dns.TypeToString[rtype]})
+						}
+					}
+					continue
+				}
+				ops = append(ops, dnsUpdateOp{delete: true, name: name})
+				continue
+			}
+			if isApex && hdr.Rrtype == dns.TypeNS {
+				continue
+			}
+			ops = append(ops, dnsUpdateOp{delete: true, name: name, dnsType: dnsType})
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 {
+				return nil, dns.RcodeFormatError, errors.Wrapf(errors.ErrInvalidFormat, "ttl of %s", hdr.Name)
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				return nil, dns.RcodeFormatError, errors.Wrapf(errors.ErrInvalidFormat, "type ANY of %s", hdr.Name)
+			}
+			if isApex && hdr.Rrtype == dns.TypeNS {
+				continue
+			}
+			value, _, err := rrToRecordValue(rr)
+			if err != nil {
+				return nil, dns.RcodeFormatError, err
+			}
+			ops = append(ops, dnsUpdateOp{delete: true, name: name, dnsType: dnsType, dnsValue: value})
+		default:
+			return nil, dns.RcodeFormatError, errors.Wrapf(errors.ErrInvalidFormat, "class %d of %s", hdr.Class, hdr.Name)
+		}
+	}
+	return ops, dns.RcodeSuccess, nil
+}
+
+// applyUpdates implements RFC 2136 section 3.4.2, the update is left
+// uncommitted
+func applyUpdates(update *models.SDnsZoneUpdate, ops []dnsUpdateOp) error {
+	for _, op := range ops {
+		if op.delete {
+			if _, err := update.RemoveDnsRecords(op.name, op.dnsType, op.dnsValue); err != nil {
+				return errors.Wrapf(err, "remove %s %s %s", op.name, op.dnsType, op.dnsValue)
+			}
+			continue
+		}
+		input := api.DnsRecordCreateInput{
+			DnsType:    op.dnsType,
+			DnsValue:   op.dnsValue,
+			TTL:        op.ttl,
+			MxPriority: op.mxPriority,
+		}
+		input.Name = op.name
+		if _, err := update.AddDnsRecord(input); err != nil {
+			return errors.Wrapf(err, "add %s %s %s", op.name, op.dnsType, op.dnsValue)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestRelativeName(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"example.com.", "@"},
+		{"Example.COM", "@"},
+		{"www.example.com.", "www"},
+		{"_acme-challenge.a.example.com.", "_acme-challenge.a"},
+	}
+	for _, c := range cases {
+		if got := relativeName("example.com.", c.name); got != c.want {
+			t.Errorf("relativeName(%q) want %q got %q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestPrescanUpdates(t *testing.T) {
+	newRR := func(s string) dns.RR {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("NewRR %s: %v", s, err)
+		}
+		return rr
+	}
+	m := new(dns.Msg)
+	m.SetUpdate("example.com.")
+	m.Insert([]dns.RR{
+		newRR("www.example.com. 300 IN A 10.0.0.1"),
+		newRR("example.com. 300 IN MX 10 mail.example.com."),
+		newRR("_sip._tcp.example.com. 300 IN SRV 10 20 5060 sip.example.com."),
+	})
+	m.RemoveRRset([]dns.RR{
+		newRR("www.example.com. 300 IN A 10.0.0.1"),
+		newRR("example.com. 300 IN NS ns.example.com."),
+	})
+	m.Remove([]dns.RR{
+		newRR("www.example.com. 300 IN A 10.0.0.2"),
+	})
+	// go through the wire as rdata length is checked
+	buf, err := m.Pack()
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	req := new(dns.Msg)
+	if err := req.Unpack(buf); err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+	updates := req.Ns
+
+	ops, rcode, err := prescanUpdates("example.com.", updates)
+	if err != nil {
+		t.Fatalf("prescanUpdates: %s %v", dns.RcodeToString[rcode], err)
+	}
+	want := []dnsUpdateOp{
+		{name: "www", dnsType: "A", dnsValue: "10.0.0.1", ttl: 300},
+		{name: "@", dnsType: "MX", dnsValue: "mail.example.com", ttl: 300, mxPriority: 10},
+		{name: "_sip._tcp", dnsType: "SRV", dnsValue: "10 20 5060 sip.example.com", ttl: 300},
+		{delete: true, name: "www", dnsType: "A"},
+		{delete: true, name: "www", dnsType: "A", dnsValue: "10.0.0.2"},
+	}
+	if len(ops) != len(want) {
+		t.Fatalf("want %d ops, got %d: %#v", len(want), len(ops), ops)
+	}
+	for i := range want {
+		if ops[i] != want[i] {
+			t.Errorf("op %d: want %#v got %#v", i, want[i], ops[i])
+		}
+	}
+
+	rr, _ := dns.NewRR("www.example.org. 300 IN A 10.0.0.1")
+	if _, rcode, err := prescanUpdates("example.com.", []dns.RR{rr}); err == nil || rcode != dns.RcodeNotZone {
+		t.Errorf("want NOTZONE, got %s", dns.RcodeToString[rcode])
+	}
+}
+
+func TestTsigVerify(t *testing.T) {
+	secret := "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0"
+	m := new(dns.Msg)
+	m.SetUpdate("example.com.")
+	rr, _ := dns.NewRR("www.example.com. 300 IN A 10.0.0.1")
+	m.Insert([]dns.RR{rr})
+	m.SetTsig("key.example.com.", dns.HmacSHA256, tsigFudge, time.Now().Unix())
+	buf, _, err := dns.TsigGenerate(m, secret, "", false)
+	if err != nil {
+		t.Fatalf("TsigGenerate: %v", err)
+	}
+	req := new(dns.Msg)
+	if err := req.Unpack(buf); err != nil {
+		t.Fatalf("Unpack: %v", err)
+	}
+	if err := tsigVerify(req, secret); err != nil {
+		t.Errorf("tsigVerify: %v", err)
+	}
+	if err := tsigVerify(req, "d3Jvbmc="); err == nil {
+		t.Errorf("tsigVerify with wrong secret should fail")
+	}
+}
+
+func TestDnssecSign(t *testing.T) {
+	newKey := func(flags uint16) (*dns.DNSKEY, crypto.Signer) {
+		key := &dns.DNSKEY{
+			Hdr:       dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+			Flags:     flags,
+			Protocol:  3,
+			Algorithm: dns.ECDSAP256SHA256,
+		}
+		priv, err := key.Generate(256)
+		if err != nil {
+			t.Fatalf("Generate: %v", err)
+		}
+		return key, priv.(crypto.Signer)
+	}
+	z := &dnssecZone{name: "example.com."}
+	z.ksk, z.kskPriv = newKey(257)
+	z.zsk, z.zskPriv = newKey(256)
+
+	a1, _ := dns.NewRR("www.example.com. 300 IN A 10.0.0.1")
+	a2, _ := dns.NewRR("www.example.com. 300 IN A 10.0.0.2")
+	other, _ := dns.NewRR("www.example.org. 300 IN A 10.0.0.3")
+	rrs, err := z.signSection([]dns.RR{a1, a2, other}, time.Now())
+	if err != nil {
+		t.Fatalf("signSection: %v", err)
+	}
+	if len(rrs) != 4 {
+		t.Fatalf("want 1 signature for in zone rrset, got %d rrs", len(rrs))
+	}
+	sig := rrs[3].(*dns.RRSIG)
+	if err := sig.Verify(z.zsk, []dns.RR{a1, a2}); err != nil {
+		t.Errorf("verify A rrset: %v", err)
+	}
+
+	keys, err := z.signSection(z.dnskeys(), time.Now())
+	if err != nil {
+		t.Fatalf("signSection dnskeys: %v", err)
+	}
+	if err := keys[2].(*dns.RRSIG).Verify(z.ksk, keys[:2]); err != nil {
+		t.Errorf("verify DNSKEY rrset with ksk: %v", err)
+	}
+
+	nsec := z.nsec("nx.example.com.", 30)
+	if nsec.NextDomain != "\\000.nx.example.com." {
+		t.Errorf("bad nsec next domain %s", nsec.NextDomain)
+	}
+}
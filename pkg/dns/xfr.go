@@ -20,11 +20,25 @@ import (
 
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/compute/models"
 )
 
-// Serial implements the Transferer interface
+// Serial implements the Transferer interface.  It follows the clock, a local
+// zone changed by dynamic updates more than once a second is ahead of it
 func (r *SRegionDNS) Serial(state request.Request) uint32 {
-	return uint32(time.Now().Unix())
+	now := time.Now()
+	zone, err := models.DnsZoneManager.FetchLocalZoneOfName(state.Name())
+	if err != nil {
+		if errors.Cause(err) != errors.ErrNotFound {
+			log.Errorf("FetchLocalZoneOfName %s: %v", state.Name(), err)
+		}
+		return uint32(now.Unix())
+	}
+	return zone.GetSoaSerial(now)
 }
 
 // MinTTL implements the Transferer interface
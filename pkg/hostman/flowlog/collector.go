@@ -0,0 +1,289 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/hostman/hostutils"
+	"yunion.io/x/onecloud/pkg/hostman/options"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	modules "yunion.io/x/onecloud/pkg/mcclient/modules/compute"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+const (
+	// max bytes of ovn-controller log consumed in one round
+	maxReadBytes = 16 * 1024 * 1024
+	// records of one flow log carried by one action log entry
+	loggerBatchSize = 64
+	// how long flow log settings fetched from region are trusted
+	flowLogCacheTTL = time.Minute
+)
+
+type IHostInfo interface {
+	GetId() string
+}
+
+type sFlowLogCache struct {
+	flowLog   *api.SFlowLog
+	fetchedAt time.Time
+}
+
+type SFlowLogCollector struct {
+	hostInfo IHostInfo
+	logPath  string
+	interval time.Duration
+
+	inode  uint64
+	offset int64
+
+	flowLogs map[string]*sFlowLogCache
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newFlowLogCollector(hostInfo IHostInfo, logPath string, interval time.Duration) *SFlowLogCollector {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SFlowLogCollector{
+		hostInfo: hostInfo,
+		logPath:  logPath,
+		interval: interval,
+		flowLogs: map[string]*sFlowLogCache{},
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+var flowLogCollector *SFlowLogCollector
+
+func Init(hostInfo IHostInfo) {
+	if !options.HostOptions.EnableFlowLogCollector {
+		return
+	}
+	if flowLogCollector == nil {
+		interval := options.HostOptions.FlowLogCollectIntervalSeconds
+		if interval <= 0 {
+			interval = 10
+		}
+		flowLogCollector = newFlowLogCollector(hostInfo,
+			options.HostOptions.OvnControllerLogPath, time.Duration(interval)*time.Second)
+	}
+}
+
+func Start() {
+	if flowLogCollector != nil {
+		go flowLogCollector.Start()
+	}
+}
+
+func Stop() {
+	if flowLogCollector != nil {
+		flowLogCollector.Stop()
+	}
+}
+
+func (c *SFlowLogCollector) Start() {
+	// records written before we start are not shipped
+	if fi, err := os.Stat(c.logPath); err == nil {
+		c.inode = fileInode(fi)
+		c.offset = fi.Size()
+	}
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		records, err := c.collect()
+		if err != nil {
+			log.Errorf("collect flow log records from %s: %s", c.logPath, err)
+			continue
+		}
+		if len(records) > 0 {
+			c.ship(c.ctx, records)
+		}
+	}
+}
+
+// Stop cancels the collecting loop.  It's safe to be called from another
+// goroutine than the one running Start
+func (c *SFlowLogCollector) Stop() {
+	c.cancel()
+}
+
+func fileInode(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
+}
+
+// collect reads log lines appended since last round.  A rotated or
+// truncated log file is read from the beginning
+func (c *SFlowLogCollector) collect() ([]*api.FlowLogRecord, error) {
+	f, err := os.Open(c.logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "open")
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "stat")
+	}
+	if inode := fileInode(fi); inode != c.inode || fi.Size() < c.offset {
+		c.inode = inode
+		c.offset = 0
+	}
+	if fi.Size() == c.offset {
+		return nil, nil
+	}
+	if _, err := f.Seek(c.offset, io.SeekStart); err != nil {
+		return nil, errors.Wrap(err, "seek")
+	}
+	buf, err := io.ReadAll(io.LimitReader(f, maxReadBytes))
+	if err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+	// leave incomplete last line to next round
+	end := bytes.LastIndexByte(buf, '\n')
+	if end < 0 {
+		return nil, nil
+	}
+	c.offset += int64(end + 1)
+
+	hostId := c.hostInfo.GetId()
+	records := []*api.FlowLogRecord{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf[:end+1]))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		record, err := ParseAclLogLine(scanner.Text())
+		if err != nil {
+			if errors.Cause(err) != ErrNotAclLog {
+				log.Debugf("parse acl log: %s", err)
+			}
+			continue
+		}
+		// acls not logged for flow logs
+		if len(record.FlowLogId) == 0 {
+			continue
+		}
+		record.HostId = hostId
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (c *SFlowLogCollector) getFlowLog(ctx context.Context, id string) (*api.SFlowLog, error) {
+	if cache, ok := c.flowLogs[id]; ok && time.Since(cache.fetchedAt) < flowLogCacheTTL {
+		return cache.flowLog, nil
+	}
+	var flowLog *api.SFlowLog
+	s := hostutils.GetComputeSession(ctx)
+	obj, err := modules.FlowLogs.Get(s, id, nil)
+	if err != nil {
+		if errors.Cause(err) != httperrors.ErrResourceNotFound {
+			return nil, errors.Wrapf(err, "get flow log %s", id)
+		}
+		// deleted, records of it are dropped
+	} else {
+		flowLog = &api.SFlowLog{}
+		if err := obj.Unmarshal(flowLog); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal flow log %s", id)
+		}
+	}
+	c.flowLogs[id] = &sFlowLogCache{
+		flowLog:   flowLog,
+		fetchedAt: time.Now(),
+	}
+	return flowLog, nil
+}
+
+func (c *SFlowLogCollector) ship(ctx context.Context, records []*api.FlowLogRecord) {
+	groups := map[string][]*api.FlowLogRecord{}
+	for _, record := range records {
+		groups[record.FlowLogId] = append(groups[record.FlowLogId], record)
+	}
+	for id, records := range groups {
+		flowLog, err := c.getFlowLog(ctx, id)
+		if err != nil {
+			log.Errorf("ship flow log records: %s", err)
+			continue
+		}
+		if flowLog == nil || flowLog.Enabled == nil || !*flowLog.Enabled {
+			continue
+		}
+		switch flowLog.Destination {
+		case api.FlowLogDestinationBucket:
+			err = c.shipToBucket(ctx, flowLog, records)
+		default:
+			c.shipToLogger(ctx, flowLog, records)
+		}
+		if err != nil {
+			log.Errorf("ship %d records of flow log %s(%s): %s", len(records), flowLog.Name, flowLog.Id, err)
+		}
+	}
+}
+
+func (c *SFlowLogCollector) shipToLogger(ctx context.Context, flowLog *api.SFlowLog, records []*api.FlowLogRecord) {
+	var (
+		obj      = logclient.NewSimpleObject(flowLog.Id, flowLog.Name, modules.FlowLogs.GetKeyword())
+		userCred = hostutils.GetComputeSession(ctx).GetToken()
+	)
+	for i := 0; i < len(records); i += loggerBatchSize {
+		end := i + loggerBatchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		logclient.AddSimpleActionLog(obj, logclient.ACT_FLOW_LOG, jsonutils.Marshal(records[i:end]), userCred, true)
+	}
+}
+
+// shipToBucket stores records as json lines in object
+// <prefix><flowLogId>/<yyyy>/<mm>/<dd>/<hostId>-<unixnano>.json
+func (c *SFlowLogCollector) shipToBucket(ctx context.Context, flowLog *api.SFlowLog, records []*api.FlowLogRecord) error {
+	body := &bytes.Buffer{}
+	for _, record := range records {
+		body.WriteString(jsonutils.Marshal(record).String())
+		body.WriteByte('\n')
+	}
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%s%s/%s/%s-%d.json", flowLog.BucketPrefix, flowLog.Id, now.Format("2006/01/02"), c.hostInfo.GetId(), now.UnixNano())
+	s := hostutils.GetComputeSession(ctx)
+	err := modules.Buckets.Upload(s, flowLog.BucketId, key, body, int64(body.Len()), "", "", nil)
+	if err != nil {
+		return errors.Wrapf(err, "upload %s to bucket %s", key, flowLog.BucketId)
+	}
+	return nil
+}
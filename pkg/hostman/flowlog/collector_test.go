@@ -0,0 +1,37 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowlog
+
+import (
+	"path"
+	"testing"
+	"time"
+)
+
+func TestCollectorStop(t *testing.T) {
+	c := newFlowLogCollector(nil, path.Join(t.TempDir(), "ovn-controller.log"), time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		c.Start()
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("collector not stopped")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowlog
+
+import (
+	"strconv"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+const (
+	ErrNotAclLog = errors.Error("not an acl log")
+
+	aclLogModule = "acl_log"
+)
+
+// ParseAclLogLine parses a line ovn-controller writes when an acl with
+// logging enabled is hit, e.g.
+//
+//	2023-06-01T08:01:55.129Z|00042|acl_log(ovn_pinctrl0)|INFO|name="fl-xxx", verdict=drop, severity=info, direction=to-lport: tcp,vlan_tci=0x0000,dl_src=00:22:..,dl_dst=00:22:..,nw_src=10.0.0.2,nw_dst=10.0.0.3,nw_tos=0,nw_ecn=0,nw_ttl=64,tp_src=34567,tp_dst=22,tcp_flags=syn
+//
+// Older ovn releases do not print the direction field.
+func ParseAclLogLine(line string) (*api.FlowLogRecord, error) {
+	parts := strings.SplitN(strings.TrimSpace(line), "|", 5)
+	if len(parts) != 5 || !strings.HasPrefix(parts[2], aclLogModule) {
+		return nil, ErrNotAclLog
+	}
+	msg := parts[4]
+	pos := strings.Index(msg, ": ")
+	if pos < 0 {
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "no flow in acl log %q", msg)
+	}
+	record := &api.FlowLogRecord{
+		Time: parts[0],
+	}
+	for _, field := range strings.Split(msg[:pos], ",") {
+		k, v := splitKeyValue(field)
+		switch k {
+		case "name":
+			name := strings.Trim(v, `"`)
+			if strings.HasPrefix(name, api.FlowLogAclNamePrefix) {
+				record.FlowLogId = name[len(api.FlowLogAclNamePrefix):]
+			}
+		case "verdict":
+			record.Verdict = v
+		case "severity":
+			record.Severity = v
+		case "direction":
+			record.Direction = v
+		}
+	}
+	if len(record.Verdict) == 0 {
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "no verdict in acl log %q", msg)
+	}
+	for i, field := range strings.Split(strings.TrimSpace(msg[pos+2:]), ",") {
+		if i == 0 && !strings.Contains(field, "=") {
+			record.Protocol = field
+			continue
+		}
+		k, v := splitKeyValue(field)
+		switch k {
+		case "dl_src":
+			record.SrcMac = v
+		case "dl_dst":
+			record.DstMac = v
+		case "nw_src", "ipv6_src":
+			record.SrcIp = v
+		case "nw_dst", "ipv6_dst":
+			record.DstIp = v
+		case "tp_src":
+			record.SrcPort, _ = strconv.Atoi(v)
+		case "tp_dst":
+			record.DstPort, _ = strconv.Atoi(v)
+		case "icmp_type", "icmpv6_type":
+			record.IcmpType, _ = strconv.Atoi(v)
+		case "icmp_code", "icmpv6_code":
+			record.IcmpCode, _ = strconv.Atoi(v)
+		case "tcp_flags":
+			record.TcpFlags = v
+		}
+	}
+	return record, nil
+}
+
+func splitKeyValue(field string) (string, string) {
+	field = strings.TrimSpace(field)
+	pos := strings.Index(field, "=")
+	if pos < 0 {
+		return field, ""
+	}
+	return field[:pos], field[pos+1:]
+}
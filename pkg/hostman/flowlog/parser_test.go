@@ -0,0 +1,110 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flowlog
+
+import (
+	"reflect"
+	"testing"
+
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+func TestParseAclLogLine(t *testing.T) {
+	cases := []struct {
+		name string
+		line string
+		want *api.FlowLogRecord
+		err  error
+	}{
+		{
+			name: "tcp to-lport",
+			line: `2023-06-01T08:01:55.129Z|00042|acl_log(ovn_pinctrl0)|INFO|name="fl-4c5bd4f0-aa2c-4e6e-8a55-1a1a4e0f5b7e", verdict=drop, severity=info, direction=to-lport: tcp,vlan_tci=0x0000,dl_src=00:22:0a:00:00:02,dl_dst=00:22:0a:00:00:03,nw_src=10.0.0.2,nw_dst=10.0.0.3,nw_tos=0,nw_ecn=0,nw_ttl=64,tp_src=34567,tp_dst=22,tcp_flags=syn`,
+			want: &api.FlowLogRecord{
+				Time:      "2023-06-01T08:01:55.129Z",
+				FlowLogId: "4c5bd4f0-aa2c-4e6e-8a55-1a1a4e0f5b7e",
+				Verdict:   "drop",
+				Severity:  "info",
+				Direction: "to-lport",
+				Protocol:  "tcp",
+				SrcMac:    "00:22:0a:00:00:02",
+				DstMac:    "00:22:0a:00:00:03",
+				SrcIp:     "10.0.0.2",
+				DstIp:     "10.0.0.3",
+				SrcPort:   34567,
+				DstPort:   22,
+				TcpFlags:  "syn",
+			},
+		},
+		{
+			name: "icmp6 without direction",
+			line: `2023-06-01T08:01:56.000Z|00043|acl_log(ovn_pinctrl0)|INFO|name="fl-abc", verdict=allow, severity=info: icmp6,vlan_tci=0x0000,dl_src=00:22:0a:00:00:02,dl_dst=00:22:0a:00:00:03,ipv6_src=fd00::2,ipv6_dst=fd00::3,ipv6_label=0x00000,nw_tos=0,nw_ecn=0,nw_ttl=64,icmp_type=128,icmp_code=0`,
+			want: &api.FlowLogRecord{
+				Time:      "2023-06-01T08:01:56.000Z",
+				FlowLogId: "abc",
+				Verdict:   "allow",
+				Severity:  "info",
+				Protocol:  "icmp6",
+				SrcMac:    "00:22:0a:00:00:02",
+				DstMac:    "00:22:0a:00:00:03",
+				SrcIp:     "fd00::2",
+				DstIp:     "fd00::3",
+				IcmpType:  128,
+			},
+		},
+		{
+			name: "unnamed acl",
+			line: `2023-06-01T08:01:57.000Z|00044|acl_log(ovn_pinctrl0)|INFO|name="<unnamed>", verdict=allow, severity=alert: udp,vlan_tci=0x0000,nw_src=10.0.0.2,nw_dst=10.0.0.3,tp_src=68,tp_dst=67`,
+			want: &api.FlowLogRecord{
+				Time:     "2023-06-01T08:01:57.000Z",
+				Verdict:  "allow",
+				Severity: "alert",
+				Protocol: "udp",
+				SrcIp:    "10.0.0.2",
+				DstIp:    "10.0.0.3",
+				SrcPort:  68,
+				DstPort:  67,
+			},
+		},
+		{
+			name: "other module",
+			line: `2023-06-01T08:01:58.000Z|00045|binding|INFO|Claiming lport vnet-xxx for this chassis.`,
+			err:  ErrNotAclLog,
+		},
+		{
+			name: "truncated",
+			line: `2023-06-01T08:01:59.000Z|00046|acl_log(ovn_pinctrl0)|INFO|name="fl-abc", verdict=allow`,
+			err:  errors.ErrInvalidFormat,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseAclLogLine(c.line)
+			if c.err != nil {
+				if errors.Cause(err) != c.err {
+					t.Fatalf("want error %v, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("want %#v\ngot  %#v", c.want, got)
+			}
+		})
+	}
+}
@@ -30,6 +30,7 @@ type Arch interface {
 	GenerateQgaDesc(qgaPath string) *desc.SGuestQga
 	GeneratePvpanicDesc() *desc.SGuestPvpanic
 	GenerateIsaSerialDesc() *desc.SGuestIsaSerial
+	GenerateTpmDesc(socketPath string, stateDir string) *desc.SGuestTpm
 }
 
 type KVMGuestInstance interface {
@@ -87,3 +88,19 @@ func (*archBase) GeneratePvpanicDesc() *desc.SGuestPvpanic {
 func (*archBase) GenerateIsaSerialDesc() *desc.SGuestIsaSerial {
 	return nil
 }
+
+func newTpmDesc(model string, socketPath string, stateDir string) *desc.SGuestTpm {
+	socket := &desc.CharDev{
+		Backend: "socket",
+		Id:      "chrtpm",
+		Options: map[string]string{
+			"path": socketPath,
+		},
+	}
+	return &desc.SGuestTpm{
+		Id:       "tpm0",
+		Model:    model,
+		Socket:   socket,
+		StateDir: stateDir,
+	}
+}
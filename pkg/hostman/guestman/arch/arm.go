@@ -37,6 +37,10 @@ type ARM struct {
 
 // -device scsi-cd,drive=cd0,share-rw=true
 // if=none,file=%s,id=cd0,media=cdrom
+func (*ARM) GenerateTpmDesc(socketPath string, stateDir string) *desc.SGuestTpm {
+	return newTpmDesc("tpm-tis-device", socketPath, stateDir)
+}
+
 func (*ARM) GenerateCdromDesc(osName string, cdrom *desc.SGuestCdrom) {
 	id := fmt.Sprintf("scsi%d-cd0", cdrom.Ordinal)
 	scsiDev := desc.NewScsiDevice("", "scsi-cd", id)
@@ -53,6 +53,11 @@ func (*X86) GenerateIsaSerialDesc() *desc.SGuestIsaSerial {
 	}
 }
 
+// crb interface is required by windows 11
+func (*X86) GenerateTpmDesc(socketPath string, stateDir string) *desc.SGuestTpm {
+	return newTpmDesc("tpm-crb", socketPath, stateDir)
+}
+
 func (*X86) GenerateCdromDesc(osName string, cdrom *desc.SGuestCdrom) {
 	var id, devType string
 	var driveOpts map[string]string
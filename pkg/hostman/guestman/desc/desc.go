@@ -93,6 +93,20 @@ type SGuestMem struct {
 
 	// hotplug mem devices
 	MemSlots []*SMemSlot `json:",omitempty"`
+
+	// virtio-mem device, resize memory online in block granularity
+	VirtioMem *SGuestVirtioMem `json:",omitempty"`
+}
+
+type SGuestVirtioMem struct {
+	*PCIDevice
+
+	MemObj *SMemDesc
+
+	BlockSizeMB int64
+	MaxSizeMB   int64
+	// plugged memory size requested to guest
+	RequestedSizeMB int64
 }
 
 type SGuestHardwareDesc struct {
@@ -108,6 +122,9 @@ type SGuestHardwareDesc struct {
 	Bios      string
 	BootOrder string
 
+	// boot with secure boot capable OVMF and enrolled keys, UEFI only
+	SecureBoot bool `json:",omitempty"`
+
 	// supported machine type: pc, q35, virt
 	Machine     string
 	MachineDesc *SGuestMachine `json:",omitempty"`
@@ -137,6 +154,8 @@ type SGuestHardwareDesc struct {
 	Qga       *SGuestQga       `json:",omitempty"`
 	Pvpanic   *SGuestPvpanic   `json:",omitempty"`
 	IsaSerial *SGuestIsaSerial `json:",omitempty"`
+	// swtpm backed TPM 2.0 device
+	Tpm *SGuestTpm `json:",omitempty"`
 
 	Usb            *UsbController   `json:",omitempty"`
 	PCIControllers []*PCIController `json:",omitempty"`
@@ -172,6 +191,19 @@ type SGuestPvpanic struct {
 	Id     string
 }
 
+// -chardev socket,id=chrtpm,path=swtpm.sock
+// -tpmdev emulator,id=tpm0,chardev=chrtpm
+// -device tpm-crb,tpmdev=tpm0
+
+type SGuestTpm struct {
+	Id string
+	// tpm-crb on x86_64, tpm-tis-device on aarch64
+	Model  string
+	Socket *CharDev
+	// persistent state directory of swtpm
+	StateDir string
+}
+
 // -device pcie-pci-bridge,id=pci.1,bus=pcie.0 \
 // -device pci-bridge,id=pci.2,bus=pci.1,chassis_nr=1,addr=0x01 \
 
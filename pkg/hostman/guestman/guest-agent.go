@@ -145,6 +145,26 @@ func (m *SGuestManager) QgaGetOsInfo(sid string) (jsonutils.JSONObject, error) {
 	return jsonutils.Marshal(res), nil
 }
 
+func (m *SGuestManager) QgaFsFreeze(sid string) (jsonutils.JSONObject, error) {
+	guest, err := m.checkAndInitGuestQga(sid)
+	if err != nil {
+		return nil, err
+	}
+	res := jsonutils.NewDict()
+	res.Set("frozen", jsonutils.NewBool(guest.FsFreeze()))
+	return res, nil
+}
+
+func (m *SGuestManager) QgaFsThaw(sid string) (jsonutils.JSONObject, error) {
+	guest, _ := m.GetKVMServer(sid)
+	if guest == nil {
+		return nil, httperrors.NewNotFoundError("Not found guest by id %s", sid)
+	}
+	res := jsonutils.NewDict()
+	res.Set("quiesced", jsonutils.NewBool(guest.FsThaw()))
+	return res, nil
+}
+
 func (guest *SKVMGuestInstance) QgaAddNicsConfigure(addNics []*desc.SGuestNetwork) error {
 	if guest.guestAgent == nil {
 		if err := guest.InitQga(); err != nil {
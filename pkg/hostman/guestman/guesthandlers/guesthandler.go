@@ -111,6 +111,8 @@ func AddGuestTaskHandler(prefix string, app *appsrv.Application) {
 			"qga-get-network":          qgaGetNetwork,
 			"qga-set-network":          qgaSetNetwork,
 			"qga-get-os-info":          qgaGetOsInfo,
+			"qga-fs-freeze":            qgaFsFreeze,
+			"qga-fs-thaw":              qgaFsThaw,
 			"start-rescue":             guestStartRescue,
 		} {
 			app.AddHandler("POST",
@@ -431,6 +433,14 @@ func guestDestPrepareMigrateInternal(ctx context.Context, userCred mcclient.Toke
 
 		}
 		params.RebaseDisks = jsonutils.QueryBoolean(body, "rebase_disks", false)
+
+		if body.Contains("tpm_state") {
+			tpmState := map[string]string{}
+			if err := body.Unmarshal(&tpmState, "tpm_state"); err != nil {
+				return httperrors.NewInputParameterError("unmarshal tpm_state to map: %s", err)
+			}
+			params.TpmState = tpmState
+		}
 	}
 
 	msUri, err := body.GetString("memory_snapshots_uri")
@@ -587,11 +597,18 @@ func guestHotplugCpuMem(ctx context.Context, userCred mcclient.TokenCredential,
 
 	addCpuCount, _ := body.Int("add_cpu")
 	addMemSize, _ := body.Int("add_mem")
+	delCpuCount, _ := body.Int("del_cpu")
+	delMemSize, _ := body.Int("del_mem")
+	if (addCpuCount > 0 && delCpuCount > 0) || (addMemSize > 0 && delMemSize > 0) {
+		return nil, httperrors.NewInputParameterError("can't add and delete cpu or mem at the same time")
+	}
 
 	input := &guestman.SGuestHotplugCpuMem{
 		Sid:         sid,
 		AddCpuCount: addCpuCount,
 		AddMemSize:  addMemSize,
+		DelCpuCount: delCpuCount,
+		DelMemSize:  delMemSize,
 	}
 	totalMemSize, err := body.Int("total_mem")
 	if err == nil {
@@ -693,6 +710,7 @@ func guestSnapshot(ctx context.Context, userCred mcclient.TokenCredential, sid s
 		Sid:        sid,
 		SnapshotId: snapshotId,
 		Disk:       disk,
+		Consistent: jsonutils.QueryBoolean(body, "consistent", false),
 	}
 
 	if body.Contains("backup_disk_config") {
@@ -954,6 +972,14 @@ func qgaGuestPing(ctx context.Context, userCred mcclient.TokenCredential, sid st
 	}
 }
 
+func qgaFsFreeze(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	return guestman.GetGuestManager().QgaFsFreeze(sid)
+}
+
+func qgaFsThaw(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	return guestman.GetGuestManager().QgaFsThaw(sid)
+}
+
 func qgaCommand(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
 	gm := guestman.GetGuestManager()
 	input := computeapi.ServerQgaCommandInput{}
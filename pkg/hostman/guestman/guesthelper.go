@@ -80,6 +80,9 @@ type SDestPrepareMigrate struct {
 	MemorySnapshotsUri string
 	SrcMemorySnapshots []string
 
+	// swtpm state files of system disk on local storage, carried by cold migration
+	TpmState map[string]string
+
 	UserCred mcclient.TokenCredential
 }
 
@@ -108,6 +111,10 @@ type SGuestHotplugCpuMem struct {
 	TotalCpuCount *int64
 	TotalMemSize  *int64
 
+	// hot unplug cpu count and shrink memory size
+	DelCpuCount int64
+	DelMemSize  int64
+
 	CpuNumaPin []*desc.SCpuNumaPin
 }
 
@@ -128,6 +135,8 @@ type SDiskSnapshot struct {
 	SnapshotId       string
 	BackupDiskConfig *SBackupDiskConfig
 	Disk             storageman.IDisk
+	// freeze guest filesystems by qga during snapshot
+	Consistent bool
 }
 
 type SMemorySnapshot struct {
@@ -1145,6 +1145,16 @@ func (m *SGuestManager) SrcPrepareMigrate(ctx context.Context, params interface{
 		}
 		ret.Set("migrate_certs", jsonutils.Marshal(certs))
 	}
+	// tpm state travels within the qemu migration stream on live migration
+	if !migParams.LiveMigrate && guest.Desc.Tpm != nil && guest.isTpmStateOnLocalStorage() {
+		tpmState, err := storageman.PackTpmState(guest.getSysDiskDesc().Path)
+		if err != nil {
+			return nil, errors.Wrap(err, "PackTpmState")
+		}
+		if len(tpmState) > 0 {
+			ret.Set("tpm_state", jsonutils.Marshal(tpmState))
+		}
+	}
 	if migParams.LiveMigrate {
 		if guest.GetDesc().Machine == "" {
 			guest.GetDesc().Machine = guest.getMachine()
@@ -1197,6 +1207,11 @@ func (m *SGuestManager) DestPrepareMigrate(ctx context.Context, params interface
 			log.Errorln(err)
 			return nil, err
 		}
+		if len(migParams.TpmState) > 0 {
+			if err := m.destinationPrepareMigrateTpmState(migParams); err != nil {
+				return nil, errors.Wrap(err, "destination prepare migrate tpm state")
+			}
+		}
 	}
 
 	for _, disk := range guest.Desc.Disks {
@@ -1250,6 +1265,25 @@ func (m *SGuestManager) DestPrepareMigrate(ctx context.Context, params interface
 	return body, nil
 }
 
+func (m *SGuestManager) destinationPrepareMigrateTpmState(migParams *SDestPrepareMigrate) error {
+	disks := migParams.Desc.Disks
+	for i := 0; i < len(disks) && i < len(migParams.TargetStorageIds); i++ {
+		if disks[i].Index != 0 {
+			continue
+		}
+		iStorage := storageman.GetManager().GetStorage(migParams.TargetStorageIds[i])
+		if iStorage == nil {
+			return errors.Errorf("Target storage %s not found", migParams.TargetStorageIds[i])
+		}
+		disk, err := iStorage.GetDiskById(disks[i].DiskId)
+		if err != nil {
+			return errors.Wrapf(err, "GetDiskById(%s)", disks[i].DiskId)
+		}
+		return storageman.UnpackTpmState(disk.GetPath(), migParams.TpmState)
+	}
+	return errors.Errorf("guest %s has no system disk to restore tpm state", migParams.Sid)
+}
+
 func (m *SGuestManager) destinationPrepareMigrateMemorySnapshots(ctx context.Context, serverId string, uri string, ids []string) (map[string]string, error) {
 	ret := make(map[string]string, 0)
 	for _, id := range ids {
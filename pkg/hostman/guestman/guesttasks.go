@@ -41,6 +41,7 @@ import (
 	"yunion.io/x/onecloud/pkg/hostman/hostutils"
 	"yunion.io/x/onecloud/pkg/hostman/isolated_device"
 	"yunion.io/x/onecloud/pkg/hostman/monitor"
+	"yunion.io/x/onecloud/pkg/hostman/monitor/qga"
 	"yunion.io/x/onecloud/pkg/hostman/options"
 	"yunion.io/x/onecloud/pkg/hostman/storageman"
 	"yunion.io/x/onecloud/pkg/mcclient/auth"
@@ -2097,17 +2098,32 @@ type SGuestDiskSnapshotTask struct {
 	*SGuestReloadDiskTask
 
 	snapshotId string
+	// thaw guest filesystems frozen before snapshot, nil if not quiesced
+	thaw qga.FsThawFunc
+	// filesystems are frozen by the instance operation and thawed by it
+	instanceFrozen bool
 }
 
 func NewGuestDiskSnapshotTask(
-	ctx context.Context, s *SKVMGuestInstance, disk storageman.IDisk, snapshotId string,
+	ctx context.Context, s *SKVMGuestInstance, disk storageman.IDisk, snapshotId string, thaw qga.FsThawFunc, instanceFrozen bool,
 ) *SGuestDiskSnapshotTask {
 	return &SGuestDiskSnapshotTask{
 		SGuestReloadDiskTask: NewGuestReloadDiskTask(ctx, s, disk),
 		snapshotId:           snapshotId,
+		thaw:                 thaw,
+		instanceFrozen:       instanceFrozen,
 	}
 }
 
+// thawFilesystems returns whether the guest stayed quiesced until the
+// snapshot was taken
+func (s *SGuestDiskSnapshotTask) thawFilesystems() bool {
+	if s.instanceFrozen {
+		return s.isFilesystemsFrozen()
+	}
+	return s.SKVMGuestInstance.thawFilesystems(s.thaw)
+}
+
 func (s *SGuestDiskSnapshotTask) Start() {
 	s.fetchDisksInfo(s.startSnapshot)
 }
@@ -2127,6 +2143,7 @@ func (s *SGuestDiskSnapshotTask) onReloadBlkdevSucc(res string) {
 }
 
 func (s *SGuestDiskSnapshotTask) onSnapshotBlkdevFail(reason string) {
+	s.thawFilesystems()
 	// rollback snapshot to disk file
 	if err := s.disk.RollbackDiskOnSnapshotFail(s.snapshotId); err != nil {
 		log.Errorf("failed do rollback %s", err)
@@ -2137,9 +2154,11 @@ func (s *SGuestDiskSnapshotTask) onSnapshotBlkdevFail(reason string) {
 
 func (s *SGuestDiskSnapshotTask) onResumeSucc(res string) {
 	log.Infof("guest disk snapshot task resume succ %s", res)
+	quiesced := s.thawFilesystems()
 	snapshotLocation := path.Join(s.disk.GetSnapshotLocation(), s.snapshotId)
 	body := jsonutils.NewDict()
 	body.Set("location", jsonutils.NewString(snapshotLocation))
+	body.Set("quiesced", jsonutils.NewBool(quiesced))
 	hostutils.TaskComplete(s.ctx, body)
 }
 
@@ -2504,6 +2523,11 @@ func (task *SGuestOnlineResizeDiskTask) OnResizeSucc(err string) {
  *  GuestHotplugCpuMem
 **/
 
+const (
+	// wait guest acknowledge cpu eject or virtio-mem (un)plug, in seconds
+	HOTPLUG_WAIT_GUEST_RETRY = 60
+)
+
 type SGuestHotplugCpuMemTask struct {
 	*SKVMGuestInstance
 
@@ -2521,6 +2545,12 @@ type SGuestHotplugCpuMemTask struct {
 	memSlotNewIndex  *int
 	memSlotNewIndexs []int
 	memSlots         []*desc.SMemSlot
+
+	delCpuCount     int
+	deletedCpuCount int
+	delMemSize      int
+	// plugged size of virtio-mem device after resize
+	virtioMemSizeMB *int64
 }
 
 func NewGuestHotplugCpuMemTask(
@@ -2532,6 +2562,8 @@ func NewGuestHotplugCpuMemTask(
 		addCpuCount:       int(input.AddCpuCount),
 		addMemSize:        int(input.AddMemSize),
 		cpuNumaPin:        input.CpuNumaPin,
+		delCpuCount:       int(input.DelCpuCount),
+		delMemSize:        int(input.DelMemSize),
 	}
 	if input.TotalCpuCount != nil && input.AddCpuCount > 0 {
 		if s.Desc.Cpu > *input.TotalCpuCount {
@@ -2539,22 +2571,36 @@ func NewGuestHotplugCpuMemTask(
 			t.addCpuCount -= addedCpuCount
 		}
 	}
-	log.Infof("guest %s add cpu count %d", s.Id, t.addCpuCount)
+	if input.TotalCpuCount != nil && input.DelCpuCount > 0 {
+		if s.Desc.Cpu < *input.TotalCpuCount {
+			deletedCpuCount := int(*input.TotalCpuCount - s.Desc.Cpu)
+			t.delCpuCount -= deletedCpuCount
+		}
+	}
+	log.Infof("guest %s add cpu count %d, del cpu count %d", s.Id, t.addCpuCount, t.delCpuCount)
 	if input.TotalMemSize != nil && input.AddMemSize > 0 {
 		if s.Desc.Mem > *input.TotalMemSize {
 			addedMemSize := int(s.Desc.Mem - *input.TotalMemSize)
 			t.addMemSize -= addedMemSize
 		}
 	}
-	log.Infof("guest %s add mem size %d", s.Id, t.addMemSize)
+	if input.TotalMemSize != nil && input.DelMemSize > 0 {
+		if s.Desc.Mem < *input.TotalMemSize {
+			deletedMemSize := int(*input.TotalMemSize - s.Desc.Mem)
+			t.delMemSize -= deletedMemSize
+		}
+	}
+	log.Infof("guest %s add mem size %d, del mem size %d", s.Id, t.addMemSize, t.delMemSize)
 	return t
 }
 
-// First at all add cpu count, second add mem size
+// First at all add or del cpu count, second add or del mem size
 func (task *SGuestHotplugCpuMemTask) Start() {
 	if task.addCpuCount > 0 {
 		task.startAddCpu()
-	} else if task.addMemSize > 0 {
+	} else if task.delCpuCount > 0 {
+		task.startDelCpu()
+	} else if task.addMemSize > 0 || task.delMemSize > 0 {
 		task.startAddMem()
 	} else {
 		task.onSucc()
@@ -2664,14 +2710,187 @@ func (task *SGuestHotplugCpuMemTask) onAddCpu(reason string) {
 	task.doAddCpu()
 }
 
+func (task *SGuestHotplugCpuMemTask) startDelCpu() {
+	if len(task.Desc.CpuNumaPin) > 0 {
+		task.onFail("hot unplug cpu of guest with cpu numa pin is not supported")
+		return
+	}
+	task.Monitor.GetHotPluggableCpus(task.onGetHotPluggableCpus)
+}
+
+func (task *SGuestHotplugCpuMemTask) onGetHotPluggableCpus(cpus []monitor.HotpluggableCPU, reason string) {
+	if len(reason) > 0 {
+		task.onFail(reason)
+		return
+	}
+	qomPath := getLastPluggedCpuQomPath(cpus)
+	if len(qomPath) == 0 {
+		task.onFail("no cpu can be hot unplugged")
+		return
+	}
+	task.Monitor.DeviceDel(qomPath, func(reason string) {
+		if len(reason) > 0 {
+			task.onFail(fmt.Sprintf("device_del cpu %s: %s", qomPath, reason))
+			return
+		}
+		task.waitCpuUnplugged(qomPath, 0)
+	})
+}
+
+// cpu is unplugged after guest acknowledge the acpi eject request
+func (task *SGuestHotplugCpuMemTask) waitCpuUnplugged(qomPath string, retry int) {
+	task.Monitor.GetHotPluggableCpus(func(cpus []monitor.HotpluggableCPU, reason string) {
+		if len(reason) > 0 {
+			task.onFail(reason)
+			return
+		}
+		for i := range cpus {
+			if cpus[i].QomPath == nil || *cpus[i].QomPath != qomPath {
+				continue
+			}
+			if retry >= HOTPLUG_WAIT_GUEST_RETRY {
+				task.onFail(fmt.Sprintf("guest not release cpu %s", qomPath))
+				return
+			}
+			time.Sleep(time.Second)
+			task.waitCpuUnplugged(qomPath, retry+1)
+			return
+		}
+
+		task.deletedCpuCount += 1
+		if task.deletedCpuCount < task.delCpuCount {
+			task.startDelCpu()
+		} else {
+			task.startAddMem()
+		}
+	})
+}
+
+// plugged cpu with the largest topology ids, boot cpu is never unplugged
+func getLastPluggedCpuQomPath(cpus []monitor.HotpluggableCPU) string {
+	propsKey := func(props monitor.CPUInstanceProperties) [3]int64 {
+		key := [3]int64{}
+		for i, id := range []*int64{props.SocketID, props.CoreID, props.ThreadID} {
+			if id != nil {
+				key[i] = *id
+			}
+		}
+		return key
+	}
+	less := func(a, b [3]int64) bool {
+		for i := range a {
+			if a[i] != b[i] {
+				return a[i] < b[i]
+			}
+		}
+		return false
+	}
+
+	var (
+		qomPath string
+		lastKey [3]int64
+		plugged int
+	)
+	for i := range cpus {
+		if cpus[i].QomPath == nil {
+			continue
+		}
+		plugged += 1
+		key := propsKey(cpus[i].Props)
+		if len(qomPath) == 0 || less(lastKey, key) {
+			qomPath = *cpus[i].QomPath
+			lastKey = key
+		}
+	}
+	if plugged <= 1 {
+		return ""
+	}
+	return qomPath
+}
+
 func (task *SGuestHotplugCpuMemTask) startAddMem() {
-	if task.addMemSize > 0 {
+	if task.Desc.MemDesc.VirtioMem != nil && (task.addMemSize > 0 || task.delMemSize > 0) {
+		task.startResizeVirtioMem()
+	} else if task.delMemSize > 0 {
+		task.onFail("hot unplug memory requires virtio-mem device")
+	} else if task.addMemSize > 0 {
 		task.Monitor.GeMemtSlotIndex(task.onGetSlotIndex)
 	} else {
 		task.onSucc()
 	}
 }
 
+func (task *SGuestHotplugCpuMemTask) virtioMemQomPath() string {
+	return fmt.Sprintf("/machine/peripheral/%s", task.Desc.MemDesc.VirtioMem.Id)
+}
+
+func (task *SGuestHotplugCpuMemTask) startResizeVirtioMem() {
+	vmem := task.Desc.MemDesc.VirtioMem
+	requestedSizeMB := vmem.RequestedSizeMB + int64(task.addMemSize-task.delMemSize)
+	if requestedSizeMB < 0 {
+		task.onFail(fmt.Sprintf("can't shrink memory below boot memory %dM", task.Desc.MemDesc.SizeMB))
+		return
+	}
+	if requestedSizeMB > vmem.MaxSizeMB {
+		task.onFail(fmt.Sprintf("virtio-mem requested size %dM exceeds max size %dM", requestedSizeMB, vmem.MaxSizeMB))
+		return
+	}
+	if requestedSizeMB%vmem.BlockSizeMB != 0 {
+		task.onFail(fmt.Sprintf("virtio-mem requested size %dM not aligned to block size %dM", requestedSizeMB, vmem.BlockSizeMB))
+		return
+	}
+
+	cb := func(reason string) {
+		if len(reason) > 0 {
+			task.onFail(fmt.Sprintf("set virtio-mem requested size: %s", reason))
+			return
+		}
+		task.waitVirtioMemResized(requestedSizeMB, 0)
+	}
+	task.Monitor.QomSet(task.virtioMemQomPath(), "requested-size", requestedSizeMB*1024*1024, cb)
+}
+
+// guest driver plugs or unplugs memory blocks until reaching requested size
+func (task *SGuestHotplugCpuMemTask) waitVirtioMemResized(requestedSizeMB int64, retry int) {
+	vmem := task.Desc.MemDesc.VirtioMem
+	task.Monitor.GetMemoryDevicesInfo(func(devs []monitor.MemoryDeviceInfo, reason string) {
+		if len(reason) > 0 {
+			task.onFail(reason)
+			return
+		}
+		var pluggedSizeMB int64 = -1
+		for i := range devs {
+			if devs[i].Type == "virtio-mem" && devs[i].Data.ID != nil && *devs[i].Data.ID == vmem.Id {
+				pluggedSizeMB = devs[i].Data.Size / 1024 / 1024
+				break
+			}
+		}
+		if pluggedSizeMB < 0 {
+			task.onFail(fmt.Sprintf("virtio-mem device %s not found", vmem.Id))
+			return
+		}
+		if pluggedSizeMB == requestedSizeMB {
+			task.virtioMemSizeMB = &pluggedSizeMB
+			task.onSucc()
+			return
+		}
+		if retry < HOTPLUG_WAIT_GUEST_RETRY {
+			time.Sleep(time.Second)
+			task.waitVirtioMemResized(requestedSizeMB, retry+1)
+			return
+		}
+
+		// guest can't reach requested size, settle on the plugged size
+		task.virtioMemSizeMB = &pluggedSizeMB
+		task.Monitor.QomSet(task.virtioMemQomPath(), "requested-size", pluggedSizeMB*1024*1024, func(res string) {
+			if len(res) > 0 {
+				log.Errorf("guest %s reset virtio-mem requested size: %s", task.GetName(), res)
+			}
+			task.onFail(fmt.Sprintf("virtio-mem plugged size %dM, requested %dM", pluggedSizeMB, requestedSizeMB))
+		})
+	})
+}
+
 func (task *SGuestHotplugCpuMemTask) onGetSlotIndex(index int) {
 	var newIndex = index
 	if task.Desc.MemDesc.Mem != nil {
@@ -2804,10 +3023,18 @@ func (task *SGuestHotplugCpuMemTask) onAddMemDevice(reason string, memSlot *desc
 }
 
 func (task *SGuestHotplugCpuMemTask) updateGuestDesc() {
-	task.Desc.Cpu += int64(task.addedCpuCount)
-	task.Desc.CpuDesc.Cpus += uint(task.addedCpuCount)
+	task.Desc.Cpu += int64(task.addedCpuCount - task.deletedCpuCount)
+	task.Desc.CpuDesc.Cpus = task.Desc.CpuDesc.Cpus + uint(task.addedCpuCount) - uint(task.deletedCpuCount)
 	task.Desc.Mem += int64(task.addedMemSize)
 
+	virtioMemResized := false
+	if task.virtioMemSizeMB != nil {
+		vmem := task.Desc.MemDesc.VirtioMem
+		virtioMemResized = *task.virtioMemSizeMB != vmem.RequestedSizeMB
+		task.Desc.Mem += *task.virtioMemSizeMB - vmem.RequestedSizeMB
+		vmem.RequestedSizeMB = *task.virtioMemSizeMB
+	}
+
 	if len(task.cpuNumaPin) > 0 {
 		task.Desc.CpuNumaPin = append(task.Desc.CpuNumaPin, task.cpuNumaPin...)
 	}
@@ -2829,14 +3056,14 @@ func (task *SGuestHotplugCpuMemTask) updateGuestDesc() {
 	if len(task.addedVcpuIds) > 0 {
 		task.setCgroupCPUSet()
 	}
-	if task.addedCpuCount > 0 && len(task.Desc.VcpuPin) == 1 {
+	if (task.addedCpuCount > 0 || task.deletedCpuCount > 0) && len(task.Desc.VcpuPin) == 1 {
 		task.Desc.VcpuPin[0].Vcpus = fmt.Sprintf("0-%d", task.Desc.Cpu-1)
 	}
 
-	if task.addedCpuCount > 0 || task.addedMemSize > 0 {
+	if task.addedCpuCount > 0 || task.deletedCpuCount > 0 || task.addedMemSize > 0 || virtioMemResized {
 		SaveLiveDesc(task, task.Desc)
 	}
-	if task.addedMemSize > 0 {
+	if task.addedMemSize > 0 || task.deletedCpuCount > 0 || virtioMemResized {
 		vncPort := task.GetVncPort()
 		data := jsonutils.NewDict()
 		data.Set("vnc_port", jsonutils.NewInt(int64(vncPort)))
@@ -2852,10 +3079,17 @@ func (task *SGuestHotplugCpuMemTask) onFail(reason string) {
 	if task.addedCpuCount < task.addCpuCount {
 		body.Set("add_cpu_failed", jsonutils.JSONTrue)
 		body.Set("added_cpu", jsonutils.NewInt(int64(task.addedCpuCount)))
-	} else if task.memSlotNewIndex != nil {
+	} else if task.deletedCpuCount < task.delCpuCount {
+		body.Set("del_cpu_failed", jsonutils.JSONTrue)
+		body.Set("deleted_cpu", jsonutils.NewInt(int64(task.deletedCpuCount)))
+	} else if task.memSlotNewIndex != nil || task.Desc.MemDesc.VirtioMem != nil {
 		body.Set("add_mem_failed", jsonutils.JSONTrue)
 	}
 	task.updateGuestDesc()
+	if task.virtioMemSizeMB != nil {
+		// memory partially plugged or unplugged by virtio-mem
+		body.Set("vmem_size", jsonutils.NewInt(task.Desc.Mem))
+	}
 	hostutils.TaskFailed2(task.ctx, reason, body)
 }
 
@@ -96,9 +96,14 @@ func (s *SKVMGuestInstance) initGuestDevicesDesc(pciRoot, pciBridge *desc.PCICon
 	s.initIsolatedDevices(pciRoot, pciBridge)
 	s.initUsbController(pciRoot)
 	s.initRandomDevice(pciRoot, options.HostOptions.EnableVirtioRngDevice)
+	s.initVirtioMemDevice(pciRoot)
 	s.initQgaDesc()
 	s.initPvpanicDesc()
 	s.initIsaSerialDesc()
+	if err := s.initTpmDesc(); err != nil {
+		return errors.Wrap(err, "init tpm desc")
+	}
+	s.initSecureBootDesc()
 	return nil
 }
 
@@ -251,6 +256,13 @@ func (s *SKVMGuestInstance) cleanGuestPciAddressed() {
 	s.pciAddrs = nil
 }
 
+func (s *SKVMGuestInstance) initVirtioMemDevice(pciRoot *desc.PCIController) {
+	if !s.isVirtioMemEnabled() || s.Desc.MemDesc.VirtioMem.PCIDevice != nil {
+		return
+	}
+	s.Desc.MemDesc.VirtioMem.PCIDevice = desc.NewPCIDevice(pciRoot.CType, "virtio-mem-pci", "vmem0")
+}
+
 func (s *SKVMGuestInstance) initRandomDevice(pciRoot *desc.PCIController, enableVirtioRngDevice bool) {
 	if !enableVirtioRngDevice {
 		return
@@ -744,6 +756,13 @@ func (s *SKVMGuestInstance) ensurePciAddresses() error {
 		}
 	}
 
+	if s.isVirtioMemEnabled() && s.Desc.MemDesc.VirtioMem.PCIDevice != nil {
+		err = s.ensureDevicePciAddress(s.Desc.MemDesc.VirtioMem.PCIDevice, -1, nil)
+		if err != nil {
+			return errors.Wrap(err, "ensure virtio-mem device pci address")
+		}
+	}
+
 	anonymousPCIDevs := s.Desc.AnonymousPCIDevs[:0]
 	for i := 0; i < len(s.Desc.AnonymousPCIDevs); i++ {
 		if s.isMachineDefaultAddress(s.Desc.AnonymousPCIDevs[i].PCIAddr) {
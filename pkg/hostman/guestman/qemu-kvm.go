@@ -21,9 +21,11 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -104,6 +106,10 @@ type SKVMInstanceRuntime struct {
 
 	pciUninitialized bool
 	pciAddrs         *desc.SGuestPCIAddresses
+
+	// thaw the filesystems frozen for all disks of an instance snapshot or backup
+	fsThaw     qga.FsThawFunc
+	fsThawLock sync.Mutex
 }
 
 type SKVMGuestInstance struct {
@@ -960,6 +966,8 @@ func (s *SKVMGuestInstance) onImportGuestMonitorConnected(ctx context.Context) {
 		meta := jsonutils.NewDict()
 		meta.Set(api.VM_METADATA_HOTPLUG_CPU_MEM, jsonutils.NewString("disable"))
 		meta.Set(api.VM_METADATA_HOT_REMOVE_NIC, jsonutils.NewString("disable"))
+		meta.Set(api.VM_METADATA_HOT_UNPLUG_CPU, jsonutils.NewString("disable"))
+		meta.Set(api.VM_METADATA_VIRTIO_MEM, jsonutils.NewString("disable"))
 		meta.Set("__qemu_version", jsonutils.NewString(s.GetQemuVersionStr()))
 		s.SyncMetadata(meta)
 		s.SyncStatus("")
@@ -2462,6 +2470,8 @@ func (s *SKVMGuestInstance) onNicChange(oldNic, newNic *desc.SGuestNetwork) erro
 	log.Infof("nic changed old: %s new: %s", jsonutils.Marshal(oldNic), jsonutils.Marshal(newNic))
 	// override network base desc
 	oldNic.GuestnetworkBaseDesc = newNic.GuestnetworkBaseDesc
+	qosChanged := !reflect.DeepEqual(oldNic.QosPolicy, newNic.QosPolicy)
+	oldNic.QosPolicy = newNic.QosPolicy
 
 	if oldNic.Driver == "vfio-pci" {
 		err := s.reconfigureVfioNicsBandwidth(oldNic)
@@ -2517,6 +2527,19 @@ func (s *SKVMGuestInstance) onNicChange(oldNic, newNic *desc.SGuestNetwork) erro
 			}
 		}
 	}
+	if qosChanged {
+		dev := s.manager.GetHost().GetBridgeDev(oldNic.Bridge)
+		if dev == nil {
+			return fmt.Errorf("Can't find bridge %s", oldNic.Bridge)
+		}
+		if err := dev.ApplyNicQos(oldNic); err != nil {
+			log.Errorf("failed apply qos of nic %s:%s: %s", s.GetId(), oldNic.Mac, err)
+		}
+		// keep ifup/ifdown scripts in line with the qos applied
+		if err := s.generateNicScripts(oldNic); err != nil {
+			log.Errorf("failed regenerate scripts of nic %s:%s: %s", s.GetId(), oldNic.Mac, err)
+		}
+	}
 	return nil
 }
 
@@ -2947,6 +2970,16 @@ func (s *SKVMGuestInstance) OnResumeSyncMetadataInfo() {
 	meta.Set("__enable_cgroup_cpuset", jsonutils.JSONTrue)
 	meta.Set(api.VM_METADATA_HOTPLUG_CPU_MEM, jsonutils.NewString("enable"))
 	meta.Set(api.VM_METADATA_HOT_REMOVE_NIC, jsonutils.NewString("enable"))
+	if s.isCpuHotUnplugSupported() {
+		meta.Set(api.VM_METADATA_HOT_UNPLUG_CPU, jsonutils.NewString("enable"))
+	} else {
+		meta.Set(api.VM_METADATA_HOT_UNPLUG_CPU, jsonutils.NewString("disable"))
+	}
+	if s.isVirtioMemEnabled() {
+		meta.Set(api.VM_METADATA_VIRTIO_MEM, jsonutils.NewString("enable"))
+	} else {
+		meta.Set(api.VM_METADATA_VIRTIO_MEM, jsonutils.NewString("disable"))
+	}
 	if len(s.VncPassword) > 0 {
 		meta.Set("__vnc_password", jsonutils.NewString(s.VncPassword))
 	}
@@ -3141,11 +3174,83 @@ func (s *SKVMGuestInstance) ExecReloadDiskTask(ctx context.Context, disk storage
 }
 
 func (s *SKVMGuestInstance) DoSnapshot(ctx context.Context, snapshotParams *SDiskSnapshot) (jsonutils.JSONObject, error) {
-	return s.ExecDiskSnapshotTask(ctx, snapshotParams.UserCred, snapshotParams.Disk, snapshotParams.SnapshotId)
+	return s.ExecDiskSnapshotTask(ctx, snapshotParams.UserCred, snapshotParams.Disk, snapshotParams.SnapshotId, snapshotParams.Consistent)
+}
+
+// freezeFilesystems quiesces guest filesystems by qga, a nil thaw func is
+// returned when the guest can't be quiesced and the snapshot falls back to
+// crash consistent
+func (s *SKVMGuestInstance) freezeFilesystems() qga.FsThawFunc {
+	if s.guestAgent == nil {
+		if err := s.InitQga(); err != nil {
+			log.Warningf("guest %s init qga: %s", s.GetName(), err)
+			return nil
+		}
+	}
+	thaw, err := s.guestAgent.FsFreeze(qga.QGA_FSFREEZE_TIMEOUT_SECOND, time.Duration(qga.QGA_FSFREEZE_AUTO_THAW_SECOND)*time.Second)
+	if err != nil {
+		log.Warningf("guest %s freeze filesystems: %s", s.GetName(), err)
+		return nil
+	}
+	return thaw
+}
+
+// thawFilesystems thaws the filesystems frozen by freezeFilesystems and
+// returns whether they stayed frozen until now, the freeze is released early
+// if qga auto thaw fired or someone else thawed the guest
+func (s *SKVMGuestInstance) thawFilesystems(thaw qga.FsThawFunc) bool {
+	if thaw == nil {
+		return false
+	}
+	frozen := s.isFilesystemsFrozen()
+	if err := thaw(); err != nil {
+		log.Errorf("guest %s thaw filesystems: %s", s.GetName(), err)
+		return false
+	}
+	return frozen
+}
+
+func (s *SKVMGuestInstance) isFilesystemsFrozen() bool {
+	if s.guestAgent == nil {
+		return false
+	}
+	status, err := s.guestAgent.GuestFsFreezeStatus()
+	if err != nil {
+		log.Warningf("guest %s get fsfreeze status: %s", s.GetName(), err)
+		return false
+	}
+	return status == qga.QGA_FSFREEZE_STATUS_FROZEN
+}
+
+// FsFreeze freezes the guest filesystems once for all the disk snapshots of
+// an instance snapshot or backup, returns false if the guest can't be quiesced
+func (s *SKVMGuestInstance) FsFreeze() bool {
+	s.fsThawLock.Lock()
+	defer s.fsThawLock.Unlock()
+	if s.fsThaw == nil {
+		s.fsThaw = s.freezeFilesystems()
+	}
+	return s.fsThaw != nil
+}
+
+// FsThaw thaws the filesystems frozen by FsFreeze, returns whether they
+// stayed frozen for all the disk snapshots
+func (s *SKVMGuestInstance) FsThaw() bool {
+	s.fsThawLock.Lock()
+	defer s.fsThawLock.Unlock()
+	thaw := s.fsThaw
+	s.fsThaw = nil
+	return s.thawFilesystems(thaw)
+}
+
+func (s *SKVMGuestInstance) isFsFrozenByInstance() bool {
+	s.fsThawLock.Lock()
+	defer s.fsThawLock.Unlock()
+	return s.fsThaw != nil
 }
 
 func (s *SKVMGuestInstance) ExecDiskSnapshotTask(
-	ctx context.Context, userCred mcclient.TokenCredential, disk storageman.IDisk, snapshotId string,
+	ctx context.Context, userCred mcclient.TokenCredential, disk storageman.IDisk, snapshotId string, consistent bool,
 ) (jsonutils.JSONObject, error) {
 	var (
 		encryptKey = ""
@@ -3165,11 +3270,22 @@ func (s *SKVMGuestInstance) ExecDiskSnapshotTask(
 		if !s.isLiveSnapshotEnabled() {
 			return nil, fmt.Errorf("Guest dosen't support live snapshot")
 		}
+		var thaw qga.FsThawFunc
+		// filesystems frozen by the instance operation are thawed by FsThaw
+		instanceFrozen := consistent && s.isFsFrozenByInstance()
+		if consistent && !instanceFrozen {
+			thaw = s.freezeFilesystems()
+		}
 		err := disk.CreateSnapshot(snapshotId, encryptKey, encFormat, encAlg)
 		if err != nil {
+			if thaw != nil {
+				if err := thaw(); err != nil {
+					log.Errorf("guest %s thaw filesystems: %s", s.GetName(), err)
+				}
+			}
 			return nil, errors.Wrap(err, "disk.CreateSnapshot")
 		}
-		task := NewGuestDiskSnapshotTask(ctx, s, disk, snapshotId)
+		task := NewGuestDiskSnapshotTask(ctx, s, disk, snapshotId, thaw, instanceFrozen)
 		task.Start()
 		return nil, nil
 	} else {
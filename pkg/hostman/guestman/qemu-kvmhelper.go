@@ -30,6 +30,7 @@ import (
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
 	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/version"
 	"yunion.io/x/pkg/utils"
 
 	"yunion.io/x/onecloud/pkg/apis"
@@ -290,6 +291,14 @@ func (s *SKVMGuestInstance) disablePvpanicDev() bool {
 	return s.Desc.Metadata["disable_pvpanic"] == "true"
 }
 
+func (s *SKVMGuestInstance) isVtpmEnabled() bool {
+	return s.Desc.Metadata[api.VM_METADATA_ENABLE_VTPM] == "true"
+}
+
+func (s *SKVMGuestInstance) isSecureBootEnabled() bool {
+	return s.Desc.Metadata[api.VM_METADATA_ENABLE_SECURE_BOOT] == "true"
+}
+
 func (s *SKVMGuestInstance) getQuorumChildIndex() int64 {
 	if sidx, ok := s.Desc.Metadata[api.QUORUM_CHILD_INDEX]; ok {
 		idx, _ := strconv.ParseInt(sidx, 10, 0)
@@ -416,6 +425,10 @@ func (s *SKVMGuestInstance) generateStartScript(data *jsonutils.JSONDict) (strin
 	}
 	cmd += diskScripts
 
+	if s.Desc.Tpm != nil {
+		cmd += s.generateTpmStartScripts(jsonutils.QueryBoolean(data, "need_migrate", false))
+	}
+
 	sriovInitScripts, err := s.generateSRIOVInitScripts()
 	if err != nil {
 		return "", errors.Wrap(err, "generateSRIOVInitScripts")
@@ -504,8 +517,13 @@ function nic_mtu() {
 	input.EnableUUID = options.HostOptions.EnableVmUuid
 	if s.Desc.Bios == qemu.BIOS_UEFI {
 		if len(input.OVMFPath) == 0 {
-			input.OVMFPath = options.HostOptions.OvmfPath
-			input.OVMFVarsPath = options.HostOptions.OvmfVarsPath
+			if s.Desc.SecureBoot {
+				input.OVMFPath = options.HostOptions.OvmfSecbootPath
+				input.OVMFVarsPath = options.HostOptions.OvmfSecbootVarsPath
+			} else {
+				input.OVMFPath = options.HostOptions.OvmfPath
+				input.OVMFVarsPath = options.HostOptions.OvmfVarsPath
+			}
 		}
 	}
 
@@ -582,6 +600,33 @@ function nic_mtu() {
 	return cmd, nil
 }
 
+// generateTpmStartScripts launches swtpm as a daemon before qemu, swtpm
+// exits by itself once qemu closes the control channel
+func (s *SKVMGuestInstance) generateTpmStartScripts(needMigrate bool) string {
+	tpm := s.Desc.Tpm
+	pidFile := s.getTpmPidFilePath()
+	socket := s.getTpmSocketPath()
+
+	cmd := ""
+	cmd += fmt.Sprintf("if [ -f %s ]; then\n", pidFile)
+	cmd += fmt.Sprintf("    kill -9 $(cat %s) > /dev/null 2>&1\n", pidFile)
+	cmd += "fi\n"
+	cmd += fmt.Sprintf("rm -f %s %s\n", pidFile, socket)
+	cmd += fmt.Sprintf("mkdir -p %s\n", tpm.StateDir)
+	// the state dir may reside on shared storage, the lock is released by
+	// the outgoing side and taken by the incoming side once migrated
+	migration := "release-lock-outgoing"
+	if needMigrate {
+		migration += ",incoming"
+	}
+	cmd += fmt.Sprintf(
+		"%s socket --tpm2 --tpmstate dir=%s,mode=0600 --ctrl type=unixio,path=%s,mode=0600 "+
+			"--pid file=%s --log file=%s,level=1 --migration %s --terminate --daemon\n",
+		options.HostOptions.SwtpmPath, tpm.StateDir, socket, pidFile, s.getTpmLogPath(), migration,
+	)
+	return cmd
+}
+
 func (s *SKVMGuestInstance) getRescueInitrdPath() string {
 	return path.Join(s.GetRescueDirPath(), api.GUEST_RESCUE_INITRAMFS)
 }
@@ -901,10 +946,83 @@ func (s *SKVMGuestInstance) initCpuDesc(cpuMax uint) error {
 }
 
 func (s *SKVMGuestInstance) initMemDesc(memSizeMB int64) error {
+	var vmemPci *desc.PCIDevice
+	if s.Desc.MemDesc != nil && s.Desc.MemDesc.VirtioMem != nil {
+		// keep pci address of virtio-mem device on desc regenerate
+		vmemPci = s.Desc.MemDesc.VirtioMem.PCIDevice
+	}
 	s.Desc.MemDesc = s.archMan.GenerateMemDesc()
-	s.Desc.MemDesc.SizeMB = memSizeMB
 
-	return s.initGuestMemObjects(memSizeMB)
+	bootMemSizeMB := memSizeMB
+	if s.isVirtioMemSupported() {
+		s.Desc.MemDesc.VirtioMem = s.newVirtioMemDesc(memSizeMB, vmemPci)
+		if s.Desc.MemDesc.VirtioMem != nil {
+			bootMemSizeMB -= s.Desc.MemDesc.VirtioMem.RequestedSizeMB
+		}
+	}
+	s.Desc.MemDesc.SizeMB = bootMemSizeMB
+
+	return s.initGuestMemObjects(bootMemSizeMB)
+}
+
+// virtio-mem requires qemu 5.1 and guest driver, linux supports it since 5.8.
+// reserve=off of sparse memory backend requires qemu 6.1
+func (s *SKVMGuestInstance) isVirtioMemSupported() bool {
+	if !options.HostOptions.EnableVirtioMem {
+		return false
+	}
+	if s.GetOsName() != OS_NAME_LINUX || s.manager.host.IsAarch64() {
+		return false
+	}
+	if s.manager.host.IsHugepagesEnabled() || s.isMemcleanEnabled() || len(s.Desc.CpuNumaPin) > 0 {
+		return false
+	}
+	qemuVersion := options.HostOptions.DefaultQemuVersion
+	if qemuVersion != "" && qemuVersion != "latest" && version.LT(qemuVersion, "6.1.0") {
+		return false
+	}
+	return true
+}
+
+func (s *SKVMGuestInstance) newVirtioMemDesc(memSizeMB int64, pciDev *desc.PCIDevice) *desc.SGuestVirtioMem {
+	blockSizeMB := options.HostOptions.VirtioMemBlockSizeMB
+	bootSizeMB := options.HostOptions.VirtioMemBootSizeMB
+	maxSizeMB := options.HostOptions.VirtioMemMaxSizeMB
+	if blockSizeMB <= 0 || bootSizeMB <= 0 || maxSizeMB < blockSizeMB {
+		return nil
+	}
+	maxSizeMB -= maxSizeMB % blockSizeMB
+
+	if bootSizeMB > memSizeMB {
+		bootSizeMB = memSizeMB
+	}
+	requestedSizeMB := (memSizeMB - bootSizeMB) / blockSizeMB * blockSizeMB
+	if requestedSizeMB > maxSizeMB {
+		log.Warningf("guest %s memory %dM exceeds virtio-mem max size %dM", s.GetName(), memSizeMB, maxSizeMB)
+		return nil
+	}
+
+	memObj := desc.NewMemDesc("memory-backend-ram", "vmemobj0", nil, nil)
+	memObj.Options = map[string]string{
+		"size":    fmt.Sprintf("%dM", maxSizeMB),
+		"reserve": "off",
+	}
+	return &desc.SGuestVirtioMem{
+		PCIDevice:       pciDev,
+		MemObj:          memObj,
+		BlockSizeMB:     blockSizeMB,
+		MaxSizeMB:       maxSizeMB,
+		RequestedSizeMB: requestedSizeMB,
+	}
+}
+
+func (s *SKVMGuestInstance) isVirtioMemEnabled() bool {
+	return s.Desc.MemDesc != nil && s.Desc.MemDesc.VirtioMem != nil
+}
+
+// cpu hot unplug relies on guest acpi handling, only linux guest ejects cpu reliably
+func (s *SKVMGuestInstance) isCpuHotUnplugSupported() bool {
+	return s.GetOsName() == OS_NAME_LINUX && !s.manager.host.IsAarch64() && len(s.Desc.CpuNumaPin) == 0
 }
 
 func (s *SKVMGuestInstance) memObjectType() string {
@@ -1088,6 +1206,23 @@ func (s *SKVMGuestInstance) initIsaSerialDesc() {
 	}
 }
 
+func (s *SKVMGuestInstance) initTpmDesc() error {
+	s.Desc.Tpm = nil
+	if !s.isVtpmEnabled() {
+		return nil
+	}
+	stateDir, err := s.getTpmStateDir()
+	if err != nil {
+		return err
+	}
+	s.Desc.Tpm = s.archMan.GenerateTpmDesc(s.getTpmSocketPath(), stateDir)
+	return nil
+}
+
+func (s *SKVMGuestInstance) initSecureBootDesc() {
+	s.Desc.SecureBoot = s.isSecureBootEnabled() && s.Desc.Bios == qemu.BIOS_UEFI
+}
+
 func (s *SKVMGuestInstance) getVfioDeviceHotPlugPciControllerType() *desc.PCI_CONTROLLER_TYPE {
 	if s.Desc.Machine == api.VM_MACHINE_TYPE_Q35 || s.Desc.Machine == api.VM_MACHINE_TYPE_ARM_VIRT {
 		_, _, found := s.findUnusedSlotForController(desc.CONTROLLER_TYPE_PCIE_ROOT_PORT, 0)
@@ -1126,6 +1261,46 @@ func (s *SKVMGuestInstance) getOvmfVarsPath() string {
 	return path.Join(s.HomeDir(), "OVMF_VARS.fd")
 }
 
+func (s *SKVMGuestInstance) getTpmSocketPath() string {
+	return path.Join(s.HomeDir(), "swtpm.sock")
+}
+
+func (s *SKVMGuestInstance) getTpmPidFilePath() string {
+	return path.Join(s.HomeDir(), "swtpm.pid")
+}
+
+func (s *SKVMGuestInstance) getTpmLogPath() string {
+	return path.Join(s.HomeDir(), "swtpm.log")
+}
+
+func (s *SKVMGuestInstance) getSysDiskDesc() *desc.SGuestDisk {
+	for i := range s.Desc.Disks {
+		if s.Desc.Disks[i].Index == 0 {
+			return s.Desc.Disks[i]
+		}
+	}
+	return nil
+}
+
+// getTpmStateDir returns the swtpm state directory beside the system disk
+// file, the state is lost with a system disk which isn't a plain file, e.g.
+// rbd, so the vTPM is refused there
+func (s *SKVMGuestInstance) getTpmStateDir() (string, error) {
+	sysDisk := s.getSysDiskDesc()
+	if sysDisk == nil || len(sysDisk.Path) == 0 {
+		return "", errors.Errorf("vtpm requires a system disk")
+	}
+	if !utils.IsInStringArray(sysDisk.StorageType, api.VTPM_STATE_STORAGE) {
+		return "", errors.Errorf("vtpm is not supported with system disk on storage %s", sysDisk.StorageType)
+	}
+	return storageman.GetTpmStateDir(sysDisk.Path), nil
+}
+
+func (s *SKVMGuestInstance) isTpmStateOnLocalStorage() bool {
+	sysDisk := s.getSysDiskDesc()
+	return sysDisk != nil && sysDisk.StorageType == api.STORAGE_LOCAL
+}
+
 func (s *SKVMGuestInstance) getDiskBootOrderType(driver string) uefi.OvmfDevicePathType {
 	switch driver {
 	case qemu.DISK_DRIVER_VIRTIO:
@@ -183,6 +183,10 @@ func generateMachineOption(drvOpt QemuOptions, desc *desc.SGuestDesc) string {
 	if desc.MachineDesc.GicVersion != nil {
 		cmd += fmt.Sprintf(",gic-version=%s", *desc.MachineDesc.GicVersion)
 	}
+	if desc.SecureBoot {
+		// secure boot variables are only writable in system management mode
+		cmd += ",smm=on"
+	}
 	if desc.NoHpet != nil && *desc.NoHpet {
 		machineOpts, noHpetCmd := drvOpt.NoHpet()
 		if machineOpts {
@@ -617,6 +621,17 @@ func getRNGRandomOptions(rng *desc.SGuestRng) []string {
 	}
 }
 
+func generateVirtioMemOptions(vmem *desc.SGuestVirtioMem) []string {
+	cmd := generatePCIDeviceOption(vmem.PCIDevice)
+	cmd += fmt.Sprintf(",memdev=%s,block-size=%dM,requested-size=%dM",
+		vmem.MemObj.Id, vmem.BlockSizeMB, vmem.RequestedSizeMB)
+
+	return []string{
+		generateObjectOption(vmem.MemObj.Object),
+		cmd,
+	}
+}
+
 func generateQgaOptions(guestDesc *desc.SGuestDesc) []string {
 	opts := make([]string, 0)
 	opts = append(opts, chardevOption(guestDesc.Qga.Socket))
@@ -635,6 +650,14 @@ func generatePvpanicDeviceOption(pvpanic *desc.SGuestPvpanic) string {
 	return fmt.Sprintf("-device pvpanic,id=%s,ioport=0x%x", pvpanic.Id, pvpanic.Ioport)
 }
 
+func generateTpmOptions(tpm *desc.SGuestTpm) []string {
+	opts := make([]string, 0)
+	opts = append(opts, chardevOption(tpm.Socket))
+	opts = append(opts, fmt.Sprintf("-tpmdev emulator,id=%s,chardev=%s", tpm.Id, tpm.Socket.Id))
+	opts = append(opts, fmt.Sprintf("-device %s,tpmdev=%s", tpm.Model, tpm.Id))
+	return opts
+}
+
 func getMigrateOptions(drvOpt QemuOptions, input *GenerateStartOptionsInput) []string {
 	opts := make([]string, 0)
 	if input.NeedMigrate {
@@ -769,6 +792,9 @@ func GenerateStartOptions(
 			return "", errors.Wrap(err, "bios option")
 		}
 		opts = append(opts, fmOpt)
+		if input.GuestDesc.SecureBoot {
+			opts = append(opts, "-global driver=cfi.pflash01,property=secure,value=on")
+		}
 	}
 
 	if input.OsName == OS_NAME_MACOS {
@@ -874,11 +900,21 @@ func GenerateStartOptions(
 		opts = append(opts, getRNGRandomOptions(input.GuestDesc.Rng)...)
 	}
 
+	// virtio-mem device
+	if input.GuestDesc.MemDesc != nil && input.GuestDesc.MemDesc.VirtioMem != nil {
+		opts = append(opts, generateVirtioMemOptions(input.GuestDesc.MemDesc.VirtioMem)...)
+	}
+
 	// serial device
 	if input.GuestDesc.IsaSerial != nil {
 		opts = append(opts, generateISASerialOptions(input.GuestDesc.IsaSerial)...)
 	}
 
+	// tpm device
+	if input.GuestDesc.Tpm != nil {
+		opts = append(opts, generateTpmOptions(input.GuestDesc.Tpm)...)
+	}
+
 	// migrate options
 	opts = append(opts, getMigrateOptions(drvOpt, input)...)
 
@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"yunion.io/x/onecloud/pkg/hostman/guestman/desc"
 )
 
 func Test_baseOptions(t *testing.T) {
@@ -44,3 +46,47 @@ func Test_baseOptions(t *testing.T) {
 	assert.Equal("-vnc :5900,password", opt.VNC(5900, true))
 	assert.Equal("-vnc :5900", opt.VNC(5900, false))
 }
+
+func Test_generateTpmOptions(t *testing.T) {
+	tpm := &desc.SGuestTpm{
+		Id:    "tpm0",
+		Model: "tpm-crb",
+		Socket: &desc.CharDev{
+			Backend: "socket",
+			Id:      "chrtpm",
+			Options: map[string]string{"path": "/var/run/swtpm.sock"},
+		},
+	}
+	assert.Equal(t, []string{
+		"-chardev socket,id=chrtpm,path=/var/run/swtpm.sock",
+		"-tpmdev emulator,id=tpm0,chardev=chrtpm",
+		"-device tpm-crb,tpmdev=tpm0",
+	}, generateTpmOptions(tpm))
+}
+
+func Test_generateMachineOptionSecureBoot(t *testing.T) {
+	guestDesc := &desc.SGuestDesc{}
+	guestDesc.Machine = "q35"
+	guestDesc.MachineDesc = &desc.SGuestMachine{Accel: "kvm"}
+	opt := newBaseOptions_x86_64()
+	assert.Equal(t, "-machine q35,accel=kvm", generateMachineOption(opt, guestDesc))
+	guestDesc.SecureBoot = true
+	assert.Equal(t, "-machine q35,accel=kvm,smm=on", generateMachineOption(opt, guestDesc))
+}
+
+func Test_generateVirtioMemOptions(t *testing.T) {
+	memObj := desc.NewMemDesc("memory-backend-ram", "vmemobj0", nil, nil)
+	memObj.Options = map[string]string{"size": "7168M"}
+	vmem := &desc.SGuestVirtioMem{
+		PCIDevice:       desc.NewPCIDevice(desc.CONTROLLER_TYPE_PCIE_ROOT, "virtio-mem-pci", "vmem0"),
+		MemObj:          memObj,
+		BlockSizeMB:     2,
+		MaxSizeMB:       7168,
+		RequestedSizeMB: 3072,
+	}
+	vmem.PCIAddr = &desc.PCIAddr{Bus: 0, Slot: 6}
+	assert.Equal(t, []string{
+		"-object memory-backend-ram,id=vmemobj0,size=7168M",
+		"-device virtio-mem-pci,id=vmem0,bus=pcie.0,addr=0x06,memdev=vmemobj0,block-size=2M,requested-size=3072M",
+	}, generateVirtioMemOptions(vmem))
+}
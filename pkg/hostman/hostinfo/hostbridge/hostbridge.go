@@ -65,8 +65,11 @@ type IBridgeDriver interface {
 
 	getUpScripts(nic *desc.SGuestNetwork, isVolatileHost bool) (string, error)
 	getDownScripts(nic *desc.SGuestNetwork, isVolatileHost bool) (string, error)
+	getQosScripts(nic *desc.SGuestNetwork) (string, error)
 
 	OnVolatileGuestResume(nic *desc.SGuestNetwork) error
+	// ApplyNicQos re-applies qos policy or bandwidth limit of a running nic
+	ApplyNicQos(nic *desc.SGuestNetwork) error
 
 	Bridge() string
 }
@@ -110,9 +110,39 @@ func (l *SLinuxBridgeDriver) getUpScripts(nic *desc.SGuestNetwork, isVolatileHos
 			s += fmt.Sprintf("bridge fdb add %s dev %s\n", nic.Mac, l.inter.String())
 		}
 	}
+	qos, err := l.getQosScripts(nic)
+	if err != nil {
+		return "", err
+	}
+	if len(qos) > 0 {
+		s += "IF=$1\n"
+		s += qos
+	}
 	return s, nil
 }
 
+// getQosScripts expects IF being set
+func (l *SLinuxBridgeDriver) getQosScripts(nic *desc.SGuestNetwork) (string, error) {
+	if nic.QosPolicy == nil || nic.Driver == compute.NETWORK_DRIVER_VFIO {
+		return "", nil
+	}
+	return linuxBridgeQosScripts(nic), nil
+}
+
+func (l *SLinuxBridgeDriver) ApplyNicQos(nic *desc.SGuestNetwork) error {
+	if nic.Driver == compute.NETWORK_DRIVER_VFIO {
+		return nil
+	}
+	s := fmt.Sprintf("IF='%s'\n", nic.Ifname)
+	s += linuxBridgeQosResetScripts()
+	qos, err := l.getQosScripts(nic)
+	if err != nil {
+		return errors.Wrap(err, "getQosScripts")
+	}
+	s += qos
+	return runQosScripts(nic, s)
+}
+
 func (l *SLinuxBridgeDriver) getDownScripts(nic *desc.SGuestNetwork, isVolatileHost bool) (string, error) {
 	s := "#!/bin/sh\n\n"
 	s += fmt.Sprintf("switch='%s'\n", l.bridge)
@@ -160,17 +160,6 @@ func (o *SOVSBridgeDriver) getUpScripts(nic *desc.SGuestNetwork, isVolatileHost
 	s += fmt.Sprintf("MAC='%s'\n", mac)
 	s += fmt.Sprintf("VLAN_ID=%d\n", vlan)
 	s += fmt.Sprintf("NET_ID=%s\n", netId)
-	limit, burst, err := bwutils.GetOvsBwValues(nic.Bw, nic.Ip)
-	if err != nil {
-		return "", err
-	}
-	s += fmt.Sprintf("LIMIT=%d\n", limit)
-	s += fmt.Sprintf("BURST=%d\n", burst)
-	bwDownload, err := bwutils.GetDownloadBwValue(nic.Bw, nic.Ip, nic.Ifname, options.HostOptions.BwDownloadBandwidth)
-	if err != nil {
-		return "", err
-	}
-	s += fmt.Sprintf("LIMIT_DOWNLOAD='%dmbit'\n", bwDownload)
 	if options.HostOptions.TunnelPaddingBytes > 0 {
 		s += fmt.Sprintf("ip link set dev $IF mtu %d\n",
 			1500+options.HostOptions.TunnelPaddingBytes)
@@ -191,14 +180,48 @@ func (o *SOVSBridgeDriver) getUpScripts(nic *desc.SGuestNetwork, isVolatileHost
 	s += "PORT=$(ovs-ofctl show $SWITCH | grep -w $IF)\n"
 	s += "PORT=$(echo $PORT | awk 'BEGIN{FS=\"(\"}{print $1}')\n"
 	s += "OFCTL=$(ovs-vsctl get-controller $SWITCH)\n"
+	if nic.Driver != compute.NETWORK_DRIVER_VFIO {
+		if vpcProvider != compute.VPC_PROVIDER_OVN && len(options.HostOptions.SRIOVNics) > 0 {
+			s += fmt.Sprintf("bridge fdb add %s dev %s\n", nic.Mac, o.inter.String())
+		}
+	}
+	qos, err := o.getQosScripts(nic)
+	if err != nil {
+		return "", err
+	}
+	s += qos
+	return s, nil
+}
+
+// getQosScripts expects SWITCH, IF, PORT and OFCTL being set
+func (o *SOVSBridgeDriver) getQosScripts(nic *desc.SGuestNetwork) (string, error) {
+	if nic.QosPolicy != nil {
+		if nic.Driver == compute.NETWORK_DRIVER_VFIO {
+			return "", nil
+		}
+		return ovsQosScripts(nic), nil
+	}
+	return o.getBwScripts(nic)
+}
+
+func (o *SOVSBridgeDriver) getBwScripts(nic *desc.SGuestNetwork) (string, error) {
+	s := ""
+	limit, burst, err := bwutils.GetOvsBwValues(nic.Bw, nic.Ip)
+	if err != nil {
+		return "", err
+	}
+	s += fmt.Sprintf("LIMIT=%d\n", limit)
+	s += fmt.Sprintf("BURST=%d\n", burst)
+	bwDownload, err := bwutils.GetDownloadBwValue(nic.Bw, nic.Ip, nic.Ifname, options.HostOptions.BwDownloadBandwidth)
+	if err != nil {
+		return "", err
+	}
+	s += fmt.Sprintf("LIMIT_DOWNLOAD='%dmbit'\n", bwDownload)
 	if nic.Driver != compute.NETWORK_DRIVER_VFIO {
 		s += "if [ -z \"$OFCTL\" ]; then\n"
 		s += "    ovs-vsctl set Interface $IF ingress_policing_rate=$LIMIT\n"
 		s += "    ovs-vsctl set Interface $IF ingress_policing_burst=$BURST\n"
 		s += "fi\n"
-		if vpcProvider != compute.VPC_PROVIDER_OVN && len(options.HostOptions.SRIOVNics) > 0 {
-			s += fmt.Sprintf("bridge fdb add %s dev %s\n", nic.Mac, o.inter.String())
-		}
 	}
 
 	s += "if [ $LIMIT_DOWNLOAD != \"0mbit\" ]; then\n"
@@ -212,6 +235,30 @@ func (o *SOVSBridgeDriver) getUpScripts(nic *desc.SGuestNetwork, isVolatileHost
 	return s, nil
 }
 
+func (o *SOVSBridgeDriver) ApplyNicQos(nic *desc.SGuestNetwork) error {
+	bridge := o.bridge.String()
+	if qosIsOvn(nic) {
+		bridge = options.HostOptions.OvnIntegrationBridge
+	}
+	s := fmt.Sprintf("SWITCH='%s'\n", bridge)
+	s += fmt.Sprintf("IF='%s'\n", nic.Ifname)
+	s += "PORT=$(ovs-ofctl show $SWITCH | grep -w $IF)\n"
+	s += "if [ $? -ne '0' ]; then\n"
+	s += "    exit 0\n"
+	s += "fi\n"
+	s += "PORT=$(echo $PORT | awk 'BEGIN{FS=\"(\"}{print $1}')\n"
+	s += "OFCTL=$(ovs-vsctl get-controller $SWITCH)\n"
+	if nic.Driver != compute.NETWORK_DRIVER_VFIO {
+		s += ovsQosResetScripts()
+	}
+	qos, err := o.getQosScripts(nic)
+	if err != nil {
+		return errors.Wrap(err, "getQosScripts")
+	}
+	s += qos
+	return runQosScripts(nic, s)
+}
+
 func (o *SOVSBridgeDriver) getDownScripts(nic *desc.SGuestNetwork, isVolatileHost bool) (string, error) {
 	var (
 		bridge = o.bridge.String()
@@ -234,6 +281,11 @@ func (o *SOVSBridgeDriver) getDownScripts(nic *desc.SGuestNetwork, isVolatileHos
 	s += "OFCTL=$(ovs-vsctl get-controller $SWITCH)\n"
 	s += "PORT=$(echo $PORT | awk 'BEGIN{FS=\"(\"}{print $1}')\n"
 	s += "ip link set dev $IF down\n"
+	if nic.QosPolicy != nil && nic.QosPolicy.HasDscp() && nic.Vpc.Provider != compute.VPC_PROVIDER_OVN {
+		s += "if [ -z \"$OFCTL\" ]; then\n"
+		s += fmt.Sprintf("    ovs-ofctl --strict del-flows $SWITCH \"priority=%d,ip,in_port=$PORT\"\n", ovsQosDscpFlowPriority)
+		s += "fi\n"
+	}
 	s += "ovs-vsctl -- --if-exists del-port $SWITCH $IF\n"
 	if nic.Driver != compute.NETWORK_DRIVER_VFIO {
 		if nic.Vpc.Provider != compute.VPC_PROVIDER_OVN && len(options.HostOptions.SRIOVNics) > 0 {
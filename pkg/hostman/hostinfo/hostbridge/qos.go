@@ -0,0 +1,157 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostbridge
+
+import (
+	"fmt"
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/hostman/guestman/desc"
+	"yunion.io/x/onecloud/pkg/util/procutils"
+)
+
+// Qos policy of a nic is realised on the tap device.  Traffic into the guest
+// leaves the host through the root qdisc of the tap, traffic out of the
+// guest enters the host through its ingress qdisc or ovs ingress policing.
+// For ovn nics, rate and dscp are enforced by ovn northbound qos rules, only
+// packet rate is left to the host.
+//
+// Packet rate policing requires kernel 5.14+, ovs 2.17+ for kpkts policing
+const (
+	// priority of openflow rules marking dscp on ovs bridges without
+	// controller, above the default normal flow
+	ovsQosDscpFlowPriority = 100
+)
+
+func qosIsOvn(nic *desc.SGuestNetwork) bool {
+	return nic.Vpc.Provider == compute.VPC_PROVIDER_OVN
+}
+
+// tcRootQosScripts limits traffic into the guest
+func tcRootQosScripts(mbps, burstMb, pps int) string {
+	if mbps <= 0 && pps <= 0 {
+		return ""
+	}
+	s := "tc qdisc del dev $IF root 2>/dev/null\n"
+	s += "tc qdisc add dev $IF root handle 1: htb default 10\n"
+	if mbps > 0 {
+		s += fmt.Sprintf("tc class add dev $IF parent 1: classid 1:1 htb "+
+			"rate %dmbit ceil %dmbit burst %dmbit\n", mbps, mbps, burstMb)
+		s += fmt.Sprintf("tc class add dev $IF parent 1:1 classid 1:10 htb "+
+			"rate %dmbit ceil %dmbit burst %dmbit\n", mbps, mbps, burstMb)
+	}
+	if pps > 0 {
+		s += fmt.Sprintf("tc filter add dev $IF parent 1: protocol all prio 1 matchall classid 1:10 "+
+			"action police pkts_rate %d pkts_burst %d conform-exceed drop/ok\n", pps, pps*2)
+	}
+	return s
+}
+
+// tcIngressQosScripts limits and marks traffic out of the guest.  Ip packets
+// are matched first for dscp marking, so that pedit never touches arp
+func tcIngressQosScripts(mbps, burstMb, pps int, dscp int) string {
+	hasDscp := dscp >= 0 && dscp <= compute.QosPolicyDscpMax
+	if mbps <= 0 && pps <= 0 && !hasDscp {
+		return ""
+	}
+	actions := []string{}
+	if mbps > 0 {
+		actions = append(actions, fmt.Sprintf("action police rate %dmbit burst %dmbit conform-exceed drop/pipe", mbps, burstMb))
+	}
+	if pps > 0 {
+		actions = append(actions, fmt.Sprintf("action police pkts_rate %d pkts_burst %d conform-exceed drop/pipe", pps, pps*2))
+	}
+	s := "tc qdisc del dev $IF ingress 2>/dev/null\n"
+	s += "tc qdisc add dev $IF handle ffff: ingress\n"
+	if hasDscp {
+		ipActions := append(append([]string{}, actions...),
+			fmt.Sprintf("action pedit ex munge ip dsfield set %d retain 0xfc pipe", dscp<<2),
+			"action csum ip",
+		)
+		s += "tc filter add dev $IF parent ffff: protocol ip prio 1 matchall " + strings.Join(ipActions, " ") + "\n"
+	}
+	if len(actions) > 0 {
+		s += "tc filter add dev $IF parent ffff: protocol all prio 2 matchall " + strings.Join(actions, " ") + "\n"
+	}
+	return s
+}
+
+// ovsQosScripts is run after PORT and OFCTL are resolved in ovs scripts
+func ovsQosScripts(nic *desc.SGuestNetwork) string {
+	p := nic.QosPolicy
+	isOvn := qosIsOvn(nic)
+	s := "if [ -z \"$OFCTL\" ]; then\n"
+	if !isOvn {
+		s += fmt.Sprintf("    ovs-vsctl set Interface $IF ingress_policing_rate=%d\n", p.EgressBandwidth*1000)
+		s += fmt.Sprintf("    ovs-vsctl set Interface $IF ingress_policing_burst=%d\n", p.GetEgressBurst()*1000)
+	}
+	if p.EgressPps > 0 {
+		kpkts := (p.EgressPps + 999) / 1000
+		s += fmt.Sprintf("    ovs-vsctl set Interface $IF ingress_policing_kpkts_rate=%d\n", kpkts)
+		s += fmt.Sprintf("    ovs-vsctl set Interface $IF ingress_policing_kpkts_burst=%d\n", kpkts*2)
+	}
+	if !isOvn && p.HasDscp() {
+		s += fmt.Sprintf("    ovs-ofctl add-flow $SWITCH \"priority=%d,ip,in_port=$PORT,actions=mod_nw_tos:%d,normal\"\n",
+			ovsQosDscpFlowPriority, p.Dscp<<2)
+	}
+	s += "fi\n"
+	if isOvn {
+		s += tcRootQosScripts(0, 0, p.IngressPps)
+	} else {
+		s += tcRootQosScripts(p.IngressBandwidth, p.GetIngressBurst(), p.IngressPps)
+	}
+	return s
+}
+
+// ovsQosResetScripts clears whatever qos applied to the port before
+func ovsQosResetScripts() string {
+	s := "tc qdisc del dev $IF root 2>/dev/null\n"
+	s += "if [ -z \"$OFCTL\" ]; then\n"
+	s += "    ovs-vsctl set Interface $IF ingress_policing_rate=0\n"
+	s += "    ovs-vsctl set Interface $IF ingress_policing_burst=0\n"
+	s += "    ovs-vsctl set Interface $IF ingress_policing_kpkts_rate=0 2>/dev/null\n"
+	s += "    ovs-vsctl set Interface $IF ingress_policing_kpkts_burst=0 2>/dev/null\n"
+	s += "    ovs-ofctl --strict del-flows $SWITCH \"priority=" +
+		fmt.Sprintf("%d", ovsQosDscpFlowPriority) + ",ip,in_port=$PORT\"\n"
+	s += "fi\n"
+	return s
+}
+
+// linuxBridgeQosScripts expects the tap device in IF
+func linuxBridgeQosScripts(nic *desc.SGuestNetwork) string {
+	p := nic.QosPolicy
+	s := tcRootQosScripts(p.IngressBandwidth, p.GetIngressBurst(), p.IngressPps)
+	s += tcIngressQosScripts(p.EgressBandwidth, p.GetEgressBurst(), p.EgressPps, p.Dscp)
+	return s
+}
+
+func linuxBridgeQosResetScripts() string {
+	s := "tc qdisc del dev $IF root 2>/dev/null\n"
+	s += "tc qdisc del dev $IF ingress 2>/dev/null\n"
+	return s
+}
+
+func runQosScripts(nic *desc.SGuestNetwork, script string) error {
+	output, err := procutils.NewRemoteCommandAsFarAsPossible("bash", "-c", script).Output()
+	if err != nil {
+		log.Errorf("apply qos of nic %s failed: %s", nic.Ifname, output)
+		return errors.Wrapf(err, "apply qos of nic %s: %s", nic.Ifname, output)
+	}
+	return nil
+}
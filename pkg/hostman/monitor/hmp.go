@@ -510,6 +510,10 @@ func (m *HmpMonitor) GeMemtSlotIndex(callback func(index int)) {
 	m.Query("info memory-devices", cb)
 }
 
+func (m *HmpMonitor) QomSet(path, property string, val interface{}, callback StringCallback) {
+	m.Query(fmt.Sprintf("qom-set %s %s %v", path, property, val), callback)
+}
+
 func (m *HmpMonitor) GetMemoryDevicesInfo(cb QueryMemoryDevicesCallback) {
 	go cb(nil, "hmp unsupport get memory devices info")
 }
@@ -208,6 +208,7 @@ type Monitor interface {
 	GeMemtSlotIndex(func(index int))
 	GetMemoryDevicesInfo(QueryMemoryDevicesCallback)
 	GetMemdevList(MemdevListCallback)
+	QomSet(path, property string, val interface{}, callback StringCallback)
 
 	GetBlocks(callback func([]QemuBlock))
 	EjectCdrom(dev string, callback StringCallback)
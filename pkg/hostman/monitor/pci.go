@@ -109,6 +109,11 @@ type PcdimmDeviceInfo struct {
 	Memdev       string  `json:"memdev"`
 	Hotplugged   bool    `json:"hotplugged"`
 	Hotpluggable bool    `json:"hotpluggable"`
+
+	// virtio-mem only, size above is the currently plugged size
+	RequestedSize int64 `json:"requested-size,omitempty"`
+	MaxSize       int64 `json:"max-size,omitempty"`
+	BlockSize     int64 `json:"block-size,omitempty"`
 }
 
 type QueryMemoryDevicesCallback func(memoryDevicesInfoList []MemoryDeviceInfo, err string)
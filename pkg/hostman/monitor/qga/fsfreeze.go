@@ -0,0 +1,170 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qga
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/hostman/monitor"
+)
+
+const (
+	QGA_FSFREEZE_TIMEOUT_SECOND   int = 10
+	QGA_FSFREEZE_AUTO_THAW_SECOND int = 60
+	QGA_FSFREEZE_STATUS_THAWED        = "thawed"
+	QGA_FSFREEZE_STATUS_FROZEN        = "frozen"
+)
+
+/*
+##
+# @guest-fsfreeze-status:
+#
+# Get guest fsfreeze state.
+#
+# Returns: GuestFsfreezeStatus ("thawed", "frozen")
+#
+# Since: 0.15.0
+##
+{ 'command': 'guest-fsfreeze-status',
+  'returns': 'GuestFsfreezeStatus' }
+*/
+
+func (qga *QemuGuestAgent) GuestFsFreezeStatus() (string, error) {
+	cmd := &monitor.Command{
+		Execute: "guest-fsfreeze-status",
+	}
+	rawRes, err := qga.execCmd(cmd, true, -1)
+	if err != nil {
+		return "", err
+	}
+	if rawRes == nil {
+		return "", errors.Errorf("qga no response")
+	}
+	var status string
+	if err := json.Unmarshal(*rawRes, &status); err != nil {
+		return "", errors.Wrap(err, "unmarshal raw response")
+	}
+	return status, nil
+}
+
+/*
+##
+# @guest-fsfreeze-freeze:
+#
+# Sync and freeze all freezable, local guest filesystems.
+#
+# Returns: Number of file systems currently frozen. On error, all filesystems
+#          will be thawed.
+#
+# Since: 0.15.0
+##
+{ 'command': 'guest-fsfreeze-freeze',
+  'returns': 'int' }
+*/
+
+func (qga *QemuGuestAgent) GuestFsFreezeFreeze(timeoutSecond int) (int, error) {
+	return qga.fsFreezeCmd("guest-fsfreeze-freeze", timeoutSecond)
+}
+
+/*
+##
+# @guest-fsfreeze-thaw:
+#
+# Unfreeze all frozen guest filesystems
+#
+# Returns: Number of file systems thawed by this call
+#
+# Since: 0.15.0
+##
+{ 'command': 'guest-fsfreeze-thaw',
+  'returns': 'int' }
+*/
+
+func (qga *QemuGuestAgent) GuestFsFreezeThaw(timeoutSecond int) (int, error) {
+	return qga.fsFreezeCmd("guest-fsfreeze-thaw", timeoutSecond)
+}
+
+func (qga *QemuGuestAgent) fsFreezeCmd(execute string, timeoutSecond int) (int, error) {
+	cmd := &monitor.Command{
+		Execute: execute,
+	}
+	rawRes, err := qga.execCmd(cmd, true, timeoutSecond)
+	if err != nil {
+		return 0, err
+	}
+	if rawRes == nil {
+		return 0, errors.Errorf("qga no response")
+	}
+	var count int
+	if err := json.Unmarshal(*rawRes, &count); err != nil {
+		return 0, errors.Wrap(err, "unmarshal raw response")
+	}
+	return count, nil
+}
+
+// FsThawFunc thaws the filesystems frozen by FsFreeze, it is safe to call
+// more than once
+type FsThawFunc func() error
+
+// FsFreeze freezes the guest filesystems and returns the function to thaw
+// them. If freezing fails the filesystems are thawed right away, and once
+// frozen they are thawed automatically after autoThaw in case the caller
+// never gets to thaw them.
+func (qga *QemuGuestAgent) FsFreeze(timeoutSecond int, autoThaw time.Duration) (FsThawFunc, error) {
+	if timeoutSecond <= 0 {
+		timeoutSecond = QGA_FSFREEZE_TIMEOUT_SECOND
+	}
+	if autoThaw <= 0 {
+		autoThaw = time.Duration(QGA_FSFREEZE_AUTO_THAW_SECOND) * time.Second
+	}
+	count, err := qga.GuestFsFreezeFreeze(timeoutSecond)
+	if err != nil {
+		// freeze may time out while part of the filesystems are frozen
+		if _, thawErr := qga.GuestFsFreezeThaw(timeoutSecond); thawErr != nil {
+			log.Errorf("qga %s thaw after freeze failure: %s", qga.id, thawErr)
+		}
+		return nil, errors.Wrap(err, "guest-fsfreeze-freeze")
+	}
+	log.Infof("qga %s froze %d filesystems", qga.id, count)
+
+	var (
+		once    sync.Once
+		thawErr error
+	)
+	doThaw := func() error {
+		once.Do(func() {
+			_, thawErr = qga.GuestFsFreezeThaw(timeoutSecond)
+			if thawErr != nil {
+				thawErr = errors.Wrap(thawErr, "guest-fsfreeze-thaw")
+			}
+		})
+		return thawErr
+	}
+	timer := time.AfterFunc(autoThaw, func() {
+		log.Warningf("qga %s filesystems still frozen after %s, thaw automatically", qga.id, autoThaw)
+		if err := doThaw(); err != nil {
+			log.Errorf("qga %s auto thaw: %s", qga.id, err)
+		}
+	})
+	return func() error {
+		timer.Stop()
+		return doThaw()
+	}, nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qga
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGuestAgent serves the fsfreeze commands on a unix socket the way
+// qemu-guest-agent does
+type fakeGuestAgent struct {
+	listener net.Listener
+
+	mutex      sync.Mutex
+	frozen     bool
+	failFreeze bool
+	commands   []string
+}
+
+func newFakeGuestAgent(t *testing.T) *fakeGuestAgent {
+	dir, err := os.MkdirTemp("", "qga")
+	if err != nil {
+		t.Fatalf("mkdir temp: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	l, err := net.Listen("unix", filepath.Join(dir, "qga.sock"))
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	fake := &fakeGuestAgent{listener: l}
+	go fake.serve()
+	return fake
+}
+
+func (f *fakeGuestAgent) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeGuestAgent) handle(conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	for {
+		cmd := struct {
+			Execute string `json:"execute"`
+		}{}
+		if err := dec.Decode(&cmd); err != nil {
+			return
+		}
+		f.mutex.Lock()
+		f.commands = append(f.commands, cmd.Execute)
+		var resp string
+		switch cmd.Execute {
+		case "guest-fsfreeze-freeze":
+			if f.failFreeze {
+				resp = `{"error":{"class":"GenericError","desc":"failed to freeze /"}}`
+			} else {
+				f.frozen = true
+				resp = `{"return":2}`
+			}
+		case "guest-fsfreeze-thaw":
+			count := 0
+			if f.frozen {
+				count = 2
+			}
+			f.frozen = false
+			resp = fmt.Sprintf(`{"return":%d}`, count)
+		case "guest-fsfreeze-status":
+			status := QGA_FSFREEZE_STATUS_THAWED
+			if f.frozen {
+				status = QGA_FSFREEZE_STATUS_FROZEN
+			}
+			resp = fmt.Sprintf(`{"return":"%s"}`, status)
+		default:
+			resp = `{"error":{"class":"CommandNotFound","desc":"not supported"}}`
+		}
+		f.mutex.Unlock()
+		conn.Write([]byte(resp + "\n"))
+	}
+}
+
+func (f *fakeGuestAgent) isFrozen() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.frozen
+}
+
+func (f *fakeGuestAgent) countCommand(execute string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	cnt := 0
+	for _, cmd := range f.commands {
+		if cmd == execute {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+func newTestAgent(t *testing.T, fake *fakeGuestAgent) *QemuGuestAgent {
+	qga, err := NewQemuGuestAgent("test", fake.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("new qga: %s", err)
+	}
+	t.Cleanup(func() { qga.Close() })
+	return qga
+}
+
+func TestFsFreeze(t *testing.T) {
+	fake := newFakeGuestAgent(t)
+	qga := newTestAgent(t, fake)
+
+	thaw, err := qga.FsFreeze(2, time.Minute)
+	if err != nil {
+		t.Fatalf("freeze: %s", err)
+	}
+	if !fake.isFrozen() {
+		t.Fatalf("filesystems should be frozen")
+	}
+	status, err := qga.GuestFsFreezeStatus()
+	if err != nil {
+		t.Fatalf("status: %s", err)
+	}
+	if status != QGA_FSFREEZE_STATUS_FROZEN {
+		t.Errorf("want status %s, got %s", QGA_FSFREEZE_STATUS_FROZEN, status)
+	}
+	if err := thaw(); err != nil {
+		t.Fatalf("thaw: %s", err)
+	}
+	if fake.isFrozen() {
+		t.Fatalf("filesystems should be thawed")
+	}
+	// thaw is only sent once
+	if err := thaw(); err != nil {
+		t.Fatalf("thaw again: %s", err)
+	}
+	if cnt := fake.countCommand("guest-fsfreeze-thaw"); cnt != 1 {
+		t.Errorf("want 1 thaw command, got %d", cnt)
+	}
+}
+
+func TestFsFreezeAutoThaw(t *testing.T) {
+	fake := newFakeGuestAgent(t)
+	qga := newTestAgent(t, fake)
+
+	thaw, err := qga.FsFreeze(2, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("freeze: %s", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for fake.isFrozen() {
+		if time.Now().After(deadline) {
+			t.Fatalf("filesystems not thawed automatically")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := thaw(); err != nil {
+		t.Fatalf("thaw: %s", err)
+	}
+	if cnt := fake.countCommand("guest-fsfreeze-thaw"); cnt != 1 {
+		t.Errorf("want 1 thaw command, got %d", cnt)
+	}
+}
+
+func TestFsFreezeFailed(t *testing.T) {
+	fake := newFakeGuestAgent(t)
+	fake.failFreeze = true
+	qga := newTestAgent(t, fake)
+
+	if _, err := qga.FsFreeze(2, time.Minute); err == nil {
+		t.Fatalf("freeze should fail")
+	}
+	if cnt := fake.countCommand("guest-fsfreeze-thaw"); cnt != 1 {
+		t.Errorf("want thaw after failed freeze, got %d thaw commands", cnt)
+	}
+}
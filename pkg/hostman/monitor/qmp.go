@@ -948,6 +948,23 @@ func (m *QmpMonitor) GetMemoryDevicesInfo(callback QueryMemoryDevicesCallback) {
 	m.Query(cmd, cb)
 }
 
+func (m *QmpMonitor) QomSet(path, property string, val interface{}, callback StringCallback) {
+	var (
+		cb = func(res *Response) {
+			callback(m.actionResult(res))
+		}
+		cmd = &Command{
+			Execute: "qom-set",
+			Args: map[string]interface{}{
+				"path":     path,
+				"property": property,
+				"value":    val,
+			},
+		}
+	)
+	m.Query(cmd, cb)
+}
+
 func (m *QmpMonitor) GetMemdevList(callback MemdevListCallback) {
 	var (
 		cb = func(res *Response) {
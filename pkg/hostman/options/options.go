@@ -109,6 +109,10 @@ type SHostOptions struct {
 	OvmfPath     string `help:"Path to OVMF.fd" default:"/opt/cloud/contrib/OVMF.fd"`
 	OvmfVarsPath string `help:"Path to OVMF_VARS.fd" default:"/opt/cloud/contrib/OVMF_VARS.fd"`
 
+	OvmfSecbootPath     string `help:"Path to secure boot capable OVMF_CODE.secboot.fd" default:"/opt/cloud/contrib/OVMF_CODE.secboot.fd"`
+	OvmfSecbootVarsPath string `help:"Path to OVMF_VARS.secboot.fd with enrolled secure boot keys" default:"/opt/cloud/contrib/OVMF_VARS.secboot.fd"`
+	SwtpmPath           string `help:"Path to swtpm binary for guest vTPM" default:"/usr/bin/swtpm"`
+
 	LinuxDefaultRootUser    bool `help:"Default account for linux system is root"`
 	WindowsDefaultAdminUser bool `default:"true" help:"Default account for Windows system is Administrator"`
 
@@ -186,6 +190,10 @@ type SHostOptions struct {
 
 	ovnutils.SOvnOptions
 
+	EnableFlowLogCollector        bool   `help:"collect ovn acl logs of vpc flow logs and ship them to logger or bucket" default:"false"`
+	OvnControllerLogPath          string `help:"log file of ovn-controller where acl logs are written to" default:"/var/log/ovn/ovn-controller.log"`
+	FlowLogCollectIntervalSeconds int    `help:"interval in seconds of collecting and shipping flow log records" default:"10"`
+
 	// EnableRemoteExecutor bool `help:"Enable remote executor" default:"false"`
 	HostHealthTimeout int `help:"host health timeout" default:"30"`
 	HostLeaseTimeout  int `help:"lease timeout" default:"10"`
@@ -215,6 +223,11 @@ type SHostOptions struct {
 
 	EnableVirtioRngDevice bool `help:"enable qemu virtio-rng device" default:"true"`
 
+	EnableVirtioMem      bool  `help:"enable virtio-mem device for online memory grow and shrink of linux guests" default:"false"`
+	VirtioMemBootSizeMB  int64 `help:"boot memory size of guest with virtio-mem device, the rest is plugged by virtio-mem" default:"1024"`
+	VirtioMemBlockSizeMB int64 `help:"virtio-mem block size, granularity of memory resize" default:"2"`
+	VirtioMemMaxSizeMB   int64 `help:"max memory size virtio-mem device can provide" default:"262144"`
+
 	RestrictQemuImgConvertWorker bool `help:"restrict qemu-img convert worker" default:"false"`
 
 	DefaultLiveMigrateDowntime float32 `help:"allow downtime in seconds for live migrate" default:"5.0"`
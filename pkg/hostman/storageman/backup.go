@@ -69,6 +69,10 @@ func isTarSnapshot(path string) bool {
 }
 
 func doBackupDisk(ctx context.Context, snapshotPath string, diskBackup *SDiskBackup) (int, error) {
+	if len(diskBackup.ChainId) > 0 && len(diskBackup.EncryptKeyId) == 0 && !isTarSnapshot(snapshotPath) {
+		return doChunkedBackupDisk(ctx, snapshotPath, diskBackup)
+	}
+
 	backupTmpDir, err := EnsureBackupDir()
 	if err != nil {
 		return 0, errors.Wrap(err, "EnsureBackupDir")
@@ -141,9 +145,9 @@ func doRestoreDisk(ctx context.Context, dc IDiskCreator, input *SDiskCreateByDis
 		return errors.Wrap(err, "GetBackupStorage")
 	}
 	backupPath := path.Join(backupTmpDir, diskInfo.Backup.BackupId)
-	err = backupStorage.RestoreBackupTo(ctx, backupPath, diskInfo.Backup.BackupId)
+	_, err = restoreBackupImage(ctx, backupStorage, diskInfo.Backup.BackupId, backupPath)
 	if err != nil {
-		return errors.Wrap(err, "RestoreBackupTo")
+		return errors.Wrap(err, "restoreBackupImage")
 	}
 
 	backupInput := diskInfo.Backup
@@ -260,9 +264,15 @@ func DoInstancePackBackup(ctx context.Context, backupInfo SStoragePackInstanceBa
 		// download disk files
 		for i, backupId := range backupInfo.BackupIds {
 			packageDiskPath := path.Join(packagePath, fmt.Sprintf("%s_%d", PackageDiskFilename, i))
-			err := backupStorage.RestoreBackupTo(ctx, packageDiskPath, backupId)
+			chunked, err := restoreBackupImage(ctx, backupStorage, backupId, packageDiskPath)
 			if err != nil {
-				return "", errors.Wrapf(err, "RestoreBackupTo %s %s", backupId, packageDiskPath)
+				return "", errors.Wrapf(err, "restoreBackupImage %s %s", backupId, packageDiskPath)
+			}
+			if chunked {
+				// package chunked backups as standalone qcow2 images
+				if err := convertRawToQcow2(packageDiskPath); err != nil {
+					return "", errors.Wrapf(err, "convert backup %s", backupId)
+				}
 			}
 		}
 	}
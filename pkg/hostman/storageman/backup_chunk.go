@@ -0,0 +1,715 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageman
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/qemuimgfmt"
+
+	"yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage"
+	"yunion.io/x/onecloud/pkg/util/qemuimg"
+)
+
+// Chunked backups split the raw disk content into fixed size chunks which
+// are stored once per backup chain and addressed by their sha256 hash.
+// Every backup of a chain only stores a small manifest in place of the
+// backup file: a full backup lists all non-zero chunks, an incremental
+// backup lists the chunks that changed since its parent, and a zero hash
+// marks a chunk that was discarded since the parent.
+//
+// The manifest also records the layers of the qcow2 backing chain the backup
+// was taken from. An incremental backup only reads the chunks allocated in
+// layers that the parent backup has not seen, i.e. the qcow2 diff between
+// consecutive snapshots, and falls back to reading the whole snapshot when the
+// chains share no layer.
+const (
+	backupManifestMagic = "onecloud-backup-manifest"
+	backupChunkSize     = 4 * 1024 * 1024
+	backupZeroChunk     = "zero"
+	backupChainMaxDepth = 1024
+)
+
+type SBackupChunk struct {
+	Index int64  `json:"index"`
+	Hash  string `json:"hash"`
+}
+
+type SBackupManifest struct {
+	Magic          string         `json:"magic"`
+	BackupId       string         `json:"backup_id"`
+	ParentBackupId string         `json:"parent_backup_id"`
+	ChainId        string         `json:"chain_id"`
+	ChunkSize      int64          `json:"chunk_size"`
+	SizeBytes      int64          `json:"size_bytes"`
+	Chunks         []SBackupChunk `json:"chunks"`
+	// identities of the backing chain layers, base first
+	Layers []string `json:"layers,omitempty"`
+}
+
+func newBackupManifest(backupId, parentBackupId, chainId string) *SBackupManifest {
+	return &SBackupManifest{
+		Magic:          backupManifestMagic,
+		BackupId:       backupId,
+		ParentBackupId: parentBackupId,
+		ChainId:        chainId,
+		ChunkSize:      backupChunkSize,
+	}
+}
+
+func parseBackupManifest(data []byte) (*SBackupManifest, bool) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return nil, false
+	}
+	obj, err := jsonutils.Parse(data)
+	if err != nil {
+		return nil, false
+	}
+	manifest := &SBackupManifest{}
+	if err := obj.Unmarshal(manifest); err != nil || manifest.Magic != backupManifestMagic {
+		return nil, false
+	}
+	return manifest, true
+}
+
+func (m *SBackupManifest) chunkMap() map[int64]string {
+	ret := make(map[int64]string, len(m.Chunks))
+	for _, chunk := range m.Chunks {
+		ret[chunk.Index] = chunk.Hash
+	}
+	return ret
+}
+
+func (m *SBackupManifest) chunkCount() int64 {
+	if m.ChunkSize <= 0 {
+		return 0
+	}
+	return (m.SizeBytes + m.ChunkSize - 1) / m.ChunkSize
+}
+
+func sortedBackupChunks(chunks map[int64]string) []SBackupChunk {
+	ret := make([]SBackupChunk, 0, len(chunks))
+	for idx, hash := range chunks {
+		ret = append(ret, SBackupChunk{Index: idx, Hash: hash})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Index < ret[j].Index
+	})
+	return ret
+}
+
+// overlayBackupChunks applies the manifests of a chain ordered from the full
+// backup to the leaf and returns the non-zero chunks of the leaf
+func overlayBackupChunks(chain []*SBackupManifest) map[int64]string {
+	ret := make(map[int64]string)
+	if len(chain) == 0 {
+		return ret
+	}
+	for _, m := range chain {
+		for _, chunk := range m.Chunks {
+			if chunk.Hash == backupZeroChunk {
+				delete(ret, chunk.Index)
+			} else {
+				ret[chunk.Index] = chunk.Hash
+			}
+		}
+	}
+	count := chain[len(chain)-1].chunkCount()
+	for idx := range ret {
+		if idx >= count {
+			delete(ret, idx)
+		}
+	}
+	return ret
+}
+
+// diffBackupChunks returns the chunks to record in an incremental manifest
+func diffBackupChunks(parent, current map[int64]string) []SBackupChunk {
+	diff := make(map[int64]string)
+	for idx, hash := range current {
+		if parent[idx] != hash {
+			diff[idx] = hash
+		}
+	}
+	for idx := range parent {
+		if _, ok := current[idx]; !ok {
+			diff[idx] = backupZeroChunk
+		}
+	}
+	return sortedBackupChunks(diff)
+}
+
+// mergeBackupManifests folds base into its direct child inc, the result
+// replaces inc and takes over the parent of base
+func mergeBackupManifests(base, inc *SBackupManifest) *SBackupManifest {
+	chunks := base.chunkMap()
+	for _, chunk := range inc.Chunks {
+		chunks[chunk.Index] = chunk.Hash
+	}
+	count := inc.chunkCount()
+	for idx, hash := range chunks {
+		if idx >= count || (len(base.ParentBackupId) == 0 && hash == backupZeroChunk) {
+			delete(chunks, idx)
+		}
+	}
+	merged := *inc
+	merged.ParentBackupId = base.ParentBackupId
+	merged.Chunks = sortedBackupChunks(chunks)
+	return &merged
+}
+
+func referencedBackupChunks(manifests ...*SBackupManifest) map[string]bool {
+	ret := make(map[string]bool)
+	for _, m := range manifests {
+		for _, chunk := range m.Chunks {
+			if chunk.Hash != backupZeroChunk {
+				ret[chunk.Hash] = true
+			}
+		}
+	}
+	return ret
+}
+
+func isZeroBackupChunk(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func loadBackupManifest(ctx context.Context, backupStorage backupstorage.IBackupStorage, backupId string, tmpDir string) (*SBackupManifest, error) {
+	manifestPath := path.Join(tmpDir, fmt.Sprintf("%s.manifest", backupId))
+	defer os.Remove(manifestPath)
+	err := backupStorage.RestoreBackupTo(ctx, manifestPath, backupId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "RestoreBackupTo %s", backupId)
+	}
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ReadFile %s", manifestPath)
+	}
+	manifest, ok := parseBackupManifest(data)
+	if !ok {
+		return nil, errors.Wrapf(errors.ErrInvalidFormat, "backup %s is not a chunked backup", backupId)
+	}
+	return manifest, nil
+}
+
+// loadBackupManifestChain returns the manifests from the full backup to backupId
+func loadBackupManifestChain(ctx context.Context, backupStorage backupstorage.IBackupStorage, backupId string, tmpDir string) ([]*SBackupManifest, error) {
+	chain := make([]*SBackupManifest, 0)
+	for len(backupId) > 0 {
+		if len(chain) >= backupChainMaxDepth {
+			return nil, errors.Errorf("backup chain is deeper than %d", backupChainMaxDepth)
+		}
+		manifest, err := loadBackupManifest(ctx, backupStorage, backupId, tmpDir)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, manifest)
+		backupId = manifest.ParentBackupId
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+func saveBackupManifest(ctx context.Context, backupStorage backupstorage.IBackupStorage, manifest *SBackupManifest, tmpDir string) error {
+	manifestPath := path.Join(tmpDir, fmt.Sprintf("%s.manifest", manifest.BackupId))
+	defer os.Remove(manifestPath)
+	err := ioutil.WriteFile(manifestPath, []byte(jsonutils.Marshal(manifest).String()), 0644)
+	if err != nil {
+		return errors.Wrapf(err, "unable to write to %s", manifestPath)
+	}
+	err = backupStorage.SaveBackupFrom(ctx, manifestPath, manifest.BackupId)
+	if err != nil {
+		return errors.Wrap(err, "SaveBackupFrom")
+	}
+	return nil
+}
+
+// sBackupChunkWriter hashes chunks and uploads the ones not yet in the chain
+type sBackupChunkWriter struct {
+	backupStorage backupstorage.IBackupStorage
+	manifest      *SBackupManifest
+	chunkPath     string
+
+	saved      map[string]bool
+	savedBytes int64
+}
+
+func newBackupChunkWriter(backupStorage backupstorage.IBackupStorage, manifest *SBackupManifest, tmpDir string) *sBackupChunkWriter {
+	return &sBackupChunkWriter{
+		backupStorage: backupStorage,
+		manifest:      manifest,
+		chunkPath:     path.Join(tmpDir, fmt.Sprintf("%s.chunk", manifest.BackupId)),
+		saved:         make(map[string]bool),
+	}
+}
+
+// write stores the chunk and returns its hash, an empty hash for zero chunk
+func (w *sBackupChunkWriter) write(ctx context.Context, idx int64, data []byte) (string, error) {
+	if isZeroBackupChunk(data) {
+		return "", nil
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(data))
+	if w.saved[hash] {
+		return hash, nil
+	}
+	w.saved[hash] = true
+	exists, err := w.backupStorage.IsBackupChunkExists(w.manifest.ChainId, hash)
+	if err != nil {
+		return "", errors.Wrapf(err, "IsBackupChunkExists %s", hash)
+	}
+	if !exists {
+		if err := ioutil.WriteFile(w.chunkPath, data, 0644); err != nil {
+			return "", errors.Wrapf(err, "write chunk %d", idx)
+		}
+		if err := w.backupStorage.SaveBackupChunkFrom(ctx, w.chunkPath, w.manifest.ChainId, hash); err != nil {
+			return "", errors.Wrapf(err, "SaveBackupChunkFrom %s", hash)
+		}
+		w.savedBytes += int64(len(data))
+	}
+	return hash, nil
+}
+
+// writeRaw stores the chunks of a raw file whose first chunk is startIdx
+func (w *sBackupChunkWriter) writeRaw(ctx context.Context, rawPath string, startIdx int64, current map[int64]string) error {
+	file, err := os.Open(rawPath)
+	if err != nil {
+		return errors.Wrapf(err, "Open %s", rawPath)
+	}
+	defer file.Close()
+	buf := make([]byte, w.manifest.ChunkSize)
+	for idx := startIdx; ; idx++ {
+		n, err := io.ReadFull(file, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			if err == io.EOF {
+				break
+			}
+			return errors.Wrapf(err, "read chunk %d of %s", idx, rawPath)
+		}
+		hash, err := w.write(ctx, idx, buf[:n])
+		if err != nil {
+			return err
+		}
+		if len(hash) > 0 {
+			current[idx] = hash
+		} else {
+			delete(current, idx)
+		}
+		if n < len(buf) {
+			break
+		}
+	}
+	return nil
+}
+
+// saveChunkedBackup uploads the chunks of the raw image which are not yet in
+// the chain and saves the manifest, returns the size of the newly stored data
+func saveChunkedBackup(ctx context.Context, backupStorage backupstorage.IBackupStorage, rawPath string, manifest *SBackupManifest, parentChain []*SBackupManifest, tmpDir string) (int64, error) {
+	fileInfo, err := os.Stat(rawPath)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Stat %s", rawPath)
+	}
+	manifest.SizeBytes = fileInfo.Size()
+
+	writer := newBackupChunkWriter(backupStorage, manifest, tmpDir)
+	defer os.Remove(writer.chunkPath)
+	current := make(map[int64]string)
+	if err := writer.writeRaw(ctx, rawPath, 0, current); err != nil {
+		return 0, err
+	}
+	return writer.savedBytes, finishChunkedBackup(ctx, backupStorage, manifest, parentChain, current, tmpDir)
+}
+
+// saveIncrementalChunkedBackup only reads the changed chunks of the image,
+// the other chunks are the same as the parent backup
+func saveIncrementalChunkedBackup(ctx context.Context, backupStorage backupstorage.IBackupStorage, img *qemuimg.SQemuImage, changed []int64, manifest *SBackupManifest, parentChain []*SBackupManifest, tmpDir string) (int64, error) {
+	manifest.SizeBytes = img.SizeBytes
+
+	writer := newBackupChunkWriter(backupStorage, manifest, tmpDir)
+	defer os.Remove(writer.chunkPath)
+	current := overlayBackupChunks(parentChain)
+	rawPath := path.Join(tmpDir, fmt.Sprintf("%s.raw", manifest.BackupId))
+	defer os.Remove(rawPath)
+	for _, run := range backupChunkRuns(changed) {
+		os.Remove(rawPath)
+		if err := img.DdRaw(rawPath, manifest.ChunkSize, run[0], run[1]); err != nil {
+			return 0, errors.Wrapf(err, "read chunks %d-%d", run[0], run[0]+run[1]-1)
+		}
+		if err := writer.writeRaw(ctx, rawPath, run[0], current); err != nil {
+			return 0, err
+		}
+	}
+	return writer.savedBytes, finishChunkedBackup(ctx, backupStorage, manifest, parentChain, current, tmpDir)
+}
+
+func finishChunkedBackup(ctx context.Context, backupStorage backupstorage.IBackupStorage, manifest *SBackupManifest, parentChain []*SBackupManifest, current map[int64]string, tmpDir string) error {
+	if len(parentChain) > 0 {
+		manifest.Chunks = diffBackupChunks(overlayBackupChunks(parentChain), current)
+	} else {
+		manifest.Chunks = sortedBackupChunks(current)
+	}
+	if err := saveBackupManifest(ctx, backupStorage, manifest, tmpDir); err != nil {
+		return err
+	}
+	log.Infof("chunked backup %s of chain %s saved %d of %d chunks", manifest.BackupId, manifest.ChainId, len(manifest.Chunks), len(current))
+	return nil
+}
+
+// backupChunkRuns groups sorted chunk indexes into runs of [start, count]
+func backupChunkRuns(chunks []int64) [][2]int64 {
+	runs := make([][2]int64, 0)
+	for _, idx := range chunks {
+		if n := len(runs); n > 0 && runs[n-1][0]+runs[n-1][1] == idx {
+			runs[n-1][1] += 1
+		} else {
+			runs = append(runs, [2]int64{idx, 1})
+		}
+	}
+	return runs
+}
+
+// getBackupImageLayers returns the identities of the layers of the backing
+// chain of an image, base first. A layer rewritten by merging a snapshot
+// gets a new identity.
+func getBackupImageLayers(img *qemuimg.SQemuImage) ([]string, error) {
+	chain, err := img.GetBackingChain()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetBackingChain")
+	}
+	chain = append(chain, img.Path)
+	layers := make([]string, 0, len(chain))
+	for _, layer := range chain {
+		fi, err := os.Stat(layer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Stat %s", layer)
+		}
+		layers = append(layers, fmt.Sprintf("%s:%d:%d", layer, fi.Size(), fi.ModTime().UnixNano()))
+	}
+	return layers, nil
+}
+
+// changedBackupChunks returns the sorted indexes of chunks that overlap an
+// extent of a layer unknown to the parent backup. The result is not usable,
+// ok is false, if the chains share no layer or the disk has been resized.
+func changedBackupChunks(extents []qemuimg.SImageMapExtent, layers []string, parent *SBackupManifest, sizeBytes int64) ([]int64, bool) {
+	if len(parent.Layers) == 0 || len(layers) == 0 || parent.SizeBytes != sizeBytes {
+		return nil, false
+	}
+	known := make(map[string]bool, len(parent.Layers))
+	for _, layer := range parent.Layers {
+		known[layer] = true
+	}
+	shared := false
+	for _, layer := range layers {
+		if known[layer] {
+			shared = true
+			break
+		}
+	}
+	if !shared {
+		return nil, false
+	}
+	changed := make(map[int64]bool)
+	for _, extent := range extents {
+		var layerKnown bool
+		if extent.Depth < len(layers) {
+			layerKnown = known[layers[len(layers)-1-extent.Depth]]
+		} else {
+			// unallocated in the whole chain, unchanged as long as the base is
+			layerKnown = known[layers[0]]
+		}
+		if layerKnown || extent.Length <= 0 {
+			continue
+		}
+		for idx := extent.Start / parent.ChunkSize; idx <= (extent.Start+extent.Length-1)/parent.ChunkSize; idx++ {
+			changed[idx] = true
+		}
+	}
+	ret := make([]int64, 0, len(changed))
+	for idx := range changed {
+		ret = append(ret, idx)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret, true
+}
+
+// restoreChunkedBackup rebuilds the raw image of the chain leaf at targetPath
+func restoreChunkedBackup(ctx context.Context, backupStorage backupstorage.IBackupStorage, chain []*SBackupManifest, targetPath string, tmpDir string) error {
+	if len(chain) == 0 {
+		return errors.Wrap(errors.ErrEmpty, "empty backup chain")
+	}
+	leaf := chain[len(chain)-1]
+	file, err := os.OpenFile(targetPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "OpenFile %s", targetPath)
+	}
+	defer file.Close()
+	if err := file.Truncate(leaf.SizeBytes); err != nil {
+		return errors.Wrapf(err, "Truncate %s", targetPath)
+	}
+	chunkPath := path.Join(tmpDir, fmt.Sprintf("%s.chunk", leaf.BackupId))
+	defer os.Remove(chunkPath)
+	for _, chunk := range sortedBackupChunks(overlayBackupChunks(chain)) {
+		os.Remove(chunkPath)
+		if err := backupStorage.RestoreBackupChunkTo(ctx, chunkPath, leaf.ChainId, chunk.Hash); err != nil {
+			return errors.Wrapf(err, "RestoreBackupChunkTo %s", chunk.Hash)
+		}
+		data, err := ioutil.ReadFile(chunkPath)
+		if err != nil {
+			return errors.Wrapf(err, "ReadFile %s", chunkPath)
+		}
+		if hash := fmt.Sprintf("%x", sha256.Sum256(data)); hash != chunk.Hash {
+			return errors.Errorf("chunk %d of backup %s is corrupted: expect hash %s got %s", chunk.Index, leaf.BackupId, chunk.Hash, hash)
+		}
+		if _, err := file.WriteAt(data, chunk.Index*leaf.ChunkSize); err != nil {
+			return errors.Wrapf(err, "write chunk %d", chunk.Index)
+		}
+	}
+	return nil
+}
+
+// removeChunkedBackup removes the manifest and the chunks that no remaining
+// backup of the chain refers to
+func removeChunkedBackup(ctx context.Context, backupStorage backupstorage.IBackupStorage, manifest *SBackupManifest, remaining []*SBackupManifest) error {
+	err := backupStorage.RemoveBackup(ctx, manifest.BackupId)
+	if err != nil {
+		return errors.Wrapf(err, "RemoveBackup %s", manifest.BackupId)
+	}
+	inUse := referencedBackupChunks(remaining...)
+	for hash := range referencedBackupChunks(manifest) {
+		if inUse[hash] {
+			continue
+		}
+		if err := backupStorage.RemoveBackupChunk(ctx, manifest.ChainId, hash); err != nil {
+			return errors.Wrapf(err, "RemoveBackupChunk %s", hash)
+		}
+	}
+	return nil
+}
+
+func loadRemainingBackupManifests(ctx context.Context, backupStorage backupstorage.IBackupStorage, backupIds []string, tmpDir string) []*SBackupManifest {
+	ret := make([]*SBackupManifest, 0, len(backupIds))
+	for _, backupId := range backupIds {
+		manifest, err := loadBackupManifest(ctx, backupStorage, backupId, tmpDir)
+		if err != nil {
+			log.Warningf("skip backup %s of chain: %s", backupId, err)
+			continue
+		}
+		ret = append(ret, manifest)
+	}
+	return ret
+}
+
+func doChunkedBackupDisk(ctx context.Context, snapshotPath string, diskBackup *SDiskBackup) (int, error) {
+	backupTmpDir, err := EnsureBackupDir()
+	if err != nil {
+		return 0, errors.Wrap(err, "EnsureBackupDir")
+	}
+	defer CleanupDirOrFile(backupTmpDir)
+
+	backupStorage, err := backupstorage.GetBackupStorage(diskBackup.BackupStorageId, diskBackup.BackupStorageAccessInfo)
+	if err != nil {
+		return 0, errors.Wrap(err, "GetBackupStorage")
+	}
+	var parentChain []*SBackupManifest
+	if len(diskBackup.ParentBackupId) > 0 {
+		parentChain, err = loadBackupManifestChain(ctx, backupStorage, diskBackup.ParentBackupId, backupTmpDir)
+		if err != nil {
+			return 0, errors.Wrapf(err, "load chain of parent backup %s", diskBackup.ParentBackupId)
+		}
+	}
+
+	img, err := qemuimg.NewQemuImage(snapshotPath)
+	if err != nil {
+		return 0, errors.Wrap(err, "NewQemuImage snapshot")
+	}
+	manifest := newBackupManifest(diskBackup.BackupId, diskBackup.ParentBackupId, diskBackup.ChainId)
+	if layers, err := getBackupImageLayers(img); err != nil {
+		log.Warningf("unable to get layers of snapshot %s: %s", snapshotPath, err)
+	} else {
+		manifest.Layers = layers
+	}
+
+	if len(parentChain) > 0 && len(manifest.Layers) > 0 {
+		changed, ok := func() ([]int64, bool) {
+			extents, err := img.Map()
+			if err != nil {
+				log.Warningf("unable to map snapshot %s: %s", snapshotPath, err)
+				return nil, false
+			}
+			return changedBackupChunks(extents, manifest.Layers, parentChain[len(parentChain)-1], img.SizeBytes)
+		}()
+		if ok {
+			savedBytes, err := saveIncrementalChunkedBackup(ctx, backupStorage, img, changed, manifest, parentChain, backupTmpDir)
+			if err != nil {
+				return 0, errors.Wrap(err, "saveIncrementalChunkedBackup")
+			}
+			return int(savedBytes / 1024 / 1024), nil
+		}
+		log.Infof("no common layer with parent backup %s, read the whole snapshot %s", diskBackup.ParentBackupId, snapshotPath)
+	}
+
+	rawPath := path.Join(backupTmpDir, fmt.Sprintf("%s.raw", diskBackup.BackupId))
+	if _, err := img.Clone(rawPath, qemuimgfmt.RAW, false); err != nil {
+		return 0, errors.Wrap(err, "unable to convert snapshot to raw")
+	}
+	savedBytes, err := saveChunkedBackup(ctx, backupStorage, rawPath, manifest, parentChain, backupTmpDir)
+	if err != nil {
+		return 0, errors.Wrap(err, "saveChunkedBackup")
+	}
+	return int(savedBytes / 1024 / 1024), nil
+}
+
+// restoreBackupImage fetches the image of a backup to targetFilename, a
+// chunked backup is rebuilt from its chain as a raw image
+func restoreBackupImage(ctx context.Context, backupStorage backupstorage.IBackupStorage, backupId string, targetFilename string) (bool, error) {
+	err := backupStorage.RestoreBackupTo(ctx, targetFilename, backupId)
+	if err != nil {
+		return false, errors.Wrap(err, "RestoreBackupTo")
+	}
+	if !isBackupManifestFile(targetFilename) {
+		return false, nil
+	}
+	backupTmpDir, err := EnsureBackupDir()
+	if err != nil {
+		return false, errors.Wrap(err, "EnsureBackupDir")
+	}
+	defer CleanupDirOrFile(backupTmpDir)
+
+	chain, err := loadBackupManifestChain(ctx, backupStorage, backupId, backupTmpDir)
+	if err != nil {
+		return false, errors.Wrapf(err, "load chain of backup %s", backupId)
+	}
+	err = restoreChunkedBackup(ctx, backupStorage, chain, targetFilename, backupTmpDir)
+	if err != nil {
+		return false, errors.Wrap(err, "restoreChunkedBackup")
+	}
+	return true, nil
+}
+
+func convertRawToQcow2(filename string) error {
+	img, err := qemuimg.NewQemuImage(filename)
+	if err != nil {
+		return errors.Wrap(err, "NewQemuImage")
+	}
+	qcow2Path := fmt.Sprintf("%s.qcow2", filename)
+	if _, err := img.Clone(qcow2Path, qemuimgfmt.QCOW2, true); err != nil {
+		return errors.Wrap(err, "Clone")
+	}
+	if err := os.Rename(qcow2Path, filename); err != nil {
+		return errors.Wrapf(err, "Rename %s", qcow2Path)
+	}
+	return nil
+}
+
+func isBackupManifestFile(filename string) bool {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	head := make([]byte, 1)
+	if _, err := io.ReadFull(file, head); err != nil || head[0] != '{' {
+		return false
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+	_, ok := parseBackupManifest(data)
+	return ok
+}
+
+func DoDeleteBackup(ctx context.Context, params *SStorageBackup) error {
+	backupStorage, err := backupstorage.GetBackupStorage(params.BackupStorageId, params.BackupStorageAccessInfo)
+	if err != nil {
+		return errors.Wrap(err, "GetBackupStorage")
+	}
+	if err := removeTpmStateBackup(ctx, backupStorage, params.BackupId); err != nil {
+		return errors.Wrap(err, "removeTpmStateBackup")
+	}
+	if len(params.ChainId) == 0 {
+		return backupStorage.RemoveBackup(ctx, params.BackupId)
+	}
+	exists, err := backupStorage.IsBackupExists(params.BackupId)
+	if err != nil {
+		return errors.Wrap(err, "IsBackupExists")
+	}
+	if !exists {
+		return nil
+	}
+	backupTmpDir, err := EnsureBackupDir()
+	if err != nil {
+		return errors.Wrap(err, "EnsureBackupDir")
+	}
+	defer CleanupDirOrFile(backupTmpDir)
+
+	manifest, err := loadBackupManifest(ctx, backupStorage, params.BackupId, backupTmpDir)
+	if err != nil {
+		log.Warningf("backup %s of chain %s has no manifest: %s", params.BackupId, params.ChainId, err)
+		return backupStorage.RemoveBackup(ctx, params.BackupId)
+	}
+	remaining := loadRemainingBackupManifests(ctx, backupStorage, params.ChainBackupIds, backupTmpDir)
+	return removeChunkedBackup(ctx, backupStorage, manifest, remaining)
+}
+
+func DoMergeBackup(ctx context.Context, params *SStorageMergeBackup) error {
+	backupStorage, err := backupstorage.GetBackupStorage(params.BackupStorageId, params.BackupStorageAccessInfo)
+	if err != nil {
+		return errors.Wrap(err, "GetBackupStorage")
+	}
+	backupTmpDir, err := EnsureBackupDir()
+	if err != nil {
+		return errors.Wrap(err, "EnsureBackupDir")
+	}
+	defer CleanupDirOrFile(backupTmpDir)
+
+	base, err := loadBackupManifest(ctx, backupStorage, params.BackupId, backupTmpDir)
+	if err != nil {
+		return errors.Wrapf(err, "load base backup %s", params.BackupId)
+	}
+	inc, err := loadBackupManifest(ctx, backupStorage, params.IntoBackupId, backupTmpDir)
+	if err != nil {
+		return errors.Wrapf(err, "load incremental backup %s", params.IntoBackupId)
+	}
+	if inc.ParentBackupId != base.BackupId {
+		return errors.Wrapf(errors.ErrInvalidStatus, "backup %s is not based on %s", inc.BackupId, base.BackupId)
+	}
+	merged := mergeBackupManifests(base, inc)
+	if err := saveBackupManifest(ctx, backupStorage, merged, backupTmpDir); err != nil {
+		return errors.Wrapf(err, "save merged backup %s", merged.BackupId)
+	}
+	remaining := loadRemainingBackupManifests(ctx, backupStorage, params.ChainBackupIds, backupTmpDir)
+	remaining = append(remaining, merged)
+	return removeChunkedBackup(ctx, backupStorage, base, remaining)
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageman
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/util/qemuimg"
+)
+
+type sMemBackupStorage struct {
+	backups map[string][]byte
+	chunks  map[string][]byte
+}
+
+func newMemBackupStorage() *sMemBackupStorage {
+	return &sMemBackupStorage{
+		backups: map[string][]byte{},
+		chunks:  map[string][]byte{},
+	}
+}
+
+func (s *sMemBackupStorage) save(store map[string][]byte, src, id string) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	store[id] = data
+	return nil
+}
+
+func (s *sMemBackupStorage) restore(store map[string][]byte, target, id string) error {
+	data, ok := store[id]
+	if !ok {
+		return errors.ErrNotFound
+	}
+	return ioutil.WriteFile(target, data, 0644)
+}
+
+func (s *sMemBackupStorage) SaveBackupFrom(ctx context.Context, src string, id string) error {
+	return s.save(s.backups, src, id)
+}
+
+func (s *sMemBackupStorage) RestoreBackupTo(ctx context.Context, target string, id string) error {
+	return s.restore(s.backups, target, id)
+}
+
+func (s *sMemBackupStorage) RemoveBackup(ctx context.Context, id string) error {
+	delete(s.backups, id)
+	return nil
+}
+
+func (s *sMemBackupStorage) IsBackupExists(id string) (bool, error) {
+	_, ok := s.backups[id]
+	return ok, nil
+}
+
+func (s *sMemBackupStorage) SaveBackupInstanceFrom(ctx context.Context, src string, id string) error {
+	return nil
+}
+
+func (s *sMemBackupStorage) RestoreBackupInstanceTo(ctx context.Context, target string, id string) error {
+	return nil
+}
+
+func (s *sMemBackupStorage) RemoveBackupInstance(ctx context.Context, id string) error {
+	return nil
+}
+
+func (s *sMemBackupStorage) IsBackupInstanceExists(id string) (bool, error) {
+	return false, nil
+}
+
+func (s *sMemBackupStorage) SaveBackupChunkFrom(ctx context.Context, src string, chainId string, hash string) error {
+	return s.save(s.chunks, src, chainId+"/"+hash)
+}
+
+func (s *sMemBackupStorage) RestoreBackupChunkTo(ctx context.Context, target string, chainId string, hash string) error {
+	return s.restore(s.chunks, target, chainId+"/"+hash)
+}
+
+func (s *sMemBackupStorage) RemoveBackupChunk(ctx context.Context, chainId string, hash string) error {
+	delete(s.chunks, chainId+"/"+hash)
+	return nil
+}
+
+func (s *sMemBackupStorage) IsBackupChunkExists(chainId string, hash string) (bool, error) {
+	_, ok := s.chunks[chainId+"/"+hash]
+	return ok, nil
+}
+
+func (s *sMemBackupStorage) IsOnline() (bool, string, error) {
+	return true, "", nil
+}
+
+func testChunk(b byte) []byte {
+	return bytes.Repeat([]byte{b}, backupChunkSize)
+}
+
+func TestChunkedBackupChain(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "backupchunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	store := newMemBackupStorage()
+	rawPath := path.Join(tmpDir, "disk.raw")
+
+	images := [][]byte{
+		bytes.Join([][]byte{testChunk(1), testChunk(0), testChunk(2), testChunk(1)}, nil),
+		bytes.Join([][]byte{testChunk(1), testChunk(3), testChunk(0), testChunk(1)}, nil),
+		bytes.Join([][]byte{testChunk(4), testChunk(3), testChunk(0), testChunk(1), []byte{5, 5}}, nil),
+	}
+	backupIds := []string{"full", "inc1", "inc2"}
+	var chain []*SBackupManifest
+	for i, image := range images {
+		if err := ioutil.WriteFile(rawPath, image, 0644); err != nil {
+			t.Fatal(err)
+		}
+		parentId := ""
+		if i > 0 {
+			parentId = backupIds[i-1]
+		}
+		manifest := newBackupManifest(backupIds[i], parentId, "chain")
+		if _, err := saveChunkedBackup(ctx, store, rawPath, manifest, chain, tmpDir); err != nil {
+			t.Fatalf("save %s: %s", backupIds[i], err)
+		}
+		chain = append(chain, manifest)
+	}
+	// chunk 1 and chunk 3 of the full backup share the same content
+	if len(chain[0].Chunks) != 3 || len(store.chunks) != 5 {
+		t.Errorf("unexpected chunks: full %d stored %d", len(chain[0].Chunks), len(store.chunks))
+	}
+	if len(chain[1].Chunks) != 2 {
+		t.Errorf("inc1 should only record the 2 changed chunks, got %#v", chain[1].Chunks)
+	}
+
+	for i, backupId := range backupIds {
+		loaded, err := loadBackupManifestChain(ctx, store, backupId, tmpDir)
+		if err != nil {
+			t.Fatalf("load chain of %s: %s", backupId, err)
+		}
+		if len(loaded) != i+1 {
+			t.Fatalf("chain of %s has %d backups", backupId, len(loaded))
+		}
+		restorePath := path.Join(tmpDir, backupId+".restore")
+		if err := restoreChunkedBackup(ctx, store, loaded, restorePath, tmpDir); err != nil {
+			t.Fatalf("restore %s: %s", backupId, err)
+		}
+		data, _ := ioutil.ReadFile(restorePath)
+		if !bytes.Equal(data, images[i]) {
+			t.Errorf("restored %s mismatch", backupId)
+		}
+	}
+
+	// merge the full backup into inc1, chunk 2 of the full backup is no longer referenced
+	merged := mergeBackupManifests(chain[0], chain[1])
+	if merged.ParentBackupId != "" || len(merged.Chunks) != 3 {
+		t.Errorf("unexpected merged manifest %#v", merged)
+	}
+	if err := saveBackupManifest(ctx, store, merged, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeChunkedBackup(ctx, store, chain[0], []*SBackupManifest{merged, chain[2]}); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.chunks) != 4 {
+		t.Errorf("expect 4 chunks after merge, got %d", len(store.chunks))
+	}
+	loaded, err := loadBackupManifestChain(ctx, store, "inc2", tmpDir)
+	if err != nil || len(loaded) != 2 {
+		t.Fatalf("load chain after merge: %v %d", err, len(loaded))
+	}
+	restorePath := path.Join(tmpDir, "merged.restore")
+	if err := restoreChunkedBackup(ctx, store, loaded, restorePath, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(restorePath)
+	if !bytes.Equal(data, images[2]) {
+		t.Errorf("restored inc2 after merge mismatch")
+	}
+}
+
+func TestParseBackupManifest(t *testing.T) {
+	if _, ok := parseBackupManifest([]byte("QFI\xfb")); ok {
+		t.Errorf("qcow2 header parsed as manifest")
+	}
+	if _, ok := parseBackupManifest([]byte(`{"magic":"other"}`)); ok {
+		t.Errorf("unknown magic parsed as manifest")
+	}
+	if m, ok := parseBackupManifest([]byte(`{"magic":"onecloud-backup-manifest","backup_id":"b","chunks":[{"index":1,"hash":"x"}]}`)); !ok || m.BackupId != "b" || len(m.Chunks) != 1 {
+		t.Errorf("parse manifest failed: %#v", m)
+	}
+}
+
+func TestChangedBackupChunks(t *testing.T) {
+	size := int64(8 * backupChunkSize)
+	parent := newBackupManifest("inc1", "full", "chain")
+	parent.SizeBytes = size
+	parent.Layers = []string{"base:1:1", "snap1:1:1"}
+
+	// snap2 is the only layer the parent backup has not seen
+	layers := []string{"base:1:1", "snap1:1:1", "snap2:1:1"}
+	extents := []qemuimg.SImageMapExtent{
+		{Start: 0, Length: backupChunkSize, Depth: 0},
+		{Start: backupChunkSize, Length: backupChunkSize + 10, Depth: 1},
+		{Start: 2*backupChunkSize + 10, Length: backupChunkSize - 10, Depth: 0},
+		{Start: 3 * backupChunkSize, Length: 2 * backupChunkSize, Depth: 2},
+		{Start: 5 * backupChunkSize, Length: backupChunkSize, Depth: 0},
+		{Start: 6 * backupChunkSize, Length: 2 * backupChunkSize, Depth: 3, Zero: true},
+	}
+	changed, ok := changedBackupChunks(extents, layers, parent, size)
+	if !ok {
+		t.Fatalf("chains sharing layers should be incremental")
+	}
+	if want := []int64{0, 2, 5}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed chunks %v, want %v", changed, want)
+	}
+	if runs := backupChunkRuns(changed); !reflect.DeepEqual(runs, [][2]int64{{0, 1}, {2, 1}, {5, 1}}) {
+		t.Errorf("unexpected runs %v", runs)
+	}
+
+	// the base has been rewritten, unallocated chunks may have changed too
+	layers = []string{"base:2:2", "snap1:1:1", "snap2:1:1"}
+	changed, ok = changedBackupChunks(extents, layers, parent, size)
+	if !ok || !reflect.DeepEqual(changed, []int64{0, 2, 3, 4, 5, 6, 7}) {
+		t.Errorf("changed chunks with rewritten base %v %v", changed, ok)
+	}
+
+	if _, ok := changedBackupChunks(extents, []string{"other:1:1"}, parent, size); ok {
+		t.Errorf("chains without common layer should fall back to full read")
+	}
+	if _, ok := changedBackupChunks(extents, layers, parent, size*2); ok {
+		t.Errorf("resized disk should fall back to full read")
+	}
+}
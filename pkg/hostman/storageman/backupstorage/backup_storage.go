@@ -45,6 +45,15 @@ type IBackupStorage interface {
 	// 备份是否存在
 	IsBackupInstanceExists(backupInstanceId string) (bool, error)
 
+	// 从指定路径拷贝备份数据块到备份存储, 数据块按备份链和内容哈希寻址
+	SaveBackupChunkFrom(ctx context.Context, srcFilename string, chainId string, chunkHash string) error
+	// 将备份链chainId中哈希为chunkHash的数据块拷贝到指定的文件路径
+	RestoreBackupChunkTo(ctx context.Context, targetFilename string, chainId string, chunkHash string) error
+	// 删除备份数据块
+	RemoveBackupChunk(ctx context.Context, chainId string, chunkHash string) error
+	// 备份数据块是否存在
+	IsBackupChunkExists(chainId string, chunkHash string) (bool, error)
+
 	// ConvertTo(destPath string, format qemuimgfmt.TImageFormat, backupId string) error
 	// ConvertFrom(srcPath string, format qemuimgfmt.TImageFormat, backupId string) (int, error)
 	// InstancePack(ctx context.Context, packageName string, backupIds []string, metadata *api.InstanceBackupPackMetadata) (string, error)
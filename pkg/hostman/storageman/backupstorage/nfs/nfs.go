@@ -67,6 +67,18 @@ func (s *SNFSBackupStorage) getBackupInstancePath(backupInstanceId string) strin
 	return path.Join(s.getPackageDir(), backupInstanceId)
 }
 
+func (s *SNFSBackupStorage) getChunkDir() string {
+	return path.Join(s.Path, "backupchunks")
+}
+
+func (s *SNFSBackupStorage) getBackupChunkPath(chunkId string) string {
+	return path.Join(s.getChunkDir(), chunkId)
+}
+
+func getBackupChunkId(chainId, chunkHash string) string {
+	return path.Join(chainId, chunkHash)
+}
+
 func (s *SNFSBackupStorage) checkAndMount() error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -145,6 +157,24 @@ func (s *SNFSBackupStorage) saveFile(ctx context.Context, srcFilename string, id
 	return nil
 }
 
+func (s *SNFSBackupStorage) SaveBackupChunkFrom(ctx context.Context, srcFilename string, chainId string, chunkHash string) error {
+	err := s.checkAndMount()
+	if err != nil {
+		return errors.Wrap(err, "unable to checkAndMount")
+	}
+	defer s.unMount()
+
+	chainDir := path.Join(s.getChunkDir(), chainId)
+	if !fileutils2.Exists(chainDir) {
+		output, err := procutils.NewCommand("mkdir", "-p", chainDir).Output()
+		if err != nil {
+			log.Errorf("mkdir %s failed: %s", chainDir, output)
+			return errors.Wrapf(err, "mkdir %s failed: %s", chainDir, output)
+		}
+	}
+	return s.saveFile(ctx, srcFilename, getBackupChunkId(chainId, chunkHash), s.getBackupChunkPath)
+}
+
 func (s *SNFSBackupStorage) RestoreBackupTo(ctx context.Context, targetFilename string, backupId string) error {
 	return s.restoreFile(ctx, targetFilename, backupId, s.getBackupDiskPath)
 }
@@ -153,6 +183,10 @@ func (s *SNFSBackupStorage) RestoreBackupInstanceTo(ctx context.Context, targetF
 	return s.restoreFile(ctx, targetFilename, backupId, s.getBackupInstancePath)
 }
 
+func (s *SNFSBackupStorage) RestoreBackupChunkTo(ctx context.Context, targetFilename string, chainId string, chunkHash string) error {
+	return s.restoreFile(ctx, targetFilename, getBackupChunkId(chainId, chunkHash), s.getBackupChunkPath)
+}
+
 func (s *SNFSBackupStorage) restoreFile(ctx context.Context, targetFilename string, id string, getPathFunc func(string) string) error {
 	err := s.checkAndMount()
 	if err != nil {
@@ -176,6 +210,10 @@ func (s *SNFSBackupStorage) RemoveBackupInstance(ctx context.Context, backupId s
 	return s.removeFile(ctx, backupId, s.getBackupInstancePath)
 }
 
+func (s *SNFSBackupStorage) RemoveBackupChunk(ctx context.Context, chainId string, chunkHash string) error {
+	return s.removeFile(ctx, getBackupChunkId(chainId, chunkHash), s.getBackupChunkPath)
+}
+
 func (s *SNFSBackupStorage) removeFile(ctx context.Context, id string, getPathFunc func(id string) string) error {
 	err := s.checkAndMount()
 	if err != nil {
@@ -202,6 +240,10 @@ func (s *SNFSBackupStorage) IsBackupInstanceExists(backupId string) (bool, error
 	return s.isFileExists(backupId, s.getBackupInstancePath)
 }
 
+func (s *SNFSBackupStorage) IsBackupChunkExists(chainId string, chunkHash string) (bool, error) {
+	return s.isFileExists(getBackupChunkId(chainId, chunkHash), s.getBackupChunkPath)
+}
+
 func (s *SNFSBackupStorage) isFileExists(id string, getPathFunc func(id string) string) (bool, error) {
 	err := s.checkAndMount()
 	if err != nil {
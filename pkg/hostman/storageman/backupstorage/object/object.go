@@ -81,6 +81,7 @@ func parseBucketUrl(bucketUrl string) (string, string, error) {
 
 const backupPathPrefix = "backups"
 const backupInstancePathPrefix = "backuppacks"
+const backupChunkPathPrefix = "backupchunks"
 
 func (s *SObjectBackupStorage) getBackupKey(backupId string) string {
 	return fmt.Sprintf("%s/%s", backupPathPrefix, backupId)
@@ -90,6 +91,14 @@ func (s *SObjectBackupStorage) getBackupInstanceKey(backupInstancePackName strin
 	return fmt.Sprintf("%s/%s", backupInstancePathPrefix, backupInstancePackName)
 }
 
+func (s *SObjectBackupStorage) getBackupChunkKey(chunkId string) string {
+	return fmt.Sprintf("%s/%s", backupChunkPathPrefix, chunkId)
+}
+
+func getBackupChunkId(chainId, chunkHash string) string {
+	return fmt.Sprintf("%s/%s", chainId, chunkHash)
+}
+
 func (s *SObjectBackupStorage) getBucket() (cloudprovider.ICloudBucket, error) {
 	bucket, err := s.store.GetIRegion().GetIBucketByName(s.bucket)
 	if err != nil {
@@ -106,6 +115,10 @@ func (s *SObjectBackupStorage) SaveBackupInstanceFrom(ctx context.Context, srcFi
 	return s.saveObject(ctx, srcFilename, backupId, s.getBackupInstanceKey)
 }
 
+func (s *SObjectBackupStorage) SaveBackupChunkFrom(ctx context.Context, srcFilename string, chainId string, chunkHash string) error {
+	return s.saveObject(ctx, srcFilename, getBackupChunkId(chainId, chunkHash), s.getBackupChunkKey)
+}
+
 func (s *SObjectBackupStorage) saveObject(ctx context.Context, srcFilename string, id string, getKeyFunc func(string) string) error {
 	bucket, err := s.getBucket()
 	if err != nil {
@@ -137,6 +150,10 @@ func (s *SObjectBackupStorage) RestoreBackupInstanceTo(ctx context.Context, targ
 	return s.restoreObject(ctx, targetFilename, backupId, s.getBackupInstanceKey)
 }
 
+func (s *SObjectBackupStorage) RestoreBackupChunkTo(ctx context.Context, targetFilename string, chainId string, chunkHash string) error {
+	return s.restoreObject(ctx, targetFilename, getBackupChunkId(chainId, chunkHash), s.getBackupChunkKey)
+}
+
 func (s *SObjectBackupStorage) restoreObject(ctx context.Context, targetFilename string, id string, getKeyFunc func(string) string) error {
 	bucket, err := s.getBucket()
 	if err != nil {
@@ -166,6 +183,10 @@ func (s *SObjectBackupStorage) RemoveBackupInstance(ctx context.Context, backupI
 	return s.removeObject(ctx, backupId, s.getBackupInstanceKey)
 }
 
+func (s *SObjectBackupStorage) RemoveBackupChunk(ctx context.Context, chainId string, chunkHash string) error {
+	return s.removeObject(ctx, getBackupChunkId(chainId, chunkHash), s.getBackupChunkKey)
+}
+
 func (s *SObjectBackupStorage) removeObject(ctx context.Context, id string, getKeyFunc func(string) string) error {
 	bucket, err := s.getBucket()
 	if err != nil {
@@ -186,6 +207,10 @@ func (s *SObjectBackupStorage) IsBackupInstanceExists(backupId string) (bool, er
 	return s.isObjectExists(backupId, s.getBackupInstanceKey)
 }
 
+func (s *SObjectBackupStorage) IsBackupChunkExists(chainId string, chunkHash string) (bool, error) {
+	return s.isObjectExists(getBackupChunkId(chainId, chunkHash), s.getBackupChunkKey)
+}
+
 func (s *SObjectBackupStorage) isObjectExists(id string, getKeyFunc func(string) string) (bool, error) {
 	bucket, err := s.getBucket()
 	if err != nil {
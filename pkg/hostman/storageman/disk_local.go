@@ -136,6 +136,7 @@ func (d *SLocalDisk) Delete(ctx context.Context, params interface{}) (jsonutils.
 	if err := d.Storage.DeleteDiskfile(dpath, p.SkipRecycle != nil && *p.SkipRecycle); err != nil {
 		return nil, err
 	}
+	RemoveTpmState(dpath)
 	d.UmountFuseImage()
 	if p.EsxiFlatFilePath != "" {
 		connections := &deployapi.EsxiDisksConnectionInfo{Disks: []*deployapi.EsxiDiskInfo{{DiskPath: p.EsxiFlatFilePath}}}
@@ -475,6 +476,9 @@ func (d *SLocalDisk) DiskBackup(ctx context.Context, params interface{}) (jsonut
 	if err != nil {
 		return nil, errors.Wrap(err, "doBackupDisk")
 	}
+	if err := backupDiskTpmState(ctx, snapshotPath, diskBackup); err != nil {
+		return nil, errors.Wrap(err, "backupDiskTpmState")
+	}
 
 	data := jsonutils.NewDict()
 	data.Set("size_mb", jsonutils.NewInt(int64(size)))
@@ -492,20 +496,26 @@ func (d *SLocalDisk) CreateSnapshot(snapshotId string, encryptKey string, encFor
 		}
 	}
 	snapshotPath := path.Join(snapshotDir, snapshotId)
+	if err := CopyTpmState(d.getPath(), snapshotPath); err != nil {
+		return errors.Wrap(err, "copy tpm state to snapshot")
+	}
 	output, err := procutils.NewCommand("mv", "-f", d.getPath(), snapshotPath).Output()
 	if err != nil {
 		log.Errorf("mv %s to %s failed %s", d.getPath(), snapshotPath, output)
+		RemoveTpmState(snapshotPath)
 		return errors.Wrapf(err, "mv %s to %s failed %s", d.getPath(), snapshotPath, output)
 	}
 	img, err := qemuimg.NewQemuImage(d.getPath())
 	if err != nil {
 		log.Errorln(err)
 		procutils.NewCommand("mv", "-f", snapshotPath, d.getPath()).Run()
+		RemoveTpmState(snapshotPath)
 		return err
 	}
 	if err := img.CreateQcow2(0, false, snapshotPath, encryptKey, encFormat, encAlg); err != nil {
 		log.Errorf("Snapshot create image error %s", err)
 		procutils.NewCommand("mv", "-f", snapshotPath, d.getPath()).Run()
+		RemoveTpmState(snapshotPath)
 		return err
 	}
 	return nil
@@ -536,7 +546,11 @@ func (d *SLocalDisk) ConvertSnapshot(convertSnapshotId string, encryptInfo apis.
 
 func (d *SLocalDisk) DeleteSnapshot(snapshotId, convertSnapshot string, blockStream bool, encryptInfo apis.SEncryptInfo) error {
 	snapshotDir := d.GetSnapshotDir()
-	return DeleteLocalSnapshot(snapshotDir, snapshotId, d.getPath(), convertSnapshot, blockStream)
+	if err := DeleteLocalSnapshot(snapshotDir, snapshotId, d.getPath(), convertSnapshot, blockStream); err != nil {
+		return err
+	}
+	RemoveTpmState(path.Join(snapshotDir, snapshotId))
+	return nil
 }
 
 func (d *SLocalDisk) PrepareSaveToGlance(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
@@ -632,6 +646,9 @@ func (d *SLocalDisk) resetFromSnapshot(snapshotPath string, outOfChain bool, enc
 		err = errors.Wrapf(err, "rm disk tmp path %s", output)
 		return nil, err
 	}
+	if err := CopyTpmState(snapshotPath, d.GetPath()); err != nil {
+		return nil, errors.Wrap(err, "restore tpm state from snapshot")
+	}
 	return nil, nil
 }
 
@@ -401,6 +401,16 @@ func (d *SLVMDisk) GetBackupPath(backupId string) string {
 func (d *SLVMDisk) DiskBackup(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
 	diskBackup := params.(*SDiskBackup)
 
+	if len(diskBackup.ChainId) > 0 && len(diskBackup.EncryptKeyId) == 0 {
+		sizeMb, err := doChunkedBackupDisk(ctx, d.GetSnapshotPath(diskBackup.SnapshotId), diskBackup)
+		if err != nil {
+			return nil, errors.Wrap(err, "doChunkedBackupDisk")
+		}
+		data := jsonutils.NewDict()
+		data.Set("size_mb", jsonutils.NewInt(int64(sizeMb)))
+		return data, nil
+	}
+
 	var encKey = ""
 	var encAlg seclib2.TSymEncAlg
 	if len(diskBackup.EncryptKeyId) > 0 {
@@ -102,6 +102,9 @@ func (s *SLocalStorage) CreateDiskFromBackup(ctx context.Context, disk IDisk, in
 	if err != nil {
 		return errors.Wrap(err, "doRestoreDisk")
 	}
+	if err := restoreDiskTpmState(ctx, input, disk.GetPath()); err != nil {
+		return errors.Wrap(err, "restoreDiskTpmState")
+	}
 	/*info := input.DiskInfo
 	backupDir := s.GetBackupDir()
 	if !fileutils2.Exists(backupDir) {
@@ -179,7 +182,8 @@ func (s *SLocalStorage) storageBackupRecovery(ctx context.Context, sbParams *SSt
 		return nil, err
 	}
 	backupPath := path.Join(s.GetBackupDir(), sbParams.BackupId)
-	return nil, backupStorage.RestoreBackupTo(ctx, backupPath, sbParams.BackupId)
+	_, err = restoreBackupImage(ctx, backupStorage, sbParams.BackupId, backupPath)
+	return nil, err
 }
 
 func (s *SLocalStorage) StorageBackupRecovery(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
@@ -72,6 +72,9 @@ func AddStorageHandler(prefix string, app *appsrv.Application) {
 		app.AddHandler("POST",
 			fmt.Sprintf("%s/%s/delete-backup", prefix, keyWords),
 			auth.Authenticate(storageDeleteBackup))
+		app.AddHandler("POST",
+			fmt.Sprintf("%s/%s/merge-backup", prefix, keyWords),
+			auth.Authenticate(storageMergeBackup))
 		app.AddHandler("POST",
 			fmt.Sprintf("%s/%s/sync-backup", prefix, keyWords),
 			auth.Authenticate(storageSyncBackup))
@@ -409,14 +412,40 @@ func storageDeleteBackup(ctx context.Context, w http.ResponseWriter, r *http.Req
 		hostutils.Response(ctx, w, httperrors.NewMissingParameterError("backup_storage_access_info"))
 		return
 	}
+	chainId, _ := body.GetString("chain_id")
+	chainBackupIds := make([]string, 0)
+	body.Unmarshal(&chainBackupIds, "chain_backup_ids")
 	hostutils.DelayTask(ctx, deleteBackup, &storageman.SStorageBackup{
 		BackupId:                backupId,
 		BackupStorageId:         backupStorageId,
 		BackupStorageAccessInfo: backupStorageAccessInfo.(*jsonutils.JSONDict),
+		ChainId:                 chainId,
+		ChainBackupIds:          chainBackupIds,
 	})
 	hostutils.ResponseOk(ctx, w)
 }
 
+func storageMergeBackup(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	_, _, body := appsrv.FetchEnv(ctx, w, r)
+	if !checkOptions(ctx, w, body, "backup_id", "into_backup_id", "chain_id", "backup_storage_id", "backup_storage_access_info") {
+		return
+	}
+	params := &storageman.SStorageMergeBackup{}
+	params.BackupId, _ = body.GetString("backup_id")
+	params.IntoBackupId, _ = body.GetString("into_backup_id")
+	params.ChainId, _ = body.GetString("chain_id")
+	params.BackupStorageId, _ = body.GetString("backup_storage_id")
+	accessInfo, _ := body.Get("backup_storage_access_info")
+	params.BackupStorageAccessInfo = accessInfo.(*jsonutils.JSONDict)
+	body.Unmarshal(&params.ChainBackupIds, "chain_backup_ids")
+	hostutils.DelayTask(ctx, mergeBackup, params)
+	hostutils.ResponseOk(ctx, w)
+}
+
+func mergeBackup(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
+	return nil, storageman.DoMergeBackup(ctx, params.(*storageman.SStorageMergeBackup))
+}
+
 func checkOptions(ctx context.Context, w http.ResponseWriter, body jsonutils.JSONObject, options ...string) bool {
 	for _, option := range options {
 		if body.Contains(option) {
@@ -430,11 +459,7 @@ func checkOptions(ctx context.Context, w http.ResponseWriter, body jsonutils.JSO
 
 func deleteBackup(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
 	sbParams := params.(*storageman.SStorageBackup)
-	backupStorage, err := backupstorage.GetBackupStorage(sbParams.BackupStorageId, sbParams.BackupStorageAccessInfo)
-	if err != nil {
-		return nil, err
-	}
-	err = backupStorage.RemoveBackup(ctx, sbParams.BackupId)
+	err := storageman.DoDeleteBackup(ctx, sbParams)
 	if err != nil {
 		return nil, err
 	}
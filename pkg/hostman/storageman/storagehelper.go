@@ -82,6 +82,11 @@ type SDiskBackup struct {
 	BackupStorageId         string              `json:"backup_storage_id"`
 	BackupStorageAccessInfo *jsonutils.JSONDict `json:"backup_storage_access_info"`
 
+	// chunked backups of the same chain share chain_id, an incremental
+	// backup only stores the chunks changed since parent_backup_id
+	ChainId        string `json:"chain_id"`
+	ParentBackupId string `json:"parent_backup_id"`
+
 	EncryptKeyId string `json:"encrypt_key_id"`
 
 	UserCred mcclient.TokenCredential
@@ -92,6 +97,20 @@ type SStorageBackup struct {
 	BackupLocalPath         string
 	BackupStorageId         string
 	BackupStorageAccessInfo *jsonutils.JSONDict
+
+	ChainId string
+	// the other backups of the chain whose chunks must be kept
+	ChainBackupIds []string
+}
+
+type SStorageMergeBackup struct {
+	BackupId                string
+	IntoBackupId            string
+	BackupStorageId         string
+	BackupStorageAccessInfo *jsonutils.JSONDict
+
+	ChainId        string
+	ChainBackupIds []string
 }
 
 type SStoragePackBackup struct {
@@ -0,0 +1,217 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageman
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/hostman/storageman/backupstorage"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+	"yunion.io/x/onecloud/pkg/util/procutils"
+)
+
+// The persistent state of swtpm is kept in a directory beside the system
+// disk file of the guest, so it follows the disk across snapshot, reset,
+// backup and migration
+const (
+	TPM_STATE_SUFFIX        = ".tpm"
+	TPM_STATE_BACKUP_SUFFIX = ".tpm.tar"
+)
+
+func GetTpmStateDir(diskPath string) string {
+	return diskPath + TPM_STATE_SUFFIX
+}
+
+func HasTpmState(diskPath string) bool {
+	return fileutils2.IsDir(GetTpmStateDir(diskPath))
+}
+
+// CopyTpmState replaces the tpm state of dstPath with the one of srcPath,
+// nothing is done if srcPath has no tpm state
+func CopyTpmState(srcPath, dstPath string) error {
+	if !HasTpmState(srcPath) {
+		return nil
+	}
+	srcDir, dstDir := GetTpmStateDir(srcPath), GetTpmStateDir(dstPath)
+	tmpDir := dstDir + ".tmp"
+	if output, err := procutils.NewCommand("rm", "-rf", tmpDir).Output(); err != nil {
+		return errors.Wrapf(err, "rm %s: %s", tmpDir, output)
+	}
+	if output, err := procutils.NewCommand("cp", "-a", srcDir, tmpDir).Output(); err != nil {
+		return errors.Wrapf(err, "cp %s to %s: %s", srcDir, tmpDir, output)
+	}
+	if output, err := procutils.NewCommand("rm", "-rf", dstDir).Output(); err != nil {
+		return errors.Wrapf(err, "rm %s: %s", dstDir, output)
+	}
+	if output, err := procutils.NewCommand("mv", "-f", tmpDir, dstDir).Output(); err != nil {
+		return errors.Wrapf(err, "mv %s to %s: %s", tmpDir, dstDir, output)
+	}
+	return nil
+}
+
+func RemoveTpmState(diskPath string) {
+	if !HasTpmState(diskPath) {
+		return
+	}
+	if output, err := procutils.NewCommand("rm", "-rf", GetTpmStateDir(diskPath)).Output(); err != nil {
+		log.Errorf("remove tpm state of %s: %s %s", diskPath, err, output)
+	}
+}
+
+// PackTpmState returns the state files of diskPath encoded as base64, a nil
+// map is returned if there is no tpm state
+func PackTpmState(diskPath string) (map[string]string, error) {
+	if !HasTpmState(diskPath) {
+		return nil, nil
+	}
+	stateDir := GetTpmStateDir(diskPath)
+	files, err := ioutil.ReadDir(stateDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read dir %s", stateDir)
+	}
+	ret := map[string]string{}
+	for _, f := range files {
+		// lock files are owned by the running swtpm
+		if !f.Mode().IsRegular() || strings.HasSuffix(f.Name(), ".lock") {
+			continue
+		}
+		content, err := ioutil.ReadFile(path.Join(stateDir, f.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", f.Name())
+		}
+		ret[f.Name()] = base64.StdEncoding.EncodeToString(content)
+	}
+	return ret, nil
+}
+
+func UnpackTpmState(diskPath string, state map[string]string) error {
+	stateDir := GetTpmStateDir(diskPath)
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return errors.Wrapf(err, "mkdir %s", stateDir)
+	}
+	for name, data := range state {
+		if strings.Contains(name, "/") {
+			return errors.Errorf("invalid tpm state file name %q", name)
+		}
+		content, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return errors.Wrapf(err, "decode %s", name)
+		}
+		if err := ioutil.WriteFile(path.Join(stateDir, name), content, 0600); err != nil {
+			return errors.Wrapf(err, "write %s", name)
+		}
+	}
+	return nil
+}
+
+func getTpmStateBackupId(backupId string) string {
+	return backupId + TPM_STATE_BACKUP_SUFFIX
+}
+
+// backupTpmState saves the tpm state of the snapshot as a standalone tarball
+// beside the disk backup
+func backupTpmState(ctx context.Context, backupStorage backupstorage.IBackupStorage, snapshotPath string, backupId string) error {
+	if !HasTpmState(snapshotPath) {
+		return nil
+	}
+	backupTmpDir, err := EnsureBackupDir()
+	if err != nil {
+		return errors.Wrap(err, "EnsureBackupDir")
+	}
+	defer CleanupDirOrFile(backupTmpDir)
+
+	stateDir := GetTpmStateDir(snapshotPath)
+	tarPath := path.Join(backupTmpDir, getTpmStateBackupId(backupId))
+	if output, err := procutils.NewCommand("tar", "-cf", tarPath, "-C", stateDir, ".").Output(); err != nil {
+		return errors.Wrapf(err, "tar %s: %s", stateDir, output)
+	}
+	if err := backupStorage.SaveBackupFrom(ctx, tarPath, getTpmStateBackupId(backupId)); err != nil {
+		return errors.Wrap(err, "SaveBackupFrom")
+	}
+	return nil
+}
+
+func restoreTpmState(ctx context.Context, backupStorage backupstorage.IBackupStorage, backupId string, diskPath string) error {
+	tpmBackupId := getTpmStateBackupId(backupId)
+	exists, err := backupStorage.IsBackupExists(tpmBackupId)
+	if err != nil {
+		return errors.Wrapf(err, "IsBackupExists %s", tpmBackupId)
+	}
+	if !exists {
+		return nil
+	}
+	backupTmpDir, err := EnsureBackupDir()
+	if err != nil {
+		return errors.Wrap(err, "EnsureBackupDir")
+	}
+	defer CleanupDirOrFile(backupTmpDir)
+
+	tarPath := path.Join(backupTmpDir, tpmBackupId)
+	if err := backupStorage.RestoreBackupTo(ctx, tarPath, tpmBackupId); err != nil {
+		return errors.Wrap(err, "RestoreBackupTo")
+	}
+	RemoveTpmState(diskPath)
+	stateDir := GetTpmStateDir(diskPath)
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return errors.Wrapf(err, "mkdir %s", stateDir)
+	}
+	if output, err := procutils.NewCommand("tar", "-xf", tarPath, "-C", stateDir).Output(); err != nil {
+		return errors.Wrapf(err, "untar %s: %s", tarPath, output)
+	}
+	return nil
+}
+
+func removeTpmStateBackup(ctx context.Context, backupStorage backupstorage.IBackupStorage, backupId string) error {
+	tpmBackupId := getTpmStateBackupId(backupId)
+	exists, err := backupStorage.IsBackupExists(tpmBackupId)
+	if err != nil {
+		return errors.Wrapf(err, "IsBackupExists %s", tpmBackupId)
+	}
+	if !exists {
+		return nil
+	}
+	return backupStorage.RemoveBackup(ctx, tpmBackupId)
+}
+
+func backupDiskTpmState(ctx context.Context, snapshotPath string, diskBackup *SDiskBackup) error {
+	if !HasTpmState(snapshotPath) {
+		return nil
+	}
+	backupStorage, err := backupstorage.GetBackupStorage(diskBackup.BackupStorageId, diskBackup.BackupStorageAccessInfo)
+	if err != nil {
+		return errors.Wrap(err, "GetBackupStorage")
+	}
+	return backupTpmState(ctx, backupStorage, snapshotPath, diskBackup.BackupId)
+}
+
+func restoreDiskTpmState(ctx context.Context, input *SDiskCreateByDiskinfo, diskPath string) error {
+	backup := input.DiskInfo.Backup
+	if backup == nil {
+		return nil
+	}
+	backupStorage, err := backupstorage.GetBackupStorage(backup.BackupStorageId, backup.BackupStorageAccessInfo)
+	if err != nil {
+		return errors.Wrap(err, "GetBackupStorage")
+	}
+	return restoreTpmState(ctx, backupStorage, backup.BackupId, diskPath)
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageman
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"yunion.io/x/onecloud/pkg/hostman/options"
+)
+
+func writeTestTpmState(t *testing.T, diskPath string, files map[string]string) {
+	stateDir := GetTpmStateDir(diskPath)
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		t.Fatalf("mkdir %s: %v", stateDir, err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(path.Join(stateDir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func readTestTpmState(t *testing.T, diskPath string) map[string]string {
+	stateDir := GetTpmStateDir(diskPath)
+	files, err := ioutil.ReadDir(stateDir)
+	if err != nil {
+		t.Fatalf("read dir %s: %v", stateDir, err)
+	}
+	ret := map[string]string{}
+	for _, f := range files {
+		content, err := ioutil.ReadFile(path.Join(stateDir, f.Name()))
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name(), err)
+		}
+		ret[f.Name()] = string(content)
+	}
+	return ret
+}
+
+func TestCopyTpmState(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := path.Join(dir, "src.qcow2"), path.Join(dir, "dst.qcow2")
+
+	// nothing to copy keeps the state of dst
+	writeTestTpmState(t, dst, map[string]string{"tpm2-00.permall": "old"})
+	if err := CopyTpmState(src, dst); err != nil {
+		t.Fatalf("CopyTpmState: %v", err)
+	}
+	if got := readTestTpmState(t, dst); got["tpm2-00.permall"] != "old" {
+		t.Errorf("state of dst changed: %v", got)
+	}
+
+	// the state of dst is replaced as a whole
+	writeTestTpmState(t, src, map[string]string{"tpm2-00.permall": "new"})
+	writeTestTpmState(t, dst, map[string]string{"stale": "stale"})
+	if err := CopyTpmState(src, dst); err != nil {
+		t.Fatalf("CopyTpmState: %v", err)
+	}
+	if got, want := readTestTpmState(t, dst), map[string]string{"tpm2-00.permall": "new"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("state of dst %v, want %v", got, want)
+	}
+	if HasTpmState(dst + ".tmp") {
+		t.Errorf("temporary state left")
+	}
+
+	RemoveTpmState(dst)
+	if HasTpmState(dst) {
+		t.Errorf("state of dst not removed")
+	}
+	if !HasTpmState(src) {
+		t.Errorf("state of src removed")
+	}
+}
+
+func TestPackTpmState(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := path.Join(dir, "src.qcow2"), path.Join(dir, "dst.qcow2")
+
+	state, err := PackTpmState(src)
+	if err != nil || state != nil {
+		t.Fatalf("expect nil state without tpm state, got %v %v", state, err)
+	}
+
+	writeTestTpmState(t, src, map[string]string{"tpm2-00.permall": "permall", ".lock": ""})
+	state, err = PackTpmState(src)
+	if err != nil {
+		t.Fatalf("PackTpmState: %v", err)
+	}
+	if _, ok := state[".lock"]; ok {
+		t.Errorf("lock file should not be packed")
+	}
+	if err := UnpackTpmState(dst, state); err != nil {
+		t.Fatalf("UnpackTpmState: %v", err)
+	}
+	if got, want := readTestTpmState(t, dst), map[string]string{"tpm2-00.permall": "permall"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unpacked state %v, want %v", got, want)
+	}
+
+	if err := UnpackTpmState(dst, map[string]string{"../escape": ""}); err == nil {
+		t.Errorf("expect error unpacking file out of the state dir")
+	}
+}
+
+func TestBackupTpmState(t *testing.T) {
+	dir := t.TempDir()
+	tmpPath := options.HostOptions.LocalBackupTempPath
+	options.HostOptions.LocalBackupTempPath = path.Join(dir, "backup-tmp")
+	defer func() {
+		options.HostOptions.LocalBackupTempPath = tmpPath
+	}()
+
+	ctx := context.Background()
+	storage := newMemBackupStorage()
+	snapshot, disk := path.Join(dir, "snapshot"), path.Join(dir, "disk.qcow2")
+
+	// no state no backup
+	if err := backupTpmState(ctx, storage, snapshot, "backup1"); err != nil {
+		t.Fatalf("backupTpmState: %v", err)
+	}
+	if len(storage.backups) != 0 {
+		t.Fatalf("unexpected backups %v", storage.backups)
+	}
+	if err := restoreTpmState(ctx, storage, "backup1", disk); err != nil {
+		t.Fatalf("restoreTpmState: %v", err)
+	}
+	if HasTpmState(disk) {
+		t.Errorf("unexpected state restored")
+	}
+
+	writeTestTpmState(t, snapshot, map[string]string{"tpm2-00.permall": "permall"})
+	if err := backupTpmState(ctx, storage, snapshot, "backup2"); err != nil {
+		t.Fatalf("backupTpmState: %v", err)
+	}
+	if _, ok := storage.backups[getTpmStateBackupId("backup2")]; !ok {
+		t.Fatalf("tpm state not backed up: %v", storage.backups)
+	}
+	writeTestTpmState(t, disk, map[string]string{"stale": "stale"})
+	if err := restoreTpmState(ctx, storage, "backup2", disk); err != nil {
+		t.Fatalf("restoreTpmState: %v", err)
+	}
+	if got, want := readTestTpmState(t, disk), map[string]string{"tpm2-00.permall": "permall"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("restored state %v, want %v", got, want)
+	}
+
+	if err := removeTpmStateBackup(ctx, storage, "backup2"); err != nil {
+		t.Fatalf("removeTpmStateBackup: %v", err)
+	}
+	if len(storage.backups) != 0 {
+		t.Errorf("tpm state backup not removed: %v", storage.backups)
+	}
+}
@@ -64,11 +64,16 @@ func (c *sAccessKeyCache) Verify(cli *mcclient.Client, req http.Request, virtual
 	if err != nil {
 		return nil, errors.Wrap(err, "s3auth.DecodeAccessKeyRequestV2")
 	}
+	return c.VerifyAccessKeyRequest(cli, req, aksk, virtualHost)
+}
 
+// VerifyAccessKeyRequest verifies an already decoded access key request, e.g.
+// one built from presigned URL query parameters or a POST policy form
+func (c *sAccessKeyCache) VerifyAccessKeyRequest(cli *mcclient.Client, req http.Request, aksk s3auth.IAccessKeySecretRequest, virtualHost bool) (mcclient.TokenCredential, error) {
 	token, found := c.getToken(aksk.GetAccessKey())
 	if found {
 		if token.Token.IsValid() && token.AccessKeySecret.IsValid() {
-			err = aksk.Verify(token.AccessKeySecret.Secret)
+			err := aksk.Verify(token.AccessKeySecret.Secret)
 			if err != nil {
 				return nil, errors.Wrap(err, "aksk.Verify")
 			}
@@ -78,7 +83,7 @@ func (c *sAccessKeyCache) Verify(cli *mcclient.Client, req http.Request, virtual
 		}
 	}
 
-	token, err = cli.VerifyRequest(req, aksk, virtualHost)
+	token, err := cli.VerifyRequest(req, aksk, virtualHost)
 	if err != nil {
 		return nil, errors.Wrap(err, "cli.VerifyRequest")
 	}
@@ -28,6 +28,7 @@ import (
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/util/cache"
 	"yunion.io/x/pkg/util/httputils"
+	"yunion.io/x/pkg/util/s3auth"
 
 	"yunion.io/x/onecloud/pkg/apis/identity"
 	"yunion.io/x/onecloud/pkg/cloudcommon/syncman"
@@ -220,6 +221,17 @@ func (a *authManager) verifyRequest(req http.Request, virtualHost bool) (mcclien
 	return cred, nil
 }
 
+func (a *authManager) verifyAccessKeyRequest(req http.Request, aksk s3auth.IAccessKeySecretRequest, virtualHost bool) (mcclient.TokenCredential, error) {
+	if a.adminCredential == nil {
+		return nil, fmt.Errorf("No valid admin token credential")
+	}
+	cred, err := a.accessKeyCache.VerifyAccessKeyRequest(a.client, req, aksk, virtualHost)
+	if err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
 func (a *authManager) verify(ctx context.Context, token string) (mcclient.TokenCredential, error) {
 	if a.adminCredential == nil {
 		a.reAuth()
@@ -384,6 +396,10 @@ func VerifyRequest(req http.Request, virtualHost bool) (mcclient.TokenCredential
 	return manager.verifyRequest(req, virtualHost)
 }
 
+func VerifyAccessKeyRequest(req http.Request, aksk s3auth.IAccessKeySecretRequest, virtualHost bool) (mcclient.TokenCredential, error) {
+	return manager.verifyAccessKeyRequest(req, aksk, virtualHost)
+}
+
 func GetServiceURL(service, region, zone, endpointType string) (string, error) {
 	return manager.GetServiceURL(service, region, zone, endpointType)
 }
@@ -52,7 +52,7 @@ type SNotificationManager struct {
 func NewNotificationManager() *SNotificationManager {
 	man := modules.NewMonitorV2Manager(
 		"alert_notification", "alert_notifications",
-		[]string{"id", "name", "type", "is_default", "disable_resolve_message", "send_reminder", "frequency", "settings"},
+		[]string{"id", "name", "type", "is_default", "disable_resolve_message", "send_reminder", "frequency", "settings", "group_by", "escalation_notification_id", "escalation_after"},
 		[]string{})
 	return &SNotificationManager{
 		ResourceManager: &man,
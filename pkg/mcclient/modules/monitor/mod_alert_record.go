@@ -37,7 +37,7 @@ func init() {
 
 func NewAlertRecordManager() *SAlertRecordManager {
 	man := modules.NewMonitorV2Manager("alertrecord", "alertrecords",
-		[]string{"id", "alert_name", "res_type", "level", "state", "res_num", "eval_data"},
+		[]string{"id", "alert_name", "res_type", "level", "state", "res_num", "eval_data", "acked_by", "acked_at"},
 		[]string{})
 	return &SAlertRecordManager{
 		ResourceManager: &man,
@@ -0,0 +1,42 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"yunion.io/x/onecloud/pkg/mcclient/modulebase"
+	"yunion.io/x/onecloud/pkg/mcclient/modules"
+)
+
+var (
+	AlertSilenceManager *SAlertSilenceManager
+)
+
+type SAlertSilenceManager struct {
+	*modulebase.ResourceManager
+}
+
+func init() {
+	AlertSilenceManager = NewAlertSilenceManager()
+	modules.Register(AlertSilenceManager)
+}
+
+func NewAlertSilenceManager() *SAlertSilenceManager {
+	man := modules.NewMonitorV2Manager("alertsilence", "alertsilences",
+		[]string{"id", "name", "enabled", "alert_id", "alert_name", "matchers", "start_time", "end_time", "recurrence", "duration", "active", "suppressed_count"},
+		[]string{})
+	return &SAlertSilenceManager{
+		ResourceManager: &man,
+	}
+}
@@ -93,6 +93,15 @@ func (this *SchedulerManager) Test(s *mcclient.ClientSession, params *api.Schedu
 }
 
 func (this *SchedulerManager) DoForecast(s *mcclient.ClientSession, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	return this.doProjectRequest(s, "forecast", params)
+}
+
+// DoExplain return per candidate predicate verdicts and priority scores of the schedule input
+func (this *SchedulerManager) DoExplain(s *mcclient.ClientSession, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	return this.doProjectRequest(s, "explain", params)
+}
+
+func (this *SchedulerManager) doProjectRequest(s *mcclient.ClientSession, action string, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
 	projectId := s.GetProjectId()
 	domainId := s.GetProjectDomainId()
 	cliProjectId, _ := params.GetString("project_id")
@@ -111,7 +120,7 @@ func (this *SchedulerManager) DoForecast(s *mcclient.ClientSession, params jsonu
 	data := params.(*jsonutils.JSONDict)
 	data.Set("domain_id", jsonutils.NewString(domainId))
 	data.Set("project_id", jsonutils.NewString(projectId))
-	url := newSchedURL("forecast")
+	url := newSchedURL(action)
 	_, obj, err := modulebase.JsonRequest(this.ResourceManager, s, "POST", url, nil, data)
 	if err != nil {
 		return nil, err
@@ -220,6 +229,43 @@ func (this *SchedulerManager) HistoryShow(s *mcclient.ClientSession, id string,
 	return modulebase.Post(this.ResourceManager, s, url, params, "history")
 }
 
+func (this *SchedulerManager) rebalanceRequest(s *mcclient.ClientSession, url string, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	_, obj, err := modulebase.JsonRequest(this.ResourceManager, s, "POST", url, nil, params)
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// RebalancePlan return a dry-run migration plan to rebalance hosts
+func (this *SchedulerManager) RebalancePlan(s *mcclient.ClientSession, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	return this.rebalanceRequest(s, newSchedURL("rebalance-plan"), params)
+}
+
+// RebalanceExecute run the migrations of a computed plan in background
+func (this *SchedulerManager) RebalanceExecute(s *mcclient.ClientSession, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	return this.rebalanceRequest(s, newSchedURL("rebalance-execute"), params)
+}
+
+func (this *SchedulerManager) RebalanceShow(s *mcclient.ClientSession, id string) (jsonutils.JSONObject, error) {
+	return this.rebalanceRequest(s, newSchedIdentURL("rebalance-detail", id), jsonutils.NewDict())
+}
+
+// ReservedResources list the all-or-nothing reservations held by scheduler
+func (this *SchedulerManager) ReservedResources(s *mcclient.ClientSession, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	return modulebase.Post(this.ResourceManager, s, newSchedURL("reserved-resources"), params, "")
+}
+
+// CommitReservation tell scheduler all placements of the all-or-nothing session are persisted
+func (this *SchedulerManager) CommitReservation(s *mcclient.ClientSession, sessionId string) (jsonutils.JSONObject, error) {
+	return modulebase.Post(this.ResourceManager, s, newSchedIdentURL("reservation-commit", sessionId), jsonutils.NewDict(), "")
+}
+
+// ReleaseReservation release the pending usage of the whole all-or-nothing session
+func (this *SchedulerManager) ReleaseReservation(s *mcclient.ClientSession, sessionId string) (jsonutils.JSONObject, error) {
+	return modulebase.Post(this.ResourceManager, s, newSchedIdentURL("reservation-release", sessionId), jsonutils.NewDict(), "")
+}
+
 func (this *SchedulerManager) CleanCache(s *mcclient.ClientSession, hostId, sessionId string, sync bool) error {
 	url := newSchedURL("clean-cache")
 	if len(hostId) > 0 {
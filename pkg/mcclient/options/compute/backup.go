@@ -60,6 +60,9 @@ type DiskBackupCreateOptions struct {
 	AsTarIncludeFile        []string `help:"include file path of tar process"`
 	AsTarExcludeFile        []string `help:"exclude file path of tar process"`
 	AsTarIgnoreNotExistFile bool     `help:"ignore not exist file when using tar"`
+	Incremental             bool     `help:"incremental backup based on the latest chained backup of the disk"`
+	MaxIncrements           *int     `help:"max incremental backups kept in the chain, older increments are merged into the full backup"`
+	Consistent              bool     `help:"freeze guest filesystems by qemu-guest-agent during backup"`
 
 	DISKID          string `help:"disk id" json:"disk_id"`
 	BACKUPSTORAGEID string `help:"back storage id" json:"backup_storage_id"`
@@ -70,6 +73,9 @@ func (opts *DiskBackupCreateOptions) Params() (jsonutils.JSONObject, error) {
 		DiskId:          opts.DISKID,
 		BackupStorageId: opts.BACKUPSTORAGEID,
 		BackupAsTar:     new(computeapi.DiskBackupAsTarInput),
+		Incremental:     opts.Incremental,
+		MaxIncrements:   opts.MaxIncrements,
+		Consistent:      opts.Consistent,
 	}
 	input.Name = opts.NAME
 	input.Description = opts.Desc
@@ -83,3 +83,30 @@ type DnsZoneRemoveVpcsOptions struct {
 func (opts *DnsZoneRemoveVpcsOptions) Params() (jsonutils.JSONObject, error) {
 	return jsonutils.Marshal(map[string]string{"vpc_ids": opts.VPC_IDS}), nil
 }
+
+type DnsZoneEnableDnssecOptions struct {
+	SDnsZoneIdOptions
+	Algorithm string `help:"Signing algorithm" choices:"ECDSAP256SHA256|ECDSAP384SHA384|ED25519"`
+	Rekey     bool   `help:"Regenerate ksk and zsk"`
+}
+
+func (opts *DnsZoneEnableDnssecOptions) Params() (jsonutils.JSONObject, error) {
+	return jsonutils.Marshal(map[string]interface{}{"algorithm": opts.Algorithm, "rekey": opts.Rekey}), nil
+}
+
+type DnsZoneSetDynamicUpdateOptions struct {
+	SDnsZoneIdOptions
+	Disable       bool   `help:"Disable dynamic update"`
+	TsigKeyName   string `help:"TSIG key name, default to the zone name"`
+	TsigAlgorithm string `help:"TSIG algorithm" choices:"hmac-sha1|hmac-sha256|hmac-sha512"`
+	ResetSecret   bool   `help:"Regenerate TSIG secret"`
+}
+
+func (opts *DnsZoneSetDynamicUpdateOptions) Params() (jsonutils.JSONObject, error) {
+	return jsonutils.Marshal(map[string]interface{}{
+		"enabled":        !opts.Disable,
+		"tsig_key_name":  opts.TsigKeyName,
+		"tsig_algorithm": opts.TsigAlgorithm,
+		"reset_secret":   opts.ResetSecret,
+	}), nil
+}
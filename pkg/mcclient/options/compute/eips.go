@@ -96,6 +96,15 @@ func (opts *EipChangeBandwidthOptions) Params() (jsonutils.JSONObject, error) {
 	return jsonutils.Marshal(map[string]int{"bandwidth": opts.BANDWIDTH}), nil
 }
 
+type EipSetQosPolicyOptions struct {
+	options.BaseIdOptions
+	QosPolicy string `help:"id or name of qos policy, leave empty to remove"`
+}
+
+func (opts *EipSetQosPolicyOptions) Params() (jsonutils.JSONObject, error) {
+	return jsonutils.Marshal(map[string]string{"qos_policy_id": opts.QosPolicy}), nil
+}
+
 type EipChangeOwnerOptions struct {
 	options.BaseIdOptions
 	PROJECT string `help:"Project ID or change"`
@@ -0,0 +1,78 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+type FlowLogCreateOptions struct {
+	api.FlowLogCreateInput
+}
+
+func (o *FlowLogCreateOptions) Params() (jsonutils.JSONObject, error) {
+	return jsonutils.Marshal(o), nil
+}
+
+type FlowLogListOptions struct {
+	options.BaseListOptions
+
+	ResourceType []string `help:"filter by resource type" choices:"vpc|network|vnic" json:"resource_type"`
+
+	VpcId string `help:"filter by vpc id or name" json:"vpc_id"`
+
+	NetworkId string `help:"filter by network id or name" json:"network_id"`
+
+	GuestId string `help:"filter by guest id or name" json:"guest_id"`
+
+	Destination []string `help:"filter by destination" choices:"logger|bucket" json:"destination"`
+}
+
+func (o *FlowLogListOptions) Params() (jsonutils.JSONObject, error) {
+	return options.ListStructToParams(o)
+}
+
+type FlowLogIdOptions struct {
+	ID string `json:"-" help:"Id or name of flow log"`
+}
+
+func (o *FlowLogIdOptions) GetId() string {
+	return o.ID
+}
+
+func (o *FlowLogIdOptions) Params() (jsonutils.JSONObject, error) {
+	return options.StructToParams(o)
+}
+
+type FlowLogUpdateOptions struct {
+	FlowLogIdOptions
+
+	TrafficType string `help:"traffic to log" choices:"all|accept|reject" json:"traffic_type"`
+
+	RateLimit *int `help:"max logged packets per second" json:"rate_limit"`
+
+	Destination string `help:"where flow records are shipped to" choices:"logger|bucket" json:"destination"`
+
+	BucketId string `help:"id or name of bucket to store flow records" json:"bucket_id"`
+
+	BucketPrefix *string `help:"object key prefix in bucket" json:"bucket_prefix"`
+}
+
+func (o *FlowLogUpdateOptions) Params() (jsonutils.JSONObject, error) {
+	return options.StructToParams(o)
+}
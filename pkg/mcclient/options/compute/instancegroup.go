@@ -50,6 +50,10 @@ type InstanceGroupCreateOptions struct {
 	SchedStrategy   string `help:"scheduler strategy"`
 	Granularity     string `help:"the upper limit number of guests with this group in a host"`
 	ForceDispersion bool   `help:"force to make guest dispersion"`
+	Affinity        string `help:"affinity of guests in group" choices:"anti-affinity|affinity"`
+	TopologyKey     string `help:"topology domain of affinity, host, zone, wire or host metadata key like rack"`
+	Weight          int    `help:"weight of soft affinity and topology spread, 1-100"`
+	MaxSkew         int    `help:"max skew of guest count between topology domains, 0 means disabled"`
 }
 
 func (opts *InstanceGroupCreateOptions) Params() (jsonutils.JSONObject, error) {
@@ -66,6 +70,10 @@ type InstanceGroupUpdateOptions struct {
 	Name            string `help:"New name to change"`
 	Granularity     string `help:"the upper limit number of guests with this group in a host"`
 	ForceDispersion string `help:"force to make guest dispersion" choices:"yes|no" json:"-"`
+	Affinity        string `help:"affinity of guests in group" choices:"anti-affinity|affinity"`
+	TopologyKey     string `help:"topology domain of affinity, host, zone, wire or host metadata key like rack"`
+	Weight          *int   `help:"weight of soft affinity and topology spread, 1-100"`
+	MaxSkew         *int   `help:"max skew of guest count between topology domains, 0 means disabled"`
 }
 
 func (opts *InstanceGroupUpdateOptions) Params() (jsonutils.JSONObject, error) {
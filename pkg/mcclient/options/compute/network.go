@@ -342,3 +342,13 @@ func (opts *NetworkSyncAdditionalWiresOptions) GetId() string {
 func (opts *NetworkSyncAdditionalWiresOptions) Params() (jsonutils.JSONObject, error) {
 	return jsonutils.Marshal(opts), nil
 }
+
+type NetworkSetQosPolicyOptions struct {
+	NetworkIdOptions
+
+	QosPolicy string `help:"id or name of qos policy, leave empty to remove" json:"qos_policy_id"`
+}
+
+func (opts *NetworkSetQosPolicyOptions) Params() (jsonutils.JSONObject, error) {
+	return jsonutils.Marshal(map[string]string{"qos_policy_id": opts.QosPolicy}), nil
+}
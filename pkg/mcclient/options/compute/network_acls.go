@@ -0,0 +1,145 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"strconv"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+// 100#in#allow#tcp#10.0.0.0/8#22,80, 协议, 地址段与端口可省略
+func parseNetworkAclRule(s string) (api.SNetworkAclRule, error) {
+	rule := api.SNetworkAclRule{}
+	segs := strings.Split(s, "#")
+	if len(segs) < 3 {
+		return rule, errors.Errorf("invalid network acl rule %q", s)
+	}
+	priority, err := strconv.Atoi(strings.TrimSpace(segs[0]))
+	if err != nil {
+		return rule, errors.Wrapf(err, "invalid priority of rule %q", s)
+	}
+	rule.Priority = priority
+	rule.Direction = strings.TrimSpace(segs[1])
+	rule.Action = strings.TrimSpace(segs[2])
+	if len(segs) > 3 {
+		rule.Protocol = strings.TrimSpace(segs[3])
+	}
+	if len(segs) > 4 {
+		rule.Cidr = strings.TrimSpace(segs[4])
+	}
+	if len(segs) > 5 {
+		rule.Ports = strings.TrimSpace(segs[5])
+	}
+	return rule, nil
+}
+
+func parseNetworkAclRules(ss []string) (api.SNetworkAclRules, error) {
+	rules := api.SNetworkAclRules{}
+	for _, s := range ss {
+		rule, err := parseNetworkAclRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+type NetworkAclCreateOptions struct {
+	options.EnabledStatusCreateOptions
+
+	Vpc string `help:"id or name of vpc" json:"vpc_id" required:"true"`
+
+	Rule []string `help:"stateful network acl rule, replies of allowed connections are always passed, with priority, direction, action, protocol, cidr and ports separated by #, e.g. 100#in#allow#tcp#10.0.0.0/8#22,80" json:"-"`
+}
+
+func (o *NetworkAclCreateOptions) Params() (jsonutils.JSONObject, error) {
+	params := jsonutils.Marshal(o).(*jsonutils.JSONDict)
+	rules, err := parseNetworkAclRules(o.Rule)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) > 0 {
+		params.Set("rules", jsonutils.Marshal(rules))
+	}
+	return params, nil
+}
+
+type NetworkAclListOptions struct {
+	options.BaseListOptions
+
+	VpcId string `help:"filter by vpc id or name" json:"vpc_id"`
+}
+
+func (o *NetworkAclListOptions) Params() (jsonutils.JSONObject, error) {
+	return options.ListStructToParams(o)
+}
+
+type NetworkAclIdOptions struct {
+	ID string `json:"-" help:"Id or name of network acl"`
+}
+
+func (o *NetworkAclIdOptions) GetId() string {
+	return o.ID
+}
+
+func (o *NetworkAclIdOptions) Params() (jsonutils.JSONObject, error) {
+	return options.StructToParams(o)
+}
+
+type NetworkAclUpdateOptions struct {
+	NetworkAclIdOptions
+
+	Name string `help:"new name of network acl" json:"name"`
+
+	Desc string `metavar:"<DESCRIPTION>" help:"Description" json:"description"`
+
+	Rule []string `help:"stateful network acl rule, replies of allowed connections are always passed, with priority, direction, action, protocol, cidr and ports separated by #, e.g. 100#in#allow#tcp#10.0.0.0/8#22,80" json:"-"`
+
+	ClearRules bool `help:"remove all rules" json:"-"`
+}
+
+func (o *NetworkAclUpdateOptions) Params() (jsonutils.JSONObject, error) {
+	params, err := options.StructToParams(o)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseNetworkAclRules(o.Rule)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) > 0 {
+		params.Set("rules", jsonutils.Marshal(rules))
+	} else if o.ClearRules {
+		params.Set("rules", jsonutils.NewArray())
+	}
+	return params, nil
+}
+
+type NetworkAclAssociateOptions struct {
+	NetworkAclIdOptions
+
+	Network []string `help:"id or name of networks" json:"network_ids"`
+}
+
+func (o *NetworkAclAssociateOptions) Params() (jsonutils.JSONObject, error) {
+	return options.StructToParams(o)
+}
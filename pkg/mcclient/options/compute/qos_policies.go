@@ -0,0 +1,81 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+type QosPolicyCreateOptions struct {
+	options.EnabledStatusCreateOptions
+
+	IngressBandwidth int `help:"bandwidth into guest in Mbps" json:"ingress_bandwidth"`
+	IngressBurst     int `help:"burst into guest in Mb, default twice the bandwidth" json:"ingress_burst"`
+	IngressPps       int `help:"packets per second into guest" json:"ingress_pps"`
+
+	EgressBandwidth int `help:"bandwidth out of guest in Mbps" json:"egress_bandwidth"`
+	EgressBurst     int `help:"burst out of guest in Mb, default twice the bandwidth" json:"egress_burst"`
+	EgressPps       int `help:"packets per second out of guest" json:"egress_pps"`
+
+	Dscp *int `help:"dscp (0-63) marked on ip packets sent by guest" json:"dscp"`
+}
+
+func (o *QosPolicyCreateOptions) Params() (jsonutils.JSONObject, error) {
+	return jsonutils.Marshal(o), nil
+}
+
+type QosPolicyListOptions struct {
+	options.BaseListOptions
+}
+
+func (o *QosPolicyListOptions) Params() (jsonutils.JSONObject, error) {
+	return options.ListStructToParams(o)
+}
+
+type QosPolicyIdOptions struct {
+	ID string `json:"-" help:"Id or name of qos policy"`
+}
+
+func (o *QosPolicyIdOptions) GetId() string {
+	return o.ID
+}
+
+func (o *QosPolicyIdOptions) Params() (jsonutils.JSONObject, error) {
+	return options.StructToParams(o)
+}
+
+type QosPolicyUpdateOptions struct {
+	QosPolicyIdOptions
+
+	Name string `help:"new name of qos policy" json:"name"`
+
+	Desc string `metavar:"<DESCRIPTION>" help:"Description" json:"description"`
+
+	IngressBandwidth *int `help:"bandwidth into guest in Mbps" json:"ingress_bandwidth"`
+	IngressBurst     *int `help:"burst into guest in Mb" json:"ingress_burst"`
+	IngressPps       *int `help:"packets per second into guest" json:"ingress_pps"`
+
+	EgressBandwidth *int `help:"bandwidth out of guest in Mbps" json:"egress_bandwidth"`
+	EgressBurst     *int `help:"burst out of guest in Mb" json:"egress_burst"`
+	EgressPps       *int `help:"packets per second out of guest" json:"egress_pps"`
+
+	Dscp *int `help:"dscp (0-63) marked on ip packets sent by guest, -1 to stop marking" json:"dscp"`
+}
+
+func (o *QosPolicyUpdateOptions) Params() (jsonutils.JSONObject, error) {
+	return options.StructToParams(o)
+}
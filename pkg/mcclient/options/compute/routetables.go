@@ -16,9 +16,12 @@ package compute
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"yunion.io/x/jsonutils"
 
+	api "yunion.io/x/onecloud/pkg/apis/compute"
 	baseoptions "yunion.io/x/onecloud/pkg/mcclient/options"
 )
 
@@ -57,11 +60,59 @@ func (opts *RoutesOptions) Params() (jsonutils.JSONObject, error) {
 	return routesJson, nil
 }
 
+type RoutePoliciesOptions struct {
+	Policy []string `help:"route policy with priority, action, src cidr, dst cidr, protocol, ports, next hop type and next hop id separated by #, e.g. 100#reroute#10.0.1.0/24##tcp#80,443#Instance#fw-vm" json:"-"`
+}
+
+// 100#reroute#10.0.1.0/24##tcp#80,443#Instance#fw-vm, 优先级与行为之后的字段可省略
+func parseRoutePolicy(s string) (*api.SRoutePolicy, error) {
+	segs := strings.Split(s, "#")
+	if len(segs) < 2 {
+		return nil, fmt.Errorf("invalid route policy %q", s)
+	}
+	priority, err := strconv.Atoi(strings.TrimSpace(segs[0]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid priority of route policy %q: %v", s, err)
+	}
+	policy := &api.SRoutePolicy{
+		Priority: priority,
+		Action:   strings.TrimSpace(segs[1]),
+	}
+	fields := []*string{
+		&policy.SrcCidr,
+		&policy.DstCidr,
+		&policy.Protocol,
+		&policy.Ports,
+		&policy.NextHopType,
+		&policy.NextHopId,
+	}
+	for i, seg := range segs[2:] {
+		if i >= len(fields) {
+			return nil, fmt.Errorf("too many fields in route policy %q", s)
+		}
+		*fields[i] = strings.TrimSpace(seg)
+	}
+	return policy, nil
+}
+
+func (opts *RoutePoliciesOptions) Policies() (api.SRoutePolicies, error) {
+	policies := api.SRoutePolicies{}
+	for _, s := range opts.Policy {
+		policy, err := parseRoutePolicy(s)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
 type RouteTableCreateOptions struct {
 	NAME string
 	Vpc  string `required:"true"`
 
 	RoutesOptions
+	RoutePoliciesOptions
 }
 
 func (opts *RouteTableCreateOptions) Params() (jsonutils.JSONObject, error) {
@@ -74,6 +125,13 @@ func (opts *RouteTableCreateOptions) Params() (jsonutils.JSONObject, error) {
 		return nil, err
 	}
 	params.Set("routes", routesJson)
+	policies, err := opts.RoutePoliciesOptions.Policies()
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) > 0 {
+		params.Set("policies", jsonutils.Marshal(policies))
+	}
 	return params, nil
 }
 
@@ -98,6 +156,9 @@ type RouteTableUpdateOptions struct {
 	Name string
 
 	RoutesOptions
+	RoutePoliciesOptions
+
+	ClearPolicies bool `help:"remove all route policies" json:"-"`
 }
 
 func (opts *RouteTableUpdateOptions) GetId() string {
@@ -116,6 +177,15 @@ func (opts *RouteTableUpdateOptions) Params() (jsonutils.JSONObject, error) {
 		}
 		params.Set("routes", routesJson)
 	}
+	policies, err := opts.RoutePoliciesOptions.Policies()
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) > 0 {
+		params.Set("policies", jsonutils.Marshal(policies))
+	} else if opts.ClearPolicies {
+		params.Set("policies", jsonutils.NewArray())
+	}
 	return params, nil
 }
 
@@ -161,6 +231,48 @@ func (opts *RouteTableDelRoutesOptions) Params() (jsonutils.JSONObject, error) {
 	return params, nil
 }
 
+type RouteTableAddPoliciesOptions struct {
+	ID string `json:"-"`
+
+	RoutePoliciesOptions
+}
+
+func (opts *RouteTableAddPoliciesOptions) GetId() string {
+	return opts.ID
+}
+
+func (opts *RouteTableAddPoliciesOptions) Params() (jsonutils.JSONObject, error) {
+	policies, err := opts.RoutePoliciesOptions.Policies()
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("nothing to add")
+	}
+	params := jsonutils.NewDict()
+	params.Set("policies", jsonutils.Marshal(policies))
+	return params, nil
+}
+
+type RouteTableDelPoliciesOptions struct {
+	ID string `json:"-"`
+
+	Priority []int `help:"priority of route policies to delete"`
+}
+
+func (opts *RouteTableDelPoliciesOptions) GetId() string {
+	return opts.ID
+}
+
+func (opts *RouteTableDelPoliciesOptions) Params() (jsonutils.JSONObject, error) {
+	if len(opts.Priority) == 0 {
+		return nil, fmt.Errorf("nothing to del")
+	}
+	params := jsonutils.NewDict()
+	params.Set("priorities", jsonutils.Marshal(opts.Priority))
+	return params, nil
+}
+
 type RouteTableDeleteOptions struct {
 	ID string
 }
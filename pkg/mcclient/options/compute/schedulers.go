@@ -15,6 +15,12 @@
 package compute
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+
 	"yunion.io/x/onecloud/pkg/apis/scheduler"
 	"yunion.io/x/onecloud/pkg/mcclient"
 )
@@ -99,3 +105,94 @@ func (o SchedulerForecastOptions) Params(s *mcclient.ClientSession) (*scheduler.
 	input.ScheduleBaseConfig = *opts
 	return input, nil
 }
+
+type SchedulerExplainOptions struct {
+	SchedulerTestBaseOptions
+
+	WhatIfHost           []string `help:"Pretend host resource changes, format: <host>:mem=<MB>,cpu=<count>, e.g. host1:mem=65536" metavar:"HOST_CHANGES"`
+	WhatIfRemoveSchedtag []string `help:"Pretend schedtag is removed" metavar:"SCHEDTAG"`
+}
+
+func parseWhatIfHost(str string) (*scheduler.SchedWhatIfHost, error) {
+	parts := strings.SplitN(str, ":", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return nil, fmt.Errorf("invalid what-if host %q", str)
+	}
+	host := &scheduler.SchedWhatIfHost{Id: parts[0]}
+	for _, kv := range strings.Split(parts[1], ",") {
+		segs := strings.SplitN(kv, "=", 2)
+		if len(segs) != 2 {
+			return nil, fmt.Errorf("invalid what-if host change %q", kv)
+		}
+		val, err := strconv.ParseInt(segs[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid what-if host change %q: %v", kv, err)
+		}
+		switch segs[0] {
+		case "mem":
+			host.ExtraMemoryMb = val
+		case "cpu":
+			host.ExtraCpuCount = val
+		default:
+			return nil, fmt.Errorf("unsupported what-if host change %q", segs[0])
+		}
+	}
+	return host, nil
+}
+
+func (o SchedulerExplainOptions) Params(s *mcclient.ClientSession) (*scheduler.ScheduleInput, error) {
+	input, err := SchedulerForecastOptions{o.SchedulerTestBaseOptions}.Params(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.WhatIfHost) == 0 && len(o.WhatIfRemoveSchedtag) == 0 {
+		return input, nil
+	}
+	input.WhatIf = &scheduler.SchedWhatIf{
+		RemoveSchedtags: o.WhatIfRemoveSchedtag,
+	}
+	for _, str := range o.WhatIfHost {
+		host, err := parseWhatIfHost(str)
+		if err != nil {
+			return nil, err
+		}
+		input.WhatIf.Hosts = append(input.WhatIf.Hosts, *host)
+	}
+	return input, nil
+}
+
+type SchedulerRebalanceOptions struct {
+	Strategy       string   `help:"Rebalance strategy" choices:"balance|pack" default:"balance"`
+	Zone           string   `help:"Only rebalance hosts of the zone"`
+	Host           []string `help:"Only rebalance these hosts"`
+	DrainHost      []string `help:"Hosts to be emptied by pack strategy"`
+	MaxMigrations  int      `help:"Max count of migrations in plan"`
+	Tolerance      float64  `help:"Balance strategy stops when the spread of host utilization is within tolerance, e.g. 0.1"`
+	MaxUtilization float64  `help:"Max utilization of target hosts of pack strategy, e.g. 0.8"`
+}
+
+func (o *SchedulerRebalanceOptions) Params() (jsonutils.JSONObject, error) {
+	input := scheduler.RebalancePlanInput{
+		Strategy:       o.Strategy,
+		Zone:           o.Zone,
+		Hosts:          o.Host,
+		DrainHosts:     o.DrainHost,
+		MaxMigrations:  o.MaxMigrations,
+		Tolerance:      o.Tolerance,
+		MaxUtilization: o.MaxUtilization,
+	}
+	return jsonutils.Marshal(input), nil
+}
+
+type SchedulerRebalanceExecuteOptions struct {
+	ID          string `help:"Rebalance plan ID computed by scheduler-rebalance-plan"`
+	Concurrency int    `help:"Count of concurrent live migrations"`
+}
+
+func (o *SchedulerRebalanceExecuteOptions) Params() (jsonutils.JSONObject, error) {
+	input := scheduler.RebalanceExecuteInput{
+		PlanId:      o.ID,
+		Concurrency: o.Concurrency,
+	}
+	return jsonutils.Marshal(input), nil
+}
@@ -281,6 +281,9 @@ type ServerCreateCommonConfig struct {
 		--disk 'snpahost_id=1ceb8c6d-6571-451d-8957-4bd3a871af85'
 	" nargs:"+"`
 	DiskSchedtag []string `help:"Disk schedtag description, e.g. '0:<tag>:<strategy>'"`
+
+	AllOrNothing       bool `help:"Fail all servers if any one of them can't be scheduled when creating multiple simultaneously"`
+	ReservationTimeout int  `help:"Seconds of scheduler reservation for all-or-nothing create, default by scheduler"`
 }
 
 func (o ServerCreateCommonConfig) Data() (*computeapi.ServerConfigs, error) {
@@ -295,6 +298,8 @@ func (o ServerCreateCommonConfig) Data() (*computeapi.ServerConfigs, error) {
 		Networks:      make([]*computeapi.NetworkConfig, 0),
 		Disks:         make([]*computeapi.DiskConfig, 0),
 	}
+	data.AllOrNothing = o.AllOrNothing
+	data.ReservationTimeout = o.ReservationTimeout
 	for i, n := range o.Net {
 		net, err := cmdline.ParseNetworkConfig(n, i)
 		if err != nil {
@@ -482,6 +487,9 @@ type ServerCreateOptionalOptions struct {
 
 	OsType string `help:"os type, e.g. Linux, Windows, etc."`
 
+	EnableVtpm       bool `help:"attach a swtpm backed TPM 2.0 device, KVM only" json:"enable_vtpm"`
+	EnableSecureBoot bool `help:"enable UEFI secure boot with enrolled keys, KVM only" json:"enable_secure_boot"`
+
 	Duration  string `help:"valid duration of the server, e.g. 1H, 1D, 1W, 1M, 1Y, ADMIN ONLY option"`
 	AutoRenew bool   `help:"auto renew for prepaid server"`
 
@@ -590,6 +598,9 @@ func (opts *ServerCreateOptionalOptions) OptionalParams() (*computeapi.ServerCre
 		EnableMemclean:     opts.EnableMemclean,
 	}
 
+	params.EnableVtpm = opts.EnableVtpm
+	params.EnableSecureBoot = opts.EnableSecureBoot
+
 	params.ProjectId = opts.Project
 
 	if opts.FakeCreate != nil {
@@ -1228,6 +1239,55 @@ func (o *ServerLiveMigrateOptions) Params() (jsonutils.JSONObject, error) {
 	return options.StructToParams(o)
 }
 
+type ServerCrossRegionMigrateOptions struct {
+	ID             string   `help:"ID of server" json:"-"`
+	PreferRegion   string   `help:"Target region id or name, must be a region of this deployment" json:"prefer_region_id"`
+	PreferZone     string   `help:"Target zone id or name" json:"prefer_zone_id"`
+	PreferHost     string   `help:"Target host id or name" json:"prefer_host_id"`
+	Network        []string `help:"Network remap rule, format: <nic_index>:<network>[:reuse|:<ip_addr>], e.g. 0:vnet1:reuse" json:"-"`
+	LiveSwitchover bool     `help:"Switch over by live migration, all nics must reuse ip"`
+	AutoStart      bool     `help:"Start server after cold switchover"`
+	SkipCpuCheck   bool     `help:"Skip check CPU mode of the target host"`
+	EnableTLS      bool     `help:"Enable tls migration"`
+	MaxBandwidthMb *int64   `help:"live migrate bandwidth limit, unit MB"`
+}
+
+func (o *ServerCrossRegionMigrateOptions) GetId() string {
+	return o.ID
+}
+
+func (o *ServerCrossRegionMigrateOptions) Params() (jsonutils.JSONObject, error) {
+	params, err := options.StructToParams(o)
+	if err != nil {
+		return nil, err
+	}
+	remaps := make([]computeapi.GuestNetworkRemap, 0, len(o.Network))
+	for _, rule := range o.Network {
+		parts := strings.Split(rule, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, errors.Errorf("invalid network remap rule %q", rule)
+		}
+		index, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid nic index of rule %q", rule)
+		}
+		remap := computeapi.GuestNetworkRemap{
+			Index:   index,
+			Network: parts[1],
+		}
+		if len(parts) == 3 {
+			if parts[2] == "reuse" {
+				remap.ReuseIp = true
+			} else {
+				remap.Address = parts[2]
+			}
+		}
+		remaps = append(remaps, remap)
+	}
+	params.Set("networks", jsonutils.Marshal(remaps))
+	return params, nil
+}
+
 type ServerSetLiveMigrateParamsOptions struct {
 	ID              string `help:"ID of server" json:"-"`
 	MaxBandwidthMB  *int64 `help:"live migrate downtime, unit MB"`
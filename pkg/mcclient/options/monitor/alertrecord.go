@@ -34,6 +34,7 @@ type AlertRecordListOptions struct {
 	ResId    string   `json:"res_id"`
 	ResName  string   `json:"res_name"`
 	Alerting bool     `json:"alerting"`
+	Acked    *bool    `help:"filter by acknowledged or not" json:"acked"`
 }
 
 func (o *AlertRecordListOptions) Params() (jsonutils.JSONObject, error) {
@@ -52,6 +53,10 @@ func (o *AlertRecordShowOptions) GetId() string {
 	return o.ID
 }
 
+type AlertRecordAckOptions struct {
+	options.BaseIdOptions
+}
+
 type AlertRecordTotalOptions struct {
 	ID string `help:"total-alert" json:"-"`
 	options.BaseListOptions
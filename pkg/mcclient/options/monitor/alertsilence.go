@@ -0,0 +1,181 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+// parseAlertSilenceMatchers parses matchers like host=web01, level!=fatal,
+// vm_name=~db-.* or tenant!~test.*
+func parseAlertSilenceMatchers(strs []string) ([]monitor.AlertSilenceMatcher, error) {
+	ret := make([]monitor.AlertSilenceMatcher, 0, len(strs))
+	for _, str := range strs {
+		matcher, err := parseAlertSilenceMatcher(str)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, matcher)
+	}
+	return ret, nil
+}
+
+func parseAlertSilenceMatcher(str string) (monitor.AlertSilenceMatcher, error) {
+	ops := []string{
+		monitor.ALERT_SILENCE_MATCH_NOT_EQUAL,
+		monitor.ALERT_SILENCE_MATCH_NOT_REGEX,
+		monitor.ALERT_SILENCE_MATCH_REGEX,
+		monitor.ALERT_SILENCE_MATCH_EQUAL,
+	}
+	for i := 0; i < len(str); i++ {
+		for _, op := range ops {
+			if strings.HasPrefix(str[i:], op) && i > 0 {
+				return monitor.AlertSilenceMatcher{
+					Label:    strings.TrimSpace(str[:i]),
+					Operator: op,
+					Value:    strings.TrimSpace(str[i+len(op):]),
+				}, nil
+			}
+		}
+	}
+	return monitor.AlertSilenceMatcher{}, errors.Errorf("invalid matcher %q", str)
+}
+
+func parseAlertSilenceTime(str string) (time.Time, error) {
+	if d, err := time.ParseDuration(str); err == nil {
+		return time.Now().Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, str)
+	if err != nil {
+		return t, errors.Wrapf(err, "invalid time %q, expect RFC3339 or a duration from now", str)
+	}
+	return t, nil
+}
+
+type AlertSilenceListOptions struct {
+	options.BaseListOptions
+
+	AlertId string `help:"id or name of alert" json:"alert_id"`
+	Active  *bool  `help:"only list the silences in effect" json:"active"`
+}
+
+func (o *AlertSilenceListOptions) Params() (jsonutils.JSONObject, error) {
+	return options.ListStructToParams(o)
+}
+
+type AlertSilenceShowOptions struct {
+	options.BaseShowOptions
+}
+
+type AlertSilenceDeleteOptions struct {
+	options.BaseIdOptions
+}
+
+type AlertSilenceCreateOptions struct {
+	options.BaseCreateOptions
+
+	AlertId string   `help:"id or name of the alert to silence" json:"alert_id"`
+	Matcher []string `help:"label matcher, e.g. host=web01, vm_name=~db-.*, level!=fatal" json:"-"`
+
+	StartTime string `help:"start time in RFC3339 or a duration from now, default now" json:"-"`
+	EndTime   string `help:"end time in RFC3339 or a duration from now, e.g. 2h" json:"-"`
+
+	Recurrence string `help:"cron expression of the recurring maintenance windows, e.g. '0 2 * * 6'" json:"recurrence"`
+	Duration   string `help:"duration of each recurring window, e.g. 2h" json:"-"`
+	Timezone   string `help:"timezone of the recurrence, e.g. Asia/Shanghai" json:"timezone"`
+}
+
+func (o *AlertSilenceCreateOptions) Params() (jsonutils.JSONObject, error) {
+	params, err := options.StructToParams(o)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.Matcher) > 0 {
+		matchers, err := parseAlertSilenceMatchers(o.Matcher)
+		if err != nil {
+			return nil, err
+		}
+		params.Add(jsonutils.Marshal(matchers), "matchers")
+	}
+	if len(o.StartTime) > 0 {
+		t, err := parseAlertSilenceTime(o.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		params.Add(jsonutils.NewTimeString(t), "start_time")
+	}
+	if len(o.EndTime) > 0 {
+		t, err := parseAlertSilenceTime(o.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		params.Add(jsonutils.NewTimeString(t), "end_time")
+	}
+	if len(o.Duration) > 0 {
+		d, err := time.ParseDuration(o.Duration)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse duration")
+		}
+		params.Add(jsonutils.NewInt(int64(d.Seconds())), "duration")
+	}
+	return params, nil
+}
+
+type AlertSilenceUpdateOptions struct {
+	options.BaseIdOptions
+
+	Name       string   `help:"name of the silence" json:"name"`
+	Matcher    []string `help:"label matcher, replace all the matchers" json:"-"`
+	EndTime    string   `help:"end time in RFC3339 or a duration from now" json:"-"`
+	Recurrence string   `help:"cron expression of the recurring maintenance windows" json:"recurrence"`
+	Duration   string   `help:"duration of each recurring window, e.g. 2h" json:"-"`
+	Timezone   string   `help:"timezone of the recurrence" json:"timezone"`
+}
+
+func (o *AlertSilenceUpdateOptions) Params() (jsonutils.JSONObject, error) {
+	params, err := options.StructToParams(o)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.Matcher) > 0 {
+		matchers, err := parseAlertSilenceMatchers(o.Matcher)
+		if err != nil {
+			return nil, err
+		}
+		params.Add(jsonutils.Marshal(matchers), "matchers")
+	}
+	if len(o.EndTime) > 0 {
+		t, err := parseAlertSilenceTime(o.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		params.Add(jsonutils.NewTimeString(t), "end_time")
+	}
+	if len(o.Duration) > 0 {
+		d, err := time.ParseDuration(o.Duration)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse duration")
+		}
+		params.Add(jsonutils.NewInt(int64(d.Seconds())), "duration")
+	}
+	return params, nil
+}
@@ -15,7 +15,10 @@
 package monitor
 
 import (
+	"time"
+
 	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
 
 	"yunion.io/x/onecloud/pkg/apis/monitor"
 	"yunion.io/x/onecloud/pkg/mcclient/options"
@@ -54,6 +57,49 @@ type NotificationFields struct {
 	IsDefault             *bool  `help:"set as default notification"`
 	DisableResolveMessage *bool  `help:"disable notify recover message"`
 	SendReminder          *bool  `help:"send reminder"`
+
+	GroupBy        []string `help:"labels to group alerts into one notification, e.g. host, alert_name"`
+	GroupWait      string   `help:"wait before the first notification of a group, e.g. 30s"`
+	GroupInterval  string   `help:"wait before notifying new alerts of a notified group, e.g. 5m"`
+	RepeatInterval string   `help:"wait before notifying the same alert again, e.g. 4h"`
+
+	EscalationNotification string `help:"ID or name of the notification to escalate to when the alert is not acknowledged"`
+	EscalationAfter        string `help:"escalate when the alert is not acknowledged after this duration, e.g. 15m"`
+}
+
+func parseSeconds(name, val string) (*int64, error) {
+	if len(val) == 0 {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", name)
+	}
+	sec := int64(d / time.Second)
+	return &sec, nil
+}
+
+func (opt NotificationFields) groupParams() (*monitor.NotificationUpdateInput, error) {
+	ret := &monitor.NotificationUpdateInput{
+		GroupBy: opt.GroupBy,
+	}
+	var err error
+	if ret.GroupWait, err = parseSeconds("group_wait", opt.GroupWait); err != nil {
+		return nil, err
+	}
+	if ret.GroupInterval, err = parseSeconds("group_interval", opt.GroupInterval); err != nil {
+		return nil, err
+	}
+	if ret.RepeatInterval, err = parseSeconds("repeat_interval", opt.RepeatInterval); err != nil {
+		return nil, err
+	}
+	if ret.EscalationAfter, err = parseSeconds("escalation_after", opt.EscalationAfter); err != nil {
+		return nil, err
+	}
+	if len(opt.EscalationNotification) > 0 {
+		ret.EscalationNotificationId = &opt.EscalationNotification
+	}
+	return ret, nil
 }
 
 type NotificationCreateOptions struct {
@@ -70,6 +116,26 @@ func (opt NotificationCreateOptions) Params() (*monitor.NotificationCreateInput,
 	if opt.IsDefault != nil && *opt.IsDefault {
 		ret.IsDefault = true
 	}
+	group, err := opt.groupParams()
+	if err != nil {
+		return nil, err
+	}
+	ret.GroupBy = group.GroupBy
+	if group.GroupWait != nil {
+		ret.GroupWait = *group.GroupWait
+	}
+	if group.GroupInterval != nil {
+		ret.GroupInterval = *group.GroupInterval
+	}
+	if group.RepeatInterval != nil {
+		ret.RepeatInterval = *group.RepeatInterval
+	}
+	if group.EscalationNotificationId != nil {
+		ret.EscalationNotificationId = *group.EscalationNotificationId
+	}
+	if group.EscalationAfter != nil {
+		ret.EscalationAfter = *group.EscalationAfter
+	}
 	return ret, nil
 }
 
@@ -133,10 +199,12 @@ func (opt NotificationUpdateOptions) Params() (*monitor.NotificationUpdateInput,
 		tmp := false
 		opt.SendReminder = &tmp
 	}
-	ret := &monitor.NotificationUpdateInput{
-		IsDefault:             opt.IsDefault,
-		DisableResolveMessage: opt.DisableResolveMessage,
-		SendReminder:          opt.SendReminder,
+	ret, err := opt.groupParams()
+	if err != nil {
+		return nil, err
 	}
+	ret.IsDefault = opt.IsDefault
+	ret.DisableResolveMessage = opt.DisableResolveMessage
+	ret.SendReminder = opt.SendReminder
 	return ret, nil
 }
@@ -16,6 +16,7 @@ package conditions
 
 import (
 	"fmt"
+	"math"
 
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/utils"
@@ -126,6 +127,91 @@ func (e *rangedEvaluator) String() string {
 	return fmt.Sprintf("%s [%.2f, %.2f]", e.Type, e.Lower, e.Upper)
 }
 
+const (
+	SEASONAL_BASELINE_DEFAULT_DAYS = 7
+	SEASONAL_BASELINE_MAX_DAYS     = 30
+	// flat baselines get a deviation of 1% of the mean, so that tiny
+	// fluctuations of an otherwise constant metric do not fire
+	SEASONAL_BASELINE_MIN_STDDEV_RATIO = 0.01
+)
+
+// BaselineEvaluator is implemented by evaluators comparing the reduced value
+// of a series with the values reduced from the same time window in previous
+// days. The query condition fetches the history before evaluation.
+type BaselineEvaluator interface {
+	AlertEvaluator
+	BaselineDays() int
+	EvalBaseline(reducedValue *float64, baseline []float64) bool
+}
+
+// seasonalBaselineEvaluator fires when the reduced value deviates more than
+// Sigma standard deviations from the mean of the same window in previous days.
+// Params: [sigma, days], days defaults to 7.
+type seasonalBaselineEvaluator struct {
+	Type  string
+	Sigma float64
+	Days  int
+}
+
+func newSeasonalBaselineEvaluator(cond *monitor.Condition) (*seasonalBaselineEvaluator, error) {
+	if len(cond.Params) == 0 {
+		return nil, errors.Wrap(validators.ErrMissingParameterThreshold, "SeasonalBaselineEvaluator sigma parameter is missing")
+	}
+	eval := &seasonalBaselineEvaluator{
+		Type:  cond.Type,
+		Sigma: cond.Params[0],
+		Days:  SEASONAL_BASELINE_DEFAULT_DAYS,
+	}
+	if eval.Sigma <= 0 {
+		return nil, errors.Wrapf(validators.ErrMissingParameterThreshold, "SeasonalBaselineEvaluator sigma %f must be positive", eval.Sigma)
+	}
+	if len(cond.Params) > 1 {
+		eval.Days = int(cond.Params[1])
+		if eval.Days < 2 || eval.Days > SEASONAL_BASELINE_MAX_DAYS {
+			return nil, errors.Wrapf(validators.ErrMissingParameterThreshold, "SeasonalBaselineEvaluator days %d must be between 2 and %d", eval.Days, SEASONAL_BASELINE_MAX_DAYS)
+		}
+	}
+	return eval, nil
+}
+
+func (e *seasonalBaselineEvaluator) BaselineDays() int {
+	return e.Days
+}
+
+// Eval without history never fires
+func (e *seasonalBaselineEvaluator) Eval(reducedValue *float64) bool {
+	return false
+}
+
+func (e *seasonalBaselineEvaluator) EvalBaseline(reducedValue *float64, baseline []float64) bool {
+	if reducedValue == nil || len(baseline) < 2 {
+		return false
+	}
+	mean, stddev := meanStddev(baseline)
+	if minStddev := math.Abs(mean) * SEASONAL_BASELINE_MIN_STDDEV_RATIO; stddev < minStddev {
+		stddev = minStddev
+	}
+	return math.Abs(*reducedValue-mean) > e.Sigma*stddev
+}
+
+func (e *seasonalBaselineEvaluator) String() string {
+	return fmt.Sprintf("%s %.2f sigma over %d days", e.Type, e.Sigma, e.Days)
+}
+
+func meanStddev(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(values))
+	return mean, math.Sqrt(variance)
+}
+
 // NewAlertEvaluator is a factory function for returning
 // an `AlertEvaluator` depending on the input condition.
 func NewAlertEvaluator(cond *monitor.Condition) (AlertEvaluator, error) {
@@ -141,6 +227,10 @@ func NewAlertEvaluator(cond *monitor.Condition) (AlertEvaluator, error) {
 		return newRangedEvaluator(cond)
 	}
 
+	if utils.IsInStringArray(typ, validators.EvaluatorBaselineTypes) {
+		return newSeasonalBaselineEvaluator(cond)
+	}
+
 	if typ == "no_value" {
 		return &noValueEvaluator{}, nil
 	}
@@ -66,3 +66,44 @@ func TestEvalutors(t *testing.T) {
 		})
 	})
 }
+
+func TestSeasonalBaselineEvaluator(t *testing.T) {
+	Convey("seasonal_baseline", t, func() {
+		evaluator, err := NewAlertEvaluator(&monitor.Condition{Type: "seasonal_baseline", Params: []float64{3, 5}})
+		So(err, ShouldBeNil)
+		baselineEval, ok := evaluator.(BaselineEvaluator)
+		So(ok, ShouldBeTrue)
+		So(baselineEval.BaselineDays(), ShouldEqual, 5)
+
+		// mean 100, stddev 2
+		baseline := []float64{98, 102, 98, 102, 100, 100}
+		val := float64(104)
+		So(baselineEval.EvalBaseline(&val, baseline), ShouldBeFalse)
+		val = float64(107)
+		So(baselineEval.EvalBaseline(&val, baseline), ShouldBeTrue)
+		val = float64(93)
+		So(baselineEval.EvalBaseline(&val, baseline), ShouldBeTrue)
+
+		Convey("should be false without enough history", func() {
+			val := float64(1000)
+			So(baselineEval.EvalBaseline(&val, []float64{100}), ShouldBeFalse)
+			So(baselineEval.EvalBaseline(nil, baseline), ShouldBeFalse)
+			So(evaluator.Eval(&val), ShouldBeFalse)
+		})
+
+		Convey("flat baseline tolerates small fluctuation", func() {
+			flat := []float64{100, 100, 100}
+			val := float64(102)
+			So(baselineEval.EvalBaseline(&val, flat), ShouldBeFalse)
+			val = float64(104)
+			So(baselineEval.EvalBaseline(&val, flat), ShouldBeTrue)
+		})
+
+		Convey("invalid params", func() {
+			_, err := NewAlertEvaluator(&monitor.Condition{Type: "seasonal_baseline"})
+			So(err, ShouldNotBeNil)
+			_, err = NewAlertEvaluator(&monitor.Condition{Type: "seasonal_baseline", Params: []float64{3, 100}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -18,7 +18,9 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
@@ -161,6 +163,15 @@ func (c *QueryCondition) Eval(context *alerting.EvalContext) (*alerting.Conditio
 	seriesList := ret.series
 	metas := ret.metas
 
+	baselineEval, isBaseline := c.Evaluator.(BaselineEvaluator)
+	var baselines map[string][]float64
+	if isBaseline && len(seriesList) > 0 {
+		baselines, err = c.fetchBaselines(context, timeRange, baselineEval.BaselineDays())
+		if err != nil {
+			return nil, errors.Wrap(err, "fetchBaselines")
+		}
+	}
+
 	emptySeriesCount := 0
 	evalMatchCount := 0
 	var matches []*monitor.EvalMatch
@@ -180,7 +191,12 @@ func (c *QueryCondition) Eval(context *alerting.EvalContext) (*alerting.Conditio
 			c.FillSerieByResourceField(resource, series)
 		}
 		reducedValue, valStrArr := c.Reducer.Reduce(series)
-		evalMatch := c.Evaluator.Eval(reducedValue)
+		var evalMatch bool
+		if isBaseline {
+			evalMatch = baselineEval.EvalBaseline(reducedValue, baselines[seriesKey(series)])
+		} else {
+			evalMatch = c.Evaluator.Eval(reducedValue)
+		}
 
 		if reducedValue == nil {
 			emptySeriesCount++
@@ -386,6 +402,45 @@ func (c *QueryCondition) jointPointStr(series monitor.TimeSeries, value string,
 	return str
 }
 
+// seriesKey identifies a series across queries of different time ranges
+func seriesKey(series *monitor.TimeSeries) string {
+	keys := make([]string, 0, len(series.Tags))
+	for k := range series.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{series.Name}
+	for _, k := range keys {
+		parts = append(parts, k+"="+series.Tags[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// fetchBaselines queries the same time window in each of the previous days
+// and reduces every series the same way as the current window
+func (c *QueryCondition) fetchBaselines(evalCtx *alerting.EvalContext, timeRange *tsdb.TimeRange, days int) (map[string][]float64, error) {
+	from := timeRange.GetFromAsMsEpoch()
+	to := timeRange.GetToAsMsEpoch()
+	dayMs := int64(24 * time.Hour / time.Millisecond)
+	baselines := make(map[string][]float64)
+	for i := 1; i <= days; i++ {
+		shifted := tsdb.NewTimeRange(strconv.FormatInt(from-int64(i)*dayMs, 10), strconv.FormatInt(to-int64(i)*dayMs, 10))
+		ret, err := c.executeQuery(evalCtx, shifted)
+		if err != nil {
+			return nil, errors.Wrapf(err, "query %d days ago", i)
+		}
+		for _, series := range ret.series {
+			value, _ := c.Reducer.Reduce(series)
+			if value == nil {
+				continue
+			}
+			key := seriesKey(series)
+			baselines[key] = append(baselines[key], *value)
+		}
+	}
+	return baselines, nil
+}
+
 type queryResult struct {
 	series        monitor.TimeSeriesSlice
 	metas         []monitor.QueryResultMeta
@@ -150,23 +150,21 @@ func (s *queryReducer) Reduce(series *monitor.TimeSeries) (*float64, []string) {
 			allNull = false
 		}
 	case monitor.REDUCER_PERCENTILE:
-		var values []float64
-		for _, v := range series.Points {
-			if v.IsValid() {
-				allNull = false
-				values = append(values, v.Value())
-			}
-		}
 		pNum := float64(95)
 		if len(s.Params) != 0 {
 			pNum = s.Params[0]
 		}
-		if len(values) >= 1 {
-			sort.Float64s(values)
-			length := len(values)
-			index := math.Floor(float64(length) * pNum / float64(100))
-			value = values[int64(index)]
-		}
+		allNull, value = calculatePercentile(series, pNum)
+	case monitor.REDUCER_P50:
+		allNull, value = calculatePercentile(series, 50)
+	case monitor.REDUCER_P95:
+		allNull, value = calculatePercentile(series, 95)
+	case monitor.REDUCER_P99:
+		allNull, value = calculatePercentile(series, 99)
+	case monitor.REDUCER_RATE:
+		allNull, value = calculateRate(series, s.getRateUnit(), true)
+	case monitor.REDUCER_DERIVATIVE:
+		allNull, value = calculateRate(series, s.getRateUnit(), false)
 	}
 
 	if allNull {
@@ -218,6 +216,68 @@ func calculateDiff(series *monitor.TimeSeries, allNull bool, value float64, fn f
 	return allNull, value
 }
 
+func calculatePercentile(series *monitor.TimeSeries, pNum float64) (bool, float64) {
+	var values []float64
+	for _, v := range series.Points {
+		if v.IsValid() {
+			values = append(values, v.Value())
+		}
+	}
+	if len(values) == 0 {
+		return true, 0
+	}
+	sort.Float64s(values)
+	index := int(math.Floor(float64(len(values)) * pNum / float64(100)))
+	if index >= len(values) {
+		index = len(values) - 1
+	} else if index < 0 {
+		index = 0
+	}
+	return false, values[index]
+}
+
+// getRateUnit returns the time unit in seconds of rate and derivative
+// reducers, which is given by the first param and defaults to one second
+func (s *queryReducer) getRateUnit() float64 {
+	if len(s.Params) != 0 && s.Params[0] > 0 {
+		return s.Params[0]
+	}
+	return 1
+}
+
+// calculateRate returns the change per unit of time between the oldest and
+// the newest valid points. For counters, a decreasing value is taken as a
+// counter reset, so the increase after the reset is counted from zero.
+func calculateRate(series *monitor.TimeSeries, unit float64, isCounter bool) (bool, float64) {
+	var (
+		first, last *monitor.TimePoint
+		increase    float64
+	)
+	for i := range series.Points {
+		point := series.Points[i]
+		if !point.IsValid() {
+			continue
+		}
+		if first == nil {
+			first = &series.Points[i]
+		} else if isCounter && point.Value() < last.Value() {
+			increase += point.Value()
+		} else {
+			increase += point.Value() - last.Value()
+		}
+		last = &series.Points[i]
+	}
+	if first == nil {
+		return true, 0
+	}
+	// timestamps are in milliseconds
+	duration := (last.Timestamp() - first.Timestamp()) / 1000
+	if duration <= 0 {
+		return false, 0
+	}
+	return false, increase / duration * unit
+}
+
 var diff = func(newest, oldest float64) float64 {
 	return newest - oldest
 }
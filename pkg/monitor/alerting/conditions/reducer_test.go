@@ -187,6 +187,72 @@ func TestSimpleReducer(t *testing.T) {
 	})
 }
 
+func TestPercentileAndRateReducer(t *testing.T) {
+	Convey("Test percentile reducers", t, func() {
+		values := make([]float64, 0, 100)
+		for i := 1; i <= 100; i++ {
+			values = append(values, float64(i))
+		}
+		So(testReducer("p50", values...), ShouldEqual, float64(51))
+		So(testReducer("p95", values...), ShouldEqual, float64(96))
+		So(testReducer("p99", values...), ShouldEqual, float64(100))
+		So(testReducer("p99", 7), ShouldEqual, float64(7))
+	})
+
+	Convey("Test rate and derivative reducers", t, func() {
+		newSeries := func(values ...float64) *monitor.TimeSeries {
+			series := &monitor.TimeSeries{
+				Name: "test time series",
+			}
+			for i := range values {
+				// one point every 10 seconds, timestamps in milliseconds
+				series.Points = append(series.Points, monitor.NewTimePointByVal(values[i], float64(i*10000)))
+			}
+			return series
+		}
+
+		Convey("rate of a monotonic counter", func() {
+			reducer := newSimpleReducerByType("rate")
+			result, _ := reducer.Reduce(newSeries(100, 200, 300))
+			So(*result, ShouldEqual, float64(10))
+		})
+
+		Convey("rate tolerates counter reset", func() {
+			reducer := newSimpleReducerByType("rate")
+			result, _ := reducer.Reduce(newSeries(100, 200, 100, 200))
+			So(*result, ShouldEqual, float64(10))
+		})
+
+		Convey("rate per minute", func() {
+			reducer := &queryReducer{Type: monitor.REDUCER_RATE, Params: []float64{60}}
+			result, _ := reducer.Reduce(newSeries(100, 200, 300))
+			So(*result, ShouldEqual, float64(600))
+		})
+
+		Convey("derivative can be negative", func() {
+			reducer := newSimpleReducerByType("derivative")
+			result, _ := reducer.Reduce(newSeries(300, 200, 100))
+			So(*result, ShouldEqual, float64(-10))
+		})
+
+		Convey("rate of a single point", func() {
+			reducer := newSimpleReducerByType("rate")
+			result, _ := reducer.Reduce(newSeries(100))
+			So(*result, ShouldEqual, float64(0))
+		})
+
+		Convey("rate with only nulls", func() {
+			reducer := newSimpleReducerByType("rate")
+			series := &monitor.TimeSeries{
+				Name: "test time series",
+			}
+			series.Points = append(series.Points, monitor.NewTimePoint(nil, 1))
+			result, _ := reducer.Reduce(series)
+			So(result, ShouldBeNil)
+		})
+	})
+}
+
 func testReducer(reducerType string, datapoints ...float64) float64 {
 	reducer := newSimpleReducerByType(reducerType)
 	serires := &monitor.TimeSeries{
@@ -68,6 +68,7 @@ func (e *AlertEngine) Run(ctx context.Context) error {
 	alertGroup, ctx := errgroup.WithContext(ctx)
 	alertGroup.Go(func() error { return e.alertingTicker(ctx) })
 	alertGroup.Go(func() error { return e.runJobDispatcher(ctx) })
+	alertGroup.Go(func() error { return e.notificationTicker(ctx) })
 
 	err := alertGroup.Wait()
 	return err
@@ -99,6 +100,40 @@ func (e *AlertEngine) alertingTicker(ctx context.Context) error {
 	}
 }
 
+var (
+	notificationTickInterval = time.Second * 5
+	// check the escalations every sixth notification tick
+	escalationTicks = 6
+)
+
+// notificationTicker flushes the grouped notifications and escalates the
+// alerts not acknowledged in time.
+func (e *AlertEngine) notificationTicker(ctx context.Context) error {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Errorf("Notification panic: stopping notificationTicker, error: %v", err)
+			debug.PrintStack()
+		}
+	}()
+
+	ticker := time.NewTicker(notificationTickInterval)
+	defer ticker.Stop()
+	tickIndex := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			notificationGroups.flush(ctx, now)
+			if tickIndex%escalationTicks == 0 {
+				processEscalations(ctx, now)
+			}
+			tickIndex++
+		}
+	}
+}
+
 func (e *AlertEngine) runJobDispatcher(ctx context.Context) error {
 	dispatcherGroup, alertCtx := errgroup.WithContext(ctx)
 
@@ -0,0 +1,146 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerting
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/monitor/models"
+)
+
+// startEscalation schedules the escalation policy of the notification once
+// the alert has been notified, an alert acknowledged in its current alerting
+// period is not escalated
+func startEscalation(ctx context.Context, alertId string, noti *models.SNotification) {
+	if err := models.AlertEscalationManager.StartEscalation(ctx, alertId, noti, 1); err != nil {
+		log.Errorf("start escalation of alert %s by notification %s: %v", alertId, noti.GetName(), err)
+	}
+}
+
+// processEscalations notifies the escalation notifications of the alerts
+// still not acknowledged
+func processEscalations(ctx context.Context, now time.Time) {
+	escalations, err := models.AlertEscalationManager.GetDueEscalations(now)
+	if err != nil {
+		log.Errorf("get due escalations: %v", err)
+		return
+	}
+	for i := range escalations {
+		if err := escalate(ctx, &escalations[i]); err != nil {
+			log.Errorf("escalate alert %s: %v", escalations[i].AlertId, err)
+		}
+	}
+}
+
+type iEscalationAlert interface {
+	GetEnabled() bool
+	GetState() monitor.AlertStateType
+}
+
+// escalationStopState returns the state a due escalation stops at without
+// firing, or empty if it fires. ackedRecord is the record of the alert
+// acknowledged last and since the start of the current alert state.
+func escalationStopState(escalation *models.SAlertEscalation, alert iEscalationAlert, ackedRecord *models.SAlertRecord, since time.Time) string {
+	if !alert.GetEnabled() || alert.GetState() != monitor.AlertStateAlerting {
+		return monitor.ALERT_ESCALATION_STATE_RESOLVED
+	}
+	if escalation.IsAckedBy(ackedRecord, since) {
+		return monitor.ALERT_ESCALATION_STATE_ACKED
+	}
+	return ""
+}
+
+func escalate(ctx context.Context, escalation *models.SAlertEscalation) error {
+	alert, err := models.CommonAlertManager.GetAlert(escalation.AlertId)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return escalation.SetState(monitor.ALERT_ESCALATION_STATE_RESOLVED)
+		}
+		return errors.Wrap(err, "get alert")
+	}
+	// the ack may have been made after the escalation was fetched as pending
+	ackedRecord, err := models.AlertRecordManager.GetLatestAckedRecord(alert.Id)
+	if err != nil {
+		return err
+	}
+	if state := escalationStopState(escalation, alert, ackedRecord, alert.LastStateChange); len(state) > 0 {
+		return escalation.SetState(state)
+	}
+	noti, err := escalation.GetNotification()
+	if err != nil {
+		return errors.Wrap(err, "get escalation notification")
+	}
+	if noti == nil {
+		return escalation.SetState(monitor.ALERT_ESCALATION_STATE_RESOLVED)
+	}
+
+	evalCtx, err := newEscalationEvalContext(ctx, alert)
+	if err != nil {
+		return err
+	}
+	notifier, err := InitNotifier(newNotificationConfig(ctx, noti))
+	if err != nil {
+		return errors.Wrapf(err, "init notifier %s", noti.GetName())
+	}
+	var params jsonutils.JSONObject
+	if state, err := models.AlertNotificationManager.Get(alert.Id, noti.Id); err == nil {
+		params = state.GetParams()
+	}
+	// the step is done whether the notification succeeds or not, so that a
+	// broken notification is not retried forever
+	if err := escalation.SetState(monitor.ALERT_ESCALATION_STATE_ESCALATED); err != nil {
+		return err
+	}
+	log.Infof("Escalate alert %s to notification %s, step %d", alert.Name, noti.Name, escalation.Step)
+	if err := notifier.Notify(evalCtx, params); err != nil {
+		return errors.Wrapf(err, "notify %s", noti.GetName())
+	}
+	// StartEscalation checks the ack again in case it was made while notifying
+	return models.AlertEscalationManager.StartEscalation(ctx, alert.Id, noti, escalation.Step+1)
+}
+
+// newEscalationEvalContext rebuilds the evaluation of the alert from its
+// latest record
+func newEscalationEvalContext(ctx context.Context, alert *models.SCommonAlert) (*EvalContext, error) {
+	rule, err := NewRuleFromDBAlert(&alert.SAlert)
+	if err != nil {
+		return nil, errors.Wrapf(err, "new rule from alert %s", alert.Name)
+	}
+	evalCtx := NewEvalContext(ctx, auth.AdminCredential(), rule)
+	evalCtx.Firing = true
+	evalCtx.PrevAlertState = monitor.AlertStateAlerting
+	record, err := models.AlertRecordManager.GetLatestAlertRecord(alert.Id)
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		matches, err := record.GetEvalData()
+		if err != nil {
+			return nil, errors.Wrap(err, "get eval data of record")
+		}
+		for i := range matches {
+			evalCtx.EvalMatches = append(evalCtx.EvalMatches, &matches[i])
+		}
+	}
+	return evalCtx, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/monitor/models"
+)
+
+type fakeEscalationAlert struct {
+	enabled bool
+	state   monitor.AlertStateType
+}
+
+func (alert fakeEscalationAlert) GetEnabled() bool {
+	return alert.enabled
+}
+
+func (alert fakeEscalationAlert) GetState() monitor.AlertStateType {
+	return alert.state
+}
+
+func newTestAckedRecord(alertId string, ackedAt time.Time) *models.SAlertRecord {
+	record := &models.SAlertRecord{}
+	record.AlertId = alertId
+	record.AckedBy = "admin"
+	record.AckedAt = ackedAt
+	return record
+}
+
+func TestEscalationStopState(t *testing.T) {
+	now := time.Now()
+	since := now.Add(-time.Hour)
+	escalation := &models.SAlertEscalation{AlertId: "alert1", Step: 1}
+	escalation.CreatedAt = now.Add(-time.Minute)
+	alerting := fakeEscalationAlert{enabled: true, state: monitor.AlertStateAlerting}
+
+	cases := []struct {
+		name   string
+		alert  fakeEscalationAlert
+		record *models.SAlertRecord
+		want   string
+	}{
+		{
+			name:  "alerting without ack fires",
+			alert: alerting,
+			want:  "",
+		},
+		{
+			name:  "disabled alert is resolved",
+			alert: fakeEscalationAlert{enabled: false, state: monitor.AlertStateAlerting},
+			want:  monitor.ALERT_ESCALATION_STATE_RESOLVED,
+		},
+		{
+			name:   "recovered alert is resolved even if acked",
+			alert:  fakeEscalationAlert{enabled: true, state: monitor.AlertStateOK},
+			record: newTestAckedRecord("alert1", now),
+			want:   monitor.ALERT_ESCALATION_STATE_RESOLVED,
+		},
+		{
+			name:   "ack after the escalation was scheduled stops it",
+			alert:  alerting,
+			record: newTestAckedRecord("alert1", now),
+			want:   monitor.ALERT_ESCALATION_STATE_ACKED,
+		},
+		{
+			name:   "ack in the current alerting period before the escalation was scheduled stops it",
+			alert:  alerting,
+			record: newTestAckedRecord("alert1", since.Add(time.Minute)),
+			want:   monitor.ALERT_ESCALATION_STATE_ACKED,
+		},
+		{
+			name:   "ack of a former alerting period does not stop it",
+			alert:  alerting,
+			record: newTestAckedRecord("alert1", since.Add(-time.Minute)),
+			want:   "",
+		},
+		{
+			name:   "ack of another alert does not stop it",
+			alert:  alerting,
+			record: newTestAckedRecord("alert2", now),
+			want:   "",
+		},
+		{
+			name:   "record not acked does not stop it",
+			alert:  alerting,
+			record: newTestAckedRecord("alert1", time.Time{}),
+			want:   "",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, escalationStopState(escalation, c.alert, c.record, since))
+		})
+	}
+}
@@ -47,6 +47,8 @@ type EvalContext struct {
 
 	NoDataFound    bool
 	PrevAlertState monitor.AlertStateType
+	// all the matches are covered by alert silences
+	Silenced bool
 
 	Ctx      context.Context
 	UserCred mcclient.TokenCredential
@@ -282,6 +284,19 @@ func (c *EvalContext) GetResourceNameOfMatches(matches []*monitor.EvalMatch) str
 	return names.String()
 }
 
+// GetUnsilencedEvalMatches returns the alerting matches not covered by
+// alert silences
+func (c *EvalContext) GetUnsilencedEvalMatches() []*monitor.EvalMatch {
+	ret := make([]*monitor.EvalMatch, 0)
+	for i := range c.EvalMatches {
+		m := c.EvalMatches[i]
+		if _, ok := m.Tags[monitor.ALERT_SILENCE_ID_KEY]; !ok {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
 func (c *EvalContext) GetRecoveredMatches() []*monitor.EvalMatch {
 	ret := make([]*monitor.EvalMatch, 0)
 	for i := range c.AlertOkEvalMatches {
@@ -0,0 +1,330 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/monitor/models"
+)
+
+const (
+	// forget the notified matches not seen for so long
+	notifiedMatchExpire = 24 * time.Hour
+)
+
+var notificationGroups = newNotificationGrouper()
+
+type groupedMatch struct {
+	evalCtx *EvalContext
+	match   *monitor.EvalMatch
+}
+
+// notificationGroup collects the matches with the same group_by label values
+// until it is flushed as a single notification
+type notificationGroup struct {
+	key   string
+	state *notifierState
+
+	firing    map[string]groupedMatch
+	recovered map[string]groupedMatch
+
+	lastFlushAt time.Time
+	nextFlushAt time.Time
+}
+
+type notifiedMatch struct {
+	notifiedAt time.Time
+	seenAt     time.Time
+}
+
+// notificationGrouper groups, deduplicates and throttles the eval matches of
+// the notifications with group_by set, the same way as the alertmanager:
+// a new group waits group_wait before the first notification, new matches of
+// a notified group wait group_interval and a match already notified is not
+// notified again within repeat_interval.
+type notificationGrouper struct {
+	lock   sync.Mutex
+	groups map[string]*notificationGroup
+	// keyed by notification id and match fingerprint
+	notified map[string]*notifiedMatch
+
+	send func(evalCtx *EvalContext, state *notifierState) error
+}
+
+func newNotificationGrouper() *notificationGrouper {
+	return &notificationGrouper{
+		groups:   make(map[string]*notificationGroup),
+		notified: make(map[string]*notifiedMatch),
+		send: func(evalCtx *EvalContext, state *notifierState) error {
+			return newNotificationService().sendNotification(evalCtx, state)
+		},
+	}
+}
+
+var internalMatchTags = []string{
+	monitor.ALERT_RESOURCE_RECORD_SHIELD_KEY,
+	monitor.ALERT_SILENCE_ID_KEY,
+}
+
+// matchFingerprint identifies the same series of the same alert across
+// evaluations
+func matchFingerprint(alertId string, match *monitor.EvalMatch) string {
+	keys := make([]string, 0, len(match.Tags))
+	for k := range match.Tags {
+		if !isInternalMatchTag(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var buf strings.Builder
+	buf.WriteString(alertId)
+	buf.WriteByte('|')
+	buf.WriteString(match.Metric)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "|%s=%s", k, match.Tags[k])
+	}
+	return buf.String()
+}
+
+func isInternalMatchTag(key string) bool {
+	for _, k := range internalMatchTags {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func groupKey(noti *models.SNotification, labels map[string]string) string {
+	var buf strings.Builder
+	buf.WriteString(noti.Id)
+	buf.WriteByte('{')
+	for i, label := range noti.GroupBy {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%s=%q", label, labels[label])
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+func (g *notificationGrouper) getGroup(key string, state *notifierState) *notificationGroup {
+	group, ok := g.groups[key]
+	if !ok {
+		group = &notificationGroup{
+			key:       key,
+			firing:    make(map[string]groupedMatch),
+			recovered: make(map[string]groupedMatch),
+		}
+		g.groups[key] = group
+	}
+	group.state = state
+	return group
+}
+
+// schedule sets the time to flush a group having pending matches
+func (group *notificationGroup) schedule(now time.Time) {
+	if !group.nextFlushAt.IsZero() {
+		return
+	}
+	noti := group.state.notification
+	if group.lastFlushAt.IsZero() {
+		group.nextFlushAt = now.Add(time.Duration(noti.GroupWait) * time.Second)
+		return
+	}
+	next := group.lastFlushAt.Add(time.Duration(noti.GroupInterval) * time.Second)
+	if next.Before(now) {
+		next = now
+	}
+	group.nextFlushAt = next
+}
+
+// add puts the matches of an evaluation into the groups of the notification
+func (g *notificationGrouper) add(evalCtx *EvalContext, state *notifierState, now time.Time) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	noti := state.notification
+	repeat := time.Duration(noti.RepeatInterval) * time.Second
+	if evalCtx.Firing {
+		for _, match := range evalCtx.GetUnsilencedEvalMatches() {
+			if _, ok := match.Tags[monitor.ALERT_RESOURCE_RECORD_SHIELD_KEY]; ok {
+				continue
+			}
+			fp := matchFingerprint(evalCtx.Rule.Id, match)
+			group := g.getGroup(groupKey(noti, evalMatchLabels(evalCtx, match)), state)
+			delete(group.recovered, fp)
+			if notified, ok := g.notified[noti.Id+fp]; ok {
+				notified.seenAt = now
+				if now.Sub(notified.notifiedAt) < repeat {
+					continue
+				}
+			}
+			group.firing[fp] = groupedMatch{evalCtx: evalCtx, match: match}
+			group.schedule(now)
+		}
+	}
+	for _, match := range evalCtx.GetRecoveredMatches() {
+		fp := matchFingerprint(evalCtx.Rule.Id, match)
+		group := g.getGroup(groupKey(noti, evalMatchLabels(evalCtx, match)), state)
+		delete(group.firing, fp)
+		if _, ok := g.notified[noti.Id+fp]; !ok {
+			// the firing was never notified, so is the recovery
+			continue
+		}
+		delete(g.notified, noti.Id+fp)
+		group.recovered[fp] = groupedMatch{evalCtx: evalCtx, match: match}
+		group.schedule(now)
+	}
+}
+
+type groupFlush struct {
+	key      string
+	state    *notifierState
+	evalCtx  *EvalContext
+	alertIds []string
+}
+
+// collect takes out the groups due at now and builds their notifications
+func (g *notificationGrouper) collect(ctx context.Context, now time.Time) []groupFlush {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	ret := make([]groupFlush, 0)
+	for key, group := range g.groups {
+		if group.nextFlushAt.IsZero() {
+			idle := time.Duration(group.state.notification.GroupInterval) * time.Second
+			if now.Sub(group.lastFlushAt) > idle && len(group.firing) == 0 && len(group.recovered) == 0 {
+				delete(g.groups, key)
+			}
+			continue
+		}
+		if group.nextFlushAt.After(now) {
+			continue
+		}
+		group.nextFlushAt = time.Time{}
+		if len(group.firing) == 0 && len(group.recovered) == 0 {
+			continue
+		}
+		evalCtx, alertIds := group.buildEvalContext(ctx)
+		for fp := range group.firing {
+			g.notified[group.state.notification.Id+fp] = &notifiedMatch{notifiedAt: now, seenAt: now}
+		}
+		group.firing = make(map[string]groupedMatch)
+		group.recovered = make(map[string]groupedMatch)
+		group.lastFlushAt = now
+		ret = append(ret, groupFlush{
+			key:      key,
+			state:    group.state,
+			evalCtx:  evalCtx,
+			alertIds: alertIds,
+		})
+	}
+	for key, notified := range g.notified {
+		if now.Sub(notified.seenAt) > notifiedMatchExpire {
+			delete(g.notified, key)
+		}
+	}
+	return ret
+}
+
+func sortedGroupedMatches(matches map[string]groupedMatch) []groupedMatch {
+	fps := make([]string, 0, len(matches))
+	for fp := range matches {
+		fps = append(fps, fp)
+	}
+	sort.Strings(fps)
+	ret := make([]groupedMatch, len(fps))
+	for i, fp := range fps {
+		ret[i] = matches[fp]
+	}
+	return ret
+}
+
+// buildEvalContext merges the pending matches of the group into one
+// evaluation context, based on the rule of the latest evaluation
+func (group *notificationGroup) buildEvalContext(ctx context.Context) (*EvalContext, []string) {
+	firing := sortedGroupedMatches(group.firing)
+	recovered := sortedGroupedMatches(group.recovered)
+
+	var latest *EvalContext
+	alertIds := make([]string, 0)
+	evalMatches := make([]*monitor.EvalMatch, 0, len(firing))
+	okMatches := make([]*monitor.EvalMatch, 0, len(recovered))
+	for _, m := range append(firing, recovered...) {
+		if latest == nil || m.evalCtx.StartTime.After(latest.StartTime) {
+			latest = m.evalCtx
+		}
+	}
+	for _, m := range firing {
+		evalMatches = append(evalMatches, m.match)
+		alertIds = appendAlertId(alertIds, m.evalCtx.Rule.Id)
+	}
+	for _, m := range recovered {
+		okMatches = append(okMatches, m.match)
+	}
+
+	rule := *latest.Rule
+	if len(evalMatches) > 0 {
+		rule.State = monitor.AlertStateAlerting
+	} else {
+		rule.State = monitor.AlertStateOK
+	}
+	evalCtx := &EvalContext{
+		Ctx:                ctx,
+		UserCred:           latest.UserCred,
+		Firing:             len(evalMatches) > 0,
+		StartTime:          latest.StartTime,
+		EndTime:            latest.EndTime,
+		Rule:               &rule,
+		EvalMatches:        evalMatches,
+		AlertOkEvalMatches: okMatches,
+		PrevAlertState:     latest.PrevAlertState,
+	}
+	return evalCtx, alertIds
+}
+
+func appendAlertId(ids []string, id string) []string {
+	for _, i := range ids {
+		if i == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+// flush sends the notifications of the groups due at now
+func (g *notificationGrouper) flush(ctx context.Context, now time.Time) {
+	for _, f := range g.collect(ctx, now) {
+		log.Infof("Flush notification group %s: %d alerting, %d recovered", f.key, len(f.evalCtx.EvalMatches), len(f.evalCtx.AlertOkEvalMatches))
+		if err := g.send(f.evalCtx, f.state); err != nil {
+			log.Errorf("send notification of group %s: %v", f.key, err)
+			continue
+		}
+		for _, alertId := range f.alertIds {
+			startEscalation(ctx, alertId, f.state.notification)
+		}
+	}
+}
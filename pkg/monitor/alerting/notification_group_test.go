@@ -0,0 +1,119 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/monitor/models"
+)
+
+func newGroupTestContext(alertId string, firing bool, matches ...*monitor.EvalMatch) *EvalContext {
+	ctx := NewEvalContext(context.TODO(), nil, &Rule{Id: alertId, Name: alertId})
+	ctx.Firing = firing
+	if firing {
+		ctx.EvalMatches = matches
+	} else {
+		for _, m := range matches {
+			m.IsRecovery = true
+		}
+		ctx.AlertOkEvalMatches = matches
+	}
+	return ctx
+}
+
+func newGroupTestMatch(host string, vm string) *monitor.EvalMatch {
+	return &monitor.EvalMatch{
+		Metric: "vm_cpu.usage_active",
+		Tags:   map[string]string{"host": host, "vm_name": vm},
+	}
+}
+
+func TestNotificationGrouper(t *testing.T) {
+	noti := &models.SNotification{
+		GroupBy:        []string{"host"},
+		GroupWait:      30,
+		GroupInterval:  300,
+		RepeatInterval: 3600,
+	}
+	noti.Id = "noti1"
+	state := &notifierState{notification: noti}
+
+	sent := make([]*EvalContext, 0)
+	g := newNotificationGrouper()
+	g.send = func(evalCtx *EvalContext, state *notifierState) error {
+		sent = append(sent, evalCtx)
+		return nil
+	}
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// two alerts on the same host are grouped, another host is a new group
+	g.add(newGroupTestContext("alert1", true, newGroupTestMatch("h1", "vm1")), state, now)
+	g.add(newGroupTestContext("alert2", true, newGroupTestMatch("h1", "vm2")), state, now.Add(10*time.Second))
+	g.add(newGroupTestContext("alert1", true, newGroupTestMatch("h2", "vm3")), state, now.Add(20*time.Second))
+
+	g.flush(context.TODO(), now.Add(29*time.Second))
+	assert.Equal(t, 0, len(sent), "nothing is sent before group_wait")
+
+	g.flush(context.TODO(), now.Add(31*time.Second))
+	assert.Equal(t, 1, len(sent))
+	assert.Equal(t, 2, len(sent[0].EvalMatches))
+	assert.Equal(t, monitor.AlertStateAlerting, sent[0].Rule.State)
+
+	g.flush(context.TODO(), now.Add(51*time.Second))
+	assert.Equal(t, 2, len(sent))
+	assert.Equal(t, "vm3", sent[1].EvalMatches[0].Tags["vm_name"])
+
+	// the same matches are deduplicated within repeat_interval
+	g.add(newGroupTestContext("alert1", true, newGroupTestMatch("h1", "vm1")), state, now.Add(time.Minute))
+	g.flush(context.TODO(), now.Add(90*time.Second))
+	assert.Equal(t, 2, len(sent))
+
+	// a new match of a notified group waits group_interval
+	g.add(newGroupTestContext("alert3", true, newGroupTestMatch("h1", "vm4")), state, now.Add(2*time.Minute))
+	g.flush(context.TODO(), now.Add(3*time.Minute))
+	assert.Equal(t, 2, len(sent))
+	g.flush(context.TODO(), now.Add(5*time.Minute+31*time.Second))
+	assert.Equal(t, 3, len(sent))
+	assert.Equal(t, 1, len(sent[2].EvalMatches))
+
+	// notified matches are repeated after repeat_interval
+	g.add(newGroupTestContext("alert1", true, newGroupTestMatch("h1", "vm1")), state, now.Add(61*time.Minute))
+	g.flush(context.TODO(), now.Add(70*time.Minute))
+	assert.Equal(t, 4, len(sent))
+
+	// the recovery of a notified match is notified, others are not
+	g.add(newGroupTestContext("alert1", false, newGroupTestMatch("h2", "vm3")), state, now.Add(80*time.Minute))
+	g.add(newGroupTestContext("alert9", false, newGroupTestMatch("h2", "vm9")), state, now.Add(80*time.Minute))
+	g.flush(context.TODO(), now.Add(90*time.Minute))
+	assert.Equal(t, 5, len(sent))
+	assert.False(t, sent[4].Firing)
+	assert.Equal(t, 0, len(sent[4].EvalMatches))
+	assert.Equal(t, 1, len(sent[4].AlertOkEvalMatches))
+	assert.Equal(t, monitor.AlertStateOK, sent[4].Rule.State)
+}
+
+func TestMatchFingerprint(t *testing.T) {
+	m1 := newGroupTestMatch("h1", "vm1")
+	m2 := newGroupTestMatch("h1", "vm1")
+	m2.Tags[monitor.ALERT_SILENCE_ID_KEY] = "s1"
+	assert.Equal(t, matchFingerprint("a", m1), matchFingerprint("a", m2))
+	assert.NotEqual(t, matchFingerprint("a", m1), matchFingerprint("b", m1))
+}
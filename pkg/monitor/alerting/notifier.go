@@ -15,6 +15,7 @@
 package alerting
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
@@ -38,6 +39,11 @@ func newNotificationService() *notificationService {
 }
 
 func (n *notificationService) SendIfNeeded(evalCtx *EvalContext) error {
+	if evalCtx.Silenced {
+		log.Infof("alert %s is silenced, skip notification", evalCtx.Rule.Name)
+		n.syncResources(evalCtx, false)
+		return nil
+	}
 	notifierStates, shouldNotify, err := n.getNeededNotifiers(evalCtx.Rule.Notifications, evalCtx)
 	if err != nil {
 		return errors.Wrap(err, "failed to get alert notifiers")
@@ -53,8 +59,9 @@ func (n *notificationService) SendIfNeeded(evalCtx *EvalContext) error {
 }
 
 type notifierState struct {
-	notifier Notifier
-	state    *models.SAlertnotification
+	notifier     Notifier
+	state        *models.SAlertnotification
+	notification *models.SNotification
 }
 
 type notifierStateSlice []*notifierState
@@ -89,16 +96,37 @@ func (n *notificationService) sendAndMarkAsComplete(evalCtx *EvalContext, state
 
 func (n *notificationService) sendNotifications(evalCtx *EvalContext, states notifierStateSlice) error {
 	for _, state := range states {
+		if !evalCtx.IsTestRun && state.notification.IsGrouped() {
+			notificationGroups.add(evalCtx, state, time.Now())
+			continue
+		}
 		if err := n.sendNotification(evalCtx, state); err != nil {
 			log.Errorf("failed to send %s(%s) notification: %v", state.notifier.GetType(), state.notifier.GetNotifierId(), err)
 			if evalCtx.IsTestRun {
 				return err
 			}
+			continue
+		}
+		if !evalCtx.IsTestRun && evalCtx.Firing {
+			startEscalation(evalCtx.Ctx, evalCtx.Rule.Id, state.notification)
 		}
 	}
 	return nil
 }
 
+func newNotificationConfig(ctx context.Context, obj *models.SNotification) NotificationConfig {
+	return NotificationConfig{
+		Ctx:                   ctx,
+		Id:                    obj.GetId(),
+		Name:                  obj.GetName(),
+		Type:                  obj.Type,
+		Frequency:             time.Duration(obj.Frequency),
+		SendReminder:          obj.SendReminder,
+		DisableResolveMessage: obj.DisableResolveMessage,
+		Settings:              obj.Settings,
+	}
+}
+
 func (n *notificationService) getNeededNotifiers(nIds []string, evalCtx *EvalContext) (notifierStateSlice, bool, error) {
 	notis, err := models.NotificationManager.GetNotificationsWithDefault(nIds)
 	if err != nil {
@@ -107,17 +135,9 @@ func (n *notificationService) getNeededNotifiers(nIds []string, evalCtx *EvalCon
 
 	var result notifierStateSlice
 	shouldNotify := false
-	for _, obj := range notis {
-		not, err := InitNotifier(NotificationConfig{
-			Ctx:                   evalCtx.Ctx,
-			Id:                    obj.GetId(),
-			Name:                  obj.GetName(),
-			Type:                  obj.Type,
-			Frequency:             time.Duration(obj.Frequency),
-			SendReminder:          obj.SendReminder,
-			DisableResolveMessage: obj.DisableResolveMessage,
-			Settings:              obj.Settings,
-		})
+	for i := range notis {
+		obj := &notis[i]
+		not, err := InitNotifier(newNotificationConfig(evalCtx.Ctx, obj))
 		if err != nil {
 			log.Errorf("Could not create notifier %s, error: %v", obj.GetId(), err)
 			continue
@@ -139,8 +159,9 @@ func (n *notificationService) getNeededNotifiers(nIds []string, evalCtx *EvalCon
 		if not.ShouldNotify(evalCtx.Ctx, evalCtx, state) {
 			shouldNotify = true
 			result = append(result, &notifierState{
-				notifier: not,
-				state:    state,
+				notifier:     not,
+				state:        state,
+				notification: obj,
 			})
 		}
 	}
@@ -190,7 +211,9 @@ func (n *notificationService) createAlertRecordWhenNotify(evalCtx *EvalContext,
 		EvalData:  matches,
 		AlertRule: evalCtx.Rule.RuleDescription,
 	}
-	if !shouldNotify {
+	if evalCtx.Silenced {
+		recordCreateInput.SendState = monitor.SEND_STATE_MUTED
+	} else if !shouldNotify {
 		recordCreateInput.SendState = monitor.SEND_STATE_SILENT
 	}
 	recordCreateInput.ResType = recordCreateInput.AlertRule[0].ResType
@@ -61,12 +61,13 @@ func newAutoMigratingNotifier(conf alerting.NotificationConfig) (alerting.Notifi
 }
 
 func (am *autoMigrationNotifier) getBalancerRules(ctx *alerting.EvalContext, alert *models.SMigrationAlert) (*balancer.Rules, error) {
-	if len(ctx.EvalMatches) >= 1 {
+	matches := ctx.GetUnsilencedEvalMatches()
+	if len(matches) >= 1 {
 		log.Warningf("EvalMatches great than 1, use first one")
 	} else {
-		return nil, errors.Errorf("Matches not >= 1 %d", len(ctx.EvalMatches))
+		return nil, errors.Errorf("Matches not >= 1 %d", len(matches))
 	}
-	match := ctx.EvalMatches[0]
+	match := matches[0]
 	drv, err := balancer.GetMetricDrivers().Get(alert.GetMetricType())
 	if err != nil {
 		return nil, errors.Wrap(err, "Get metric driver")
@@ -80,6 +81,10 @@ func (am *autoMigrationNotifier) Notify(ctx *alerting.EvalContext, data jsonutil
 		// do nothing
 		return nil
 	}
+	if len(ctx.GetUnsilencedEvalMatches()) == 0 {
+		// all matches are silenced
+		return nil
+	}
 
 	alertId := ctx.Rule.Id
 	man := models.GetMigrationAlertManager()
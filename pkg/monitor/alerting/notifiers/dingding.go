@@ -89,8 +89,8 @@ func newDingdingNotifier(config alerting.NotificationConfig) (alerting.Notifier,
 func (dd *DingDingNotifier) Notify(evalCtx *alerting.EvalContext, d jsonutils.JSONObject) error {
 	log.Infof("Sending alert notification to dingding")
 	errs := []error{}
-	if len(evalCtx.EvalMatches) > 0 {
-		if err := dd.notify(evalCtx, evalCtx.EvalMatches, false, d); err != nil {
+	if matches := evalCtx.GetUnsilencedEvalMatches(); len(matches) > 0 {
+		if err := dd.notify(evalCtx, matches, false, d); err != nil {
 			errs = append(errs, errors.Wrap(err, "notify alerting matches"))
 		}
 	}
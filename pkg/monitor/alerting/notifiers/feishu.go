@@ -87,6 +87,9 @@ func newFeishuNotifier(config alerting.NotificationConfig) (alerting.Notifier, e
 }
 
 func (fs *FeishuNotifier) Notify(ctx *alerting.EvalContext, _ jsonutils.JSONObject) error {
+	if len(ctx.GetUnsilencedEvalMatches()) == 0 {
+		return nil
+	}
 	log.Infof("Sending alert notification to feishu")
 	errGrp := errgroup.Group{}
 	for _, cId := range fs.ChatIds {
@@ -164,7 +167,7 @@ func (fs *FeishuNotifier) getMetricsMod(config monitor.NotificationTemplateConfi
 }
 
 func (fs *FeishuNotifier) genCard(ctx *alerting.EvalContext, chatId string) (*feishu.MsgReq, error) {
-	config := GetNotifyTemplateConfig(ctx, false, ctx.EvalMatches)
+	config := GetNotifyTemplateConfig(ctx, false, ctx.GetUnsilencedEvalMatches())
 	commonElem := fs.getCommonInfoMod(config)
 
 	msElems := fs.getMetricsMod(config)
@@ -193,7 +196,7 @@ func (fs *FeishuNotifier) genCard(ctx *alerting.EvalContext, chatId string) (*fe
 }
 
 func (fs *FeishuNotifier) genMsg(ctx *alerting.EvalContext, chatId string) (*feishu.MsgReq, error) {
-	config := GetNotifyTemplateConfig(ctx, false, ctx.EvalMatches)
+	config := GetNotifyTemplateConfig(ctx, false, ctx.GetUnsilencedEvalMatches())
 	// 富文本: https://open.feishu.cn/document/ukTMukTMukTM/uMDMxEjLzATMx4yMwETM
 	return &feishu.MsgReq{
 		ChatId:  chatId,
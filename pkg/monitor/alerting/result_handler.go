@@ -80,6 +80,9 @@ func (handler *defaultResultHandler) handle(evalCtx *EvalContext) error {
 	if evalCtx.Error != nil {
 		return evalCtx.Error
 	}
+	if !evalCtx.IsTestRun {
+		silenceEvalMatches(evalCtx)
+	}
 	if err := handler.notifier.SendIfNeeded(evalCtx); err != nil {
 		return err
 	}
@@ -0,0 +1,118 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerting
+
+import (
+	"time"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/monitor/models"
+)
+
+// evalMatchLabels returns the labels silences and notification groups are
+// matched against: the tags of the eval match plus the attributes of the
+// alert rule. match may be nil to get the labels of the alert itself.
+func evalMatchLabels(evalCtx *EvalContext, match *monitor.EvalMatch) map[string]string {
+	labels := make(map[string]string)
+	if match != nil {
+		for k, v := range match.Tags {
+			labels[k] = v
+		}
+		labels[monitor.ALERT_SILENCE_LABEL_METRIC] = match.Metric
+		if tenant, ok := match.Tags["tenant"]; ok {
+			labels[monitor.ALERT_SILENCE_LABEL_PROJECT] = tenant
+		}
+		if tenantId, ok := match.Tags["tenant_id"]; ok {
+			labels[monitor.ALERT_SILENCE_LABEL_PROJECT_ID] = tenantId
+		}
+	}
+	labels[monitor.ALERT_SILENCE_LABEL_ALERT_ID] = evalCtx.Rule.Id
+	labels[monitor.ALERT_SILENCE_LABEL_ALERT_NAME] = evalCtx.Rule.Name
+	labels[monitor.ALERT_SILENCE_LABEL_LEVEL] = evalCtx.Rule.Level
+	if len(evalCtx.Rule.RuleDescription) > 0 {
+		labels[monitor.ALERT_SILENCE_LABEL_RES_TYPE] = evalCtx.Rule.RuleDescription[0].ResType
+	}
+	return labels
+}
+
+func findSilence(silences []models.SAlertSilence, labels map[string]string) *models.SAlertSilence {
+	for i := range silences {
+		if silences[i].Match(labels) {
+			return &silences[i]
+		}
+	}
+	return nil
+}
+
+// applySilences tags the eval matches covered by the silences, so that they
+// are recorded but not notified, and returns the number of matches suppressed
+// by each silence. The context is marked as silenced when nothing is left to
+// notify.
+func applySilences(evalCtx *EvalContext, silences []models.SAlertSilence) map[string]int {
+	suppressed := make(map[string]int)
+	if len(silences) == 0 {
+		return suppressed
+	}
+	matches := evalCtx.EvalMatches
+	if !evalCtx.Firing {
+		matches = evalCtx.AlertOkEvalMatches
+	}
+	if len(matches) == 0 {
+		if silence := findSilence(silences, evalMatchLabels(evalCtx, nil)); silence != nil {
+			evalCtx.Silenced = true
+			suppressed[silence.Id] += 1
+		}
+		return suppressed
+	}
+	silencedCnt := 0
+	for _, match := range matches {
+		silence := findSilence(silences, evalMatchLabels(evalCtx, match))
+		if silence == nil {
+			continue
+		}
+		if match.Tags == nil {
+			match.Tags = make(map[string]string)
+		}
+		match.Tags[monitor.ALERT_SILENCE_ID_KEY] = silence.Id
+		suppressed[silence.Id] += 1
+		silencedCnt += 1
+	}
+	evalCtx.Silenced = silencedCnt == len(matches)
+	return suppressed
+}
+
+// silenceEvalMatches applies the silences in effect to the result of an
+// evaluation. Failing to fetch the silences never blocks the notification.
+func silenceEvalMatches(evalCtx *EvalContext) {
+	now := time.Now()
+	silences, err := models.AlertSilenceManager.GetActiveSilences(now)
+	if err != nil {
+		log.Errorf("get active alert silences: %v", err)
+		return
+	}
+	suppressed := applySilences(evalCtx, silences)
+	for i := range silences {
+		cnt, ok := suppressed[silences[i].Id]
+		if !ok {
+			continue
+		}
+		if err := silences[i].RecordSuppressed(cnt, now); err != nil {
+			log.Errorf("record suppressed of silence %s: %v", silences[i].Name, err)
+		}
+		log.Infof("alert %s: %d matches suppressed by silence %s", evalCtx.Rule.Name, cnt, silences[i].Name)
+	}
+}
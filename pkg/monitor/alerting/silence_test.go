@@ -0,0 +1,82 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/monitor/models"
+)
+
+func newTestSilence(id string, matchers ...monitor.AlertSilenceMatcher) models.SAlertSilence {
+	silence := models.SAlertSilence{}
+	silence.Id = id
+	silence.Matchers = jsonutils.Marshal(matchers)
+	return silence
+}
+
+func TestApplySilences(t *testing.T) {
+	newCtx := func() *EvalContext {
+		ctx := NewEvalContext(context.TODO(), nil, &Rule{
+			Id:              "alert1",
+			Name:            "cpu",
+			Level:           "important",
+			RuleDescription: []*monitor.AlertRecordRule{{ResType: monitor.METRIC_RES_TYPE_GUEST}},
+		})
+		ctx.Firing = true
+		ctx.EvalMatches = []*monitor.EvalMatch{
+			{Metric: "vm_cpu.usage_active", Tags: map[string]string{"vm_name": "web-01", "tenant_id": "p1"}},
+			{Metric: "vm_cpu.usage_active", Tags: map[string]string{"vm_name": "db-01", "tenant_id": "p1"}},
+		}
+		return ctx
+	}
+
+	ctx := newCtx()
+	silences := []models.SAlertSilence{
+		newTestSilence("s1", monitor.AlertSilenceMatcher{Label: "vm_name", Operator: "=", Value: "web-01"}),
+	}
+	suppressed := applySilences(ctx, silences)
+	assert.Equal(t, map[string]int{"s1": 1}, suppressed)
+	assert.False(t, ctx.Silenced)
+	assert.Equal(t, "s1", ctx.EvalMatches[0].Tags[monitor.ALERT_SILENCE_ID_KEY])
+	assert.Equal(t, 1, len(ctx.GetUnsilencedEvalMatches()))
+	assert.Equal(t, "db-01", ctx.GetUnsilencedEvalMatches()[0].Tags["vm_name"])
+
+	ctx = newCtx()
+	silences = []models.SAlertSilence{
+		newTestSilence("s2",
+			monitor.AlertSilenceMatcher{Label: monitor.ALERT_SILENCE_LABEL_RES_TYPE, Operator: "=", Value: monitor.METRIC_RES_TYPE_GUEST},
+			monitor.AlertSilenceMatcher{Label: monitor.ALERT_SILENCE_LABEL_PROJECT_ID, Operator: "=", Value: "p1"},
+		),
+	}
+	suppressed = applySilences(ctx, silences)
+	assert.Equal(t, map[string]int{"s2": 2}, suppressed)
+	assert.True(t, ctx.Silenced)
+	assert.Equal(t, 0, len(ctx.GetUnsilencedEvalMatches()))
+
+	ctx = newCtx()
+	ctx.EvalMatches = nil
+	silences = []models.SAlertSilence{
+		newTestSilence("s3", monitor.AlertSilenceMatcher{Label: monitor.ALERT_SILENCE_LABEL_ALERT_NAME, Operator: "=~", Value: "cp.*"}),
+	}
+	applySilences(ctx, silences)
+	assert.True(t, ctx.Silenced)
+}
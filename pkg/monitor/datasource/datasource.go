@@ -141,15 +141,19 @@ func (man *dataSourceManager) initDefaultDataSource(ctx context.Context) error {
 	region := options.Options.Region
 	epType := options.Options.SessionEndpointType
 	s := auth.GetAdminSession(ctx, region)
-	//dsSvc := options.Options.MonitorDataSource
 	if s == nil {
 		return errors.Errorf("get empty public session for region %s", region)
 	}
-	source, err := commontsdb.GetDefaultServiceSource(s, epType)
-	if err != nil {
-		return errors.Wrap(err, "get default TSDB source")
+	// query only sources like prometheus are never the write target of
+	// metrics, so they have to be chosen explicitly
+	dsSvc := options.Options.MonitorDataSource
+	if len(dsSvc) == 0 {
+		source, err := commontsdb.GetDefaultServiceSource(s, epType)
+		if err != nil {
+			return errors.Wrap(err, "get default TSDB source")
+		}
+		dsSvc = source.Type
 	}
-	dsSvc := source.Type
 	if err := tsdb.IsValidDataSource(dsSvc); err != nil {
 		return errors.Wrapf(err, "invalid type %q", dsSvc)
 	}
@@ -0,0 +1,170 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/sqlchemy"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+var (
+	AlertEscalationManager *SAlertEscalationManager
+)
+
+// +onecloud:swagger-gen-ignore
+type SAlertEscalationManager struct {
+	db.SStandaloneAnonResourceBaseManager
+}
+
+func init() {
+	AlertEscalationManager = &SAlertEscalationManager{
+		SStandaloneAnonResourceBaseManager: db.NewStandaloneAnonResourceBaseManager(
+			SAlertEscalation{},
+			"alertescalation_tbl",
+			"alertescalation",
+			"alertescalations",
+		),
+	}
+	AlertEscalationManager.SetVirtualObject(AlertEscalationManager)
+}
+
+// SAlertEscalation is a step of an escalation chain: when the alert is still
+// not acknowledged at escalate_at, notification_id is notified.
+// +onecloud:swagger-gen-ignore
+type SAlertEscalation struct {
+	db.SStandaloneAnonResourceBase
+
+	AlertId string `width:"36" charset:"ascii" nullable:"false" list:"user" index:"true"`
+	// the notification whose escalation policy started this step
+	SourceNotificationId string `width:"36" charset:"ascii" nullable:"false" list:"user"`
+	// the notification to send when escalating
+	NotificationId string    `width:"36" charset:"ascii" nullable:"false" list:"user"`
+	Step           int       `nullable:"false" default:"1" list:"user"`
+	EscalateAt     time.Time `nullable:"false" list:"user"`
+	State          string    `width:"16" charset:"ascii" nullable:"false" default:"pending" list:"user"`
+}
+
+func (man *SAlertEscalationManager) getPendingQuery(alertId string) *sqlchemy.SQuery {
+	q := man.Query().Equals("state", monitor.ALERT_ESCALATION_STATE_PENDING)
+	if len(alertId) > 0 {
+		q = q.Equals("alert_id", alertId)
+	}
+	return q
+}
+
+// IsAlertAcked tells whether the alert has been acknowledged since it
+// entered its current state
+func (man *SAlertEscalationManager) IsAlertAcked(alertId string) (bool, error) {
+	alert, err := CommonAlertManager.GetAlert(alertId)
+	if err != nil {
+		return false, errors.Wrapf(err, "get alert %s", alertId)
+	}
+	record, err := AlertRecordManager.GetLatestAckedRecord(alertId)
+	if err != nil {
+		return false, err
+	}
+	return record != nil && record.IsAckedSince(alert.LastStateChange), nil
+}
+
+// StartEscalation schedules the escalation policy of the notification for
+// the alert, unless one is already pending or the alert is acknowledged
+func (man *SAlertEscalationManager) StartEscalation(ctx context.Context, alertId string, noti *SNotification, step int) error {
+	if len(noti.EscalationNotificationId) == 0 || noti.EscalationAfter <= 0 {
+		return nil
+	}
+	if step > monitor.NOTIFICATION_ESCALATION_MAX_STEPS {
+		return nil
+	}
+	acked, err := man.IsAlertAcked(alertId)
+	if err != nil {
+		return errors.Wrap(err, "check alert ack")
+	}
+	if acked {
+		return nil
+	}
+	cnt, err := man.getPendingQuery(alertId).Equals("source_notification_id", noti.Id).CountWithError()
+	if err != nil {
+		return errors.Wrap(err, "count pending escalations")
+	}
+	if cnt > 0 {
+		return nil
+	}
+	escalation := &SAlertEscalation{
+		AlertId:              alertId,
+		SourceNotificationId: noti.Id,
+		NotificationId:       noti.EscalationNotificationId,
+		Step:                 step,
+		EscalateAt:           time.Now().Add(time.Duration(noti.EscalationAfter) * time.Second),
+		State:                monitor.ALERT_ESCALATION_STATE_PENDING,
+	}
+	escalation.SetModelManager(man, escalation)
+	if err := man.TableSpec().Insert(ctx, escalation); err != nil {
+		return errors.Wrap(err, "insert escalation")
+	}
+	return nil
+}
+
+// GetDueEscalations returns the pending escalations to fire at now
+func (man *SAlertEscalationManager) GetDueEscalations(now time.Time) ([]SAlertEscalation, error) {
+	q := man.getPendingQuery("").LE("escalate_at", now).Asc("escalate_at")
+	ret := make([]SAlertEscalation, 0)
+	if err := db.FetchModelObjects(man, q, &ret); err != nil {
+		return nil, errors.Wrap(err, "fetch due escalations")
+	}
+	return ret, nil
+}
+
+// AckAlert stops the pending escalations of the alert
+func (man *SAlertEscalationManager) AckAlert(ctx context.Context, userCred mcclient.TokenCredential, alertId string) error {
+	escalations := make([]SAlertEscalation, 0)
+	if err := db.FetchModelObjects(man, man.getPendingQuery(alertId), &escalations); err != nil {
+		return errors.Wrap(err, "fetch pending escalations")
+	}
+	for i := range escalations {
+		if err := escalations[i].SetState(monitor.ALERT_ESCALATION_STATE_ACKED); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (escalation *SAlertEscalation) SetState(state string) error {
+	_, err := db.Update(escalation, func() error {
+		escalation.State = state
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "set escalation %s state %s", escalation.Id, state)
+	}
+	return nil
+}
+
+// GetNotification returns the notification to send when escalating
+func (escalation *SAlertEscalation) GetNotification() (*SNotification, error) {
+	return NotificationManager.GetNotification(escalation.NotificationId)
+}
+
+// IsAckedBy tells whether the record acknowledged the alerting period of
+// the alert which started at since, so the escalation must not fire
+func (escalation *SAlertEscalation) IsAckedBy(record *SAlertRecord, since time.Time) bool {
+	return record != nil && record.AlertId == escalation.AlertId && record.IsAckedSince(since)
+}
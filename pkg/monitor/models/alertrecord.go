@@ -62,6 +62,10 @@ type SAlertRecord struct {
 	AlertRule jsonutils.JSONObject `list:"user" update:"user" length:"medium"`
 	ResType   string               `width:"36" list:"user" update:"user"`
 	ResIds    string               `length:"medium" list:"user"`
+
+	// who acknowledged the alert, escalation stops once acknowledged
+	AckedBy string    `width:"128" charset:"utf8" nullable:"true" list:"user"`
+	AckedAt time.Time `nullable:"true" list:"user"`
 }
 
 func init() {
@@ -141,6 +145,13 @@ func (manager *SAlertRecordManager) ListItemFilter(
 	if len(query.ResId) != 0 {
 		q.Filter(sqlchemy.ContainsAny(q.Field("res_ids"), []string{query.ResId}))
 	}
+	if query.Acked != nil {
+		if *query.Acked {
+			q = q.IsNotNull("acked_at")
+		} else {
+			q = q.IsNull("acked_at")
+		}
+	}
 	if len(query.Filter) != 0 {
 		for i, _ := range query.Filter {
 			if strings.Contains(query.Filter[i], "trigger_time") {
@@ -207,6 +218,35 @@ func (man *SAlertRecordManager) GetAlertRecord(id string) (*SAlertRecord, error)
 	return obj.(*SAlertRecord), nil
 }
 
+// GetLatestAlertRecord returns the latest record of the alert, nil if none
+func (man *SAlertRecordManager) GetLatestAlertRecord(alertId string) (*SAlertRecord, error) {
+	record := new(SAlertRecord)
+	q := man.Query().Equals("alert_id", alertId).Desc("created_at")
+	if err := q.First(record); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "get latest record of alert %s", alertId)
+	}
+	record.SetModelManager(man, record)
+	return record, nil
+}
+
+// GetLatestAckedRecord returns the record of the alert acknowledged last,
+// nil if no record of the alert has been acknowledged
+func (man *SAlertRecordManager) GetLatestAckedRecord(alertId string) (*SAlertRecord, error) {
+	record := new(SAlertRecord)
+	q := man.Query().Equals("alert_id", alertId).IsNotNull("acked_at").Desc("acked_at")
+	if err := q.First(record); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "get latest acked record of alert %s", alertId)
+	}
+	record.SetModelManager(man, record)
+	return record, nil
+}
+
 func (man *SAlertRecordManager) GetAlertRecordsByAlertId(id string) ([]SAlertRecord, error) {
 	records := make([]SAlertRecord, 0)
 	query := man.Query()
@@ -418,6 +458,42 @@ func (record *SAlertRecord) GetState() monitor.AlertStateType {
 	return monitor.AlertStateType(record.State)
 }
 
+func (record *SAlertRecord) IsAcked() bool {
+	return !record.AckedAt.IsZero()
+}
+
+// IsAckedSince tells whether the record was acknowledged at or after since,
+// an ack of a former alerting period does not hold for the current one
+func (record *SAlertRecord) IsAckedSince(since time.Time) bool {
+	return record.IsAcked() && !record.AckedAt.Before(since)
+}
+
+// PerformAck acknowledges the current alerting period of the alert of the
+// record: the pending escalations are stopped, and no further escalation is
+// started until the alert changes state again
+func (record *SAlertRecord) PerformAck(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input monitor.AlertRecordAckInput,
+) (jsonutils.JSONObject, error) {
+	if record.IsAcked() {
+		return nil, nil
+	}
+	_, err := db.Update(record, func() error {
+		record.AckedBy = userCred.GetUserName()
+		record.AckedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "update acked_at")
+	}
+	if err := AlertEscalationManager.AckAlert(ctx, userCred, record.AlertId); err != nil {
+		return nil, errors.Wrap(err, "ack alert escalations")
+	}
+	return nil, nil
+}
+
 func (manager *SAlertRecordManager) DeleteRecordsOfThirtyDaysAgo(ctx context.Context, userCred mcclient.TokenCredential,
 	isStart bool) {
 	records := make([]SAlertRecord, 0)
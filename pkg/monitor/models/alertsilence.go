@@ -0,0 +1,487 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/stringutils2"
+	"yunion.io/x/onecloud/pkg/util/timeutils2"
+)
+
+var (
+	AlertSilenceManager *SAlertSilenceManager
+)
+
+// +onecloud:swagger-gen-model-singular=alertsilence
+// +onecloud:swagger-gen-model-plural=alertsilences
+type SAlertSilenceManager struct {
+	db.SEnabledResourceBaseManager
+	db.SStatusStandaloneResourceBaseManager
+	SMonitorScopedResourceManager
+}
+
+func init() {
+	AlertSilenceManager = &SAlertSilenceManager{
+		SStatusStandaloneResourceBaseManager: db.NewStatusStandaloneResourceBaseManager(
+			SAlertSilence{},
+			"alertsilence_tbl",
+			"alertsilence",
+			"alertsilences",
+		),
+	}
+	AlertSilenceManager.SetVirtualObject(AlertSilenceManager)
+}
+
+// SAlertSilence suppresses the notifications of the eval matches selected
+// by its matchers, either during [start_time, end_time) or, when recurrence
+// is set, during the maintenance windows starting at each cron occurrence.
+type SAlertSilence struct {
+	db.SEnabledResourceBase
+	db.SStatusStandaloneResourceBase
+	SMonitorScopedResource
+
+	AlertId  string               `width:"36" charset:"ascii" nullable:"true" list:"user" create:"optional" update:"user" json:"alert_id"`
+	Matchers jsonutils.JSONObject `nullable:"true" list:"user" create:"optional" update:"user" json:"matchers"`
+
+	StartTime time.Time `nullable:"false" list:"user" create:"optional" update:"user" json:"start_time"`
+	EndTime   time.Time `nullable:"true" list:"user" create:"optional" update:"user" json:"end_time"`
+
+	Recurrence string `width:"64" charset:"ascii" nullable:"true" list:"user" create:"optional" update:"user" json:"recurrence"`
+	// seconds
+	Duration int    `nullable:"false" default:"0" list:"user" create:"optional" update:"user" json:"duration"`
+	Timezone string `width:"64" charset:"ascii" nullable:"true" list:"user" create:"optional" update:"user" json:"timezone"`
+
+	// how many eval matches have been suppressed
+	SuppressedCount  int       `nullable:"false" default:"0" list:"user" json:"suppressed_count"`
+	LastSuppressedAt time.Time `nullable:"true" list:"user" json:"last_suppressed_at"`
+}
+
+type sAlertSilenceSchedule struct {
+	StartTime  time.Time
+	EndTime    time.Time
+	Recurrence string
+	Duration   int
+	Timezone   string
+}
+
+func validateAlertSilenceSchedule(s sAlertSilenceSchedule) error {
+	if !s.EndTime.IsZero() && !s.EndTime.After(s.StartTime) {
+		return httperrors.NewInputParameterError("end_time is not after start_time")
+	}
+	if len(s.Timezone) > 0 {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return httperrors.NewInputParameterError("invalid timezone %q: %v", s.Timezone, err)
+		}
+	}
+	if len(s.Recurrence) == 0 {
+		return nil
+	}
+	if _, err := timeutils2.ParseCronExpr(s.Recurrence); err != nil {
+		return httperrors.NewInputParameterError("invalid recurrence: %v", err)
+	}
+	if s.Duration <= 0 || s.Duration > monitor.ALERT_SILENCE_MAX_DURATION {
+		return httperrors.NewInputParameterError("duration of recurrence should be between 1 and %d seconds", monitor.ALERT_SILENCE_MAX_DURATION)
+	}
+	return nil
+}
+
+func validateAlertSilenceMatchers(matchers []monitor.AlertSilenceMatcher) ([]monitor.AlertSilenceMatcher, error) {
+	for i := range matchers {
+		m := &matchers[i]
+		if len(m.Label) == 0 {
+			return nil, httperrors.NewInputParameterError("label of matcher %d is empty", i)
+		}
+		if len(m.Operator) == 0 {
+			m.Operator = monitor.ALERT_SILENCE_MATCH_EQUAL
+		}
+		if !utils.IsInStringArray(m.Operator, monitor.ALERT_SILENCE_MATCH_OPERATORS) {
+			return nil, httperrors.NewInputParameterError("invalid operator %q of matcher %s, should be one of %v", m.Operator, m.Label, monitor.ALERT_SILENCE_MATCH_OPERATORS)
+		}
+		if m.Operator == monitor.ALERT_SILENCE_MATCH_REGEX || m.Operator == monitor.ALERT_SILENCE_MATCH_NOT_REGEX {
+			if _, err := regexp.Compile(anchorRegex(m.Value)); err != nil {
+				return nil, httperrors.NewInputParameterError("invalid regex %q of matcher %s: %v", m.Value, m.Label, err)
+			}
+		}
+	}
+	return matchers, nil
+}
+
+// anchorRegex makes the regex of a matcher match the whole label value
+func anchorRegex(val string) string {
+	return "^(?:" + val + ")$"
+}
+
+func (man *SAlertSilenceManager) fetchAlertId(ctx context.Context, userCred mcclient.TokenCredential, alertId string) (string, error) {
+	alert, err := db.FetchByIdOrName(ctx, CommonAlertManager, userCred, alertId)
+	if err != nil {
+		if errors.Cause(err) == errors.ErrNotFound {
+			return "", httperrors.NewResourceNotFoundError2(CommonAlertManager.Keyword(), alertId)
+		}
+		return "", errors.Wrapf(err, "fetch alert %s", alertId)
+	}
+	return alert.GetId(), nil
+}
+
+func (man *SAlertSilenceManager) ValidateCreateData(
+	ctx context.Context, userCred mcclient.TokenCredential,
+	ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject,
+	input monitor.AlertSilenceCreateInput,
+) (monitor.AlertSilenceCreateInput, error) {
+	var err error
+	input.ScopedResourceCreateInput, err = man.SScopedResourceBaseManager.ValidateCreateData(man, ctx, userCred, ownerId, query, input.ScopedResourceCreateInput)
+	if err != nil {
+		return input, err
+	}
+	if len(input.AlertId) > 0 {
+		input.AlertId, err = man.fetchAlertId(ctx, userCred, input.AlertId)
+		if err != nil {
+			return input, err
+		}
+	}
+	input.Matchers, err = validateAlertSilenceMatchers(input.Matchers)
+	if err != nil {
+		return input, err
+	}
+	if len(input.AlertId) == 0 && len(input.Matchers) == 0 {
+		return input, httperrors.NewMissingParameterError("alert_id or matchers")
+	}
+	if input.StartTime.IsZero() {
+		input.StartTime = time.Now().UTC()
+	}
+	if err := validateAlertSilenceSchedule(sAlertSilenceSchedule{
+		StartTime:  input.StartTime,
+		EndTime:    input.EndTime,
+		Recurrence: input.Recurrence,
+		Duration:   input.Duration,
+		Timezone:   input.Timezone,
+	}); err != nil {
+		return input, err
+	}
+	if input.Enabled == nil {
+		input.SetEnabled()
+	}
+	if len(input.Name) == 0 && len(input.GenerateName) == 0 {
+		input.GenerateName = "silence"
+	}
+	return input, nil
+}
+
+func (silence *SAlertSilence) ValidateUpdateData(
+	ctx context.Context, userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject, input monitor.AlertSilenceUpdateInput,
+) (monitor.AlertSilenceUpdateInput, error) {
+	var err error
+	input.StatusStandaloneResourceBaseUpdateInput, err = silence.SStatusStandaloneResourceBase.ValidateUpdateData(ctx, userCred, query, input.StatusStandaloneResourceBaseUpdateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SStatusStandaloneResourceBase.ValidateUpdateData")
+	}
+	if input.AlertId != nil && len(*input.AlertId) > 0 {
+		alertId, err := AlertSilenceManager.fetchAlertId(ctx, userCred, *input.AlertId)
+		if err != nil {
+			return input, err
+		}
+		input.AlertId = &alertId
+	}
+	if input.Matchers != nil {
+		input.Matchers, err = validateAlertSilenceMatchers(input.Matchers)
+		if err != nil {
+			return input, err
+		}
+	}
+	schedule := sAlertSilenceSchedule{
+		StartTime:  silence.StartTime,
+		EndTime:    silence.EndTime,
+		Recurrence: silence.Recurrence,
+		Duration:   silence.Duration,
+		Timezone:   silence.Timezone,
+	}
+	if input.StartTime != nil {
+		schedule.StartTime = *input.StartTime
+	}
+	if input.EndTime != nil {
+		schedule.EndTime = *input.EndTime
+	}
+	if input.Recurrence != nil {
+		schedule.Recurrence = *input.Recurrence
+	}
+	if input.Duration != nil {
+		schedule.Duration = *input.Duration
+	}
+	if input.Timezone != nil {
+		schedule.Timezone = *input.Timezone
+	}
+	if err := validateAlertSilenceSchedule(schedule); err != nil {
+		return input, err
+	}
+	return input, nil
+}
+
+func (silence *SAlertSilence) CustomizeCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) error {
+	return silence.SMonitorScopedResource.CustomizeCreate(ctx, userCred, ownerId, query, data)
+}
+
+func (silence *SAlertSilence) PostCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) {
+	silence.SetStatus(ctx, userCred, monitor.ALERT_STATUS_READY, "")
+}
+
+func (man *SAlertSilenceManager) ListItemFilter(
+	ctx context.Context, q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query monitor.AlertSilenceListInput,
+) (*sqlchemy.SQuery, error) {
+	var err error
+	q, err = man.SStatusStandaloneResourceBaseManager.ListItemFilter(ctx, q, userCred, query.StatusStandaloneResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SStatusStandaloneResourceBaseManager.ListItemFilter")
+	}
+	q, err = man.SEnabledResourceBaseManager.ListItemFilter(ctx, q, userCred, query.EnabledResourceBaseListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SEnabledResourceBaseManager.ListItemFilter")
+	}
+	q, err = man.SScopedResourceBaseManager.ListItemFilter(ctx, q, userCred, query.ScopedResourceBaseListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SScopedResourceBaseManager.ListItemFilter")
+	}
+	if len(query.AlertId) > 0 {
+		q = q.Equals("alert_id", query.AlertId)
+	}
+	if query.Active != nil {
+		now := time.Now()
+		ids := make([]string, 0)
+		silences, err := man.getEffectiveSilences(man.Query(), now)
+		if err != nil {
+			return nil, err
+		}
+		for i := range silences {
+			if silences[i].IsActive(now) {
+				ids = append(ids, silences[i].Id)
+			}
+		}
+		if *query.Active {
+			q = q.In("id", ids)
+		} else {
+			q = q.NotIn("id", ids)
+		}
+	}
+	return q, nil
+}
+
+func (man *SAlertSilenceManager) OrderByExtraFields(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	input monitor.AlertSilenceListInput,
+) (*sqlchemy.SQuery, error) {
+	var err error
+	q, err = man.SStatusStandaloneResourceBaseManager.OrderByExtraFields(ctx, q, userCred, input.StatusStandaloneResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SStatusStandaloneResourceBaseManager.OrderByExtraFields")
+	}
+	q, err = man.SScopedResourceBaseManager.OrderByExtraFields(ctx, q, userCred, input.ScopedResourceBaseListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SScopedResourceBaseManager.OrderByExtraFields")
+	}
+	return q, nil
+}
+
+func (man *SAlertSilenceManager) ListItemExportKeys(ctx context.Context, q *sqlchemy.SQuery, userCred mcclient.TokenCredential, keys stringutils2.SSortedStrings) (*sqlchemy.SQuery, error) {
+	q, err := man.SStatusStandaloneResourceBaseManager.ListItemExportKeys(ctx, q, userCred, keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "SStatusStandaloneResourceBaseManager.ListItemExportKeys")
+	}
+	q, err = man.SScopedResourceBaseManager.ListItemExportKeys(ctx, q, userCred, keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "SScopedResourceBaseManager.ListItemExportKeys")
+	}
+	return q, nil
+}
+
+func (man *SAlertSilenceManager) FetchCustomizeColumns(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	objs []interface{},
+	fields stringutils2.SSortedStrings,
+	isList bool,
+) []monitor.AlertSilenceDetails {
+	rows := make([]monitor.AlertSilenceDetails, len(objs))
+	stdRows := man.SStatusStandaloneResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+	scopedRows := man.SScopedResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+	alertIds := make([]string, 0)
+	for i := range objs {
+		if alertId := objs[i].(*SAlertSilence).AlertId; len(alertId) > 0 {
+			alertIds = append(alertIds, alertId)
+		}
+	}
+	alerts := make(map[string]SCommonAlert)
+	if len(alertIds) > 0 {
+		if err := db.FetchModelObjectsByIds(CommonAlertManager, "id", alertIds, &alerts); err != nil {
+			log.Errorf("FetchModelObjectsByIds alerts: %v", err)
+		}
+	}
+	now := time.Now()
+	for i := range rows {
+		silence := objs[i].(*SAlertSilence)
+		rows[i] = monitor.AlertSilenceDetails{
+			StatusStandaloneResourceDetails: stdRows[i],
+			ScopedResourceBaseInfo:          scopedRows[i],
+			Active:                          silence.IsActive(now),
+			Expired:                         !silence.EndTime.IsZero() && !now.Before(silence.EndTime),
+		}
+		if alert, ok := alerts[silence.AlertId]; ok {
+			rows[i].AlertName = alert.Name
+		}
+	}
+	return rows
+}
+
+func (silence *SAlertSilence) GetMatchers() ([]monitor.AlertSilenceMatcher, error) {
+	ret := make([]monitor.AlertSilenceMatcher, 0)
+	if silence.Matchers == nil {
+		return ret, nil
+	}
+	if err := silence.Matchers.Unmarshal(&ret); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal matchers of silence %s", silence.Name)
+	}
+	return ret, nil
+}
+
+func (silence *SAlertSilence) getLocation() *time.Location {
+	if len(silence.Timezone) > 0 {
+		loc, err := time.LoadLocation(silence.Timezone)
+		if err == nil {
+			return loc
+		}
+		log.Warningf("silence %s invalid timezone %q: %v", silence.Name, silence.Timezone, err)
+	}
+	return time.Local
+}
+
+// IsActive tells whether now falls in the silence, i.e. in
+// [start_time, end_time) and, when recurring, in one of the windows
+func (silence *SAlertSilence) IsActive(now time.Time) bool {
+	if !silence.GetEnabled() {
+		return false
+	}
+	if now.Before(silence.StartTime) {
+		return false
+	}
+	if !silence.EndTime.IsZero() && !now.Before(silence.EndTime) {
+		return false
+	}
+	if len(silence.Recurrence) == 0 {
+		return true
+	}
+	expr, err := timeutils2.ParseCronExpr(silence.Recurrence)
+	if err != nil {
+		log.Warningf("silence %s: %v", silence.Name, err)
+		return false
+	}
+	duration := time.Duration(silence.Duration) * time.Second
+	localNow := now.In(silence.getLocation())
+	windowStart, ok := expr.Prev(localNow, localNow.Add(-duration))
+	return ok && localNow.Before(windowStart.Add(duration))
+}
+
+func matchSilenceLabel(m monitor.AlertSilenceMatcher, labels map[string]string) bool {
+	val := labels[m.Label]
+	switch m.Operator {
+	case monitor.ALERT_SILENCE_MATCH_EQUAL:
+		return val == m.Value
+	case monitor.ALERT_SILENCE_MATCH_NOT_EQUAL:
+		return val != m.Value
+	case monitor.ALERT_SILENCE_MATCH_REGEX, monitor.ALERT_SILENCE_MATCH_NOT_REGEX:
+		re, err := regexp.Compile(anchorRegex(m.Value))
+		if err != nil {
+			return false
+		}
+		return re.MatchString(val) == (m.Operator == monitor.ALERT_SILENCE_MATCH_REGEX)
+	}
+	return false
+}
+
+// Match tells whether the labels of an eval match are selected by the
+// silence. Silences of a project or a domain only cover its own resources.
+func (silence *SAlertSilence) Match(labels map[string]string) bool {
+	if len(silence.AlertId) > 0 && labels[monitor.ALERT_SILENCE_LABEL_ALERT_ID] != silence.AlertId {
+		return false
+	}
+	if len(silence.ProjectId) > 0 {
+		if labels[monitor.ALERT_SILENCE_LABEL_PROJECT_ID] != silence.ProjectId {
+			return false
+		}
+	} else if len(silence.DomainId) > 0 && labels["domain_id"] != silence.DomainId {
+		return false
+	}
+	matchers, err := silence.GetMatchers()
+	if err != nil {
+		log.Errorf("silence %s: %v", silence.Name, err)
+		return false
+	}
+	for _, m := range matchers {
+		if !matchSilenceLabel(m, labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (man *SAlertSilenceManager) getEffectiveSilences(q *sqlchemy.SQuery, now time.Time) ([]SAlertSilence, error) {
+	q = q.IsTrue("enabled").LE("start_time", now)
+	q = q.Filter(sqlchemy.OR(sqlchemy.IsNull(q.Field("end_time")), sqlchemy.GT(q.Field("end_time"), now)))
+	silences := make([]SAlertSilence, 0)
+	if err := db.FetchModelObjects(man, q, &silences); err != nil {
+		return nil, errors.Wrap(err, "fetch silences")
+	}
+	return silences, nil
+}
+
+// GetActiveSilences returns the silences in effect at now
+func (man *SAlertSilenceManager) GetActiveSilences(now time.Time) ([]SAlertSilence, error) {
+	silences, err := man.getEffectiveSilences(man.Query(), now)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]SAlertSilence, 0, len(silences))
+	for i := range silences {
+		if silences[i].IsActive(now) {
+			ret = append(ret, silences[i])
+		}
+	}
+	return ret, nil
+}
+
+// RecordSuppressed keeps track of the eval matches suppressed by the silence
+func (silence *SAlertSilence) RecordSuppressed(count int, at time.Time) error {
+	_, err := db.Update(silence, func() error {
+		silence.SuppressedCount += count
+		silence.LastSuppressedAt = at
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/tristate"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+)
+
+func TestAlertSilenceIsActive(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	silence := &SAlertSilence{}
+	silence.Enabled = tristate.True
+	silence.StartTime = start
+	silence.EndTime = start.Add(30 * 24 * time.Hour)
+
+	if silence.IsActive(start.Add(-time.Minute)) {
+		t.Errorf("active before start_time")
+	}
+	if !silence.IsActive(start) {
+		t.Errorf("inactive at start_time")
+	}
+	if silence.IsActive(silence.EndTime) {
+		t.Errorf("active at end_time")
+	}
+
+	// every saturday 02:00 - 04:00 in Shanghai
+	silence.Recurrence = "0 2 * * 6"
+	silence.Duration = 2 * 3600
+	silence.Timezone = "Asia/Shanghai"
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	cases := []struct {
+		now  time.Time
+		want bool
+	}{
+		{time.Date(2024, 3, 2, 1, 59, 0, 0, loc), false},
+		{time.Date(2024, 3, 2, 2, 0, 0, 0, loc), true},
+		{time.Date(2024, 3, 2, 3, 59, 0, 0, loc), true},
+		{time.Date(2024, 3, 2, 4, 0, 0, 0, loc), false},
+		{time.Date(2024, 3, 3, 2, 30, 0, 0, loc), false},
+		{time.Date(2024, 3, 9, 2, 30, 0, 0, loc), true},
+	}
+	for _, c := range cases {
+		if got := silence.IsActive(c.now); got != c.want {
+			t.Errorf("IsActive(%s) = %v, want %v", c.now, got, c.want)
+		}
+	}
+
+	silence.Enabled = tristate.False
+	if silence.IsActive(time.Date(2024, 3, 2, 2, 30, 0, 0, loc)) {
+		t.Errorf("disabled silence is active")
+	}
+}
+
+func TestAlertSilenceMatch(t *testing.T) {
+	silence := &SAlertSilence{}
+	silence.ProjectId = "p1"
+	silence.Matchers = jsonutils.Marshal([]monitor.AlertSilenceMatcher{
+		{Label: "host", Operator: monitor.ALERT_SILENCE_MATCH_REGEX, Value: "web-.*"},
+		{Label: "level", Operator: monitor.ALERT_SILENCE_MATCH_NOT_EQUAL, Value: "fatal"},
+	})
+	cases := []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{
+			name:   "match",
+			labels: map[string]string{"host": "web-01", "level": "important", "project_id": "p1"},
+			want:   true,
+		},
+		{
+			name:   "regex is anchored",
+			labels: map[string]string{"host": "db-web-01", "level": "important", "project_id": "p1"},
+			want:   false,
+		},
+		{
+			name:   "not equal",
+			labels: map[string]string{"host": "web-01", "level": "fatal", "project_id": "p1"},
+			want:   false,
+		},
+		{
+			name:   "other project",
+			labels: map[string]string{"host": "web-01", "level": "important", "project_id": "p2"},
+			want:   false,
+		},
+	}
+	for _, c := range cases {
+		if got := silence.Match(c.labels); got != c.want {
+			t.Errorf("%s: Match = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	silence.AlertId = "alert1"
+	if silence.Match(map[string]string{"host": "web-01", "project_id": "p1", "alert_id": "alert2"}) {
+		t.Errorf("match silence of another alert")
+	}
+}
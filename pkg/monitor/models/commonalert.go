@@ -223,7 +223,7 @@ func (man *SCommonAlertManager) ValidateCreateData(
 			if query.ConditionType == monitor.METRIC_QUERY_TYPE_NO_DATA {
 				query.Comparator = "=="
 			}
-			if !utils.IsInStringArray(getQueryEvalType(query.Comparator), validators.EvaluatorDefaultTypes) {
+			if !isValidQueryEvalType(getQueryEvalType(query.Comparator)) {
 				return data, httperrors.NewInputParameterError("the Comparator is illegal: %s", query.Comparator)
 			}
 			if _, ok := monitor.AlertReduceFunc[query.Reduce]; !ok {
@@ -800,6 +800,8 @@ func getCommonAlertMetricDetailsFromCondition(
 		cmp = "=="
 	case "lt":
 		cmp = "<="
+	case "seasonal_baseline":
+		cmp = "seasonal_baseline"
 	}
 	metricDetails.Comparator = cmp
 
@@ -921,10 +923,19 @@ func getQueryEvalType(evalType string) string {
 		typ = "lt"
 	case "==":
 		typ = "eq"
+	case "seasonal_baseline":
+		typ = "seasonal_baseline"
 	}
 	return typ
 }
 
+// isValidQueryEvalType tells whether the evaluator type can be used by
+// common alerts, whose threshold is the only evaluator parameter
+func isValidQueryEvalType(typ string) bool {
+	return utils.IsInStringArray(typ, validators.EvaluatorDefaultTypes) ||
+		utils.IsInStringArray(typ, validators.EvaluatorBaselineTypes)
+}
+
 func (man *SCommonAlertManager) toAlertCreatInput(input monitor.CommonAlertCreateInput) (monitor.AlertCreateInput, error) {
 	freq, _ := time.ParseDuration(input.Period)
 	ret := new(monitor.AlertCreateInput)
@@ -1022,7 +1033,7 @@ func (alert *SCommonAlert) ValidateUpdateData(
 			if query.ConditionType == monitor.METRIC_QUERY_TYPE_NO_DATA {
 				query.Comparator = "=="
 			}
-			if !utils.IsInStringArray(getQueryEvalType(query.Comparator), validators.EvaluatorDefaultTypes) {
+			if !isValidQueryEvalType(getQueryEvalType(query.Comparator)) {
 				return data, httperrors.NewInputParameterError("the Comparator is illegal: %s", query.Comparator)
 			}
 			if _, ok := monitor.AlertReduceFunc[query.Reduce]; !ok {
@@ -1278,7 +1289,7 @@ func (alert *SCommonAlert) PerformConfig(ctx context.Context, userCred mcclient.
 		}
 	}
 	if len(comparator) != 0 {
-		if !utils.IsInStringArray(getQueryEvalType(comparator), validators.EvaluatorDefaultTypes) {
+		if !isValidQueryEvalType(getQueryEvalType(comparator)) {
 			return data, httperrors.NewInputParameterError("the Comparator is illegal: %s", comparator)
 		}
 	}
@@ -148,6 +148,9 @@ func (obj *SMonitorResourceAlert) UpdateAlertRecordData(input *UpdateMonitorReso
 	if _, ok := match.Tags[monitor.ALERT_RESOURCE_RECORD_SHIELD_KEY]; ok {
 		sendState = monitor.SEND_STATE_SHIELD
 	}
+	if _, ok := match.Tags[monitor.ALERT_SILENCE_ID_KEY]; ok {
+		sendState = monitor.SEND_STATE_MUTED
+	}
 	if _, err := db.Update(obj, func() error {
 		if input.AlertRecordId != "" {
 			obj.AlertRecordId = input.AlertRecordId
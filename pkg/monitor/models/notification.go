@@ -23,6 +23,7 @@ import (
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/sqlchemy"
 
+	"yunion.io/x/onecloud/pkg/apis"
 	"yunion.io/x/onecloud/pkg/apis/monitor"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
 	"yunion.io/x/onecloud/pkg/httperrors"
@@ -70,6 +71,17 @@ type SNotification struct {
 	Frequency            int64                `nullable:"false" default:"0" list:"user" create:"optional" update:"user"`
 	Settings             jsonutils.JSONObject `nullable:"false" list:"user" create:"required" update:"user"`
 	LastSendNotification time.Time            `list:"user" create:"optional" update:"user"`
+
+	// labels to group the eval matches of alerts into one notification
+	GroupBy []string `width:"256" charset:"utf8" nullable:"true" list:"user" create:"optional" update:"user"`
+	// unit is second
+	GroupWait      int64 `nullable:"false" default:"0" list:"user" create:"optional" update:"user"`
+	GroupInterval  int64 `nullable:"false" default:"0" list:"user" create:"optional" update:"user"`
+	RepeatInterval int64 `nullable:"false" default:"0" list:"user" create:"optional" update:"user"`
+
+	// notification sent when the alert is not acknowledged after escalation_after seconds
+	EscalationNotificationId string `width:"36" charset:"ascii" nullable:"true" list:"user" create:"optional" update:"user"`
+	EscalationAfter          int64  `nullable:"false" default:"0" list:"user" create:"optional" update:"user"`
 }
 
 func (man *SNotificationManager) GetPlugin(typ string) (*notifydrivers.NotifierPlugin, error) {
@@ -136,6 +148,19 @@ func (man *SNotificationManager) ValidateCreateData(ctx context.Context, userCre
 		dr := false
 		input.DisableResolveMessage = &dr
 	}
+	if err := validateNotificationGroup(&input.NotificationGroupInput); err != nil {
+		return input, err
+	}
+	if len(input.EscalationNotificationId) > 0 {
+		escalation, err := man.fetchEscalationNotification(ctx, userCred, input.EscalationNotificationId)
+		if err != nil {
+			return input, err
+		}
+		input.EscalationNotificationId = escalation.Id
+		if input.EscalationAfter <= 0 {
+			input.EscalationAfter = monitor.NOTIFICATION_ESCALATION_AFTER
+		}
+	}
 	plug, err := man.GetPlugin(input.Type)
 	if err != nil {
 		return input, err
@@ -143,6 +168,132 @@ func (man *SNotificationManager) ValidateCreateData(ctx context.Context, userCre
 	return plug.ValidateCreateData(userCred, input)
 }
 
+func validateNotificationGroup(input *monitor.NotificationGroupInput) error {
+	if input.GroupWait < 0 || input.GroupInterval < 0 || input.RepeatInterval < 0 {
+		return httperrors.NewInputParameterError("group_wait, group_interval and repeat_interval must not be negative")
+	}
+	if len(input.GroupBy) == 0 {
+		return nil
+	}
+	for _, label := range input.GroupBy {
+		if len(label) == 0 {
+			return httperrors.NewInputParameterError("empty label in group_by")
+		}
+	}
+	if input.GroupWait == 0 {
+		input.GroupWait = monitor.NOTIFICATION_GROUP_WAIT
+	}
+	if input.GroupInterval == 0 {
+		input.GroupInterval = monitor.NOTIFICATION_GROUP_INTERVAL
+	}
+	if input.RepeatInterval == 0 {
+		input.RepeatInterval = monitor.NOTIFICATION_REPEAT_INTERVAL
+	}
+	return nil
+}
+
+func (man *SNotificationManager) fetchEscalationNotification(ctx context.Context, userCred mcclient.TokenCredential, idOrName string) (*SNotification, error) {
+	obj, err := man.FetchByIdOrName(ctx, userCred, idOrName)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, httperrors.NewResourceNotFoundError2(man.Keyword(), idOrName)
+		}
+		return nil, errors.Wrapf(err, "fetch escalation notification %s", idOrName)
+	}
+	return obj.(*SNotification), nil
+}
+
+func (n *SNotification) ValidateUpdateData(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input monitor.NotificationUpdateInput) (monitor.NotificationUpdateInput, error) {
+	baseInput := apis.VirtualResourceBaseUpdateInput{}
+	baseInput.Name = input.Name
+	baseInput, err := n.SVirtualResourceBase.ValidateUpdateData(ctx, userCred, query, baseInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SVirtualResourceBase.ValidateUpdateData")
+	}
+	input.Name = baseInput.Name
+
+	group := monitor.NotificationGroupInput{
+		GroupBy:        n.GroupBy,
+		GroupWait:      n.GroupWait,
+		GroupInterval:  n.GroupInterval,
+		RepeatInterval: n.RepeatInterval,
+	}
+	if input.GroupBy != nil {
+		group.GroupBy = input.GroupBy
+	}
+	if input.GroupWait != nil {
+		group.GroupWait = *input.GroupWait
+	}
+	if input.GroupInterval != nil {
+		group.GroupInterval = *input.GroupInterval
+	}
+	if input.RepeatInterval != nil {
+		group.RepeatInterval = *input.RepeatInterval
+	}
+	if err := validateNotificationGroup(&group); err != nil {
+		return input, err
+	}
+	input.GroupWait = &group.GroupWait
+	input.GroupInterval = &group.GroupInterval
+	input.RepeatInterval = &group.RepeatInterval
+
+	if input.EscalationNotificationId != nil && len(*input.EscalationNotificationId) > 0 {
+		escalation, err := NotificationManager.fetchEscalationNotification(ctx, userCred, *input.EscalationNotificationId)
+		if err != nil {
+			return input, err
+		}
+		if err := n.checkEscalationLoop(escalation); err != nil {
+			return input, err
+		}
+		input.EscalationNotificationId = &escalation.Id
+		if input.EscalationAfter == nil && n.EscalationAfter <= 0 {
+			after := int64(monitor.NOTIFICATION_ESCALATION_AFTER)
+			input.EscalationAfter = &after
+		}
+	}
+	if input.EscalationAfter != nil && *input.EscalationAfter < 0 {
+		return input, httperrors.NewInputParameterError("escalation_after must not be negative")
+	}
+	return input, nil
+}
+
+// checkEscalationLoop makes sure that escalating to next never comes back
+// to this notification
+func (n *SNotification) checkEscalationLoop(next *SNotification) error {
+	cur := next
+	for i := 0; i < monitor.NOTIFICATION_ESCALATION_MAX_STEPS; i++ {
+		if cur.Id == n.Id {
+			return httperrors.NewInputParameterError("escalation of notification %s loops back to itself", n.Name)
+		}
+		if len(cur.EscalationNotificationId) == 0 {
+			return nil
+		}
+		nextNoti, err := NotificationManager.GetNotification(cur.EscalationNotificationId)
+		if err != nil {
+			return errors.Wrapf(err, "get notification %s", cur.EscalationNotificationId)
+		}
+		if nextNoti == nil {
+			return nil
+		}
+		cur = nextNoti
+	}
+	return httperrors.NewInputParameterError("escalation chain is longer than %d", monitor.NOTIFICATION_ESCALATION_MAX_STEPS)
+}
+
+// IsGrouped tells whether the eval matches are grouped before notifying
+func (n *SNotification) IsGrouped() bool {
+	return len(n.GroupBy) > 0
+}
+
+// GetEscalationNotification returns the notification to escalate to, nil if
+// escalation is not configured
+func (n *SNotification) GetEscalationNotification() (*SNotification, error) {
+	if len(n.EscalationNotificationId) == 0 || n.EscalationAfter <= 0 {
+		return nil, nil
+	}
+	return NotificationManager.GetNotification(n.EscalationNotificationId)
+}
+
 func (man *SNotificationManager) ListItemFilter(ctx context.Context, q *sqlchemy.SQuery,
 	userCred mcclient.TokenCredential, input monitor.NotificationListInput) (*sqlchemy.SQuery, error) {
 
@@ -230,6 +381,13 @@ func (n *SNotification) ValidateDeleteCondition(ctx context.Context, info jsonut
 	if cnt > 0 {
 		return httperrors.NewNotEmptyError("Alert notification used by %d alert", cnt)
 	}
+	cnt, err = NotificationManager.Query().Equals("escalation_notification_id", n.Id).CountWithError()
+	if err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return httperrors.NewNotEmptyError("Alert notification is the escalation of %d notification", cnt)
+	}
 	return n.SVirtualResourceBase.ValidateDeleteCondition(ctx, nil)
 }
 
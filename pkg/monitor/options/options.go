@@ -39,6 +39,8 @@ type AlerterOptions struct {
 
 	AutoMigrationMustPair      bool `default:"false" help:"result of auto migration source guests and target hosts must be paired"`
 	DisableQuerySignatureCheck bool `default:"true" help:"disable query signature check"`
+
+	MonitorDataSource string `help:"service type of the TSDB to query, e.g. prometheus, default to the TSDB metrics are written to"`
 }
 
 var (
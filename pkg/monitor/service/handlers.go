@@ -69,6 +69,7 @@ func InitHandlers(app *appsrv.Application) {
 		models.AlertPanelManager,
 		models.MonitorResourceManager,
 		models.AlertRecordShieldManager,
+		models.AlertSilenceManager,
 		models.GetMigrationAlertManager(),
 	} {
 		db.RegisterModelManager(manager)
@@ -76,6 +77,12 @@ func InitHandlers(app *appsrv.Application) {
 		dispatcher.AddModelDispatcher("", app, handler)
 	}
 
+	for _, manager := range []db.IModelManager{
+		models.AlertEscalationManager,
+	} {
+		db.RegisterModelManager(manager)
+	}
+
 	for _, manager := range []db.IModelManager{
 		models.UnifiedMonitorManager,
 	} {
@@ -0,0 +1,183 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context/ctxhttp"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/httputils"
+)
+
+const (
+	ErrPrometheusInvalidResponse = errors.Error("Prometheus invalid response")
+
+	RESULT_TYPE_MATRIX = "matrix"
+
+	RESPONSE_STATUS_SUCCESS = "success"
+)
+
+// Client talks to the HTTP API of Prometheus, which is also served by
+// Thanos query and other compatible implementations.
+type Client interface {
+	QueryRange(ctx context.Context, httpCli *http.Client, query string, start, end time.Time, step time.Duration) (*MatrixResult, error)
+	Series(ctx context.Context, httpCli *http.Client, matches []string, start, end time.Time) ([]map[string]string, error)
+}
+
+type client struct {
+	endpointURL url.URL
+}
+
+func NewClient(endpoint string) (Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid url: %q", endpoint)
+	}
+	return &client{
+		endpointURL: *u,
+	}, nil
+}
+
+// Response is the envelope of every API response, see
+// https://prometheus.io/docs/prometheus/latest/querying/api/#format-overview
+type Response struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+	Warnings  []string        `json:"warnings"`
+}
+
+// SampleValue likes: [ 1435781430.781, "1" ]
+type SampleValue []interface{}
+
+type MatrixSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values []SampleValue     `json:"values"`
+}
+
+type MatrixResult struct {
+	ResultType string         `json:"resultType"`
+	Result     []MatrixSeries `json:"result"`
+}
+
+func (c *client) getAPIURL(reqPath string) string {
+	reqURL := c.endpointURL
+	reqURL.Path = path.Join(reqURL.Path, "/api/v1", reqPath)
+	return reqURL.String()
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/float64(time.Second), 'f', -1, 64)
+}
+
+// QueryRange implements Client.
+func (c *client) QueryRange(ctx context.Context, httpCli *http.Client, query string, start, end time.Time, step time.Duration) (*MatrixResult, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", formatTime(start))
+	params.Set("end", formatTime(end))
+	params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	data, err := c.do(ctx, httpCli, "/query_range", params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "query_range %s", query)
+	}
+	ret := new(MatrixResult)
+	if err := decodeJSON(data, ret); err != nil {
+		return nil, errors.Wrap(err, "decode query_range data")
+	}
+	if ret.ResultType != RESULT_TYPE_MATRIX {
+		return nil, errors.Wrapf(ErrPrometheusInvalidResponse, "unexpected result type %q", ret.ResultType)
+	}
+	return ret, nil
+}
+
+// Series implements Client.
+func (c *client) Series(ctx context.Context, httpCli *http.Client, matches []string, start, end time.Time) ([]map[string]string, error) {
+	params := url.Values{}
+	for _, m := range matches {
+		params.Add("match[]", m)
+	}
+	params.Set("start", formatTime(start))
+	params.Set("end", formatTime(end))
+	data, err := c.do(ctx, httpCli, "/series", params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "series %v", matches)
+	}
+	ret := make([]map[string]string, 0)
+	if err := decodeJSON(data, &ret); err != nil {
+		return nil, errors.Wrap(err, "decode series data")
+	}
+	return ret, nil
+}
+
+// do posts the parameters as a form, so that long selectors do not hit
+// the URL length limit, and returns the data of a successful response
+func (c *client) do(ctx context.Context, httpCli *http.Client, reqPath string, params url.Values) (json.RawMessage, error) {
+	reqURL := c.getAPIURL(reqPath)
+	req, err := http.NewRequest(http.MethodPost, reqURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "new HTTP request of: %s", reqURL)
+	}
+	req.Header.Set("User-Agent", "Cloudpods Monitor Service")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	log.Debugf("Prometheus request %s: %s", reqURL, params.Encode())
+
+	resp, err := ctxhttp.Do(ctx, httpCli, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "Do request")
+	}
+	defer httputils.CloseResponse(resp)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read response body")
+	}
+	ret := new(Response)
+	if err := decodeJSON(body, ret); err != nil {
+		if resp.StatusCode/100 != 2 {
+			return nil, errors.Wrapf(ErrPrometheusInvalidResponse, "status code: %d (%s)", resp.StatusCode, body)
+		}
+		return nil, errors.Wrap(err, "decode json response")
+	}
+	if resp.StatusCode/100 != 2 || ret.Status != RESPONSE_STATUS_SUCCESS {
+		return nil, errors.Wrapf(ErrPrometheusInvalidResponse, "status code: %d, %s: %s", resp.StatusCode, ret.ErrorType, ret.Error)
+	}
+	for _, w := range ret.Warnings {
+		log.Warningf("Prometheus %s warning: %s", reqPath, w)
+	}
+	return ret.Data, nil
+}
+
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return errors.Wrapf(err, "decode %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/sets"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/monitor/tsdb"
+	"yunion.io/x/onecloud/pkg/monitor/tsdb/driver/influxdb"
+)
+
+const (
+	LABEL_METRIC_NAME = "__name__"
+
+	// telegraf collects most metrics every minute, a shorter range window
+	// would often be empty
+	DEFAULT_MIN_INTERVAL = time.Minute
+)
+
+func init() {
+	tsdb.RegisterTsdbQueryEndpoint(monitor.DataSourceTypePrometheus, NewPrometheusAdapter)
+}
+
+type prometheusAdapter struct {
+	datasource *tsdb.DataSource
+}
+
+func NewPrometheusAdapter(datasource *tsdb.DataSource) (tsdb.TsdbQueryEndpoint, error) {
+	return &prometheusAdapter{
+		datasource: datasource,
+	}, nil
+}
+
+func (p *prometheusAdapter) getClient(ds *tsdb.DataSource) (Client, error) {
+	cli, err := NewClient(ds.Url)
+	if err != nil {
+		return nil, errors.Wrap(err, "New Prometheus client")
+	}
+	return cli, nil
+}
+
+// Query implements tsdb.TsdbQueryEndpoint.
+func (p *prometheusAdapter) Query(ctx context.Context, ds *tsdb.DataSource, query *tsdb.TsdbQuery) (*tsdb.Response, error) {
+	cli, err := p.getClient(ds)
+	if err != nil {
+		return nil, err
+	}
+	httpCli, err := ds.GetHttpClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetHttpClient of data source")
+	}
+	result := &tsdb.Response{
+		Results: make(map[string]*tsdb.QueryResult),
+	}
+	for _, q := range query.Queries {
+		ret, err := p.queryOne(ctx, cli, httpCli, ds, query.TimeRange, q)
+		if err != nil {
+			return nil, errors.Wrapf(err, "query %s", q.RefId)
+		}
+		ret.RefId = q.RefId
+		result.Results[q.RefId] = ret
+	}
+	return result, nil
+}
+
+func getInterval(ds *tsdb.DataSource, q *tsdb.Query, tr *tsdb.TimeRange) (time.Duration, error) {
+	minInterval, err := tsdb.GetIntervalFrom(ds, q, DEFAULT_MIN_INTERVAL)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid interval %q", q.Interval)
+	}
+	_, _, bucket, err := groupByLabels(q.GroupBy)
+	if err != nil {
+		return 0, err
+	}
+	if bucket > minInterval {
+		minInterval = bucket
+	}
+	calculator := tsdb.NewIntervalCalculator(&tsdb.IntervalOptions{})
+	return calculator.Calculate(tr, minInterval).Value, nil
+}
+
+func (p *prometheusAdapter) queryOne(ctx context.Context, cli Client, httpCli *http.Client, ds *tsdb.DataSource, tr *tsdb.TimeRange, q *tsdb.Query) (*tsdb.QueryResult, error) {
+	interval, err := getInterval(ds, q, tr)
+	if err != nil {
+		return nil, errors.Wrap(err, "get query interval")
+	}
+	promQs, err := buildPromQueries(&q.MetricQuery, interval)
+	if err != nil {
+		return nil, errors.Wrap(err, "translate to PromQL")
+	}
+	// align to the interval like influxdb time buckets, so that points of
+	// consecutive evaluations are stable
+	start := tr.MustGetFrom().Truncate(interval)
+	end := tr.MustGetTo()
+
+	exprs := make([]string, len(promQs))
+	results := make([]*MatrixResult, len(promQs))
+	for i, pq := range promQs {
+		exprs[i] = pq.Expr
+		begin := time.Now()
+		resp, err := cli.QueryRange(ctx, httpCli, pq.Expr, start, end, interval)
+		if err != nil {
+			return nil, errors.Wrapf(err, "query range by: %s", pq.Expr)
+		}
+		log.Debugf("promQL: %s, elapsed: %s", pq.Expr, time.Since(begin))
+		results[i] = resp
+	}
+
+	ret := tsdb.NewQueryResult()
+	ret.Series = convertMatrixResults(q, promQs, results)
+	ret.Meta = monitor.QueryResultMeta{
+		RawQuery: strings.Join(exprs, "; "),
+	}
+	return ret, nil
+}
+
+func labelsId(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s->%s", k, tags[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// sSeriesRows gathers the values of every select of the same label set,
+// each select being a column as in influxdb results
+type sSeriesRows struct {
+	tags  map[string]string
+	times []float64
+	rows  map[float64][]interface{}
+}
+
+func parseSampleValue(val interface{}) *float64 {
+	var str string
+	switch v := val.(type) {
+	case string:
+		str = v
+	case json.Number:
+		str = v.String()
+	default:
+		return nil
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	return &f
+}
+
+// parseSampleTime returns the timestamp of a sample in milliseconds, the
+// precision used by influxdb results
+func parseSampleTime(val SampleValue) (float64, error) {
+	if len(val) != 2 {
+		return 0, errors.Wrapf(ErrPrometheusInvalidResponse, "invalid sample %v", val)
+	}
+	number, ok := val[0].(json.Number)
+	if !ok {
+		return 0, errors.Wrapf(ErrPrometheusInvalidResponse, "invalid sample time %v", val[0])
+	}
+	ts, err := number.Float64()
+	if err != nil {
+		return 0, errors.Wrapf(err, "parse sample time %s", number)
+	}
+	return math.Round(ts * 1000), nil
+}
+
+func convertMatrixResults(q *tsdb.Query, promQs []sPromQuery, results []*MatrixResult) monitor.TimeSeriesSlice {
+	columns := make([]string, 0, len(promQs)+1)
+	for _, pq := range promQs {
+		columns = append(columns, pq.Column)
+	}
+	columns = append(columns, "time")
+
+	ids := make([]string, 0)
+	seriesRows := make(map[string]*sSeriesRows)
+	for col, result := range results {
+		for _, s := range result.Result {
+			tags := make(map[string]string, len(s.Metric))
+			for k, v := range s.Metric {
+				if k == LABEL_METRIC_NAME {
+					continue
+				}
+				tags[k] = v
+			}
+			id := labelsId(tags)
+			sr, ok := seriesRows[id]
+			if !ok {
+				sr = &sSeriesRows{
+					tags: tags,
+					rows: make(map[float64][]interface{}),
+				}
+				seriesRows[id] = sr
+				ids = append(ids, id)
+			}
+			for _, val := range s.Values {
+				ts, err := parseSampleTime(val)
+				if err != nil {
+					log.Errorf("parseSampleTime: %v", err)
+					continue
+				}
+				row, ok := sr.rows[ts]
+				if !ok {
+					row = make([]interface{}, len(promQs))
+					for i := range row {
+						row[i] = (*float64)(nil)
+					}
+					sr.rows[ts] = row
+					sr.times = append(sr.times, ts)
+				}
+				row[col] = parseSampleValue(val[1])
+			}
+		}
+	}
+
+	// add the tag keys whose values differ between series
+	diffTagKeys := sets.NewString()
+	for i := 1; i < len(ids); i++ {
+		for k, v := range seriesRows[ids[0]].tags {
+			if seriesRows[ids[i]].tags[k] != v {
+				diffTagKeys.Insert(k)
+			}
+		}
+	}
+	groupByTags := []string{}
+	for _, group := range q.GroupBy {
+		if group.Type == "tag" && len(group.Params) > 0 {
+			groupByTags = append(groupByTags, group.Params[0])
+		}
+	}
+
+	name := fmt.Sprintf("%s.%s", q.Measurement, strings.Join(columns[:len(columns)-1], "-"))
+	ret := make(monitor.TimeSeriesSlice, 0, len(ids))
+	for idx, id := range ids {
+		sr := seriesRows[id]
+		sort.Float64s(sr.times)
+		points := make(monitor.TimeSeriesPoints, 0, len(sr.times))
+		for _, ts := range sr.times {
+			point := make(monitor.TimePoint, 0, len(columns))
+			point = append(point, sr.rows[ts]...)
+			point = append(point, ts)
+			points = append(points, point)
+		}
+		ret = append(ret, tsdb.NewTimeSeries(name, tsdb.FormatRawName(idx, name, groupByTags, sr.tags, diffTagKeys), columns, points, sr.tags))
+	}
+	return ret
+}
+
+func (p *prometheusAdapter) FilterMeasurement(ctx context.Context, ds *tsdb.DataSource, from, to string, ms *monitor.InfluxMeasurement, tagFilter *monitor.MetricQueryTag) (*monitor.InfluxMeasurement, error) {
+	cli, err := p.getClient(ds)
+	if err != nil {
+		return nil, err
+	}
+	httpCli, err := ds.GetHttpClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetHttpClient of data source")
+	}
+	matchers := ""
+	if tagFilter != nil {
+		matchers, err = renderMatchers([]monitor.MetricQueryTag{*tagFilter})
+		if err != nil {
+			return nil, errors.Wrap(err, "render tag filter")
+		}
+	}
+	if len(to) == 0 {
+		to = "now"
+	}
+	tr := tsdb.NewTimeRange(from, to)
+	matches := make([]string, len(ms.FieldKey))
+	for i, field := range ms.FieldKey {
+		matches[i] = metricSelector(ms.Measurement, field, matchers)
+	}
+
+	retMs := new(monitor.InfluxMeasurement)
+	if len(matches) == 0 {
+		return retMs, nil
+	}
+	series, err := cli.Series(ctx, httpCli, matches, tr.MustGetFrom(), tr.MustGetTo())
+	if err != nil {
+		return nil, errors.Wrapf(err, "get series of measurement %s", ms.Measurement)
+	}
+	names := sets.NewString()
+	for _, s := range series {
+		names.Insert(s[LABEL_METRIC_NAME])
+	}
+	retFields := sets.NewString()
+	for _, field := range ms.FieldKey {
+		if names.Has(metricName(ms.Measurement, field)) {
+			retFields.Insert(field)
+		}
+	}
+	retMs.FieldKey = retFields.List()
+	if len(retMs.FieldKey) != 0 {
+		retMs.Measurement = ms.Measurement
+		retMs.Database = ms.Database
+		retMs.ResType = ms.ResType
+	}
+	return retMs, nil
+}
+
+func (p *prometheusAdapter) FillSelect(query *monitor.AlertQuery, isAlert bool) *monitor.AlertQuery {
+	if isAlert {
+		query = influxdb.FillSelectWithMean(query)
+	}
+	return query
+}
+
+func (p *prometheusAdapter) FillGroupBy(query *monitor.AlertQuery, inputQuery *monitor.MetricQueryInput, tagId string, isAlert bool) *monitor.AlertQuery {
+	if isAlert {
+		query = influxdb.FillGroupByWithWildChar(query, inputQuery, tagId)
+	}
+	return query
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/monitor/tsdb"
+)
+
+func newTestServer(t *testing.T, queries *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/prom/api/v1/query_range":
+			query := r.Form.Get("query")
+			*queries = append(*queries, query)
+			if r.Form.Get("step") != "300" {
+				t.Errorf("step %s", r.Form.Get("step"))
+			}
+			switch query {
+			case `avg by (host_id) (avg_over_time(cpu_usage_active{res_type="host"}[300s]))`:
+				fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[
+					{"metric":{"host_id":"h1"},"values":[[1700000000,"10"],[1700000300,"20"]]},
+					{"metric":{"host_id":"h2"},"values":[[1700000000,"NaN"],[1700000300,"5.5"]]}]}}`)
+			case `max by (host_id) (max_over_time(cpu_usage_active{res_type="host"}[300s]))`:
+				fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[
+					{"metric":{"host_id":"h1"},"values":[[1700000300,"30"]]}]}}`)
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+			}
+		case "/prom/api/v1/series":
+			fmt.Fprint(w, `{"status":"success","data":[{"__name__":"cpu_usage_active","res_type":"host"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestPrometheusQuery(t *testing.T) {
+	queries := []string{}
+	srv := newTestServer(t, &queries)
+	defer srv.Close()
+
+	ds := &tsdb.DataSource{
+		Type: monitor.DataSourceTypePrometheus,
+		Url:  srv.URL + "/prom",
+	}
+	ep, err := tsdb.GetTsdbQueryEndpointFor(ds)
+	if err != nil {
+		t.Fatalf("GetTsdbQueryEndpointFor: %v", err)
+	}
+	q := &tsdb.TsdbQuery{
+		TimeRange: tsdb.NewTimeRange("1700000000000", "1700000600000"),
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				MetricQuery: monitor.MetricQuery{
+					Measurement: "cpu",
+					Interval:    "5m",
+					Selects: []monitor.MetricQuerySelect{
+						{monitor.NewMetricQueryPartField("usage_active"), monitor.NewMetricQueryPartMean()},
+						{monitor.NewMetricQueryPartField("usage_active"), monitor.NewMetricQueryPartMax()},
+					},
+					Tags: []monitor.MetricQueryTag{{Key: "res_type", Operator: "=", Value: "host"}},
+					GroupBy: []monitor.MetricQueryPart{
+						{Type: "tag", Params: []string{"host_id"}},
+					},
+				},
+			},
+		},
+	}
+	resp, err := ep.Query(context.Background(), ds, q)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("queries: %v", queries)
+	}
+	series := resp.Results["A"].Series
+	if len(series) != 2 {
+		t.Fatalf("series count %d", len(series))
+	}
+	h1 := series[0]
+	if h1.Name != "cpu.mean-max" || h1.Tags["host_id"] != "h1" {
+		t.Errorf("series %s tags %v", h1.Name, h1.Tags)
+	}
+	if len(h1.Columns) != 3 || h1.Columns[0] != "mean" || h1.Columns[1] != "max" || h1.Columns[2] != "time" {
+		t.Errorf("columns %v", h1.Columns)
+	}
+	if len(h1.Points) != 2 {
+		t.Fatalf("points %v", h1.Points)
+	}
+	if v := h1.Points[0][0].(*float64); *v != 10 {
+		t.Errorf("mean %v", *v)
+	}
+	if v := h1.Points[0][1].(*float64); v != nil {
+		t.Errorf("missing max %v", *v)
+	}
+	if v := h1.Points[1][1].(*float64); *v != 30 {
+		t.Errorf("max %v", *v)
+	}
+	if ts := h1.Points[1][2].(float64); ts != 1700000300000 {
+		t.Errorf("timestamp %v", ts)
+	}
+	if v := series[1].Points[0][0].(*float64); v != nil {
+		t.Errorf("NaN should be null, got %v", *v)
+	}
+
+	// PromQL errors are reported to the caller
+	q.Queries[0].Selects = q.Queries[0].Selects[:1]
+	q.Queries[0].GroupBy = nil
+	if _, err := ep.Query(context.Background(), ds, q); err == nil {
+		t.Errorf("bad query should fail")
+	}
+}
+
+func TestPrometheusFilterMeasurement(t *testing.T) {
+	queries := []string{}
+	srv := newTestServer(t, &queries)
+	defer srv.Close()
+
+	ds := &tsdb.DataSource{
+		Type: monitor.DataSourceTypePrometheus,
+		Url:  srv.URL + "/prom",
+	}
+	ep, _ := NewPrometheusAdapter(ds)
+	ms := &monitor.InfluxMeasurement{
+		Database:    "telegraf",
+		Measurement: "cpu",
+		FieldKey:    []string{"usage_active", "usage_idle"},
+	}
+	ret, err := ep.FilterMeasurement(context.Background(), ds, "1h", "now", ms, &monitor.MetricQueryTag{Key: "res_type", Value: "host"})
+	if err != nil {
+		t.Fatalf("FilterMeasurement: %v", err)
+	}
+	if ret.Measurement != "cpu" || len(ret.FieldKey) != 1 || ret.FieldKey[0] != "usage_active" {
+		t.Errorf("got %#v", ret)
+	}
+}
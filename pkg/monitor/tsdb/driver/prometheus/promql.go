@@ -0,0 +1,313 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+)
+
+const (
+	ErrUnsupportedQuery = errors.Error("unsupported query for Prometheus")
+
+	GROUP_BY_ALL = "*"
+)
+
+var (
+	invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+	influxRegexValue = regexp.MustCompile(`^/.*/$`)
+)
+
+// rangeFuncs maps the select functions of the monitor query model to
+// PromQL functions over a range vector of one interval
+var rangeFuncs = map[string]string{
+	"mean":                    "avg_over_time",
+	"max":                     "max_over_time",
+	"min":                     "min_over_time",
+	"sum":                     "sum_over_time",
+	"count":                   "count_over_time",
+	"last":                    "last_over_time",
+	"stddev":                  "stddev_over_time",
+	"derivative":              "deriv",
+	"non_negative_derivative": "rate",
+}
+
+// seriesAggrs maps the select functions to the PromQL aggregation that
+// merges series sharing the same group by tags, like influxdb does when
+// grouping by a subset of the tags
+var seriesAggrs = map[string]string{
+	"max":   "max",
+	"min":   "min",
+	"sum":   "sum",
+	"count": "sum",
+}
+
+// sPromQuery is the PromQL expression of one select of a metric query
+type sPromQuery struct {
+	Expr   string
+	Column string
+}
+
+// sanitizeName turns a measurement, field or tag key into a valid
+// Prometheus name, the same way telegraf's prometheus serializer does
+func sanitizeName(name string) string {
+	name = invalidNameChars.ReplaceAllString(name, "_")
+	if len(name) > 0 && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+func metricName(measurement, field string) string {
+	return sanitizeName(measurement + "_" + field)
+}
+
+func metricSelector(measurement, field string, matchers string) string {
+	name := metricName(measurement, field)
+	if len(matchers) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s{%s}", name, matchers)
+}
+
+type sLabelMatcher struct {
+	Name     string
+	Operator string
+	Value    string
+}
+
+func (m sLabelMatcher) String() string {
+	return fmt.Sprintf("%s%s%s", m.Name, m.Operator, strconv.Quote(m.Value))
+}
+
+// toRegex turns an equal matcher into a regex one, so that it can be
+// merged with another value of the same label
+func (m *sLabelMatcher) toRegex() {
+	if m.Operator == "=" {
+		m.Operator = "=~"
+		m.Value = regexp.QuoteMeta(m.Value)
+	}
+}
+
+// convertRegex converts an influxdb regex literal like /^host-.*/ to a
+// Prometheus one. Prometheus regexes are fully anchored while influxdb
+// ones are not.
+func convertRegex(val string) string {
+	val = strings.TrimSuffix(strings.TrimPrefix(val, "/"), "/")
+	return ".*(?:" + val + ").*"
+}
+
+func newLabelMatcher(tag monitor.MetricQueryTag) (sLabelMatcher, error) {
+	m := sLabelMatcher{
+		Name:     sanitizeName(tag.Key),
+		Operator: tag.Operator,
+		Value:    tag.Value,
+	}
+	isRegex := influxRegexValue.MatchString(tag.Value)
+	if m.Operator == "" {
+		if isRegex {
+			m.Operator = "=~"
+		} else {
+			m.Operator = "="
+		}
+	}
+	switch m.Operator {
+	case "=", "!=":
+	case "<>":
+		m.Operator = "!="
+	case "=~", "!~":
+		if isRegex {
+			m.Value = convertRegex(m.Value)
+		}
+	default:
+		return m, errors.Wrapf(ErrUnsupportedQuery, "tag operator %q of %s", tag.Operator, tag.Key)
+	}
+	return m, nil
+}
+
+// renderMatchers renders the tag filters as label matchers. Prometheus
+// selectors can only AND matchers, so OR conditions are only accepted
+// between values of the same tag and are folded into a regex alternation.
+func renderMatchers(tags []monitor.MetricQueryTag) (string, error) {
+	matchers := make([]sLabelMatcher, 0, len(tags))
+	for i, tag := range tags {
+		m, err := newLabelMatcher(tag)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 && strings.EqualFold(tag.Condition, "OR") {
+			last := &matchers[len(matchers)-1]
+			if last.Name != m.Name {
+				return "", errors.Wrapf(ErrUnsupportedQuery, "OR condition between tag %s and %s", last.Name, m.Name)
+			}
+			last.toRegex()
+			m.toRegex()
+			if last.Operator != "=~" || m.Operator != "=~" {
+				return "", errors.Wrapf(ErrUnsupportedQuery, "OR condition on negative matchers of tag %s", m.Name)
+			}
+			last.Value = last.Value + "|" + m.Value
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+	strs := make([]string, len(matchers))
+	for i := range matchers {
+		strs[i] = matchers[i].String()
+	}
+	return strings.Join(strs, ","), nil
+}
+
+// groupByLabels returns the tags to group by, or keepAll when every series
+// should be kept as is, and the explicit time bucket of the query
+func groupByLabels(groupBy []monitor.MetricQueryPart) ([]string, bool, time.Duration, error) {
+	labels := make([]string, 0)
+	keepAll := false
+	var bucket time.Duration
+	for _, part := range groupBy {
+		if len(part.Params) == 0 {
+			continue
+		}
+		switch part.Type {
+		case "tag", "field":
+			if part.Params[0] == GROUP_BY_ALL {
+				keepAll = true
+				continue
+			}
+			labels = append(labels, sanitizeName(part.Params[0]))
+		case "time":
+			if strings.HasPrefix(part.Params[0], "$") {
+				continue
+			}
+			d, err := time.ParseDuration(part.Params[0])
+			if err != nil {
+				return nil, false, 0, errors.Wrapf(err, "invalid group by time %q", part.Params[0])
+			}
+			bucket = d
+		}
+	}
+	return labels, keepAll, bucket, nil
+}
+
+func formatRange(interval time.Duration) string {
+	if interval%time.Second != 0 || interval < time.Second {
+		return fmt.Sprintf("%dms", interval.Milliseconds())
+	}
+	return fmt.Sprintf("%ds", int64(interval.Seconds()))
+}
+
+func applyFunc(expr string, part monitor.MetricQueryPart, interval time.Duration) (string, error) {
+	window := formatRange(interval)
+	if fn, ok := rangeFuncs[part.Type]; ok {
+		return fmt.Sprintf("%s(%s[%s])", fn, expr, window), nil
+	}
+	switch part.Type {
+	case "median":
+		return fmt.Sprintf("quantile_over_time(0.5, %s[%s])", expr, window), nil
+	case "percentile":
+		if len(part.Params) == 0 {
+			return "", errors.Wrap(ErrUnsupportedQuery, "percentile without parameter")
+		}
+		p, err := strconv.ParseFloat(part.Params[0], 64)
+		if err != nil || p < 0 || p > 100 {
+			return "", errors.Wrapf(ErrUnsupportedQuery, "invalid percentile %q", part.Params[0])
+		}
+		return fmt.Sprintf("quantile_over_time(%s, %s[%s])", strconv.FormatFloat(p/100, 'f', -1, 64), expr, window), nil
+	}
+	return "", errors.Wrapf(ErrUnsupportedQuery, "function %q", part.Type)
+}
+
+func aggregateSeries(expr string, fn string, labels []string) string {
+	aggr, ok := seriesAggrs[fn]
+	if !ok {
+		aggr = "avg"
+	}
+	if len(labels) == 0 {
+		return fmt.Sprintf("%s(%s)", aggr, expr)
+	}
+	return fmt.Sprintf("%s by (%s) (%s)", aggr, strings.Join(labels, ","), expr)
+}
+
+// buildPromQueries translates every select of the metric query into a
+// PromQL expression evaluated at each step of interval. The metric name is
+// <measurement>_<field>, the naming used by telegraf and VictoriaMetrics.
+func buildPromQueries(q *monitor.MetricQuery, interval time.Duration) ([]sPromQuery, error) {
+	matchers, err := renderMatchers(q.Tags)
+	if err != nil {
+		return nil, errors.Wrap(err, "render tag matchers")
+	}
+	labels, keepAll, _, err := groupByLabels(q.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]sPromQuery, 0, len(q.Selects))
+	for _, sel := range q.Selects {
+		pq := sPromQuery{}
+		alias := ""
+		hasFunc := false
+		for _, part := range sel {
+			switch part.Type {
+			case "field":
+				if len(part.Params) == 0 || part.Params[0] == "*" {
+					return nil, errors.Wrapf(ErrUnsupportedQuery, "field %v", part.Params)
+				}
+				pq.Expr = metricSelector(q.Measurement, part.Params[0], matchers)
+				pq.Column = part.Params[0]
+			case "alias":
+				if len(part.Params) > 0 {
+					alias = part.Params[0]
+				}
+			case "math":
+				if len(part.Params) > 0 {
+					pq.Expr = fmt.Sprintf("(%s) %s", pq.Expr, part.Params[0])
+				}
+			default:
+				if len(pq.Expr) == 0 {
+					return nil, errors.Wrapf(ErrUnsupportedQuery, "function %q before field", part.Type)
+				}
+				if hasFunc {
+					return nil, errors.Wrapf(ErrUnsupportedQuery, "nested function %q", part.Type)
+				}
+				expr, err := applyFunc(pq.Expr, part, interval)
+				if err != nil {
+					return nil, err
+				}
+				if !keepAll {
+					expr = aggregateSeries(expr, part.Type, labels)
+				}
+				pq.Expr = expr
+				pq.Column = part.Type
+				hasFunc = true
+			}
+		}
+		if len(pq.Expr) == 0 {
+			return nil, errors.Wrap(ErrUnsupportedQuery, "select without field")
+		}
+		if len(alias) > 0 {
+			pq.Column = alias
+		}
+		ret = append(ret, pq)
+	}
+	if len(ret) == 0 {
+		return nil, errors.Wrap(ErrUnsupportedQuery, "query without select")
+	}
+	return ret, nil
+}
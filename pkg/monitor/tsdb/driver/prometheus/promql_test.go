@@ -0,0 +1,130 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+)
+
+func TestBuildPromQueries(t *testing.T) {
+	usageActive := monitor.NewMetricQueryPartField("usage_active")
+	tests := []struct {
+		name    string
+		query   monitor.MetricQuery
+		want    []sPromQuery
+		wantErr bool
+	}{
+		{
+			name: "mean group by tag",
+			query: monitor.MetricQuery{
+				Measurement: "cpu",
+				Selects:     []monitor.MetricQuerySelect{{usageActive, monitor.NewMetricQueryPartMean()}},
+				Tags: []monitor.MetricQueryTag{
+					{Key: "res_type", Operator: "=", Value: "host"},
+					{Key: "host", Operator: "=~", Value: "/^node-/"},
+				},
+				GroupBy: []monitor.MetricQueryPart{
+					{Type: "time", Params: []string{"$interval"}},
+					{Type: "tag", Params: []string{"host_id"}},
+				},
+			},
+			want: []sPromQuery{
+				{
+					Expr:   `avg by (host_id) (avg_over_time(cpu_usage_active{res_type="host",host=~".*(?:^node-).*"}[300s]))`,
+					Column: "mean",
+				},
+			},
+		},
+		{
+			name: "keep all series with math and alias",
+			query: monitor.MetricQuery{
+				Measurement: "mem",
+				Selects: []monitor.MetricQuerySelect{
+					{
+						monitor.NewMetricQueryPartField("used"),
+						monitor.NewMetricQueryPartMax(),
+						monitor.NewMetricQueryPartMath("/", "1024"),
+						monitor.NewMetricQueryPartAS("used_kb"),
+					},
+				},
+				GroupBy: []monitor.MetricQueryPart{{Type: "field", Params: []string{"*"}}},
+			},
+			want: []sPromQuery{
+				{Expr: `(max_over_time(mem_used[300s])) / 1024`, Column: "used_kb"},
+			},
+		},
+		{
+			name: "or on same tag and percentile",
+			query: monitor.MetricQuery{
+				Measurement: "net",
+				Selects: []monitor.MetricQuerySelect{
+					{monitor.NewMetricQueryPartField("bps_recv"), {Type: "percentile", Params: []string{"95"}}},
+				},
+				Tags: []monitor.MetricQueryTag{
+					{Key: "interface", Value: "eth0"},
+					{Key: "interface", Value: "eth1.1", Condition: "OR"},
+				},
+			},
+			want: []sPromQuery{
+				{Expr: `avg(quantile_over_time(0.95, net_bps_recv{interface=~"eth0|eth1\\.1"}[300s]))`, Column: "percentile"},
+			},
+		},
+		{
+			name: "or between different tags",
+			query: monitor.MetricQuery{
+				Measurement: "cpu",
+				Selects:     []monitor.MetricQuerySelect{{usageActive}},
+				Tags: []monitor.MetricQueryTag{
+					{Key: "host", Value: "a"},
+					{Key: "vm", Value: "b", Condition: "OR"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported function",
+			query: monitor.MetricQuery{
+				Measurement: "cpu",
+				Selects:     []monitor.MetricQuerySelect{{usageActive, monitor.NewMetricQueryPartDistinct()}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildPromQueries(&tt.query, 5*time.Minute)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %#v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildPromQueries: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %#v, want %#v", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
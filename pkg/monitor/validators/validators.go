@@ -38,6 +38,8 @@ const (
 var (
 	EvaluatorDefaultTypes = []string{"gt", "lt", "eq"}
 	EvaluatorRangedTypes  = []string{"within_range", "outside_range"}
+	// EvaluatorBaselineTypes compare with the same window in previous days
+	EvaluatorBaselineTypes = []string{"seasonal_baseline"}
 
 	CommonAlertType = []string{
 		monitor.CommonAlertNomalAlertType,
@@ -158,6 +160,9 @@ func ValidateAlertConditionEvaluator(input monitor.Condition) error {
 	if utils.IsInStringArray(typ, EvaluatorRangedTypes) {
 		return ValidateAlertConditionRangedEvaluator(input)
 	}
+	if utils.IsInStringArray(typ, EvaluatorBaselineTypes) {
+		return ValidateAlertConditionBaselineEvaluator(input)
+	}
 	if typ != "no_value" {
 		return errors.Wrapf(ErrInvalidEvaluatorType, "type: %s", typ)
 	}
@@ -191,6 +196,13 @@ func ValidateAlertConditionRangedEvaluator(input monitor.Condition) error {
 	return nil
 }
 
+func ValidateAlertConditionBaselineEvaluator(input monitor.Condition) error {
+	if len(input.Params) == 0 || input.Params[0] <= 0 {
+		return errors.Wrapf(ErrMissingParameterThreshold, "Evaluator %s requires a positive sigma", HumanThresholdType(input.Type))
+	}
+	return nil
+}
+
 // HumanThresholdType converts a threshold "type" string to a string that matches the UI
 // so errors are less confusing.
 func HumanThresholdType(typ string) string {
@@ -203,6 +215,8 @@ func HumanThresholdType(typ string) string {
 		return "IS WITHIN RANGE"
 	case "outside_range":
 		return "IS OUTSIDE RANGE"
+	case "seasonal_baseline":
+		return "DEVIATES FROM BASELINE"
 	}
 	return ""
 }
@@ -89,6 +89,10 @@ func OutOfRangeError(ctx context.Context, msg string) s3cli.ErrorResponse {
 	return generalError(ctx, 416, "Range Not Satisfiable", msg)
 }
 
+func NoSuchLifecycleConfiguration(ctx context.Context, msg string) s3cli.ErrorResponse {
+	return generalError(ctx, 404, "NoSuchLifecycleConfiguration", msg)
+}
+
 func SendGeneralError(ctx context.Context, w http.ResponseWriter, err error) {
 	switch e := err.(type) {
 	case s3cli.ErrorResponse:
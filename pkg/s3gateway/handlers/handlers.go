@@ -16,8 +16,10 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -58,8 +60,13 @@ func s3HandlerTimeoutInfo(info *appsrv.SHandlerInfo, r *http.Request) time.Durat
 			return 2 * time.Hour
 		} else if r.Method == http.MethodPut && (len(r.URL.RawQuery) == 0 || strings.Contains(r.URL.RawQuery, "partNumber=")) {
 			return 2 * time.Hour
+		} else if r.Method == http.MethodPost && strings.Contains(r.URL.RawQuery, "select") {
+			return 2 * time.Hour
 		}
 	}
+	if len(o.Bucket) > 0 && isPostPolicyRequest(r) {
+		return 2 * time.Hour
+	}
 	return time.Duration(0)
 }
 
@@ -134,7 +141,13 @@ func headHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		return
 	} else if len(o.Bucket) > 0 && len(o.Key) > 0 {
 		// head object
-		hdr, err := headObject(ctx, userCred, o.Bucket, o.Key)
+		query, err := jsonutils.ParseQueryString(r.URL.RawQuery)
+		if err != nil {
+			SendError(ctx, w, BadRequest(ctx, err.Error()))
+			return
+		}
+		versionId, _ := query.GetString("versionId")
+		hdr, err := headObject(ctx, userCred, o.Bucket, o.Key, versionId)
 		if err != nil {
 			SendGeneralError(ctx, w, err)
 		} else {
@@ -166,7 +179,8 @@ func readBucket(ctx context.Context, userCred mcclient.TokenCredential, bucketNa
 	} else if query.Contains("inventory") {
 
 	} else if query.Contains("lifecycle") {
-
+		resp, err := getBucketLifecycle(ctx, userCred, bucket)
+		return resp, nil, err
 	} else if query.Contains("location") {
 		result := s3cli.LocationConstraint(bucket.Location)
 		return &result, nil, nil
@@ -183,7 +197,16 @@ func readBucket(ctx context.Context, userCred mcclient.TokenCredential, bucketNa
 	} else if query.Contains("policyStatus") {
 
 	} else if query.Contains("versions") {
-
+		input := models.ListObjectVersionsInput{}
+		err := query.Unmarshal(&input)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "query.Unmarshal ListObjectVersionsInput")
+		}
+		result, err := bucket.ListObjectVersions(ctx, userCred, &input)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "bucket.ListObjectVersions")
+		}
+		return result, nil, nil
 	} else if query.Contains("policy") {
 
 	} else if query.Contains("replication") {
@@ -193,7 +216,11 @@ func readBucket(ctx context.Context, userCred mcclient.TokenCredential, bucketNa
 	} else if query.Contains("tagging") {
 
 	} else if query.Contains("versioning") {
-		return &s3cli.VersioningConfiguration{}, nil, nil
+		result, err := bucket.GetVersioning(ctx, userCred)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "bucket.GetVersioning")
+		}
+		return result, nil, nil
 	} else if query.Contains("website") {
 
 	} else if query.Contains("uploads") {
@@ -241,6 +268,36 @@ func readObject(ctx context.Context, userCred mcclient.TokenCredential, bucketNa
 	return nil, nil, NotImplemented(ctx, "not implemented")
 }
 
+var objectSubresources = []string{"acl", "legal-hold", "retention", "tagging", "torrent"}
+
+func isObjectSubresource(query jsonutils.JSONObject) bool {
+	for _, sub := range objectSubresources {
+		if query.Contains(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownObjectQueryParams returns the query parameters of an object GET
+// that are neither understood by download nor part of the request signature,
+// e.g. uploadId of ListParts, which must not be answered with the object body
+func unknownObjectQueryParams(query url.Values) []string {
+	ret := make([]string, 0)
+	for k := range query {
+		lower := strings.ToLower(k)
+		switch {
+		case k == "versionId", k == "x-id":
+		case strings.HasPrefix(lower, "response-"), strings.HasPrefix(lower, "x-amz-"):
+		case k == "AWSAccessKeyId", k == "Signature", k == "Expires":
+		default:
+			ret = append(ret, k)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
 func getRangeOpt(rangeStr string, sizeBytes int64) (*cloudprovider.SGetObjectRange, error) {
 	if len(rangeStr) > 0 {
 		rangeOptObj := cloudprovider.ParseRange(rangeStr)
@@ -257,20 +314,19 @@ func getRangeOpt(rangeStr string, sizeBytes int64) (*cloudprovider.SGetObjectRan
 	return nil, nil
 }
 
-func downloadObject(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, key string, reqHdr http.Header, w http.ResponseWriter) error {
+func downloadObject(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, key string, versionId string, reqHdr http.Header, w http.ResponseWriter) error {
 	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
 	if err != nil {
 		return errors.Wrap(err, "models.BucketManager.GetByName")
 	}
-	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	obj, _, err := getObjectVersion(ctx, userCred, bucket, key, versionId)
 	if err != nil {
-		return errors.Wrap(err, "bucket.GetIBucket")
-	}
-	obj, err := cloudprovider.GetIObject(iBucket, key)
-	if err != nil {
-		return errors.Wrap(err, "cloudprovider.GetIObject")
+		return errors.Wrap(err, "getObjectVersion")
 	}
 	hdr := cloudprovider.MetaToHttpHeader(cloudprovider.META_HEADER_PREFIX, obj.GetMeta())
+	if len(versionId) > 0 {
+		hdr.Set("x-amz-version-id", versionId)
+	}
 	eTag := obj.GetETag()
 	if len(eTag) > 0 {
 		hdr.Set("ETag", eTag)
@@ -284,9 +340,9 @@ func downloadObject(ctx context.Context, userCred mcclient.TokenCredential, buck
 	if err != nil {
 		return errors.Wrap(err, rangeStr)
 	}
-	stream, err := iBucket.GetObject(ctx, key, rangeOpt)
+	stream, err := getObjectVersionStream(ctx, userCred, bucket, key, versionId, rangeOpt)
 	if err != nil {
-		return errors.Wrap(err, "iBucket.GetObject")
+		return errors.Wrap(err, "getObjectVersionStream")
 	}
 	err = appsrv.SendStream(w, rangeOpt != nil, hdr, stream, obj.GetSizeBytes())
 	if err != nil {
@@ -334,7 +390,7 @@ func readHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		// object get
 		if len(r.URL.RawQuery) == 0 {
 			// download object
-			err := downloadObject(ctx, userCred, o.Bucket, o.Key, r.Header, w)
+			err := downloadObject(ctx, userCred, o.Bucket, o.Key, "", r.Header, w)
 			if err != nil {
 				SendGeneralError(ctx, w, err)
 			}
@@ -345,6 +401,19 @@ func readHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 			SendError(ctx, w, BadRequest(ctx, err.Error()))
 			return
 		}
+		if !isObjectSubresource(query) {
+			if unknown := unknownObjectQueryParams(r.URL.Query()); len(unknown) > 0 {
+				SendError(ctx, w, NotImplemented(ctx, fmt.Sprintf("query %s not implemented", strings.Join(unknown, ","))))
+				return
+			}
+			// download object, optionally a specific version
+			versionId, _ := query.GetString("versionId")
+			err := downloadObject(ctx, userCred, o.Bucket, o.Key, versionId, r.Header, w)
+			if err != nil {
+				SendGeneralError(ctx, w, err)
+			}
+			return
+		}
 		resp, respHdr, err := readObject(ctx, userCred, o.Bucket, o.Key, query, r)
 		if err != nil {
 			SendGeneralError(ctx, w, err)
@@ -372,17 +441,22 @@ func postObject(ctx context.Context, userCred mcclient.TokenCredential, bucket s
 			return nil, nil, errors.Wrap(httperrors.ErrBadRequest, "FetchXml")
 		}
 		return completeMultipartUpload(ctx, userCred, r.Header, bucket, key, uploadId, &request)
-	} else if query.Contains("select") {
-		// select object
-		return selectObject(ctx, userCred, r.Header, bucket, key)
 	} else {
-		// upload object by form POST
+		// upload object by form POST, which is handled by postPolicyObject
 	}
 	return nil, nil, NotImplemented(ctx, "not implemented")
 }
 
 func postHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	o := fetchObjectRequest(ctx)
+	if len(o.Bucket) > 0 && isPostPolicyRequest(r) {
+		// browser-based upload with POST policy
+		err := postPolicyObject(ctx, o, r, w)
+		if err != nil {
+			SendGeneralError(ctx, w, err)
+		}
+		return
+	}
 	userCred := auth.FetchUserCredential(ctx, nil)
 	if len(o.Bucket) == 0 {
 		// no bucket
@@ -397,6 +471,14 @@ func postHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 			SendError(ctx, w, BadRequest(ctx, err.Error()))
 			return
 		}
+		if query.Contains("select") {
+			// select object, the result is streamed as event stream
+			err := selectObject(ctx, userCred, o.Bucket, o.Key, r, w)
+			if err != nil {
+				SendGeneralError(ctx, w, err)
+			}
+			return
+		}
 		resp, respHdr, err := postObject(ctx, userCred, o.Bucket, o.Key, query, r)
 		if err != nil {
 			SendGeneralError(ctx, w, err)
@@ -422,7 +504,8 @@ func putBucket(ctx context.Context, userCred mcclient.TokenCredential, bucket st
 	} else if query.Contains("inventory") {
 
 	} else if query.Contains("lifecycle") {
-
+		err := putBucketLifecycle(ctx, userCred, bucket, r)
+		return nil, nil, err
 	} else if query.Contains("publicAccessBlock") {
 
 	} else if query.Contains("logging") {
@@ -442,7 +525,8 @@ func putBucket(ctx context.Context, userCred mcclient.TokenCredential, bucket st
 	} else if query.Contains("tagging") {
 
 	} else if query.Contains("versioning") {
-
+		err := putBucketVersioning(ctx, userCred, bucket, r)
+		return nil, nil, err
 	} else if query.Contains("website") {
 
 	} else {
@@ -527,7 +611,8 @@ func deleteBucket(ctx context.Context, userCred mcclient.TokenCredential, bucket
 	} else if query.Contains("inventory") {
 
 	} else if query.Contains("lifecycle") {
-
+		err := deleteBucketLifecycle(ctx, userCred, bucket)
+		return nil, err
 	} else if query.Contains("publicAccessBlock") {
 
 	} else if query.Contains("metrics") {
@@ -551,16 +636,21 @@ func deleteBucket(ctx context.Context, userCred mcclient.TokenCredential, bucket
 	return nil, NotImplemented(ctx, "not implemented")
 }
 
-func deleteObject(ctx context.Context, userCred mcclient.TokenCredential, bucket string, key string, query jsonutils.JSONObject) (interface{}, error) {
+func deleteObject(ctx context.Context, userCred mcclient.TokenCredential, bucket string, key string, query jsonutils.JSONObject) (interface{}, http.Header, error) {
 	if query.Contains("tagging") {
-		return deleteObjectTags(ctx, userCred, bucket, key)
+		resp, err := deleteObjectTags(ctx, userCred, bucket, key)
+		return resp, nil, err
+	} else if versionId, _ := query.GetString("versionId"); len(versionId) > 0 {
+		// delete a specific version of object
+		hdr, err := removeObjectVersion(ctx, userCred, bucket, key, versionId)
+		return nil, hdr, err
 	} else {
 		// delete object
 		err := removeObject(ctx, userCred, bucket, key)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		return nil, nil
+		return nil, nil, nil
 	}
 }
 
@@ -590,11 +680,11 @@ func deleteHandler(ctx context.Context, w http.ResponseWriter, r *http.Request)
 			SendError(ctx, w, BadRequest(ctx, err.Error()))
 			return
 		}
-		resp, err := deleteObject(ctx, userCred, o.Bucket, o.Key, query)
+		resp, respHdr, err := deleteObject(ctx, userCred, o.Bucket, o.Key, query)
 		if err != nil {
 			SendGeneralError(ctx, w, err)
 		} else {
-			appsrv.SendXml(w, nil, resp)
+			appsrv.SendXml(w, respHdr, resp)
 		}
 		return
 	}
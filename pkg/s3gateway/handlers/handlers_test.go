@@ -0,0 +1,42 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUnknownObjectQueryParams(t *testing.T) {
+	for _, c := range []struct {
+		query string
+		want  string
+	}{
+		{"versionId=v1", ""},
+		{"response-content-type=text%2Fplain&X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=abc", ""},
+		{"AWSAccessKeyId=ak&Signature=sig&Expires=1", ""},
+		{"uploadId=abc", "uploadId"},
+		{"versionId=v1&partNumber=1&attributes", "attributes,partNumber"},
+	} {
+		query, err := url.ParseQuery(c.query)
+		if err != nil {
+			t.Fatalf("ParseQuery %s: %v", c.query, err)
+		}
+		if got := strings.Join(unknownObjectQueryParams(query), ","); got != c.want {
+			t.Errorf("%s: got %q want %q", c.query, got, c.want)
+		}
+	}
+}
@@ -17,12 +17,14 @@ package handlers
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"yunion.io/x/log"
 	"yunion.io/x/pkg/appctx"
 	"yunion.io/x/pkg/gotypes"
 
 	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/mcclient"
 	"yunion.io/x/onecloud/pkg/mcclient/auth"
 )
 
@@ -40,11 +42,31 @@ func s3authenticate(f appsrv.FilterHandler) appsrv.FilterHandler {
 			return
 		}
 		ctx = context.WithValue(ctx, S3_OBJECT_REQUEST, o)
-		userCred, err := auth.VerifyRequest(*r, o.VirtualHost)
-		if err != nil {
-			SendError(ctx, w, Unauthenticated(ctx, err.Error()))
+		if isPostPolicyRequest(r) {
+			// browser-based upload, the policy in the form is verified by postHandler
+			f(ctx, w, r)
 			return
 		}
+		var userCred mcclient.TokenCredential
+		if isPresignedRequest(r) {
+			aksk, err := decodePresignedRequestV4(r, time.Now().UTC())
+			if err != nil {
+				SendGeneralError(ctx, w, err)
+				return
+			}
+			userCred, err = auth.VerifyAccessKeyRequest(*r, aksk, o.VirtualHost)
+			if err != nil {
+				SendError(ctx, w, Unauthenticated(ctx, err.Error()))
+				return
+			}
+			stripPresignQuery(r)
+		} else {
+			userCred, err = auth.VerifyRequest(*r, o.VirtualHost)
+			if err != nil {
+				SendError(ctx, w, Unauthenticated(ctx, err.Error()))
+				return
+			}
+		}
 		ctx = context.WithValue(ctx, appctx.APP_CONTEXT_KEY_AUTH_TOKEN, userCred)
 
 		f(ctx, w, r)
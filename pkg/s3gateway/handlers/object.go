@@ -34,20 +34,19 @@ import (
 	"yunion.io/x/onecloud/pkg/s3gateway/models"
 )
 
-func headObject(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, key string) (http.Header, error) {
+func headObject(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, key string, versionId string) (http.Header, error) {
 	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
 	if err != nil {
 		return nil, errors.Wrap(err, "models.BucketManager.GetByName")
 	}
-	iBucket, err := bucket.GetIBucket(ctx, userCred)
-	if err != nil {
-		return nil, errors.Wrap(err, "bucket.GetIBucket")
-	}
-	obj, err := cloudprovider.GetIObject(iBucket, key)
+	obj, _, err := getObjectVersion(ctx, userCred, bucket, key, versionId)
 	if err != nil {
-		return nil, errors.Wrap(err, "cloudprovider.GetIObject")
+		return nil, errors.Wrap(err, "getObjectVersion")
 	}
 	hdr := cloudprovider.MetaToHttpHeader(cloudprovider.META_HEADER_PREFIX, obj.GetMeta())
+	if len(versionId) > 0 {
+		hdr.Set("x-amz-version-id", versionId)
+	}
 	hdr.Set(http.CanonicalHeaderKey("x-amz-acl"), string(obj.GetAcl()))
 	hdr.Set(http.CanonicalHeaderKey("x-amz-storage-class"), obj.GetStorageClass())
 	hdr.Set(http.CanonicalHeaderKey("content-length"), strconv.FormatInt(obj.GetSizeBytes(), 10))
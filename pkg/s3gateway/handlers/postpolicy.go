@@ -0,0 +1,449 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/cloudmux/pkg/cloudprovider"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/s3gateway/models"
+	"yunion.io/x/onecloud/pkg/s3gateway/options"
+)
+
+const (
+	// form fields other than the file are small, cap them to avoid
+	// buffering arbitrary data before the policy is verified
+	POST_FORM_FIELD_MAX_BYTES = 64 * 1024
+	POST_FORM_MAX_FIELDS      = 100
+)
+
+// PostResponse is the body returned on success_action_status 201
+type PostResponse struct {
+	XMLName  xml.Name `xml:"PostResponse"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+// isPostPolicyRequest tells whether the request is a browser-based upload
+// with a POST policy, which is authenticated by the signature in the form
+// rather than by the Authorization header
+func isPostPolicyRequest(r *http.Request) bool {
+	if r.Method != http.MethodPost || len(r.Header.Get("Authorization")) > 0 {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "multipart/form-data"
+}
+
+type sPostPolicyCondition struct {
+	op    string
+	field string
+	value string
+
+	min int64
+	max int64
+}
+
+type sPostPolicy struct {
+	Expiration time.Time
+	conditions []sPostPolicyCondition
+}
+
+func parsePostPolicy(policyB64 string) (*sPostPolicy, error) {
+	policyJson, err := base64.StdEncoding.DecodeString(policyB64)
+	if err != nil {
+		return nil, errors.Wrap(httperrors.ErrBadRequest, "policy is not base64 encoded")
+	}
+	raw := struct {
+		Expiration string
+		Conditions []json.RawMessage
+	}{}
+	err = json.Unmarshal(policyJson, &raw)
+	if err != nil {
+		return nil, errors.Wrapf(httperrors.ErrBadRequest, "invalid policy document: %s", err)
+	}
+	policy := &sPostPolicy{}
+	policy.Expiration, err = time.Parse(time.RFC3339Nano, raw.Expiration)
+	if err != nil {
+		return nil, errors.Wrapf(httperrors.ErrBadRequest, "invalid policy expiration %q", raw.Expiration)
+	}
+	for _, c := range raw.Conditions {
+		cond, err := parsePostPolicyCondition(c)
+		if err != nil {
+			return nil, errors.Wrapf(httperrors.ErrBadRequest, "invalid policy condition %s: %s", c, err)
+		}
+		policy.conditions = append(policy.conditions, cond)
+	}
+	return policy, nil
+}
+
+// parsePostPolicyCondition accepts the three forms of condition:
+// {"field": "value"}, ["eq"|"starts-with", "$field", "value"] and
+// ["content-length-range", min, max]
+func parsePostPolicyCondition(data json.RawMessage) (sPostPolicyCondition, error) {
+	cond := sPostPolicyCondition{}
+	exact := map[string]string{}
+	if err := json.Unmarshal(data, &exact); err == nil {
+		if len(exact) != 1 {
+			return cond, errors.Error("exact match condition must have exactly one field")
+		}
+		for k, v := range exact {
+			cond.op = "eq"
+			cond.field = strings.ToLower(k)
+			cond.value = v
+		}
+		return cond, nil
+	}
+	list := []interface{}{}
+	if err := json.Unmarshal(data, &list); err != nil || len(list) != 3 {
+		return cond, errors.Error("condition must be an object or an array of three elements")
+	}
+	op, _ := list[0].(string)
+	cond.op = strings.ToLower(op)
+	switch cond.op {
+	case "eq", "starts-with":
+		field, ok1 := list[1].(string)
+		value, ok2 := list[2].(string)
+		if !ok1 || !ok2 || !strings.HasPrefix(field, "$") {
+			return cond, errors.Errorf("malformed %s condition", cond.op)
+		}
+		cond.field = strings.ToLower(field[1:])
+		cond.value = value
+	case "content-length-range":
+		min, ok1 := list[1].(float64)
+		max, ok2 := list[2].(float64)
+		if !ok1 || !ok2 || min < 0 || max < min {
+			return cond, errors.Error("malformed content-length-range condition")
+		}
+		cond.min = int64(min)
+		cond.max = int64(max)
+	default:
+		return cond, errors.Errorf("unsupported condition %q", op)
+	}
+	return cond, nil
+}
+
+// isPostPolicyExemptField tells whether a form field does not need to be
+// covered by a policy condition
+func isPostPolicyExemptField(field string) bool {
+	switch field {
+	case "policy", "x-amz-signature", "file", "bucket":
+		return true
+	}
+	return strings.HasPrefix(field, "x-ignore-")
+}
+
+// Check verifies the form fields against the policy. Every form field must
+// be matched by at least one condition, and every condition must hold. The
+// bucket field is set from the request, so that bucket conditions apply to
+// the target bucket.
+func (policy *sPostPolicy) Check(fields map[string]string, now time.Time) error {
+	if now.After(policy.Expiration) {
+		return errors.Wrap(httperrors.ErrForbidden, "policy has expired")
+	}
+	covered := map[string]bool{}
+	for _, cond := range policy.conditions {
+		if cond.op == "content-length-range" {
+			continue
+		}
+		covered[cond.field] = true
+		value := fields[cond.field]
+		switch cond.op {
+		case "eq":
+			if value != cond.value {
+				return errors.Wrapf(httperrors.ErrForbidden, "policy condition failed: [\"eq\", \"$%s\", %q]", cond.field, cond.value)
+			}
+		case "starts-with":
+			if !postPolicyStartsWith(cond.field, value, cond.value) {
+				return errors.Wrapf(httperrors.ErrForbidden, "policy condition failed: [\"starts-with\", \"$%s\", %q]", cond.field, cond.value)
+			}
+		}
+	}
+	for field := range fields {
+		if !covered[field] && !isPostPolicyExemptField(field) {
+			return errors.Wrapf(httperrors.ErrForbidden, "extra input field %s not covered by policy", field)
+		}
+	}
+	return nil
+}
+
+func postPolicyStartsWith(field string, value string, prefix string) bool {
+	if field == "content-type" {
+		// each of the comma separated content types must match
+		for _, v := range strings.Split(value, ",") {
+			if !strings.HasPrefix(strings.TrimSpace(v), prefix) {
+				return false
+			}
+		}
+		return true
+	}
+	return strings.HasPrefix(value, prefix)
+}
+
+// ContentLengthRange returns the allowed object size range, the gateway wide
+// limit applies when the policy does not restrict it
+func (policy *sPostPolicy) ContentLengthRange() (int64, int64) {
+	min, max := int64(0), int64(options.Options.PostObjectMaxSizeMb)*1024*1024
+	for _, cond := range policy.conditions {
+		if cond.op == "content-length-range" {
+			if cond.min > min {
+				min = cond.min
+			}
+			if cond.max < max {
+				max = cond.max
+			}
+		}
+	}
+	return min, max
+}
+
+type sPostForm struct {
+	fields   map[string]string
+	fileName string
+	file     io.Reader
+}
+
+// readPostForm reads the form fields up to the file, which must be the last
+// field of the form. The file content is left unread in the returned form.
+func readPostForm(r *http.Request) (*sPostForm, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, errors.Wrap(httperrors.ErrBadRequest, "MultipartReader")
+	}
+	form := &sPostForm{
+		fields: map[string]string{},
+	}
+	for i := 0; i < POST_FORM_MAX_FIELDS; i++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.Wrap(httperrors.ErrBadRequest, "missing file field")
+		} else if err != nil {
+			return nil, errors.Wrap(httperrors.ErrBadRequest, "NextPart")
+		}
+		name := strings.ToLower(part.FormName())
+		if name == "file" {
+			form.fileName = part.FileName()
+			form.file = part
+			return form, nil
+		}
+		value, err := ioutil.ReadAll(io.LimitReader(part, POST_FORM_FIELD_MAX_BYTES+1))
+		if err != nil {
+			return nil, errors.Wrapf(httperrors.ErrBadRequest, "read field %s", name)
+		}
+		if len(value) > POST_FORM_FIELD_MAX_BYTES {
+			return nil, errors.Wrapf(httperrors.ErrBadRequest, "field %s too large", name)
+		}
+		form.fields[name] = string(value)
+	}
+	return nil, errors.Wrap(httperrors.ErrBadRequest, "too many form fields")
+}
+
+// verifyPostPolicy checks the policy signature with the access key secret
+// known by keystone and returns the credential of the access key owner
+func verifyPostPolicy(r *http.Request, virtualHost bool, fields map[string]string) (mcclient.TokenCredential, error) {
+	if algo := fields["x-amz-algorithm"]; algo != SIGN_V4_ALGORITHM {
+		return nil, errors.Wrapf(httperrors.ErrBadRequest, "unsupported x-amz-algorithm %q", algo)
+	}
+	cred, err := parseAmzCredential(fields["x-amz-credential"])
+	if err != nil {
+		return nil, err
+	}
+	signDate, err := parseAmzDate(fields["x-amz-date"], cred)
+	if err != nil {
+		return nil, err
+	}
+	signature := fields["x-amz-signature"]
+	if len(signature) == 0 {
+		return nil, errors.Wrap(httperrors.ErrBadRequest, "missing x-amz-signature")
+	}
+	// the string to sign of a POST policy is the base64 encoded policy itself
+	aksk := newAccessKeyRequestV4(cred, signDate, signature, fields["policy"])
+	userCred, err := auth.VerifyAccessKeyRequest(*r, aksk, virtualHost)
+	if err != nil {
+		return nil, errors.Wrap(httperrors.ErrUnauthenticated, err.Error())
+	}
+	return userCred, nil
+}
+
+// spoolPostFile saves the uploaded file to a temporary file, as the object
+// size must be known before uploading to the backend
+func spoolPostFile(file io.Reader, min int64, max int64) (*os.File, int64, error) {
+	tmp, err := ioutil.TempFile("", "s3gateway-post")
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "TempFile")
+	}
+	os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, io.LimitReader(file, max+1))
+	if err != nil {
+		tmp.Close()
+		return nil, 0, errors.Wrap(err, "spool file")
+	}
+	if size < min || size > max {
+		tmp.Close()
+		return nil, 0, errors.Wrapf(httperrors.ErrBadRequest, "object size is not within content-length-range [%d, %d]", min, max)
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		tmp.Close()
+		return nil, 0, errors.Wrap(err, "Seek")
+	}
+	return tmp, size, nil
+}
+
+// postPolicyObject handles a browser-based upload: the form carries the
+// object key, its metadata, a POST policy restricting them and a SigV4
+// signature of the policy issued with keystone S3 credentials.
+func postPolicyObject(ctx context.Context, o SObjectRequest, r *http.Request, w http.ResponseWriter) error {
+	form, err := readPostForm(r)
+	if err != nil {
+		return err
+	}
+	fields := form.fields
+	fields["bucket"] = o.Bucket
+	key, ok := fields["key"]
+	if !ok {
+		if len(o.Key) == 0 {
+			return errors.Wrap(httperrors.ErrBadRequest, "missing key field")
+		}
+		key = o.Key
+		fields["key"] = key
+	}
+	key = strings.Replace(key, "${filename}", form.fileName, -1)
+	if len(key) == 0 {
+		return errors.Wrap(httperrors.ErrBadRequest, "empty key")
+	}
+
+	policyStr, ok := fields["policy"]
+	if !ok {
+		return errors.Wrap(httperrors.ErrForbidden, "anonymous POST upload is not allowed")
+	}
+	userCred, err := verifyPostPolicy(r, o.VirtualHost, fields)
+	if err != nil {
+		return err
+	}
+	policy, err := parsePostPolicy(policyStr)
+	if err != nil {
+		return err
+	}
+	err = policy.Check(fields, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, o.Bucket)
+	if err != nil {
+		return errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	err = bucket.IsOutOfLimit()
+	if err != nil {
+		return errors.Wrap(err, "IsOutOfLimit")
+	}
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "bucket.GetIBucket")
+	}
+
+	min, max := policy.ContentLengthRange()
+	file, size, err := spoolPostFile(form.file, min, max)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hdr := http.Header{}
+	for k, v := range fields {
+		if strings.HasPrefix(k, "x-amz-meta-") {
+			hdr.Set(cloudprovider.META_HEADER_PREFIX+k[len("x-amz-meta-"):], v)
+			continue
+		}
+		switch k {
+		case "content-type", "content-encoding", "content-disposition", "content-language", "cache-control":
+			hdr.Set(k, v)
+		}
+	}
+	meta := cloudprovider.FetchMetaFromHttpHeader(cloudprovider.META_HEADER_PREFIX, hdr)
+	err = iBucket.PutObject(ctx, key, file, size, cloudprovider.TBucketACLType(fields["acl"]), fields["x-amz-storage-class"], meta)
+	if err != nil {
+		return errors.Wrap(err, "iBucket.PutObject")
+	}
+	bucket.Invalidate()
+	obj, err := cloudprovider.GetIObject(iBucket, key)
+	if err != nil {
+		return errors.Wrap(err, "cloudprovider.GetIObject")
+	}
+	etag := obj.GetETag()
+
+	if redirect, ok := fields["success_action_redirect"]; ok && len(redirect) > 0 {
+		redirectUrl, err := url.Parse(redirect)
+		if err == nil {
+			query := redirectUrl.Query()
+			query.Set("bucket", o.Bucket)
+			query.Set("key", key)
+			query.Set("etag", etag)
+			redirectUrl.RawQuery = query.Encode()
+			w.Header().Set("Location", redirectUrl.String())
+			w.WriteHeader(http.StatusSeeOther)
+			return nil
+		}
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Location", fmt.Sprintf("/%s/%s", o.Bucket, encodeAmzPath(key)))
+	status, _ := strconv.Atoi(fields["success_action_status"])
+	switch status {
+	case http.StatusOK:
+		w.WriteHeader(http.StatusOK)
+	case http.StatusCreated:
+		body, err := xml.Marshal(&PostResponse{
+			Location: w.Header().Get("Location"),
+			Bucket:   o.Bucket,
+			Key:      key,
+			ETag:     etag,
+		})
+		if err != nil {
+			return errors.Wrap(err, "xml.Marshal")
+		}
+		w.Header().Set("Content-Type", "application/xml;charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(xml.Header))
+		w.Write(body)
+	default:
+		appsrv.SendNoContent(w)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/s3auth"
+
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+const (
+	SIGN_V4_ALGORITHM = "AWS4-HMAC-SHA256"
+
+	AMZ_DATE_FORMAT = "20060102T150405Z"
+	AMZ_DAY_FORMAT  = "20060102"
+
+	UNSIGNED_PAYLOAD = "UNSIGNED-PAYLOAD"
+
+	// presigned URLs are valid for at most 7 days
+	PRESIGN_MAX_EXPIRES = 7 * 24 * 3600
+	// tolerated clock skew between the signer and the gateway
+	PRESIGN_MAX_CLOCK_SKEW = 15 * time.Minute
+
+	AMZ_QUERY_ALGORITHM      = "X-Amz-Algorithm"
+	AMZ_QUERY_CREDENTIAL     = "X-Amz-Credential"
+	AMZ_QUERY_DATE           = "X-Amz-Date"
+	AMZ_QUERY_EXPIRES        = "X-Amz-Expires"
+	AMZ_QUERY_SIGNED_HEADERS = "X-Amz-SignedHeaders"
+	AMZ_QUERY_SIGNATURE      = "X-Amz-Signature"
+	AMZ_QUERY_CONTENT_SHA256 = "X-Amz-Content-Sha256"
+)
+
+// isPresignedRequest tells whether the request carries its SigV4 signature
+// in the query string rather than in the Authorization header
+func isPresignedRequest(r *http.Request) bool {
+	return len(r.URL.Query().Get(AMZ_QUERY_SIGNATURE)) > 0
+}
+
+// sAmzCredential is the parsed form of <access-key>/<date>/<region>/s3/aws4_request
+type sAmzCredential struct {
+	AccessKey string
+	Day       string
+	Region    string
+}
+
+func parseAmzCredential(cred string) (sAmzCredential, error) {
+	ret := sAmzCredential{}
+	parts := strings.Split(cred, "/")
+	if len(parts) != 5 || len(parts[0]) == 0 || parts[3] != "s3" || parts[4] != "aws4_request" {
+		return ret, errors.Wrapf(httperrors.ErrBadRequest, "malformed credential %q", cred)
+	}
+	ret.AccessKey = parts[0]
+	ret.Day = parts[1]
+	ret.Region = parts[2]
+	return ret, nil
+}
+
+func (cred sAmzCredential) scope() string {
+	return strings.Join([]string{cred.Day, cred.Region, "s3", "aws4_request"}, "/")
+}
+
+// parseAmzDate parses the signing time and checks that it agrees with the
+// date in the credential scope
+func parseAmzDate(dateStr string, cred sAmzCredential) (time.Time, error) {
+	signDate, err := time.Parse(AMZ_DATE_FORMAT, dateStr)
+	if err != nil {
+		return signDate, errors.Wrapf(httperrors.ErrBadRequest, "malformed %s %q", AMZ_QUERY_DATE, dateStr)
+	}
+	if signDate.Format(AMZ_DAY_FORMAT) != cred.Day {
+		return signDate, errors.Wrap(httperrors.ErrBadRequest, "credential date does not match signing date")
+	}
+	return signDate, nil
+}
+
+func newAccessKeyRequestV4(cred sAmzCredential, signDate time.Time, signature string, request string) *s3auth.SAccessKeyRequestV4 {
+	aksk := s3auth.NewV4Request()
+	aksk.AccessKey = cred.AccessKey
+	aksk.Location = cred.Region
+	aksk.SignDate = signDate
+	aksk.Signature = signature
+	aksk.Request = request
+	return &aksk
+}
+
+// decodePresignedRequestV4 builds the access key request of a SigV4
+// presigned URL, so that the signature can be verified by keystone the same
+// way as a header-signed request. Expired or not yet valid URLs are refused
+// here, before any credential lookup.
+func decodePresignedRequestV4(r *http.Request, now time.Time) (*s3auth.SAccessKeyRequestV4, error) {
+	query := r.URL.Query()
+	if algo := query.Get(AMZ_QUERY_ALGORITHM); algo != SIGN_V4_ALGORITHM {
+		return nil, errors.Wrapf(httperrors.ErrBadRequest, "unsupported %s %q", AMZ_QUERY_ALGORITHM, algo)
+	}
+	cred, err := parseAmzCredential(query.Get(AMZ_QUERY_CREDENTIAL))
+	if err != nil {
+		return nil, err
+	}
+	signDate, err := parseAmzDate(query.Get(AMZ_QUERY_DATE), cred)
+	if err != nil {
+		return nil, err
+	}
+	expires, err := strconv.ParseInt(query.Get(AMZ_QUERY_EXPIRES), 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(httperrors.ErrBadRequest, "malformed %s", AMZ_QUERY_EXPIRES)
+	}
+	if expires <= 0 || expires > PRESIGN_MAX_EXPIRES {
+		return nil, errors.Wrapf(httperrors.ErrBadRequest, "%s must be between 1 and %d seconds", AMZ_QUERY_EXPIRES, PRESIGN_MAX_EXPIRES)
+	}
+	if signDate.After(now.Add(PRESIGN_MAX_CLOCK_SKEW)) {
+		return nil, errors.Wrap(httperrors.ErrForbidden, "request is not valid yet")
+	}
+	if now.After(signDate.Add(time.Duration(expires) * time.Second)) {
+		return nil, errors.Wrap(httperrors.ErrForbidden, "request has expired")
+	}
+	signedHeaders := strings.Split(query.Get(AMZ_QUERY_SIGNED_HEADERS), ";")
+	sort.Strings(signedHeaders)
+	hasHost := false
+	for _, h := range signedHeaders {
+		if h == "host" {
+			hasHost = true
+			break
+		}
+	}
+	if !hasHost {
+		return nil, errors.Wrapf(httperrors.ErrBadRequest, "%s must include host", AMZ_QUERY_SIGNED_HEADERS)
+	}
+	signature := query.Get(AMZ_QUERY_SIGNATURE)
+
+	query.Del(AMZ_QUERY_SIGNATURE)
+	payloadHash := query.Get(AMZ_QUERY_CONTENT_SHA256)
+	if len(payloadHash) == 0 {
+		payloadHash = UNSIGNED_PAYLOAD
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		encodeAmzPath(r.URL.Path),
+		strings.Replace(query.Encode(), "+", "%20", -1),
+		canonicalAmzHeaders(r, signedHeaders),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		SIGN_V4_ALGORITHM,
+		signDate.Format(AMZ_DATE_FORMAT),
+		cred.scope(),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+	aksk := newAccessKeyRequestV4(cred, signDate, signature, stringToSign)
+	aksk.SignedHeaders = signedHeaders
+	return aksk, nil
+}
+
+func canonicalAmzHeaders(r *http.Request, signedHeaders []string) string {
+	var buf bytes.Buffer
+	for _, k := range signedHeaders {
+		buf.WriteString(k)
+		buf.WriteByte(':')
+		if k == "host" {
+			buf.WriteString(r.Host)
+		} else {
+			for i, v := range r.Header[http.CanonicalHeaderKey(k)] {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				buf.WriteString(strings.Join(strings.Fields(v), " "))
+			}
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// encodeAmzPath escapes every byte of the path except the unreserved
+// characters of RFC 3986 and the path separator
+func encodeAmzPath(path string) string {
+	var buf strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' {
+			buf.WriteByte(c)
+			continue
+		}
+		switch c {
+		case '-', '_', '.', '~', '/':
+			buf.WriteByte(c)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+// stripPresignQuery removes the authentication parameters of a presigned
+// URL so that they are not taken as subresources by the handlers
+func stripPresignQuery(r *http.Request) {
+	query := r.URL.Query()
+	for _, k := range []string{
+		AMZ_QUERY_ALGORITHM,
+		AMZ_QUERY_CREDENTIAL,
+		AMZ_QUERY_DATE,
+		AMZ_QUERY_EXPIRES,
+		AMZ_QUERY_SIGNED_HEADERS,
+		AMZ_QUERY_SIGNATURE,
+		AMZ_QUERY_CONTENT_SHA256,
+		"X-Amz-Security-Token",
+	} {
+		query.Del(k)
+	}
+	r.URL.RawQuery = query.Encode()
+}
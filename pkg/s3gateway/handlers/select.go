@@ -16,13 +16,93 @@ package handlers
 
 import (
 	"context"
+	"io"
 	"net/http"
 
+	"yunion.io/x/cloudmux/pkg/cloudprovider"
+	"yunion.io/x/pkg/errors"
 	"yunion.io/x/s3cli"
 
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/s3gateway/models"
+	"yunion.io/x/onecloud/pkg/s3gateway/s3select"
 )
 
-func selectObject(ctx context.Context, userCred mcclient.TokenCredential, hdr http.Header, bucket string, key string) (*s3cli.InitiateMultipartUploadResult, http.Header, error) {
-	return nil, nil, NotImplemented(ctx, "")
+// sSelectObjectSource adapts a cloudprovider bucket object to the
+// s3select.IObjectSource interface, using ranged GetObject for random access
+type sSelectObjectSource struct {
+	ctx     context.Context
+	iBucket cloudprovider.ICloudBucket
+	key     string
+	size    int64
+}
+
+func (s *sSelectObjectSource) Size() int64 {
+	return s.size
+}
+
+func (s *sSelectObjectSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	return s.iBucket.GetObject(ctx, s.key, nil)
+}
+
+func (s *sSelectObjectSource) ReadAt(p []byte, off int64) (int, error) {
+	if off >= s.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p)) - 1
+	if end >= s.size {
+		end = s.size - 1
+	}
+	stream, err := s.iBucket.GetObject(s.ctx, s.key, &cloudprovider.SGetObjectRange{Start: off, End: end})
+	if err != nil {
+		return 0, errors.Wrap(err, "iBucket.GetObject")
+	}
+	defer stream.Close()
+	n, err := io.ReadFull(stream, p[:end-off+1])
+	if err != nil {
+		return n, errors.Wrap(err, "io.ReadFull")
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func selectObject(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, key string, r *http.Request, w http.ResponseWriter) error {
+	request := s3cli.SelectObjectOptions{}
+	err := appsrv.FetchXml(r, &request)
+	if err != nil {
+		return errors.Wrap(httperrors.ErrBadRequest, "FetchXml")
+	}
+	selector, err := s3select.NewSelector(&request)
+	if err != nil {
+		return errors.Wrap(httperrors.ErrBadRequest, err.Error())
+	}
+
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "bucket.GetIBucket")
+	}
+	obj, err := cloudprovider.GetIObject(iBucket, key)
+	if err != nil {
+		return errors.Wrap(err, "cloudprovider.GetIObject")
+	}
+	source := &sSelectObjectSource{
+		ctx:     ctx,
+		iBucket: iBucket,
+		key:     key,
+		size:    obj.GetSizeBytes(),
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	// errors are reported inside the event stream once the response started
+	selector.Run(ctx, source, w)
+	return nil
 }
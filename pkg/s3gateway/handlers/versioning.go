@@ -0,0 +1,114 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"yunion.io/x/cloudmux/pkg/cloudprovider"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/s3cli"
+
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/s3gateway/models"
+)
+
+func putBucketVersioning(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, r *http.Request) error {
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	conf := s3cli.VersioningConfiguration{}
+	err = appsrv.FetchXml(r, &conf)
+	if err != nil {
+		return errors.Wrap(httperrors.ErrBadRequest, "FetchXml")
+	}
+	return bucket.SetVersioning(ctx, userCred, &conf)
+}
+
+// getObjectVersion resolves the object addressed by versionId. An empty
+// versionId, or "null" on a bucket that has never been versioned, refers to
+// the current object and returns a nil versioning bucket.
+func getObjectVersion(ctx context.Context, userCred mcclient.TokenCredential, bucket *models.SBucketDelegate, key string, versionId string) (cloudprovider.ICloudObject, models.ICloudVersioningBucket, error) {
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "bucket.GetIBucket")
+	}
+	vBucket, isVersioned := models.GetIVersioningBucket(iBucket)
+	if len(versionId) == 0 || (!isVersioned && versionId == models.NULL_VERSION_ID) {
+		obj, err := cloudprovider.GetIObject(iBucket, key)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "cloudprovider.GetIObject")
+		}
+		return obj, nil, nil
+	}
+	if !isVersioned {
+		return nil, nil, errors.Wrapf(httperrors.ErrNotFound, "version %s of %s", versionId, key)
+	}
+	obj, err := vBucket.GetIObjectVersion(key, versionId)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "GetIObjectVersion")
+	}
+	return obj, vBucket, nil
+}
+
+func getObjectVersionStream(ctx context.Context, userCred mcclient.TokenCredential, bucket *models.SBucketDelegate, key string, versionId string, rangeOpt *cloudprovider.SGetObjectRange) (io.ReadCloser, error) {
+	_, vBucket, err := getObjectVersion(ctx, userCred, bucket, key, versionId)
+	if err != nil {
+		return nil, err
+	}
+	if vBucket != nil {
+		return vBucket.GetObjectVersion(ctx, key, versionId, rangeOpt)
+	}
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return nil, errors.Wrap(err, "bucket.GetIBucket")
+	}
+	return iBucket.GetObject(ctx, key, rangeOpt)
+}
+
+func removeObjectVersion(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, key string, versionId string) (http.Header, error) {
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return nil, errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return nil, errors.Wrap(err, "bucket.GetIBucket")
+	}
+	vBucket, isVersioned := models.GetIVersioningBucket(iBucket)
+	if !isVersioned {
+		if versionId != models.NULL_VERSION_ID {
+			return nil, errors.Wrapf(httperrors.ErrNotFound, "version %s of %s", versionId, key)
+		}
+		err = iBucket.DeleteObject(ctx, key)
+		if err != nil {
+			return nil, errors.Wrap(err, "DeleteObject")
+		}
+	} else {
+		err = vBucket.DeleteObjectVersion(ctx, key, versionId)
+		if err != nil {
+			return nil, errors.Wrap(err, "DeleteObjectVersion")
+		}
+	}
+	bucket.Invalidate()
+	hdr := http.Header{}
+	hdr.Set("x-amz-version-id", versionId)
+	return hdr, nil
+}
@@ -103,6 +103,10 @@ type SBucketDelegate struct {
 }
 
 func (manager *SBucketManagerDelegate) List(ctx context.Context, userCred mcclient.TokenCredential) ([]*SBucketDelegate, error) {
+	return manager.list(ctx, userCred, "")
+}
+
+func (manager *SBucketManagerDelegate) list(ctx context.Context, userCred mcclient.TokenCredential, scope string) ([]*SBucketDelegate, error) {
 	s := session.GetSession(ctx, userCred)
 	offset := 0
 	total := -1
@@ -111,9 +115,11 @@ func (manager *SBucketManagerDelegate) List(ctx context.Context, userCred mcclie
 		params := struct {
 			Limit  int
 			Offset int
+			Scope  string
 		}{}
 		params.Limit = 1000
 		params.Offset = offset
+		params.Scope = scope
 		result, err := modules.Buckets.List(s, jsonutils.Marshal(params))
 		if err != nil {
 			return nil, errors.Wrap(err, "List")
@@ -0,0 +1,424 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"encoding/xml"
+	"strings"
+	"time"
+
+	"yunion.io/x/cloudmux/pkg/cloudprovider"
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	modules "yunion.io/x/onecloud/pkg/mcclient/modules/compute"
+	"yunion.io/x/onecloud/pkg/s3gateway/session"
+)
+
+const (
+	// the lifecycle configuration is kept in the metadata of the compute bucket
+	BUCKET_METADATA_LIFECYCLE = "s3gateway_lifecycle"
+
+	LIFECYCLE_RULE_ENABLED  = "Enabled"
+	LIFECYCLE_RULE_DISABLED = "Disabled"
+
+	MAX_LIFECYCLE_RULES = 1000
+
+	lifecycleListPageSize = 1000
+)
+
+type LifecycleFilter struct {
+	Prefix string `xml:",omitempty"`
+}
+
+type LifecycleExpiration struct {
+	Days int        `xml:",omitempty"`
+	Date *time.Time `xml:",omitempty"`
+}
+
+type LifecycleTransition struct {
+	Days         int        `xml:",omitempty"`
+	Date         *time.Time `xml:",omitempty"`
+	StorageClass string
+}
+
+type LifecycleNoncurrentVersionExpiration struct {
+	NoncurrentDays int
+}
+
+type LifecycleAbortIncompleteMultipartUpload struct {
+	DaysAfterInitiation int
+}
+
+type LifecycleRule struct {
+	ID     string `xml:",omitempty"`
+	Status string
+	// Prefix is the legacy form of Filter.Prefix
+	Prefix string           `xml:",omitempty"`
+	Filter *LifecycleFilter `xml:",omitempty"`
+
+	Expiration                     *LifecycleExpiration                     `xml:",omitempty"`
+	Transition                     []LifecycleTransition                    `xml:",omitempty"`
+	NoncurrentVersionExpiration    *LifecycleNoncurrentVersionExpiration    `xml:",omitempty"`
+	AbortIncompleteMultipartUpload *LifecycleAbortIncompleteMultipartUpload `xml:",omitempty"`
+}
+
+type LifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration" json:"-"`
+	Rule    []LifecycleRule `xml:"Rule"`
+}
+
+func (rule *LifecycleRule) GetPrefix() string {
+	if rule.Filter != nil {
+		return rule.Filter.Prefix
+	}
+	return rule.Prefix
+}
+
+func (rule *LifecycleRule) IsEnabled() bool {
+	return rule.Status == LIFECYCLE_RULE_ENABLED
+}
+
+func (rule *LifecycleRule) Validate() error {
+	if len(rule.ID) > 255 {
+		return errors.Wrap(httperrors.ErrBadRequest, "rule ID too long")
+	}
+	if rule.Status != LIFECYCLE_RULE_ENABLED && rule.Status != LIFECYCLE_RULE_DISABLED {
+		return errors.Wrapf(httperrors.ErrBadRequest, "invalid rule status %q", rule.Status)
+	}
+	if rule.Filter != nil && len(rule.Prefix) > 0 {
+		return errors.Wrap(httperrors.ErrBadRequest, "Prefix and Filter cannot be used together")
+	}
+	if rule.Expiration == nil && len(rule.Transition) == 0 && rule.NoncurrentVersionExpiration == nil && rule.AbortIncompleteMultipartUpload == nil {
+		return errors.Wrapf(httperrors.ErrBadRequest, "rule %s has no action", rule.ID)
+	}
+	if rule.Expiration != nil {
+		if (rule.Expiration.Days > 0) == (rule.Expiration.Date != nil) {
+			return errors.Wrap(httperrors.ErrBadRequest, "exactly one of Expiration Days or Date is required")
+		}
+		if rule.Expiration.Days < 0 {
+			return errors.Wrap(httperrors.ErrBadRequest, "Expiration Days must be positive")
+		}
+	}
+	for _, t := range rule.Transition {
+		if (t.Days > 0) == (t.Date != nil) {
+			return errors.Wrap(httperrors.ErrBadRequest, "exactly one of Transition Days or Date is required")
+		}
+		if len(t.StorageClass) == 0 {
+			return errors.Wrap(httperrors.ErrBadRequest, "Transition StorageClass is required")
+		}
+		if rule.Expiration != nil && rule.Expiration.Days > 0 && t.Days >= rule.Expiration.Days {
+			return errors.Wrap(httperrors.ErrBadRequest, "Transition Days must be less than Expiration Days")
+		}
+	}
+	if rule.NoncurrentVersionExpiration != nil && rule.NoncurrentVersionExpiration.NoncurrentDays <= 0 {
+		return errors.Wrap(httperrors.ErrBadRequest, "NoncurrentDays must be positive")
+	}
+	if rule.AbortIncompleteMultipartUpload != nil && rule.AbortIncompleteMultipartUpload.DaysAfterInitiation <= 0 {
+		return errors.Wrap(httperrors.ErrBadRequest, "DaysAfterInitiation must be positive")
+	}
+	return nil
+}
+
+func (conf *LifecycleConfiguration) Validate() error {
+	if len(conf.Rule) == 0 {
+		return errors.Wrap(httperrors.ErrBadRequest, "at least one rule is required")
+	}
+	if len(conf.Rule) > MAX_LIFECYCLE_RULES {
+		return errors.Wrapf(httperrors.ErrBadRequest, "too many rules, max %d", MAX_LIFECYCLE_RULES)
+	}
+	ids := make(map[string]bool)
+	for i := range conf.Rule {
+		rule := &conf.Rule[i]
+		if len(rule.ID) > 0 {
+			if ids[rule.ID] {
+				return errors.Wrapf(httperrors.ErrBadRequest, "duplicate rule ID %s", rule.ID)
+			}
+			ids[rule.ID] = true
+		}
+		err := rule.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isDue(days int, date *time.Time, since time.Time, now time.Time) bool {
+	if date != nil {
+		return !now.Before(*date)
+	}
+	return days > 0 && !now.Before(since.Add(time.Duration(days)*24*time.Hour))
+}
+
+// ObjectAction returns whether an object should be expired, or the storage
+// class it should be transitioned to, according to the enabled rules.
+func (conf *LifecycleConfiguration) ObjectAction(key string, lastModified time.Time, storageClass string, now time.Time) (bool, string) {
+	transitionClass := ""
+	var transitionAt time.Time
+	for i := range conf.Rule {
+		rule := &conf.Rule[i]
+		if !rule.IsEnabled() || !strings.HasPrefix(key, rule.GetPrefix()) {
+			continue
+		}
+		if rule.Expiration != nil && isDue(rule.Expiration.Days, rule.Expiration.Date, lastModified, now) {
+			return true, ""
+		}
+		for _, t := range rule.Transition {
+			if !isDue(t.Days, t.Date, lastModified, now) {
+				continue
+			}
+			// the latest due transition wins
+			at := lastModified.Add(time.Duration(t.Days) * 24 * time.Hour)
+			if t.Date != nil {
+				at = *t.Date
+			}
+			if len(transitionClass) == 0 || at.After(transitionAt) {
+				transitionClass = t.StorageClass
+				transitionAt = at
+			}
+		}
+	}
+	if strings.EqualFold(transitionClass, storageClass) {
+		transitionClass = ""
+	}
+	return false, transitionClass
+}
+
+func (conf *LifecycleConfiguration) hasObjectRules() bool {
+	for i := range conf.Rule {
+		if conf.Rule[i].IsEnabled() && (conf.Rule[i].Expiration != nil || len(conf.Rule[i].Transition) > 0) {
+			return true
+		}
+	}
+	return false
+}
+
+func (bucket *SBucketDelegate) GetLifecycle(ctx context.Context, userCred mcclient.TokenCredential) (*LifecycleConfiguration, error) {
+	s := session.GetSession(ctx, userCred)
+	meta, err := modules.Buckets.GetMetadata(s, bucket.Id, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "modules.Buckets.GetMetadata")
+	}
+	confStr, _ := meta.GetString(BUCKET_METADATA_LIFECYCLE)
+	if len(confStr) == 0 {
+		return nil, nil
+	}
+	confJson, err := jsonutils.ParseString(confStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "jsonutils.ParseString")
+	}
+	conf := &LifecycleConfiguration{}
+	err = confJson.Unmarshal(conf)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal LifecycleConfiguration")
+	}
+	return conf, nil
+}
+
+func (bucket *SBucketDelegate) SetLifecycle(ctx context.Context, userCred mcclient.TokenCredential, conf *LifecycleConfiguration) error {
+	err := conf.Validate()
+	if err != nil {
+		return err
+	}
+	return bucket.setLifecycleMetadata(ctx, userCred, jsonutils.Marshal(conf).String())
+}
+
+func (bucket *SBucketDelegate) DeleteLifecycle(ctx context.Context, userCred mcclient.TokenCredential) error {
+	return bucket.setLifecycleMetadata(ctx, userCred, "")
+}
+
+func (bucket *SBucketDelegate) setLifecycleMetadata(ctx context.Context, userCred mcclient.TokenCredential, val string) error {
+	s := session.GetSession(ctx, userCred)
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.NewString(val), BUCKET_METADATA_LIFECYCLE)
+	_, err := modules.Buckets.SetMetadata(s, bucket.Id, params)
+	if err != nil {
+		return errors.Wrap(err, "modules.Buckets.SetMetadata")
+	}
+	return nil
+}
+
+// ApplyLifecycleRules is the periodic worker that enforces the lifecycle
+// configuration of every bucket: expiring and transitioning objects,
+// removing noncurrent versions and aborting stale multipart uploads.
+func (manager *SBucketManagerDelegate) ApplyLifecycleRules(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	buckets, err := manager.list(ctx, userCred, "system")
+	if err != nil {
+		log.Errorf("ApplyLifecycleRules list buckets: %s", err)
+		return
+	}
+	now := time.Now()
+	for _, bucket := range buckets {
+		conf, err := bucket.GetLifecycle(ctx, userCred)
+		if err != nil {
+			log.Errorf("bucket %s GetLifecycle: %s", bucket.Name, err)
+			continue
+		}
+		if conf == nil {
+			continue
+		}
+		err = bucket.applyLifecycle(ctx, userCred, conf, now)
+		if err != nil {
+			log.Errorf("bucket %s applyLifecycle: %s", bucket.Name, err)
+		}
+	}
+}
+
+func (bucket *SBucketDelegate) applyLifecycle(ctx context.Context, userCred mcclient.TokenCredential, conf *LifecycleConfiguration, now time.Time) error {
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "bucket.GetIBucket")
+	}
+	changed := false
+	defer func() {
+		if changed {
+			bucket.Invalidate()
+		}
+	}()
+
+	errs := make([]error, 0)
+	if conf.hasObjectRules() {
+		marker := ""
+		for {
+			result, err := iBucket.ListObjects("", marker, "", lifecycleListPageSize)
+			if err != nil {
+				return errors.Wrap(err, "ListObjects")
+			}
+			for _, obj := range result.Objects {
+				key := obj.GetKey()
+				expire, storageClass := conf.ObjectAction(key, obj.GetLastModified(), obj.GetStorageClass(), now)
+				if expire {
+					log.Infof("lifecycle: expire %s/%s", bucket.Name, key)
+					err = iBucket.DeleteObject(ctx, key)
+					if err != nil {
+						errs = append(errs, errors.Wrapf(err, "DeleteObject %s", key))
+					}
+					changed = true
+				} else if len(storageClass) > 0 {
+					log.Infof("lifecycle: transition %s/%s %s => %s", bucket.Name, key, obj.GetStorageClass(), storageClass)
+					err = iBucket.CopyObject(ctx, key, iBucket.GetName(), key, obj.GetAcl(), storageClass, obj.GetMeta())
+					if err != nil {
+						errs = append(errs, errors.Wrapf(err, "transition %s", key))
+					}
+				}
+			}
+			if !result.IsTruncated || len(result.Objects) == 0 {
+				break
+			}
+			marker = result.NextMarker
+			if len(marker) == 0 {
+				marker = result.Objects[len(result.Objects)-1].GetKey()
+			}
+		}
+	}
+
+	err = bucket.expireNoncurrentVersions(ctx, iBucket, conf, now)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = bucket.abortIncompleteUploads(ctx, iBucket, conf, now)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return errors.NewAggregate(errs)
+}
+
+func (bucket *SBucketDelegate) expireNoncurrentVersions(ctx context.Context, iBucket cloudprovider.ICloudBucket, conf *LifecycleConfiguration, now time.Time) error {
+	vBucket, ok := GetIVersioningBucket(iBucket)
+	if !ok {
+		return nil
+	}
+	for i := range conf.Rule {
+		rule := &conf.Rule[i]
+		if !rule.IsEnabled() || rule.NoncurrentVersionExpiration == nil {
+			continue
+		}
+		keyMarker, versionMarker := "", ""
+		// versions of a key are listed newest first, a version becomes
+		// noncurrent when its successor is created
+		lastKey := ""
+		var successorTime time.Time
+		for {
+			result, nextVersionMarker, err := vBucket.ListObjectVersions(rule.GetPrefix(), keyMarker, versionMarker, "", lifecycleListPageSize)
+			if err != nil {
+				return errors.Wrap(err, "ListObjectVersions")
+			}
+			for _, obj := range result.Objects {
+				v, ok := obj.(ICloudObjectVersion)
+				if !ok {
+					continue
+				}
+				if v.GetKey() != lastKey {
+					lastKey = v.GetKey()
+					successorTime = v.GetLastModified()
+					continue
+				}
+				noncurrentSince := successorTime
+				successorTime = v.GetLastModified()
+				if isDue(rule.NoncurrentVersionExpiration.NoncurrentDays, nil, noncurrentSince, now) {
+					log.Infof("lifecycle: expire noncurrent version %s/%s@%s", bucket.Name, v.GetKey(), v.GetVersionId())
+					err = vBucket.DeleteObjectVersion(ctx, v.GetKey(), v.GetVersionId())
+					if err != nil {
+						return errors.Wrapf(err, "DeleteObjectVersion %s %s", v.GetKey(), v.GetVersionId())
+					}
+				}
+			}
+			if !result.IsTruncated {
+				break
+			}
+			keyMarker, versionMarker = result.NextMarker, nextVersionMarker
+		}
+	}
+	return nil
+}
+
+func (bucket *SBucketDelegate) abortIncompleteUploads(ctx context.Context, iBucket cloudprovider.ICloudBucket, conf *LifecycleConfiguration, now time.Time) error {
+	rules := make([]*LifecycleRule, 0)
+	for i := range conf.Rule {
+		if conf.Rule[i].IsEnabled() && conf.Rule[i].AbortIncompleteMultipartUpload != nil {
+			rules = append(rules, &conf.Rule[i])
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	uploads, err := iBucket.ListMultipartUploads()
+	if err != nil {
+		return errors.Wrap(err, "ListMultipartUploads")
+	}
+	for _, upload := range uploads {
+		for _, rule := range rules {
+			if !strings.HasPrefix(upload.ObjectName, rule.GetPrefix()) {
+				continue
+			}
+			if !isDue(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation, nil, upload.Initiated, now) {
+				continue
+			}
+			log.Infof("lifecycle: abort multipart upload %s/%s %s", bucket.Name, upload.ObjectName, upload.UploadID)
+			err = iBucket.AbortMultipartUpload(ctx, upload.ObjectName, upload.UploadID)
+			if err != nil {
+				return errors.Wrapf(err, "AbortMultipartUpload %s %s", upload.ObjectName, upload.UploadID)
+			}
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"time"
+
+	"yunion.io/x/cloudmux/pkg/cloudprovider"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/s3cli"
+
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+const (
+	VERSIONING_ENABLED   = "Enabled"
+	VERSIONING_SUSPENDED = "Suspended"
+
+	// NULL_VERSION_ID is the version id of objects written while versioning
+	// was never enabled or suspended
+	NULL_VERSION_ID = "null"
+)
+
+// ICloudVersioningBucket is implemented by cloudprovider buckets whose
+// backend supports object versioning. It only refers to cloudprovider types,
+// so that cloudmux drivers are able to implement it. Buckets that implement
+// neither it nor the s3 compatible fallback of GetIVersioningBucket behave as
+// never-versioned buckets.
+type ICloudVersioningBucket interface {
+	GetVersioning() (string, error)
+	SetVersioning(status string) error
+
+	// ListObjectVersions lists the versions and delete markers of objects,
+	// versions of a key are listed newest first. Objects of the result
+	// implement ICloudObjectVersion, NextMarker of the result is the next
+	// key marker and the next version id marker is returned aside.
+	ListObjectVersions(prefix string, keyMarker string, versionIdMarker string, delimiter string, maxCount int) (cloudprovider.SListObjectResult, string, error)
+	GetIObjectVersion(key string, versionId string) (cloudprovider.ICloudObject, error)
+	GetObjectVersion(ctx context.Context, key string, versionId string, rangeOpt *cloudprovider.SGetObjectRange) (io.ReadCloser, error)
+	DeleteObjectVersion(ctx context.Context, key string, versionId string) error
+}
+
+// ICloudObjectVersion is implemented by the objects listed by
+// ICloudVersioningBucket.ListObjectVersions
+type ICloudObjectVersion interface {
+	cloudprovider.ICloudObject
+
+	GetVersionId() string
+	IsLatest() bool
+	IsDeleteMarker() bool
+}
+
+// GetIVersioningBucket returns the versioning interface of a bucket, either
+// implemented by its driver or by the s3 compatible fallback
+func GetIVersioningBucket(iBucket cloudprovider.ICloudBucket) (ICloudVersioningBucket, bool) {
+	if vBucket, ok := iBucket.(ICloudVersioningBucket); ok {
+		return vBucket, true
+	}
+	return newObjectStoreVersioningBucket(iBucket)
+}
+
+type ListObjectVersionsInput struct {
+	Prefix          string `json:"prefix"`
+	Delimiter       string `json:"delimiter"`
+	KeyMarker       string `json:"key-marker"`
+	VersionIdMarker string `json:"version-id-marker"`
+	MaxKeys         int    `json:"max-keys"`
+	EncodingType    string `json:"encoding-type"`
+}
+
+type ObjectVersion struct {
+	Key          string
+	VersionId    string
+	IsLatest     bool
+	LastModified time.Time
+	ETag         string `xml:",omitempty"`
+	Size         int64
+	StorageClass string `xml:",omitempty"`
+	Owner        s3cli.Owner
+}
+
+type ListVersionsResult struct {
+	XMLName             xml.Name `xml:"ListVersionsResult"`
+	Name                string
+	Prefix              string
+	KeyMarker           string
+	VersionIdMarker     string
+	NextKeyMarker       string `xml:",omitempty"`
+	NextVersionIdMarker string `xml:",omitempty"`
+	MaxKeys             int
+	Delimiter           string `xml:",omitempty"`
+	EncodingType        string `xml:",omitempty"`
+	IsTruncated         bool
+	Version             []ObjectVersion `xml:"Version"`
+	DeleteMarker        []ObjectVersion `xml:"DeleteMarker"`
+	CommonPrefixes      []s3cli.CommonPrefix
+}
+
+func (bucket *SBucketDelegate) GetIVersioningBucket(ctx context.Context, userCred mcclient.TokenCredential) (ICloudVersioningBucket, error) {
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return nil, errors.Wrap(err, "bucket.GetIBucket")
+	}
+	vBucket, ok := GetIVersioningBucket(iBucket)
+	if !ok {
+		return nil, errors.Wrapf(httperrors.ErrNotSupported, "bucket %s does not support versioning", bucket.Name)
+	}
+	return vBucket, nil
+}
+
+func (bucket *SBucketDelegate) GetVersioning(ctx context.Context, userCred mcclient.TokenCredential) (*s3cli.VersioningConfiguration, error) {
+	conf := &s3cli.VersioningConfiguration{}
+	vBucket, err := bucket.GetIVersioningBucket(ctx, userCred)
+	if err != nil {
+		if errors.Cause(err) == httperrors.ErrNotSupported {
+			// never versioned
+			return conf, nil
+		}
+		return nil, err
+	}
+	conf.Status, err = vBucket.GetVersioning()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetVersioning")
+	}
+	return conf, nil
+}
+
+func (bucket *SBucketDelegate) SetVersioning(ctx context.Context, userCred mcclient.TokenCredential, conf *s3cli.VersioningConfiguration) error {
+	switch conf.Status {
+	case VERSIONING_ENABLED, VERSIONING_SUSPENDED:
+	default:
+		return errors.Wrapf(httperrors.ErrBadRequest, "invalid versioning status %q", conf.Status)
+	}
+	vBucket, err := bucket.GetIVersioningBucket(ctx, userCred)
+	if err != nil {
+		return err
+	}
+	err = vBucket.SetVersioning(conf.Status)
+	if err != nil {
+		return errors.Wrap(err, "SetVersioning")
+	}
+	return nil
+}
+
+func (bucket *SBucketDelegate) ListObjectVersions(ctx context.Context, userCred mcclient.TokenCredential, input *ListObjectVersionsInput) (*ListVersionsResult, error) {
+	vBucket, err := bucket.GetIVersioningBucket(ctx, userCred)
+	if err != nil {
+		return nil, err
+	}
+	if input.MaxKeys <= 0 || input.MaxKeys > 1000 {
+		input.MaxKeys = 1000
+	}
+	result, nextVersionIdMarker, err := vBucket.ListObjectVersions(input.Prefix, input.KeyMarker, input.VersionIdMarker, input.Delimiter, input.MaxKeys)
+	if err != nil {
+		return nil, errors.Wrap(err, "ListObjectVersions")
+	}
+	ret := ListVersionsResult{}
+	ret.Name = bucket.Name
+	ret.Prefix = input.Prefix
+	ret.KeyMarker = input.KeyMarker
+	ret.VersionIdMarker = input.VersionIdMarker
+	ret.MaxKeys = input.MaxKeys
+	ret.Delimiter = input.Delimiter
+	ret.EncodingType = input.EncodingType
+	ret.IsTruncated = result.IsTruncated
+	if result.IsTruncated {
+		ret.NextKeyMarker = result.NextMarker
+		ret.NextVersionIdMarker = nextVersionIdMarker
+	}
+	owner := s3cli.Owner{
+		DisplayName: userCred.GetProjectName(),
+		ID:          userCred.GetProjectId(),
+	}
+	for _, prefix := range result.CommonPrefixes {
+		ret.CommonPrefixes = append(ret.CommonPrefixes, s3cli.CommonPrefix{Prefix: prefix.GetKey()})
+	}
+	for _, obj := range result.Objects {
+		v, ok := obj.(ICloudObjectVersion)
+		if !ok {
+			return nil, errors.Wrapf(httperrors.ErrInternalError, "object %s of version list is not a version", obj.GetKey())
+		}
+		ver := ObjectVersion{
+			Key:          v.GetKey(),
+			VersionId:    v.GetVersionId(),
+			IsLatest:     v.IsLatest(),
+			LastModified: v.GetLastModified(),
+			Owner:        owner,
+		}
+		if v.IsDeleteMarker() {
+			ret.DeleteMarker = append(ret.DeleteMarker, ver)
+			continue
+		}
+		ver.ETag = v.GetETag()
+		ver.Size = v.GetSizeBytes()
+		ver.StorageClass = v.GetStorageClass()
+		ret.Version = append(ret.Version, ver)
+	}
+	return &ret, nil
+}
@@ -0,0 +1,322 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/cloudmux/pkg/cloudprovider"
+	"yunion.io/x/cloudmux/pkg/multicloud/objectstore"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/httputils"
+	"yunion.io/x/s3cli"
+
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+const (
+	objectStorePresignExpires = time.Hour
+)
+
+// sObjectStoreVersioningBucket implements ICloudVersioningBucket for the s3
+// compatible object storages, i.e. the generic objectstore, ceph and xsky
+// drivers, by sending presigned requests with the s3 client of the driver
+type sObjectStoreVersioningBucket struct {
+	cloudprovider.ICloudBucket
+
+	client *s3cli.Client
+}
+
+type iObjectStoreBucket interface {
+	GetIBucketProvider() objectstore.IBucketProvider
+}
+
+func newObjectStoreVersioningBucket(iBucket cloudprovider.ICloudBucket) (ICloudVersioningBucket, bool) {
+	osBucket, ok := iBucket.(iObjectStoreBucket)
+	if !ok {
+		return nil, false
+	}
+	provider := osBucket.GetIBucketProvider()
+	if provider == nil || provider.S3Client() == nil {
+		return nil, false
+	}
+	return &sObjectStoreVersioningBucket{
+		ICloudBucket: iBucket,
+		client:       provider.S3Client(),
+	}, true
+}
+
+func (b *sObjectStoreVersioningBucket) request(ctx context.Context, method string, key string, params url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u, err := b.client.Presign(method, b.GetName(), key, objectStorePresignExpires, params)
+	if err != nil {
+		return nil, errors.Wrap(err, "Presign")
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "http.NewRequest")
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.ContentLength = int64(len(body))
+	}
+	resp, err := httputils.GetDefaultClient().Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s", method, key)
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, parseObjectStoreError(resp)
+}
+
+func parseObjectStoreError(resp *http.Response) error {
+	eresp := s3cli.ErrorResponse{}
+	data, _ := ioutil.ReadAll(resp.Body)
+	if len(data) > 0 {
+		xml.Unmarshal(data, &eresp)
+	}
+	if len(eresp.Code) == 0 {
+		eresp.Code = resp.Status
+	}
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return errors.Wrapf(httperrors.ErrNotFound, "%s: %s", eresp.Code, eresp.Message)
+	case http.StatusNotImplemented, http.StatusMethodNotAllowed:
+		return errors.Wrapf(httperrors.ErrNotSupported, "%s: %s", eresp.Code, eresp.Message)
+	case http.StatusBadRequest:
+		return errors.Wrapf(httperrors.ErrBadRequest, "%s: %s", eresp.Code, eresp.Message)
+	case http.StatusForbidden:
+		return errors.Wrapf(httperrors.ErrForbidden, "%s: %s", eresp.Code, eresp.Message)
+	}
+	return errors.Errorf("%s: %s", eresp.Code, eresp.Message)
+}
+
+func (b *sObjectStoreVersioningBucket) GetVersioning() (string, error) {
+	resp, err := b.request(context.Background(), http.MethodGet, "", url.Values{"versioning": []string{""}}, nil, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "get versioning")
+	}
+	defer resp.Body.Close()
+	conf := s3cli.VersioningConfiguration{}
+	err = xml.NewDecoder(resp.Body).Decode(&conf)
+	if err != nil && err != io.EOF {
+		return "", errors.Wrap(err, "decode versioning")
+	}
+	return conf.Status, nil
+}
+
+func (b *sObjectStoreVersioningBucket) SetVersioning(status string) error {
+	body, err := xml.Marshal(s3cli.VersioningConfiguration{Status: status})
+	if err != nil {
+		return errors.Wrap(err, "xml.Marshal")
+	}
+	resp, err := b.request(context.Background(), http.MethodPut, "", url.Values{"versioning": []string{""}}, nil, body)
+	if err != nil {
+		return errors.Wrap(err, "put versioning")
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type sObjectStoreVersionEntry struct {
+	XMLName      xml.Name
+	Key          string
+	VersionId    string
+	IsLatest     bool
+	LastModified time.Time
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type sObjectStoreListVersionsResult struct {
+	IsTruncated         bool
+	NextKeyMarker       string
+	NextVersionIdMarker string
+	CommonPrefixes      []s3cli.CommonPrefix
+	// versions and delete markers in the order of the response
+	Entries []sObjectStoreVersionEntry `xml:",any"`
+}
+
+func parseListVersionsResult(data []byte) (*sObjectStoreListVersionsResult, error) {
+	result := &sObjectStoreListVersionsResult{}
+	err := xml.Unmarshal(data, result)
+	if err != nil {
+		return nil, errors.Wrap(err, "xml.Unmarshal")
+	}
+	entries := make([]sObjectStoreVersionEntry, 0, len(result.Entries))
+	for _, e := range result.Entries {
+		if e.XMLName.Local == "Version" || e.XMLName.Local == "DeleteMarker" {
+			entries = append(entries, e)
+		}
+	}
+	result.Entries = entries
+	return result, nil
+}
+
+func (b *sObjectStoreVersioningBucket) ListObjectVersions(prefix string, keyMarker string, versionIdMarker string, delimiter string, maxCount int) (cloudprovider.SListObjectResult, string, error) {
+	ret := cloudprovider.SListObjectResult{}
+	params := url.Values{}
+	params.Set("versions", "")
+	if len(prefix) > 0 {
+		params.Set("prefix", prefix)
+	}
+	if len(keyMarker) > 0 {
+		params.Set("key-marker", keyMarker)
+	}
+	if len(versionIdMarker) > 0 {
+		params.Set("version-id-marker", versionIdMarker)
+	}
+	if len(delimiter) > 0 {
+		params.Set("delimiter", delimiter)
+	}
+	if maxCount > 0 {
+		params.Set("max-keys", strconv.Itoa(maxCount))
+	}
+	resp, err := b.request(context.Background(), http.MethodGet, "", params, nil, nil)
+	if err != nil {
+		return ret, "", errors.Wrap(err, "list object versions")
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ret, "", errors.Wrap(err, "read list object versions")
+	}
+	result, err := parseListVersionsResult(data)
+	if err != nil {
+		return ret, "", errors.Wrap(err, "parseListVersionsResult")
+	}
+	for _, e := range result.Entries {
+		ret.Objects = append(ret.Objects, &sObjectStoreObjectVersion{
+			SBaseCloudObject: cloudprovider.SBaseCloudObject{
+				Key:          e.Key,
+				SizeBytes:    e.Size,
+				StorageClass: e.StorageClass,
+				ETag:         strings.Trim(e.ETag, "\""),
+				LastModified: e.LastModified,
+			},
+			bucket:       b,
+			versionId:    e.VersionId,
+			isLatest:     e.IsLatest,
+			deleteMarker: e.XMLName.Local == "DeleteMarker",
+		})
+	}
+	for _, p := range result.CommonPrefixes {
+		ret.CommonPrefixes = append(ret.CommonPrefixes, &sObjectStoreObjectVersion{
+			SBaseCloudObject: cloudprovider.SBaseCloudObject{Key: p.Prefix},
+			bucket:           b,
+		})
+	}
+	ret.IsTruncated = result.IsTruncated
+	ret.NextMarker = result.NextKeyMarker
+	return ret, result.NextVersionIdMarker, nil
+}
+
+func (b *sObjectStoreVersioningBucket) GetIObjectVersion(key string, versionId string) (cloudprovider.ICloudObject, error) {
+	resp, err := b.request(context.Background(), http.MethodHead, key, url.Values{"versionId": []string{versionId}}, nil, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "head %s version %s", key, versionId)
+	}
+	resp.Body.Close()
+	obj := &sObjectStoreObjectVersion{
+		SBaseCloudObject: cloudprovider.SBaseCloudObject{
+			Key:          key,
+			SizeBytes:    resp.ContentLength,
+			StorageClass: resp.Header.Get("X-Amz-Storage-Class"),
+			ETag:         strings.Trim(resp.Header.Get("ETag"), "\""),
+			Meta:         cloudprovider.FetchMetaFromHttpHeader(objectstore.META_HEADER, resp.Header),
+		},
+		bucket:    b,
+		versionId: versionId,
+	}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		obj.LastModified = lastModified
+	}
+	return obj, nil
+}
+
+func (b *sObjectStoreVersioningBucket) GetObjectVersion(ctx context.Context, key string, versionId string, rangeOpt *cloudprovider.SGetObjectRange) (io.ReadCloser, error) {
+	header := http.Header{}
+	if rangeOpt != nil && len(rangeOpt.String()) > 0 {
+		header.Set("Range", rangeOpt.String())
+	}
+	resp, err := b.request(ctx, http.MethodGet, key, url.Values{"versionId": []string{versionId}}, header, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s version %s", key, versionId)
+	}
+	return resp.Body, nil
+}
+
+func (b *sObjectStoreVersioningBucket) DeleteObjectVersion(ctx context.Context, key string, versionId string) error {
+	resp, err := b.request(ctx, http.MethodDelete, key, url.Values{"versionId": []string{versionId}}, nil, nil)
+	if err != nil {
+		return errors.Wrapf(err, "delete %s version %s", key, versionId)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type sObjectStoreObjectVersion struct {
+	cloudprovider.SBaseCloudObject
+
+	bucket       *sObjectStoreVersioningBucket
+	versionId    string
+	isLatest     bool
+	deleteMarker bool
+}
+
+func (o *sObjectStoreObjectVersion) GetIBucket() cloudprovider.ICloudBucket {
+	return o.bucket.ICloudBucket
+}
+
+func (o *sObjectStoreObjectVersion) GetAcl() cloudprovider.TBucketACLType {
+	return o.bucket.GetAcl()
+}
+
+func (o *sObjectStoreObjectVersion) SetAcl(acl cloudprovider.TBucketACLType) error {
+	return errors.Wrap(cloudprovider.ErrNotSupported, "set acl of object version")
+}
+
+func (o *sObjectStoreObjectVersion) SetMeta(ctx context.Context, meta http.Header) error {
+	return errors.Wrap(cloudprovider.ErrNotSupported, "set meta of object version")
+}
+
+func (o *sObjectStoreObjectVersion) GetVersionId() string {
+	return o.versionId
+}
+
+func (o *sObjectStoreObjectVersion) IsLatest() bool {
+	return o.isLatest
+}
+
+func (o *sObjectStoreObjectVersion) IsDeleteMarker() bool {
+	return o.deleteMarker
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"yunion.io/x/cloudmux/pkg/cloudprovider"
+	"yunion.io/x/s3cli"
+)
+
+const testListVersionsXml = `<?xml version="1.0" encoding="UTF-8"?>
+<ListVersionsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>bucket</Name>
+  <Prefix></Prefix>
+  <KeyMarker></KeyMarker>
+  <VersionIdMarker></VersionIdMarker>
+  <NextKeyMarker>b</NextKeyMarker>
+  <NextVersionIdMarker>v4</NextVersionIdMarker>
+  <MaxKeys>3</MaxKeys>
+  <IsTruncated>true</IsTruncated>
+  <DeleteMarker>
+    <Key>a</Key>
+    <VersionId>v3</VersionId>
+    <IsLatest>true</IsLatest>
+    <LastModified>2024-01-03T00:00:00.000Z</LastModified>
+  </DeleteMarker>
+  <Version>
+    <Key>a</Key>
+    <VersionId>v2</VersionId>
+    <IsLatest>false</IsLatest>
+    <LastModified>2024-01-02T00:00:00.000Z</LastModified>
+    <ETag>"etag2"</ETag>
+    <Size>20</Size>
+    <StorageClass>STANDARD</StorageClass>
+  </Version>
+  <Version>
+    <Key>b</Key>
+    <VersionId>v4</VersionId>
+    <IsLatest>true</IsLatest>
+    <LastModified>2024-01-01T00:00:00.000Z</LastModified>
+    <ETag>"etag4"</ETag>
+    <Size>40</Size>
+  </Version>
+  <CommonPrefixes><Prefix>dir/</Prefix></CommonPrefixes>
+</ListVersionsResult>`
+
+type sTestBucket struct {
+	cloudprovider.ICloudBucket
+}
+
+func (b *sTestBucket) GetName() string {
+	return "bucket"
+}
+
+func newTestVersioningBucket(t *testing.T, handler http.HandlerFunc) *sObjectStoreVersioningBucket {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	cli, err := s3cli.NewWithRegion(strings.TrimPrefix(srv.URL, "http://"), "ak", "sk", false, "us-east-1", false)
+	if err != nil {
+		t.Fatalf("s3cli.NewWithRegion: %v", err)
+	}
+	return &sObjectStoreVersioningBucket{ICloudBucket: &sTestBucket{}, client: cli}
+}
+
+func TestObjectStoreListObjectVersions(t *testing.T) {
+	b := newTestVersioningBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.Method != http.MethodGet || r.URL.Path != "/bucket/" || !q.Has("versions") || q.Get("key-marker") != "a" || q.Get("max-keys") != "3" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		w.Write([]byte(testListVersionsXml))
+	})
+	result, nextVersionIdMarker, err := b.ListObjectVersions("", "a", "", "", 3)
+	if err != nil {
+		t.Fatalf("ListObjectVersions: %v", err)
+	}
+	if !result.IsTruncated || result.NextMarker != "b" || nextVersionIdMarker != "v4" {
+		t.Errorf("markers got %v %q %q", result.IsTruncated, result.NextMarker, nextVersionIdMarker)
+	}
+	want := []struct {
+		key, versionId, etag string
+		latest, deleteMarker bool
+	}{
+		{"a", "v3", "", true, true},
+		{"a", "v2", "etag2", false, false},
+		{"b", "v4", "etag4", true, false},
+	}
+	if len(result.Objects) != len(want) {
+		t.Fatalf("objects got %d want %d", len(result.Objects), len(want))
+	}
+	for i, w := range want {
+		v := result.Objects[i].(ICloudObjectVersion)
+		if v.GetKey() != w.key || v.GetVersionId() != w.versionId || v.GetETag() != w.etag || v.IsLatest() != w.latest || v.IsDeleteMarker() != w.deleteMarker {
+			t.Errorf("object %d got %s %s %s %v %v", i, v.GetKey(), v.GetVersionId(), v.GetETag(), v.IsLatest(), v.IsDeleteMarker())
+		}
+	}
+	if len(result.CommonPrefixes) != 1 || result.CommonPrefixes[0].GetKey() != "dir/" {
+		t.Errorf("common prefixes got %v", result.CommonPrefixes)
+	}
+}
+
+func TestObjectStoreVersioning(t *testing.T) {
+	var putBody string
+	b := newTestVersioningBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.Query().Has("versioning") {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`<VersioningConfiguration><Status>Suspended</Status></VersioningConfiguration>`))
+		case http.MethodPut:
+			data, _ := ioutil.ReadAll(r.Body)
+			putBody = string(data)
+		}
+	})
+	status, err := b.GetVersioning()
+	if err != nil || status != VERSIONING_SUSPENDED {
+		t.Errorf("GetVersioning got %q %v", status, err)
+	}
+	if err := b.SetVersioning(VERSIONING_ENABLED); err != nil {
+		t.Fatalf("SetVersioning: %v", err)
+	}
+	if !strings.Contains(putBody, "<Status>Enabled</Status>") {
+		t.Errorf("put versioning body %q", putBody)
+	}
+}
+
+func TestObjectStoreObjectVersion(t *testing.T) {
+	deleted := ""
+	b := newTestVersioningBucket(t, func(w http.ResponseWriter, r *http.Request) {
+		versionId := r.URL.Query().Get("versionId")
+		if r.URL.Path != "/bucket/key" || versionId == "" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		if versionId == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchVersion</Code><Message>no such version</Message></Error>`))
+			return
+		}
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("ETag", `"etag1"`)
+			w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("X-Amz-Meta-Owner", "alice")
+			w.Header().Set("Content-Length", "5")
+		case http.MethodGet:
+			if r.Header.Get("Range") != "bytes=1-3" {
+				t.Errorf("range got %q", r.Header.Get("Range"))
+			}
+			w.Write([]byte("ell"))
+		case http.MethodDelete:
+			deleted = versionId
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	obj, err := b.GetIObjectVersion("key", "v1")
+	if err != nil {
+		t.Fatalf("GetIObjectVersion: %v", err)
+	}
+	if obj.GetSizeBytes() != 5 || obj.GetETag() != "etag1" || obj.GetLastModified().Year() != 2024 || obj.GetMeta().Get("Owner") != "alice" || obj.GetMeta().Get("Content-Type") != "text/plain" {
+		t.Errorf("object got %d %s %s %v", obj.GetSizeBytes(), obj.GetETag(), obj.GetLastModified(), obj.GetMeta())
+	}
+	stream, err := b.GetObjectVersion(context.Background(), "key", "v1", &cloudprovider.SGetObjectRange{Start: 1, End: 3})
+	if err != nil {
+		t.Fatalf("GetObjectVersion: %v", err)
+	}
+	data, _ := ioutil.ReadAll(stream)
+	stream.Close()
+	if string(data) != "ell" {
+		t.Errorf("GetObjectVersion got %q", data)
+	}
+	if err := b.DeleteObjectVersion(context.Background(), "key", "v1"); err != nil || deleted != "v1" {
+		t.Errorf("DeleteObjectVersion got %q %v", deleted, err)
+	}
+	if _, err := b.GetIObjectVersion("key", "missing"); err == nil {
+		t.Errorf("GetIObjectVersion of a missing version should fail")
+	}
+}
@@ -22,6 +22,10 @@ type SS3GatewayOptions struct {
 	common_options.CommonOptions
 
 	DomainName string `help:"s3 domain name"`
+
+	LifecycleCheckIntervalMinutes int `help:"interval in minutes to enforce bucket lifecycle rules" default:"60"`
+
+	PostObjectMaxSizeMb int `help:"maximal size in MB of an object uploaded by browser-based POST" default:"5120"`
 }
 
 var (
@@ -0,0 +1,776 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	ErrEvaluate = errors.Error("EvaluatorError")
+)
+
+// Expr is a node of the parsed SQL expression tree. Values are represented
+// as nil, bool, int64, float64, string, *SOrderedMap or []interface{}.
+type Expr interface {
+	Eval(rec *SRecord) (interface{}, error)
+}
+
+type SLiteral struct {
+	Value interface{}
+}
+
+func (e *SLiteral) Eval(rec *SRecord) (interface{}, error) {
+	return e.Value, nil
+}
+
+type SPathElem struct {
+	Name          string
+	CaseSensitive bool
+	Index         int
+	IsIndex       bool
+}
+
+type SColumnRef struct {
+	Path []SPathElem
+
+	query    *SQuery
+	resolved bool
+}
+
+func (e *SColumnRef) resolve() {
+	if e.resolved {
+		return
+	}
+	e.resolved = true
+	if len(e.Path) > 1 && !e.Path[0].IsIndex {
+		first := e.Path[0].Name
+		if strings.EqualFold(first, "s3object") || (len(e.query.Alias) > 0 && strings.EqualFold(first, e.query.Alias)) {
+			e.Path = e.Path[1:]
+		}
+	}
+}
+
+func (e *SColumnRef) Eval(rec *SRecord) (interface{}, error) {
+	e.resolve()
+	val, _ := rec.Lookup(e.Path)
+	return val, nil
+}
+
+// Name returns the column name used for the output field of a projection
+func (e *SColumnRef) Name() string {
+	e.resolve()
+	last := e.Path[len(e.Path)-1]
+	if last.IsIndex {
+		return ""
+	}
+	return last.Name
+}
+
+type SLogicExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+func (e *SLogicExpr) Eval(rec *SRecord) (interface{}, error) {
+	left, err := e.Left.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	lb, lnull := toBool(left)
+	if e.Op == "and" && !lnull && !lb {
+		return false, nil
+	}
+	if e.Op == "or" && !lnull && lb {
+		return true, nil
+	}
+	right, err := e.Right.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	rb, rnull := toBool(right)
+	if e.Op == "and" {
+		if !rnull && !rb {
+			return false, nil
+		}
+		if lnull || rnull {
+			return nil, nil
+		}
+		return true, nil
+	}
+	if !rnull && rb {
+		return true, nil
+	}
+	if lnull || rnull {
+		return nil, nil
+	}
+	return false, nil
+}
+
+type SNotExpr struct {
+	Expr Expr
+}
+
+func (e *SNotExpr) Eval(rec *SRecord) (interface{}, error) {
+	val, err := e.Expr.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	b, null := toBool(val)
+	if null {
+		return nil, nil
+	}
+	return !b, nil
+}
+
+type SCompareExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+func (e *SCompareExpr) Eval(rec *SRecord) (interface{}, error) {
+	left, err := e.Left.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.Right.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	cmp, err := compareValues(left, right)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case "=":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return nil, errors.Wrapf(ErrEvaluate, "unknown operator %s", e.Op)
+}
+
+type SIsNullExpr struct {
+	Expr   Expr
+	Negate bool
+}
+
+func (e *SIsNullExpr) Eval(rec *SRecord) (interface{}, error) {
+	val, err := e.Expr.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	return (val == nil) != e.Negate, nil
+}
+
+type SLikeExpr struct {
+	Expr    Expr
+	Pattern Expr
+	Escape  Expr
+	Negate  bool
+
+	cachePattern string
+	cacheRegexp  *regexp.Regexp
+}
+
+func (e *SLikeExpr) Eval(rec *SRecord) (interface{}, error) {
+	val, err := e.Expr.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	pat, err := e.Pattern.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	if val == nil || pat == nil {
+		return nil, nil
+	}
+	escape := ""
+	if e.Escape != nil {
+		esc, err := e.Escape.Eval(rec)
+		if err != nil {
+			return nil, err
+		}
+		escape = toString(esc)
+	}
+	patStr := toString(pat)
+	if e.cacheRegexp == nil || e.cachePattern != patStr+"\x00"+escape {
+		e.cacheRegexp, err = likeToRegexp(patStr, escape)
+		if err != nil {
+			return nil, err
+		}
+		e.cachePattern = patStr + "\x00" + escape
+	}
+	return e.cacheRegexp.MatchString(toString(val)) != e.Negate, nil
+}
+
+func likeToRegexp(pattern string, escape string) (*regexp.Regexp, error) {
+	if len([]rune(escape)) > 1 {
+		return nil, errors.Wrapf(ErrEvaluate, "invalid escape %q", escape)
+	}
+	buf := strings.Builder{}
+	buf.WriteString("(?s)^")
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		if len(escape) > 0 && string(c) == escape && i+1 < len(runes) {
+			i++
+			buf.WriteString(regexp.QuoteMeta(string(runes[i])))
+			continue
+		}
+		switch c {
+		case '%':
+			buf.WriteString(".*")
+		case '_':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	buf.WriteString("$")
+	return regexp.Compile(buf.String())
+}
+
+type SBetweenExpr struct {
+	Expr   Expr
+	Low    Expr
+	High   Expr
+	Negate bool
+}
+
+func (e *SBetweenExpr) Eval(rec *SRecord) (interface{}, error) {
+	ge, err := (&SCompareExpr{Op: ">=", Left: e.Expr, Right: e.Low}).Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	le, err := (&SCompareExpr{Op: "<=", Left: e.Expr, Right: e.High}).Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	if ge == nil || le == nil {
+		return nil, nil
+	}
+	return (ge.(bool) && le.(bool)) != e.Negate, nil
+}
+
+type SInExpr struct {
+	Expr   Expr
+	List   []Expr
+	Negate bool
+}
+
+func (e *SInExpr) Eval(rec *SRecord) (interface{}, error) {
+	val, err := e.Expr.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	if val == nil {
+		return nil, nil
+	}
+	for _, item := range e.List {
+		iv, err := item.Eval(rec)
+		if err != nil {
+			return nil, err
+		}
+		if iv == nil {
+			continue
+		}
+		cmp, err := compareValues(val, iv)
+		if err == nil && cmp == 0 {
+			return !e.Negate, nil
+		}
+	}
+	return e.Negate, nil
+}
+
+type SArithExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+func (e *SArithExpr) Eval(rec *SRecord) (interface{}, error) {
+	left, err := e.Left.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.Right.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	if e.Op == "||" {
+		return toString(left) + toString(right), nil
+	}
+	li, lIsInt := toInt(left)
+	ri, rIsInt := toInt(right)
+	if lIsInt && rIsInt {
+		switch e.Op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/":
+			if ri == 0 {
+				return nil, errors.Wrap(ErrEvaluate, "division by zero")
+			}
+			return li / ri, nil
+		case "%":
+			if ri == 0 {
+				return nil, errors.Wrap(ErrEvaluate, "division by zero")
+			}
+			return li % ri, nil
+		}
+	}
+	lf, lok := toFloat(left)
+	rf, rok := toFloat(right)
+	if !lok || !rok {
+		return nil, errors.Wrapf(ErrEvaluate, "invalid operands for %s: %v, %v", e.Op, left, right)
+	}
+	switch e.Op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, errors.Wrap(ErrEvaluate, "division by zero")
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, errors.Wrap(ErrEvaluate, "division by zero")
+		}
+		return math.Mod(lf, rf), nil
+	}
+	return nil, errors.Wrapf(ErrEvaluate, "unknown operator %s", e.Op)
+}
+
+type SCastExpr struct {
+	Expr Expr
+	Type string
+}
+
+func (e *SCastExpr) Eval(rec *SRecord) (interface{}, error) {
+	val, err := e.Expr.Eval(rec)
+	if err != nil {
+		return nil, err
+	}
+	if val == nil {
+		return nil, nil
+	}
+	switch e.Type {
+	case "int":
+		if i, ok := toInt(val); ok {
+			return i, nil
+		}
+		if f, ok := toFloat(val); ok {
+			return int64(f), nil
+		}
+	case "float":
+		if f, ok := toFloat(val); ok {
+			return f, nil
+		}
+	case "string":
+		return toString(val), nil
+	case "bool":
+		if b, null := toBool(val); !null {
+			return b, nil
+		}
+	}
+	return nil, errors.Wrapf(ErrEvaluate, "cannot cast %v to %s", val, e.Type)
+}
+
+type scalarFunc func(args []interface{}) (interface{}, error)
+
+var scalarFuncs = map[string]scalarFunc{
+	"lower":            strFunc(strings.ToLower),
+	"upper":            strFunc(strings.ToUpper),
+	"trim":             strFunc(strings.TrimSpace),
+	"char_length":      lengthFunc,
+	"character_length": lengthFunc,
+	"coalesce":         coalesceFunc,
+	"nullif":           nullifFunc,
+	"substring":        substringFunc,
+}
+
+func strFunc(f func(string) string) scalarFunc {
+	return func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errors.Wrap(ErrEvaluate, "expect exactly 1 argument")
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		return f(toString(args[0])), nil
+	}
+}
+
+func lengthFunc(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.Wrap(ErrEvaluate, "expect exactly 1 argument")
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	return int64(len([]rune(toString(args[0])))), nil
+}
+
+func coalesceFunc(args []interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if arg != nil {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+
+func nullifFunc(args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errors.Wrap(ErrEvaluate, "expect exactly 2 arguments")
+	}
+	if args[0] != nil && args[1] != nil {
+		if cmp, err := compareValues(args[0], args[1]); err == nil && cmp == 0 {
+			return nil, nil
+		}
+	}
+	return args[0], nil
+}
+
+func substringFunc(args []interface{}) (interface{}, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.Wrap(ErrEvaluate, "expect 2 or 3 arguments")
+	}
+	for _, arg := range args {
+		if arg == nil {
+			return nil, nil
+		}
+	}
+	runes := []rune(toString(args[0]))
+	start, ok := toInt(args[1])
+	if !ok {
+		return nil, errors.Wrap(ErrEvaluate, "invalid start position")
+	}
+	// SQL positions are 1-based
+	start -= 1
+	end := int64(len(runes))
+	if len(args) == 3 {
+		length, ok := toInt(args[2])
+		if !ok || length < 0 {
+			return nil, errors.Wrap(ErrEvaluate, "invalid length")
+		}
+		end = start + length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > int64(len(runes)) {
+		end = int64(len(runes))
+	}
+	if start >= end {
+		return "", nil
+	}
+	return string(runes[start:end]), nil
+}
+
+type SFuncExpr struct {
+	Name string
+	Args []Expr
+
+	fn scalarFunc
+}
+
+func (e *SFuncExpr) Eval(rec *SRecord) (interface{}, error) {
+	args := make([]interface{}, len(e.Args))
+	for i := range e.Args {
+		val, err := e.Args[i].Eval(rec)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+	val, err := e.fn(args)
+	if err != nil {
+		return nil, errors.Wrap(err, e.Name)
+	}
+	return val, nil
+}
+
+type TAggregateFunc string
+
+const (
+	AGG_COUNT = TAggregateFunc("count")
+	AGG_SUM   = TAggregateFunc("sum")
+	AGG_AVG   = TAggregateFunc("avg")
+	AGG_MIN   = TAggregateFunc("min")
+	AGG_MAX   = TAggregateFunc("max")
+)
+
+var aggregateFuncs = map[string]TAggregateFunc{
+	"count": AGG_COUNT,
+	"sum":   AGG_SUM,
+	"avg":   AGG_AVG,
+	"min":   AGG_MIN,
+	"max":   AGG_MAX,
+}
+
+// SAggregate accumulates values across records; Eval returns the
+// aggregated result once all records have been accumulated.
+type SAggregate struct {
+	Func TAggregateFunc
+	Arg  Expr
+
+	count   int64
+	intSum  int64
+	sum     float64
+	isFloat bool
+	value   interface{}
+}
+
+func (e *SAggregate) Accumulate(rec *SRecord) error {
+	if e.Arg == nil {
+		e.count++
+		return nil
+	}
+	val, err := e.Arg.Eval(rec)
+	if err != nil {
+		return err
+	}
+	if val == nil {
+		return nil
+	}
+	e.count++
+	switch e.Func {
+	case AGG_SUM, AGG_AVG:
+		if i, ok := toInt(val); ok && !e.isFloat {
+			e.intSum += i
+			e.sum += float64(i)
+		} else if f, ok := toFloat(val); ok {
+			e.isFloat = true
+			e.sum += f
+		} else {
+			return errors.Wrapf(ErrEvaluate, "%s: non-numeric value %v", e.Func, val)
+		}
+	case AGG_MIN, AGG_MAX:
+		if e.value == nil {
+			e.value = val
+			return nil
+		}
+		cmp, err := compareValues(val, e.value)
+		if err != nil {
+			return errors.Wrap(err, string(e.Func))
+		}
+		if (e.Func == AGG_MIN && cmp < 0) || (e.Func == AGG_MAX && cmp > 0) {
+			e.value = val
+		}
+	}
+	return nil
+}
+
+func (e *SAggregate) Eval(rec *SRecord) (interface{}, error) {
+	switch e.Func {
+	case AGG_COUNT:
+		return e.count, nil
+	case AGG_SUM:
+		if e.count == 0 {
+			return nil, nil
+		}
+		if e.isFloat {
+			return e.sum, nil
+		}
+		return e.intSum, nil
+	case AGG_AVG:
+		if e.count == 0 {
+			return nil, nil
+		}
+		return e.sum / float64(e.count), nil
+	default:
+		return e.value, nil
+	}
+}
+
+func collectAggregates(expr Expr, aggs []*SAggregate) []*SAggregate {
+	switch e := expr.(type) {
+	case *SAggregate:
+		aggs = append(aggs, e)
+	case *SLogicExpr:
+		aggs = collectAggregates(e.Left, aggs)
+		aggs = collectAggregates(e.Right, aggs)
+	case *SNotExpr:
+		aggs = collectAggregates(e.Expr, aggs)
+	case *SCompareExpr:
+		aggs = collectAggregates(e.Left, aggs)
+		aggs = collectAggregates(e.Right, aggs)
+	case *SArithExpr:
+		aggs = collectAggregates(e.Left, aggs)
+		aggs = collectAggregates(e.Right, aggs)
+	case *SCastExpr:
+		aggs = collectAggregates(e.Expr, aggs)
+	case *SIsNullExpr:
+		aggs = collectAggregates(e.Expr, aggs)
+	case *SFuncExpr:
+		for _, arg := range e.Args {
+			aggs = collectAggregates(arg, aggs)
+		}
+	}
+	return aggs
+}
+
+func containsAggregate(expr Expr) bool {
+	return len(collectAggregates(expr, nil)) > 0
+}
+
+func isConstant(expr Expr) bool {
+	_, ok := expr.(*SLiteral)
+	return ok
+}
+
+func toBool(val interface{}) (bool, bool) {
+	switch v := val.(type) {
+	case nil:
+		return false, true
+	case bool:
+		return v, false
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, true
+		}
+		return b, false
+	case int64:
+		return v != 0, false
+	case float64:
+		return v != 0, false
+	}
+	return false, true
+}
+
+func toInt(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case int64:
+		return v, true
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return i, err == nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v), false
+		}
+	}
+	return 0, false
+}
+
+func toFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toString(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case *SOrderedMap:
+		return v.String()
+	case []interface{}:
+		return jsonString(v)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+func isNumber(val interface{}) bool {
+	switch val.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+// compareValues compares two non-null values. Text read from CSV is
+// compared numerically when the other side is a number and the text
+// parses as one, so that `WHERE s.age > 30` works without an explicit CAST.
+func compareValues(a, b interface{}) (int, error) {
+	if isNumber(a) || isNumber(b) {
+		af, aok := toFloat(a)
+		bf, bok := toFloat(b)
+		if aok && bok {
+			switch {
+			case af < bf:
+				return -1, nil
+			case af > bf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if ab, ok := a.(bool); ok {
+		bb, null := toBool(b)
+		if null {
+			return 0, errors.Wrapf(ErrEvaluate, "cannot compare %v with %v", a, b)
+		}
+		switch {
+		case ab == bb:
+			return 0, nil
+		case !ab:
+			return -1, nil
+		}
+		return 1, nil
+	}
+	if _, ok := b.(bool); ok {
+		cmp, err := compareValues(b, a)
+		return -cmp, err
+	}
+	return strings.Compare(toString(a), toString(b)), nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"hash/crc32"
+	"io"
+	"net/http"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/s3cli"
+)
+
+// AWS event stream framing, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/RESTSelectObjectAppendix.html
+//
+//	prelude:  total length (4) | headers length (4) | prelude crc (4)
+//	headers:  name length (1) | name | value type (1) | value length (2) | value
+//	payload
+//	message crc (4)
+
+const (
+	eventHeaderTypeString = 7
+
+	EVENT_RECORDS  = "Records"
+	EVENT_STATS    = "Stats"
+	EVENT_PROGRESS = "Progress"
+	EVENT_CONT     = "Cont"
+	EVENT_END      = "End"
+)
+
+type sEventHeader struct {
+	name  string
+	value string
+}
+
+func encodeMessage(headers []sEventHeader, payload []byte) []byte {
+	hdrBuf := bytes.Buffer{}
+	for _, h := range headers {
+		hdrBuf.WriteByte(byte(len(h.name)))
+		hdrBuf.WriteString(h.name)
+		hdrBuf.WriteByte(eventHeaderTypeString)
+		binary.Write(&hdrBuf, binary.BigEndian, uint16(len(h.value)))
+		hdrBuf.WriteString(h.value)
+	}
+	totalLen := 4 + 4 + 4 + hdrBuf.Len() + len(payload) + 4
+
+	msg := bytes.Buffer{}
+	msg.Grow(totalLen)
+	binary.Write(&msg, binary.BigEndian, uint32(totalLen))
+	binary.Write(&msg, binary.BigEndian, uint32(hdrBuf.Len()))
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	msg.Write(hdrBuf.Bytes())
+	msg.Write(payload)
+	binary.Write(&msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	return msg.Bytes()
+}
+
+func eventMessage(eventType string, contentType string, payload []byte) []byte {
+	headers := []sEventHeader{
+		{name: ":event-type", value: eventType},
+	}
+	if len(contentType) > 0 {
+		headers = append(headers, sEventHeader{name: ":content-type", value: contentType})
+	}
+	headers = append(headers, sEventHeader{name: ":message-type", value: "event"})
+	return encodeMessage(headers, payload)
+}
+
+func errorMessage(code string, message string) []byte {
+	return encodeMessage([]sEventHeader{
+		{name: ":error-code", value: code},
+		{name: ":error-message", value: message},
+		{name: ":message-type", value: "error"},
+	}, nil)
+}
+
+// sEventStreamWriter writes event stream messages to the HTTP response,
+// flushing after every message so that clients see records as they come.
+type sEventStreamWriter struct {
+	writer io.Writer
+}
+
+func newEventStreamWriter(w io.Writer) *sEventStreamWriter {
+	return &sEventStreamWriter{writer: w}
+}
+
+func (w *sEventStreamWriter) write(msg []byte) error {
+	_, err := w.writer.Write(msg)
+	if err != nil {
+		return errors.Wrap(err, "write event")
+	}
+	if f, ok := w.writer.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+func (w *sEventStreamWriter) Records(payload []byte) error {
+	return w.write(eventMessage(EVENT_RECORDS, "application/octet-stream", payload))
+}
+
+func (w *sEventStreamWriter) Stats(stats s3cli.StatsMessage) error {
+	payload, err := xml.Marshal(stats)
+	if err != nil {
+		return errors.Wrap(err, "xml.Marshal stats")
+	}
+	return w.write(eventMessage(EVENT_STATS, "text/xml", payload))
+}
+
+func (w *sEventStreamWriter) Progress(stats s3cli.StatsMessage) error {
+	payload, err := xml.Marshal(s3cli.ProgressMessage{StatsMessage: stats})
+	if err != nil {
+		return errors.Wrap(err, "xml.Marshal progress")
+	}
+	return w.write(eventMessage(EVENT_PROGRESS, "text/xml", payload))
+}
+
+func (w *sEventStreamWriter) Continuation() error {
+	return w.write(eventMessage(EVENT_CONT, "", nil))
+}
+
+func (w *sEventStreamWriter) End() error {
+	return w.write(eventMessage(EVENT_END, "", nil))
+}
+
+func (w *sEventStreamWriter) Error(code string, message string) error {
+	return w.write(errorMessage(code, message))
+}
@@ -0,0 +1,174 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/csv"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/s3cli"
+)
+
+const (
+	ErrUnsupportedFormat = errors.Error("UnsupportedFormat")
+
+	maxRecordBytes = 1024 * 1024
+)
+
+type sCSVReader struct {
+	reader *csv.Reader
+	names  []string
+}
+
+func newCSVReader(r io.Reader, opts *s3cli.CSVInputOptions) (*sCSVReader, error) {
+	recordDelimiter := opts.RecordDelimiter
+	if len(recordDelimiter) > 0 && recordDelimiter != "\n" && recordDelimiter != "\r\n" {
+		r = newDelimiterReader(r, []byte(recordDelimiter))
+	}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = false
+	if len(opts.FieldDelimiter) > 0 {
+		c, err := singleRune(opts.FieldDelimiter, "FieldDelimiter")
+		if err != nil {
+			return nil, err
+		}
+		reader.Comma = c
+	}
+	if len(opts.Comments) > 0 {
+		c, err := singleRune(opts.Comments, "Comments")
+		if err != nil {
+			return nil, err
+		}
+		reader.Comment = c
+	}
+	if len(opts.QuoteCharacter) > 0 && opts.QuoteCharacter != `"` {
+		return nil, errors.Wrapf(ErrUnsupportedFormat, "QuoteCharacter %q", opts.QuoteCharacter)
+	}
+	if len(opts.QuoteEscapeCharacter) > 0 && opts.QuoteEscapeCharacter != `"` {
+		return nil, errors.Wrapf(ErrUnsupportedFormat, "QuoteEscapeCharacter %q", opts.QuoteEscapeCharacter)
+	}
+	cr := &sCSVReader{reader: reader}
+	switch strings.ToUpper(string(opts.FileHeaderInfo)) {
+	case string(s3cli.CSVFileHeaderInfoUse):
+		header, err := reader.Read()
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrap(err, "read csv header")
+		}
+		cr.names = header
+	case s3cli.CSVFileHeaderInfoIgnore:
+		_, err := reader.Read()
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrap(err, "read csv header")
+		}
+	}
+	return cr, nil
+}
+
+func singleRune(s string, field string) (rune, error) {
+	c, size := utf8.DecodeRuneInString(s)
+	if size != len(s) {
+		return 0, errors.Wrapf(ErrUnsupportedFormat, "%s must be a single character", field)
+	}
+	return c, nil
+}
+
+func (r *sCSVReader) Read() (*SRecord, error) {
+	fields, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	rec := &SRecord{
+		Names:  r.names,
+		Values: make([]interface{}, len(fields)),
+	}
+	for i := range fields {
+		rec.Values[i] = fields[i]
+	}
+	return rec, nil
+}
+
+// sDelimiterReader translates a custom record delimiter to newlines so that
+// encoding/csv can split records.
+type sDelimiterReader struct {
+	scanner *bufio.Scanner
+	buf     []byte
+}
+
+func newDelimiterReader(r io.Reader, delimiter []byte) *sDelimiterReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordBytes)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if idx := bytes.Index(data, delimiter); idx >= 0 {
+			return idx + len(delimiter), data[:idx], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	return &sDelimiterReader{scanner: scanner}
+}
+
+func (r *sDelimiterReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		r.buf = append(append(r.buf[:0], r.scanner.Bytes()...), '\n')
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// sCountingReader counts bytes flowing through a reader for the Stats message
+type sCountingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *sCountingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+func decompress(r io.Reader, compression s3cli.SelectCompressionType) (io.Reader, error) {
+	switch strings.ToUpper(string(compression)) {
+	case "", string(s3cli.SelectCompressionNONE):
+		return r, nil
+	case s3cli.SelectCompressionGZIP:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "gzip.NewReader")
+		}
+		return gz, nil
+	case s3cli.SelectCompressionBZIP:
+		return bzip2.NewReader(r), nil
+	}
+	return nil, errors.Wrapf(ErrUnsupportedFormat, "CompressionType %s", compression)
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/s3cli"
+)
+
+// IRecordWriter serializes an output record into buf
+type IRecordWriter interface {
+	Write(buf *bytes.Buffer, names []string, values []interface{}) error
+}
+
+type sCSVWriter struct {
+	fieldDelimiter  string
+	recordDelimiter string
+	quote           string
+	quoteEscape     string
+	alwaysQuote     bool
+}
+
+func newCSVWriter(opts *s3cli.CSVOutputOptions) *sCSVWriter {
+	w := &sCSVWriter{
+		fieldDelimiter:  ",",
+		recordDelimiter: "\n",
+		quote:           `"`,
+		quoteEscape:     `"`,
+	}
+	if len(opts.FieldDelimiter) > 0 {
+		w.fieldDelimiter = opts.FieldDelimiter
+	}
+	if len(opts.RecordDelimiter) > 0 {
+		w.recordDelimiter = opts.RecordDelimiter
+	}
+	if len(opts.QuoteCharacter) > 0 {
+		w.quote = opts.QuoteCharacter
+	}
+	if len(opts.QuoteEscapeCharacter) > 0 {
+		w.quoteEscape = opts.QuoteEscapeCharacter
+	}
+	w.alwaysQuote = strings.EqualFold(string(opts.QuoteFields), string(s3cli.CSVQuoteFieldsAlways))
+	return w
+}
+
+func (w *sCSVWriter) Write(buf *bytes.Buffer, names []string, values []interface{}) error {
+	for i, val := range values {
+		if i > 0 {
+			buf.WriteString(w.fieldDelimiter)
+		}
+		field := toString(val)
+		if w.alwaysQuote || strings.Contains(field, w.fieldDelimiter) || strings.Contains(field, w.quote) ||
+			strings.Contains(field, w.recordDelimiter) || strings.ContainsAny(field, "\r\n") {
+			buf.WriteString(w.quote)
+			buf.WriteString(strings.ReplaceAll(field, w.quote, w.quoteEscape+w.quote))
+			buf.WriteString(w.quote)
+		} else {
+			buf.WriteString(field)
+		}
+	}
+	buf.WriteString(w.recordDelimiter)
+	return nil
+}
+
+type sJSONWriter struct {
+	recordDelimiter string
+}
+
+func newJSONWriter(opts *s3cli.JSONOutputOptions) *sJSONWriter {
+	w := &sJSONWriter{
+		recordDelimiter: "\n",
+	}
+	if len(opts.RecordDelimiter) > 0 {
+		w.recordDelimiter = opts.RecordDelimiter
+	}
+	return w
+}
+
+func (w *sJSONWriter) Write(buf *bytes.Buffer, names []string, values []interface{}) error {
+	obj := NewOrderedMap()
+	for i := range values {
+		obj.Set(names[i], values[i])
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+	buf.Write(b)
+	buf.WriteString(w.recordDelimiter)
+	return nil
+}
@@ -0,0 +1,773 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/golang/snappy"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// A minimal Parquet reader: flat schemas (no repeated or nested columns),
+// PLAIN and dictionary encodings, data page v1/v2, uncompressed, snappy or
+// gzip codecs. Column chunks are fetched with ranged reads so that only the
+// footer and the column data are transferred from the backend.
+
+const (
+	parquetMagic = "PAR1"
+
+	parquetBoolean           = 0
+	parquetInt32             = 1
+	parquetInt64             = 2
+	parquetInt96             = 3
+	parquetFloat             = 4
+	parquetDouble            = 5
+	parquetByteArray         = 6
+	parquetFixedLenByteArray = 7
+
+	parquetRepetitionRequired = 0
+	parquetRepetitionOptional = 1
+	parquetRepetitionRepeated = 2
+
+	parquetEncodingPlain          = 0
+	parquetEncodingPlainDictonary = 2
+	parquetEncodingRLE            = 3
+	parquetEncodingRLEDictionary  = 8
+
+	parquetCodecUncompressed = 0
+	parquetCodecSnappy       = 1
+	parquetCodecGzip         = 2
+
+	parquetPageData       = 0
+	parquetPageDictionary = 2
+	parquetPageDataV2     = 3
+
+	maxParquetFooterBytes = 64 * 1024 * 1024
+)
+
+type sParquetSchemaElement struct {
+	Type           int32
+	TypeLength     int32
+	RepetitionType int32
+	Name           string
+	NumChildren    int32
+}
+
+type sParquetColumnMeta struct {
+	Type                  int32
+	Path                  []string
+	Codec                 int32
+	NumValues             int64
+	TotalCompressedSize   int64
+	DataPageOffset        int64
+	DictionaryPageOffset  int64
+	hasDictionaryPageOffs bool
+}
+
+type sParquetRowGroup struct {
+	Columns []sParquetColumnMeta
+	NumRows int64
+}
+
+type sParquetFileMeta struct {
+	Schema    []sParquetSchemaElement
+	NumRows   int64
+	RowGroups []sParquetRowGroup
+}
+
+type sParquetPageHeader struct {
+	Type                 int32
+	UncompressedSize     int32
+	CompressedSize       int32
+	NumValues            int32
+	Encoding             int32
+	DefLevelsByteLength  int32
+	RepLevelsByteLength  int32
+	IsCompressed         bool
+	DictionaryNumValues  int32
+	DictionaryEncoding   int32
+	hasDataPageHeader    bool
+	hasDataPageHeaderV2  bool
+	hasDictionaryPageHdr bool
+}
+
+// thrift compact protocol helpers
+
+type thriftFieldHandler func(prot thrift.TProtocol, fieldType thrift.TType, id int16) (bool, error)
+
+func readThriftStruct(prot thrift.TProtocol, handler thriftFieldHandler) error {
+	_, err := prot.ReadStructBegin()
+	if err != nil {
+		return err
+	}
+	for {
+		_, fieldType, id, err := prot.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if fieldType == thrift.STOP {
+			break
+		}
+		handled, err := handler(prot, fieldType, id)
+		if err != nil {
+			return err
+		}
+		if !handled {
+			err = thrift.SkipDefaultDepth(prot, fieldType)
+			if err != nil {
+				return err
+			}
+		}
+		err = prot.ReadFieldEnd()
+		if err != nil {
+			return err
+		}
+	}
+	return prot.ReadStructEnd()
+}
+
+func readThriftList(prot thrift.TProtocol, elem func(prot thrift.TProtocol) error) error {
+	_, size, err := prot.ReadListBegin()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < size; i++ {
+		err = elem(prot)
+		if err != nil {
+			return err
+		}
+	}
+	return prot.ReadListEnd()
+}
+
+func readSchemaElement(prot thrift.TProtocol) (sParquetSchemaElement, error) {
+	elem := sParquetSchemaElement{Type: -1}
+	err := readThriftStruct(prot, func(prot thrift.TProtocol, fieldType thrift.TType, id int16) (bool, error) {
+		var err error
+		switch id {
+		case 1:
+			elem.Type, err = prot.ReadI32()
+		case 2:
+			elem.TypeLength, err = prot.ReadI32()
+		case 3:
+			elem.RepetitionType, err = prot.ReadI32()
+		case 4:
+			elem.Name, err = prot.ReadString()
+		case 5:
+			elem.NumChildren, err = prot.ReadI32()
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+	return elem, err
+}
+
+func readColumnMeta(prot thrift.TProtocol) (sParquetColumnMeta, error) {
+	meta := sParquetColumnMeta{}
+	err := readThriftStruct(prot, func(prot thrift.TProtocol, fieldType thrift.TType, id int16) (bool, error) {
+		var err error
+		switch id {
+		case 1:
+			meta.Type, err = prot.ReadI32()
+		case 3:
+			err = readThriftList(prot, func(prot thrift.TProtocol) error {
+				name, err := prot.ReadString()
+				meta.Path = append(meta.Path, name)
+				return err
+			})
+		case 4:
+			meta.Codec, err = prot.ReadI32()
+		case 5:
+			meta.NumValues, err = prot.ReadI64()
+		case 7:
+			meta.TotalCompressedSize, err = prot.ReadI64()
+		case 9:
+			meta.DataPageOffset, err = prot.ReadI64()
+		case 11:
+			meta.DictionaryPageOffset, err = prot.ReadI64()
+			meta.hasDictionaryPageOffs = true
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+	return meta, err
+}
+
+func readRowGroup(prot thrift.TProtocol) (sParquetRowGroup, error) {
+	rg := sParquetRowGroup{}
+	err := readThriftStruct(prot, func(prot thrift.TProtocol, fieldType thrift.TType, id int16) (bool, error) {
+		switch id {
+		case 1:
+			return true, readThriftList(prot, func(prot thrift.TProtocol) error {
+				var meta *sParquetColumnMeta
+				err := readThriftStruct(prot, func(prot thrift.TProtocol, fieldType thrift.TType, id int16) (bool, error) {
+					if id == 3 {
+						m, err := readColumnMeta(prot)
+						meta = &m
+						return true, err
+					}
+					return false, nil
+				})
+				if err != nil {
+					return err
+				}
+				if meta == nil {
+					return errors.Wrap(ErrUnsupportedFormat, "parquet column chunk without inline metadata")
+				}
+				rg.Columns = append(rg.Columns, *meta)
+				return nil
+			})
+		case 3:
+			var err error
+			rg.NumRows, err = prot.ReadI64()
+			return true, err
+		}
+		return false, nil
+	})
+	return rg, err
+}
+
+func readFileMeta(data []byte) (*sParquetFileMeta, error) {
+	buf := thrift.NewTMemoryBuffer()
+	buf.Buffer = bytes.NewBuffer(data)
+	prot := thrift.NewTCompactProtocol(buf)
+	meta := &sParquetFileMeta{}
+	err := readThriftStruct(prot, func(prot thrift.TProtocol, fieldType thrift.TType, id int16) (bool, error) {
+		var err error
+		switch id {
+		case 2:
+			err = readThriftList(prot, func(prot thrift.TProtocol) error {
+				elem, err := readSchemaElement(prot)
+				meta.Schema = append(meta.Schema, elem)
+				return err
+			})
+		case 3:
+			meta.NumRows, err = prot.ReadI64()
+		case 4:
+			err = readThriftList(prot, func(prot thrift.TProtocol) error {
+				rg, err := readRowGroup(prot)
+				meta.RowGroups = append(meta.RowGroups, rg)
+				return err
+			})
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "decode parquet FileMetaData")
+	}
+	return meta, nil
+}
+
+// readPageHeader decodes a page header at the beginning of data and returns
+// it together with the number of bytes it occupies.
+func readPageHeader(data []byte) (*sParquetPageHeader, int, error) {
+	trans := thrift.NewTMemoryBuffer()
+	trans.Buffer = bytes.NewBuffer(data)
+	prot := thrift.NewTCompactProtocol(trans)
+	hdr := &sParquetPageHeader{IsCompressed: true}
+	err := readThriftStruct(prot, func(prot thrift.TProtocol, fieldType thrift.TType, id int16) (bool, error) {
+		var err error
+		switch id {
+		case 1:
+			hdr.Type, err = prot.ReadI32()
+		case 2:
+			hdr.UncompressedSize, err = prot.ReadI32()
+		case 3:
+			hdr.CompressedSize, err = prot.ReadI32()
+		case 5:
+			hdr.hasDataPageHeader = true
+			err = readThriftStruct(prot, func(prot thrift.TProtocol, fieldType thrift.TType, id int16) (bool, error) {
+				var err error
+				switch id {
+				case 1:
+					hdr.NumValues, err = prot.ReadI32()
+				case 2:
+					hdr.Encoding, err = prot.ReadI32()
+				default:
+					return false, nil
+				}
+				return true, err
+			})
+		case 7:
+			hdr.hasDictionaryPageHdr = true
+			err = readThriftStruct(prot, func(prot thrift.TProtocol, fieldType thrift.TType, id int16) (bool, error) {
+				var err error
+				switch id {
+				case 1:
+					hdr.DictionaryNumValues, err = prot.ReadI32()
+				case 2:
+					hdr.DictionaryEncoding, err = prot.ReadI32()
+				default:
+					return false, nil
+				}
+				return true, err
+			})
+		case 8:
+			hdr.hasDataPageHeaderV2 = true
+			err = readThriftStruct(prot, func(prot thrift.TProtocol, fieldType thrift.TType, id int16) (bool, error) {
+				var err error
+				switch id {
+				case 1:
+					hdr.NumValues, err = prot.ReadI32()
+				case 4:
+					hdr.Encoding, err = prot.ReadI32()
+				case 5:
+					hdr.DefLevelsByteLength, err = prot.ReadI32()
+				case 6:
+					hdr.RepLevelsByteLength, err = prot.ReadI32()
+				case 7:
+					hdr.IsCompressed, err = prot.ReadBool()
+				default:
+					return false, nil
+				}
+				return true, err
+			})
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "decode parquet PageHeader")
+	}
+	return hdr, len(data) - trans.Len(), nil
+}
+
+type sParquetColumn struct {
+	name     string
+	elem     sParquetSchemaElement
+	optional bool
+}
+
+type sParquetReader struct {
+	source  io.ReaderAt
+	meta    *sParquetFileMeta
+	columns []sParquetColumn
+	names   []string
+
+	rowGroup int
+	row      int64
+	values   [][]interface{}
+
+	bytesRead int64
+}
+
+func newParquetReader(source io.ReaderAt, size int64) (*sParquetReader, error) {
+	if size < int64(2*len(parquetMagic)+4) {
+		return nil, errors.Wrap(ErrUnsupportedFormat, "object too small to be parquet")
+	}
+	tail := make([]byte, 8)
+	_, err := source.ReadAt(tail, size-8)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "read parquet footer")
+	}
+	if string(tail[4:]) != parquetMagic {
+		return nil, errors.Wrap(ErrUnsupportedFormat, "invalid parquet magic")
+	}
+	footerLen := int64(binary.LittleEndian.Uint32(tail[:4]))
+	if footerLen <= 0 || footerLen > maxParquetFooterBytes || footerLen > size-8 {
+		return nil, errors.Wrapf(ErrUnsupportedFormat, "invalid parquet footer length %d", footerLen)
+	}
+	footer := make([]byte, footerLen)
+	_, err = source.ReadAt(footer, size-8-footerLen)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "read parquet metadata")
+	}
+	meta, err := readFileMeta(footer)
+	if err != nil {
+		return nil, err
+	}
+	r := &sParquetReader{
+		source:    source,
+		meta:      meta,
+		bytesRead: footerLen + 8,
+	}
+	if len(meta.Schema) == 0 {
+		return nil, errors.Wrap(ErrUnsupportedFormat, "empty parquet schema")
+	}
+	for _, elem := range meta.Schema[1:] {
+		if elem.NumChildren > 0 {
+			return nil, errors.Wrapf(ErrUnsupportedFormat, "nested parquet column %s", elem.Name)
+		}
+		if elem.RepetitionType == parquetRepetitionRepeated {
+			return nil, errors.Wrapf(ErrUnsupportedFormat, "repeated parquet column %s", elem.Name)
+		}
+		r.columns = append(r.columns, sParquetColumn{
+			name:     elem.Name,
+			elem:     elem,
+			optional: elem.RepetitionType == parquetRepetitionOptional,
+		})
+		r.names = append(r.names, elem.Name)
+	}
+	return r, nil
+}
+
+func (r *sParquetReader) Read() (*SRecord, error) {
+	for r.values == nil || r.row >= r.meta.RowGroups[r.rowGroup].NumRows {
+		if r.values != nil {
+			r.rowGroup++
+		}
+		if r.rowGroup >= len(r.meta.RowGroups) {
+			return nil, io.EOF
+		}
+		err := r.loadRowGroup()
+		if err != nil {
+			return nil, err
+		}
+	}
+	rec := &SRecord{
+		Names:  r.names,
+		Values: make([]interface{}, len(r.columns)),
+	}
+	for i := range r.columns {
+		if r.row < int64(len(r.values[i])) {
+			rec.Values[i] = r.values[i][r.row]
+		}
+	}
+	r.row++
+	return rec, nil
+}
+
+func (r *sParquetReader) loadRowGroup() error {
+	rg := r.meta.RowGroups[r.rowGroup]
+	if len(rg.Columns) != len(r.columns) {
+		return errors.Wrapf(ErrUnsupportedFormat, "row group has %d columns, schema has %d", len(rg.Columns), len(r.columns))
+	}
+	r.values = make([][]interface{}, len(r.columns))
+	r.row = 0
+	for i := range rg.Columns {
+		vals, err := r.readColumnChunk(r.columns[i], rg.Columns[i])
+		if err != nil {
+			return errors.Wrapf(err, "column %s", r.columns[i].name)
+		}
+		r.values[i] = vals
+	}
+	return nil
+}
+
+func (r *sParquetReader) readColumnChunk(col sParquetColumn, meta sParquetColumnMeta) ([]interface{}, error) {
+	offset := meta.DataPageOffset
+	if meta.hasDictionaryPageOffs && meta.DictionaryPageOffset > 0 && meta.DictionaryPageOffset < offset {
+		offset = meta.DictionaryPageOffset
+	}
+	chunk := make([]byte, meta.TotalCompressedSize)
+	_, err := r.source.ReadAt(chunk, offset)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "read column chunk")
+	}
+	r.bytesRead += int64(len(chunk))
+
+	pos := 0
+	var dict []interface{}
+	values := make([]interface{}, 0, meta.NumValues)
+	for int64(len(values)) < meta.NumValues && pos < len(chunk) {
+		hdr, hdrLen, err := readPageHeader(chunk[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += hdrLen
+		if hdr.CompressedSize < 0 || pos+int(hdr.CompressedSize) > len(chunk) {
+			return nil, errors.Wrap(ErrUnsupportedFormat, "truncated parquet page")
+		}
+		page := chunk[pos : pos+int(hdr.CompressedSize)]
+		pos += int(hdr.CompressedSize)
+		switch hdr.Type {
+		case parquetPageDictionary:
+			data, err := decompressPage(meta.Codec, page, hdr.UncompressedSize)
+			if err != nil {
+				return nil, err
+			}
+			dict, _, err = decodePlain(data, col.elem, int(hdr.DictionaryNumValues))
+			if err != nil {
+				return nil, errors.Wrap(err, "decode dictionary")
+			}
+		case parquetPageData, parquetPageDataV2:
+			vals, err := decodeDataPage(hdr, page, meta.Codec, col, dict)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, vals...)
+		}
+	}
+	return values, nil
+}
+
+func decompressPage(codec int32, data []byte, uncompressedSize int32) ([]byte, error) {
+	switch codec {
+	case parquetCodecUncompressed:
+		return data, nil
+	case parquetCodecSnappy:
+		out, err := snappy.Decode(make([]byte, uncompressedSize), data)
+		if err != nil {
+			return nil, errors.Wrap(err, "snappy.Decode")
+		}
+		return out, nil
+	case parquetCodecGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.Wrap(err, "gzip.NewReader")
+		}
+		defer gz.Close()
+		out := make([]byte, 0, uncompressedSize)
+		buf := bytes.NewBuffer(out)
+		_, err = io.Copy(buf, gz)
+		if err != nil {
+			return nil, errors.Wrap(err, "gunzip")
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, errors.Wrapf(ErrUnsupportedFormat, "parquet codec %d", codec)
+}
+
+func decodeDataPage(hdr *sParquetPageHeader, page []byte, codec int32, col sParquetColumn, dict []interface{}) ([]interface{}, error) {
+	numValues := int(hdr.NumValues)
+	var defLevels []int
+	var data []byte
+	var err error
+	if hdr.Type == parquetPageDataV2 {
+		levelsLen := int(hdr.RepLevelsByteLength + hdr.DefLevelsByteLength)
+		if levelsLen > len(page) {
+			return nil, errors.Wrap(ErrUnsupportedFormat, "invalid levels length")
+		}
+		if col.optional {
+			defLevels, err = decodeRLEHybrid(page[hdr.RepLevelsByteLength:levelsLen], 1, numValues)
+			if err != nil {
+				return nil, errors.Wrap(err, "decode definition levels")
+			}
+		}
+		data = page[levelsLen:]
+		if hdr.IsCompressed {
+			data, err = decompressPage(codec, data, hdr.UncompressedSize-int32(levelsLen))
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		data, err = decompressPage(codec, page, hdr.UncompressedSize)
+		if err != nil {
+			return nil, err
+		}
+		if col.optional {
+			if len(data) < 4 {
+				return nil, errors.Wrap(ErrUnsupportedFormat, "truncated definition levels")
+			}
+			levelsLen := int(binary.LittleEndian.Uint32(data[:4]))
+			if 4+levelsLen > len(data) {
+				return nil, errors.Wrap(ErrUnsupportedFormat, "invalid definition levels length")
+			}
+			defLevels, err = decodeRLEHybrid(data[4:4+levelsLen], 1, numValues)
+			if err != nil {
+				return nil, errors.Wrap(err, "decode definition levels")
+			}
+			data = data[4+levelsLen:]
+		}
+	}
+
+	nonNull := numValues
+	if defLevels != nil {
+		nonNull = 0
+		for _, l := range defLevels {
+			if l > 0 {
+				nonNull++
+			}
+		}
+	}
+
+	var vals []interface{}
+	switch hdr.Encoding {
+	case parquetEncodingPlain:
+		vals, _, err = decodePlain(data, col.elem, nonNull)
+	case parquetEncodingPlainDictonary, parquetEncodingRLEDictionary:
+		if dict == nil {
+			return nil, errors.Wrap(ErrUnsupportedFormat, "dictionary page missing")
+		}
+		if len(data) < 1 {
+			return nil, errors.Wrap(ErrUnsupportedFormat, "truncated dictionary indices")
+		}
+		var indices []int
+		indices, err = decodeRLEHybrid(data[1:], int(data[0]), nonNull)
+		if err == nil {
+			vals = make([]interface{}, len(indices))
+			for i, idx := range indices {
+				if idx < 0 || idx >= len(dict) {
+					return nil, errors.Wrapf(ErrUnsupportedFormat, "dictionary index %d out of range", idx)
+				}
+				vals[i] = dict[idx]
+			}
+		}
+	default:
+		return nil, errors.Wrapf(ErrUnsupportedFormat, "parquet encoding %d", hdr.Encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if defLevels == nil {
+		return vals, nil
+	}
+	result := make([]interface{}, numValues)
+	j := 0
+	for i, l := range defLevels {
+		if l > 0 && j < len(vals) {
+			result[i] = vals[j]
+			j++
+		}
+	}
+	return result, nil
+}
+
+func decodePlain(data []byte, elem sParquetSchemaElement, count int) ([]interface{}, int, error) {
+	vals := make([]interface{}, 0, count)
+	pos := 0
+	need := func(n int) error {
+		if pos+n > len(data) {
+			return errors.Wrap(ErrUnsupportedFormat, "truncated plain values")
+		}
+		return nil
+	}
+	for i := 0; i < count; i++ {
+		switch elem.Type {
+		case parquetBoolean:
+			if i/8 >= len(data) {
+				return nil, 0, errors.Wrap(ErrUnsupportedFormat, "truncated boolean values")
+			}
+			vals = append(vals, data[i/8]&(1<<uint(i%8)) != 0)
+			pos = i/8 + 1
+		case parquetInt32:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			vals = append(vals, int64(int32(binary.LittleEndian.Uint32(data[pos:]))))
+			pos += 4
+		case parquetInt64:
+			if err := need(8); err != nil {
+				return nil, 0, err
+			}
+			vals = append(vals, int64(binary.LittleEndian.Uint64(data[pos:])))
+			pos += 8
+		case parquetInt96:
+			if err := need(12); err != nil {
+				return nil, 0, err
+			}
+			vals = append(vals, int96ToString(data[pos:pos+12]))
+			pos += 12
+		case parquetFloat:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			vals = append(vals, float64(math.Float32frombits(binary.LittleEndian.Uint32(data[pos:]))))
+			pos += 4
+		case parquetDouble:
+			if err := need(8); err != nil {
+				return nil, 0, err
+			}
+			vals = append(vals, math.Float64frombits(binary.LittleEndian.Uint64(data[pos:])))
+			pos += 8
+		case parquetByteArray:
+			if err := need(4); err != nil {
+				return nil, 0, err
+			}
+			l := int(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+			if err := need(l); err != nil {
+				return nil, 0, err
+			}
+			vals = append(vals, string(data[pos:pos+l]))
+			pos += l
+		case parquetFixedLenByteArray:
+			l := int(elem.TypeLength)
+			if err := need(l); err != nil {
+				return nil, 0, err
+			}
+			vals = append(vals, string(data[pos:pos+l]))
+			pos += l
+		default:
+			return nil, 0, errors.Wrapf(ErrUnsupportedFormat, "parquet type %d", elem.Type)
+		}
+	}
+	return vals, pos, nil
+}
+
+// int96ToString converts the legacy Impala timestamp layout
+// (nanoseconds of day followed by the Julian day number) to RFC3339.
+func int96ToString(b []byte) string {
+	nanos := int64(binary.LittleEndian.Uint64(b[:8]))
+	julianDay := int64(binary.LittleEndian.Uint32(b[8:]))
+	const julianUnixEpoch = 2440588
+	secs := (julianDay-julianUnixEpoch)*86400 + nanos/1e9
+	return time.Unix(secs, nanos%1e9).UTC().Format(time.RFC3339Nano)
+}
+
+// decodeRLEHybrid decodes the RLE/bit-packing hybrid encoding used for
+// definition levels and dictionary indices.
+func decodeRLEHybrid(data []byte, bitWidth int, count int) ([]int, error) {
+	vals := make([]int, 0, count)
+	pos := 0
+	byteWidth := (bitWidth + 7) / 8
+	for len(vals) < count {
+		if pos >= len(data) {
+			return nil, errors.Wrap(ErrUnsupportedFormat, "truncated RLE data")
+		}
+		header, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return nil, errors.Wrap(ErrUnsupportedFormat, "invalid RLE header")
+		}
+		pos += n
+		if header&1 == 0 {
+			runLen := int(header >> 1)
+			if pos+byteWidth > len(data) {
+				return nil, errors.Wrap(ErrUnsupportedFormat, "truncated RLE run")
+			}
+			val := 0
+			for i := 0; i < byteWidth; i++ {
+				val |= int(data[pos+i]) << (8 * uint(i))
+			}
+			pos += byteWidth
+			for i := 0; i < runLen && len(vals) < count; i++ {
+				vals = append(vals, val)
+			}
+		} else {
+			groups := int(header >> 1)
+			numBytes := groups * bitWidth
+			if pos+numBytes > len(data) {
+				numBytes = len(data) - pos
+			}
+			packed := data[pos : pos+numBytes]
+			pos += numBytes
+			for i := 0; i < groups*8 && len(vals) < count; i++ {
+				val := 0
+				for b := 0; b < bitWidth; b++ {
+					bit := i*bitWidth + b
+					if bit/8 < len(packed) && packed[bit/8]&(1<<uint(bit%8)) != 0 {
+						val |= 1 << uint(b)
+					}
+				}
+				vals = append(vals, val)
+			}
+		}
+	}
+	return vals, nil
+}
@@ -0,0 +1,331 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// SOrderedMap is a JSON object that keeps the order of its keys so that
+// SELECT * returns fields in the order they appear in the input.
+type SOrderedMap struct {
+	Keys   []string
+	Values map[string]interface{}
+}
+
+func NewOrderedMap() *SOrderedMap {
+	return &SOrderedMap{
+		Values: make(map[string]interface{}),
+	}
+}
+
+func (m *SOrderedMap) Set(key string, val interface{}) {
+	if _, ok := m.Values[key]; !ok {
+		m.Keys = append(m.Keys, key)
+	}
+	m.Values[key] = val
+}
+
+func (m *SOrderedMap) Get(elem SPathElem) (interface{}, bool) {
+	if val, ok := m.Values[elem.Name]; ok {
+		return val, true
+	}
+	if elem.CaseSensitive {
+		return nil, false
+	}
+	for _, k := range m.Keys {
+		if strings.EqualFold(k, elem.Name) {
+			return m.Values[k], true
+		}
+	}
+	return nil, false
+}
+
+func (m *SOrderedMap) String() string {
+	return jsonString(m)
+}
+
+func (m *SOrderedMap) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, k := range m.Keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, _ := json.Marshal(k)
+		buf.Write(kb)
+		buf.WriteByte(':')
+		vb, err := json.Marshal(m.Values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func jsonString(val interface{}) string {
+	b, _ := json.Marshal(val)
+	return string(b)
+}
+
+// SRecord is a single input row. Names may be empty when the input has no
+// header, in which case columns are only addressable by position (_1, _2 ...).
+type SRecord struct {
+	Names  []string
+	Values []interface{}
+}
+
+var positionalColumn = regexp.MustCompile(`^_[1-9][0-9]*$`)
+
+func (r *SRecord) column(elem SPathElem) (interface{}, bool) {
+	if elem.IsIndex {
+		if elem.Index >= 0 && elem.Index < len(r.Values) {
+			return r.Values[elem.Index], true
+		}
+		return nil, false
+	}
+	for i, name := range r.Names {
+		if name == elem.Name {
+			return r.value(i), true
+		}
+	}
+	if !elem.CaseSensitive {
+		for i, name := range r.Names {
+			if strings.EqualFold(name, elem.Name) {
+				return r.value(i), true
+			}
+		}
+	}
+	if positionalColumn.MatchString(elem.Name) {
+		idx, _ := strconv.Atoi(elem.Name[1:])
+		if idx <= len(r.Values) {
+			return r.Values[idx-1], true
+		}
+	}
+	return nil, false
+}
+
+// value returns the i-th value, a ragged row shorter than the header yields
+// NULL for the trailing columns
+func (r *SRecord) value(i int) interface{} {
+	if i < len(r.Values) {
+		return r.Values[i]
+	}
+	return nil
+}
+
+// Lookup resolves a column path, descending into nested JSON values
+func (r *SRecord) Lookup(path []SPathElem) (interface{}, bool) {
+	if len(path) == 0 {
+		return r.Object(), true
+	}
+	val, ok := r.column(path[0])
+	if !ok {
+		return nil, false
+	}
+	return lookupValue(val, path[1:])
+}
+
+func lookupValue(val interface{}, path []SPathElem) (interface{}, bool) {
+	for _, elem := range path {
+		switch v := val.(type) {
+		case *SOrderedMap:
+			if elem.IsIndex {
+				return nil, false
+			}
+			next, ok := v.Get(elem)
+			if !ok {
+				return nil, false
+			}
+			val = next
+		case []interface{}:
+			if !elem.IsIndex || elem.Index < 0 || elem.Index >= len(v) {
+				return nil, false
+			}
+			val = v[elem.Index]
+		default:
+			return nil, false
+		}
+	}
+	return val, true
+}
+
+// Object returns the record as a JSON object
+func (r *SRecord) Object() *SOrderedMap {
+	obj := NewOrderedMap()
+	for i := range r.Values {
+		obj.Set(r.columnName(i), r.Values[i])
+	}
+	return obj
+}
+
+func (r *SRecord) columnName(i int) string {
+	if i < len(r.Names) && len(r.Names[i]) > 0 {
+		return r.Names[i]
+	}
+	return "_" + strconv.Itoa(i+1)
+}
+
+func recordFromValue(val interface{}) *SRecord {
+	if obj, ok := val.(*SOrderedMap); ok {
+		rec := &SRecord{
+			Names:  obj.Keys,
+			Values: make([]interface{}, len(obj.Keys)),
+		}
+		for i, k := range obj.Keys {
+			rec.Values[i] = obj.Values[k]
+		}
+		return rec
+	}
+	return &SRecord{Values: []interface{}{val}}
+}
+
+// IRecordReader produces input records one at a time, returning io.EOF at the end
+type IRecordReader interface {
+	Read() (*SRecord, error)
+}
+
+type sJSONReader struct {
+	decoder  *json.Decoder
+	document bool
+	pending  []interface{}
+}
+
+func newJSONReader(r io.Reader, document bool) *sJSONReader {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &sJSONReader{
+		decoder:  dec,
+		document: document,
+	}
+}
+
+func (r *sJSONReader) Read() (*SRecord, error) {
+	for len(r.pending) == 0 {
+		val, err := decodeOrdered(r.decoder)
+		if err != nil {
+			return nil, err
+		}
+		if arr, ok := val.([]interface{}); ok && r.document {
+			r.pending = arr
+			continue
+		}
+		return recordFromValue(val), nil
+	}
+	val := r.pending[0]
+	r.pending = r.pending[1:]
+	return recordFromValue(val), nil
+}
+
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return decodeOrderedToken(dec, tok)
+}
+
+func decodeOrderedToken(dec *json.Decoder, tok json.Token) (interface{}, error) {
+	switch v := tok.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			obj := NewOrderedMap()
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, ok := keyTok.(string)
+				if !ok {
+					return nil, errors.Wrapf(ErrEvaluate, "invalid object key %v", keyTok)
+				}
+				val, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj.Set(key, val)
+			}
+			_, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			return obj, nil
+		case '[':
+			arr := make([]interface{}, 0)
+			for dec.More() {
+				val, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, val)
+			}
+			_, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			return arr, nil
+		}
+		return nil, errors.Wrapf(ErrEvaluate, "unexpected delimiter %s", v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid number %s", v)
+		}
+		return f, nil
+	}
+	return tok, nil
+}
+
+// sPathReader expands FROM S3Object[*].path: each input record is descended
+// along the path and arrays found there are flattened into records.
+type sPathReader struct {
+	reader  IRecordReader
+	path    []SPathElem
+	pending []interface{}
+}
+
+func (r *sPathReader) Read() (*SRecord, error) {
+	for len(r.pending) == 0 {
+		rec, err := r.reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		val, ok := rec.Lookup(r.path)
+		if !ok {
+			continue
+		}
+		if arr, ok := val.([]interface{}); ok {
+			r.pending = arr
+		} else {
+			return recordFromValue(val), nil
+		}
+	}
+	val := r.pending[0]
+	r.pending = r.pending[1:]
+	return recordFromValue(val), nil
+}
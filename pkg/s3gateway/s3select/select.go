@@ -0,0 +1,319 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/s3cli"
+)
+
+const (
+	recordsMessageBytes = 128 * 1024
+	keepAliveInterval   = 5 * time.Second
+)
+
+// IObjectSource gives access to the object being queried. CSV and JSON
+// inputs are consumed as a stream, Parquet needs random access to the footer.
+type IObjectSource interface {
+	io.ReaderAt
+	Open(ctx context.Context) (io.ReadCloser, error)
+	Size() int64
+}
+
+type SSelector struct {
+	request *s3cli.SelectObjectOptions
+	query   *SQuery
+	output  IRecordWriter
+}
+
+// NewSelector validates a SelectObjectContent request, so that malformed
+// requests can be rejected with a regular error response before the event
+// stream begins.
+func NewSelector(req *s3cli.SelectObjectOptions) (*SSelector, error) {
+	if len(req.ExpressionType) > 0 && !strings.EqualFold(string(req.ExpressionType), string(s3cli.QueryExpressionTypeSQL)) {
+		return nil, errors.Wrapf(ErrUnsupportedFormat, "ExpressionType %s", req.ExpressionType)
+	}
+	query, err := ParseQuery(req.Expression)
+	if err != nil {
+		return nil, err
+	}
+	input := req.InputSerialization
+	formats := 0
+	if input.CSV != nil {
+		formats++
+	}
+	if input.JSON != nil {
+		formats++
+		switch strings.ToUpper(string(input.JSON.Type)) {
+		case "", string(s3cli.JSONDocumentType), s3cli.JSONLinesType:
+		default:
+			return nil, errors.Wrapf(ErrUnsupportedFormat, "JSON Type %s", input.JSON.Type)
+		}
+	}
+	if input.Parquet != nil {
+		formats++
+		if len(input.CompressionType) > 0 && !strings.EqualFold(string(input.CompressionType), string(s3cli.SelectCompressionNONE)) {
+			return nil, errors.Wrap(ErrUnsupportedFormat, "Parquet input does not support CompressionType")
+		}
+	}
+	if formats != 1 {
+		return nil, errors.Wrap(ErrUnsupportedFormat, "exactly one of CSV, JSON or Parquet input serialization is required")
+	}
+	s := &SSelector{
+		request: req,
+		query:   query,
+	}
+	output := req.OutputSerialization
+	switch {
+	case output.CSV != nil && output.JSON == nil:
+		s.output = newCSVWriter(output.CSV)
+	case output.JSON != nil && output.CSV == nil:
+		s.output = newJSONWriter(output.JSON)
+	default:
+		return nil, errors.Wrap(ErrUnsupportedFormat, "exactly one of CSV or JSON output serialization is required")
+	}
+	return s, nil
+}
+
+type sSelectRun struct {
+	selector *SSelector
+	events   *sEventStreamWriter
+
+	scanned   func() int64
+	processed func() int64
+	returned  int64
+
+	buf      bytes.Buffer
+	lastSent time.Time
+}
+
+func (run *sSelectRun) stats() s3cli.StatsMessage {
+	return s3cli.StatsMessage{
+		BytesScanned:   run.scanned(),
+		BytesProcessed: run.processed(),
+		BytesReturned:  run.returned,
+	}
+}
+
+func (run *sSelectRun) flush() error {
+	if run.buf.Len() == 0 {
+		return nil
+	}
+	run.returned += int64(run.buf.Len())
+	err := run.events.Records(run.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	run.buf.Reset()
+	run.lastSent = time.Now()
+	if run.selector.request.RequestProgress.Enabled {
+		return run.events.Progress(run.stats())
+	}
+	return nil
+}
+
+func (run *sSelectRun) keepAlive() error {
+	if time.Since(run.lastSent) < keepAliveInterval {
+		return nil
+	}
+	run.lastSent = time.Now()
+	if run.selector.request.RequestProgress.Enabled {
+		return run.events.Progress(run.stats())
+	}
+	return run.events.Continuation()
+}
+
+func (s *SSelector) openReader(ctx context.Context, source IObjectSource, run *sSelectRun) (IRecordReader, io.Closer, error) {
+	input := s.request.InputSerialization
+	if input.Parquet != nil {
+		reader, err := newParquetReader(source, source.Size())
+		if err != nil {
+			return nil, nil, err
+		}
+		run.scanned = func() int64 { return reader.bytesRead }
+		run.processed = run.scanned
+		return reader, nil, nil
+	}
+	stream, err := source.Open(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "open object")
+	}
+	scanned := &sCountingReader{reader: stream}
+	decompressed, err := decompress(scanned, input.CompressionType)
+	if err != nil {
+		stream.Close()
+		return nil, nil, err
+	}
+	processed := &sCountingReader{reader: decompressed}
+	run.scanned = func() int64 { return scanned.count }
+	run.processed = func() int64 { return processed.count }
+	if input.CSV != nil {
+		reader, err := newCSVReader(processed, input.CSV)
+		if err != nil {
+			stream.Close()
+			return nil, nil, err
+		}
+		return reader, stream, nil
+	}
+	document := !strings.EqualFold(string(input.JSON.Type), s3cli.JSONLinesType)
+	return newJSONReader(processed, document), stream, nil
+}
+
+// Run evaluates the query over the object and writes the result to w as
+// an event stream. Errors after the stream has started are reported as an
+// error message in the stream as well as returned.
+func (s *SSelector) Run(ctx context.Context, source IObjectSource, w io.Writer) error {
+	run := &sSelectRun{
+		selector: s,
+		events:   newEventStreamWriter(w),
+		lastSent: time.Now(),
+	}
+	err := s.run(ctx, source, run)
+	if err != nil {
+		log.Errorf("select object: %s", err)
+		code := "InternalError"
+		switch errors.Cause(err) {
+		case ErrParse:
+			code = "ParseError"
+		case ErrEvaluate:
+			code = "EvaluatorError"
+		case ErrUnsupportedFormat:
+			code = "UnsupportedFormat"
+		}
+		run.events.Error(code, err.Error())
+		return err
+	}
+	return nil
+}
+
+func (s *SSelector) run(ctx context.Context, source IObjectSource, run *sSelectRun) error {
+	reader, closer, err := s.openReader(ctx, source, run)
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+	if len(s.query.Path) > 0 {
+		reader = &sPathReader{reader: reader, path: s.query.Path}
+	}
+
+	query := s.query
+	var count int64
+	for query.Limit < 0 || count < query.Limit || query.HasAgg {
+		if ctx.Err() != nil {
+			return errors.Wrap(ctx.Err(), "select object")
+		}
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.Wrap(err, "read record")
+		}
+		if query.Where != nil {
+			match, err := query.Where.Eval(rec)
+			if err != nil {
+				return err
+			}
+			if b, null := toBool(match); null || !b {
+				if err := run.keepAlive(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		count++
+		if query.HasAgg {
+			for _, agg := range query.aggregates {
+				if err := agg.Accumulate(rec); err != nil {
+					return err
+				}
+			}
+			if err := run.keepAlive(); err != nil {
+				return err
+			}
+			continue
+		}
+		names, values, err := s.project(rec)
+		if err != nil {
+			return err
+		}
+		err = s.output.Write(&run.buf, names, values)
+		if err != nil {
+			return err
+		}
+		if run.buf.Len() >= recordsMessageBytes {
+			if err := run.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if query.HasAgg {
+		names, values, err := s.project(&SRecord{})
+		if err != nil {
+			return err
+		}
+		err = s.output.Write(&run.buf, names, values)
+		if err != nil {
+			return err
+		}
+	}
+	err = run.flush()
+	if err != nil {
+		return err
+	}
+	err = run.events.Stats(run.stats())
+	if err != nil {
+		return err
+	}
+	return run.events.End()
+}
+
+func (s *SSelector) project(rec *SRecord) ([]string, []interface{}, error) {
+	if s.query.Star {
+		names := make([]string, len(rec.Values))
+		for i := range rec.Values {
+			names[i] = rec.columnName(i)
+		}
+		return names, rec.Values, nil
+	}
+	names := make([]string, len(s.query.Items))
+	values := make([]interface{}, len(s.query.Items))
+	for i, item := range s.query.Items {
+		val, err := item.Expr.Eval(rec)
+		if err != nil {
+			return nil, nil, err
+		}
+		values[i] = val
+		names[i] = item.Alias
+		if len(names[i]) == 0 {
+			if col, ok := item.Expr.(*SColumnRef); ok {
+				names[i] = col.Name()
+			}
+		}
+		if len(names[i]) == 0 {
+			names[i] = "_" + strconv.Itoa(i+1)
+		}
+	}
+	return names, values, nil
+}
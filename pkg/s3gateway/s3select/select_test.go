@@ -0,0 +1,393 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+
+	"yunion.io/x/s3cli"
+)
+
+type sBytesSource struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newBytesSource(data []byte) *sBytesSource {
+	return &sBytesSource{Reader: bytes.NewReader(data), data: data}
+}
+
+func (s *sBytesSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(s.data)), nil
+}
+
+type sDecodedEvent struct {
+	headers map[string]string
+	payload []byte
+}
+
+func decodeEvents(t *testing.T, data []byte) []sDecodedEvent {
+	events := make([]sDecodedEvent, 0)
+	for len(data) > 0 {
+		totalLen := binary.BigEndian.Uint32(data[0:4])
+		hdrLen := binary.BigEndian.Uint32(data[4:8])
+		if crc32.ChecksumIEEE(data[:8]) != binary.BigEndian.Uint32(data[8:12]) {
+			t.Fatalf("prelude crc mismatch")
+		}
+		if crc32.ChecksumIEEE(data[:totalLen-4]) != binary.BigEndian.Uint32(data[totalLen-4:totalLen]) {
+			t.Fatalf("message crc mismatch")
+		}
+		event := sDecodedEvent{headers: map[string]string{}}
+		hdrs := data[12 : 12+hdrLen]
+		for len(hdrs) > 0 {
+			nameLen := int(hdrs[0])
+			name := string(hdrs[1 : 1+nameLen])
+			valLen := int(binary.BigEndian.Uint16(hdrs[2+nameLen:]))
+			event.headers[name] = string(hdrs[4+nameLen : 4+nameLen+valLen])
+			hdrs = hdrs[4+nameLen+valLen:]
+		}
+		event.payload = data[12+hdrLen : totalLen-4]
+		events = append(events, event)
+		data = data[totalLen:]
+	}
+	return events
+}
+
+func runSelect(t *testing.T, req *s3cli.SelectObjectOptions, data []byte) string {
+	selector, err := NewSelector(req)
+	if err != nil {
+		t.Fatalf("NewSelector %s: %s", req.Expression, err)
+	}
+	out := bytes.Buffer{}
+	err = selector.Run(context.Background(), newBytesSource(data), &out)
+	if err != nil {
+		t.Fatalf("Run %s: %s", req.Expression, err)
+	}
+	events := decodeEvents(t, out.Bytes())
+	if len(events) < 2 || events[len(events)-1].headers[":event-type"] != EVENT_END || events[len(events)-2].headers[":event-type"] != EVENT_STATS {
+		t.Fatalf("event stream must end with Stats and End: %v", events)
+	}
+	records := bytes.Buffer{}
+	for _, e := range events {
+		if e.headers[":event-type"] == EVENT_RECORDS {
+			records.Write(e.payload)
+		}
+	}
+	return records.String()
+}
+
+const testCSV = `name,age,city
+alice,30,beijing
+bob,25,shanghai
+carol,41,"beijing, haidian"
+dave,,shenzhen
+`
+
+func TestSelectCSV(t *testing.T) {
+	cases := []struct {
+		sql  string
+		want string
+	}{
+		{
+			sql:  "SELECT * FROM S3Object LIMIT 1",
+			want: "alice,30,beijing\n",
+		},
+		{
+			sql:  "SELECT s.name FROM S3Object s WHERE s.age > 28",
+			want: "alice\ncarol\n",
+		},
+		{
+			sql:  "SELECT name, city FROM S3Object WHERE city LIKE 'beijing%'",
+			want: "alice,beijing\ncarol,\"beijing, haidian\"\n",
+		},
+		{
+			sql:  "SELECT _1 FROM S3Object WHERE age IS NULL OR age = ''",
+			want: "dave\n",
+		},
+		{
+			sql:  "SELECT COUNT(*), SUM(CAST(age AS INT)), MAX(name) FROM S3Object WHERE age <> ''",
+			want: "3,96,carol\n",
+		},
+		{
+			sql:  "SELECT UPPER(name) FROM S3Object s WHERE s.age BETWEEN 25 AND 30 AND s.city IN ('shanghai')",
+			want: "BOB\n",
+		},
+	}
+	for _, c := range cases {
+		req := &s3cli.SelectObjectOptions{
+			Expression:     c.sql,
+			ExpressionType: s3cli.QueryExpressionTypeSQL,
+		}
+		req.InputSerialization.CSV = &s3cli.CSVInputOptions{FileHeaderInfo: s3cli.CSVFileHeaderInfoUse}
+		req.OutputSerialization.CSV = &s3cli.CSVOutputOptions{}
+		got := runSelect(t, req, []byte(testCSV))
+		if got != c.want {
+			t.Errorf("%s: want %q got %q", c.sql, c.want, got)
+		}
+	}
+}
+
+func TestSelectCSVRagged(t *testing.T) {
+	data := "a,b,c\n1,2\n3,4,5\n"
+	cases := []struct {
+		sql  string
+		want string
+	}{
+		{
+			sql:  "SELECT c FROM S3Object",
+			want: "\n5\n",
+		},
+		{
+			sql:  "SELECT a FROM S3Object WHERE C IS NULL",
+			want: "1\n",
+		},
+	}
+	for _, c := range cases {
+		req := &s3cli.SelectObjectOptions{
+			Expression:     c.sql,
+			ExpressionType: s3cli.QueryExpressionTypeSQL,
+		}
+		req.InputSerialization.CSV = &s3cli.CSVInputOptions{FileHeaderInfo: s3cli.CSVFileHeaderInfoUse}
+		req.OutputSerialization.CSV = &s3cli.CSVOutputOptions{}
+		got := runSelect(t, req, []byte(data))
+		if got != c.want {
+			t.Errorf("%s: want %q got %q", c.sql, c.want, got)
+		}
+	}
+}
+
+func TestSelectJSON(t *testing.T) {
+	lines := `{"id":1,"host":{"name":"h1","cpu":0.5},"tags":["a","b"]}
+{"id":2,"host":{"name":"h2","cpu":0.9},"tags":["c"]}
+{"id":3,"host":{"name":"h3","cpu":0.7}}
+`
+	cases := []struct {
+		sql  string
+		want string
+	}{
+		{
+			sql:  "SELECT s.id, s.host.name FROM S3Object s WHERE s.host.cpu >= 0.7",
+			want: "{\"id\":2,\"name\":\"h2\"}\n{\"id\":3,\"name\":\"h3\"}\n",
+		},
+		{
+			sql:  "SELECT s.tags[0] AS tag FROM S3Object s WHERE s.tags IS NOT NULL",
+			want: "{\"tag\":\"a\"}\n{\"tag\":\"c\"}\n",
+		},
+		{
+			sql:  "SELECT AVG(s.id) AS avg FROM S3Object s",
+			want: "{\"avg\":2}\n",
+		},
+		{
+			sql:  "SELECT * FROM S3Object s WHERE s.id = 3",
+			want: "{\"id\":3,\"host\":{\"name\":\"h3\",\"cpu\":0.7}}\n",
+		},
+	}
+	for _, c := range cases {
+		req := &s3cli.SelectObjectOptions{
+			Expression: c.sql,
+		}
+		req.InputSerialization.JSON = &s3cli.JSONInputOptions{Type: s3cli.JSONLinesType}
+		req.OutputSerialization.JSON = &s3cli.JSONOutputOptions{}
+		got := runSelect(t, req, []byte(lines))
+		if got != c.want {
+			t.Errorf("%s: want %q got %q", c.sql, c.want, got)
+		}
+	}
+}
+
+func TestParseQueryError(t *testing.T) {
+	cases := []string{
+		"SELECT FROM S3Object",
+		"SELECT * FROM table",
+		"SELECT name, COUNT(*) FROM S3Object",
+		"SELECT * FROM S3Object WHERE COUNT(*) > 1",
+		"SELECT * FROM S3Object LIMIT x",
+		"SELECT 'abc FROM S3Object",
+	}
+	for _, c := range cases {
+		_, err := ParseQuery(c)
+		if err == nil {
+			t.Errorf("%s: expect parse error", c)
+		}
+	}
+}
+
+// writeTestParquet builds an uncompressed, PLAIN encoded parquet file with a
+// required INT64 column "id" and an optional BYTE_ARRAY column "name".
+func writeTestParquet(t *testing.T, ids []int64, names []interface{}) []byte {
+	ctx := context.Background()
+	file := bytes.Buffer{}
+	file.WriteString(parquetMagic)
+
+	encode := func(write func(prot *thrift.TCompactProtocol)) []byte {
+		buf := thrift.NewTMemoryBuffer()
+		prot := thrift.NewTCompactProtocol(buf)
+		write(prot)
+		prot.Flush(ctx)
+		return buf.Bytes()
+	}
+	i32 := func(prot *thrift.TCompactProtocol, id int16, v int32) {
+		prot.WriteFieldBegin("", thrift.I32, id)
+		prot.WriteI32(v)
+		prot.WriteFieldEnd()
+	}
+	i64 := func(prot *thrift.TCompactProtocol, id int16, v int64) {
+		prot.WriteFieldBegin("", thrift.I64, id)
+		prot.WriteI64(v)
+		prot.WriteFieldEnd()
+	}
+	pageHeader := func(size int, numValues int) []byte {
+		return encode(func(prot *thrift.TCompactProtocol) {
+			prot.WriteStructBegin("PageHeader")
+			i32(prot, 1, parquetPageData)
+			i32(prot, 2, int32(size))
+			i32(prot, 3, int32(size))
+			prot.WriteFieldBegin("", thrift.STRUCT, 5)
+			prot.WriteStructBegin("DataPageHeader")
+			i32(prot, 1, int32(numValues))
+			i32(prot, 2, parquetEncodingPlain)
+			i32(prot, 3, parquetEncodingRLE)
+			i32(prot, 4, parquetEncodingRLE)
+			prot.WriteFieldStop()
+			prot.WriteStructEnd()
+			prot.WriteFieldEnd()
+			prot.WriteFieldStop()
+			prot.WriteStructEnd()
+		})
+	}
+
+	// column id
+	idPage := bytes.Buffer{}
+	for _, id := range ids {
+		binary.Write(&idPage, binary.LittleEndian, id)
+	}
+	idOffset := int64(file.Len())
+	file.Write(pageHeader(idPage.Len(), len(ids)))
+	file.Write(idPage.Bytes())
+	idSize := int64(file.Len()) - idOffset
+
+	// column name: definition levels as a single bit-packed run, then values
+	levels := make([]byte, (len(names)+7)/8)
+	values := bytes.Buffer{}
+	for i, n := range names {
+		if n != nil {
+			levels[i/8] |= 1 << uint(i%8)
+			binary.Write(&values, binary.LittleEndian, uint32(len(n.(string))))
+			values.WriteString(n.(string))
+		}
+	}
+	levelData := append([]byte{byte(len(levels)<<1 | 1)}, levels...)
+	namePage := bytes.Buffer{}
+	binary.Write(&namePage, binary.LittleEndian, uint32(len(levelData)))
+	namePage.Write(levelData)
+	namePage.Write(values.Bytes())
+	nameOffset := int64(file.Len())
+	file.Write(pageHeader(namePage.Len(), len(names)))
+	file.Write(namePage.Bytes())
+	nameSize := int64(file.Len()) - nameOffset
+
+	columnChunk := func(prot *thrift.TCompactProtocol, typ int32, path string, offset int64, size int64, num int) {
+		prot.WriteStructBegin("ColumnChunk")
+		i64(prot, 2, offset)
+		prot.WriteFieldBegin("", thrift.STRUCT, 3)
+		prot.WriteStructBegin("ColumnMetaData")
+		i32(prot, 1, typ)
+		prot.WriteFieldBegin("", thrift.LIST, 3)
+		prot.WriteListBegin(thrift.STRING, 1)
+		prot.WriteString(path)
+		prot.WriteListEnd()
+		prot.WriteFieldEnd()
+		i32(prot, 4, parquetCodecUncompressed)
+		i64(prot, 5, int64(num))
+		i64(prot, 6, size)
+		i64(prot, 7, size)
+		i64(prot, 9, offset)
+		prot.WriteFieldStop()
+		prot.WriteStructEnd()
+		prot.WriteFieldEnd()
+		prot.WriteFieldStop()
+		prot.WriteStructEnd()
+	}
+	schemaElement := func(prot *thrift.TCompactProtocol, typ int32, repetition int32, name string, children int32) {
+		prot.WriteStructBegin("SchemaElement")
+		if typ >= 0 {
+			i32(prot, 1, typ)
+			i32(prot, 3, repetition)
+		}
+		prot.WriteFieldBegin("", thrift.STRING, 4)
+		prot.WriteString(name)
+		prot.WriteFieldEnd()
+		if children > 0 {
+			i32(prot, 5, children)
+		}
+		prot.WriteFieldStop()
+		prot.WriteStructEnd()
+	}
+	footer := encode(func(prot *thrift.TCompactProtocol) {
+		prot.WriteStructBegin("FileMetaData")
+		i32(prot, 1, 1)
+		prot.WriteFieldBegin("", thrift.LIST, 2)
+		prot.WriteListBegin(thrift.STRUCT, 3)
+		schemaElement(prot, -1, 0, "schema", 2)
+		schemaElement(prot, parquetInt64, parquetRepetitionRequired, "id", 0)
+		schemaElement(prot, parquetByteArray, parquetRepetitionOptional, "name", 0)
+		prot.WriteListEnd()
+		prot.WriteFieldEnd()
+		i64(prot, 3, int64(len(ids)))
+		prot.WriteFieldBegin("", thrift.LIST, 4)
+		prot.WriteListBegin(thrift.STRUCT, 1)
+		prot.WriteStructBegin("RowGroup")
+		prot.WriteFieldBegin("", thrift.LIST, 1)
+		prot.WriteListBegin(thrift.STRUCT, 2)
+		columnChunk(prot, parquetInt64, "id", idOffset, idSize, len(ids))
+		columnChunk(prot, parquetByteArray, "name", nameOffset, nameSize, len(names))
+		prot.WriteListEnd()
+		prot.WriteFieldEnd()
+		i64(prot, 2, idSize+nameSize)
+		i64(prot, 3, int64(len(ids)))
+		prot.WriteFieldStop()
+		prot.WriteStructEnd()
+		prot.WriteListEnd()
+		prot.WriteFieldEnd()
+		prot.WriteFieldStop()
+		prot.WriteStructEnd()
+	})
+	file.Write(footer)
+	binary.Write(&file, binary.LittleEndian, uint32(len(footer)))
+	file.WriteString(parquetMagic)
+	return file.Bytes()
+}
+
+func TestSelectParquet(t *testing.T) {
+	data := writeTestParquet(t, []int64{1, 2, 3}, []interface{}{"a", nil, "c"})
+	req := &s3cli.SelectObjectOptions{
+		Expression: "SELECT s.id, s.name FROM S3Object s WHERE s.id >= 2",
+	}
+	req.InputSerialization.Parquet = &s3cli.ParquetInputOptions{}
+	req.OutputSerialization.CSV = &s3cli.CSVOutputOptions{}
+	got := runSelect(t, req, data)
+	want := "2,\n3,c\n"
+	if got != want {
+		t.Errorf("want %q got %q", want, got)
+	}
+}
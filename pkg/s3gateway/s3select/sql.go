@@ -0,0 +1,701 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	ErrParse = errors.Error("ParseError")
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) isKeyword(kw string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+func (t token) isOp(op string) bool {
+	return t.kind == tokOp && t.text == op
+}
+
+func tokenize(sql string) ([]token, error) {
+	tokens := make([]token, 0)
+	runes := []rune(sql)
+	i := 0
+	for i < len(runes) {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			start := i
+			i++
+			buf := strings.Builder{}
+			closed := false
+			for i < len(runes) {
+				if runes[i] == c {
+					if i+1 < len(runes) && runes[i+1] == c {
+						buf.WriteRune(c)
+						i += 2
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				buf.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, errors.Wrapf(ErrParse, "unterminated quote at %d", start)
+			}
+			kind := tokString
+			if c == '"' {
+				kind = tokQuotedIdent
+			}
+			tokens = append(tokens, token{kind: kind, text: buf.String(), pos: start})
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E' ||
+				((runes[i] == '-' || runes[i] == '+') && (runes[i-1] == 'e' || runes[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(runes[start:i]), pos: start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[start:i]), pos: start})
+		default:
+			start := i
+			if i+1 < len(runes) {
+				two := string(runes[i : i+2])
+				switch two {
+				case "<=", ">=", "<>", "!=", "||":
+					tokens = append(tokens, token{kind: tokOp, text: two, pos: start})
+					i += 2
+					continue
+				}
+			}
+			switch c {
+			case '=', '<', '>', '+', '-', '*', '/', '%', '(', ')', ',', '.', '[', ']':
+				tokens = append(tokens, token{kind: tokOp, text: string(c), pos: start})
+				i++
+			default:
+				return nil, errors.Wrapf(ErrParse, "unexpected character %q at %d", c, start)
+			}
+		}
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+// SSelectItem is one projected expression of a SELECT statement
+type SSelectItem struct {
+	Expr  Expr
+	Alias string
+}
+
+// SQuery is the parsed form of an S3 Select SQL statement
+type SQuery struct {
+	Star   bool
+	Items  []SSelectItem
+	Alias  string
+	Path   []SPathElem
+	Where  Expr
+	Limit  int64
+	HasAgg bool
+
+	aggregates []*SAggregate
+}
+
+type sParser struct {
+	tokens []token
+	pos    int
+	query  *SQuery
+}
+
+var reservedWords = map[string]bool{
+	"select": true, "from": true, "where": true, "limit": true, "and": true, "or": true,
+	"not": true, "is": true, "null": true, "like": true, "escape": true, "between": true,
+	"in": true, "as": true, "true": true, "false": true, "cast": true, "missing": true,
+}
+
+// ParseQuery parses a subset of the S3 Select SQL dialect:
+//
+//	SELECT * | expr [[AS] alias], ... FROM S3Object[[*][.path]] [[AS] alias] [WHERE expr] [LIMIT n]
+func ParseQuery(sql string) (*SQuery, error) {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &sParser{tokens: tokens, query: &SQuery{Limit: -1}}
+	err = p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	return p.query, nil
+}
+
+func (p *sParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *sParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *sParser) errorf(format string, args ...interface{}) error {
+	return errors.Wrapf(ErrParse, "%s at %d", fmt.Sprintf(format, args...), p.peek().pos)
+}
+
+func (p *sParser) expectKeyword(kw string) error {
+	if !p.peek().isKeyword(kw) {
+		return p.errorf("expect %s", strings.ToUpper(kw))
+	}
+	p.next()
+	return nil
+}
+
+func (p *sParser) expectOp(op string) error {
+	if !p.peek().isOp(op) {
+		return p.errorf("expect %q", op)
+	}
+	p.next()
+	return nil
+}
+
+func (p *sParser) parseQuery() error {
+	err := p.expectKeyword("select")
+	if err != nil {
+		return err
+	}
+	if p.peek().isOp("*") {
+		p.next()
+		p.query.Star = true
+	} else {
+		for {
+			item, err := p.parseSelectItem()
+			if err != nil {
+				return err
+			}
+			p.query.Items = append(p.query.Items, item)
+			if !p.peek().isOp(",") {
+				break
+			}
+			p.next()
+		}
+	}
+	err = p.expectKeyword("from")
+	if err != nil {
+		return err
+	}
+	err = p.parseFrom()
+	if err != nil {
+		return err
+	}
+	if p.peek().isKeyword("where") {
+		p.next()
+		p.query.Where, err = p.parseExpr()
+		if err != nil {
+			return err
+		}
+		if containsAggregate(p.query.Where) {
+			return p.errorf("aggregate function is not allowed in WHERE clause")
+		}
+	}
+	if p.peek().isKeyword("limit") {
+		p.next()
+		t := p.next()
+		if t.kind != tokNumber {
+			return p.errorf("expect number after LIMIT")
+		}
+		p.query.Limit, err = strconv.ParseInt(t.text, 10, 64)
+		if err != nil || p.query.Limit < 0 {
+			return errors.Wrapf(ErrParse, "invalid LIMIT %s", t.text)
+		}
+	}
+	if p.peek().kind != tokEOF {
+		return p.errorf("unexpected token %q", p.peek().text)
+	}
+	return p.resolveAggregates()
+}
+
+func (p *sParser) resolveAggregates() error {
+	for i := range p.query.Items {
+		aggs := collectAggregates(p.query.Items[i].Expr, nil)
+		if len(aggs) > 0 {
+			p.query.HasAgg = true
+			p.query.aggregates = append(p.query.aggregates, aggs...)
+		}
+	}
+	if p.query.HasAgg {
+		for i := range p.query.Items {
+			if !containsAggregate(p.query.Items[i].Expr) && !isConstant(p.query.Items[i].Expr) {
+				return errors.Wrap(ErrParse, "cannot mix aggregate and non-aggregate projections")
+			}
+		}
+	}
+	return nil
+}
+
+func (p *sParser) parseSelectItem() (SSelectItem, error) {
+	item := SSelectItem{}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return item, err
+	}
+	item.Expr = expr
+	if p.peek().isKeyword("as") {
+		p.next()
+		t := p.next()
+		if t.kind != tokIdent && t.kind != tokQuotedIdent {
+			return item, p.errorf("expect alias after AS")
+		}
+		item.Alias = t.text
+	} else if t := p.peek(); t.kind == tokQuotedIdent || (t.kind == tokIdent && !reservedWords[strings.ToLower(t.text)]) {
+		p.next()
+		item.Alias = t.text
+	}
+	return item, nil
+}
+
+func (p *sParser) parseFrom() error {
+	t := p.next()
+	if !t.isKeyword("s3object") {
+		return errors.Wrapf(ErrParse, "expect S3Object at %d", t.pos)
+	}
+	if p.peek().isOp("[") {
+		p.next()
+		if err := p.expectOp("*"); err != nil {
+			return err
+		}
+		if err := p.expectOp("]"); err != nil {
+			return err
+		}
+		for p.peek().isOp(".") || p.peek().isOp("[") {
+			elem, err := p.parsePathElem()
+			if err != nil {
+				return err
+			}
+			p.query.Path = append(p.query.Path, elem)
+		}
+	}
+	if p.peek().isKeyword("as") {
+		p.next()
+	}
+	if t := p.peek(); t.kind == tokQuotedIdent || (t.kind == tokIdent && !reservedWords[strings.ToLower(t.text)]) {
+		p.next()
+		p.query.Alias = t.text
+	}
+	return nil
+}
+
+func (p *sParser) parsePathElem() (SPathElem, error) {
+	if p.peek().isOp(".") {
+		p.next()
+		t := p.next()
+		switch t.kind {
+		case tokIdent:
+			return SPathElem{Name: t.text}, nil
+		case tokQuotedIdent:
+			return SPathElem{Name: t.text, CaseSensitive: true}, nil
+		}
+		return SPathElem{}, errors.Wrapf(ErrParse, "expect field name at %d", t.pos)
+	}
+	if err := p.expectOp("["); err != nil {
+		return SPathElem{}, err
+	}
+	t := p.next()
+	var elem SPathElem
+	switch t.kind {
+	case tokNumber:
+		idx, err := strconv.Atoi(t.text)
+		if err != nil {
+			return elem, errors.Wrapf(ErrParse, "invalid index %s", t.text)
+		}
+		elem = SPathElem{Index: idx, IsIndex: true}
+	case tokString:
+		elem = SPathElem{Name: t.text, CaseSensitive: true}
+	default:
+		return elem, errors.Wrapf(ErrParse, "invalid index at %d", t.pos)
+	}
+	return elem, p.expectOp("]")
+}
+
+func (p *sParser) parseExpr() (Expr, error) {
+	return p.parseOr()
+}
+
+func (p *sParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &SLogicExpr{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *sParser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &SLogicExpr{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *sParser) parseNot() (Expr, error) {
+	if p.peek().isKeyword("not") {
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &SNotExpr{Expr: expr}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *sParser) parseComparison() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind == tokOp {
+		switch t.text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			op := t.text
+			if op == "<>" {
+				op = "!="
+			}
+			return &SCompareExpr{Op: op, Left: left, Right: right}, nil
+		}
+		return left, nil
+	}
+	if t.isKeyword("is") {
+		p.next()
+		negate := false
+		if p.peek().isKeyword("not") {
+			p.next()
+			negate = true
+		}
+		if !p.peek().isKeyword("null") && !p.peek().isKeyword("missing") {
+			return nil, p.errorf("expect NULL")
+		}
+		p.next()
+		return &SIsNullExpr{Expr: left, Negate: negate}, nil
+	}
+	negate := false
+	if t.isKeyword("not") {
+		p.next()
+		negate = true
+		t = p.peek()
+	}
+	switch {
+	case t.isKeyword("like"):
+		p.next()
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		like := &SLikeExpr{Expr: left, Pattern: pattern, Negate: negate}
+		if p.peek().isKeyword("escape") {
+			p.next()
+			like.Escape, err = p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return like, nil
+	case t.isKeyword("between"):
+		p.next()
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("and"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &SBetweenExpr{Expr: left, Low: low, High: high, Negate: negate}, nil
+	case t.isKeyword("in"):
+		p.next()
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		in := &SInExpr{Expr: left, Negate: negate}
+		for {
+			item, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			in.List = append(in.List, item)
+			if !p.peek().isOp(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return in, nil
+	}
+	if negate {
+		return nil, p.errorf("expect LIKE, BETWEEN or IN after NOT")
+	}
+	return left, nil
+}
+
+func (p *sParser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.isOp("+") && !t.isOp("-") && !t.isOp("||") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &SArithExpr{Op: t.text, Left: left, Right: right}
+	}
+}
+
+func (p *sParser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.isOp("*") && !t.isOp("/") && !t.isOp("%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &SArithExpr{Op: t.text, Left: left, Right: right}
+	}
+}
+
+func (p *sParser) parseUnary() (Expr, error) {
+	if p.peek().isOp("-") {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &SArithExpr{Op: "-", Left: &SLiteral{Value: int64(0)}, Right: expr}, nil
+	}
+	if p.peek().isOp("+") {
+		p.next()
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+func (p *sParser) parsePrimary() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		if strings.ContainsAny(t.text, ".eE") {
+			f, err := strconv.ParseFloat(t.text, 64)
+			if err != nil {
+				return nil, errors.Wrapf(ErrParse, "invalid number %s", t.text)
+			}
+			return &SLiteral{Value: f}, nil
+		}
+		i, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(ErrParse, "invalid number %s", t.text)
+		}
+		return &SLiteral{Value: i}, nil
+	case tokString:
+		return &SLiteral{Value: t.text}, nil
+	case tokQuotedIdent:
+		return p.parseColumnRef(SPathElem{Name: t.text, CaseSensitive: true})
+	case tokOp:
+		if t.text == "(" {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return expr, p.expectOp(")")
+		}
+		return nil, errors.Wrapf(ErrParse, "unexpected %q at %d", t.text, t.pos)
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "null", "missing":
+			return &SLiteral{Value: nil}, nil
+		case "true":
+			return &SLiteral{Value: true}, nil
+		case "false":
+			return &SLiteral{Value: false}, nil
+		case "cast":
+			return p.parseCast()
+		}
+		if p.peek().isOp("(") {
+			return p.parseFunction(t.text)
+		}
+		return p.parseColumnRef(SPathElem{Name: t.text})
+	}
+	return nil, errors.Wrapf(ErrParse, "unexpected end of expression at %d", t.pos)
+}
+
+func (p *sParser) parseCast() (Expr, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("as"); err != nil {
+		return nil, err
+	}
+	t := p.next()
+	if t.kind != tokIdent {
+		return nil, errors.Wrapf(ErrParse, "expect type name at %d", t.pos)
+	}
+	typ := strings.ToLower(t.text)
+	switch typ {
+	case "int", "integer", "bigint", "smallint":
+		typ = "int"
+	case "float", "double", "decimal", "numeric", "real":
+		typ = "float"
+	case "string", "varchar", "char", "text":
+		typ = "string"
+	case "bool", "boolean":
+		typ = "bool"
+	default:
+		return nil, errors.Wrapf(ErrParse, "unsupported cast type %s", t.text)
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	return &SCastExpr{Expr: expr, Type: typ}, nil
+}
+
+func (p *sParser) parseFunction(name string) (Expr, error) {
+	p.next() // (
+	lname := strings.ToLower(name)
+	if aggFunc, ok := aggregateFuncs[lname]; ok {
+		agg := &SAggregate{Func: aggFunc}
+		if p.peek().isOp("*") {
+			if aggFunc != AGG_COUNT {
+				return nil, p.errorf("%s(*) not supported", strings.ToUpper(name))
+			}
+			p.next()
+		} else {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if containsAggregate(arg) {
+				return nil, p.errorf("nested aggregate function")
+			}
+			agg.Arg = arg
+		}
+		return agg, p.expectOp(")")
+	}
+	fn, ok := scalarFuncs[lname]
+	if !ok {
+		return nil, p.errorf("unsupported function %s", name)
+	}
+	call := &SFuncExpr{Name: lname, fn: fn}
+	if !p.peek().isOp(")") {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if !p.peek().isOp(",") {
+				break
+			}
+			p.next()
+		}
+	}
+	return call, p.expectOp(")")
+}
+
+func (p *sParser) parseColumnRef(first SPathElem) (Expr, error) {
+	path := []SPathElem{first}
+	for p.peek().isOp(".") || p.peek().isOp("[") {
+		elem, err := p.parsePathElem()
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, elem)
+	}
+	return &SColumnRef{Path: path, query: p.query}, nil
+}
@@ -16,6 +16,7 @@ package service
 
 import (
 	"os"
+	"time"
 
 	_ "yunion.io/x/cloudmux/pkg/multicloud/loader"
 	"yunion.io/x/log"
@@ -24,8 +25,10 @@ import (
 	api "yunion.io/x/onecloud/pkg/apis/s3gateway"
 	"yunion.io/x/onecloud/pkg/cloudcommon"
 	app_common "yunion.io/x/onecloud/pkg/cloudcommon/app"
+	"yunion.io/x/onecloud/pkg/cloudcommon/cronman"
 	common_options "yunion.io/x/onecloud/pkg/cloudcommon/options"
 	"yunion.io/x/onecloud/pkg/s3gateway/handlers"
+	"yunion.io/x/onecloud/pkg/s3gateway/models"
 	"yunion.io/x/onecloud/pkg/s3gateway/options"
 )
 
@@ -42,6 +45,11 @@ func StartService() {
 	app := app_common.InitApp(&opts.BaseOptions, false)
 	handlers.InitHandlers(app)
 
+	cron := cronman.InitCronJobManager(false, opts.CronJobWorkerCount, opts.TimeZone)
+	cron.AddJobAtIntervals("ApplyBucketLifecycleRules", time.Duration(opts.LifecycleCheckIntervalMinutes)*time.Minute, models.BucketManager.ApplyLifecycleRules)
+	cron.Start()
+	defer cron.Stop()
+
 	/*if !opts.IsSlaveNode {
 		cron := cronman.GetCronJobManager(true)
 		cron.AddJobAtIntervals("CleanPendingDeleteImages", time.Duration(options.Options.PendingDeleteCheckSeconds)*time.Second, models.ImageManager.CleanPendingDeleteImages)
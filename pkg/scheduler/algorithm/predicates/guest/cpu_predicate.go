@@ -16,11 +16,13 @@ package guest
 
 import (
 	"context"
+	"fmt"
 
 	"yunion.io/x/onecloud/pkg/apis"
 	"yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/scheduler/algorithm/predicates"
 	"yunion.io/x/onecloud/pkg/scheduler/core"
+	o "yunion.io/x/onecloud/pkg/scheduler/options"
 )
 
 // CPUPredicate check the current resources of the CPU is available,
@@ -82,6 +84,20 @@ func (f *CPUPredicate) Execute(ctx context.Context, u *core.Unit, c core.Candida
 
 	freeCPUCount := getter.FreeCPUCount(useRsvd)
 	reqCPUCount := int64(d.Ncpu + d.ExtraCpuCount)
+	if host, hu, ok := predicates.GetHostUtilization(c); ok {
+		if hu == nil {
+			h.AppendInfo(fmt.Sprintf("no recent utilization metrics, use static free cpu %d", freeCPUCount))
+		} else {
+			staticFree := freeCPUCount
+			cmtbound := host.GetCPUOvercommitBound()
+			freeCPUCount = predicates.UtilizationFreeCount(
+				int64(host.GetCpuCount()), cmtbound, hu.CpuUsage,
+				o.Options.UtilizationCpuSafetyMargin, int64(getter.GetPendingUsage().Cpu),
+				getter.TotalCPUCount(useRsvd), staticFree, o.Options.UtilizationOvercommitLimit)
+			h.AppendInfo(fmt.Sprintf("cpu usage %.1f%% of %d cores, safety margin %d%%, cmtbound %.1f, free cpu %d (static %d)",
+				hu.CpuUsage, host.GetCpuCount(), o.Options.UtilizationCpuSafetyMargin, cmtbound, freeCPUCount, staticFree))
+		}
+	}
 	if freeCPUCount < reqCPUCount {
 		totalCPUCount := getter.TotalCPUCount(useRsvd)
 		h.AppendInsufficientResourceError(reqCPUCount, totalCPUCount, freeCPUCount)
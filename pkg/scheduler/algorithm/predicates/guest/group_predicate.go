@@ -14,100 +14,72 @@
 
 package guest
 
-/*import (
+import (
+	"context"
 	"fmt"
+	"sort"
 
-	"yunion.io/x/onecloud/pkg/scheduler/algorithm/plugin"
 	"yunion.io/x/onecloud/pkg/scheduler/algorithm/predicates"
 	"yunion.io/x/onecloud/pkg/scheduler/core"
-	"yunion.io/x/onecloud/pkg/scheduler/core/score"
 )
 
-// GroupPredicate filter the packet based on the label information,
-// the same group of guests should avoid schedule on same host.
+// GroupPredicate checks the hard affinity and anti-affinity rules of instance groups
+// over their topology domains. Anti-affinity on host dimension limited by granularity
+// is still handled when selecting hosts, see core.transToInstanceGroupSchedResult.
+// The counts only include the guests before this request, the guests of a batch
+// are counted one by one when selecting hosts.
 type GroupPredicate struct {
 	predicates.BasePredicate
-	plugin.BasePlugin
 
-	ExcludeGroups []string
-	RequireGroups []string
-	AvoidGroups   []string
-	PreferGroups  []string
+	topologies []*core.GroupTopology
 }
 
 func (p *GroupPredicate) Name() string {
-	return "host_group"
+	return "instance_group"
 }
 
 func (p *GroupPredicate) Clone() core.FitPredicate {
 	return &GroupPredicate{}
 }
 
-func (p *GroupPredicate) PreExecute(u *core.Unit, cs []core.Candidater) (bool, error) {
-	d := u.SchedData()
-	if len(d.GroupRelations) == 0 {
-		return false, nil
-	}
-
-	for _, r := range d.GroupRelations {
-		if r.Strategy == "exclude" {
-			p.ExcludeGroups = append(p.ExcludeGroups, r.GroupId)
-		} else if r.Strategy == "require" {
-			p.RequireGroups = append(p.RequireGroups, r.GroupId)
-		} else if r.Strategy == "avoid" {
-			p.AvoidGroups = append(p.AvoidGroups, r.GroupId)
-		} else if r.Strategy == "prefer" {
-			p.PreferGroups = append(p.PreferGroups, r.GroupId)
+func (p *GroupPredicate) PreExecute(ctx context.Context, u *core.Unit, cs []core.Candidater) (bool, error) {
+	p.topologies = make([]*core.GroupTopology, 0)
+	for _, group := range u.SchedData().InstanceGroupsDetail {
+		if group.IsHostAntiAffinity() || !group.ForceDispersion.IsTrue() {
+			continue
 		}
+		p.topologies = append(p.topologies, core.NewGroupTopology(group, cs))
 	}
-	u.AppendSelectPlugin(p)
-	return true, nil
+	sort.Slice(p.topologies, func(i, j int) bool {
+		return p.topologies[i].Group.Id < p.topologies[j].Group.Id
+	})
+	return len(p.topologies) > 0, nil
 }
 
-func (p *GroupPredicate) Execute(u *core.Unit, c core.Candidater) (bool, []core.PredicateFailureReason, error) {
-
+func (p *GroupPredicate) Execute(ctx context.Context, u *core.Unit, c core.Candidater) (bool, []core.PredicateFailureReason, error) {
 	h := predicates.NewPredicateHelper(p, u, c)
 
-	g, err := h.GetGroupCounts()
-	if err != nil {
-		return false, nil, err
-	}
-
-	if len(p.ExcludeGroups) > 0 {
-		for _, groupId := range p.ExcludeGroups {
-			if g.ExistsGroup(groupId) {
-				h.Exclude(fmt.Sprintf("exclude by %v:exclude", groupId))
-				break
-			}
+	for _, t := range p.topologies {
+		group := t.Group
+		domain, count := t.Count(c)
+		if len(domain) == 0 {
+			h.Exclude(fmt.Sprintf("host has no topology %q required by instance group %s", group.TopologyKey, group.Name))
+			continue
 		}
-	} else if len(p.RequireGroups) > 0 {
-		for _, groupId := range p.RequireGroups {
-			if !g.ExistsGroup(groupId) {
-				h.Exclude(fmt.Sprintf("exclude by %v:require", groupId))
-				break
+		if t.IsAffinity() {
+			if count == 0 && t.MemberCount() > 0 {
+				h.Exclude(fmt.Sprintf("instance group %s requires affinity, no member in %s %s", group.Name, group.TopologyKey, domain))
 			}
+			continue
+		}
+		granularity := group.Granularity
+		if granularity < 1 {
+			granularity = 1
+		}
+		if count >= granularity {
+			h.Exclude(fmt.Sprintf("instance group %s requires anti-affinity, %d members in %s %s", group.Name, count, group.TopologyKey, domain))
 		}
 	}
 
 	return h.GetResult()
 }
-
-func (p *GroupPredicate) OnPriorityEnd(u *core.Unit, c core.Candidater) {
-	if len(p.AvoidGroups) > 0 {
-		u.SetFrontScore(
-			c.IndexKey(),
-			score.NewScore(
-				score.TScore(-core.PriorityStep*len(p.AvoidGroups)),
-				p.Name()+":avoid",
-			))
-	}
-
-	if len(p.PreferGroups) > 0 {
-		u.SetFrontScore(
-			c.IndexKey(),
-			score.NewScore(
-				score.TScore(core.PriorityStep*len(p.PreferGroups)),
-				p.Name()+":prefer",
-			))
-	}
-}*/
@@ -23,6 +23,7 @@ import (
 	"yunion.io/x/onecloud/pkg/apis/scheduler"
 	"yunion.io/x/onecloud/pkg/scheduler/algorithm/predicates"
 	"yunion.io/x/onecloud/pkg/scheduler/core"
+	o "yunion.io/x/onecloud/pkg/scheduler/options"
 )
 
 // MemoryPredicate filter current resources free memory capacity is meet,
@@ -63,6 +64,20 @@ func (p *MemoryPredicate) Execute(ctx context.Context, u *core.Unit, c core.Cand
 	getter := c.Getter()
 	freeMemSize := getter.FreeMemorySize(useRsvd)
 	reqMemSize := int64(d.Memory)
+	if host, hu, ok := predicates.GetHostUtilization(c); ok {
+		if hu == nil {
+			h.AppendInfo(fmt.Sprintf("no recent utilization metrics, use static free memory %dMB", freeMemSize))
+		} else {
+			staticFree := freeMemSize
+			cmtbound := host.GetMemoryOvercommitBound()
+			freeMemSize = predicates.UtilizationFreeCount(
+				int64(host.GetMemSize()), cmtbound, hu.MemUsage,
+				o.Options.UtilizationMemorySafetyMargin, int64(getter.GetPendingUsage().Memory),
+				getter.TotalMemorySize(useRsvd), staticFree, o.Options.UtilizationOvercommitLimit)
+			h.AppendInfo(fmt.Sprintf("memory usage %.1f%% of %dMB, safety margin %d%%, cmtbound %.1f, free memory %dMB (static %dMB)",
+				hu.MemUsage, host.GetMemSize(), o.Options.UtilizationMemorySafetyMargin, cmtbound, freeMemSize, staticFree))
+		}
+	}
 	if freeMemSize < reqMemSize {
 		totalMemSize := getter.TotalMemorySize(useRsvd)
 		h.AppendInsufficientResourceError(reqMemSize, totalMemSize, freeMemSize)
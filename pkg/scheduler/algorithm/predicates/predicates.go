@@ -70,21 +70,24 @@ func (b *BasePredicate) GetHypervisorDriver(u *core.Unit) models.IGuestDriver {
 type PredicateHelper struct {
 	predicate      core.FitPredicate
 	predicateFails []core.PredicateFailureReason
-	capacity       int64
-	Unit           *core.Unit
-	Candidate      core.Candidater
+	// infos explain how the predicate decides, they are returned with the result
+	// even if the candidate fits, so they can be shown in scheduler history
+	infos     []core.PredicateFailureReason
+	capacity  int64
+	Unit      *core.Unit
+	Candidate core.Candidater
 }
 
 func (h *PredicateHelper) getResult() (bool, []core.PredicateFailureReason, error) {
 	if len(h.predicateFails) > 0 {
-		return false, h.predicateFails, nil
+		return false, append(h.predicateFails, h.infos...), nil
 	}
 
 	if h.capacity == 0 {
-		return false, []core.PredicateFailureReason{}, nil
+		return false, append([]core.PredicateFailureReason{}, h.infos...), nil
 	}
 
-	return true, nil, nil
+	return true, h.infos, nil
 }
 
 func (h *PredicateHelper) GetResult() (bool, []core.PredicateFailureReason, error) {
@@ -149,6 +152,24 @@ func (h *PredicateHelper) AppendPredicateFailMsgWithType(reason string, eType st
 	h.AppendPredicateFail(&predicateFailure{err: err, eType: eType})
 }
 
+type predicateInfo struct {
+	info  string
+	eType string
+}
+
+func (i predicateInfo) GetReason() string {
+	return i.info
+}
+
+func (i predicateInfo) GetType() string {
+	return i.eType
+}
+
+// AppendInfo records the detail of decision, which doesn't make the candidate fail
+func (h *PredicateHelper) AppendInfo(info string) {
+	h.infos = append(h.infos, &predicateInfo{info: info, eType: h.predicate.Name()})
+}
+
 func (h *PredicateHelper) AppendInsufficientResourceError(req, total, free int64) {
 	h.AppendPredicateFail(
 		&predicateFailure{
@@ -363,7 +384,7 @@ func (p *BaseSchedtagPredicate) check(input ISchedtagCustomer, candidate ISchedt
 	// if err != nil {
 	// 	return nil, err
 	// }
-	tagPredicate := NewSchedtagPredicate(input.GetSchedtags(), allTags)
+	tagPredicate := NewSchedtagPredicate(filterWhatIfSchedtagConfigs(u, input.GetSchedtags()), allTags)
 	res := &PredicatedSchedtagResource{
 		ISchedtagCandidateResource: candidate,
 	}
@@ -494,6 +515,7 @@ func (p *BaseSchedtagPredicate) Execute(
 			h.Exclude(fmt.Sprintf("get all schedtags"))
 			break
 		}
+		allTags = filterWhatIfSchedtags(u, allTags)
 		//checkTime := time.Now()
 		matchedResources, err := p.checkResources(input, fitResources, u, c, allTags)
 		//log.Infof("---%s checkResources time: %s", sp.Name(), time.Since(checkTime))
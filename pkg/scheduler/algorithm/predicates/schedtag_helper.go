@@ -24,6 +24,7 @@ import (
 
 	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
 	"yunion.io/x/onecloud/pkg/scheduler/data_manager/schedtag"
 	"yunion.io/x/onecloud/pkg/scheduler/options"
 	"yunion.io/x/onecloud/pkg/util/conditionparser"
@@ -317,6 +318,35 @@ func (c *SchedtagChecker) Check(p ISchedtagPredicate, candidate ISchedtagCandida
 	return nil
 }
 
+// filterWhatIfSchedtags drops the schedtags removed by explain what-if input
+func filterWhatIfSchedtags(u *core.Unit, tags []schedtag.ISchedtag) []schedtag.ISchedtag {
+	whatIf := u.SchedData().WhatIf
+	if whatIf == nil || len(whatIf.RemoveSchedtags) == 0 {
+		return tags
+	}
+	ret := make([]schedtag.ISchedtag, 0, len(tags))
+	for _, tag := range tags {
+		if !whatIf.IsSchedtagRemoved(tag.GetId(), tag.GetName()) {
+			ret = append(ret, tag)
+		}
+	}
+	return ret
+}
+
+func filterWhatIfSchedtagConfigs(u *core.Unit, tags []*computeapi.SchedtagConfig) []*computeapi.SchedtagConfig {
+	whatIf := u.SchedData().WhatIf
+	if whatIf == nil || len(whatIf.RemoveSchedtags) == 0 {
+		return tags
+	}
+	ret := make([]*computeapi.SchedtagConfig, 0, len(tags))
+	for _, tag := range tags {
+		if !whatIf.IsSchedtagRemoved(tag.Id, tag.Id) {
+			ret = append(ret, tag)
+		}
+	}
+	return ret
+}
+
 func GetInputSchedtagByType(tags []*computeapi.SchedtagConfig, types ...string) []*computeapi.SchedtagConfig {
 	ret := make([]*computeapi.SchedtagConfig, 0)
 	for _, tag := range tags {
@@ -0,0 +1,69 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicates
+
+import (
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+	"yunion.io/x/onecloud/pkg/scheduler/data_manager/utilization"
+	"yunion.io/x/onecloud/pkg/scheduler/options"
+)
+
+const (
+	// hosts with this metadata set to false are scheduled by static overcommit bound
+	// even if utilization-aware schedule is enabled
+	HostMetadataUtilizationAware = "sched_utilization_aware"
+)
+
+// GetHostUtilization returns the host and its recent utilization if utilization-aware
+// schedule is enabled for the candidate, the utilization is nil if metrics is missing.
+func GetHostUtilization(c core.Candidater) (*models.SHost, *utilization.HostUtilization, bool) {
+	if !options.Options.EnableUtilizationAwareSchedule {
+		return nil, nil, false
+	}
+	getter := c.Getter()
+	if getter.HostMetadata()[HostMetadataUtilizationAware] == "false" {
+		return nil, nil, false
+	}
+	host := getter.Host()
+	if host == nil {
+		return nil, nil, false
+	}
+	return host, utilization.Get(host.Id), true
+}
+
+// UtilizationFreeCount computes the effective free capacity from the real usage of
+// physical resource instead of the allocation:
+//
+//	headroom = physical * (1 - margin%) - physical * usage%
+//	free = headroom * cmtbound - pending
+//
+// total and free are the static capacity by overcommit bound, the allocation
+// including the new one is limited to total * limit.
+func UtilizationFreeCount(physical int64, cmtbound float32, usage float64, margin int, pending int64, total, free int64, limit float32) int64 {
+	headroom := float64(physical)*(1-float64(margin)/100) - float64(physical)*usage/100
+	if headroom < 0 {
+		headroom = 0
+	}
+	ret := int64(headroom*float64(cmtbound)) - pending
+	allocated := total - free
+	if limitFree := int64(float64(total)*float64(limit)) - allocated; ret > limitFree {
+		ret = limitFree
+	}
+	if ret < 0 {
+		ret = 0
+	}
+	return ret
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicates
+
+import "testing"
+
+func TestUtilizationFreeCount(t *testing.T) {
+	cases := []struct {
+		name     string
+		physical int64
+		cmtbound float32
+		usage    float64
+		margin   int
+		pending  int64
+		total    int64
+		free     int64
+		limit    float32
+		want     int64
+	}{
+		{
+			// idle host: headroom 32*0.8-32*0.1=22.4 cores, 22.4*4=89, limited by 128*2-120=136
+			name: "idle host packs over static bound", physical: 32, cmtbound: 4, usage: 10, margin: 20,
+			total: 128, free: 8, limit: 2, want: 89,
+		},
+		{
+			name: "busy host is not overcommitted", physical: 32, cmtbound: 4, usage: 85, margin: 20,
+			total: 128, free: 100, limit: 2, want: 0,
+		},
+		{
+			name: "limited by overcommit limit", physical: 32, cmtbound: 8, usage: 0, margin: 20,
+			total: 256, free: 0, limit: 1.5, want: 128,
+		},
+		{
+			name: "pending usage is subtracted", physical: 10, cmtbound: 1, usage: 50, margin: 10,
+			pending: 2, total: 10, free: 10, limit: 2, want: 2,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := UtilizationFreeCount(c.physical, c.cmtbound, c.usage, c.margin, c.pending, c.total, c.free, c.limit)
+			if got != c.want {
+				t.Errorf("want %d, got %d", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guest
+
+import (
+	"sort"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/scheduler/algorithm/priorities"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+	"yunion.io/x/onecloud/pkg/scheduler/core/score"
+)
+
+func groupTopologies(u *core.Unit, cs []core.Candidater, filter func(group *models.SGroup) bool) []*core.GroupTopology {
+	ret := make([]*core.GroupTopology, 0)
+	for _, group := range u.SchedData().InstanceGroupsDetail {
+		if filter(group) {
+			ret = append(ret, core.NewGroupTopology(group, cs))
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Group.Id < ret[j].Group.Id
+	})
+	return ret
+}
+
+// GroupAffinityPriority scores the soft affinity and anti-affinity rules of instance groups,
+// candidates in the domain with group members are preferred for affinity and avoided for anti-affinity.
+// The guests of a batch are scored again one by one when selecting hosts.
+type GroupAffinityPriority struct {
+	priorities.BasePriority
+
+	topologies []*core.GroupTopology
+}
+
+func (p *GroupAffinityPriority) Name() string {
+	return "guest_group_affinity"
+}
+
+func (p *GroupAffinityPriority) Clone() core.Priority {
+	return &GroupAffinityPriority{}
+}
+
+func (p *GroupAffinityPriority) PreExecute(u *core.Unit, cs []core.Candidater) (bool, []core.PredicateFailureReason, error) {
+	p.topologies = groupTopologies(u, cs, func(group *models.SGroup) bool {
+		// soft anti-affinity on host is handled when selecting hosts
+		return !group.ForceDispersion.IsTrue() && !group.IsHostAntiAffinity()
+	})
+	return len(p.topologies) > 0, nil, nil
+}
+
+func (p *GroupAffinityPriority) Map(u *core.Unit, c core.Candidater) (core.HostPriority, error) {
+	h := priorities.NewPriorityHelper(p, u, c)
+
+	val := 0
+	for _, t := range p.topologies {
+		val += t.AffinityScore(c)
+	}
+	if val != 0 {
+		h.SetScore(val)
+	}
+
+	return h.GetResult()
+}
+
+func (p *GroupAffinityPriority) ScoreIntervals() score.Intervals {
+	return score.NewIntervals(0, 1, 10)
+}
+
+// TopologySpreadPriority spreads the guests of instance groups with max_skew over the
+// topology domains. The skew of a domain is the guest count after placement minus the
+// minimum guest count of all domains, domains exceed max_skew are scored down instead
+// of being filtered, so the placement doesn't fail when some domains are full.
+type TopologySpreadPriority struct {
+	priorities.BasePriority
+
+	topologies []*core.GroupTopology
+}
+
+func (p *TopologySpreadPriority) Name() string {
+	return "guest_topology_spread"
+}
+
+func (p *TopologySpreadPriority) Clone() core.Priority {
+	return &TopologySpreadPriority{}
+}
+
+func (p *TopologySpreadPriority) PreExecute(u *core.Unit, cs []core.Candidater) (bool, []core.PredicateFailureReason, error) {
+	p.topologies = groupTopologies(u, cs, func(group *models.SGroup) bool {
+		return group.MaxSkew > 0 && group.Affinity != computeapi.INSTANCE_GROUP_AFFINITY
+	})
+	return len(p.topologies) > 0, nil, nil
+}
+
+func (p *TopologySpreadPriority) Map(u *core.Unit, c core.Candidater) (core.HostPriority, error) {
+	h := priorities.NewPriorityHelper(p, u, c)
+
+	val := 0
+	for _, t := range p.topologies {
+		val += t.SpreadScore(c)
+	}
+	if val != 0 {
+		h.SetScore(val)
+	}
+
+	return h.GetResult()
+}
+
+func (p *TopologySpreadPriority) ScoreIntervals() score.Intervals {
+	return score.NewIntervals(0, 1, 10)
+}
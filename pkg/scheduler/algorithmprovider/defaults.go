@@ -36,7 +36,7 @@ func defaultPredicates() sets.String {
 		factory.RegisterFitPredicate("e-GuestDomainFilter", &predicates.DomainPredicate{}),
 		factory.RegisterFitPredicate("e-GuestImageFilter", &predicateguest.ImagePredicate{}),
 		factory.RegisterFitPredicate("f-ClassMetadataFilter", &predicates.ClassMetadataPredicate{}),
-		//factory.RegisterFitPredicate("f-GuestGroupFilter", &predicateguest.GroupPredicate{}),
+		factory.RegisterFitPredicate("f-GuestGroupFilter", &predicateguest.GroupPredicate{}),
 		factory.RegisterFitPredicate("g-GuestCPUFilter", &predicateguest.CPUPredicate{}),
 		factory.RegisterFitPredicate("h-GuestMemoryFilter", &predicateguest.MemoryPredicate{}),
 		factory.RegisterFitPredicate("i-GuestStorageFilter", &predicateguest.StoragePredicate{}),
@@ -60,5 +60,7 @@ func defaultPriorities() sets.String {
 		factory.RegisterPriority("guest-creating", &priorityguest.CreatingPriority{}, 1),
 		factory.RegisterPriority("guest-capacity", &priorityguest.CapacityPriority{}, 1),
 		factory.RegisterPriority("guest-cpunumapin", &priorityguest.CpuNumaPinPriority{}, 1),
+		factory.RegisterPriority("guest-group-affinity", &priorityguest.GroupAffinityPriority{}, 1),
+		factory.RegisterPriority("guest-topology-spread", &priorityguest.TopologySpreadPriority{}, 1),
 	)
 }
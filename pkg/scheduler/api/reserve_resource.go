@@ -14,6 +14,19 @@
 
 package api
 
+import "time"
+
+const (
+	// ReservationStatusReserved means resources of the whole gang are held by scheduler
+	ReservationStatusReserved = "reserved"
+	// ReservationStatusCommitted means all placements are persisted by region
+	ReservationStatusCommitted = "committed"
+	// ReservationStatusReleased means region gives up the gang
+	ReservationStatusReleased = "released"
+	// ReservationStatusExpired means region does not commit or release in time
+	ReservationStatusExpired = "expired"
+)
+
 type ReservedResourcesArgs struct {
 	Name   string
 	Remove string
@@ -22,3 +35,22 @@ type ReservedResourcesArgs struct {
 type ReservedResourcesResult struct {
 	Resources interface{} `json:"resources"`
 }
+
+// GangReservation holds the pending usage of an all-or-nothing schedule session
+type GangReservation struct {
+	SessionId       string    `json:"session_id"`
+	Status          string    `json:"status"`
+	GuestIds        []string  `json:"guest_ids"`
+	DirtyHosts      []string  `json:"hosts"`
+	DirtyBaremetals []string  `json:"baremetals"`
+	CreatedAt       time.Time `json:"created_at"`
+	ExpireAt        time.Time `json:"expire_at"`
+}
+
+func (r *GangReservation) ToExpireArgs() *ExpireArgs {
+	return &ExpireArgs{
+		DirtyHosts:      r.DirtyHosts,
+		DirtyBaremetals: r.DirtyBaremetals,
+		SessionId:       r.SessionId,
+	}
+}
@@ -16,6 +16,7 @@ package api
 
 import (
 	"net/http" //"yunion.io/x/jsonutils"
+	"time"
 
 	"yunion.io/x/log"
 	"yunion.io/x/pkg/errors"
@@ -207,6 +208,10 @@ func (data *SchedInfo) reviseData() {
 		data.Count = 1
 	}
 
+	if input.AllOrNothing && input.ReservationTimeout <= 0 {
+		data.ReservationTimeout = o.Options.GangReservationTimeout
+	}
+
 	ignoreFilters := make(map[string]bool, len(input.IgnoreFilters))
 	for _, filter := range input.IgnoreFilters {
 		ignoreFilters[filter] = true
@@ -220,6 +225,14 @@ func (data *SchedInfo) reviseData() {
 	data.Raw = input.JSON(input).String()
 }
 
+// GetReservationTimeout returns how long the pending usage of all-or-nothing schedule is held
+func (d *SchedInfo) GetReservationTimeout() time.Duration {
+	if !d.AllOrNothing || d.ReservationTimeout <= 0 {
+		return 0
+	}
+	return time.Duration(d.ReservationTimeout) * time.Second
+}
+
 func (d *SchedInfo) GetCandidateHostTypes() []string {
 	switch d.Hypervisor {
 	case computeapi.HYPERVISOR_POD:
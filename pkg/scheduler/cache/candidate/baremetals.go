@@ -53,6 +53,10 @@ func (h *baremetalGetter) GetFreeCpuNuma() []*scheduler.SFreeNumaCpuMem {
 	return nil
 }
 
+func (h *baremetalGetter) HostMetadata() map[string]string {
+	return nil
+}
+
 func (h baremetalGetter) IsEmpty() bool {
 	return h.bm.ServerID == ""
 }
@@ -88,6 +88,10 @@ func (h *hostGetter) TotalMemorySize(useRsvd bool) int64 {
 	return h.h.GetTotalMemSize(useRsvd)
 }
 
+func (h *hostGetter) HostMetadata() map[string]string {
+	return h.h.Metadata
+}
+
 func (h *hostGetter) IsEmpty() bool {
 	return h.h.GuestCount == 0
 }
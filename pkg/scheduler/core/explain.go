@@ -0,0 +1,249 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"sort"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/workqueue"
+
+	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
+	o "yunion.io/x/onecloud/pkg/scheduler/options"
+)
+
+// whatIfCandidate wraps a candidate with the hypothetical resource changes
+// from explain input, predicates and priorities only see it through Getter()
+type whatIfCandidate struct {
+	Candidater
+	getter *whatIfGetter
+}
+
+func (c *whatIfCandidate) Getter() CandidatePropertyGetter {
+	return c.getter
+}
+
+type whatIfGetter struct {
+	CandidatePropertyGetter
+	host *schedapi.SchedWhatIfHost
+}
+
+func (g *whatIfGetter) TotalCPUCount(useRsvd bool) int64 {
+	return g.CandidatePropertyGetter.TotalCPUCount(useRsvd) + g.host.ExtraCpuCount
+}
+
+func (g *whatIfGetter) FreeCPUCount(useRsvd bool) int64 {
+	return g.CandidatePropertyGetter.FreeCPUCount(useRsvd) + g.host.ExtraCpuCount
+}
+
+func (g *whatIfGetter) TotalMemorySize(useRsvd bool) int64 {
+	return g.CandidatePropertyGetter.TotalMemorySize(useRsvd) + g.host.ExtraMemoryMb
+}
+
+func (g *whatIfGetter) FreeMemorySize(useRsvd bool) int64 {
+	return g.CandidatePropertyGetter.FreeMemorySize(useRsvd) + g.host.ExtraMemoryMb
+}
+
+// GetFreeCpuNuma spreads the extra cpu and memory evenly over numa nodes
+func (g *whatIfGetter) GetFreeCpuNuma() []*schedapi.SFreeNumaCpuMem {
+	nodes := g.CandidatePropertyGetter.GetFreeCpuNuma()
+	if len(nodes) == 0 {
+		return nodes
+	}
+	cnt := int64(len(nodes))
+	ret := make([]*schedapi.SFreeNumaCpuMem, len(nodes))
+	for i := range nodes {
+		node := *nodes[i]
+		extraCpu := g.host.ExtraCpuCount / cnt
+		extraMem := g.host.ExtraMemoryMb / cnt
+		if int64(i) < g.host.ExtraCpuCount%cnt {
+			extraCpu += 1
+		}
+		if int64(i) < g.host.ExtraMemoryMb%cnt {
+			extraMem += 1
+		}
+		node.FreeCpuCount += int(extraCpu)
+		node.CpuCount += int(extraCpu)
+		node.MemSize += int(extraMem)
+		ret[i] = &node
+	}
+	return ret
+}
+
+func applyWhatIf(whatIf *schedapi.SchedWhatIf, candidates []Candidater) []Candidater {
+	if whatIf == nil || len(whatIf.Hosts) == 0 {
+		return candidates
+	}
+	ret := make([]Candidater, len(candidates))
+	for i, c := range candidates {
+		getter := c.Getter()
+		host := whatIf.GetHost(getter.Id(), getter.Name())
+		if host == nil {
+			ret[i] = c
+			continue
+		}
+		ret[i] = &whatIfCandidate{
+			Candidater: c,
+			getter: &whatIfGetter{
+				CandidatePropertyGetter: getter,
+				host:                    host,
+			},
+		}
+	}
+	return ret
+}
+
+func explainScores(kind string, scores map[string]int) []schedapi.SchedExplainScore {
+	names := make([]string, 0, len(scores))
+	for name := range scores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ret := make([]schedapi.SchedExplainScore, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, schedapi.SchedExplainScore{Name: name, Kind: kind, Score: scores[name]})
+	}
+	return ret
+}
+
+func explainCandidate(ctx context.Context, unit *Unit, candidate Candidater, predicates []FitPredicate) *schedapi.SchedExplainCandidate {
+	ret := &schedapi.SchedExplainCandidate{
+		Id:         candidate.IndexKey(),
+		Name:       candidate.Getter().Name(),
+		Fit:        true,
+		Predicates: make([]schedapi.SchedExplainPredicate, 0, len(predicates)),
+		RejectedBy: []string{},
+		Scores:     []schedapi.SchedExplainScore{},
+	}
+	_, ret.WhatIf = candidate.(*whatIfCandidate)
+	// always check all predicates to report every rejection reason
+	for _, predicate := range predicates {
+		fit, reasons, err := predicate.Execute(ctx, unit, candidate)
+		result := schedapi.SchedExplainPredicate{
+			Name:    predicate.Name(),
+			Fit:     fit && err == nil,
+			Reasons: make([]string, 0, len(reasons)),
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		for _, reason := range reasons {
+			result.Reasons = append(result.Reasons, reason.GetReason())
+		}
+		if !result.Fit {
+			ret.Fit = false
+			ret.RejectedBy = append(ret.RejectedBy, result.Name)
+		}
+		ret.Predicates = append(ret.Predicates, result)
+	}
+	return ret
+}
+
+// Explain runs the same predicates and priorities as Schedule against every
+// candidate, but reports the verdict of each predicate and the score of each
+// priority instead of only the selected result. The what-if overlay of the
+// sched info is applied to candidates before predicates run.
+func (g *GenericScheduler) Explain(ctx context.Context, unit *Unit, candidates []Candidater) (*schedapi.SchedExplainOutput, error) {
+	schedInfo := unit.SchedInfo
+	output := &schedapi.SchedExplainOutput{
+		SessionId:  schedInfo.SessionId,
+		ReqCount:   int64(schedInfo.Count),
+		Candidates: []schedapi.SchedExplainCandidate{},
+	}
+	if len(candidates) == 0 {
+		return output, nil
+	}
+	candidates = applyWhatIf(schedInfo.WhatIf, candidates)
+
+	if err := g.BeforePredicate(); err != nil {
+		return nil, err
+	}
+	newPredicates, err := preExecPredicate(ctx, unit, candidates, g.predicates)
+	if err != nil {
+		return nil, err
+	}
+	predicateNames := make([]string, 0, len(newPredicates))
+	for name := range newPredicates {
+		predicateNames = append(predicateNames, name)
+	}
+	sort.Strings(predicateNames)
+	predicateArray := make([]FitPredicate, 0, len(predicateNames))
+	for _, name := range predicateNames {
+		predicateArray = append(predicateArray, newPredicates[name])
+	}
+
+	results := make([]*schedapi.SchedExplainCandidate, len(candidates))
+	workerSize := o.Options.PredicateParallelizeSize
+	if workerSize == 0 {
+		workerSize = 1
+	}
+	workqueue.Parallelize(workerSize, len(candidates), func(i int) {
+		results[i] = explainCandidate(ctx, unit, candidates[i], predicateArray)
+	})
+
+	resultMap := make(map[string]*schedapi.SchedExplainCandidate)
+	fitted := make([]Candidater, 0)
+	rejected := make([]*schedapi.SchedExplainCandidate, 0)
+	for i, ret := range results {
+		resultMap[ret.Id] = ret
+		if ret.Fit {
+			fitted = append(fitted, candidates[i])
+		} else {
+			rejected = append(rejected, ret)
+		}
+	}
+
+	if len(fitted) > 0 {
+		priorityList, err := PrioritizeCandidates(unit, fitted, g.priorities)
+		if err != nil {
+			return nil, errors.Wrap(err, "PrioritizeCandidates")
+		}
+		sort.Sort(sort.Reverse(priorityList))
+		for i, item := range priorityList {
+			ret := resultMap[item.Host]
+			bucket := unit.GetScore(item.Host).ScoreBucket
+			ret.Rank = i + 1
+			ret.PreferScore = bucket.PreferScore()
+			ret.AvoidScore = bucket.AvoidScore()
+			ret.NormalScore = bucket.NormalScore()
+			ret.Scores = append(ret.Scores, explainScores("prefer", bucket.PreferScores())...)
+			ret.Scores = append(ret.Scores, explainScores("avoid", bucket.AvoidScores())...)
+			ret.Scores = append(ret.Scores, explainScores("normal", bucket.NormalScores())...)
+		}
+		selected, err := SelectHosts(unit, priorityList)
+		if err != nil {
+			return nil, errors.Wrap(err, "SelectHosts")
+		}
+		for _, sc := range selected {
+			resultMap[sc.Candidate.IndexKey()].Selected = sc.Count
+			output.AllowCount += sc.Count
+		}
+		for _, item := range priorityList {
+			output.Candidates = append(output.Candidates, *resultMap[item.Host])
+		}
+	}
+
+	sort.Slice(rejected, func(i, j int) bool {
+		return rejected[i].Name < rejected[j].Name
+	})
+	for _, ret := range rejected {
+		output.Candidates = append(output.Candidates, *ret)
+	}
+	for i := range output.Candidates {
+		output.Candidates[i].Capacity = unit.GetCapacity(output.Candidates[i].Id)
+	}
+	return output, nil
+}
@@ -34,6 +34,10 @@ func transToInstanceGroupSchedResult(result *SchedResultItemList, schedInfo *api
 	}
 	guestInfos, backGuestInfos, groups := generateGuestInfo(schedInfo)
 	hosts := buildHosts(result, groups)
+	topologies := newGroupTopologies(schedInfo.InstanceGroupsDetail, hosts)
+	for i := range guestInfos {
+		guestInfos[i].topologies = topologies
+	}
 	if len(backGuestInfos) > 0 {
 		return getBackupSchedResult(hosts, guestInfos, backGuestInfos, schedInfo.SessionId)
 	}
@@ -44,6 +48,59 @@ type sGuestInfo struct {
 	schedInfo            *api.SchedInfo
 	instanceGroupsDetail map[string]*models.SGroup
 	preferHost           string
+	topologies           sGroupTopologies
+}
+
+// sGroupTopologies tracks the topology domains of instance groups while the
+// guests of a batch are placed one by one, the predicates and priorities only
+// see the distribution before the batch
+type sGroupTopologies []*GroupTopology
+
+func newGroupTopologies(groups map[string]*models.SGroup, hosts []*sSchedResultItem) sGroupTopologies {
+	cs := make([]Candidater, len(hosts))
+	for i := range hosts {
+		cs[i] = hosts[i].Candidater
+	}
+	ret := make(sGroupTopologies, 0)
+	for _, group := range groups {
+		if group.IsHostAntiAffinity() && group.MaxSkew <= 0 {
+			continue
+		}
+		ret = append(ret, NewGroupTopology(group, cs))
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Group.Id < ret[j].Group.Id
+	})
+	return ret
+}
+
+func (ts sGroupTopologies) fits(host *sSchedResultItem, forced bool) bool {
+	for _, t := range ts {
+		if !t.Group.IsHostAntiAffinity() && !t.Fits(host.Candidater, forced) {
+			return false
+		}
+	}
+	return true
+}
+
+// score follows the priorities of soft affinity and topology spread
+func (ts sGroupTopologies) score(host *sSchedResultItem) int64 {
+	val := 0
+	for _, t := range ts {
+		if !t.Group.IsHostAntiAffinity() && !t.Group.ForceDispersion.IsTrue() {
+			val += t.AffinityScore(host.Candidater)
+		}
+		if t.Group.MaxSkew > 0 && !t.IsAffinity() {
+			val += t.SpreadScore(host.Candidater)
+		}
+	}
+	return int64(val)
+}
+
+func (ts sGroupTopologies) add(host *sSchedResultItem, delta int) {
+	for _, t := range ts {
+		t.Add(host.Candidater, delta)
+	}
 }
 
 type sSchedResultItem struct {
@@ -95,7 +152,7 @@ func buildHosts(result *SchedResultItemList, groups map[string]*models.SGroup) [
 // sortHost sorts the host for guest that is the backup one of the high-availability guest
 // if isBackup is true and the master one if isBackup is false.
 func sortHosts(hosts []*sSchedResultItem, guestInfo *sGuestInfo, isBackup *bool) {
-	sortIndexi, sortIndexj := make([]int64, 5), make([]int64, 5)
+	sortIndexi, sortIndexj := make([]int64, 6), make([]int64, 6)
 	sort.Slice(hosts, func(i, j int) bool {
 		switch {
 		case isBackup == nil:
@@ -107,9 +164,10 @@ func sortHosts(hosts []*sSchedResultItem, guestInfo *sGuestInfo, isBackup *bool)
 		}
 		sortIndexi[1], sortIndexj[1] = hosts[i].Count, hosts[j].Count
 		sortIndexi[2], sortIndexj[2] = -(hosts[i].minInstanceGroupCapacity(guestInfo.instanceGroupsDetail)), -(hosts[j].minInstanceGroupCapacity(guestInfo.instanceGroupsDetail))
-		sortIndexi[3], sortIndexj[3] = scoreNormalization(hosts[i].Score, hosts[j].Score)
-		sortIndexi[4], sortIndexj[4] = -(hosts[i].Capacity), -(hosts[j].Capacity)
-		for i := 0; i < 5; i++ {
+		sortIndexi[3], sortIndexj[3] = -(guestInfo.topologies.score(hosts[i])), -(guestInfo.topologies.score(hosts[j]))
+		sortIndexi[4], sortIndexj[4] = scoreNormalization(hosts[i].Score, hosts[j].Score)
+		sortIndexi[5], sortIndexj[5] = -(hosts[i].Capacity), -(hosts[j].Capacity)
+		for i := 0; i < 6; i++ {
 			if sortIndexi[i] == sortIndexj[i] {
 				continue
 			}
@@ -166,7 +224,14 @@ func generateGuestInfo(schedInfo *api.SchedInfo) ([]sGuestInfo, []sGuestInfo, ma
 	if len(name) == 0 {
 		name = "default"
 	}
+	hostGroups := make(map[string]*models.SGroup)
 	for id, group := range schedInfo.InstanceGroupsDetail {
+		// affinity and other topology rules are handled by predicates and priorities,
+		// and by topologies of guest infos within a batch
+		if !group.IsHostAntiAffinity() {
+			continue
+		}
+		hostGroups[id] = group
 		groups[id] = group
 	}
 	for i := 0; i < schedInfo.Count; i++ {
@@ -175,7 +240,7 @@ func generateGuestInfo(schedInfo *api.SchedInfo) ([]sGuestInfo, []sGuestInfo, ma
 			instanceGroupsDetail: make(map[string]*models.SGroup),
 			preferHost:           schedInfo.PreferHost,
 		}
-		for id, group := range schedInfo.InstanceGroupsDetail {
+		for id, group := range hostGroups {
 			info.instanceGroupsDetail[id] = group
 		}
 		infos = append(infos, info)
@@ -224,6 +289,7 @@ func getSchedResult(hosts []*sSchedResultItem, guestInfos []sGuestInfo, sid stri
 			if host == nil {
 				er := &schedapi.CandidateResource{Error: fmt.Sprintf("no suitable Host for No.%d Guest", i+1)}
 				apiResults = append(apiResults, er)
+				i++
 				break
 			}
 		}
@@ -293,6 +359,7 @@ func markHostUsed(host *sSchedResultItem, guestInfo sGuestInfo, isBackup *bool)
 	for gid := range guestInfo.instanceGroupsDetail {
 		host.instanceGroupCapacity[gid] = host.instanceGroupCapacity[gid] - 1
 	}
+	guestInfo.topologies.add(host, 1)
 	host.Capacity--
 	host.Count++
 	if isBackup == nil {
@@ -310,6 +377,7 @@ func unMarkHostUsed(host *sSchedResultItem, guestInfo sGuestInfo, isBackup *bool
 	for gid := range guestInfo.instanceGroupsDetail {
 		host.instanceGroupCapacity[gid] = host.instanceGroupCapacity[gid] + 1
 	}
+	guestInfo.topologies.add(host, -1)
 	host.Capacity++
 	host.Count--
 	if isBackup == nil {
@@ -350,6 +418,9 @@ Loop:
 				continue Loop
 			}
 		}
+		if !guestInfo.topologies.fits(host, forced) {
+			continue
+		}
 		idx = i
 		choosed = true
 		break
@@ -0,0 +1,134 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	"yunion.io/x/pkg/tristate"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+	schedmodels "yunion.io/x/onecloud/pkg/scheduler/models"
+)
+
+type sTestGetter struct {
+	CandidatePropertyGetter
+
+	id       string
+	metadata map[string]string
+}
+
+func (g *sTestGetter) Id() string {
+	return g.id
+}
+
+func (g *sTestGetter) HostMetadata() map[string]string {
+	return g.metadata
+}
+
+func (g *sTestGetter) InstanceGroups() map[string]*api.CandidateGroup {
+	return nil
+}
+
+func (g *sTestGetter) GetPendingUsage() *schedmodels.SPendingUsage {
+	return nil
+}
+
+type sTestCandidate struct {
+	Candidater
+
+	getter *sTestGetter
+}
+
+func (c *sTestCandidate) Getter() CandidatePropertyGetter {
+	return c.getter
+}
+
+func (c *sTestCandidate) AllocCpuNumaPin(vcpuCount, memSizeKB int, preferNumaNodes []int) []schedapi.SCpuNumaPin {
+	return nil
+}
+
+func TestInstanceGroupTopologyBatch(t *testing.T) {
+	racks := map[string]string{
+		"host1": "rack1",
+		"host2": "rack1",
+		"host3": "rack2",
+		"host4": "rack2",
+	}
+	newGroup := func(id string, affinity string, force bool) *models.SGroup {
+		group := &models.SGroup{
+			Granularity:     1,
+			ForceDispersion: tristate.NewFromBool(force),
+			Affinity:        affinity,
+			TopologyKey:     "rack",
+		}
+		group.Id = id
+		return group
+	}
+	schedule := func(group *models.SGroup, count int) map[string]int {
+		schedInfo := &api.SchedInfo{
+			ScheduleInput: &schedapi.ScheduleInput{
+				ServerConfig: schedapi.ServerConfig{
+					ServerConfigs: &computeapi.ServerConfigs{Count: count},
+				},
+			},
+			InstanceGroupsDetail: map[string]*models.SGroup{group.Id: group},
+		}
+		result := &SchedResultItemList{}
+		for _, id := range []string{"host1", "host2", "host3", "host4"} {
+			result.Data = append(result.Data, &SchedResultItem{
+				ID:       id,
+				Capacity: 10,
+				Score:    newZeroScore(),
+				Candidater: &sTestCandidate{
+					getter: &sTestGetter{id: id, metadata: map[string]string{"rack": racks[id]}},
+				},
+				AllocatedResource: NewAllocatedResource(),
+				SchedData:         schedInfo,
+			})
+		}
+		out := transToInstanceGroupSchedResult(result, schedInfo)
+		ret := make(map[string]int)
+		for _, c := range out.Candidates {
+			if len(c.Error) > 0 {
+				ret[""]++
+			} else {
+				ret[racks[c.HostId]]++
+			}
+		}
+		return ret
+	}
+
+	// every rack takes one guest of the batch, the third one can't be placed
+	ret := schedule(newGroup("anti", computeapi.INSTANCE_GROUP_ANTI_AFFINITY, true), 3)
+	if ret["rack1"] != 1 || ret["rack2"] != 1 || ret[""] != 1 {
+		t.Errorf("forced anti-affinity over racks: %v", ret)
+	}
+
+	// soft anti-affinity spreads the batch but doesn't fail
+	ret = schedule(newGroup("soft-anti", computeapi.INSTANCE_GROUP_ANTI_AFFINITY, false), 4)
+	if ret["rack1"] != 2 || ret["rack2"] != 2 {
+		t.Errorf("soft anti-affinity over racks: %v", ret)
+	}
+
+	// the first guest of the batch decides the rack of the others
+	ret = schedule(newGroup("affinity", computeapi.INSTANCE_GROUP_AFFINITY, true), 3)
+	if len(ret) != 1 || (ret["rack1"] != 3 && ret["rack2"] != 3) {
+		t.Errorf("forced affinity over racks: %v", ret)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sort"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/compute/models"
+)
+
+// GroupTopologyValue return the topology domain of the candidate for the topology key,
+// empty string means the candidate doesn't belong to any domain of the key.
+// Keys other than host, zone and wire are treated as host metadata keys, e.g. rack.
+func GroupTopologyValue(c Candidater, topologyKey string) string {
+	getter := c.Getter()
+	switch topologyKey {
+	case "", computeapi.INSTANCE_GROUP_TOPOLOGY_HOST:
+		return getter.Id()
+	case computeapi.INSTANCE_GROUP_TOPOLOGY_ZONE:
+		if zone := getter.Zone(); zone != nil {
+			return zone.GetId()
+		}
+		return ""
+	case computeapi.INSTANCE_GROUP_TOPOLOGY_WIRE:
+		wireIds := make([]string, 0)
+		for _, net := range getter.Networks() {
+			if len(net.WireId) > 0 {
+				wireIds = append(wireIds, net.WireId)
+			}
+		}
+		if len(wireIds) == 0 {
+			return ""
+		}
+		sort.Strings(wireIds)
+		return wireIds[0]
+	default:
+		return getter.HostMetadata()[topologyKey]
+	}
+}
+
+// GroupMemberCount return the count of guests of the instance group on candidate,
+// including the pending ones which are scheduled but not created yet.
+func GroupMemberCount(c Candidater, groupId string) int {
+	getter := c.Getter()
+	count := 0
+	if cg, ok := getter.InstanceGroups()[groupId]; ok {
+		count += cg.ReferCount
+	}
+	if pending := getter.GetPendingUsage(); pending != nil {
+		if cg, ok := pending.InstanceGroupUsage[groupId]; ok {
+			count += cg.ReferCount
+		}
+	}
+	return count
+}
+
+// GroupTopology is the distribution of guests of an instance group over
+// the topology domains of candidates
+type GroupTopology struct {
+	Group *models.SGroup
+	// domain => guest count of the group, every domain of candidates is included
+	Counts map[string]int
+}
+
+func NewGroupTopology(group *models.SGroup, cs []Candidater) *GroupTopology {
+	t := &GroupTopology{
+		Group:  group,
+		Counts: make(map[string]int),
+	}
+	for _, c := range cs {
+		domain := t.Domain(c)
+		if len(domain) == 0 {
+			continue
+		}
+		t.Counts[domain] += GroupMemberCount(c, group.Id)
+	}
+	return t
+}
+
+func (t *GroupTopology) Domain(c Candidater) string {
+	return GroupTopologyValue(c, t.Group.TopologyKey)
+}
+
+// Count return the domain of candidate and guest count of the group in it
+func (t *GroupTopology) Count(c Candidater) (string, int) {
+	domain := t.Domain(c)
+	return domain, t.Counts[domain]
+}
+
+// MemberCount return total guest count of the group on candidates
+func (t *GroupTopology) MemberCount() int {
+	total := 0
+	for _, cnt := range t.Counts {
+		total += cnt
+	}
+	return total
+}
+
+// MinMax return the minimum and maximum guest count of all domains
+func (t *GroupTopology) MinMax() (int, int) {
+	min, max := -1, 0
+	for _, cnt := range t.Counts {
+		if min < 0 || cnt < min {
+			min = cnt
+		}
+		if cnt > max {
+			max = cnt
+		}
+	}
+	if min < 0 {
+		min = 0
+	}
+	return min, max
+}
+
+func (t *GroupTopology) IsAffinity() bool {
+	return t.Group.Affinity == computeapi.INSTANCE_GROUP_AFFINITY
+}
+
+func (t *GroupTopology) Weight() int {
+	if t.Group.Weight <= 0 {
+		return computeapi.INSTANCE_GROUP_WEIGHT_DEFAULT
+	}
+	return t.Group.Weight
+}
+
+// Add records delta guests of the group placed on the candidate
+func (t *GroupTopology) Add(c Candidater, delta int) {
+	if domain := t.Domain(c); len(domain) > 0 {
+		t.Counts[domain] += delta
+	}
+}
+
+// Fits checks the affinity or anti-affinity rule of the group for placing
+// a guest on the candidate, the rule of a group not forcing dispersion is
+// only checked when forced is true
+func (t *GroupTopology) Fits(c Candidater, forced bool) bool {
+	if !forced && !t.Group.ForceDispersion.IsTrue() {
+		return true
+	}
+	domain, count := t.Count(c)
+	if len(domain) == 0 {
+		return false
+	}
+	if t.IsAffinity() {
+		return count > 0 || t.MemberCount() == 0
+	}
+	granularity := t.Group.Granularity
+	if granularity < 1 {
+		granularity = 1
+	}
+	return count < granularity
+}
+
+// AffinityScore prefers the candidate in the domain with group members for
+// affinity and avoids it for anti-affinity
+func (t *GroupTopology) AffinityScore(c Candidater) int {
+	domain, count := t.Count(c)
+	if len(domain) == 0 {
+		return 0
+	}
+	if t.IsAffinity() {
+		if count > 0 {
+			return t.Weight()
+		}
+		return 0
+	}
+	return -t.Weight() * count
+}
+
+// SpreadScore scores the candidate by the skew of its domain after placing a guest
+func (t *GroupTopology) SpreadScore(c Candidater) int {
+	domain, count := t.Count(c)
+	if len(domain) == 0 {
+		return 0
+	}
+	min, max := t.MinMax()
+	skew := count + 1 - min
+	if skew > t.Group.MaxSkew {
+		return -t.Weight() * (skew - t.Group.MaxSkew)
+	}
+	return t.Weight() * (max - count)
+}
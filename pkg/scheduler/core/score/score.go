@@ -116,6 +116,29 @@ func (b *ScoreBucket) NormalScore() int {
 	return b.normalScore.Total()
 }
 
+func (ss scores) copy() map[string]int {
+	ret := make(map[string]int, len(ss))
+	for name, s := range ss {
+		ret[name] = s
+	}
+	return ret
+}
+
+// PreferScores return a copy of prefer scores keyed by score name
+func (b *ScoreBucket) PreferScores() map[string]int {
+	return b.preferScore.copy()
+}
+
+// AvoidScores return a copy of avoid scores keyed by score name
+func (b *ScoreBucket) AvoidScores() map[string]int {
+	return b.avoidScore.copy()
+}
+
+// NormalScores return a copy of normal scores keyed by score name
+func (b *ScoreBucket) NormalScores() map[string]int {
+	return b.normalScore.copy()
+}
+
 func (b *ScoreBucket) debugString(kind string, vals map[string]int) string {
 	return fmt.Sprintf("%s: %v", kind, vals)
 }
@@ -0,0 +1,191 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utilization
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/wait"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/mcclient/modules/monitor"
+)
+
+// HostUtilization is the recent resource utilization of a host reported by
+// hostmetrics through telegraf and stored in the monitor tsdb
+type HostUtilization struct {
+	HostId string
+	// peak of cpu usage_active percent in the metrics window
+	CpuUsage float64
+	// peak of memory used_percent in the metrics window
+	MemUsage float64
+
+	UpdatedAt time.Time
+}
+
+type SManager struct {
+	lock  sync.RWMutex
+	hosts map[string]*HostUtilization
+
+	window          time.Duration
+	refreshInterval time.Duration
+}
+
+var manager = NewManager()
+
+func NewManager() *SManager {
+	return &SManager{
+		hosts: make(map[string]*HostUtilization),
+	}
+}
+
+// Start refreshes the host utilization from monitor periodically
+func Start(ctx context.Context, refreshInterval, window time.Duration) {
+	manager.refreshInterval = refreshInterval
+	manager.window = window
+	wait.Forever(func() {
+		manager.syncOnce(ctx)
+	}, refreshInterval)
+}
+
+// Get returns the recent utilization of the host, nil is returned if
+// the metrics of host is missing or stale
+func Get(hostId string) *HostUtilization {
+	return manager.Get(hostId)
+}
+
+// Update replaces the cached utilization of hosts
+func Update(items []*HostUtilization) {
+	manager.Update(items)
+}
+
+func (m *SManager) Get(hostId string) *HostUtilization {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	u, ok := m.hosts[hostId]
+	if !ok {
+		return nil
+	}
+	if m.refreshInterval > 0 && time.Since(u.UpdatedAt) > 3*m.refreshInterval {
+		return nil
+	}
+	return u
+}
+
+func (m *SManager) Update(items []*HostUtilization) {
+	hosts := make(map[string]*HostUtilization, len(items))
+	for _, item := range items {
+		hosts[item.HostId] = item
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.hosts = hosts
+}
+
+func (m *SManager) syncOnce(ctx context.Context) {
+	s := auth.GetAdminSession(ctx, consts.GetRegion())
+	cpus, err := m.queryPeak(s, "cpu", "usage_active", map[string]string{"cpu": "cpu-total"})
+	if err != nil {
+		log.Errorf("query host cpu utilization: %v", err)
+		return
+	}
+	mems, err := m.queryPeak(s, "mem", "used_percent", nil)
+	if err != nil {
+		log.Errorf("query host memory utilization: %v", err)
+		return
+	}
+	now := time.Now()
+	items := make([]*HostUtilization, 0, len(cpus))
+	for hostId, cpu := range cpus {
+		mem, ok := mems[hostId]
+		if !ok {
+			continue
+		}
+		items = append(items, &HostUtilization{
+			HostId:    hostId,
+			CpuUsage:  cpu,
+			MemUsage:  mem,
+			UpdatedAt: now,
+		})
+	}
+	m.Update(items)
+	log.Debugf("sync utilization of %d hosts", len(items))
+}
+
+// queryPeak returns the max of per-minute mean value of the field in window by host_id
+func (m *SManager) queryPeak(s *mcclient.ClientSession, measurement, field string, tags map[string]string) (map[string]float64, error) {
+	now := time.Now()
+	input := monitor.NewMetricQueryInput(measurement).
+		From(now.Add(-m.window)).
+		To(now).
+		Interval("1m").
+		Scope("system").
+		SkipCheckSeries(true)
+	input.Selects().Select(field).MEAN()
+	where := input.Where()
+	for k, v := range tags {
+		where.Equal(k, v)
+	}
+	input.GroupBy().TAG("host_id")
+	ret, err := monitor.UnifiedMonitorManager.PerformQuery(s, input.ToQueryData())
+	if err != nil {
+		return nil, errors.Wrapf(err, "query %s.%s", measurement, field)
+	}
+	return parsePeak(ret)
+}
+
+func parsePeak(ret jsonutils.JSONObject) (map[string]float64, error) {
+	series, err := ret.GetArray("series")
+	if err != nil {
+		if errors.Cause(err) == jsonutils.ErrJsonDictKeyNotFound {
+			return map[string]float64{}, nil
+		}
+		return nil, errors.Wrap(err, "get series")
+	}
+	peaks := make(map[string]float64)
+	for _, s := range series {
+		hostId, _ := s.GetString("tags", "host_id")
+		if len(hostId) == 0 {
+			continue
+		}
+		points, _ := s.GetArray("points")
+		for _, point := range points {
+			arr, ok := point.(*jsonutils.JSONArray)
+			if !ok {
+				continue
+			}
+			val, err := arr.GetAt(0)
+			if err != nil {
+				continue
+			}
+			v, err := val.Float()
+			if err != nil {
+				continue
+			}
+			if peak, ok := peaks[hostId]; !ok || v > peak {
+				peaks[hostId] = v
+			}
+		}
+	}
+	return peaks, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utilization
+
+import (
+	"testing"
+	"time"
+
+	"yunion.io/x/jsonutils"
+)
+
+func TestParsePeak(t *testing.T) {
+	ret, err := jsonutils.ParseString(`{"series":[
+		{"tags":{"host_id":"host1"},"points":[[10.5,1],[null,2],[30.2,3],[20,4]]},
+		{"tags":{"host_id":"host2"},"points":[[5,1]]},
+		{"tags":{},"points":[[99,1]]}
+	]}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	peaks, err := parsePeak(ret)
+	if err != nil {
+		t.Fatalf("parsePeak: %v", err)
+	}
+	want := map[string]float64{"host1": 30.2, "host2": 5}
+	if len(peaks) != len(want) {
+		t.Fatalf("want %v, got %v", want, peaks)
+	}
+	for id, v := range want {
+		if peaks[id] != v {
+			t.Errorf("host %s want %v, got %v", id, v, peaks[id])
+		}
+	}
+
+	peaks, err = parsePeak(jsonutils.NewDict())
+	if err != nil || len(peaks) != 0 {
+		t.Errorf("empty result: %v, %v", peaks, err)
+	}
+}
+
+func TestManagerGet(t *testing.T) {
+	m := NewManager()
+	m.refreshInterval = time.Minute
+	m.Update([]*HostUtilization{
+		{HostId: "fresh", CpuUsage: 10, UpdatedAt: time.Now()},
+		{HostId: "stale", CpuUsage: 10, UpdatedAt: time.Now().Add(-time.Hour)},
+	})
+	if m.Get("fresh") == nil {
+		t.Errorf("fresh host should be returned")
+	}
+	if m.Get("stale") != nil {
+		t.Errorf("stale host should not be returned")
+	}
+	if m.Get("missing") != nil {
+		t.Errorf("missing host should not be returned")
+	}
+}
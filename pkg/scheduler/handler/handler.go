@@ -15,7 +15,9 @@
 package handler
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -26,6 +28,7 @@ import (
 	"yunion.io/x/log"
 
 	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
 	computemodels "yunion.io/x/onecloud/pkg/compute/models"
 	"yunion.io/x/onecloud/pkg/scheduler/api"
@@ -67,6 +70,12 @@ func schedulerActionHandler(c *gin.Context) {
 		doSchedulerTest(c)
 	case "forecast":
 		doSchedulerForecast(c)
+	case "explain":
+		doSchedulerExplain(c)
+	case "rebalance-plan":
+		doRebalancePlan(c)
+	case "rebalance-execute":
+		doRebalanceExecute(c)
 	case "candidate-list":
 		doCandidateList(c)
 	case "cleanup":
@@ -77,8 +86,8 @@ func schedulerActionHandler(c *gin.Context) {
 		doCleanAllHostCache(c)
 	case "sync-sku":
 		doSyncSku(c)
-	//case "reserved-resources":
-	//doReservedResources(c)
+	case "reserved-resources":
+		doReservedResources(c)
 	default:
 		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("action: %s not support", act))
 	}
@@ -94,20 +103,40 @@ func schedulerActionIdentHandler(c *gin.Context) {
 		doCandidateDetail(c, id)
 	case "history-detail":
 		doHistoryDetail(c, id)
+	case "rebalance-detail":
+		doRebalanceDetail(c, id)
 	case "completed":
 		doCompleted(c, id)
+	case "reservation-commit":
+		doReservation(c, id, true)
+	case "reservation-release":
+		doReservation(c, id, false)
 	default:
 		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("action: %s not support", act))
 	}
 }
 
+// fetchScheduleInfo fetches sched info for requests that really schedule,
+// what-if overlays are only meaningful to explain and must never leak into
+// placement decisions
+func fetchScheduleInfo(c *gin.Context) (*api.SchedInfo, error) {
+	schedInfo, err := api.FetchSchedInfo(c.Request)
+	if err != nil {
+		return nil, err
+	}
+	if schedInfo.WhatIf != nil {
+		return nil, fmt.Errorf("what_if is only supported by explain")
+	}
+	return schedInfo, nil
+}
+
 func doSchedulerTest(c *gin.Context) {
 	if !schedman.IsReady() {
 		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("Global scheduler not init"))
 		return
 	}
 
-	schedInfo, err := api.FetchSchedInfo(c.Request)
+	schedInfo, err := fetchScheduleInfo(c)
 	if err != nil {
 		c.AbortWithError(http.StatusBadRequest, err)
 		return
@@ -128,7 +157,7 @@ func doSchedulerForecast(c *gin.Context) {
 		return
 	}
 
-	schedInfo, err := api.FetchSchedInfo(c.Request)
+	schedInfo, err := fetchScheduleInfo(c)
 	if err != nil {
 		c.AbortWithError(http.StatusBadRequest, err)
 		return
@@ -145,6 +174,145 @@ func doSchedulerForecast(c *gin.Context) {
 	c.JSON(http.StatusOK, result.ForecastResult)
 }
 
+func doSchedulerExplain(c *gin.Context) {
+	if !schedman.IsReady() {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("Global scheduler not init"))
+		return
+	}
+
+	schedInfo, err := api.FetchSchedInfo(c.Request)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	if whatIf := schedInfo.WhatIf; whatIf != nil {
+		// match removed schedtags by both id and name
+		tags := make([]string, 0, len(whatIf.RemoveSchedtags))
+		for _, tag := range whatIf.RemoveSchedtags {
+			obj, err := computemodels.SchedtagManager.FetchByIdOrName(c.Request.Context(), schedInfo.UserCred, tag)
+			if err != nil {
+				c.AbortWithError(http.StatusBadRequest, fmt.Errorf("fetch schedtag %q: %v", tag, err))
+				return
+			}
+			tags = append(tags, obj.GetId(), obj.GetName())
+		}
+		whatIf.RemoveSchedtags = tags
+	}
+
+	result, err := schedman.Explain(schedInfo)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func checkSystemAdmin(c *gin.Context) bool {
+	userCred, err := api.FetchUserCred(c.Request)
+	if err != nil {
+		c.AbortWithError(http.StatusUnauthorized, err)
+		return false
+	}
+	if !userCred.HasSystemAdminPrivilege() {
+		c.AbortWithError(http.StatusForbidden, fmt.Errorf("system admin privilege required"))
+		return false
+	}
+	return true
+}
+
+func checkRebalance(c *gin.Context) bool {
+	if !schedman.IsReady() {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("Global scheduler not init"))
+		return false
+	}
+	return checkSystemAdmin(c)
+}
+
+func doRebalancePlan(c *gin.Context) {
+	if !checkRebalance(c) {
+		return
+	}
+	input := schedapi.RebalancePlanInput{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&input); err != nil && err != io.EOF {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	plan, err := schedman.RebalancePlan(input)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+func doRebalanceExecute(c *gin.Context) {
+	if !checkRebalance(c) {
+		return
+	}
+	input := schedapi.RebalanceExecuteInput{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&input); err != nil && err != io.EOF {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	plan, err := schedman.RebalanceExecute(input)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+func doRebalanceDetail(c *gin.Context, id string) {
+	if !checkSystemAdmin(c) {
+		return
+	}
+	plan, err := schedman.GetRebalancePlan(id)
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, err)
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+func doReservedResources(c *gin.Context) {
+	if !schedman.IsReady() {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("Global scheduler not init"))
+		return
+	}
+	args := new(api.ReservedResourcesArgs)
+	if err := json.NewDecoder(c.Request.Body).Decode(args); err != nil && err != io.EOF {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	result, err := schedman.GetReservedResources(args)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func doReservation(c *gin.Context, sessionId string, commit bool) {
+	if !schedman.IsReady() {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("Global scheduler not init"))
+		return
+	}
+	var (
+		reservation *api.GangReservation
+		err         error
+	)
+	if commit {
+		reservation, err = schedman.CommitReservation(sessionId)
+	} else {
+		reservation, err = schedman.ReleaseReservation(sessionId)
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, err)
+		return
+	}
+	c.JSON(http.StatusOK, reservation)
+}
+
 func doCandidateList(c *gin.Context) {
 	args, err := api.NewCandidateListArgs(c.Request.Body)
 	if err != nil {
@@ -269,7 +437,7 @@ func doSyncSchedule(c *gin.Context) {
 		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("Global scheduler not init"))
 		return
 	}
-	schedInfo, err := api.FetchSchedInfo(c.Request)
+	schedInfo, err := fetchScheduleInfo(c)
 	if err != nil {
 		c.AbortWithError(http.StatusBadRequest, err)
 		return
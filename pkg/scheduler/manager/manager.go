@@ -15,6 +15,7 @@
 package manager
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -22,7 +23,11 @@ import (
 	"k8s.io/client-go/kubernetes"
 
 	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
 
+	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
+	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/scheduler/api"
 	"yunion.io/x/onecloud/pkg/scheduler/cache/candidate"
 	candidatecache "yunion.io/x/onecloud/pkg/scheduler/cache/candidate"
@@ -31,6 +36,7 @@ import (
 	"yunion.io/x/onecloud/pkg/scheduler/data_manager/common"
 	schedmodels "yunion.io/x/onecloud/pkg/scheduler/models"
 	o "yunion.io/x/onecloud/pkg/scheduler/options"
+	"yunion.io/x/onecloud/pkg/scheduler/rebalance"
 	"yunion.io/x/onecloud/pkg/util/k8s"
 )
 
@@ -44,6 +50,8 @@ type SchedulerManager struct {
 	HistoryManager   *HistoryManager
 	TaskManager      *TaskManager
 
+	ReservationManager *GangReservationManager
+
 	DataManager        *data_manager.DataManager
 	CandidateManager   *data_manager.CandidateManager
 	KubeClusterManager *k8s.SKubeClusterManager
@@ -57,6 +65,10 @@ func newSchedulerManager(stopCh <-chan struct{}) *SchedulerManager {
 	sm.CompletedManager = NewCompletedManager(stopCh)
 	sm.HistoryManager = NewHistoryManager(stopCh)
 	sm.TaskManager = NewTaskManager(stopCh)
+	sm.ReservationManager = NewGangReservationManager(func(args *api.ExpireArgs) {
+		sm.ExpireManager.Add(args)
+		sm.ExpireManager.Trigger()
+	})
 	sm.KubeClusterManager = k8s.NewKubeClusterManager(o.Options.Region, 30*time.Second)
 
 	common.RegisterCacheManager(sm.CandidateManager)
@@ -129,9 +141,77 @@ func Schedule(info *api.SchedInfo) (*core.ScheduleResult, error) {
 	if len(info.SessionId) == 0 {
 		info.SessionId = NewSessionID()
 	}
+	// what-if overlays only apply to explain
+	info.WhatIf = nil
 	return schedManager.schedule(info)
 }
 
+func (sm *SchedulerManager) explain(info *api.SchedInfo) (*schedapi.SchedExplainOutput, error) {
+	var (
+		scheduler Scheduler
+		err       error
+	)
+	if info.Hypervisor == api.SchedTypeBaremetal {
+		scheduler, err = newBaremetalScheduler(sm, info)
+	} else {
+		scheduler, err = newGuestScheduler(sm, info)
+	}
+	if err != nil {
+		return nil, err
+	}
+	genericScheduler, err := core.NewGenericScheduler(scheduler.(core.Scheduler))
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := scheduler.Candidates()
+	if err != nil {
+		return nil, err
+	}
+	return genericScheduler.Explain(context.Background(), scheduler.Unit(), candidates)
+}
+
+// Explain reports how every candidate is filtered and scored for the request,
+// it is executed out of the task queue because nothing is selected or reserved.
+func Explain(info *api.SchedInfo) (*schedapi.SchedExplainOutput, error) {
+	if len(info.SessionId) == 0 {
+		info.SessionId = NewSessionID()
+	}
+	info.IsSuggestion = true
+	return schedManager.explain(info)
+}
+
+// RebalancePlan computes a dry-run migration plan from the candidate cache,
+// the plan is kept for executing it later by id
+func RebalancePlan(input schedapi.RebalancePlanInput) (*schedapi.RebalancePlan, error) {
+	if input.Strategy != "" && !utils.IsInStringArray(input.Strategy, []string{schedapi.RebalanceStrategyBalance, schedapi.RebalanceStrategyPack}) {
+		return nil, httperrors.NewInputParameterError("unsupported rebalance strategy %q", input.Strategy)
+	}
+	candidates, err := GetCandidateHostsDesc()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetCandidateHostsDesc")
+	}
+	hosts, groups, err := rebalance.BuildHosts(input, candidates)
+	if err != nil {
+		return nil, errors.Wrap(err, "BuildHosts")
+	}
+	executor := rebalance.GetExecutor()
+	id := executor.Save(rebalance.NewPlanner(input, hosts, groups).Plan())
+	return executor.GetPlan(id)
+}
+
+// RebalanceExecute runs the migrations of a computed plan in background, the
+// plan is executed exactly as it was reviewed
+func RebalanceExecute(input schedapi.RebalanceExecuteInput) (*schedapi.RebalancePlan, error) {
+	if len(input.PlanId) == 0 {
+		return nil, httperrors.NewMissingParameterError("plan_id")
+	}
+	return rebalance.GetExecutor().Execute(context.Background(), input.PlanId, input.Concurrency)
+}
+
+func GetRebalancePlan(id string) (*schedapi.RebalancePlan, error) {
+	return rebalance.GetExecutor().GetPlan(id)
+}
+
 func IsReady() bool {
 	return schedManager != nil
 }
@@ -148,6 +228,27 @@ func Expire(expireArgs *api.ExpireArgs, trigger bool) (*api.ExpireResult, error)
 	return &api.ExpireResult{}, nil
 }
 
+// CommitReservation drops the all-or-nothing reservation after region persisted every placement
+func CommitReservation(sessionId string) (*api.GangReservation, error) {
+	return schedManager.ReservationManager.Commit(sessionId)
+}
+
+// ReleaseReservation releases the pending usage of the whole all-or-nothing session
+func ReleaseReservation(sessionId string) (*api.GangReservation, error) {
+	return schedManager.ReservationManager.Release(sessionId)
+}
+
+func GetReservedResources(args *api.ReservedResourcesArgs) (*api.ReservedResourcesResult, error) {
+	if len(args.Remove) > 0 {
+		if _, err := ReleaseReservation(args.Remove); err != nil {
+			return nil, err
+		}
+	}
+	return &api.ReservedResourcesResult{
+		Resources: schedManager.ReservationManager.List(),
+	}, nil
+}
+
 func CompletedNotify(completedNotifyArgs *api.CompletedNotifyArgs) (*api.CompletedNotifyResult, error) {
 	schedManager.CompletedManager.Add(completedNotifyArgs)
 	return &api.CompletedNotifyResult{}, nil
@@ -0,0 +1,148 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/util/sets"
+
+	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+)
+
+type gangReservation struct {
+	*api.GangReservation
+	timer *time.Timer
+}
+
+// GangReservationManager keeps pending usages of all-or-nothing schedule sessions,
+// a session is released as a whole when region commits, releases or it is timeout.
+type GangReservationManager struct {
+	lock         *sync.Mutex
+	reservations map[string]*gangReservation
+	// release flushes the pending usage of reserved hosts through expire queue
+	release func(args *api.ExpireArgs)
+}
+
+func NewGangReservationManager(release func(args *api.ExpireArgs)) *GangReservationManager {
+	return &GangReservationManager{
+		lock:         new(sync.Mutex),
+		reservations: make(map[string]*gangReservation),
+		release:      release,
+	}
+}
+
+func (m *GangReservationManager) Reserve(info *api.SchedInfo, output *schedapi.ScheduleOutput) *api.GangReservation {
+	hosts := sets.NewString()
+	for _, c := range output.Candidates {
+		for ; c != nil; c = c.BackupCandidate {
+			if c.Error == "" && c.HostId != "" {
+				hosts.Insert(c.HostId)
+			}
+		}
+	}
+	now := time.Now()
+	timeout := info.GetReservationTimeout()
+	r := &api.GangReservation{
+		SessionId: info.SessionId,
+		Status:    api.ReservationStatusReserved,
+		GuestIds:  info.GuestIds,
+		CreatedAt: now,
+		ExpireAt:  now.Add(timeout),
+	}
+	if info.Hypervisor == api.SchedTypeBaremetal {
+		r.DirtyBaremetals = hosts.List()
+	} else {
+		r.DirtyHosts = hosts.List()
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if old, ok := m.reservations[r.SessionId]; ok {
+		// same session scheduled again, the new reservation takes over
+		old.timer.Stop()
+	}
+	item := &gangReservation{GangReservation: r}
+	item.timer = time.AfterFunc(timeout, func() {
+		m.expire(item)
+	})
+	m.reservations[r.SessionId] = item
+	log.Infof("all-or-nothing reservation of session %s on hosts %v, expire at %s", r.SessionId, hosts.List(), r.ExpireAt)
+	return r
+}
+
+// Commit is called after region persisted all placements of the session
+func (m *GangReservationManager) Commit(sessionId string) (*api.GangReservation, error) {
+	return m.finish(sessionId, api.ReservationStatusCommitted)
+}
+
+// Release is called when region gives up the whole session
+func (m *GangReservationManager) Release(sessionId string) (*api.GangReservation, error) {
+	return m.finish(sessionId, api.ReservationStatusReleased)
+}
+
+func (m *GangReservationManager) expire(item *gangReservation) {
+	m.lock.Lock()
+	if m.reservations[item.SessionId] != item {
+		// already finished or taken over
+		m.lock.Unlock()
+		return
+	}
+	delete(m.reservations, item.SessionId)
+	m.lock.Unlock()
+
+	item.Status = api.ReservationStatusExpired
+	log.Warningf("all-or-nothing reservation of session %s is not committed before %s, release it", item.SessionId, item.ExpireAt)
+	m.release(item.ToExpireArgs())
+}
+
+func (m *GangReservationManager) finish(sessionId string, status string) (*api.GangReservation, error) {
+	m.lock.Lock()
+	r, ok := m.reservations[sessionId]
+	if ok {
+		r.timer.Stop()
+		delete(m.reservations, sessionId)
+	}
+	m.lock.Unlock()
+
+	if !ok {
+		return nil, httperrors.NewResourceNotFoundError2("reservation", sessionId)
+	}
+	r.Status = status
+	// committed guests are already recorded in database, so reloading hosts is
+	// the same for all the status: drop pending usage and take database as truth.
+	m.release(r.ToExpireArgs())
+	return r.GangReservation, nil
+}
+
+func (m *GangReservationManager) List() []*api.GangReservation {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ret := make([]*api.GangReservation, 0, len(m.reservations))
+	for _, r := range m.reservations {
+		ret = append(ret, r.GangReservation)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].CreatedAt.Before(ret[j].CreatedAt)
+	})
+	return ret
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+)
+
+func newGangSchedInfo(sid string, timeout int) *api.SchedInfo {
+	return &api.SchedInfo{
+		ScheduleInput: &schedapi.ScheduleInput{
+			ScheduleBaseConfig: schedapi.ScheduleBaseConfig{SessionId: sid},
+			ServerConfig: schedapi.ServerConfig{
+				ServerConfigs: &computeapi.ServerConfigs{
+					Hypervisor:         computeapi.HYPERVISOR_KVM,
+					AllOrNothing:       true,
+					ReservationTimeout: timeout,
+				},
+			},
+			GuestIds: []string{"g1", "g2", "g3"},
+		},
+	}
+}
+
+func TestSetAllOrNothingResult(t *testing.T) {
+	output := &schedapi.ScheduleOutput{
+		Candidates: []*schedapi.CandidateResource{
+			{SessionId: "s1", HostId: "h1"},
+			{SessionId: "s1", HostId: "h2"},
+		},
+	}
+	if !setAllOrNothingResult(output) {
+		t.Fatalf("all candidates scheduled should be succeeded")
+	}
+	if output.Candidates[0].HostId != "h1" {
+		t.Errorf("succeeded result should be kept")
+	}
+
+	output.Candidates = append(output.Candidates, &schedapi.CandidateResource{SessionId: "s1", Error: "no enough memory"})
+	if setAllOrNothingResult(output) {
+		t.Fatalf("partial scheduled should be failed")
+	}
+	for i, c := range output.Candidates {
+		if c.Error == "" || c.HostId != "" {
+			t.Errorf("candidate %d should be failed without host: %#v", i, c)
+		}
+	}
+	if output.Candidates[2].Error != "no enough memory" {
+		t.Errorf("origin error should be kept, got %q", output.Candidates[2].Error)
+	}
+}
+
+func TestGangReservationManager(t *testing.T) {
+	released := make(chan *api.ExpireArgs, 10)
+	m := NewGangReservationManager(func(args *api.ExpireArgs) {
+		released <- args
+	})
+	output := &schedapi.ScheduleOutput{
+		Candidates: []*schedapi.CandidateResource{
+			{SessionId: "s1", HostId: "h2"},
+			{SessionId: "s1", HostId: "h1", BackupCandidate: &schedapi.CandidateResource{SessionId: "s1", HostId: "h3"}},
+			{SessionId: "s1", HostId: "h2"},
+		},
+	}
+
+	r := m.Reserve(newGangSchedInfo("s1", 60), output)
+	if want := []string{"h1", "h2", "h3"}; !reflect.DeepEqual(r.DirtyHosts, want) {
+		t.Errorf("reserved hosts %v, want %v", r.DirtyHosts, want)
+	}
+	if len(m.List()) != 1 {
+		t.Fatalf("reservation should be listed")
+	}
+
+	t.Run("commit", func(t *testing.T) {
+		r, err := m.Commit("s1")
+		if err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+		if r.Status != api.ReservationStatusCommitted {
+			t.Errorf("status %s, want %s", r.Status, api.ReservationStatusCommitted)
+		}
+		args := <-released
+		if args.SessionId != "s1" || len(args.DirtyHosts) != 3 {
+			t.Errorf("unexpected expire args %#v", args)
+		}
+		if _, err := m.Release("s1"); err == nil {
+			t.Errorf("finished reservation should not be released again")
+		}
+		if len(m.List()) != 0 {
+			t.Errorf("finished reservation should not be listed")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		info := newGangSchedInfo("s2", 0)
+		info.ReservationTimeout = 0
+		info.AllOrNothing = true
+		r := m.Reserve(info, output)
+		// zero timeout expires right now
+		select {
+		case args := <-released:
+			if args.SessionId != "s2" {
+				t.Errorf("unexpected expire args %#v", args)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("reservation is not released when timeout")
+		}
+		if r.Status != api.ReservationStatusExpired {
+			t.Errorf("status %s, want %s", r.Status, api.ReservationStatusExpired)
+		}
+		if _, err := m.Commit("s2"); err == nil {
+			t.Errorf("expired reservation should not be committed")
+		}
+	})
+}
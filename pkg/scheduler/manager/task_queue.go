@@ -109,15 +109,47 @@ func (te *TaskExecutor) execute(ctx context.Context) (*core.ScheduleResult, erro
 	if schedInfo.IsSuggestion {
 		return result, nil
 	}
+	if schedInfo.AllOrNothing && !setAllOrNothingResult(result.Result) {
+		// nothing is reserved, so no pending usage need to be released
+		log.Warningf("all-or-nothing schedule session %s failed", schedInfo.SessionId)
+		return result, nil
+	}
 	driver := te.unit.GetHypervisorDriver()
 
 	// set sched pending usage
 	if err := setSchedPendingUsage(driver, schedInfo, result.Result); err != nil {
 		return nil, errors.Wrap(err, "setSchedPendingUsage")
 	}
+	if schedInfo.AllOrNothing && !IsDriverSkipScheduleDirtyMark(driver) {
+		schedManager.ReservationManager.Reserve(schedInfo, result.Result)
+	}
 	return result, nil
 }
 
+// setAllOrNothingResult marks every candidate failed when any of them can't be
+// scheduled, it returns true if all candidates are scheduled.
+func setAllOrNothingResult(output *schedapi.ScheduleOutput) bool {
+	failed := 0
+	for _, c := range output.Candidates {
+		if c.Error != "" {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return true
+	}
+	reason := fmt.Sprintf("all_or_nothing: %d of %d guests can't be scheduled", failed, len(output.Candidates))
+	for i, c := range output.Candidates {
+		if c.Error == "" {
+			output.Candidates[i] = &schedapi.CandidateResource{
+				SessionId: c.SessionId,
+				Error:     reason,
+			}
+		}
+	}
+	return false
+}
+
 func GenerateResultHelper(schedInfo *api.SchedInfo) core.IResultHelper {
 	if !schedInfo.IsSuggestion {
 		return core.SResultHelperFunc(core.ResultHelp)
@@ -52,6 +52,9 @@ func (m *SHostPendingUsageManager) Keyword() string {
 func (m *SHostPendingUsageManager) newSessionUsage(req *api.SchedInfo, hostId string, candidate *schedapi.CandidateResource) *SessionPendingUsage {
 	usage := NewPendingUsageBySchedInfo(hostId, req, candidate)
 	su := NewSessionUsage(req.SessionId, hostId, usage)
+	if timeout := req.GetReservationTimeout(); timeout > su.timeout {
+		su.timeout = timeout
+	}
 	return su
 }
 
@@ -196,6 +199,7 @@ type SessionPendingUsage struct {
 	countLock *sync.Mutex
 	count     int
 	cancelCh  chan string
+	timeout   time.Duration
 }
 
 func NewSessionUsage(sid, hostId string, usage *SPendingUsage) *SessionPendingUsage {
@@ -206,6 +210,7 @@ func NewSessionUsage(sid, hostId string, usage *SPendingUsage) *SessionPendingUs
 		count:     0,
 		countLock: new(sync.Mutex),
 		cancelCh:  make(chan string),
+		timeout:   1 * time.Minute,
 	}
 	return su
 }
@@ -527,7 +532,7 @@ func (self *SessionPendingUsage) cancelSelf() {
 }
 
 func (self *SessionPendingUsage) StartTimer() {
-	timeout := 1 * time.Minute
+	timeout := self.timeout
 	go func() {
 		for {
 			select {
@@ -52,6 +52,9 @@ type SchedOptions struct {
 	ExpireQueueMaxLength          int    `help:"Expire queue max length" default:"1000"`
 	ExpireQueueDealLength         int    `help:"Expire queue deal length" default:"100"`
 
+	// all-or-nothing schedule options
+	GangReservationTimeout int `help:"Default seconds of resource reservation for all-or-nothing schedule, reservations not committed in time are released" default:"300"`
+
 	// completed queue options
 	CompletedQueueConsumptionPeriod  string `help:"Completed queue consumption period" default:"30s"`
 	CompletedQueueConsumptionTimeout string `help:"Completed queue consumption timeout" default:"30s"`
@@ -97,6 +100,14 @@ type SchedOptions struct {
 	EnableDynamicSchedtag bool `help:"Enable dynamic schedtag feature" default:"false"`
 	EnableAnalysis        bool `help:"Enable analysis feature" default:"false"`
 
+	// utilization-aware options
+	EnableUtilizationAwareSchedule bool    `help:"Compute free cpu and memory of hosts by recent utilization metrics instead of static overcommit bound, hosts with metadata sched_utilization_aware=false are excluded" default:"false"`
+	UtilizationMetricsWindow       string  `help:"Time window of host utilization metrics, the peak of per-minute mean is used" default:"15m"`
+	UtilizationRefreshInterval     string  `help:"Host utilization metrics refresh interval" default:"1m"`
+	UtilizationCpuSafetyMargin     int     `help:"Percent of physical cpu kept idle in utilization-aware schedule" default:"20"`
+	UtilizationMemorySafetyMargin  int     `help:"Percent of physical memory kept free in utilization-aware schedule" default:"15"`
+	UtilizationOvercommitLimit     float32 `help:"Upper limit of allocation in utilization-aware schedule, relative to the static capacity by overcommit bound" default:"2.0"`
+
 	OpenstackOptions
 }
 
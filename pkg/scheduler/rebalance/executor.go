@@ -0,0 +1,253 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rebalance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/wait"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	api "yunion.io/x/onecloud/pkg/apis/scheduler"
+	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	computemod "yunion.io/x/onecloud/pkg/mcclient/modules/compute"
+)
+
+const (
+	// keep the latest plans for executing and querying
+	maxKeptPlans = 20
+	// a plan computed earlier than this must be computed again before
+	// executing, the hosts have likely changed since
+	planExpiration = 30 * time.Minute
+
+	migrateWatchInterval = 10 * time.Second
+	migrateTimeout       = 2 * time.Hour
+)
+
+type migrateFunc func(ctx context.Context, m *api.RebalanceMigration) error
+
+type Executor struct {
+	lock    sync.Mutex
+	plans   map[string]*api.RebalancePlan
+	planIds []string
+	migrate migrateFunc
+}
+
+func NewExecutor() *Executor {
+	return &Executor{
+		plans:   make(map[string]*api.RebalancePlan),
+		migrate: liveMigrate,
+	}
+}
+
+var defaultExecutor = NewExecutor()
+
+func GetExecutor() *Executor {
+	return defaultExecutor
+}
+
+// Save keeps the computed plan so that it can be executed as is later, the
+// plan id is returned
+func (e *Executor) Save(plan *api.RebalancePlan) string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	plan.Id = fmt.Sprintf("%d", time.Now().UnixNano())
+	plan.Status = api.RebalancePlanStatusPlanned
+	plan.CreatedAt = time.Now()
+	e.plans[plan.Id] = plan
+	e.planIds = append(e.planIds, plan.Id)
+	// drop the oldest plans not running
+	for i := 0; len(e.planIds) > maxKeptPlans && i < len(e.planIds); {
+		id := e.planIds[i]
+		if e.plans[id].Status == api.RebalancePlanStatusRunning {
+			i++
+			continue
+		}
+		delete(e.plans, id)
+		e.planIds = append(e.planIds[:i], e.planIds[i+1:]...)
+	}
+	return plan.Id
+}
+
+// Execute runs the migrations of the saved plan in background, at most
+// concurrency live migrations run at the same time and a migration waits
+// for the migrations it depends on
+func (e *Executor) Execute(ctx context.Context, id string, concurrency int) (*api.RebalancePlan, error) {
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	e.lock.Lock()
+	plan, ok := e.plans[id]
+	if !ok {
+		e.lock.Unlock()
+		return nil, httperrors.NewResourceNotFoundError2("rebalance-plan", id)
+	}
+	if plan.Status != api.RebalancePlanStatusPlanned {
+		e.lock.Unlock()
+		return nil, httperrors.NewInvalidStatusError("rebalance plan %s is %s", id, plan.Status)
+	}
+	if time.Since(plan.CreatedAt) > planExpiration {
+		e.lock.Unlock()
+		return nil, httperrors.NewInvalidStatusError("rebalance plan %s is computed more than %s ago, please plan again", id, planExpiration)
+	}
+	plan.Status = api.RebalancePlanStatusRunning
+	e.lock.Unlock()
+
+	go e.run(ctx, plan, concurrency)
+	return e.GetPlan(id)
+}
+
+func (e *Executor) run(ctx context.Context, plan *api.RebalancePlan, concurrency int) {
+	sem := make(chan struct{}, concurrency)
+	done := make([]chan struct{}, len(plan.Migrations))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	wg := sync.WaitGroup{}
+	for i := range plan.Migrations {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			defer close(done[idx])
+			if !e.waitDependencies(plan, idx, done) {
+				return
+			}
+			sem <- struct{}{}
+			defer func() {
+				<-sem
+			}()
+			e.runMigration(ctx, plan, idx)
+		}(i)
+	}
+	wg.Wait()
+	e.lock.Lock()
+	plan.Status = api.RebalancePlanStatusFinished
+	e.lock.Unlock()
+}
+
+// waitDependencies waits for the earlier migrations the migration depends
+// on, the migration is skipped if any of them did not succeed
+func (e *Executor) waitDependencies(plan *api.RebalancePlan, idx int, done []chan struct{}) bool {
+	e.lock.Lock()
+	deps := make([]int, len(plan.Migrations[idx].DependsOn))
+	copy(deps, plan.Migrations[idx].DependsOn)
+	e.lock.Unlock()
+
+	for _, dep := range deps {
+		// only earlier migrations are waited for, so that no cycle is possible
+		if dep < 0 || dep >= idx {
+			continue
+		}
+		<-done[dep]
+		e.lock.Lock()
+		depM := plan.Migrations[dep]
+		e.lock.Unlock()
+		if depM.Status != api.RebalanceMigrationStatusSuccess {
+			err := errors.Errorf("depended migration of %s(%s) is %s", depM.GuestName, depM.GuestId, depM.Status)
+			e.setMigrationStatus(plan, idx, api.RebalanceMigrationStatusSkipped, err)
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Executor) setMigrationStatus(plan *api.RebalancePlan, idx int, status string, err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	plan.Migrations[idx].Status = status
+	if err != nil {
+		plan.Migrations[idx].Error = err.Error()
+	}
+}
+
+func (e *Executor) runMigration(ctx context.Context, plan *api.RebalancePlan, idx int) {
+	e.lock.Lock()
+	m := plan.Migrations[idx]
+	e.lock.Unlock()
+
+	e.setMigrationStatus(plan, idx, api.RebalanceMigrationStatusRunning, nil)
+	if err := e.migrate(ctx, &m); err != nil {
+		log.Errorf("rebalance plan %s migrate %s(%s) to %s: %v", plan.Id, m.GuestName, m.GuestId, m.TargetHostName, err)
+		e.setMigrationStatus(plan, idx, api.RebalanceMigrationStatusFailed, err)
+		return
+	}
+	e.setMigrationStatus(plan, idx, api.RebalanceMigrationStatusSuccess, nil)
+}
+
+// GetPlan returns a snapshot of the plan
+func (e *Executor) GetPlan(id string) (*api.RebalancePlan, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	plan, ok := e.plans[id]
+	if !ok {
+		return nil, httperrors.NewResourceNotFoundError2("rebalance-plan", id)
+	}
+	ret := *plan
+	ret.Migrations = make([]api.RebalanceMigration, len(plan.Migrations))
+	copy(ret.Migrations, plan.Migrations)
+	return &ret, nil
+}
+
+func liveMigrate(ctx context.Context, m *api.RebalanceMigration) error {
+	s := auth.GetAdminSession(ctx, consts.GetRegion())
+	// the plan was computed earlier, make sure the guest is still where the
+	// plan expects it
+	obj, err := computemod.Servers.Get(s, m.GuestId, nil)
+	if err != nil {
+		return errors.Wrap(err, "get server")
+	}
+	if hostId, _ := obj.GetString("host_id"); hostId != m.SourceHostId {
+		return errors.Errorf("server moved to host %s since planning", hostId)
+	}
+	if status, _ := obj.GetString("status"); status != computeapi.VM_RUNNING {
+		return errors.Errorf("server status %s since planning", status)
+	}
+	input := computeapi.GuestLiveMigrateInput{
+		PreferHostId: m.TargetHostId,
+	}
+	if _, err := computemod.Servers.PerformAction(s, m.GuestId, "live-migrate", jsonutils.Marshal(input)); err != nil {
+		return errors.Wrap(err, "live-migrate")
+	}
+	return wait.Poll(migrateWatchInterval, migrateTimeout, func() (bool, error) {
+		obj, err := computemod.Servers.Get(s, m.GuestId, nil)
+		if err != nil {
+			return false, errors.Wrap(err, "get server")
+		}
+		status, _ := obj.GetString("status")
+		hostId, _ := obj.GetString("host_id")
+		if status == computeapi.VM_RUNNING {
+			if hostId == m.TargetHostId {
+				return true, nil
+			}
+			if hostId == m.SourceHostId {
+				return false, errors.Errorf("server still on source host %s", m.SourceHostId)
+			}
+			return false, errors.Errorf("server expected on host %s, current %s", m.TargetHostId, hostId)
+		}
+		if strings.HasSuffix(status, "_fail") || strings.HasSuffix(status, "_failed") {
+			return false, errors.Errorf("server status %s", status)
+		}
+		return false, nil
+	})
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rebalance
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "yunion.io/x/onecloud/pkg/apis/scheduler"
+)
+
+func waitPlanFinished(t *testing.T, e *Executor, id string) *api.RebalancePlan {
+	var ret *api.RebalancePlan
+	for i := 0; i < 100; i++ {
+		var err error
+		ret, err = e.GetPlan(id)
+		if err != nil {
+			t.Fatalf("GetPlan: %v", err)
+		}
+		if ret.Status == api.RebalancePlanStatusFinished {
+			return ret
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("plan not finished: %s", ret.Status)
+	return nil
+}
+
+func TestExecutor(t *testing.T) {
+	var running, peak int32
+	finished := sync.Map{}
+	e := NewExecutor()
+	e.migrate = func(ctx context.Context, m *api.RebalanceMigration) error {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if cur <= old || atomic.CompareAndSwapInt32(&peak, old, cur) {
+				break
+			}
+		}
+		if m.GuestId == "guest-5" {
+			if _, ok := finished.Load("guest-1"); !ok {
+				t.Errorf("guest-5 migrated before guest-1 it depends on")
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		if m.GuestId == "guest-3" {
+			return fmt.Errorf("migrate failed")
+		}
+		finished.Store(m.GuestId, true)
+		return nil
+	}
+
+	plan := &api.RebalancePlan{}
+	for i := 0; i < 6; i++ {
+		plan.Migrations = append(plan.Migrations, api.RebalanceMigration{
+			GuestId: fmt.Sprintf("guest-%d", i),
+			Status:  api.RebalanceMigrationStatusPending,
+		})
+	}
+	plan.Migrations[4].DependsOn = []int{3}
+	plan.Migrations[5].DependsOn = []int{1}
+	id := e.Save(plan)
+	if ret, err := e.GetPlan(id); err != nil || ret.Status != api.RebalancePlanStatusPlanned {
+		t.Fatalf("saved plan %v: %v", ret, err)
+	}
+	if _, err := e.Execute(context.Background(), id, 2); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if _, err := e.Execute(context.Background(), id, 2); err == nil {
+		t.Errorf("expect error executing a running plan twice")
+	}
+	ret := waitPlanFinished(t, e, id)
+	if peak > 2 {
+		t.Errorf("concurrency exceeds limit: %d", peak)
+	}
+	for _, m := range ret.Migrations {
+		expect := api.RebalanceMigrationStatusSuccess
+		switch m.GuestId {
+		case "guest-3":
+			expect = api.RebalanceMigrationStatusFailed
+		case "guest-4":
+			expect = api.RebalanceMigrationStatusSkipped
+		}
+		if m.Status != expect {
+			t.Errorf("migration %s status %s, expect %s", m.GuestId, m.Status, expect)
+		}
+	}
+	if _, err := e.GetPlan("not-exists"); err == nil {
+		t.Errorf("expect not found error")
+	}
+}
+
+func TestExecutorExpiredPlan(t *testing.T) {
+	e := NewExecutor()
+	e.migrate = func(ctx context.Context, m *api.RebalanceMigration) error {
+		return nil
+	}
+	id := e.Save(&api.RebalancePlan{})
+	e.plans[id].CreatedAt = time.Now().Add(-planExpiration - time.Minute)
+	if _, err := e.Execute(context.Background(), id, 1); err == nil {
+		t.Errorf("expect error executing an expired plan")
+	}
+	if _, err := e.Execute(context.Background(), "not-exists", 1); err == nil {
+		t.Errorf("expect not found error")
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rebalance
+
+import (
+	"sort"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/tristate"
+	"yunion.io/x/pkg/utils"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	api "yunion.io/x/onecloud/pkg/apis/scheduler"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+	"yunion.io/x/onecloud/pkg/scheduler/data_manager/schedtag"
+)
+
+func matchIdent(idents []string, id, name string) bool {
+	return utils.IsInStringArray(id, idents) || utils.IsInStringArray(name, idents)
+}
+
+// hostSchedtags returns the key of the host schedtags with a require or
+// exclude default strategy and the ids and names of all its schedtags
+func hostSchedtags(hostId string) (string, []string) {
+	keys := []string{}
+	tags := []string{}
+	for _, tag := range schedtag.GetCandidateSchedtags("hosts", hostId) {
+		if utils.IsInStringArray(tag.GetDefaultStrategy(), []string{models.STRATEGY_REQUIRE, models.STRATEGY_EXCLUDE}) {
+			keys = append(keys, tag.GetId())
+		}
+		tags = append(tags, tag.GetId(), tag.GetName())
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ","), tags
+}
+
+// guestSchedtags returns the host schedtags required and excluded by the sched
+// policies matching the guest, the same ones live migration is scheduled with
+func guestSchedtags(guest *models.SGuest) ([]string, []string) {
+	require, exclude := []string{}, []string{}
+	input := models.ApplySchedPolicies(guest.ToSchedDesc())
+	for _, tag := range input.Schedtags {
+		if tag.ResourceType != "" && tag.ResourceType != models.HostManager.KeywordPlural() {
+			continue
+		}
+		switch tag.Strategy {
+		case models.STRATEGY_REQUIRE:
+			require = append(require, tag.Id)
+		case models.STRATEGY_EXCLUDE:
+			exclude = append(exclude, tag.Id)
+		}
+	}
+	return require, exclude
+}
+
+// BuildHosts converts kvm hosts of the candidate cache into planner hosts and
+// loads their live migratable guests and anti-affinity groups from database
+func BuildHosts(input api.RebalancePlanInput, candidates []core.Candidater) ([]*Host, map[string]*Group, error) {
+	hosts := make([]*Host, 0)
+	hostMap := make(map[string]*Host)
+	for _, c := range candidates {
+		getter := c.Getter()
+		if getter.HostType() != computeapi.HOST_TYPE_HYPERVISOR {
+			continue
+		}
+		if !getter.Enabled() || getter.HostStatus() != computeapi.HOST_ONLINE || getter.Status() != computeapi.HOST_STATUS_RUNNING {
+			continue
+		}
+		zone := getter.Zone()
+		if zone == nil || (input.Zone != "" && input.Zone != zone.GetId() && input.Zone != zone.GetName()) {
+			continue
+		}
+		if len(input.Hosts) > 0 && !matchIdent(input.Hosts, getter.Id(), getter.Name()) {
+			continue
+		}
+		totalCpu, totalMem := getter.TotalCPUCount(false), getter.TotalMemorySize(false)
+		schedtagKey, schedtags := hostSchedtags(getter.Id())
+		h := &Host{
+			Id:          getter.Id(),
+			Name:        getter.Name(),
+			ZoneId:      zone.GetId(),
+			HostType:    getter.HostType(),
+			SchedtagKey: schedtagKey,
+			Schedtags:   schedtags,
+			TotalCpu:    totalCpu,
+			TotalMem:    totalMem,
+			UsedCpu:     totalCpu - getter.FreeCPUCount(false),
+			UsedMem:     totalMem - getter.FreeMemorySize(false),
+			Guests:      []*Guest{},
+		}
+		if host := getter.Host(); host != nil && host.IsMaintenance {
+			h.NoTarget = true
+		}
+		// drained hosts never receive guests
+		if matchIdent(input.DrainHosts, h.Id, h.Name) {
+			h.NoTarget = true
+		}
+		hosts = append(hosts, h)
+		hostMap[h.Id] = h
+	}
+	if len(hosts) == 0 {
+		return hosts, map[string]*Group{}, nil
+	}
+
+	groups, err := fillHostGuests(hostMap)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hosts, groups, nil
+}
+
+func fillHostGuests(hostMap map[string]*Host) (map[string]*Group, error) {
+	hostIds := make([]string, 0, len(hostMap))
+	for id := range hostMap {
+		hostIds = append(hostIds, id)
+	}
+	q := models.GuestManager.Query().In("host_id", hostIds).
+		Equals("status", computeapi.VM_RUNNING).
+		Equals("hypervisor", computeapi.HYPERVISOR_KVM).
+		IsNullOrEmpty("backup_host_id")
+	guests := make([]models.SGuest, 0)
+	if err := db.FetchModelObjects(models.GuestManager, q, &guests); err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects guests")
+	}
+	guestIds := make([]string, 0, len(guests))
+	for i := range guests {
+		guestIds = append(guestIds, guests[i].Id)
+	}
+	if len(guestIds) == 0 {
+		return map[string]*Group{}, nil
+	}
+
+	// guests with passthrough devices can't be live migrated
+	devs := make([]models.SIsolatedDevice, 0)
+	q = models.IsolatedDeviceManager.Query().In("guest_id", guestIds)
+	if err := db.FetchModelObjects(models.IsolatedDeviceManager, q, &devs); err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects isolated devices")
+	}
+	pinned := make(map[string]bool)
+	for i := range devs {
+		pinned[devs[i].GuestId] = true
+	}
+
+	groupGuests := make([]models.SGroupguest, 0)
+	q = models.GroupguestManager.Query().In("guest_id", guestIds)
+	if err := db.FetchModelObjects(models.GroupguestManager, q, &groupGuests); err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects groupguests")
+	}
+	groupIds := make([]string, 0)
+	for i := range groupGuests {
+		groupIds = append(groupIds, groupGuests[i].GroupId)
+	}
+	groups := make(map[string]*Group)
+	pinnedGroups := make(map[string]bool)
+	if len(groupIds) > 0 {
+		dbGroups := make([]models.SGroup, 0)
+		q = models.GroupManager.Query().In("id", groupIds)
+		if err := db.FetchModelObjects(models.GroupManager, q, &dbGroups); err != nil {
+			return nil, errors.Wrap(err, "FetchModelObjects groups")
+		}
+		for i := range dbGroups {
+			group := &dbGroups[i]
+			if group.Enabled.IsFalse() || group.ForceDispersion == tristate.False {
+				continue
+			}
+			if !group.IsHostAntiAffinity() {
+				// hard topology rules other than host anti-affinity are not
+				// understood by the planner, keep their members in place
+				pinnedGroups[group.Id] = true
+				continue
+			}
+			groups[group.Id] = &Group{Id: group.Id, Granularity: group.Granularity}
+		}
+	}
+	guestGroups := make(map[string][]string)
+	for i := range groupGuests {
+		gg := groupGuests[i]
+		if pinnedGroups[gg.GroupId] {
+			pinned[gg.GuestId] = true
+		}
+		if _, ok := groups[gg.GroupId]; ok {
+			guestGroups[gg.GuestId] = append(guestGroups[gg.GuestId], gg.GroupId)
+		}
+	}
+
+	for i := range guests {
+		guest := &guests[i]
+		require, exclude := guestSchedtags(guest)
+		hostMap[guest.HostId].Guests = append(hostMap[guest.HostId].Guests, &Guest{
+			Id:               guest.Id,
+			Name:             guest.Name,
+			Cpu:              int64(guest.VcpuCount),
+			Mem:              int64(guest.VmemSize),
+			Groups:           guestGroups[guest.Id],
+			RequireSchedtags: require,
+			ExcludeSchedtags: exclude,
+			Fixed:            pinned[guest.Id],
+		})
+	}
+	return groups, nil
+}
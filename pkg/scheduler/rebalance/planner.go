@@ -0,0 +1,431 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rebalance
+
+import (
+	"sort"
+
+	"yunion.io/x/pkg/utils"
+
+	api "yunion.io/x/onecloud/pkg/apis/scheduler"
+)
+
+const (
+	defaultMaxMigrations  = 20
+	defaultTolerance      = 0.1
+	defaultMaxUtilization = 0.8
+	defaultConcurrency    = 2
+)
+
+// Guest is a live migratable guest seen by the planner
+type Guest struct {
+	Id     string
+	Name   string
+	Cpu    int64
+	Mem    int64
+	Groups []string
+	// host schedtags the guest requires or excludes by sched policies, they
+	// apply on top of the default strategies in Host.SchedtagKey
+	RequireSchedtags []string
+	ExcludeSchedtags []string
+	// guest can't be migrated but still counts for anti-affinity
+	Fixed bool
+}
+
+// Group is an instance group requiring anti-affinity, at most Granularity
+// guests of the group can run on one host
+type Group struct {
+	Id          string
+	Granularity int
+}
+
+// Host is a candidate host of rebalancing, TotalCpu and TotalMem include
+// the commit bound so that they are comparable to guest allocation
+type Host struct {
+	Id       string
+	Name     string
+	ZoneId   string
+	HostType string
+	// schedtags whose default strategy is require or exclude, guests only
+	// move between hosts of the same placement constraints
+	SchedtagKey string
+	// ids and names of all schedtags of the host
+	Schedtags []string
+	// host can't receive guests, e.g. it is out of the requested scope
+	NoTarget bool
+
+	TotalCpu int64
+	TotalMem int64
+	UsedCpu  int64
+	UsedMem  int64
+
+	Guests []*Guest
+}
+
+func (h *Host) cpuRatio() float64 {
+	if h.TotalCpu <= 0 {
+		return 0
+	}
+	return float64(h.UsedCpu) / float64(h.TotalCpu)
+}
+
+func (h *Host) memRatio() float64 {
+	if h.TotalMem <= 0 {
+		return 0
+	}
+	return float64(h.UsedMem) / float64(h.TotalMem)
+}
+
+// load is the utilization of the scarcer resource
+func (h *Host) load() float64 {
+	cpu, mem := h.cpuRatio(), h.memRatio()
+	if cpu > mem {
+		return cpu
+	}
+	return mem
+}
+
+func (h *Host) loadWith(cpu, mem int64) float64 {
+	h.UsedCpu += cpu
+	h.UsedMem += mem
+	defer func() {
+		h.UsedCpu -= cpu
+		h.UsedMem -= mem
+	}()
+	return h.load()
+}
+
+func (h *Host) usage() api.RebalanceHostUsage {
+	return api.RebalanceHostUsage{
+		HostId:     h.Id,
+		HostName:   h.Name,
+		GuestCount: len(h.Guests),
+		CpuRatio:   h.cpuRatio(),
+		MemRatio:   h.memRatio(),
+	}
+}
+
+type move struct {
+	guest  *Guest
+	source *Host
+	target *Host
+}
+
+type Planner struct {
+	input  api.RebalancePlanInput
+	hosts  []*Host
+	groups map[string]*Group
+
+	// host id => group id => guest count
+	groupCount map[string]map[string]int
+	moved      map[string]bool
+	drained    map[string]bool
+	moves      []move
+}
+
+func NewPlanner(input api.RebalancePlanInput, hosts []*Host, groups map[string]*Group) *Planner {
+	if input.Strategy == "" {
+		input.Strategy = api.RebalanceStrategyBalance
+	}
+	if input.MaxMigrations <= 0 {
+		input.MaxMigrations = defaultMaxMigrations
+	}
+	if input.Tolerance <= 0 {
+		input.Tolerance = defaultTolerance
+	}
+	if input.MaxUtilization <= 0 {
+		input.MaxUtilization = defaultMaxUtilization
+	}
+	p := &Planner{
+		input:      input,
+		hosts:      hosts,
+		groups:     groups,
+		groupCount: make(map[string]map[string]int),
+		moved:      make(map[string]bool),
+		drained:    make(map[string]bool),
+	}
+	for _, h := range hosts {
+		counts := make(map[string]int)
+		for _, g := range h.Guests {
+			for _, gid := range g.Groups {
+				counts[gid]++
+			}
+		}
+		p.groupCount[h.Id] = counts
+	}
+	return p
+}
+
+func (p *Planner) Input() api.RebalancePlanInput {
+	return p.input
+}
+
+// Plan computes migrations on a copy of host usage, nothing is executed
+func (p *Planner) Plan() *api.RebalancePlan {
+	plan := &api.RebalancePlan{
+		Strategy:   p.input.Strategy,
+		Status:     api.RebalancePlanStatusPlanned,
+		Migrations: []api.RebalanceMigration{},
+		FreedHosts: []string{},
+		Before:     p.usages(),
+	}
+	switch p.input.Strategy {
+	case api.RebalanceStrategyPack:
+		plan.FreedHosts = p.pack()
+	default:
+		p.balance()
+	}
+	for j, m := range p.moves {
+		plan.Migrations = append(plan.Migrations, api.RebalanceMigration{
+			GuestId:        m.guest.Id,
+			GuestName:      m.guest.Name,
+			VcpuCount:      m.guest.Cpu,
+			VmemSizeMb:     m.guest.Mem,
+			SourceHostId:   m.source.Id,
+			SourceHostName: m.source.Name,
+			TargetHostId:   m.target.Id,
+			TargetHostName: m.target.Name,
+			DependsOn:      p.dependencies(j),
+			Status:         api.RebalanceMigrationStatusPending,
+		})
+	}
+	plan.After = p.usages()
+	return plan
+}
+
+// dependencies returns the earlier moves leaving the target host of move j,
+// the capacity or anti-affinity slot they free may be what move j relies on
+func (p *Planner) dependencies(j int) []int {
+	ret := []int{}
+	for i := 0; i < j; i++ {
+		if p.moves[i].source == p.moves[j].target {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+func (p *Planner) usages() []api.RebalanceHostUsage {
+	ret := make([]api.RebalanceHostUsage, 0, len(p.hosts))
+	for _, h := range p.hosts {
+		ret = append(ret, h.usage())
+	}
+	return ret
+}
+
+func (p *Planner) canPlace(g *Guest, src, dst *Host, maxLoad float64) bool {
+	if dst == src || dst.NoTarget || p.drained[dst.Id] {
+		return false
+	}
+	if dst.ZoneId != src.ZoneId || dst.HostType != src.HostType || dst.SchedtagKey != src.SchedtagKey {
+		return false
+	}
+	for _, tag := range g.RequireSchedtags {
+		if !utils.IsInStringArray(tag, dst.Schedtags) {
+			return false
+		}
+	}
+	for _, tag := range g.ExcludeSchedtags {
+		if utils.IsInStringArray(tag, dst.Schedtags) {
+			return false
+		}
+	}
+	if dst.UsedCpu+g.Cpu > dst.TotalCpu || dst.UsedMem+g.Mem > dst.TotalMem {
+		return false
+	}
+	if maxLoad > 0 && dst.loadWith(g.Cpu, g.Mem) > maxLoad {
+		return false
+	}
+	counts := p.groupCount[dst.Id]
+	for _, gid := range g.Groups {
+		group, ok := p.groups[gid]
+		if !ok {
+			continue
+		}
+		if counts[gid] >= group.Granularity {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Planner) transfer(g *Guest, src, dst *Host) {
+	for i := range src.Guests {
+		if src.Guests[i] == g {
+			src.Guests = append(src.Guests[:i], src.Guests[i+1:]...)
+			break
+		}
+	}
+	dst.Guests = append(dst.Guests, g)
+	src.UsedCpu -= g.Cpu
+	src.UsedMem -= g.Mem
+	dst.UsedCpu += g.Cpu
+	dst.UsedMem += g.Mem
+	for _, gid := range g.Groups {
+		p.groupCount[src.Id][gid]--
+		p.groupCount[dst.Id][gid]++
+	}
+}
+
+func (p *Planner) apply(g *Guest, src, dst *Host) {
+	p.transfer(g, src, dst)
+	p.moved[g.Id] = true
+	p.moves = append(p.moves, move{guest: g, source: src, target: dst})
+}
+
+// revert undoes the moves from index n in reverse order
+func (p *Planner) revert(n int) {
+	for i := len(p.moves) - 1; i >= n; i-- {
+		m := p.moves[i]
+		p.transfer(m.guest, m.target, m.source)
+		delete(p.moved, m.guest.Id)
+	}
+	p.moves = p.moves[:n]
+}
+
+func (p *Planner) hasUnmovableGuest(h *Host) bool {
+	for _, g := range h.Guests {
+		if p.moved[g.Id] || g.Fixed {
+			return true
+		}
+	}
+	return false
+}
+
+// balance repeatedly moves one guest off the most loaded host to the host
+// where the peak load of the pair drops the most, until the spread between
+// the most and the least loaded host is within tolerance
+func (p *Planner) balance() {
+	exhausted := make(map[string]bool)
+	for len(p.moves) < p.input.MaxMigrations {
+		var src, min *Host
+		for _, h := range p.hosts {
+			if min == nil || h.load() < min.load() {
+				min = h
+			}
+			if exhausted[h.Id] || len(h.Guests) == 0 {
+				continue
+			}
+			if src == nil || h.load() > src.load() {
+				src = h
+			}
+		}
+		if src == nil || src.load()-min.load() <= p.input.Tolerance {
+			return
+		}
+		var (
+			best     *move
+			bestPeak = src.load()
+		)
+		for _, g := range src.Guests {
+			if p.moved[g.Id] || g.Fixed {
+				continue
+			}
+			srcLoad := src.loadWith(-g.Cpu, -g.Mem)
+			for _, dst := range p.hosts {
+				if !p.canPlace(g, src, dst, 0) {
+					continue
+				}
+				peak := dst.loadWith(g.Cpu, g.Mem)
+				if srcLoad > peak {
+					peak = srcLoad
+				}
+				if peak < bestPeak {
+					bestPeak = peak
+					best = &move{guest: g, source: src, target: dst}
+				}
+			}
+		}
+		if best == nil {
+			exhausted[src.Id] = true
+			continue
+		}
+		p.apply(best.guest, best.source, best.target)
+	}
+}
+
+func (p *Planner) drainCandidates() []*Host {
+	ret := make([]*Host, 0)
+	if len(p.input.DrainHosts) > 0 {
+		for _, ident := range p.input.DrainHosts {
+			for _, h := range p.hosts {
+				if h.Id == ident || h.Name == ident {
+					ret = append(ret, h)
+				}
+			}
+		}
+		return ret
+	}
+	for _, h := range p.hosts {
+		if len(h.Guests) > 0 {
+			ret = append(ret, h)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].load() < ret[j].load()
+	})
+	return ret
+}
+
+// pack tries to empty whole hosts beginning with the least loaded one, the
+// guests of a host are placed best-fit into the most loaded hosts below the
+// utilization limit, a host is only drained when all its guests fit
+func (p *Planner) pack() []string {
+	freed := []string{}
+	for _, src := range p.drainCandidates() {
+		// never move a guest twice
+		if len(src.Guests) == 0 || p.drained[src.Id] || p.hasUnmovableGuest(src) {
+			continue
+		}
+		if len(p.moves)+len(src.Guests) > p.input.MaxMigrations {
+			continue
+		}
+		// a host being drained is not a target anymore
+		p.drained[src.Id] = true
+		guests := make([]*Guest, len(src.Guests))
+		copy(guests, src.Guests)
+		sort.SliceStable(guests, func(i, j int) bool {
+			if guests[i].Mem != guests[j].Mem {
+				return guests[i].Mem > guests[j].Mem
+			}
+			return guests[i].Cpu > guests[j].Cpu
+		})
+		start := len(p.moves)
+		ok := true
+		for _, g := range guests {
+			var target *Host
+			for _, dst := range p.hosts {
+				if !p.canPlace(g, src, dst, p.input.MaxUtilization) {
+					continue
+				}
+				if target == nil || dst.load() > target.load() {
+					target = dst
+				}
+			}
+			if target == nil {
+				ok = false
+				break
+			}
+			p.apply(g, src, target)
+		}
+		if !ok {
+			p.revert(start)
+			delete(p.drained, src.Id)
+			continue
+		}
+		freed = append(freed, src.Id)
+	}
+	return freed
+}
@@ -0,0 +1,258 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rebalance
+
+import (
+	"fmt"
+	"testing"
+
+	api "yunion.io/x/onecloud/pkg/apis/scheduler"
+)
+
+func newTestHost(id string, totalCpu, totalMem int64, guests ...*Guest) *Host {
+	h := &Host{
+		Id:       id,
+		Name:     id,
+		ZoneId:   "zone",
+		HostType: "hypervisor",
+		TotalCpu: totalCpu,
+		TotalMem: totalMem,
+		Guests:   guests,
+	}
+	for _, g := range guests {
+		h.UsedCpu += g.Cpu
+		h.UsedMem += g.Mem
+	}
+	return h
+}
+
+func newTestGuests(prefix string, count int, cpu, mem int64) []*Guest {
+	ret := make([]*Guest, 0, count)
+	for i := 0; i < count; i++ {
+		ret = append(ret, &Guest{Id: fmt.Sprintf("%s-%d", prefix, i), Name: fmt.Sprintf("%s-%d", prefix, i), Cpu: cpu, Mem: mem})
+	}
+	return ret
+}
+
+func maxSpread(usages []api.RebalanceHostUsage) float64 {
+	min, max := 1.0, 0.0
+	for _, u := range usages {
+		load := u.CpuRatio
+		if u.MemRatio > load {
+			load = u.MemRatio
+		}
+		if load < min {
+			min = load
+		}
+		if load > max {
+			max = load
+		}
+	}
+	return max - min
+}
+
+func TestPlannerBalance(t *testing.T) {
+	hosts := []*Host{
+		newTestHost("host1", 32, 65536, newTestGuests("a", 8, 2, 4096)...),
+		newTestHost("host2", 32, 65536),
+	}
+	plan := NewPlanner(api.RebalancePlanInput{}, hosts, nil).Plan()
+	if len(plan.Migrations) != 4 {
+		t.Fatalf("expect 4 migrations, got %d", len(plan.Migrations))
+	}
+	for _, m := range plan.Migrations {
+		if m.SourceHostId != "host1" || m.TargetHostId != "host2" {
+			t.Errorf("unexpected migration %s -> %s", m.SourceHostId, m.TargetHostId)
+		}
+	}
+	if spread := maxSpread(plan.After); spread > 0.1 {
+		t.Errorf("expect balanced hosts, spread %f", spread)
+	}
+	if spread := maxSpread(plan.Before); spread != 0.5 {
+		t.Errorf("before usage should not change, spread %f", spread)
+	}
+}
+
+func TestPlannerBalanceConstraints(t *testing.T) {
+	t.Run("anti-affinity", func(t *testing.T) {
+		guests := newTestGuests("a", 2, 2, 4096)
+		for _, g := range guests {
+			g.Groups = []string{"group1"}
+		}
+		other := newTestGuests("b", 1, 2, 4096)[0]
+		other.Groups = []string{"group1"}
+		hosts := []*Host{
+			newTestHost("host1", 32, 65536, guests...),
+			newTestHost("host2", 32, 65536, other),
+		}
+		groups := map[string]*Group{"group1": {Id: "group1", Granularity: 1}}
+		plan := NewPlanner(api.RebalancePlanInput{Tolerance: 0.01}, hosts, groups).Plan()
+		if len(plan.Migrations) != 0 {
+			t.Errorf("anti-affinity group should block migrations, got %#v", plan.Migrations)
+		}
+	})
+	t.Run("schedtags", func(t *testing.T) {
+		hosts := []*Host{
+			newTestHost("host1", 32, 65536, newTestGuests("a", 8, 2, 4096)...),
+			newTestHost("host2", 32, 65536),
+		}
+		hosts[1].SchedtagKey = "gpu"
+		plan := NewPlanner(api.RebalancePlanInput{}, hosts, nil).Plan()
+		if len(plan.Migrations) != 0 {
+			t.Errorf("hosts with different schedtags should not exchange guests, got %#v", plan.Migrations)
+		}
+	})
+	t.Run("guest schedtags", func(t *testing.T) {
+		newHosts := func() []*Host {
+			guests := newTestGuests("a", 8, 2, 4096)
+			for _, g := range guests {
+				g.RequireSchedtags = []string{"ssd"}
+				g.ExcludeSchedtags = []string{"maintain"}
+			}
+			hosts := []*Host{
+				newTestHost("host1", 32, 65536, guests...),
+				newTestHost("host2", 32, 65536),
+				newTestHost("host3", 32, 65536),
+			}
+			hosts[0].Schedtags = []string{"ssd"}
+			return hosts
+		}
+		hosts := newHosts()
+		hosts[2].Schedtags = []string{"ssd", "maintain"}
+		plan := NewPlanner(api.RebalancePlanInput{}, hosts, nil).Plan()
+		if len(plan.Migrations) != 0 {
+			t.Errorf("guests should stay off hosts without required or with excluded schedtags, got %#v", plan.Migrations)
+		}
+
+		hosts = newHosts()
+		hosts[2].Schedtags = []string{"ssd"}
+		plan = NewPlanner(api.RebalancePlanInput{}, hosts, nil).Plan()
+		if len(plan.Migrations) == 0 {
+			t.Fatalf("expect migrations to host3")
+		}
+		for _, m := range plan.Migrations {
+			if m.TargetHostId != "host3" {
+				t.Errorf("unexpected migration to %s", m.TargetHostId)
+			}
+		}
+	})
+	t.Run("max migrations", func(t *testing.T) {
+		hosts := []*Host{
+			newTestHost("host1", 32, 65536, newTestGuests("a", 8, 2, 4096)...),
+			newTestHost("host2", 32, 65536),
+		}
+		plan := NewPlanner(api.RebalancePlanInput{MaxMigrations: 2}, hosts, nil).Plan()
+		if len(plan.Migrations) != 2 {
+			t.Errorf("expect 2 migrations, got %d", len(plan.Migrations))
+		}
+	})
+}
+
+func TestPlannerPack(t *testing.T) {
+	hosts := []*Host{
+		newTestHost("host1", 32, 65536, newTestGuests("a", 6, 2, 4096)...),
+		newTestHost("host2", 32, 65536, newTestGuests("b", 2, 2, 4096)...),
+		newTestHost("host3", 32, 65536, newTestGuests("c", 4, 2, 4096)...),
+	}
+	input := api.RebalancePlanInput{Strategy: api.RebalanceStrategyPack}
+	plan := NewPlanner(input, hosts, nil).Plan()
+	if len(plan.FreedHosts) != 2 || plan.FreedHosts[0] != "host2" || plan.FreedHosts[1] != "host3" {
+		t.Fatalf("expect host2 and host3 freed, got %v", plan.FreedHosts)
+	}
+	for _, m := range plan.Migrations {
+		if m.TargetHostId != "host1" {
+			t.Errorf("unexpected migration to %s", m.TargetHostId)
+		}
+	}
+	for _, u := range plan.After {
+		if u.MemRatio > 0.8 {
+			t.Errorf("host %s exceeds utilization limit: %f", u.HostId, u.MemRatio)
+		}
+	}
+
+	// host1 can't take all guests below 60%
+	hosts = []*Host{
+		newTestHost("host1", 32, 65536, newTestGuests("a", 6, 2, 4096)...),
+		newTestHost("host2", 32, 65536, newTestGuests("b", 2, 2, 4096)...),
+		newTestHost("host3", 32, 65536, newTestGuests("c", 4, 2, 4096)...),
+	}
+	input.MaxUtilization = 0.6
+	plan = NewPlanner(input, hosts, nil).Plan()
+	if len(plan.FreedHosts) != 1 || plan.FreedHosts[0] != "host2" {
+		t.Fatalf("expect host2 freed, got %v", plan.FreedHosts)
+	}
+	if len(plan.Migrations) != 2 {
+		t.Errorf("expect 2 migrations, got %d", len(plan.Migrations))
+	}
+}
+
+func TestPlannerPackDrainHosts(t *testing.T) {
+	newHosts := func() []*Host {
+		hosts := []*Host{
+			newTestHost("host1", 32, 65536, newTestGuests("a", 2, 2, 4096)...),
+			newTestHost("host2", 32, 65536, newTestGuests("b", 6, 2, 4096)...),
+			newTestHost("host3", 32, 65536, newTestGuests("c", 8, 2, 4096)...),
+		}
+		hosts[1].NoTarget = true
+		return hosts
+	}
+	input := api.RebalancePlanInput{Strategy: api.RebalanceStrategyPack, DrainHosts: []string{"host2"}}
+	plan := NewPlanner(input, newHosts(), nil).Plan()
+	if len(plan.FreedHosts) != 1 || plan.FreedHosts[0] != "host2" {
+		t.Fatalf("expect host2 freed, got %v", plan.FreedHosts)
+	}
+	if len(plan.Migrations) != 6 {
+		t.Errorf("expect 6 migrations, got %d", len(plan.Migrations))
+	}
+
+	// an unmovable guest blocks draining
+	hosts := newHosts()
+	hosts[1].Guests[0].Fixed = true
+	plan = NewPlanner(input, hosts, nil).Plan()
+	if len(plan.FreedHosts) != 0 || len(plan.Migrations) != 0 {
+		t.Errorf("expect nothing planned, got %v %v", plan.FreedHosts, plan.Migrations)
+	}
+
+	// tentative moves are reverted when not all guests fit
+	hosts = newHosts()
+	input.MaxUtilization = 0.45
+	plan = NewPlanner(input, hosts, nil).Plan()
+	if len(plan.FreedHosts) != 0 || len(plan.Migrations) != 0 {
+		t.Errorf("expect nothing planned, got %v %v", plan.FreedHosts, plan.Migrations)
+	}
+	for i, u := range plan.After {
+		if u != plan.Before[i] {
+			t.Errorf("host usage changed after revert: %#v != %#v", u, plan.Before[i])
+		}
+	}
+}
+
+func TestPlannerDependencies(t *testing.T) {
+	h1, h2, h3 := newTestHost("host1", 32, 65536), newTestHost("host2", 32, 65536), newTestHost("host3", 32, 65536)
+	guests := newTestGuests("a", 4, 2, 4096)
+	p := NewPlanner(api.RebalancePlanInput{}, []*Host{h1, h2, h3}, nil)
+	p.moves = []move{
+		{guest: guests[0], source: h2, target: h3},
+		{guest: guests[1], source: h1, target: h3},
+		{guest: guests[2], source: h1, target: h2},
+		{guest: guests[3], source: h3, target: h1},
+	}
+	expects := [][]int{{}, {}, {0}, {1, 2}}
+	for j, expect := range expects {
+		if deps := p.dependencies(j); fmt.Sprint(deps) != fmt.Sprint(expect) {
+			t.Errorf("move %d depends on %v, expect %v", j, deps, expect)
+		}
+	}
+}
@@ -44,6 +44,7 @@ import (
 	"yunion.io/x/onecloud/pkg/scheduler/data_manager/network"
 	"yunion.io/x/onecloud/pkg/scheduler/data_manager/schedtag"
 	skuman "yunion.io/x/onecloud/pkg/scheduler/data_manager/sku"
+	"yunion.io/x/onecloud/pkg/scheduler/data_manager/utilization"
 	"yunion.io/x/onecloud/pkg/scheduler/data_manager/wire"
 	"yunion.io/x/onecloud/pkg/scheduler/data_manager/zone"
 	schedhandler "yunion.io/x/onecloud/pkg/scheduler/handler"
@@ -119,6 +120,9 @@ func StartService() error {
 			ctx := context.Background()
 			go skuman.Start(utils.ToDuration(o.Options.SkuRefreshInterval))
 			go schedtag.Start(ctx, utils.ToDuration("30s"))
+			if o.Options.EnableUtilizationAwareSchedule {
+				go utilization.Start(ctx, utils.ToDuration(o.Options.UtilizationRefreshInterval), utils.ToDuration(o.Options.UtilizationMetricsWindow))
+			}
 
 			for _, f := range []func(ctx context.Context){
 				cloudregion.Manager.Start,
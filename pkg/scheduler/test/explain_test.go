@@ -0,0 +1,152 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"yunion.io/x/onecloud/pkg/apis/compute"
+	apisdu "yunion.io/x/onecloud/pkg/apis/scheduler"
+	_ "yunion.io/x/onecloud/pkg/compute/guestdrivers"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+)
+
+func TestGenericSchedulerExplain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	commonInfo := &api.SchedInfo{
+		ScheduleInput: &apisdu.ScheduleInput{
+			ServerConfig: apisdu.ServerConfig{
+				ServerConfigs: &compute.ServerConfigs{
+					PreferRegion: GlobalCloudregion.GetId(),
+					PreferZone:   GlobalZone.GetId(),
+					Hypervisor:   "hypervisor",
+					ResourceType: "shared",
+					InstanceType: "ecs.g1.c1m1",
+					Sku:          "ecs.g1.c1m1",
+					Count:        1,
+					Disks: []*compute.DiskConfig{
+						{
+							Backend:  "local",
+							DiskType: "sys",
+							ImageId:  "CentOS7.6",
+							Index:    0,
+							SizeMb:   30720,
+						},
+					},
+					BaremetalDiskConfigs: []*compute.BaremetalDiskConfig{
+						{
+							Type:  "hybrid",
+							Conf:  "none",
+							Count: 0,
+						},
+					},
+				},
+				Memory:  4096,
+				Ncpu:    1,
+				Project: GlobalProject,
+				Domain:  GlobalDoamin,
+			},
+		},
+		RequiredCandidates: 1,
+	}
+	getterParam1 := sGetterParams{
+		HostId:                 "host01",
+		HostName:               "host01name",
+		Domain:                 "default",
+		PublicScope:            "system",
+		Zone:                   buildZone("zone01", ""),
+		CloudRegion:            buildCloudregion("default", "", ""),
+		HostType:               api.HostHypervisorForKvm,
+		Storages:               []*api.CandidateStorage{buildStorage("storage01", "", 201330)},
+		TotalCPUCount:          8,
+		FreeCPUCount:           8,
+		TotalMemorySize:        10240,
+		FreeMemorySize:         10240,
+		FreeStorageSizeAnyType: 201330,
+		Skus:                   []string{"ecs.g1.c1m1"},
+	}
+	getterParam2 := getterParam1
+	getterParam2.HostId = "host02"
+	getterParam2.HostName = "host02name"
+	getterParam2.FreeCPUCount = 0
+	getterParam2.FreeMemorySize = 1024
+
+	explain := func(info *api.SchedInfo) *apisdu.SchedExplainOutput {
+		candidates := []core.Candidater{
+			buildCandidate(ctrl, getterParam1),
+			buildCandidate(ctrl, getterParam2),
+		}
+		scheduler, err := core.NewGenericScheduler(buildScheduler(ctrl, nil, basePredicateNames...))
+		if err != nil {
+			t.Fatalf("NewGenericScheduler: %s", err.Error())
+		}
+		ctx, unit, candidates, _ := preSchedule(info, candidates, true)
+		output, err := scheduler.Explain(ctx, unit, candidates)
+		if err != nil {
+			t.Fatalf("genericScheduler.Explain error: %s", err.Error())
+		}
+		return output
+	}
+
+	t.Run("Report every rejected predicate", func(t *testing.T) {
+		output := explain(deepCopy(commonInfo))
+		assert := assert.New(t)
+		assert.Equal(int64(1), output.AllowCount)
+		assert.Len(output.Candidates, 2)
+
+		fitted := output.Candidates[0]
+		assert.Equal("host01", fitted.Id)
+		assert.True(fitted.Fit)
+		assert.Equal(1, fitted.Rank)
+		assert.Equal(int64(1), fitted.Selected)
+		assert.Empty(fitted.RejectedBy)
+
+		rejected := output.Candidates[1]
+		assert.Equal("host02", rejected.Id)
+		assert.False(rejected.Fit)
+		assert.Equal(0, rejected.Rank)
+		assert.Equal([]string{"host_cpu", "host_memory"}, rejected.RejectedBy)
+		for _, p := range rejected.Predicates {
+			if p.Name == "host_memory" {
+				assert.NotEmpty(p.Reasons)
+			}
+		}
+	})
+
+	t.Run("What-if host resource changes", func(t *testing.T) {
+		info := deepCopy(commonInfo)
+		info.WhatIf = &apisdu.SchedWhatIf{
+			Hosts: []apisdu.SchedWhatIfHost{
+				{Id: "host02name", ExtraMemoryMb: 65536, ExtraCpuCount: 8},
+			},
+		}
+		info.Count = 2
+		output := explain(info)
+		assert := assert.New(t)
+		assert.Equal(int64(2), output.AllowCount)
+		assert.Len(output.Candidates, 2)
+		for _, c := range output.Candidates {
+			assert.True(c.Fit, "candidate %s should fit", c.Id)
+			assert.Equal(c.Id == "host02", c.WhatIf)
+		}
+		// host02 has much more free memory after overlay
+		assert.Equal("host02", output.Candidates[0].Id)
+	})
+}
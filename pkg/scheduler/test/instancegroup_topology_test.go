@@ -0,0 +1,209 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"yunion.io/x/pkg/tristate"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	apisdu "yunion.io/x/onecloud/pkg/apis/scheduler"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	predicateguest "yunion.io/x/onecloud/pkg/scheduler/algorithm/predicates/guest"
+	priorityguest "yunion.io/x/onecloud/pkg/scheduler/algorithm/priorities/guest"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+	schmodels "yunion.io/x/onecloud/pkg/scheduler/models"
+	"yunion.io/x/onecloud/pkg/scheduler/test/mock"
+)
+
+type sTopologyHost struct {
+	id      string
+	zone    string
+	rack    string
+	members map[string]int
+}
+
+func buildTopologyCandidate(ctrl *gomock.Controller, h sTopologyHost) core.Candidater {
+	cg := mock.NewMockCandidatePropertyGetter(ctrl)
+	cg.EXPECT().Id().AnyTimes().Return(h.id)
+	cg.EXPECT().Zone().AnyTimes().Return(buildZone(h.zone, h.zone))
+	metadata := map[string]string{}
+	if len(h.rack) > 0 {
+		metadata["rack"] = h.rack
+	}
+	cg.EXPECT().HostMetadata().AnyTimes().Return(metadata)
+	groups := make(map[string]*api.CandidateGroup)
+	for id, cnt := range h.members {
+		groups[id] = &api.CandidateGroup{ReferCount: cnt}
+	}
+	cg.EXPECT().InstanceGroups().AnyTimes().Return(groups)
+	cg.EXPECT().GetPendingUsage().AnyTimes().Return(&schmodels.SPendingUsage{})
+	cn := mock.NewMockCandidater(ctrl)
+	cn.EXPECT().Getter().AnyTimes().Return(cg)
+	cn.EXPECT().IndexKey().AnyTimes().Return(h.id)
+	return cn
+}
+
+func buildTopologyGroup(id, affinity, topologyKey string, force bool, maxSkew int) *models.SGroup {
+	group := &models.SGroup{}
+	group.Id = id
+	group.Name = id
+	group.Granularity = 1
+	group.ForceDispersion = tristate.NewFromBool(force)
+	group.Affinity = affinity
+	group.TopologyKey = topologyKey
+	group.Weight = computeapi.INSTANCE_GROUP_WEIGHT_DEFAULT
+	group.MaxSkew = maxSkew
+	return group
+}
+
+func buildTopologyUnit(groups ...*models.SGroup) *core.Unit {
+	info := &api.SchedInfo{
+		ScheduleInput:        &apisdu.ScheduleInput{},
+		InstanceGroupsDetail: make(map[string]*models.SGroup),
+	}
+	for _, group := range groups {
+		info.InstanceGroupsDetail[group.Id] = group
+	}
+	return core.NewScheduleUnit(info, nil)
+}
+
+func TestGroupPredicate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	hosts := []sTopologyHost{
+		{id: "host1", zone: "zone1", rack: "rack1", members: map[string]int{"group": 1}},
+		{id: "host2", zone: "zone1", rack: "rack1"},
+		{id: "host3", zone: "zone2", rack: "rack2"},
+		{id: "host4", zone: "zone2"},
+	}
+	cs := make([]core.Candidater, 0, len(hosts))
+	for _, h := range hosts {
+		cs = append(cs, buildTopologyCandidate(ctrl, h))
+	}
+
+	cases := []struct {
+		name  string
+		group *models.SGroup
+		fits  []string
+	}{
+		{
+			name:  "hard anti-affinity on rack",
+			group: buildTopologyGroup("group", computeapi.INSTANCE_GROUP_ANTI_AFFINITY, "rack", true, 0),
+			fits:  []string{"host3"},
+		},
+		{
+			name:  "hard affinity on zone",
+			group: buildTopologyGroup("group", computeapi.INSTANCE_GROUP_AFFINITY, computeapi.INSTANCE_GROUP_TOPOLOGY_ZONE, true, 0),
+			fits:  []string{"host1", "host2"},
+		},
+		{
+			name:  "hard affinity on host",
+			group: buildTopologyGroup("group", computeapi.INSTANCE_GROUP_AFFINITY, computeapi.INSTANCE_GROUP_TOPOLOGY_HOST, true, 0),
+			fits:  []string{"host1"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			u := buildTopologyUnit(c.group)
+			p := (&predicateguest.GroupPredicate{}).Clone()
+			ok, err := p.PreExecute(context.Background(), u, cs)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			fits := make([]string, 0)
+			for _, candi := range cs {
+				fit, _, err := p.Execute(context.Background(), u, candi)
+				assert.NoError(t, err)
+				if fit {
+					fits = append(fits, candi.IndexKey())
+				}
+			}
+			assert.Equal(t, c.fits, fits)
+		})
+	}
+
+	t.Run("soft and host anti-affinity groups are skipped", func(t *testing.T) {
+		u := buildTopologyUnit(
+			buildTopologyGroup("soft", computeapi.INSTANCE_GROUP_ANTI_AFFINITY, "rack", false, 0),
+			buildTopologyGroup("host", computeapi.INSTANCE_GROUP_ANTI_AFFINITY, computeapi.INSTANCE_GROUP_TOPOLOGY_HOST, true, 0),
+		)
+		p := (&predicateguest.GroupPredicate{}).Clone()
+		ok, err := p.PreExecute(context.Background(), u, cs)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func topologyScores(t *testing.T, p core.Priority, u *core.Unit, cs []core.Candidater) map[string]int {
+	ok, _, err := p.PreExecute(u, cs)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ret := make(map[string]int)
+	for _, c := range cs {
+		_, err := p.Map(u, c)
+		assert.NoError(t, err)
+		ret[c.IndexKey()] = u.GetScore(c.IndexKey()).NormalScore()
+	}
+	return ret
+}
+
+func TestGroupAffinityPriority(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cs := []core.Candidater{
+		buildTopologyCandidate(ctrl, sTopologyHost{id: "host1", zone: "zone1", rack: "rack1", members: map[string]int{"group": 2}}),
+		buildTopologyCandidate(ctrl, sTopologyHost{id: "host2", zone: "zone1", rack: "rack1"}),
+		buildTopologyCandidate(ctrl, sTopologyHost{id: "host3", zone: "zone1", rack: "rack2"}),
+	}
+
+	u := buildTopologyUnit(buildTopologyGroup("group", computeapi.INSTANCE_GROUP_ANTI_AFFINITY, "rack", false, 0))
+	assert.Equal(t, map[string]int{"host1": -20, "host2": -20, "host3": 0},
+		topologyScores(t, (&priorityguest.GroupAffinityPriority{}).Clone(), u, cs))
+
+	u = buildTopologyUnit(buildTopologyGroup("group", computeapi.INSTANCE_GROUP_AFFINITY, "rack", false, 0))
+	assert.Equal(t, map[string]int{"host1": 10, "host2": 10, "host3": 0},
+		topologyScores(t, (&priorityguest.GroupAffinityPriority{}).Clone(), u, cs))
+}
+
+func TestTopologySpreadPriority(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// rack1: 2, rack2: 1, rack3: 0, host5 has no rack
+	cs := []core.Candidater{
+		buildTopologyCandidate(ctrl, sTopologyHost{id: "host1", zone: "zone1", rack: "rack1", members: map[string]int{"db": 2}}),
+		buildTopologyCandidate(ctrl, sTopologyHost{id: "host2", zone: "zone1", rack: "rack2", members: map[string]int{"db": 1}}),
+		buildTopologyCandidate(ctrl, sTopologyHost{id: "host3", zone: "zone1", rack: "rack2"}),
+		buildTopologyCandidate(ctrl, sTopologyHost{id: "host4", zone: "zone1", rack: "rack3"}),
+		buildTopologyCandidate(ctrl, sTopologyHost{id: "host5", zone: "zone1"}),
+	}
+
+	u := buildTopologyUnit(buildTopologyGroup("db", computeapi.INSTANCE_GROUP_ANTI_AFFINITY, "rack", false, 1))
+	assert.Equal(t, map[string]int{"host1": -20, "host2": -10, "host3": -10, "host4": 20, "host5": 0},
+		topologyScores(t, (&priorityguest.TopologySpreadPriority{}).Clone(), u, cs))
+
+	// rack3 is full and filtered out, placement still works with rack2 preferred
+	u = buildTopologyUnit(buildTopologyGroup("db", computeapi.INSTANCE_GROUP_ANTI_AFFINITY, "rack", false, 1))
+	assert.Equal(t, map[string]int{"host1": -10, "host2": 10, "host3": 10},
+		topologyScores(t, (&priorityguest.TopologySpreadPriority{}).Clone(), u, cs[:3]))
+}
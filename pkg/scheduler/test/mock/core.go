@@ -409,6 +409,20 @@ func (mr *MockCandidatePropertyGetterMockRecorder) GetAllClassMetadata() *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstanceGroups", reflect.TypeOf((*MockCandidatePropertyGetter)(nil).GetAllClassMetadata))
 }
 
+// HostMetadata mocks base method
+func (m *MockCandidatePropertyGetter) HostMetadata() map[string]string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HostMetadata")
+	ret0, _ := ret[0].(map[string]string)
+	return ret0
+}
+
+// HostMetadata indicates an expected call of HostMetadata
+func (mr *MockCandidatePropertyGetterMockRecorder) HostMetadata() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HostMetadata", reflect.TypeOf((*MockCandidatePropertyGetter)(nil).HostMetadata))
+}
+
 // IsEmpty mocks base method
 func (m *MockCandidatePropertyGetter) IsEmpty() bool {
 	m.ctrl.T.Helper()
@@ -294,7 +294,7 @@ func buildInstanceGroup(id string, granularity int, force bool) *models.SGroup {
 	group.ProjectId = GlobalProject
 	group.Granularity = granularity
 	group.ForceDispersion = tristate.NewFromBool(force)
-	return nil
+	return group
 }
 
 func preSchedule(info *api.SchedInfo, candidates []core.Candidater, isForcast bool) (context.Context, *core.Unit, []core.Candidater, core.IResultHelper) {
@@ -303,6 +303,8 @@ const (
 
 	ACT_COLLECT_METRICS = "collect_metrics"
 
+	ACT_FLOW_LOG = "flow_log"
+
 	ACT_CONFIGURE            = "configure"
 	ACT_ACTIVATE             = "activate"
 	ACT_SUSPEND              = "suspend"
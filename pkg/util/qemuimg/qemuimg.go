@@ -889,6 +889,54 @@ func (img *SQemuImage) WholeChainFormatIs(format string) (bool, error) {
 	return true, nil
 }
 
+// SImageMapExtent is an extent reported by qemu-img map, Depth is the layer
+// of the backing chain the extent is allocated in, 0 for the image itself
+type SImageMapExtent struct {
+	Start  int64 `json:"start"`
+	Length int64 `json:"length"`
+	Depth  int   `json:"depth"`
+	Zero   bool  `json:"zero"`
+	Data   bool  `json:"data"`
+}
+
+// Map returns the allocation map of the image and its backing chain
+func (img *SQemuImage) Map() ([]SImageMapExtent, error) {
+	output, err := procutils.NewRemoteCommandAsFarAsPossible(qemutils.GetQemuImg(), "map", "-U", "--output", "json", img.Path).Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "qemu-img map: %s", output)
+	}
+	obj, err := jsonutils.Parse(output)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse qemu-img map output")
+	}
+	extents := make([]SImageMapExtent, 0)
+	err = obj.Unmarshal(&extents)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal qemu-img map output")
+	}
+	return extents, nil
+}
+
+// DdRaw copies count blocks of blockSize bytes starting from block skip of
+// the image content to target as raw data
+func (img *SQemuImage) DdRaw(target string, blockSize int64, skip int64, count int64) error {
+	args := []string{"-c", strconv.Itoa(int(img.IoLevel)), qemutils.GetQemuImg(), "dd",
+		"-f", img.Format.String(), "-O", qemuimgfmt.RAW.String(),
+		fmt.Sprintf("bs=%d", blockSize), fmt.Sprintf("skip=%d", skip), fmt.Sprintf("count=%d", count),
+		fmt.Sprintf("if=%s", img.Path), fmt.Sprintf("of=%s", target),
+	}
+	cmd := procutils.NewRemoteCommandAsFarAsPossible("ionice", args...)
+	if runtime.GOOS == "darwin" {
+		args = args[2:]
+		cmd = procutils.NewRemoteCommandAsFarAsPossible(args[0], args[1:]...)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return errors.Wrapf(err, "dd: %s", string(output))
+	}
+	return nil
+}
+
 func (img *SQemuImage) Check() error {
 	args := []string{"-c", strconv.Itoa(int(img.IoLevel)), qemutils.GetQemuImg(), "check"}
 	info := SImageInfo{
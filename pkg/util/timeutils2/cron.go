@@ -0,0 +1,169 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeutils2
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// CronExpr is a standard five field cron expression:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Each field accepts *, single values, ranges (a-b), steps (*/n, a-b/n)
+// and comma separated lists of them. Day of week is 0-7, both 0 and 7
+// being Sunday. As in cron, when both day of month and day of week are
+// restricted a day matches if either of them does.
+type CronExpr struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	domStar bool
+	dowStar bool
+}
+
+type cronFieldBound struct {
+	name string
+	min  int
+	max  int
+}
+
+var cronFieldBounds = []cronFieldBound{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func ParseCronExpr(expr string) (*CronExpr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFieldBounds) {
+		return nil, errors.Errorf("cron expression %q should have %d fields", expr, len(cronFieldBounds))
+	}
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFieldBounds[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "cron expression %q", expr)
+		}
+		bits[i] = b
+	}
+	c := &CronExpr{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	// 7 is another name of Sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseCronField(field string, bound cronFieldBound) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangeStr, step := part, 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			rangeStr = part[:idx]
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, errors.Errorf("invalid step %q of %s", part, bound.name)
+			}
+			step = n
+		}
+		start, end := bound.min, bound.max
+		if rangeStr != "*" {
+			var err error
+			if idx := strings.Index(rangeStr, "-"); idx >= 0 {
+				start, err = strconv.Atoi(rangeStr[:idx])
+				if err == nil {
+					end, err = strconv.Atoi(rangeStr[idx+1:])
+				}
+			} else {
+				start, err = strconv.Atoi(rangeStr)
+				end = start
+				if step > 1 {
+					end = bound.max
+				}
+			}
+			if err != nil {
+				return 0, errors.Errorf("invalid %s %q", bound.name, part)
+			}
+		}
+		if start < bound.min || end > bound.max || start > end {
+			return 0, errors.Errorf("%s %q out of range [%d, %d]", bound.name, part, bound.min, bound.max)
+		}
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func hasBit(bits uint64, i int) bool {
+	return bits&(1<<uint(i)) != 0
+}
+
+func (c *CronExpr) matchDay(t time.Time) bool {
+	if !hasBit(c.month, int(t.Month())) {
+		return false
+	}
+	domMatch := hasBit(c.dom, t.Day())
+	dowMatch := hasBit(c.dow, int(t.Weekday()))
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Match tells whether the minute of t is scheduled, in the location of t
+func (c *CronExpr) Match(t time.Time) bool {
+	return c.matchDay(t) && hasBit(c.hour, t.Hour()) && hasBit(c.minute, t.Minute())
+}
+
+// Prev returns the latest scheduled minute not after t and not before
+// since, in the location of t
+func (c *CronExpr) Prev(t time.Time, since time.Time) (time.Time, bool) {
+	loc := t.Location()
+	cur := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	for !cur.Before(since) {
+		if !c.matchDay(cur) {
+			cur = time.Date(cur.Year(), cur.Month(), cur.Day(), 0, 0, 0, 0, loc).Add(-time.Minute)
+			continue
+		}
+		if !hasBit(c.hour, cur.Hour()) {
+			cur = time.Date(cur.Year(), cur.Month(), cur.Day(), cur.Hour(), 0, 0, 0, loc).Add(-time.Minute)
+			continue
+		}
+		if hasBit(c.minute, cur.Minute()) {
+			return cur, true
+		}
+		cur = cur.Add(-time.Minute)
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeutils2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronExpr(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatalf("parse %s: %v", s, err)
+		}
+		return tm
+	}
+	cases := []struct {
+		expr  string
+		now   string
+		since string
+		prev  string
+		found bool
+	}{
+		// every Sunday at 02:00, 2024-03-10 is a Sunday
+		{"0 2 * * 0", "2024-03-10 03:30", "2024-03-09 00:00", "2024-03-10 02:00", true},
+		{"0 2 * * 7", "2024-03-10 03:30", "2024-03-09 00:00", "2024-03-10 02:00", true},
+		{"0 2 * * 0", "2024-03-10 01:59", "2024-03-09 00:00", "", false},
+		{"*/15 9-17 * * 1-5", "2024-03-11 10:44", "2024-03-11 00:00", "2024-03-11 10:30", true},
+		// day of month OR day of week
+		{"30 23 1 * 5", "2024-03-02 00:10", "2024-03-01 00:00", "2024-03-01 23:30", true},
+		{"0 0 1 1 *", "2024-06-01 00:00", "2023-12-01 00:00", "2024-01-01 00:00", true},
+	}
+	for _, c := range cases {
+		expr, err := ParseCronExpr(c.expr)
+		if err != nil {
+			t.Fatalf("ParseCronExpr %q: %v", c.expr, err)
+		}
+		prev, found := expr.Prev(at(c.now), at(c.since))
+		if found != c.found {
+			t.Errorf("%q Prev(%s) found %v", c.expr, c.now, found)
+			continue
+		}
+		if found && !prev.Equal(at(c.prev)) {
+			t.Errorf("%q Prev(%s) = %s, want %s", c.expr, c.now, prev, c.prev)
+		}
+		if found && !expr.Match(prev) {
+			t.Errorf("%q should match %s", c.expr, prev)
+		}
+	}
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "* 5-3 * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseCronExpr(expr); err == nil {
+			t.Errorf("%q should be invalid", expr)
+		}
+	}
+}
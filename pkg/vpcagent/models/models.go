@@ -31,6 +31,8 @@ type Vpc struct {
 
 	Wire     *Wire    `json:"-"`
 	Networks Networks `json:"-"`
+
+	FlowLogs FlowLogs `json:"-"`
 }
 
 func (el *Vpc) Copy() *Vpc {
@@ -72,6 +74,8 @@ type Network struct {
 	Groupnetworks        Groupnetworks        `json:"-"`
 	LoadbalancerNetworks LoadbalancerNetworks `json:"-"`
 	Elasticips           Elasticips           `json:"-"`
+	NetworkAcl           *NetworkAcl          `json:"-"`
+	QosPolicy            *QosPolicy           `json:"-"`
 }
 
 func (el *Network) Copy() *Network {
@@ -88,6 +92,7 @@ type Guestnetwork struct {
 	Network   *Network         `json:"-"`
 	Elasticip *Elasticip       `json:"-"`
 	SubIPs    NetworkAddresses `json:"-"`
+	QosPolicy *QosPolicy       `json:"-"`
 }
 
 func (el *Guestnetwork) Copy() *Guestnetwork {
@@ -230,6 +235,7 @@ type Elasticip struct {
 	Guestnetwork        *Guestnetwork        `json:"-"`
 	Groupnetwork        *Groupnetwork        `json:"-"`
 	LoadbalancerNetwork *LoadbalancerNetwork `json:"-"`
+	QosPolicy           *QosPolicy           `json:"-"`
 }
 
 func (el *Elasticip) Copy() *Elasticip {
@@ -238,6 +244,38 @@ func (el *Elasticip) Copy() *Elasticip {
 	}
 }
 
+type FlowLog struct {
+	compute_models.SFlowLog
+
+	Vpc *Vpc `json:"-"`
+}
+
+func (el *FlowLog) Copy() *FlowLog {
+	return &FlowLog{
+		SFlowLog: el.SFlowLog,
+	}
+}
+
+type NetworkAcl struct {
+	compute_models.SNetworkAcl
+}
+
+func (el *NetworkAcl) Copy() *NetworkAcl {
+	return &NetworkAcl{
+		SNetworkAcl: el.SNetworkAcl,
+	}
+}
+
+type QosPolicy struct {
+	compute_models.SQosPolicy
+}
+
+func (el *QosPolicy) Copy() *QosPolicy {
+	return &QosPolicy{
+		SQosPolicy: el.SQosPolicy,
+	}
+}
+
 type DnsRecord struct {
 	compute_models.SDnsRecord
 
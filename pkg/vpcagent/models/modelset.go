@@ -47,6 +47,12 @@ type (
 
 	RouteTables map[string]*RouteTable
 
+	FlowLogs map[string]*FlowLog
+
+	NetworkAcls map[string]*NetworkAcl
+
+	QosPolicies map[string]*QosPolicy
+
 	Groupguests   map[string]*Groupguest
 	Groupnetworks map[string]*Groupnetwork
 	Groups        map[string]*Group
@@ -125,6 +131,23 @@ func (ms Vpcs) joinRouteTables(subEntries RouteTables) bool {
 	return correct
 }
 
+func (ms Vpcs) joinFlowLogs(subEntries FlowLogs) bool {
+	for _, m := range ms {
+		m.FlowLogs = FlowLogs{}
+	}
+	for _, subEntry := range subEntries {
+		vpcId := subEntry.VpcId
+		m, ok := ms[vpcId]
+		if !ok {
+			// flow logs of vpcs not managed by us, or of vpcs being deleted
+			continue
+		}
+		subEntry.Vpc = m
+		m.FlowLogs[subEntry.Id] = subEntry
+	}
+	return true
+}
+
 func (ms Vpcs) joinNetworks(subEntries Networks) bool {
 	for _, m := range ms {
 		m.Networks = Networks{}
@@ -414,6 +437,28 @@ func (ms Networks) joinGuestnetworks(subEntries Guestnetworks) bool {
 	return true
 }
 
+func (ms Networks) joinNetworkAcls(subEntries NetworkAcls) bool {
+	for _, m := range ms {
+		m.NetworkAcl = nil
+		if m.NetworkAclId == "" {
+			continue
+		}
+		// acl could be missing if it was just deleted; treat the network
+		// as having no acl in that case
+		if subEntry, ok := subEntries[m.NetworkAclId]; ok {
+			m.NetworkAcl = subEntry
+		}
+	}
+	return true
+}
+
+func (ms Networks) joinQosPolicies(subEntries QosPolicies) bool {
+	for _, m := range ms {
+		m.QosPolicy = subEntries.get(m.QosPolicyId)
+	}
+	return true
+}
+
 func (ms Networks) joinLoadbalancerNetworks(subEntries LoadbalancerNetworks) bool {
 	for _, m := range ms {
 		m.LoadbalancerNetworks = LoadbalancerNetworks{}
@@ -527,6 +572,13 @@ func (set Guestnetworks) joinGuests(subEntries Guests) bool {
 	return true
 }
 
+func (set Guestnetworks) joinQosPolicies(subEntries QosPolicies) bool {
+	for _, gn := range set {
+		gn.QosPolicy = subEntries.get(gn.QosPolicyId)
+	}
+	return true
+}
+
 func (set Guestnetworks) joinElasticips(subEntries Elasticips) bool {
 	correct := true
 	for _, gn := range set {
@@ -870,6 +922,100 @@ func (set RouteTables) Copy() apihelper.IModelSet {
 	return setCopy
 }
 
+func (set FlowLogs) ModelManager() mcclient_modulebase.IBaseManager {
+	return &mcclient_modules.FlowLogs
+}
+
+func (set FlowLogs) DBModelManager() db.IModelManager {
+	return models.FlowLogManager
+}
+
+func (set FlowLogs) NewModel() db.IModel {
+	return &FlowLog{}
+}
+
+func (set FlowLogs) AddModel(i db.IModel) {
+	m := i.(*FlowLog)
+	set[m.Id] = m
+}
+
+func (set FlowLogs) Copy() apihelper.IModelSet {
+	setCopy := FlowLogs{}
+	for id, el := range set {
+		setCopy[id] = el.Copy()
+	}
+	return setCopy
+}
+
+func (set NetworkAcls) ModelManager() mcclient_modulebase.IBaseManager {
+	return &mcclient_modules.NetworkAcls
+}
+
+func (set NetworkAcls) DBModelManager() db.IModelManager {
+	return models.NetworkAclManager
+}
+
+func (set NetworkAcls) NewModel() db.IModel {
+	return &NetworkAcl{}
+}
+
+func (set NetworkAcls) AddModel(i db.IModel) {
+	m := i.(*NetworkAcl)
+	set[m.Id] = m
+}
+
+func (set NetworkAcls) Copy() apihelper.IModelSet {
+	setCopy := NetworkAcls{}
+	for id, el := range set {
+		setCopy[id] = el.Copy()
+	}
+	return setCopy
+}
+
+func (set QosPolicies) ModelManager() mcclient_modulebase.IBaseManager {
+	return &mcclient_modules.QosPolicies
+}
+
+func (set QosPolicies) DBModelManager() db.IModelManager {
+	return models.QosPolicyManager
+}
+
+func (set QosPolicies) NewModel() db.IModel {
+	return &QosPolicy{}
+}
+
+func (set QosPolicies) AddModel(i db.IModel) {
+	m := i.(*QosPolicy)
+	set[m.Id] = m
+}
+
+func (set QosPolicies) Copy() apihelper.IModelSet {
+	setCopy := QosPolicies{}
+	for id, el := range set {
+		setCopy[id] = el.Copy()
+	}
+	return setCopy
+}
+
+// get returns nil for empty id, or when the policy is disabled or was just
+// deleted, in which case no qos policy takes effect
+func (set QosPolicies) get(id string) *QosPolicy {
+	if id == "" {
+		return nil
+	}
+	if m, ok := set[id]; ok && m.GetEnabled() {
+		return m
+	}
+	return nil
+}
+
+func (set Elasticips) joinQosPolicies(subEntries QosPolicies) bool {
+	for _, eip := range set {
+		eip.QosPolicy = subEntries.get(eip.QosPolicyId)
+	}
+	return true
+}
+
 func (set Groupguests) ModelManager() mcclient_modulebase.IBaseManager {
 	return &mcclient_modules.InstanceGroupGuests
 }
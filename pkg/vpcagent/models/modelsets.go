@@ -44,6 +44,12 @@ type ModelSetsMaxUpdatedAt struct {
 
 	RouteTables time.Time
 
+	FlowLogs time.Time
+
+	NetworkAcls time.Time
+
+	QosPolicies time.Time
+
 	Groupguests   time.Time
 	Groupnetworks time.Time
 
@@ -71,6 +77,12 @@ func NewModelSetsMaxUpdatedAt() *ModelSetsMaxUpdatedAt {
 
 		RouteTables: apihelper.PseudoZeroTime,
 
+		FlowLogs: apihelper.PseudoZeroTime,
+
+		NetworkAcls: apihelper.PseudoZeroTime,
+
+		QosPolicies: apihelper.PseudoZeroTime,
+
 		Groupguests:   apihelper.PseudoZeroTime,
 		Groupnetworks: apihelper.PseudoZeroTime,
 
@@ -98,6 +110,12 @@ type ModelSets struct {
 
 	RouteTables RouteTables
 
+	FlowLogs FlowLogs
+
+	NetworkAcls NetworkAcls
+
+	QosPolicies QosPolicies
+
 	Groupguests   Groupguests
 	Groupnetworks Groupnetworks
 	Groups        Groups
@@ -126,6 +144,12 @@ func NewModelSets() *ModelSets {
 
 		RouteTables: RouteTables{},
 
+		FlowLogs: FlowLogs{},
+
+		NetworkAcls: NetworkAcls{},
+
+		QosPolicies: QosPolicies{},
+
 		Groupguests:   Groupguests{},
 		Groupnetworks: Groupnetworks{},
 		Groups:        Groups{},
@@ -156,6 +180,10 @@ func (mss *ModelSets) ModelSetList() []apihelper.IModelSet {
 
 		mss.RouteTables,
 
+		mss.FlowLogs,
+		mss.NetworkAcls,
+		mss.QosPolicies,
+
 		mss.Groupguests,
 		mss.Groupnetworks,
 		mss.Groups,
@@ -189,6 +217,12 @@ func (mss *ModelSets) copy_() *ModelSets {
 
 		RouteTables: mss.RouteTables.Copy().(RouteTables),
 
+		FlowLogs: mss.FlowLogs.Copy().(FlowLogs),
+
+		NetworkAcls: mss.NetworkAcls.Copy().(NetworkAcls),
+
+		QosPolicies: mss.QosPolicies.Copy().(QosPolicies),
+
 		Groupguests:   mss.Groupguests.Copy().(Groupguests),
 		Groupnetworks: mss.Groupnetworks.Copy().(Groupnetworks),
 		Groups:        mss.Groups.Copy().(Groups),
@@ -251,6 +285,8 @@ func (mss *ModelSets) join() bool {
 	msg = append(msg, "mss.Vpcs.joinWires(mss.Wires)")
 	p = append(p, mss.Vpcs.joinRouteTables(mss.RouteTables))
 	msg = append(msg, "mss.Vpcs.joinRouteTables(mss.RouteTables)")
+	p = append(p, mss.Vpcs.joinFlowLogs(mss.FlowLogs))
+	msg = append(msg, "mss.Vpcs.joinFlowLogs(mss.FlowLogs)")
 	p = append(p, mss.Wires.joinNetworks(mss.Networks))
 	msg = append(msg, "mss.Wires.joinNetworks(mss.Networks)")
 	p = append(p, mss.Vpcs.joinNetworks(mss.Networks))
@@ -263,6 +299,10 @@ func (mss *ModelSets) join() bool {
 	msg = append(msg, "mss.Networks.joinLoadbalancerNetworks(mss.LoadbalancerNetworks)")
 	p = append(p, mss.Networks.joinElasticips(mss.Elasticips))
 	msg = append(msg, "mss.Networks.joinElasticips(mss.Elasticips)")
+	p = append(p, mss.Networks.joinNetworkAcls(mss.NetworkAcls))
+	msg = append(msg, "mss.Networks.joinNetworkAcls(mss.NetworkAcls)")
+	p = append(p, mss.Networks.joinQosPolicies(mss.QosPolicies))
+	msg = append(msg, "mss.Networks.joinQosPolicies(mss.QosPolicies)")
 	p = append(p, mss.Guests.joinHosts(mss.Hosts))
 	msg = append(msg, "mss.Guests.joinHosts(mss.Hosts)")
 	p = append(p, mss.Guests.joinSecurityGroups(mss.SecurityGroups))
@@ -277,6 +317,10 @@ func (mss *ModelSets) join() bool {
 	msg = append(msg, "mss.Guestnetworks.joinGuests(mss.Guests)")
 	p = append(p, mss.Guestnetworks.joinElasticips(mss.Elasticips))
 	msg = append(msg, "mss.Guestnetworks.joinElasticips(mss.Elasticips)")
+	p = append(p, mss.Guestnetworks.joinQosPolicies(mss.QosPolicies))
+	msg = append(msg, "mss.Guestnetworks.joinQosPolicies(mss.QosPolicies)")
+	p = append(p, mss.Elasticips.joinQosPolicies(mss.QosPolicies))
+	msg = append(msg, "mss.Elasticips.joinQosPolicies(mss.QosPolicies)")
 	p = append(p, mss.Guestnetworks.joinNetworkAddresses(mss.NetworkAddresses))
 	msg = append(msg, "mss.Guestnetworks.joinNetworkAddresses(mss.NetworkAddresses)")
 	p = append(p, mss.Groups.joinGroupnetworks(mss.Groupnetworks, mss.Networks))
@@ -0,0 +1,107 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"fmt"
+
+	"yunion.io/x/ovsdb/schema/ovn_nb"
+
+	apis "yunion.io/x/onecloud/pkg/apis/compute"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+)
+
+const (
+	flowLogAclSeverity = "info"
+	flowLogMeterUnit   = "pktps"
+)
+
+// guestnetworkFlowLog returns the enabled flow log covering the guest nic.
+// The most specific one wins: vnic, then network, then vpc
+func guestnetworkFlowLog(guestnetwork *agentmodels.Guestnetwork) *agentmodels.FlowLog {
+	vpc := guestnetwork.Network.Vpc
+	var (
+		found *agentmodels.FlowLog
+		rank  int
+	)
+	for _, fl := range vpc.FlowLogs {
+		if !fl.Enabled.Bool() {
+			continue
+		}
+		r := 0
+		switch fl.ResourceType {
+		case apis.FlowLogResourceGuestNic:
+			if fl.GuestId == guestnetwork.GuestId && fl.MacAddr == guestnetwork.MacAddr {
+				r = 3
+			}
+		case apis.FlowLogResourceNetwork:
+			if fl.NetworkId == guestnetwork.NetworkId {
+				r = 2
+			}
+		case apis.FlowLogResourceVpc:
+			r = 1
+		}
+		if r == 0 {
+			continue
+		}
+		if r > rank || (r == rank && fl.Id < found.Id) {
+			found = fl
+			rank = r
+		}
+	}
+	return found
+}
+
+// flowLogAclName is what ovn-controller prints as name= in acl_log lines.
+// It must be within 63 characters
+func flowLogAclName(fl *agentmodels.FlowLog) string {
+	return apis.FlowLogAclNamePrefix + fl.Id
+}
+
+// flowLogMeterName encodes rate limit so that a change of it results in a
+// new meter, and acls referring to it
+func flowLogMeterName(fl *agentmodels.FlowLog) string {
+	return fmt.Sprintf("%s%s-%d", apis.FlowLogAclNamePrefix, fl.Id, fl.RateLimit)
+}
+
+// flowLogAclRefSuffix is appended to oc-ref of acls so that toggling flow
+// log settings will not match acls created with previous settings
+func flowLogAclRefSuffix(fl *agentmodels.FlowLog) string {
+	if fl == nil {
+		return ""
+	}
+	return fmt.Sprintf("/flowlog/%s/%s/%d", fl.Id, fl.TrafficType, fl.RateLimit)
+}
+
+func flowLogMatchAcl(fl *agentmodels.FlowLog, acl *ovn_nb.ACL) bool {
+	switch fl.TrafficType {
+	case apis.FlowLogTrafficAccept:
+		return acl.Action == "allow" || acl.Action == "allow-related"
+	case apis.FlowLogTrafficReject:
+		return acl.Action == "drop" || acl.Action == "reject"
+	default:
+		return true
+	}
+}
+
+func flowLogApplyAcl(fl *agentmodels.FlowLog, acl *ovn_nb.ACL) {
+	if fl == nil || !flowLogMatchAcl(fl, acl) {
+		return
+	}
+	acl.Log = true
+	acl.Name = ptr(flowLogAclName(fl))
+	acl.Severity = ptr(flowLogAclSeverity)
+	acl.Meter = ptr(flowLogMeterName(fl))
+}
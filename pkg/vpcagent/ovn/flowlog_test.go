@@ -0,0 +1,111 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"testing"
+
+	"yunion.io/x/ovsdb/schema/ovn_nb"
+	"yunion.io/x/pkg/tristate"
+
+	apis "yunion.io/x/onecloud/pkg/apis/compute"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+)
+
+func newTestFlowLog(id, resType string, enabled bool) *agentmodels.FlowLog {
+	fl := &agentmodels.FlowLog{}
+	fl.Id = id
+	fl.ResourceType = resType
+	fl.Enabled = tristate.NewFromBool(enabled)
+	fl.TrafficType = apis.FlowLogTrafficAll
+	fl.RateLimit = apis.FlowLogDefaultRateLimit
+	return fl
+}
+
+func TestGuestnetworkFlowLog(t *testing.T) {
+	vpc := &agentmodels.Vpc{}
+	network := &agentmodels.Network{Vpc: vpc}
+	network.Id = "net0"
+	gn := &agentmodels.Guestnetwork{Network: network}
+	gn.GuestId = "guest0"
+	gn.NetworkId = "net0"
+	gn.MacAddr = "00:22:11:00:00:01"
+
+	flVpc := newTestFlowLog("fl-vpc", apis.FlowLogResourceVpc, true)
+	flNet := newTestFlowLog("fl-net", apis.FlowLogResourceNetwork, true)
+	flNet.NetworkId = "net0"
+	flOtherNet := newTestFlowLog("fl-net1", apis.FlowLogResourceNetwork, true)
+	flOtherNet.NetworkId = "net1"
+	flNic := newTestFlowLog("fl-nic", apis.FlowLogResourceGuestNic, false)
+	flNic.GuestId = "guest0"
+	flNic.NetworkId = "net0"
+	flNic.MacAddr = gn.MacAddr
+
+	cases := []struct {
+		name     string
+		flowLogs []*agentmodels.FlowLog
+		want     *agentmodels.FlowLog
+	}{
+		{"none", nil, nil},
+		{"vpc", []*agentmodels.FlowLog{flVpc, flOtherNet}, flVpc},
+		{"network over vpc", []*agentmodels.FlowLog{flVpc, flNet}, flNet},
+		{"disabled nic", []*agentmodels.FlowLog{flVpc, flNet, flNic}, flNet},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			vpc.FlowLogs = agentmodels.FlowLogs{}
+			for _, fl := range c.flowLogs {
+				vpc.FlowLogs[fl.Id] = fl
+			}
+			if got := guestnetworkFlowLog(gn); got != c.want {
+				t.Errorf("want %v, got %v", c.want, got)
+			}
+		})
+	}
+
+	flNic.Enabled = tristate.True
+	vpc.FlowLogs[flNic.Id] = flNic
+	if got := guestnetworkFlowLog(gn); got != flNic {
+		t.Errorf("want nic flow log, got %v", got)
+	}
+}
+
+func TestFlowLogApplyAcl(t *testing.T) {
+	fl := newTestFlowLog("4c5bd4f0-aa2c-4e6e-8a55-1a1a4e0f5b7e", apis.FlowLogResourceVpc, true)
+	fl.TrafficType = apis.FlowLogTrafficReject
+
+	allow := &ovn_nb.ACL{Action: "allow-related"}
+	drop := &ovn_nb.ACL{Action: "drop"}
+	flowLogApplyAcl(fl, allow)
+	flowLogApplyAcl(fl, drop)
+	if allow.Log || allow.Name != nil {
+		t.Errorf("allow acl should not be logged for reject traffic")
+	}
+	if !drop.Log {
+		t.Fatalf("drop acl should be logged")
+	}
+	if name := *drop.Name; len(name) > 63 || name != "fl-"+fl.Id {
+		t.Errorf("bad acl name %q", name)
+	}
+	if meter := *drop.Meter; meter != "fl-"+fl.Id+"-100" {
+		t.Errorf("bad meter name %q", meter)
+	}
+
+	none := &ovn_nb.ACL{Action: "drop"}
+	flowLogApplyAcl(nil, none)
+	if none.Log {
+		t.Errorf("acl should not be logged without flow log")
+	}
+}
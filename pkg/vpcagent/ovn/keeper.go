@@ -56,10 +56,12 @@ func DumpOVNNorthbound(ctx context.Context, cli *ovnutil.OvnNbCtl) (*OVNNorthbou
 		&db.LogicalRouter,
 		&db.LogicalRouterPort,
 		&db.LogicalRouterStaticRoute,
+		&db.LogicalRouterPolicy,
 		&db.ACL,
 		&db.DHCPOptions,
 		&db.QoS,
 		&db.DNS,
+		&db.Meter,
 	}
 	args := []string{"--format=json", "list", "<tbl>"}
 	for _, itbl := range itbls {
@@ -381,6 +383,42 @@ func (keeper *OVNNorthboundKeeper) ClaimNetwork(ctx context.Context, network *ag
 	return keeper.cli.Must(ctx, "ClaimNetwork", args)
 }
 
+func (keeper *OVNNorthboundKeeper) ClaimNetworkAcl(ctx context.Context, network *agentmodels.Network) error {
+	nacl := network.NetworkAcl
+	if nacl == nil || !nacl.Enabled.Bool() {
+		return nil
+	}
+	var (
+		rules     apis.SNetworkAclRules
+		ocAclRef  = fmt.Sprintf("nacl/%s/%s", network.Id, nacl.Id)
+		ocVersion = fmt.Sprintf("%s.%d", nacl.UpdatedAt, nacl.UpdateVersion)
+	)
+	if nacl.Rules != nil {
+		rules = *nacl.Rules
+	}
+	acls, err := networkAclToAcls(netNrpName(network.Id), rules, network.GuestIp6Start != "")
+	if err != nil {
+		return errors.Wrapf(err, "network acl %s(%s)", nacl.Name, nacl.Id)
+	}
+	irows := make([]types.IRow, 0, len(acls))
+	for _, acl := range acls {
+		acl.ExternalIds = map[string]string{
+			externalKeyOcRef: ocAclRef,
+		}
+		irows = append(irows, acl)
+	}
+	allFound, args := cmp(&keeper.DB, ocVersion, irows...)
+	if allFound {
+		return nil
+	}
+	for i, acl := range acls {
+		ref := fmt.Sprintf("nacl%d", i)
+		args = append(args, ovnCreateArgs(acl, ref)...)
+		args = append(args, "--", "add", "Logical_Switch", netLsName(network.Id), "acls", "@"+ref)
+	}
+	return keeper.cli.Must(ctx, "ClaimNetworkAcl", args)
+}
+
 func (keeper *OVNNorthboundKeeper) ClaimVpcHost(ctx context.Context, vpc *agentmodels.Vpc, host *agentmodels.Host) error {
 	var (
 		ocVersion = fmt.Sprintf("%s.%d", host.UpdatedAt, host.UpdateVersion)
@@ -643,36 +681,19 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 	}
 
 	var qosVif []*ovn_nb.QoS
-	if bwMbps := guestnetwork.BwLimit; bwMbps > 0 {
-		var (
-			kbps = int64(bwMbps * 1000)
-			kbur = int64(kbps * 2)
-		)
-		qosVif = []*ovn_nb.QoS{
-			{
-				Priority:  2000,
-				Direction: "from-lport",
-				Match:     fmt.Sprintf("inport == %q", lportName),
-				Bandwidth: map[string]int64{
-					"rate":  kbps,
-					"burst": kbur,
-				},
-				ExternalIds: map[string]string{
-					externalKeyOcRef: ocQosRef,
-				},
-			},
-			{
-				Priority:  1000,
-				Direction: "to-lport",
-				Match:     fmt.Sprintf("outport == %q", lportName),
-				Bandwidth: map[string]int64{
-					"rate":  kbps,
-					"burst": kbur,
-				},
-				ExternalIds: map[string]string{
-					externalKeyOcRef: ocQosRef,
-				},
-			},
+	if qos := guestnetworkQosSpec(guestnetwork); qos != nil {
+		rows := []*ovn_nb.QoS{
+			qosRow(2000, "from-lport",
+				fmt.Sprintf("inport == %q", lportName),
+				ocQosRef, qos.fromGuest, qos.fromGuestAction),
+			qosRow(1000, "to-lport",
+				fmt.Sprintf("outport == %q", lportName),
+				ocQosRef, qos.toGuest, nil),
+		}
+		for _, row := range rows {
+			if row != nil {
+				qosVif = append(qosVif, row)
+			}
 		}
 	}
 
@@ -680,7 +701,6 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 		gnrDefault *ovn_nb.LogicalRouterStaticRoute
 		qosEipIn   *ovn_nb.QoS
 		qosEipOut  *ovn_nb.QoS
-		hasQoSEip  bool
 	)
 	{
 		gnrDefaultPolicy := "src-ip"
@@ -694,37 +714,14 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 					externalKeyOcRef: ocGnrDefaultRef,
 				},
 			}
-			if bwMbps := eip.Bandwidth; bwMbps > 0 {
-				var (
-					kbps     = int64(bwMbps * 1000)
-					kbur     = int64(kbps * 2)
-					eipgwVip = apis.VpcEipGatewayIP3().String()
-				)
-				hasQoSEip = true
-				qosEipIn = &ovn_nb.QoS{
-					Priority:  2000,
-					Direction: "from-lport",
-					Match:     fmt.Sprintf("inport == %q && ip4 && ip4.dst == %s", vpcEipLspName(vpc.Id, eipgwVip), guestnetwork.IpAddr),
-					Bandwidth: map[string]int64{
-						"rate":  kbps,
-						"burst": kbur,
-					},
-					ExternalIds: map[string]string{
-						externalKeyOcRef: ocQosEipRef,
-					},
-				}
-				qosEipOut = &ovn_nb.QoS{
-					Priority:  3000,
-					Direction: "from-lport",
-					Match:     fmt.Sprintf("inport == %q && ip4 && ip4.src == %s", vpcErpName(vpc.Id), guestnetwork.IpAddr),
-					Bandwidth: map[string]int64{
-						"rate":  kbps,
-						"burst": kbur,
-					},
-					ExternalIds: map[string]string{
-						externalKeyOcRef: ocQosEipRef,
-					},
-				}
+			if qos := eipQosSpec(eip); qos != nil {
+				eipgwVip := apis.VpcEipGatewayIP3().String()
+				qosEipIn = qosRow(2000, "from-lport",
+					fmt.Sprintf("inport == %q && ip4 && ip4.dst == %s", vpcEipLspName(vpc.Id, eipgwVip), guestnetwork.IpAddr),
+					ocQosEipRef, qos.toGuest, nil)
+				qosEipOut = qosRow(3000, "from-lport",
+					fmt.Sprintf("inport == %q && ip4 && ip4.src == %s", vpcErpName(vpc.Id), guestnetwork.IpAddr),
+					ocQosEipRef, qos.fromGuest, qos.fromGuestAction)
 			}
 
 		} else if vpcHasDistgw(vpc) {
@@ -742,6 +739,8 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 
 	var acls []*ovn_nb.ACL
 	{
+		flowLog := guestnetworkFlowLog(guestnetwork)
+		ocAclRef += flowLogAclRefSuffix(flowLog)
 		enableIPv6 := false
 		if len(guestnetwork.Ip6Addr) > 0 {
 			enableIPv6 = true
@@ -757,6 +756,7 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 			acl.ExternalIds = map[string]string{
 				externalKeyOcRef: ocAclRef,
 			}
+			flowLogApplyAcl(flowLog, acl)
 			acls = append(acls, acl)
 		}
 	}
@@ -777,8 +777,11 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 	for _, qos := range qosVif {
 		irows = append(irows, qos)
 	}
-	if hasQoSEip {
-		irows = append(irows, qosEipIn, qosEipOut)
+	if qosEipIn != nil {
+		irows = append(irows, qosEipIn)
+	}
+	if qosEipOut != nil {
+		irows = append(irows, qosEipOut)
 	}
 	allFound, args := cmp(&keeper.DB, ocVersion, irows...)
 	if allFound {
@@ -807,15 +810,44 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 		args = append(args, ovnCreateArgs(qos, ref)...)
 		args = append(args, "--", "add", "Logical_Switch", netLsName(guestnetwork.NetworkId), "qos_rules", "@"+ref)
 	}
-	if hasQoSEip {
+	if qosEipIn != nil {
 		args = append(args, ovnCreateArgs(qosEipIn, "qosEipIn")...)
 		args = append(args, "--", "add", "Logical_Switch", vpcEipLsName(vpc.Id), "qos_rules", "@qosEipIn")
+	}
+	if qosEipOut != nil {
 		args = append(args, ovnCreateArgs(qosEipOut, "qosEipOut")...)
 		args = append(args, "--", "add", "Logical_Switch", vpcEipLsName(vpc.Id), "qos_rules", "@qosEipOut")
 	}
 	return keeper.cli.Must(ctx, "ClaimGuestnetwork", args)
 }
 
+func (keeper *OVNNorthboundKeeper) ClaimFlowLog(ctx context.Context, flowLog *agentmodels.FlowLog) error {
+	var (
+		ocVersion  = fmt.Sprintf("%s.%d", flowLog.UpdatedAt, flowLog.UpdateVersion)
+		ocMeterRef = fmt.Sprintf("meter/%s", flowLog.Id)
+		meterName  = flowLogMeterName(flowLog)
+	)
+	meter := &ovn_nb.Meter{
+		Name: meterName,
+		Unit: flowLogMeterUnit,
+		ExternalIds: map[string]string{
+			externalKeyOcRef: ocMeterRef,
+		},
+	}
+	allFound, args := cmp(&keeper.DB, ocVersion, meter)
+	if allFound {
+		return nil
+	}
+	band := &ovn_nb.MeterBand{
+		Action: "drop",
+		Rate:   int64(flowLog.RateLimit),
+	}
+	args = append(args, ovnCreateArgs(band, "band")...)
+	args = append(args, ovnCreateArgs(meter, "meter")...)
+	args = append(args, "--", "add", "Meter", meterName, "bands", "@band")
+	return keeper.cli.Must(ctx, "ClaimFlowLog", args)
+}
+
 func (keeper *OVNNorthboundKeeper) ClaimRoutes(ctx context.Context, vpc *agentmodels.Vpc, routes resolvedRoutes) error {
 	var irows []types.IRow
 	for _, route := range routes {
@@ -842,6 +874,55 @@ func (keeper *OVNNorthboundKeeper) ClaimRoutes(ctx context.Context, vpc *agentmo
 	return nil
 }
 
+// ClaimRoutePolicies makes policies of the vpc logical router match those
+// of the route table.  Logical_Router_Policy has no external_ids in the
+// schema we build against, so rows cannot be marked and swept.  They are
+// compared against what's referenced by the logical router instead and
+// recreated as a whole on any difference.  Unreferenced rows are garbage
+// collected by ovsdb
+func (keeper *OVNNorthboundKeeper) ClaimRoutePolicies(ctx context.Context, vpc *agentmodels.Vpc, policies []*resolvedRoutePolicy) error {
+	var lrps []*ovn_nb.LogicalRouterPolicy
+	for _, rp := range policies {
+		lrp, err := routePolicyToLrp(rp)
+		if err != nil {
+			log.Errorf("vpc %s(%s): %v", vpc.Name, vpc.Id, err)
+			continue
+		}
+		lrps = append(lrps, lrp)
+	}
+
+	lrName := vpcLrName(vpc.Id)
+	var lr *ovn_nb.LogicalRouter
+	for i := range keeper.DB.LogicalRouter {
+		if keeper.DB.LogicalRouter[i].Name == lrName {
+			lr = &keeper.DB.LogicalRouter[i]
+			break
+		}
+	}
+	var existing []*ovn_nb.LogicalRouterPolicy
+	if lr != nil {
+		for _, uuid := range lr.Policies {
+			for i := range keeper.DB.LogicalRouterPolicy {
+				if keeper.DB.LogicalRouterPolicy[i].Uuid == uuid {
+					existing = append(existing, &keeper.DB.LogicalRouterPolicy[i])
+					break
+				}
+			}
+		}
+	}
+	if routePoliciesEqual(existing, lrps) {
+		return nil
+	}
+
+	args := []string{"--", "clear", "Logical_Router", lrName, "policies"}
+	for i, lrp := range lrps {
+		ref := fmt.Sprintf("p%d", i)
+		args = append(args, ovnCreateArgs(lrp, ref)...)
+		args = append(args, "--", "add", "Logical_Router", lrName, "policies", "@"+ref)
+	}
+	return keeper.cli.Must(ctx, "ClaimRoutePolicies", args)
+}
+
 func (keeper *OVNNorthboundKeeper) ClaimLoadbalancerNetwork(ctx context.Context, loadbalancerNetwork *agentmodels.LoadbalancerNetwork) error {
 	var (
 		// Callers assure that loadbalancerNetwork.Network is not nil
@@ -874,7 +955,6 @@ func (keeper *OVNNorthboundKeeper) ClaimLoadbalancerNetwork(ctx context.Context,
 		lnrDefault *ovn_nb.LogicalRouterStaticRoute
 		qosEipIn   *ovn_nb.QoS
 		qosEipOut  *ovn_nb.QoS
-		hasQoSEip  bool
 	)
 	if eip != nil && vpcHasEipgw {
 		lnrDefault = &ovn_nb.LogicalRouterStaticRoute{
@@ -886,37 +966,14 @@ func (keeper *OVNNorthboundKeeper) ClaimLoadbalancerNetwork(ctx context.Context,
 				externalKeyOcRef: ocLnrDefaultRef,
 			},
 		}
-		if bwMbps := eip.Bandwidth; bwMbps > 0 {
-			var (
-				kbps     = int64(bwMbps * 1000)
-				kbur     = int64(kbps * 2)
-				eipgwVip = apis.VpcEipGatewayIP3().String()
-			)
-			hasQoSEip = true
-			qosEipIn = &ovn_nb.QoS{
-				Priority:  2000,
-				Direction: "from-lport",
-				Match:     fmt.Sprintf("inport == %q && ip4 && ip4.dst == %s", vpcEipLspName(vpcId, eipgwVip), lbIntIp),
-				Bandwidth: map[string]int64{
-					"rate":  kbps,
-					"burst": kbur,
-				},
-				ExternalIds: map[string]string{
-					externalKeyOcRef: ocQosEipRef,
-				},
-			}
-			qosEipOut = &ovn_nb.QoS{
-				Priority:  3000,
-				Direction: "from-lport",
-				Match:     fmt.Sprintf("inport == %q", lportName),
-				Bandwidth: map[string]int64{
-					"rate":  kbps,
-					"burst": kbur,
-				},
-				ExternalIds: map[string]string{
-					externalKeyOcRef: ocQosEipRef,
-				},
-			}
+		if qos := eipQosSpec(eip); qos != nil {
+			eipgwVip := apis.VpcEipGatewayIP3().String()
+			qosEipIn = qosRow(2000, "from-lport",
+				fmt.Sprintf("inport == %q && ip4 && ip4.dst == %s", vpcEipLspName(vpcId, eipgwVip), lbIntIp),
+				ocQosEipRef, qos.toGuest, nil)
+			qosEipOut = qosRow(3000, "from-lport",
+				fmt.Sprintf("inport == %q", lportName),
+				ocQosEipRef, qos.fromGuest, qos.fromGuestAction)
 		}
 	}
 	var acls []*ovn_nb.ACL
@@ -940,8 +997,11 @@ func (keeper *OVNNorthboundKeeper) ClaimLoadbalancerNetwork(ctx context.Context,
 	if lnrDefault != nil {
 		irows = append(irows, lnrDefault)
 	}
-	if hasQoSEip {
-		irows = append(irows, qosEipIn, qosEipOut)
+	if qosEipIn != nil {
+		irows = append(irows, qosEipIn)
+	}
+	if qosEipOut != nil {
+		irows = append(irows, qosEipOut)
 	}
 	for _, acl := range acls {
 		irows = append(irows, acl)
@@ -957,9 +1017,11 @@ func (keeper *OVNNorthboundKeeper) ClaimLoadbalancerNetwork(ctx context.Context,
 		args = append(args, ovnCreateArgs(lnrDefault, "lnrDefault")...)
 		args = append(args, "--", "add", "Logical_Router", vpcExtLrName(vpcId), "static_routes", "@lnrDefault")
 	}
-	if hasQoSEip {
+	if qosEipIn != nil {
 		args = append(args, ovnCreateArgs(qosEipIn, "qosEipIn")...)
 		args = append(args, "--", "add", "Logical_Switch", vpcEipLsName(vpcId), "qos_rules", "@qosEipIn")
+	}
+	if qosEipOut != nil {
 		args = append(args, ovnCreateArgs(qosEipOut, "qosEipOut")...)
 		args = append(args, "--", "add", "Logical_Switch", netLsName(networkId), "qos_rules", "@qosEipOut")
 	}
@@ -1108,7 +1170,6 @@ func (keeper *OVNNorthboundKeeper) ClaimGroupnetwork(ctx context.Context, groupn
 		gnrDefault *ovn_nb.LogicalRouterStaticRoute
 		qosEipIn   *ovn_nb.QoS
 		qosEipOut  *ovn_nb.QoS
-		hasQoSEip  bool
 	)
 	{
 		gnrDefaultPolicy := "src-ip"
@@ -1123,37 +1184,14 @@ func (keeper *OVNNorthboundKeeper) ClaimGroupnetwork(ctx context.Context, groupn
 					externalKeyOcRef: ocGnrDefaultRef,
 				},
 			}
-			if bwMbps := eip.Bandwidth; bwMbps > 0 {
-				var (
-					kbps     = int64(bwMbps * 1000)
-					kbur     = int64(kbps * 2)
-					eipgwVip = apis.VpcEipGatewayIP3().String()
-				)
-				hasQoSEip = true
-				qosEipIn = &ovn_nb.QoS{
-					Priority:  2000,
-					Direction: "from-lport",
-					Match:     fmt.Sprintf("inport == %q && ip4 && ip4.dst == %s", vpcEipLspName(vpc.Id, eipgwVip), groupnetwork.IpAddr),
-					Bandwidth: map[string]int64{
-						"rate":  kbps,
-						"burst": kbur,
-					},
-					ExternalIds: map[string]string{
-						externalKeyOcRef: ocQosEipRef,
-					},
-				}
-				qosEipOut = &ovn_nb.QoS{
-					Priority:  3000,
-					Direction: "from-lport",
-					Match:     fmt.Sprintf("inport == %q && ip4 && ip4.src == %s", vpcErpName(vpc.Id), groupnetwork.IpAddr),
-					Bandwidth: map[string]int64{
-						"rate":  kbps,
-						"burst": kbur,
-					},
-					ExternalIds: map[string]string{
-						externalKeyOcRef: ocQosEipRef,
-					},
-				}
+			if qos := eipQosSpec(eip); qos != nil {
+				eipgwVip := apis.VpcEipGatewayIP3().String()
+				qosEipIn = qosRow(2000, "from-lport",
+					fmt.Sprintf("inport == %q && ip4 && ip4.dst == %s", vpcEipLspName(vpc.Id, eipgwVip), groupnetwork.IpAddr),
+					ocQosEipRef, qos.toGuest, nil)
+				qosEipOut = qosRow(3000, "from-lport",
+					fmt.Sprintf("inport == %q && ip4 && ip4.src == %s", vpcErpName(vpc.Id), groupnetwork.IpAddr),
+					ocQosEipRef, qos.fromGuest, qos.fromGuestAction)
 			}
 		}
 	}
@@ -1178,8 +1216,11 @@ func (keeper *OVNNorthboundKeeper) ClaimGroupnetwork(ctx context.Context, groupn
 	if gnrDefault != nil {
 		irows = append(irows, gnrDefault)
 	}
-	if hasQoSEip {
-		irows = append(irows, qosEipIn, qosEipOut)
+	if qosEipIn != nil {
+		irows = append(irows, qosEipIn)
+	}
+	if qosEipOut != nil {
+		irows = append(irows, qosEipOut)
 	}
 	allFound, args := cmp(&keeper.DB, ocVersion, irows...)
 	if allFound {
@@ -1195,9 +1236,11 @@ func (keeper *OVNNorthboundKeeper) ClaimGroupnetwork(ctx context.Context, groupn
 		args = append(args, ovnCreateArgs(gnrDefault, "vipGnrDefault")...)
 		args = append(args, "--", "add", "Logical_Router", vpcExtLrName(vpc.Id), "static_routes", "@vipGnrDefault")
 	}
-	if hasQoSEip {
+	if qosEipIn != nil {
 		args = append(args, ovnCreateArgs(qosEipIn, "vipQosEipIn")...)
 		args = append(args, "--", "add", "Logical_Switch", vpcEipLsName(vpc.Id), "qos_rules", "@vipQosEipIn")
+	}
+	if qosEipOut != nil {
 		args = append(args, ovnCreateArgs(qosEipOut, "vipQosEipOut")...)
 		args = append(args, "--", "add", "Logical_Switch", vpcEipLsName(vpc.Id), "qos_rules", "@vipQosEipOut")
 	}
@@ -1217,6 +1260,7 @@ func (keeper *OVNNorthboundKeeper) Mark(ctx context.Context) {
 		&db.DHCPOptions,
 		&db.QoS,
 		&db.DNS,
+		&db.Meter,
 	}
 	for _, itbl := range itbls {
 		for _, irow := range itbl.Rows() {
@@ -1235,6 +1279,7 @@ func (keeper *OVNNorthboundKeeper) Sweep(ctx context.Context) error {
 		&db.LogicalRouter,
 		&db.DHCPOptions,
 		&db.DNS,
+		&db.Meter,
 	}
 	var irows []types.IRow
 	for _, itbl := range itbls {
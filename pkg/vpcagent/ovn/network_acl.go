@@ -0,0 +1,146 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"yunion.io/x/ovsdb/schema/ovn_nb"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/secrules"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+const (
+	errBadNetworkAclRule = errors.Error("bad network acl rule")
+)
+
+// Network acl rules are matched against traffic crossing the router port of
+// the subnet's logical switch, while security group rules are matched
+// against guest ports.  The two never share a match, so network acls live in
+// a priority band of their own above security group acls.
+//
+// A rule with smaller priority is more preferred, it's mapped to higher ovn
+// acl priority.  The band base itself is taken by the implicit deny
+//
+// Unlike the stateless network acls of public clouds, the rules here are
+// stateful: the ovn northbound schema we build against has no
+// allow-stateless action.  Allow rules are mapped to allow-related so that
+// the admitted connections are committed to conntrack, their replies are
+// then passed by the established traffic flows ovn installs above all acls,
+// no matter whether the rules of the other direction or the implicit deny
+// would drop them.  Plain allow is not used, it's only stateful when some
+// other acl of the switch happens to be, and replies would be dropped by
+// the implicit deny otherwise
+const (
+	networkAclPriorityBase = 3000
+)
+
+func networkAclRulePriority(rule *computeapi.SNetworkAclRule) int64 {
+	return int64(networkAclPriorityBase + computeapi.NetworkAclRuleMaxPriority + 1 - rule.Priority)
+}
+
+// networkAclRuleToAcl converts a subnet level acl rule.  Traffic entering
+// the subnet comes in from the router port, traffic leaving the subnet goes
+// out to it
+func networkAclRuleToAcl(routerLport string, rule *computeapi.SNetworkAclRule, enableIPv6 bool) (*ovn_nb.ACL, error) {
+	var (
+		dir     string
+		action  string
+		matches []string
+		l3subfn string
+	)
+	switch secrules.TSecurityRuleDirection(rule.Direction) {
+	case secrules.SecurityRuleIngress:
+		dir = aclDirFromLport
+		l3subfn = "src"
+		matches = append(matches, fmt.Sprintf("inport == %q", routerLport))
+	case secrules.SecurityRuleEgress:
+		dir = aclDirToLport
+		l3subfn = "dst"
+		matches = append(matches, fmt.Sprintf("outport == %q", routerLport))
+	default:
+		return nil, errors.Wrapf(errBadNetworkAclRule, "unknown direction %q", rule.Direction)
+	}
+	switch secrules.TSecurityRuleAction(rule.Action) {
+	case secrules.SecurityRuleAllow:
+		action = "allow-related"
+	case secrules.SecurityRuleDeny:
+		action = "drop"
+	default:
+		return nil, errors.Wrapf(errBadNetworkAclRule, "unknown action %q", rule.Action)
+	}
+	protocol := rule.Protocol
+	if protocol == "" {
+		protocol = secrules.PROTO_ANY
+	}
+	protoMatches, err := aclProtoMatches(protocol, rule.Cidr, rule.Ports, l3subfn, "dst", enableIPv6)
+	if err != nil {
+		return nil, err
+	}
+	matches = append(matches, protoMatches...)
+	acl := &ovn_nb.ACL{
+		Priority:  networkAclRulePriority(rule),
+		Direction: dir,
+		Match:     strings.Join(matches, " && "),
+		Action:    action,
+	}
+	return acl, nil
+}
+
+// networkAclDefaultDenyAcls returns acls dropping ip traffic not matched by
+// any rule.  Neighbor discovery is left alone so that ipv6 keeps working
+func networkAclDefaultDenyAcls(routerLport string, enableIPv6 bool) []*ovn_nb.ACL {
+	l3match := "ip4"
+	if enableIPv6 {
+		l3match = "(ip4 || (ip6 && !nd && !nd_rs && !nd_ra))"
+	}
+	return []*ovn_nb.ACL{
+		{
+			Priority:  networkAclPriorityBase,
+			Direction: aclDirFromLport,
+			Match:     fmt.Sprintf("inport == %q && %s", routerLport, l3match),
+			Action:    "drop",
+		},
+		{
+			Priority:  networkAclPriorityBase,
+			Direction: aclDirToLport,
+			Match:     fmt.Sprintf("outport == %q && %s", routerLport, l3match),
+			Action:    "drop",
+		},
+	}
+}
+
+// networkAclToAcls converts all rules of a network acl, rules ordered by
+// priority, with the implicit deny appended
+func networkAclToAcls(routerLport string, rules computeapi.SNetworkAclRules, enableIPv6 bool) ([]*ovn_nb.ACL, error) {
+	rules = append(computeapi.SNetworkAclRules{}, rules...)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Priority < rules[j].Priority
+	})
+	acls := make([]*ovn_nb.ACL, 0, len(rules)+2)
+	for i := range rules {
+		acl, err := networkAclRuleToAcl(routerLport, &rules[i], enableIPv6)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule priority %d", rules[i].Priority)
+		}
+		acls = append(acls, acl)
+	}
+	acls = append(acls, networkAclDefaultDenyAcls(routerLport, enableIPv6)...)
+	return acls, nil
+}
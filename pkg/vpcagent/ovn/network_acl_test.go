@@ -0,0 +1,163 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/ovsdb/schema/ovn_nb"
+	"yunion.io/x/pkg/util/secrules"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+func TestNetworkAclRuleToAcl(t *testing.T) {
+	lport := "rp-net0"
+	cases := []struct {
+		name string
+		rule computeapi.SNetworkAclRule
+		ipv6 bool
+		acl  *ovn_nb.ACL
+	}{
+		{
+			name: "ingress allow ssh from cidr",
+			rule: computeapi.SNetworkAclRule{
+				Priority:  1,
+				Direction: string(secrules.SecurityRuleIngress),
+				Action:    string(secrules.SecurityRuleAllow),
+				Protocol:  secrules.PROTO_TCP,
+				Cidr:      "10.0.0.0/8",
+				Ports:     "22",
+			},
+			acl: &ovn_nb.ACL{
+				Direction: aclDirFromLport,
+				Action:    "allow-related",
+				Match:     fmt.Sprintf("inport == %q && ip4 && ip4.src == 10.0.0.0/8 && tcp && tcp.dst == 22", lport),
+				Priority:  4000,
+			},
+		},
+		{
+			name: "egress deny udp port range",
+			rule: computeapi.SNetworkAclRule{
+				Priority:  1000,
+				Direction: string(secrules.SecurityRuleEgress),
+				Action:    string(secrules.SecurityRuleDeny),
+				Protocol:  secrules.PROTO_UDP,
+				Cidr:      "192.168.1.0/24",
+				Ports:     "1000-2000",
+			},
+			acl: &ovn_nb.ACL{
+				Direction: aclDirToLport,
+				Action:    "drop",
+				Match:     fmt.Sprintf("outport == %q && ip4 && ip4.dst == 192.168.1.0/24 && udp && ( udp.dst >= 1000 && udp.dst <= 2000 )", lport),
+				Priority:  3001,
+			},
+		},
+		{
+			name: "ingress allow any with empty protocol",
+			rule: computeapi.SNetworkAclRule{
+				Priority:  500,
+				Direction: string(secrules.SecurityRuleIngress),
+				Action:    string(secrules.SecurityRuleAllow),
+			},
+			ipv6: true,
+			acl: &ovn_nb.ACL{
+				Direction: aclDirFromLport,
+				Action:    "allow-related",
+				Match:     fmt.Sprintf("inport == %q && (ip4 || ip6)", lport),
+				Priority:  3501,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := networkAclRuleToAcl(lport, &c.rule, c.ipv6)
+			if err != nil {
+				t.Fatalf("networkAclRuleToAcl: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.acl) {
+				t.Errorf("want: %s got: %s", jsonutils.Marshal(c.acl), jsonutils.Marshal(got))
+			}
+		})
+	}
+}
+
+func TestNetworkAclToAcls(t *testing.T) {
+	lport := "rp-net0"
+	rules := computeapi.SNetworkAclRules{
+		{Priority: 200, Direction: "in", Action: "allow", Protocol: "any"},
+		{Priority: 100, Direction: "in", Action: "deny", Protocol: "icmp"},
+	}
+	acls, err := networkAclToAcls(lport, rules, false)
+	if err != nil {
+		t.Fatalf("networkAclToAcls: %v", err)
+	}
+	if len(acls) != 4 {
+		t.Fatalf("want 4 acls, got %d", len(acls))
+	}
+	if acls[0].Action != "drop" || acls[0].Priority <= acls[1].Priority {
+		t.Errorf("rule with smaller priority should come first with higher ovn priority: %s", jsonutils.Marshal(acls))
+	}
+	for _, acl := range acls[2:] {
+		if acl.Action != "drop" || acl.Priority != networkAclPriorityBase {
+			t.Errorf("bad implicit deny acl: %s", jsonutils.Marshal(acl))
+		}
+	}
+	if rules[0].Priority != 200 {
+		t.Errorf("input rules should not be reordered")
+	}
+}
+
+// TestNetworkAclReplyTraffic checks that replies of connections admitted in
+// one direction need no rule of the other: allows are committed to conntrack
+// and the replies are passed by ovn's established flows above all acls, even
+// though the other direction denies everything
+func TestNetworkAclReplyTraffic(t *testing.T) {
+	lport := "rp-net0"
+	rules := computeapi.SNetworkAclRules{
+		{Priority: 1, Direction: "out", Action: "deny", Protocol: "any"},
+		{Priority: 10, Direction: "in", Action: "allow", Protocol: "tcp", Ports: "80"},
+	}
+	acls, err := networkAclToAcls(lport, rules, true)
+	if err != nil {
+		t.Fatalf("networkAclToAcls: %v", err)
+	}
+	allows := 0
+	for _, acl := range acls {
+		switch acl.Action {
+		case "allow-related":
+			allows++
+			if acl.Direction != aclDirFromLport {
+				t.Errorf("unexpected allow acl of egress: %s", jsonutils.Marshal(acl))
+			}
+		case "drop":
+		default:
+			// a stateless allow would leave the replies to the egress deny
+			t.Errorf("allow acl must be stateful: %s", jsonutils.Marshal(acl))
+		}
+		// acls never look into conntrack state, the established flows of
+		// ovn take the replies before any acl
+		if strings.Contains(acl.Match, "ct.") {
+			t.Errorf("acl should not match conntrack state: %s", jsonutils.Marshal(acl))
+		}
+	}
+	if allows != 1 {
+		t.Errorf("want 1 allow acl, got %d: %s", allows, jsonutils.Marshal(acls))
+	}
+}
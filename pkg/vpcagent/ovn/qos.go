@@ -0,0 +1,120 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"fmt"
+
+	"yunion.io/x/ovsdb/schema/ovn_nb"
+
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+)
+
+// qosSpec describes ovn qos rules of an endpoint.  toGuest and fromGuest are
+// for Bandwidth column of rows matching traffic in each direction, nil means
+// no limit.  Dscp marking only applies to traffic sent by the guest
+//
+// Packet rate limits are not expressible with ovn qos rules, they are
+// realised by host side of the vif instead
+type qosSpec struct {
+	toGuest         map[string]int64
+	fromGuest       map[string]int64
+	fromGuestAction map[string]int64
+}
+
+// qosBandwidth converts Mbps and Mb to kbps and kbits that ovn expects
+func qosBandwidth(mbps, burstMb int) map[string]int64 {
+	if mbps <= 0 {
+		return nil
+	}
+	return map[string]int64{
+		"rate":  int64(mbps) * 1000,
+		"burst": int64(burstMb) * 1000,
+	}
+}
+
+func legacyQosSpec(bwMbps int) *qosSpec {
+	if bwMbps <= 0 {
+		return nil
+	}
+	bw := qosBandwidth(bwMbps, bwMbps*2)
+	return &qosSpec{
+		toGuest:   bw,
+		fromGuest: bw,
+	}
+}
+
+func qosPolicySpec(policy *agentmodels.QosPolicy) *qosSpec {
+	desc := policy.GetDesc()
+	spec := &qosSpec{
+		toGuest:   qosBandwidth(desc.IngressBandwidth, desc.GetIngressBurst()),
+		fromGuest: qosBandwidth(desc.EgressBandwidth, desc.GetEgressBurst()),
+	}
+	if desc.HasDscp() {
+		spec.fromGuestAction = map[string]int64{
+			"dscp": int64(desc.Dscp),
+		}
+	}
+	if spec.toGuest == nil && spec.fromGuest == nil && spec.fromGuestAction == nil {
+		return nil
+	}
+	return spec
+}
+
+// guestnetworkQosSpec prefers qos policy of the nic, then that of the
+// network, and at last bandwidth limit of the nic.  Disabled policies are
+// skipped, the same order as the host applies to the nic
+func guestnetworkQosSpec(guestnetwork *agentmodels.Guestnetwork) *qosSpec {
+	if policy := guestnetwork.QosPolicy; policy != nil {
+		return qosPolicySpec(policy)
+	}
+	if policy := guestnetwork.Network.QosPolicy; policy != nil {
+		return qosPolicySpec(policy)
+	}
+	return legacyQosSpec(guestnetwork.BwLimit)
+}
+
+func eipQosSpec(eip *agentmodels.Elasticip) *qosSpec {
+	if policy := eip.QosPolicy; policy != nil {
+		return qosPolicySpec(policy)
+	}
+	return legacyQosSpec(eip.Bandwidth)
+}
+
+// qosRow returns nil if there is nothing to enforce.  Rows are matched
+// against existing ones by non-zero columns, the content is appended to the
+// oc-ref so that a row with limits or marking dropped won't match a stale one
+func qosRow(priority int64, direction, match, ocRef string, bandwidth, action map[string]int64) *ovn_nb.QoS {
+	if len(bandwidth) == 0 && len(action) == 0 {
+		return nil
+	}
+	ref := ocRef
+	if len(bandwidth) > 0 {
+		ref += fmt.Sprintf("/r%db%d", bandwidth["rate"], bandwidth["burst"])
+	}
+	if dscp, ok := action["dscp"]; ok {
+		ref += fmt.Sprintf("/d%d", dscp)
+	}
+	return &ovn_nb.QoS{
+		Priority:  priority,
+		Direction: direction,
+		Match:     match,
+		Bandwidth: bandwidth,
+		Action:    action,
+		ExternalIds: map[string]string{
+			externalKeyOcRef: ref,
+		},
+	}
+}
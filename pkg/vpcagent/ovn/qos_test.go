@@ -0,0 +1,93 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"reflect"
+	"testing"
+
+	"yunion.io/x/jsonutils"
+
+	computeapis "yunion.io/x/onecloud/pkg/apis/compute"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+)
+
+func TestQosPolicySpec(t *testing.T) {
+	policy := &agentmodels.QosPolicy{}
+	policy.IngressBandwidth = 100
+	policy.EgressBandwidth = 50
+	policy.EgressBurst = 200
+	policy.Dscp = 46
+
+	spec := qosPolicySpec(policy)
+	want := &qosSpec{
+		toGuest:         map[string]int64{"rate": 100000, "burst": 200000},
+		fromGuest:       map[string]int64{"rate": 50000, "burst": 200000},
+		fromGuestAction: map[string]int64{"dscp": 46},
+	}
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("want %#v, got %#v", want, spec)
+	}
+
+	policy = &agentmodels.QosPolicy{}
+	policy.Dscp = computeapis.QosPolicyDscpNone
+	policy.IngressPps = 1000
+	if spec := qosPolicySpec(policy); spec != nil {
+		t.Errorf("packet rate only policy should have no ovn qos, got %#v", spec)
+	}
+}
+
+func TestQosRow(t *testing.T) {
+	if row := qosRow(1000, "to-lport", "outport == \"p\"", "qos/x", nil, nil); row != nil {
+		t.Errorf("empty qos row should be nil, got %s", jsonutils.Marshal(row))
+	}
+	rowBw := qosRow(2000, "from-lport", "inport == \"p\"", "qos/x", qosBandwidth(10, 20), nil)
+	rowBwDscp := qosRow(2000, "from-lport", "inport == \"p\"", "qos/x", qosBandwidth(10, 20), map[string]int64{"dscp": 10})
+	if rowBw == nil || rowBwDscp == nil {
+		t.Fatalf("qos row should not be nil")
+	}
+	if rowBw.ExternalIds[externalKeyOcRef] != "qos/x/r10000b20000" {
+		t.Errorf("unexpected oc ref %q", rowBw.ExternalIds[externalKeyOcRef])
+	}
+	if rowBw.ExternalIds[externalKeyOcRef] == rowBwDscp.ExternalIds[externalKeyOcRef] {
+		t.Errorf("rows with different marking should have different oc ref")
+	}
+}
+
+func TestGuestnetworkQosSpec(t *testing.T) {
+	netPolicy := &agentmodels.QosPolicy{}
+	netPolicy.IngressBandwidth = 10
+	nicPolicy := &agentmodels.QosPolicy{}
+	nicPolicy.IngressBandwidth = 20
+
+	// the disabled policy of the nic is not joined, that of the network applies
+	gn := &agentmodels.Guestnetwork{
+		Network: &agentmodels.Network{QosPolicy: netPolicy},
+	}
+	gn.QosPolicyId = "disabled"
+	gn.BwLimit = 30
+	if spec := guestnetworkQosSpec(gn); spec == nil || spec.toGuest["rate"] != 10000 {
+		t.Errorf("expect qos policy of network, got %#v", spec)
+	}
+	gn.QosPolicy = nicPolicy
+	if spec := guestnetworkQosSpec(gn); spec == nil || spec.toGuest["rate"] != 20000 {
+		t.Errorf("expect qos policy of nic, got %#v", spec)
+	}
+	gn.QosPolicy = nil
+	gn.Network.QosPolicy = nil
+	if spec := guestnetworkQosSpec(gn); spec == nil || spec.toGuest["rate"] != 30000 {
+		t.Errorf("expect bandwidth limit of nic, got %#v", spec)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/ovsdb/schema/ovn_nb"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/netutils"
+	"yunion.io/x/pkg/util/secrules"
+
+	computeapis "yunion.io/x/onecloud/pkg/apis/compute"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+)
+
+const (
+	errBadRoutePolicy = errors.Error("bad route policy")
+)
+
+// Route policies are installed on the vpc logical router.  A policy with
+// smaller priority is more preferred, it's mapped to higher ovn priority
+const (
+	routePolicyPriorityBase = 1000
+)
+
+func routePolicyPriority(policy *computeapis.SRoutePolicy) int64 {
+	return int64(routePolicyPriorityBase + computeapis.RoutePolicyMaxPriority + 1 - policy.Priority)
+}
+
+type resolvedRoutePolicy struct {
+	Policy  *computeapis.SRoutePolicy
+	NextHop string
+	// Router port facing the next hop.  Traffic coming back from it must
+	// not be steered again
+	NextHopPort string
+}
+
+func routePolicyToLrp(rp *resolvedRoutePolicy) (*ovn_nb.LogicalRouterPolicy, error) {
+	policy := rp.Policy
+	protocol := policy.Protocol
+	if protocol == "" {
+		protocol = secrules.PROTO_ANY
+	}
+	protoMatches, err := aclProtoMatches(protocol, "", policy.Ports, "src", "dst", false)
+	if err != nil {
+		return nil, err
+	}
+	// the first is the l3 match, insert address matches right after it
+	matches := []string{protoMatches[0]}
+	if policy.SrcCidr != "" {
+		matches = append(matches, fmt.Sprintf("ip4.src == %s", policy.SrcCidr))
+	}
+	if policy.DstCidr != "" {
+		matches = append(matches, fmt.Sprintf("ip4.dst == %s", policy.DstCidr))
+	}
+	matches = append(matches, protoMatches[1:]...)
+
+	lrp := &ovn_nb.LogicalRouterPolicy{
+		Priority: routePolicyPriority(policy),
+	}
+	switch policy.Action {
+	case computeapis.ROUTE_POLICY_ACTION_REROUTE:
+		if rp.NextHop == "" {
+			return nil, errors.Wrapf(errBadRoutePolicy, "priority %d: empty next hop", policy.Priority)
+		}
+		if rp.NextHopPort != "" {
+			matches = append(matches, fmt.Sprintf("inport != %q", rp.NextHopPort))
+		}
+		lrp.Action = "reroute"
+		lrp.Nexthop = ptr(rp.NextHop)
+	case computeapis.ROUTE_POLICY_ACTION_DROP:
+		lrp.Action = "drop"
+	case computeapis.ROUTE_POLICY_ACTION_ALLOW:
+		lrp.Action = "allow"
+	default:
+		return nil, errors.Wrapf(errBadRoutePolicy, "priority %d: unknown action %q", policy.Priority, policy.Action)
+	}
+	lrp.Match = strings.Join(matches, " && ")
+	return lrp, nil
+}
+
+func vpcNetworkOfIp(vpc *agentmodels.Vpc, ip string) *agentmodels.Network {
+	addr, err := netutils.NewIPV4Addr(ip)
+	if err != nil {
+		return nil
+	}
+	for _, network := range vpc.Networks {
+		if addr.NetAddr(network.GuestIpMask) == network.GetNetAddr() {
+			return network
+		}
+	}
+	return nil
+}
+
+func isIpv6(s string) bool {
+	return strings.Contains(s, ":")
+}
+
+// resolveRoutePolicies resolves next hops of reroute policies.  Policies
+// that cannot be resolved, or that involve ipv6 addresses, are skipped as
+// only ipv4 matches are generated
+func resolveRoutePolicies(vpc *agentmodels.Vpc, mss *agentmodels.ModelSets) []*resolvedRoutePolicy {
+	if vpc.RouteTable == nil || vpc.RouteTable.Policies == nil {
+		return nil
+	}
+	var r []*resolvedRoutePolicy
+	for _, policy := range *vpc.RouteTable.Policies {
+		if isIpv6(policy.SrcCidr) || isIpv6(policy.DstCidr) ||
+			(policy.NextHopType == computeapis.NEXT_HOP_TYPE_IP && isIpv6(policy.NextHopId)) {
+			log.Warningf("vpc %s(%s): ipv6 route policy %d is not supported, skip",
+				vpc.Name, vpc.Id, policy.Priority)
+			continue
+		}
+		rp := &resolvedRoutePolicy{
+			Policy: policy,
+		}
+		if policy.Action == computeapis.ROUTE_POLICY_ACTION_REROUTE {
+			switch policy.NextHopType {
+			case computeapis.NEXT_HOP_TYPE_IP:
+				rp.NextHop = policy.NextHopId
+				if network := vpcNetworkOfIp(vpc, policy.NextHopId); network != nil {
+					rp.NextHopPort = netRnpName(network.Id)
+				}
+			case computeapis.NEXT_HOP_TYPE_INSTANCE:
+				guest, ok := mss.Guests[policy.NextHopId]
+				if !ok {
+					break
+				}
+				// the first nic of the guest in this vpc
+				var gnFound *agentmodels.Guestnetwork
+				for _, gn := range guest.Guestnetworks {
+					if gn.Network == nil || gn.Network.Vpc == nil || gn.Network.Vpc.Id != vpc.Id {
+						continue
+					}
+					if gnFound == nil || gn.Index < gnFound.Index {
+						gnFound = gn
+					}
+				}
+				if gnFound != nil {
+					rp.NextHop = gnFound.IpAddr
+					rp.NextHopPort = netRnpName(gnFound.Network.Id)
+				}
+			case computeapis.NEXT_HOP_TYPE_NAT:
+				// snat happens on the external gateway the same way as
+				// the default route of the vpc
+				if vpcHasDistgw(vpc) || vpcHasEipgw(vpc) {
+					rp.NextHop = computeapis.VpcInterExtIP2().String()
+					rp.NextHopPort = vpcR1extpName(vpc.Id)
+				}
+			}
+			if rp.NextHop == "" {
+				log.Warningf("vpc %s(%s): cannot resolve next hop of route policy %d, skip",
+					vpc.Name, vpc.Id, policy.Priority)
+				continue
+			}
+		}
+		r = append(r, rp)
+	}
+	return r
+}
+
+func routePolicyKey(lrp *ovn_nb.LogicalRouterPolicy) string {
+	nexthop := ""
+	if lrp.Nexthop != nil {
+		nexthop = *lrp.Nexthop
+	}
+	return fmt.Sprintf("%d/%s/%s/%s", lrp.Priority, lrp.Action, lrp.Match, nexthop)
+}
+
+// routePoliciesEqual compares policies regardless of order
+func routePoliciesEqual(a, b []*ovn_nb.LogicalRouterPolicy) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	keys := func(lrps []*ovn_nb.LogicalRouterPolicy) []string {
+		r := make([]string, len(lrps))
+		for i, lrp := range lrps {
+			r[i] = routePolicyKey(lrp)
+		}
+		sort.Strings(r)
+		return r
+	}
+	ka, kb := keys(a), keys(b)
+	for i := range ka {
+		if ka[i] != kb[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/ovsdb/schema/ovn_nb"
+
+	computeapis "yunion.io/x/onecloud/pkg/apis/compute"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+)
+
+func TestRoutePolicyToLrp(t *testing.T) {
+	cases := []struct {
+		name string
+		rp   *resolvedRoutePolicy
+		lrp  *ovn_nb.LogicalRouterPolicy
+	}{
+		{
+			name: "reroute web traffic to firewall",
+			rp: &resolvedRoutePolicy{
+				Policy: &computeapis.SRoutePolicy{
+					Priority: 1,
+					SrcCidr:  "10.0.1.0/24",
+					Protocol: "tcp",
+					Ports:    "80,443",
+					Action:   computeapis.ROUTE_POLICY_ACTION_REROUTE,
+				},
+				NextHop:     "10.0.0.5",
+				NextHopPort: netRnpName("net0"),
+			},
+			lrp: &ovn_nb.LogicalRouterPolicy{
+				Priority: 2000,
+				Action:   "reroute",
+				Nexthop:  ptr("10.0.0.5"),
+				Match:    fmt.Sprintf("ip4 && ip4.src == 10.0.1.0/24 && tcp && ( tcp.dst == 80 || tcp.dst == 443 ) && inport != %q", netRnpName("net0")),
+			},
+		},
+		{
+			name: "drop traffic between subnets",
+			rp: &resolvedRoutePolicy{
+				Policy: &computeapis.SRoutePolicy{
+					Priority: 1000,
+					SrcCidr:  "10.0.1.0/24",
+					DstCidr:  "10.0.2.0/24",
+					Action:   computeapis.ROUTE_POLICY_ACTION_DROP,
+				},
+			},
+			lrp: &ovn_nb.LogicalRouterPolicy{
+				Priority: 1001,
+				Action:   "drop",
+				Match:    "ip4 && ip4.src == 10.0.1.0/24 && ip4.dst == 10.0.2.0/24",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := routePolicyToLrp(c.rp)
+			if err != nil {
+				t.Fatalf("routePolicyToLrp: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.lrp) {
+				t.Errorf("want: %s got: %s", jsonutils.Marshal(c.lrp), jsonutils.Marshal(got))
+			}
+		})
+	}
+}
+
+func TestRoutePoliciesEqual(t *testing.T) {
+	a := []*ovn_nb.LogicalRouterPolicy{
+		{Priority: 1001, Action: "drop", Match: "ip4"},
+		{Priority: 2000, Action: "reroute", Match: "ip4", Nexthop: ptr("10.0.0.5")},
+	}
+	b := []*ovn_nb.LogicalRouterPolicy{
+		{Uuid: "u1", Priority: 2000, Action: "reroute", Match: "ip4", Nexthop: ptr("10.0.0.5")},
+		{Uuid: "u0", Priority: 1001, Action: "drop", Match: "ip4"},
+	}
+	if !routePoliciesEqual(a, b) {
+		t.Errorf("policies should be equal regardless of order and uuid")
+	}
+	b[0].Nexthop = ptr("10.0.0.6")
+	if routePoliciesEqual(a, b) {
+		t.Errorf("policies with different next hop should differ")
+	}
+}
+
+func TestResolveRoutePolicies(t *testing.T) {
+	vpc := &agentmodels.Vpc{}
+	vpc.Id = "vpc0"
+	network := &agentmodels.Network{Vpc: vpc}
+	network.Id = "net0"
+	network.GuestIpStart = "10.0.0.2"
+	network.GuestIpEnd = "10.0.0.254"
+	network.GuestIpMask = 24
+	vpc.Networks = agentmodels.Networks{network.Id: network}
+	guest := &agentmodels.Guest{}
+	guest.Id = "guest0"
+	gn := &agentmodels.Guestnetwork{Guest: guest, Network: network}
+	gn.IpAddr = "10.0.0.8"
+	guest.Guestnetworks = agentmodels.Guestnetworks{"0": gn}
+	mss := &agentmodels.ModelSets{
+		Guests: agentmodels.Guests{guest.Id: guest},
+	}
+	reroute := func(priority int, nextHopType, nextHopId string) *computeapis.SRoutePolicy {
+		return &computeapis.SRoutePolicy{
+			Priority:    priority,
+			DstCidr:     "0.0.0.0/0",
+			Action:      computeapis.ROUTE_POLICY_ACTION_REROUTE,
+			NextHopType: nextHopType,
+			NextHopId:   nextHopId,
+		}
+	}
+	policies := computeapis.SRoutePolicies{
+		reroute(1, computeapis.NEXT_HOP_TYPE_IP, "10.0.0.5"),
+		reroute(2, computeapis.NEXT_HOP_TYPE_INSTANCE, "guest0"),
+		reroute(3, computeapis.NEXT_HOP_TYPE_NAT, ""),
+		reroute(4, computeapis.NEXT_HOP_TYPE_INSTANCE, "guest-gone"),
+		reroute(5, computeapis.NEXT_HOP_TYPE_IP, "fd00::5"),
+		{Priority: 6, DstCidr: "fd00::/64", Action: computeapis.ROUTE_POLICY_ACTION_DROP},
+	}
+	vpc.RouteTable = &agentmodels.RouteTable{}
+	vpc.RouteTable.Policies = &policies
+
+	resolve := func() map[int]*resolvedRoutePolicy {
+		r := map[int]*resolvedRoutePolicy{}
+		for _, rp := range resolveRoutePolicies(vpc, mss) {
+			r[rp.Policy.Priority] = rp
+		}
+		return r
+	}
+
+	vpc.ExternalAccessMode = computeapis.VPC_EXTERNAL_ACCESS_MODE_NONE
+	got := resolve()
+	if len(got) != 2 {
+		t.Fatalf("without external gateway expect 2 policies, got %d", len(got))
+	}
+	if rp := got[1]; rp.NextHop != "10.0.0.5" || rp.NextHopPort != netRnpName("net0") {
+		t.Errorf("ip next hop resolved to %s %s", rp.NextHop, rp.NextHopPort)
+	}
+	if rp := got[2]; rp.NextHop != "10.0.0.8" || rp.NextHopPort != netRnpName("net0") {
+		t.Errorf("instance next hop resolved to %s %s", rp.NextHop, rp.NextHopPort)
+	}
+
+	vpc.ExternalAccessMode = computeapis.VPC_EXTERNAL_ACCESS_MODE_DISTGW
+	got = resolve()
+	rp, ok := got[3]
+	if len(got) != 3 || !ok {
+		t.Fatalf("with distgw expect the nat policy resolved, got %d policies", len(got))
+	}
+	if rp.NextHop != computeapis.VpcInterExtIP2().String() || rp.NextHopPort != vpcR1extpName("vpc0") {
+		t.Errorf("nat next hop resolved to %s %s", rp.NextHop, rp.NextHopPort)
+	}
+}
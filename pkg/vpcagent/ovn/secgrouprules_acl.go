@@ -46,7 +46,6 @@ func ruleToAcl(lport string, rule *agentmodels.SecurityGroupRule, enableIPv6 boo
 		matches []string
 		l3subfn string
 		l4subfn string
-		errs    []error
 	)
 
 	switch secrules.TSecurityRuleDirection(rule.Direction) {
@@ -73,13 +72,39 @@ func ruleToAcl(lport string, rule *agentmodels.SecurityGroupRule, enableIPv6 boo
 		return nil, errors.Wrapf(errBadSecgroupRule, "unknown action %q", rule.Action)
 	}
 
+	protoMatches, err := aclProtoMatches(rule.Protocol, rule.CIDR, rule.Ports, l3subfn, l4subfn, enableIPv6)
+	if err != nil {
+		return nil, err
+	}
+	matches = append(matches, protoMatches...)
+	match = strings.Join(matches, " && ")
+
+	acl := &ovn_nb.ACL{
+		Priority:  int64(rule.Priority),
+		Direction: dir,
+		Match:     match,
+		Action:    action,
+	}
+
+	return acl, nil
+}
+
+// aclProtoMatches returns l3/l4 match expressions of acl rules.  l3subfn
+// ("src" or "dst") decides which address is matched against cidr, l4subfn
+// decides which port is matched against ports
+func aclProtoMatches(protocol, cidr, ports string, l3subfn, l4subfn string, enableIPv6 bool) ([]string, error) {
+	var (
+		matches []string
+		errs    []error
+	)
+
 	addL3Match := func() {
 		if enableIPv6 {
 			matches = append(matches, "(ip4 || ip6)")
 		} else {
 			matches = append(matches, "ip4")
 		}
-		if cidr := strings.TrimSpace(rule.CIDR); cidr != "" {
+		if cidr := strings.TrimSpace(cidr); cidr != "" {
 			if regutils.MatchCIDR(cidr) {
 				matches = append(matches, fmt.Sprintf("ip4.%s == %s", l3subfn, cidr))
 			} else if regutils.MatchCIDR6(cidr) {
@@ -102,7 +127,7 @@ func ruleToAcl(lport string, rule *agentmodels.SecurityGroupRule, enableIPv6 boo
 			}
 			return int(pn), nil
 		}
-		for _, pstr := range strings.Split(rule.Ports, ",") {
+		for _, pstr := range strings.Split(ports, ",") {
 			pstr = strings.TrimSpace(pstr)
 			if pstr == "" {
 				continue
@@ -154,7 +179,7 @@ func ruleToAcl(lport string, rule *agentmodels.SecurityGroupRule, enableIPv6 boo
 			matches = append(matches, portMatch)
 		}
 	}
-	switch rule.Protocol {
+	switch protocol {
 	case "":
 		// noop
 	case "arp":
@@ -175,19 +200,10 @@ func ruleToAcl(lport string, rule *agentmodels.SecurityGroupRule, enableIPv6 boo
 			matches = append(matches, "icmp4")
 		}
 	default:
-		return nil, errors.Wrapf(errBadSecgroupRule, "unknown protocol %q", rule.Protocol)
+		return nil, errors.Wrapf(errBadSecgroupRule, "unknown protocol %q", protocol)
 	}
 	if len(errs) > 0 {
 		return nil, errors.NewAggregate(errs)
 	}
-	match = strings.Join(matches, " && ")
-
-	acl := &ovn_nb.ACL{
-		Priority:  int64(rule.Priority),
-		Direction: dir,
-		Match:     match,
-		Action:    action,
-	}
-
-	return acl, nil
+	return matches, nil
 }
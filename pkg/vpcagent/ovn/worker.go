@@ -135,11 +135,17 @@ func (w *Worker) run(ctx context.Context, mss *agentmodels.ModelSets) (err error
 			continue
 		}
 		ovndb.ClaimVpc(ctx, vpc)
+		for _, flowLog := range vpc.FlowLogs {
+			if flowLog.Enabled.Bool() {
+				ovndb.ClaimFlowLog(ctx, flowLog)
+			}
+		}
 		if vpcHasEipgw(vpc) {
 			ovndb.ClaimVpcEipgw(ctx, vpc)
 		}
 		for _, network := range vpc.Networks {
 			ovndb.ClaimNetwork(ctx, network, w.opts)
+			ovndb.ClaimNetworkAcl(ctx, network)
 			for _, guestnetwork := range network.Guestnetworks {
 				if guestnetwork.Guest == nil {
 					continue
@@ -187,6 +193,8 @@ func (w *Worker) run(ctx context.Context, mss *agentmodels.ModelSets) (err error
 		}
 		routes := resolveRoutes(vpc, mss)
 		ovndb.ClaimRoutes(ctx, vpc, routes)
+		policies := resolveRoutePolicies(vpc, mss)
+		ovndb.ClaimRoutePolicies(ctx, vpc, policies)
 	}
 	for _, vpc := range mss.Vpcs {
 		if vpc.Id == apis.DEFAULT_VPC_ID {